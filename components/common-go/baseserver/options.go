@@ -13,6 +13,7 @@ import (
 	"github.com/heptiolabs/healthcheck"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/health/grpc_health_v1"
 )
 
@@ -32,6 +33,15 @@ type options struct {
 	healthHandler healthcheck.Handler
 
 	grpcHealthCheck grpc_health_v1.HealthServer
+
+	// debugAddress is the address of the debug server, which serves pprof.
+	debugAddress string
+
+	// initializeGRPCMetrics initializes the gRPC server metrics of all registered methods when the server starts.
+	initializeGRPCMetrics bool
+
+	// unaryInterceptors are appended to the default unary interceptors of the gRPC server.
+	unaryInterceptors []grpc.UnaryServerInterceptor
 }
 
 func defaultOptions() *options {
@@ -44,6 +54,7 @@ func defaultOptions() *options {
 			},
 		},
 
+		debugAddress:    fmt.Sprintf(":%d", BuiltinDebugPort),
 		closeTimeout:    5 * time.Second,
 		healthHandler:   healthcheck.NewHandler(),
 		metricsRegistry: prometheus.NewRegistry(),
@@ -135,6 +146,43 @@ func WithGRPCHealthService(svc grpc_health_v1.HealthServer) Option {
 	}
 }
 
+// WithDebugAddress configures the address of the debug server, e.g. 127.0.0.1:6060 to only serve it on localhost.
+func WithDebugAddress(addr string) Option {
+	return func(opts *options) error {
+		if addr == "" {
+			return fmt.Errorf("empty debug address provided")
+		}
+
+		opts.debugAddress = addr
+		return nil
+	}
+}
+
+// WithInitializedGRPCMetrics initializes the gRPC server metrics of every method of the registered services with 0 when
+// the server starts. Without it, the series of a method only appear with its first call, and rates or error ratios of
+// methods which were not called yet are absent rather than 0.
+func WithInitializedGRPCMetrics() Option {
+	return func(opts *options) error {
+		opts.initializeGRPCMetrics = true
+		return nil
+	}
+}
+
+// WithGRPCUnaryInterceptors adds unary interceptors to the gRPC server. They run after the default interceptors, in the
+// order in which they are given.
+func WithGRPCUnaryInterceptors(interceptors ...grpc.UnaryServerInterceptor) Option {
+	return func(opts *options) error {
+		for _, interceptor := range interceptors {
+			if interceptor == nil {
+				return fmt.Errorf("nil grpc unary interceptor provided")
+			}
+		}
+
+		opts.unaryInterceptors = append(opts.unaryInterceptors, interceptors...)
+		return nil
+	}
+}
+
 func evaluateOptions(cfg *options, opts ...Option) (*options, error) {
 	for _, opt := range opts {
 		if err := opt(cfg); err != nil {
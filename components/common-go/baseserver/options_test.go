@@ -5,6 +5,7 @@
 package baseserver
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -12,6 +13,7 @@ import (
 	"github.com/heptiolabs/healthcheck"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/health/grpc_health_v1"
 )
 
@@ -32,6 +34,7 @@ func TestOptions(t *testing.T) {
 		WithMetricsRegistry(registry),
 		WithHealthHandler(health),
 		WithGRPCHealthService(grpcHealthService),
+		WithDebugAddress("127.0.0.1:6060"),
 	}
 	actual, err := evaluateOptions(defaultOptions(), opts...)
 	require.NoError(t, err)
@@ -44,6 +47,7 @@ func TestOptions(t *testing.T) {
 				HTTP: &httpCfg,
 			},
 		},
+		debugAddress:    "127.0.0.1:6060",
 		closeTimeout:    timeout,
 		metricsRegistry: registry,
 		healthHandler:   health,
@@ -57,3 +61,18 @@ func TestLogger_ErrorsWithNilLogger(t *testing.T) {
 	_, err := evaluateOptions(defaultOptions(), WithLogger(nil))
 	require.Error(t, err)
 }
+
+func TestGRPCUnaryInterceptors_ErrorsWithNilInterceptor(t *testing.T) {
+	_, err := evaluateOptions(defaultOptions(), WithGRPCUnaryInterceptors(nil))
+	require.Error(t, err)
+}
+
+func TestGRPCUnaryInterceptors_AreAppended(t *testing.T) {
+	interceptor := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return handler(ctx, req)
+	}
+
+	actual, err := evaluateOptions(defaultOptions(), WithGRPCUnaryInterceptors(interceptor), WithGRPCUnaryInterceptors(interceptor, interceptor))
+	require.NoError(t, err)
+	require.Len(t, actual.unaryInterceptors, 3)
+}
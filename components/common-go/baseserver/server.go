@@ -89,6 +89,7 @@ type Server struct {
 	// grpc is a grpc Server, only used when port is specified in cfg
 	grpc         *grpc.Server
 	grpcListener net.Listener
+	grpcMetrics  *grpc_prometheus.ServerMetrics
 
 	// listening indicates the server is serving. When closed, the server is in the process of graceful termination.
 	listening chan struct{}
@@ -145,6 +146,11 @@ func (s *Server) ListenAndServe() error {
 			return fmt.Errorf("failed to start gRPC server: %w", err)
 		}
 
+		if s.options.initializeGRPCMetrics {
+			// All services are registered by now.
+			s.grpcMetrics.InitializeMetrics(s.grpc)
+		}
+
 		go func() {
 			err := s.grpc.Serve(s.grpcListener)
 			if err != nil {
@@ -182,6 +188,11 @@ func (s *Server) HTTPMux() *http.ServeMux {
 	return s.httpMux
 }
 
+// DebugMux returns the handler of the debug server, to register further debug endpoints.
+func (s *Server) DebugMux() *http.ServeMux {
+	return s.builtinServices.debugMux
+}
+
 func (s *Server) GRPC() *grpc.Server {
 	return s.grpc
 }
@@ -259,6 +270,7 @@ func (s *Server) initializeGRPC() error {
 	common_grpc.SetupLogging()
 
 	grpcMetrics := grpc_prometheus.NewServerMetrics()
+	s.grpcMetrics = grpcMetrics
 	grpcMetrics.EnableHandlingTimeHistogram(
 		grpc_prometheus.WithHistogramBuckets([]float64{.005, .025, .05, .1, .5, 1, 2.5, 5, 30, 60, 120, 240, 600}),
 	)
@@ -279,6 +291,7 @@ func (s *Server) initializeGRPC() error {
 		),
 		grpcMetrics.UnaryServerInterceptor(),
 	}
+	unary = append(unary, s.options.unaryInterceptors...)
 	stream := []grpc.StreamServerInterceptor{
 		grpc_logrus.StreamServerInterceptor(s.Logger()),
 		grpcMetrics.StreamServerInterceptor(),
@@ -354,6 +367,8 @@ type builtinServices struct {
 	Debug   *http.Server
 	Health  *http.Server
 	Metrics *http.Server
+
+	debugMux *http.ServeMux
 }
 
 func newBuiltinServices(server *Server) *builtinServices {
@@ -362,12 +377,14 @@ func newBuiltinServices(server *Server) *builtinServices {
 		healthAddr = ":0"
 	}
 
+	debugMux := pprof.Handler()
 	return &builtinServices{
 		underTest: server.options.underTest,
 		Debug: &http.Server{
-			Addr:    fmt.Sprintf(":%d", BuiltinDebugPort),
-			Handler: pprof.Handler(),
+			Addr:    server.options.debugAddress,
+			Handler: debugMux,
 		},
+		debugMux: debugMux,
 		Health: &http.Server{
 			Addr:    healthAddr,
 			Handler: server.healthEndpoint(),
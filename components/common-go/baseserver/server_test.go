@@ -110,3 +110,18 @@ func TestServer_Metrics_gRPC(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, len(expected)*1, count, "expected 1 count for each metric")
 }
+
+func TestServer_Metrics_gRPC_Initialized(t *testing.T) {
+	srv := baseserver.NewForTests(t,
+		baseserver.WithGRPC(&baseserver.ServerConfiguration{
+			Address: fmt.Sprintf("localhost:%d", baseserver.MustFindFreePort(t)),
+		}),
+		baseserver.WithInitializedGRPCMetrics(),
+	)
+	baseserver.StartServerForTests(t, srv)
+
+	// Without any call, the metrics of the methods of the registered services must be present.
+	count, err := testutil.GatherAndCount(srv.MetricsRegistry(), "grpc_server_started_total", "grpc_server_handled_total")
+	require.NoError(t, err)
+	require.NotZero(t, count)
+}
@@ -16,6 +16,52 @@ export class DBCostCenter implements CostCenter {
     @Column()
     spendingLimit: number;
 
+    @Column({
+        default: "other",
+    })
+    billingStrategy: CostCenter.BillingStrategy;
+
+    @Column({
+        default: "hard",
+    })
+    spendingLimitType: CostCenter.SpendingLimitType;
+
+    @Column({
+        default: "",
+    })
+    billingCycleAnchor: string;
+
+    @Column({
+        default: "USD",
+    })
+    currency: string;
+
+    @Column({
+        default: "active",
+    })
+    state: CostCenter.State;
+
+    @Column({
+        default: "",
+    })
+    paymentFailedAt: string;
+
+    @Column({
+        default: "",
+    })
+    nextBillingTime: string;
+
+    @Column({
+        default: 0,
+    })
+    rolloverLimit: number;
+
+    @Column({
+        type: "bigint",
+        default: 0,
+    })
+    debt: number;
+
     // This column triggers the db-sync deletion mechanism. It's not intended for public consumption.
     @Column()
     deleted: boolean;
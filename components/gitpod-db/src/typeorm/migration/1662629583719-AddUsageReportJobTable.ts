@@ -0,0 +1,34 @@
+/**
+ * Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+ * Licensed under the GNU Affero General Public License (AGPL).
+ * See License-AGPL.txt in the project root for license information.
+ */
+
+import { MigrationInterface, QueryRunner } from "typeorm";
+
+export class AddUsageReportJobTable1662629583719 implements MigrationInterface {
+    public async up(queryRunner: QueryRunner): Promise<void> {
+        await queryRunner.query(
+            `CREATE TABLE IF NOT EXISTS \`d_b_usage_report_job\` (
+                \`id\` char(36) NOT NULL,
+                \`state\` varchar(255) NOT NULL,
+                \`fromTime\` timestamp(6) NOT NULL,
+                \`toTime\` timestamp(6) NOT NULL,
+                \`instancesProcessed\` bigint NOT NULL DEFAULT 0,
+                \`instancesTotal\` bigint NOT NULL DEFAULT 0,
+                \`reportId\` varchar(255) NOT NULL DEFAULT '',
+                \`error\` text NULL,
+                \`startedAt\` timestamp(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+                \`finishedAt\` timestamp(6) NULL,
+                \`_lastModified\` timestamp(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6) ON UPDATE CURRENT_TIMESTAMP(6),
+
+                INDEX \`IDX_usage_report_job__state\` (\`state\`),
+                PRIMARY KEY (\`id\`)
+            ) ENGINE=InnoDB`,
+        );
+    }
+
+    public async down(queryRunner: QueryRunner): Promise<void> {
+        await queryRunner.query(`DROP TABLE \`d_b_usage_report_job\``);
+    }
+}
@@ -0,0 +1,28 @@
+/**
+ * Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+ * Licensed under the GNU Affero General Public License (AGPL).
+ * See License-AGPL.txt in the project root for license information.
+ */
+
+import { MigrationInterface, QueryRunner } from "typeorm";
+
+export class AddCostCenterPlanChangeTable1663058270482 implements MigrationInterface {
+    public async up(queryRunner: QueryRunner): Promise<void> {
+        await queryRunner.query(
+            `CREATE TABLE IF NOT EXISTS \`d_b_cost_center_plan_change\` (
+                \`id\` char(36) NOT NULL,
+                \`attributionId\` varchar(255) NOT NULL,
+                \`plan\` varchar(255) NOT NULL,
+                \`effectiveTime\` varchar(255) NOT NULL,
+                \`_lastModified\` timestamp(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6) ON UPDATE CURRENT_TIMESTAMP(6),
+
+                INDEX \`IDX_cost_center_plan_change__attributionId\` (\`attributionId\`),
+                PRIMARY KEY (\`id\`)
+            ) ENGINE=InnoDB`,
+        );
+    }
+
+    public async down(queryRunner: QueryRunner): Promise<void> {
+        await queryRunner.query(`DROP TABLE \`d_b_cost_center_plan_change\``);
+    }
+}
@@ -0,0 +1,28 @@
+/**
+ * Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+ * Licensed under the GNU Affero General Public License (AGPL).
+ * See License-AGPL.txt in the project root for license information.
+ */
+
+import { MigrationInterface, QueryRunner } from "typeorm";
+
+export class AddStripeWebhookEventTable1663404522716 implements MigrationInterface {
+    public async up(queryRunner: QueryRunner): Promise<void> {
+        await queryRunner.query(
+            `CREATE TABLE IF NOT EXISTS \`d_b_stripe_webhook_event\` (
+                \`eventId\` varchar(255) NOT NULL,
+                \`eventType\` varchar(255) NOT NULL,
+                \`processedAt\` varchar(255) NOT NULL,
+                \`expiresAt\` varchar(255) NOT NULL,
+                \`_lastModified\` timestamp(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6) ON UPDATE CURRENT_TIMESTAMP(6),
+
+                INDEX \`IDX_stripe_webhook_event__expiresAt\` (\`expiresAt\`),
+                PRIMARY KEY (\`eventId\`)
+            ) ENGINE=InnoDB`,
+        );
+    }
+
+    public async down(queryRunner: QueryRunner): Promise<void> {
+        await queryRunner.query(`DROP TABLE \`d_b_stripe_webhook_event\``);
+    }
+}
@@ -0,0 +1,27 @@
+/**
+ * Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+ * Licensed under the GNU Affero General Public License (AGPL).
+ * See License-AGPL.txt in the project root for license information.
+ */
+
+import { MigrationInterface, QueryRunner } from "typeorm";
+
+export class AddBudgetNotificationTable1663749125307 implements MigrationInterface {
+    public async up(queryRunner: QueryRunner): Promise<void> {
+        await queryRunner.query(
+            `CREATE TABLE IF NOT EXISTS \`d_b_budget_notification\` (
+                \`attributionId\` varchar(255) NOT NULL,
+                \`billingPeriodStart\` varchar(255) NOT NULL,
+                \`thresholdPercent\` int NOT NULL,
+                \`notifiedAt\` varchar(255) NOT NULL,
+                \`_lastModified\` timestamp(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6) ON UPDATE CURRENT_TIMESTAMP(6),
+
+                PRIMARY KEY (\`attributionId\`, \`billingPeriodStart\`, \`thresholdPercent\`)
+            ) ENGINE=InnoDB`,
+        );
+    }
+
+    public async down(queryRunner: QueryRunner): Promise<void> {
+        await queryRunner.query(`DROP TABLE \`d_b_budget_notification\``);
+    }
+}
@@ -0,0 +1,31 @@
+/**
+ * Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+ * Licensed under the GNU Affero General Public License (AGPL).
+ * See License-AGPL.txt in the project root for license information.
+ */
+
+import { MigrationInterface, QueryRunner } from "typeorm";
+
+export class AddCachedBalanceTable1664094541188 implements MigrationInterface {
+    public async up(queryRunner: QueryRunner): Promise<void> {
+        await queryRunner.query(
+            `CREATE TABLE IF NOT EXISTS \`d_b_cached_balance\` (
+                \`attributionId\` varchar(255) NOT NULL,
+                \`version\` bigint NOT NULL DEFAULT 0,
+                \`computedVersion\` bigint NOT NULL DEFAULT 0,
+                \`billingPeriodStart\` varchar(255) NOT NULL DEFAULT '',
+                \`validUntil\` varchar(255) NOT NULL DEFAULT '',
+                \`creditsUsed\` bigint NOT NULL DEFAULT 0,
+                \`creditsCovered\` bigint NOT NULL DEFAULT 0,
+                \`creditsGrantedRemaining\` bigint NOT NULL DEFAULT 0,
+                \`_lastModified\` timestamp(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6) ON UPDATE CURRENT_TIMESTAMP(6),
+
+                PRIMARY KEY (\`attributionId\`)
+            ) ENGINE=InnoDB`,
+        );
+    }
+
+    public async down(queryRunner: QueryRunner): Promise<void> {
+        await queryRunner.query(`DROP TABLE \`d_b_cached_balance\``);
+    }
+}
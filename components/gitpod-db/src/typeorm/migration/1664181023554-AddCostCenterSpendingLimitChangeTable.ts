@@ -0,0 +1,30 @@
+/**
+ * Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+ * Licensed under the GNU Affero General Public License (AGPL).
+ * See License-AGPL.txt in the project root for license information.
+ */
+
+import { MigrationInterface, QueryRunner } from "typeorm";
+
+export class AddCostCenterSpendingLimitChangeTable1664181023554 implements MigrationInterface {
+    public async up(queryRunner: QueryRunner): Promise<void> {
+        await queryRunner.query(
+            `CREATE TABLE IF NOT EXISTS \`d_b_cost_center_spending_limit_change\` (
+                \`id\` char(36) NOT NULL,
+                \`attributionId\` varchar(255) NOT NULL,
+                \`oldSpendingLimit\` int NOT NULL,
+                \`newSpendingLimit\` int NOT NULL,
+                \`actor\` varchar(255) NOT NULL,
+                \`reason\` varchar(255) NOT NULL DEFAULT '',
+                \`changeTime\` timestamp(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+
+                PRIMARY KEY (\`id\`),
+                KEY \`ind_attributionId_changeTime\` (\`attributionId\`, \`changeTime\`)
+            ) ENGINE=InnoDB`,
+        );
+    }
+
+    public async down(queryRunner: QueryRunner): Promise<void> {
+        await queryRunner.query(`DROP TABLE \`d_b_cost_center_spending_limit_change\``);
+    }
+}
@@ -0,0 +1,30 @@
+/**
+ * Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+ * Licensed under the GNU Affero General Public License (AGPL).
+ * See License-AGPL.txt in the project root for license information.
+ */
+
+import { MigrationInterface, QueryRunner } from "typeorm";
+
+export class AddAttributionMigrationTable1664267432915 implements MigrationInterface {
+    public async up(queryRunner: QueryRunner): Promise<void> {
+        await queryRunner.query(
+            `CREATE TABLE IF NOT EXISTS \`d_b_attribution_migration\` (
+                \`id\` char(36) NOT NULL,
+                \`fromAttributionId\` varchar(255) NOT NULL,
+                \`toAttributionId\` varchar(255) NOT NULL,
+                \`actor\` varchar(255) NOT NULL,
+                \`reason\` varchar(255) NOT NULL DEFAULT '',
+                \`usageEntries\` bigint NOT NULL DEFAULT 0,
+                \`workspaceInstanceUsageEntries\` bigint NOT NULL DEFAULT 0,
+                \`migrationTime\` timestamp(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+
+                PRIMARY KEY (\`id\`)
+            ) ENGINE=InnoDB`,
+        );
+    }
+
+    public async down(queryRunner: QueryRunner): Promise<void> {
+        await queryRunner.query(`DROP TABLE \`d_b_attribution_migration\``);
+    }
+}
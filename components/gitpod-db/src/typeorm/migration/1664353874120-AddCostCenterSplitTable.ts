@@ -0,0 +1,34 @@
+/**
+ * Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+ * Licensed under the GNU Affero General Public License (AGPL).
+ * See License-AGPL.txt in the project root for license information.
+ */
+
+import { MigrationInterface, QueryRunner } from "typeorm";
+
+export class AddCostCenterSplitTable1664353874120 implements MigrationInterface {
+    public async up(queryRunner: QueryRunner): Promise<void> {
+        await queryRunner.query(
+            `CREATE TABLE IF NOT EXISTS \`d_b_cost_center_split\` (
+                \`attributionId\` varchar(255) NOT NULL,
+                \`targetAttributionId\` varchar(255) NOT NULL,
+                \`percentage\` int NOT NULL,
+                \`_lastModified\` timestamp(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6) ON UPDATE CURRENT_TIMESTAMP(6),
+
+                PRIMARY KEY (\`attributionId\`, \`targetAttributionId\`)
+            ) ENGINE=InnoDB`,
+        );
+
+        // Usage of a workspace instance is split into one entry per charged cost center.
+        await queryRunner.query(`ALTER TABLE \`d_b_usage\` DROP INDEX \`workspaceInstanceId\``);
+        await queryRunner.query(
+            `ALTER TABLE \`d_b_usage\` ADD UNIQUE \`ind_workspaceInstanceId_attributionId\` (\`workspaceInstanceId\`, \`attributionId\`)`,
+        );
+    }
+
+    public async down(queryRunner: QueryRunner): Promise<void> {
+        await queryRunner.query(`ALTER TABLE \`d_b_usage\` DROP INDEX \`ind_workspaceInstanceId_attributionId\``);
+        await queryRunner.query(`ALTER TABLE \`d_b_usage\` ADD UNIQUE (\`workspaceInstanceId\`)`);
+        await queryRunner.query(`DROP TABLE \`d_b_cost_center_split\``);
+    }
+}
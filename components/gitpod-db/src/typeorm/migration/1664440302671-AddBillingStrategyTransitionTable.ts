@@ -0,0 +1,33 @@
+/**
+ * Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+ * Licensed under the GNU Affero General Public License (AGPL).
+ * See License-AGPL.txt in the project root for license information.
+ */
+
+import { MigrationInterface, QueryRunner } from "typeorm";
+
+export class AddBillingStrategyTransitionTable1664440302671 implements MigrationInterface {
+    public async up(queryRunner: QueryRunner): Promise<void> {
+        await queryRunner.query(
+            `CREATE TABLE IF NOT EXISTS \`d_b_billing_strategy_transition\` (
+                \`id\` char(36) NOT NULL,
+                \`attributionId\` varchar(255) NOT NULL,
+                \`fromStrategy\` varchar(255) NOT NULL,
+                \`toStrategy\` varchar(255) NOT NULL,
+                \`transitionTime\` varchar(255) NOT NULL,
+                \`periodStart\` varchar(255) NOT NULL,
+                \`creditsUsed\` bigint NOT NULL DEFAULT 0,
+                \`creditsCovered\` bigint NOT NULL DEFAULT 0,
+                \`creditsGrantedRemaining\` bigint NOT NULL DEFAULT 0,
+                \`debt\` bigint NOT NULL DEFAULT 0,
+                \`_lastModified\` timestamp(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6) ON UPDATE CURRENT_TIMESTAMP(6),
+
+                PRIMARY KEY (\`id\`)
+            ) ENGINE=InnoDB`,
+        );
+    }
+
+    public async down(queryRunner: QueryRunner): Promise<void> {
+        await queryRunner.query(`DROP TABLE \`d_b_billing_strategy_transition\``);
+    }
+}
@@ -0,0 +1,49 @@
+/**
+ * Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+ * Licensed under the GNU Affero General Public License (AGPL).
+ * See License-AGPL.txt in the project root for license information.
+ */
+
+import { MigrationInterface, QueryRunner } from "typeorm";
+
+const TABLE_NAME = "d_b_usage";
+
+/**
+ * Partitions d_b_usage by the month of the effective time, such that scans of a billing period only read the
+ * partitions of the period. The usage component adds the partitions of upcoming months ahead of time, by splitting
+ * them off `pmax`.
+ *
+ * All unique keys of a partitioned table need to include the partitioning column. The primary key is extended with
+ * the effective time, and the unique key on workspace instance and attribution ID becomes a regular index. The usage
+ * component records usage of a workspace instance at most once per attribution ID instead: the ID of the usage is
+ * derived from the instance and the attribution ID, and writers read existing usage by ID with a locking read before
+ * they insert it.
+ */
+export class PartitionUsageByMonth1664612891047 implements MigrationInterface {
+    public async up(queryRunner: QueryRunner): Promise<void> {
+        await queryRunner.query(`ALTER TABLE \`${TABLE_NAME}\` DROP INDEX \`ind_workspaceInstanceId_attributionId\``);
+        await queryRunner.query(
+            `ALTER TABLE \`${TABLE_NAME}\` ADD INDEX \`IDX_usage__workspaceInstanceId_attributionId\` (\`workspaceInstanceId\`, \`attributionId\`)`,
+        );
+        await queryRunner.query(`ALTER TABLE \`${TABLE_NAME}\` DROP PRIMARY KEY, ADD PRIMARY KEY (\`id\`, \`effectiveTime\`)`);
+        await queryRunner.query(
+            `ALTER TABLE \`${TABLE_NAME}\` PARTITION BY RANGE COLUMNS(\`effectiveTime\`) (
+                PARTITION p202208 VALUES LESS THAN ('2022-09-01'),
+                PARTITION p202209 VALUES LESS THAN ('2022-10-01'),
+                PARTITION p202210 VALUES LESS THAN ('2022-11-01'),
+                PARTITION p202211 VALUES LESS THAN ('2022-12-01'),
+                PARTITION p202212 VALUES LESS THAN ('2023-01-01'),
+                PARTITION pmax VALUES LESS THAN (MAXVALUE)
+            )`,
+        );
+    }
+
+    public async down(queryRunner: QueryRunner): Promise<void> {
+        await queryRunner.query(`ALTER TABLE \`${TABLE_NAME}\` REMOVE PARTITIONING`);
+        await queryRunner.query(`ALTER TABLE \`${TABLE_NAME}\` DROP PRIMARY KEY, ADD PRIMARY KEY (\`id\`)`);
+        await queryRunner.query(`ALTER TABLE \`${TABLE_NAME}\` DROP INDEX \`IDX_usage__workspaceInstanceId_attributionId\``);
+        await queryRunner.query(
+            `ALTER TABLE \`${TABLE_NAME}\` ADD UNIQUE \`ind_workspaceInstanceId_attributionId\` (\`workspaceInstanceId\`, \`attributionId\`)`,
+        );
+    }
+}
@@ -0,0 +1,31 @@
+/**
+ * Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+ * Licensed under the GNU Affero General Public License (AGPL).
+ * See License-AGPL.txt in the project root for license information.
+ */
+
+import { MigrationInterface, QueryRunner } from "typeorm";
+
+/**
+ * The usage component moves usage older than its retention into the archive tables. They have the same columns as the
+ * tables they archive, such that rows can be moved with `INSERT ... SELECT *`.
+ */
+export class AddUsageArchiveTables1664699347605 implements MigrationInterface {
+    public async up(queryRunner: QueryRunner): Promise<void> {
+        await queryRunner.query(`CREATE TABLE IF NOT EXISTS \`d_b_usage_archive\` LIKE \`d_b_usage\``);
+        // The archive is only read per attribution ID, and is not partitioned.
+        await queryRunner.query(`ALTER TABLE \`d_b_usage_archive\` REMOVE PARTITIONING`);
+        await queryRunner.query(
+            `ALTER TABLE \`d_b_usage_archive\` ADD INDEX \`IDX_usage_archive__attributionId_effectiveTime\` (\`attributionId\`, \`effectiveTime\`)`,
+        );
+
+        await queryRunner.query(
+            `CREATE TABLE IF NOT EXISTS \`d_b_workspace_instance_usage_archive\` LIKE \`d_b_workspace_instance_usage\``,
+        );
+    }
+
+    public async down(queryRunner: QueryRunner): Promise<void> {
+        await queryRunner.query(`DROP TABLE \`d_b_workspace_instance_usage_archive\``);
+        await queryRunner.query(`DROP TABLE \`d_b_usage_archive\``);
+    }
+}
@@ -0,0 +1,35 @@
+/**
+ * Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+ * Licensed under the GNU Affero General Public License (AGPL).
+ * See License-AGPL.txt in the project root for license information.
+ */
+
+import { MigrationInterface, QueryRunner } from "typeorm";
+import { columnExists } from "./helper/helper";
+
+// The archive tables need the same columns as the tables they archive, in the same order.
+const TABLE_NAMES = [
+    "d_b_usage",
+    "d_b_usage_archive",
+    "d_b_workspace_instance_usage",
+    "d_b_workspace_instance_usage_archive",
+];
+const COLUMN_NAME = "softDeletedTime";
+
+export class AddUsageSoftDeletedTime1664785802316 implements MigrationInterface {
+    public async up(queryRunner: QueryRunner): Promise<void> {
+        for (const table of TABLE_NAMES) {
+            if (!(await columnExists(queryRunner, table, COLUMN_NAME))) {
+                await queryRunner.query(
+                    `ALTER TABLE \`${table}\` ADD COLUMN \`${COLUMN_NAME}\` varchar(255) NOT NULL DEFAULT ''`,
+                );
+            }
+        }
+    }
+
+    public async down(queryRunner: QueryRunner): Promise<void> {
+        for (const table of TABLE_NAMES) {
+            await queryRunner.query(`ALTER TABLE \`${table}\` DROP COLUMN \`${COLUMN_NAME}\``);
+        }
+    }
+}
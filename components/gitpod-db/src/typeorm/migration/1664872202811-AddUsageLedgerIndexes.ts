@@ -0,0 +1,40 @@
+/**
+ * Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+ * Licensed under the GNU Affero General Public License (AGPL).
+ * See License-AGPL.txt in the project root for license information.
+ */
+
+import { MigrationInterface, QueryRunner } from "typeorm";
+import { indexExists } from "./helper/helper";
+
+const TABLE_NAME = "d_b_usage";
+
+/**
+ * Composite indexes for the queries of the usage component: listing and summing the usage of an attribution ID in a
+ * range, finding the usage of workspace instances, and finding drafts. The usage component warns on startup when any
+ * of them is missing, see usage/pkg/db/usage_indexes.go.
+ */
+const INDEXES: { name: string; columns: string[] }[] = [
+    { name: "IDX_usage__attributionId_effectiveTime_kind", columns: ["attributionId", "effectiveTime", "kind"] },
+    { name: "IDX_usage__workspaceInstanceId_kind", columns: ["workspaceInstanceId", "kind"] },
+    { name: "IDX_usage__draft", columns: ["draft"] },
+];
+
+export class AddUsageLedgerIndexes1664872202811 implements MigrationInterface {
+    public async up(queryRunner: QueryRunner): Promise<void> {
+        for (const index of INDEXES) {
+            if (!(await indexExists(queryRunner, TABLE_NAME, index.name))) {
+                const columns = index.columns.map((column) => `\`${column}\``).join(", ");
+                await queryRunner.query(`CREATE INDEX \`${index.name}\` ON \`${TABLE_NAME}\` (${columns})`);
+            }
+        }
+    }
+
+    public async down(queryRunner: QueryRunner): Promise<void> {
+        for (const index of INDEXES) {
+            if (await indexExists(queryRunner, TABLE_NAME, index.name)) {
+                await queryRunner.query(`DROP INDEX \`${index.name}\` ON \`${TABLE_NAME}\``);
+            }
+        }
+    }
+}
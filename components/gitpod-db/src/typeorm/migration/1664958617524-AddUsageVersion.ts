@@ -0,0 +1,32 @@
+/**
+ * Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+ * Licensed under the GNU Affero General Public License (AGPL).
+ * See License-AGPL.txt in the project root for license information.
+ */
+
+import { MigrationInterface, QueryRunner } from "typeorm";
+import { columnExists } from "./helper/helper";
+
+// The archive table needs the same columns as d_b_usage, in the same order.
+const TABLE_NAMES = ["d_b_usage", "d_b_usage_archive"];
+const COLUMN_NAME = "version";
+
+/**
+ * The usage component increments the version of a usage entry on every update, and only updates entries whose version
+ * did not change since they were read.
+ */
+export class AddUsageVersion1664958617524 implements MigrationInterface {
+    public async up(queryRunner: QueryRunner): Promise<void> {
+        for (const table of TABLE_NAMES) {
+            if (!(await columnExists(queryRunner, table, COLUMN_NAME))) {
+                await queryRunner.query(`ALTER TABLE \`${table}\` ADD COLUMN \`${COLUMN_NAME}\` int NOT NULL DEFAULT 0`);
+            }
+        }
+    }
+
+    public async down(queryRunner: QueryRunner): Promise<void> {
+        for (const table of TABLE_NAMES) {
+            await queryRunner.query(`ALTER TABLE \`${table}\` DROP COLUMN \`${COLUMN_NAME}\``);
+        }
+    }
+}
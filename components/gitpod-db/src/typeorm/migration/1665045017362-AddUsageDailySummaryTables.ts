@@ -0,0 +1,27 @@
+/**
+ * Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+ * Licensed under the GNU Affero General Public License (AGPL).
+ * See License-AGPL.txt in the project root for license information.
+ */
+
+import { MigrationInterface, QueryRunner } from "typeorm";
+
+/**
+ * The usage component sums finalized usage per attribution ID, day and workspace class, such that balances do not need
+ * to scan the whole ledger. The state records up to which day the summaries of an attribution ID are complete.
+ */
+export class AddUsageDailySummaryTables1665045017362 implements MigrationInterface {
+    public async up(queryRunner: QueryRunner): Promise<void> {
+        await queryRunner.query(
+            `CREATE TABLE IF NOT EXISTS \`d_b_usage_daily_summary\` (\`attributionId\` varchar(255) NOT NULL, \`day\` varchar(10) NOT NULL, \`workspaceClass\` varchar(255) NOT NULL, \`creditCents\` bigint NOT NULL, \`entries\` int NOT NULL, \`_lastModified\` timestamp(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6) ON UPDATE CURRENT_TIMESTAMP(6), PRIMARY KEY (\`attributionId\`, \`day\`, \`workspaceClass\`)) ENGINE=InnoDB`,
+        );
+        await queryRunner.query(
+            `CREATE TABLE IF NOT EXISTS \`d_b_usage_daily_summary_state\` (\`attributionId\` varchar(255) NOT NULL, \`summarizedUntil\` varchar(10) NOT NULL DEFAULT '', \`_lastModified\` timestamp(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6) ON UPDATE CURRENT_TIMESTAMP(6), PRIMARY KEY (\`attributionId\`)) ENGINE=InnoDB`,
+        );
+    }
+
+    public async down(queryRunner: QueryRunner): Promise<void> {
+        await queryRunner.query(`DROP TABLE \`d_b_usage_daily_summary_state\``);
+        await queryRunner.query(`DROP TABLE \`d_b_usage_daily_summary\``);
+    }
+}
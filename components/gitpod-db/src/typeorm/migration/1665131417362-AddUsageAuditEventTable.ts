@@ -0,0 +1,36 @@
+/**
+ * Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+ * Licensed under the GNU Affero General Public License (AGPL).
+ * See License-AGPL.txt in the project root for license information.
+ */
+
+import { MigrationInterface, QueryRunner } from "typeorm";
+
+/**
+ * The usage component records an audit event for every mutating RPC. Audit events are append-only.
+ */
+export class AddUsageAuditEventTable1665131417362 implements MigrationInterface {
+    public async up(queryRunner: QueryRunner): Promise<void> {
+        await queryRunner.query(
+            `CREATE TABLE IF NOT EXISTS \`d_b_usage_audit_event\` (
+                \`id\` char(36) NOT NULL,
+                \`rpc\` varchar(255) NOT NULL,
+                \`actor\` varchar(255) NOT NULL,
+                \`attributionId\` varchar(255) NOT NULL DEFAULT '',
+                \`statusCode\` varchar(32) NOT NULL,
+                \`request\` text NOT NULL,
+                \`before\` text NOT NULL,
+                \`after\` text NOT NULL,
+                \`eventTime\` timestamp(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+
+                PRIMARY KEY (\`id\`),
+                KEY \`ind_attributionId_eventTime\` (\`attributionId\`, \`eventTime\`),
+                KEY \`ind_eventTime\` (\`eventTime\`)
+            ) ENGINE=InnoDB`,
+        );
+    }
+
+    public async down(queryRunner: QueryRunner): Promise<void> {
+        await queryRunner.query(`DROP TABLE \`d_b_usage_audit_event\``);
+    }
+}
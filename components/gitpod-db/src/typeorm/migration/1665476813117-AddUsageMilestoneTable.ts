@@ -0,0 +1,30 @@
+/**
+ * Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+ * Licensed under the GNU Affero General Public License (AGPL).
+ * See License-AGPL.txt in the project root for license information.
+ */
+
+import { MigrationInterface, QueryRunner } from "typeorm";
+
+/**
+ * The usage component records when an attribution ID reaches a usage milestone, such that every milestone is published
+ * to analytics at most once.
+ */
+export class AddUsageMilestoneTable1665476813117 implements MigrationInterface {
+    public async up(queryRunner: QueryRunner): Promise<void> {
+        await queryRunner.query(
+            `CREATE TABLE IF NOT EXISTS \`d_b_usage_milestone\` (
+                \`attributionId\` varchar(255) NOT NULL,
+                \`milestone\` varchar(64) NOT NULL,
+                \`reachedAt\` varchar(255) NOT NULL,
+                \`_lastModified\` timestamp(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6) ON UPDATE CURRENT_TIMESTAMP(6),
+
+                PRIMARY KEY (\`attributionId\`, \`milestone\`)
+            ) ENGINE=InnoDB`,
+        );
+    }
+
+    public async down(queryRunner: QueryRunner): Promise<void> {
+        await queryRunner.query(`DROP TABLE \`d_b_usage_milestone\``);
+    }
+}
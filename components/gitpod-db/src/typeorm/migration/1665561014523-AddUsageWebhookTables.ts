@@ -0,0 +1,53 @@
+/**
+ * Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+ * Licensed under the GNU Affero General Public License (AGPL).
+ * See License-AGPL.txt in the project root for license information.
+ */
+
+import { MigrationInterface, QueryRunner } from "typeorm";
+
+/**
+ * The usage component delivers the usage events of an attribution ID to the webhooks its owners registered. Deliveries
+ * are queued, such that failed deliveries are retried.
+ */
+export class AddUsageWebhookTables1665561014523 implements MigrationInterface {
+    public async up(queryRunner: QueryRunner): Promise<void> {
+        await queryRunner.query(
+            `CREATE TABLE IF NOT EXISTS \`d_b_usage_webhook\` (
+                \`id\` char(36) NOT NULL,
+                \`attributionId\` varchar(255) NOT NULL,
+                \`url\` varchar(2048) NOT NULL,
+                \`secret\` varchar(255) NOT NULL,
+                \`creationTime\` varchar(255) NOT NULL,
+                \`_lastModified\` timestamp(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6) ON UPDATE CURRENT_TIMESTAMP(6),
+
+                PRIMARY KEY (\`id\`),
+                KEY \`ind_attributionId\` (\`attributionId\`)
+            ) ENGINE=InnoDB`,
+        );
+        await queryRunner.query(
+            `CREATE TABLE IF NOT EXISTS \`d_b_usage_webhook_delivery\` (
+                \`id\` char(36) NOT NULL,
+                \`webhookId\` char(36) NOT NULL,
+                \`event\` varchar(255) NOT NULL,
+                \`payload\` text NOT NULL,
+                \`attempts\` int NOT NULL DEFAULT 0,
+                \`nextAttemptTime\` varchar(255) NOT NULL,
+                \`lastError\` varchar(255) NOT NULL DEFAULT '',
+                \`deliveredTime\` varchar(255) NOT NULL DEFAULT '',
+                \`failedTime\` varchar(255) NOT NULL DEFAULT '',
+                \`creationTime\` varchar(255) NOT NULL,
+                \`_lastModified\` timestamp(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6) ON UPDATE CURRENT_TIMESTAMP(6),
+
+                PRIMARY KEY (\`id\`),
+                KEY \`ind_pending\` (\`deliveredTime\`, \`failedTime\`, \`nextAttemptTime\`),
+                KEY \`ind_webhookId\` (\`webhookId\`)
+            ) ENGINE=InnoDB`,
+        );
+    }
+
+    public async down(queryRunner: QueryRunner): Promise<void> {
+        await queryRunner.query(`DROP TABLE \`d_b_usage_webhook_delivery\``);
+        await queryRunner.query(`DROP TABLE \`d_b_usage_webhook\``);
+    }
+}
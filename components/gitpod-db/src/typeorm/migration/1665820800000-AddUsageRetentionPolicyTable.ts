@@ -0,0 +1,31 @@
+/**
+ * Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+ * Licensed under the GNU Affero General Public License (AGPL).
+ * See License-AGPL.txt in the project root for license information.
+ */
+
+import { MigrationInterface, QueryRunner } from "typeorm";
+
+/**
+ * The usage component stores the retention policy of the installation, which the janitor applies to usage data.
+ */
+export class AddUsageRetentionPolicyTable1665820800000 implements MigrationInterface {
+    public async up(queryRunner: QueryRunner): Promise<void> {
+        await queryRunner.query(
+            `CREATE TABLE IF NOT EXISTS \`d_b_usage_retention_policy\` (
+                \`id\` varchar(64) NOT NULL,
+                \`sessionRetentionDays\` int NOT NULL DEFAULT 0,
+                \`ledgerRetentionDays\` int NOT NULL DEFAULT 0,
+                \`reportRetentionDays\` int NOT NULL DEFAULT 0,
+                \`updatedAt\` varchar(255) NOT NULL,
+                \`_lastModified\` timestamp(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6) ON UPDATE CURRENT_TIMESTAMP(6),
+
+                PRIMARY KEY (\`id\`)
+            ) ENGINE=InnoDB`,
+        );
+    }
+
+    public async down(queryRunner: QueryRunner): Promise<void> {
+        await queryRunner.query(`DROP TABLE \`d_b_usage_retention_policy\``);
+    }
+}
@@ -0,0 +1,33 @@
+/**
+ * Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+ * Licensed under the GNU Affero General Public License (AGPL).
+ * See License-AGPL.txt in the project root for license information.
+ */
+
+import { MigrationInterface, QueryRunner } from "typeorm";
+
+const TABLE_NAME = "d_b_usage_key";
+
+/**
+ * The primary key of the partitioned d_b_usage includes the effective time, so it does not make the ID of usage
+ * unique. The usage component claims the ID of every usage entry in this table, in the same transaction which inserts
+ * the entry. Keys of archived and purged usage are retained, such that their IDs are never reused.
+ */
+export class AddUsageKeyTable1665907200000 implements MigrationInterface {
+    public async up(queryRunner: QueryRunner): Promise<void> {
+        await queryRunner.query(
+            `CREATE TABLE IF NOT EXISTS \`${TABLE_NAME}\` (
+                \`id\` char(36) NOT NULL,
+                \`_lastModified\` timestamp(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6) ON UPDATE CURRENT_TIMESTAMP(6),
+
+                PRIMARY KEY (\`id\`)
+            ) ENGINE=InnoDB`,
+        );
+        await queryRunner.query(`INSERT IGNORE INTO \`${TABLE_NAME}\` (\`id\`) SELECT \`id\` FROM \`d_b_usage\``);
+        await queryRunner.query(`INSERT IGNORE INTO \`${TABLE_NAME}\` (\`id\`) SELECT \`id\` FROM \`d_b_usage_archive\``);
+    }
+
+    public async down(queryRunner: QueryRunner): Promise<void> {
+        await queryRunner.query(`DROP TABLE \`${TABLE_NAME}\``);
+    }
+}
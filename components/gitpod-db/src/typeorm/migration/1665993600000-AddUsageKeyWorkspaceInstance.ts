@@ -0,0 +1,47 @@
+/**
+ * Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+ * Licensed under the GNU Affero General Public License (AGPL).
+ * See License-AGPL.txt in the project root for license information.
+ */
+
+import { MigrationInterface, QueryRunner } from "typeorm";
+import { columnExists, indexExists } from "./helper/helper";
+
+const TABLE_NAME = "d_b_usage_key";
+const INDEX_NAME = "UQ_usage_key__workspaceInstanceId_kind_attributionId";
+
+/**
+ * The usage component upserts usage of workspace instances keyed on the instance, kind and attribution ID, which
+ * d_b_usage cannot enforce: its unique keys must include the effective time, which changes while usage is in draft.
+ * The key is recorded in d_b_usage_key instead. Only drafts are backfilled, finalized usage is not upserted anymore.
+ */
+export class AddUsageKeyWorkspaceInstance1665993600000 implements MigrationInterface {
+    public async up(queryRunner: QueryRunner): Promise<void> {
+        if (!(await columnExists(queryRunner, TABLE_NAME, "workspaceInstanceId"))) {
+            await queryRunner.query(
+                `ALTER TABLE \`${TABLE_NAME}\`
+                    ADD COLUMN \`workspaceInstanceId\` char(36) NULL,
+                    ADD COLUMN \`kind\` char(10) NOT NULL DEFAULT '',
+                    ADD COLUMN \`attributionId\` varchar(255) NOT NULL DEFAULT ''`,
+            );
+        }
+        if (!(await indexExists(queryRunner, TABLE_NAME, INDEX_NAME))) {
+            await queryRunner.query(
+                `ALTER TABLE \`${TABLE_NAME}\` ADD UNIQUE INDEX \`${INDEX_NAME}\` (\`workspaceInstanceId\`, \`kind\`, \`attributionId\`)`,
+            );
+        }
+        // Duplicate drafts of an instance keep their ID, but only one of them is keyed on the instance.
+        await queryRunner.query(
+            `UPDATE IGNORE \`${TABLE_NAME}\` k JOIN \`d_b_usage\` u ON u.\`id\` = k.\`id\`
+                SET k.\`workspaceInstanceId\` = u.\`workspaceInstanceId\`, k.\`kind\` = u.\`kind\`, k.\`attributionId\` = u.\`attributionId\`
+                WHERE u.\`draft\` = 1 AND u.\`kind\` = 'workspaceinstance'`,
+        );
+    }
+
+    public async down(queryRunner: QueryRunner): Promise<void> {
+        await queryRunner.query(`ALTER TABLE \`${TABLE_NAME}\` DROP INDEX \`${INDEX_NAME}\``);
+        await queryRunner.query(
+            `ALTER TABLE \`${TABLE_NAME}\` DROP COLUMN \`workspaceInstanceId\`, DROP COLUMN \`kind\`, DROP COLUMN \`attributionId\``,
+        );
+    }
+}
@@ -1509,4 +1509,44 @@ export interface CostCenter {
      * Unit: credits
      */
     spendingLimit: number;
+    /**
+     * Soft spending limits only warn when exceeded, hard spending limits block new workspace starts.
+     */
+    spendingLimitType?: CostCenter.SpendingLimitType;
+    billingStrategy?: CostCenter.BillingStrategy;
+    /**
+     * Start of the first billing period, as ISO 8601 timestamp. Billing periods are calendar months when not set.
+     */
+    billingCycleAnchor?: string;
+    /**
+     * ISO 4217 code of the currency the cost center is billed in. Defaults to USD.
+     */
+    currency?: string;
+    /**
+     * Disputed cost centers have an open payment dispute, and must not consume paid features.
+     */
+    state?: CostCenter.State;
+    /**
+     * When the payment of an unpaid invoice first failed, as ISO 8601 timestamp. Not set when all invoices are paid.
+     */
+    paymentFailedAt?: string;
+    /**
+     * When the current billing period ends and the usage of the cost center is billed next, as ISO 8601 timestamp.
+     */
+    nextBillingTime?: string;
+    /**
+     * The maximum of unused granted credits which roll over into the next billing period. 0 disables rollover.
+     */
+    rolloverLimit?: number;
+    /**
+     * The usage of previous billing periods in excess of the spending limit, in credit cents. It counts towards the
+     * spending limit of the current billing period.
+     */
+    debt?: number;
+}
+
+export namespace CostCenter {
+    export type BillingStrategy = "stripe" | "other";
+    export type SpendingLimitType = "soft" | "hard";
+    export type State = "active" | "disputed";
 }
@@ -96,7 +96,7 @@ export interface PaginationResponse {
     page: number;
 }
 
-export type UsageKind = "workspaceinstance" | "invoice";
+export type UsageKind = "workspaceinstance" | "invoice" | "dispute" | "creditgrant" | "creditgrantexpiry" | "adjustment";
 export interface Usage {
     id: string;
     attributionId: string;
@@ -105,8 +105,16 @@ export interface Usage {
     effectiveTime?: number;
     kind: UsageKind;
     workspaceInstanceId: string;
+    // projectId is the project of the workspace instance, it is empty for workspaces without a project.
+    projectId?: string;
     draft: boolean;
-    metadata: WorkspaceInstanceUsageData | InvoiceUsageData;
+    metadata:
+        | WorkspaceInstanceUsageData
+        | InvoiceUsageData
+        | DisputeUsageData
+        | CreditGrantUsageData
+        | CreditGrantExpiryUsageData
+        | AdjustmentUsageData;
 }
 
 // the equivalent golang shape is maintained in `/workspace/gitpod/`components/usage/pkg/db/usage.go`
@@ -119,6 +127,18 @@ export interface WorkspaceInstanceUsageData {
     endTime?: string;
     userName: string;
     userAvatarURL: string;
+    pricingSegments?: PricingSegment[];
+    // splitFromAttributionId is set on usage which was charged to a split target of the workspace's cost center.
+    splitFromAttributionId?: string;
+}
+
+// PricingSegment is a part of a workspace instance's runtime which was priced at the rates of a single plan.
+export interface PricingSegment {
+    plan: string;
+    startTime: string;
+    endTime: string;
+    creditsPerMinute: number;
+    credits: number;
 }
 
 export interface InvoiceUsageData {
@@ -126,3 +146,35 @@ export interface InvoiceUsageData {
     startDate: string;
     endDate: string;
 }
+
+export interface DisputeUsageData {
+    disputeId: string;
+    chargeId: string;
+    reason: string;
+    // amount is the disputed amount in the smallest unit of currency.
+    amount: number;
+    currency: string;
+}
+
+// the equivalent golang shape is maintained in `/workspace/gitpod/`components/usage/pkg/db/credit_grant.go`
+export interface CreditGrantUsageData {
+    reason: string;
+    // expiresAt is when the unused remainder of the grant expires, as ISO 8601 timestamp.
+    expiresAt: string;
+    // paymentIntentId is set for purchased credits, and references the payment in Stripe.
+    paymentIntentId?: string;
+}
+
+export interface CreditGrantExpiryUsageData {
+    creditGrantId: string;
+}
+
+// the equivalent golang shape is maintained in `/workspace/gitpod/`components/usage/pkg/db/usage_adjustment.go`
+export interface AdjustmentUsageData {
+    actor: string;
+    reason: string;
+    // importId identifies the import which created the adjustment, all adjustments of one import share it.
+    importId: string;
+    // line is the line of the adjustment in the imported file.
+    line: number;
+}
@@ -15,12 +15,24 @@ COMPONENTS_DIR="$ROOT_DIR"/components
 # shellcheck disable=SC1090,SC1091
 source "$ROOT_DIR"/scripts/protoc-generator.sh
 
+# The REST endpoints are declared in usage_rest.yaml rather than by google.api.http options, such that usage.proto
+# does not depend on the googleapis protos.
+go_protoc_gateway() {
+    protoc \
+        -I/usr/lib/protoc/include -I"$COMPONENTS_DIR" -I. \
+        --grpc-gateway_out=logtostderr=true,paths=source_relative,grpc_api_configuration=usage/v1/usage_rest.yaml:go \
+        --openapiv2_out=logtostderr=true,grpc_api_configuration=usage/v1/usage_rest.yaml,openapi_configuration=usage/v1/usage_openapi.yaml:go \
+        usage/v1/usage.proto
+}
+
 lint
 
 install_dependencies
+go install github.com/grpc-ecosystem/grpc-gateway/v2/protoc-gen-openapiv2@v2.10.0
 go_protoc "$COMPONENTS_DIR" "usage/v1"
+go_protoc_gateway
 mkdir -p go/v1
-mv go/usage/v1/*.pb.go go/v1
+mv go/usage/v1/*.pb.go go/usage/v1/*.pb.gw.go go/usage/v1/*.swagger.json go/v1
 rm -rf go/usage
 typescript_protoc "$COMPONENTS_DIR" "usage/v1"
 
@@ -74,6 +74,1011 @@ func (System) EnumDescriptor() ([]byte, []int) {
 	return file_usage_v1_billing_proto_rawDescGZIP(), []int{0}
 }
 
+type PurchaseCreditsRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	AttributionId string  `protobuf:"bytes,1,opt,name=attribution_id,json=attributionId,proto3" json:"attribution_id,omitempty"`
+	Credits       float64 `protobuf:"fixed64,2,opt,name=credits,proto3" json:"credits,omitempty"`
+	// purchase_id identifies the purchase, such that retried requests charge at most once.
+	PurchaseId string `protobuf:"bytes,3,opt,name=purchase_id,json=purchaseId,proto3" json:"purchase_id,omitempty"`
+}
+
+func (x *PurchaseCreditsRequest) Reset() {
+	*x = PurchaseCreditsRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_usage_v1_billing_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PurchaseCreditsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PurchaseCreditsRequest) ProtoMessage() {}
+
+func (x *PurchaseCreditsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_usage_v1_billing_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PurchaseCreditsRequest.ProtoReflect.Descriptor instead.
+func (*PurchaseCreditsRequest) Descriptor() ([]byte, []int) {
+	return file_usage_v1_billing_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *PurchaseCreditsRequest) GetAttributionId() string {
+	if x != nil {
+		return x.AttributionId
+	}
+	return ""
+}
+
+func (x *PurchaseCreditsRequest) GetCredits() float64 {
+	if x != nil {
+		return x.Credits
+	}
+	return 0
+}
+
+func (x *PurchaseCreditsRequest) GetPurchaseId() string {
+	if x != nil {
+		return x.PurchaseId
+	}
+	return ""
+}
+
+type PurchaseCreditsResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	PaymentIntentId string `protobuf:"bytes,1,opt,name=payment_intent_id,json=paymentIntentId,proto3" json:"payment_intent_id,omitempty"`
+	// status is the status of the Stripe payment intent, e.g. "succeeded" or "processing".
+	Status string `protobuf:"bytes,2,opt,name=status,proto3" json:"status,omitempty"`
+	// amount is the charged amount in the smallest unit of the currency.
+	Amount   int64  `protobuf:"varint,3,opt,name=amount,proto3" json:"amount,omitempty"`
+	Currency string `protobuf:"bytes,4,opt,name=currency,proto3" json:"currency,omitempty"`
+}
+
+func (x *PurchaseCreditsResponse) Reset() {
+	*x = PurchaseCreditsResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_usage_v1_billing_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PurchaseCreditsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PurchaseCreditsResponse) ProtoMessage() {}
+
+func (x *PurchaseCreditsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_usage_v1_billing_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PurchaseCreditsResponse.ProtoReflect.Descriptor instead.
+func (*PurchaseCreditsResponse) Descriptor() ([]byte, []int) {
+	return file_usage_v1_billing_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *PurchaseCreditsResponse) GetPaymentIntentId() string {
+	if x != nil {
+		return x.PaymentIntentId
+	}
+	return ""
+}
+
+func (x *PurchaseCreditsResponse) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *PurchaseCreditsResponse) GetAmount() int64 {
+	if x != nil {
+		return x.Amount
+	}
+	return 0
+}
+
+func (x *PurchaseCreditsResponse) GetCurrency() string {
+	if x != nil {
+		return x.Currency
+	}
+	return ""
+}
+
+type ReconcileLedgerWithInvoicesRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// from and to specify the period in which the invoices were created.
+	From *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=from,proto3" json:"from,omitempty"`
+	To   *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=to,proto3" json:"to,omitempty"`
+}
+
+func (x *ReconcileLedgerWithInvoicesRequest) Reset() {
+	*x = ReconcileLedgerWithInvoicesRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_usage_v1_billing_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ReconcileLedgerWithInvoicesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReconcileLedgerWithInvoicesRequest) ProtoMessage() {}
+
+func (x *ReconcileLedgerWithInvoicesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_usage_v1_billing_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReconcileLedgerWithInvoicesRequest.ProtoReflect.Descriptor instead.
+func (*ReconcileLedgerWithInvoicesRequest) Descriptor() ([]byte, []int) {
+	return file_usage_v1_billing_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ReconcileLedgerWithInvoicesRequest) GetFrom() *timestamppb.Timestamp {
+	if x != nil {
+		return x.From
+	}
+	return nil
+}
+
+func (x *ReconcileLedgerWithInvoicesRequest) GetTo() *timestamppb.Timestamp {
+	if x != nil {
+		return x.To
+	}
+	return nil
+}
+
+type ReconcileLedgerWithInvoicesResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// created_invoice_ids are the invoices which were missing in the ledger, and have been credited now.
+	CreatedInvoiceIds []string                 `protobuf:"bytes,1,rep,name=created_invoice_ids,json=createdInvoiceIds,proto3" json:"created_invoice_ids,omitempty"`
+	Mismatches        []*InvoiceLedgerMismatch `protobuf:"bytes,2,rep,name=mismatches,proto3" json:"mismatches,omitempty"`
+}
+
+func (x *ReconcileLedgerWithInvoicesResponse) Reset() {
+	*x = ReconcileLedgerWithInvoicesResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_usage_v1_billing_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ReconcileLedgerWithInvoicesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReconcileLedgerWithInvoicesResponse) ProtoMessage() {}
+
+func (x *ReconcileLedgerWithInvoicesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_usage_v1_billing_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReconcileLedgerWithInvoicesResponse.ProtoReflect.Descriptor instead.
+func (*ReconcileLedgerWithInvoicesResponse) Descriptor() ([]byte, []int) {
+	return file_usage_v1_billing_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *ReconcileLedgerWithInvoicesResponse) GetCreatedInvoiceIds() []string {
+	if x != nil {
+		return x.CreatedInvoiceIds
+	}
+	return nil
+}
+
+func (x *ReconcileLedgerWithInvoicesResponse) GetMismatches() []*InvoiceLedgerMismatch {
+	if x != nil {
+		return x.Mismatches
+	}
+	return nil
+}
+
+// InvoiceLedgerMismatch is an invoice whose ledger entry credits a different amount, or a different attribution ID,
+// than the invoice. Mismatches are not corrected automatically.
+type InvoiceLedgerMismatch struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	InvoiceId           string  `protobuf:"bytes,1,opt,name=invoice_id,json=invoiceId,proto3" json:"invoice_id,omitempty"`
+	AttributionId       string  `protobuf:"bytes,2,opt,name=attribution_id,json=attributionId,proto3" json:"attribution_id,omitempty"`
+	InvoiceCredits      float64 `protobuf:"fixed64,3,opt,name=invoice_credits,json=invoiceCredits,proto3" json:"invoice_credits,omitempty"`
+	LedgerAttributionId string  `protobuf:"bytes,4,opt,name=ledger_attribution_id,json=ledgerAttributionId,proto3" json:"ledger_attribution_id,omitempty"`
+	LedgerCredits       float64 `protobuf:"fixed64,5,opt,name=ledger_credits,json=ledgerCredits,proto3" json:"ledger_credits,omitempty"`
+}
+
+func (x *InvoiceLedgerMismatch) Reset() {
+	*x = InvoiceLedgerMismatch{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_usage_v1_billing_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *InvoiceLedgerMismatch) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*InvoiceLedgerMismatch) ProtoMessage() {}
+
+func (x *InvoiceLedgerMismatch) ProtoReflect() protoreflect.Message {
+	mi := &file_usage_v1_billing_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use InvoiceLedgerMismatch.ProtoReflect.Descriptor instead.
+func (*InvoiceLedgerMismatch) Descriptor() ([]byte, []int) {
+	return file_usage_v1_billing_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *InvoiceLedgerMismatch) GetInvoiceId() string {
+	if x != nil {
+		return x.InvoiceId
+	}
+	return ""
+}
+
+func (x *InvoiceLedgerMismatch) GetAttributionId() string {
+	if x != nil {
+		return x.AttributionId
+	}
+	return ""
+}
+
+func (x *InvoiceLedgerMismatch) GetInvoiceCredits() float64 {
+	if x != nil {
+		return x.InvoiceCredits
+	}
+	return 0
+}
+
+func (x *InvoiceLedgerMismatch) GetLedgerAttributionId() string {
+	if x != nil {
+		return x.LedgerAttributionId
+	}
+	return ""
+}
+
+func (x *InvoiceLedgerMismatch) GetLedgerCredits() float64 {
+	if x != nil {
+		return x.LedgerCredits
+	}
+	return 0
+}
+
+type ListBillingDriftRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// from and to specify the period whose usage is compared, like in ReconcileInvoicesRequest.
+	From *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=from,proto3" json:"from,omitempty"`
+	To   *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=to,proto3" json:"to,omitempty"`
+}
+
+func (x *ListBillingDriftRequest) Reset() {
+	*x = ListBillingDriftRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_usage_v1_billing_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ListBillingDriftRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListBillingDriftRequest) ProtoMessage() {}
+
+func (x *ListBillingDriftRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_usage_v1_billing_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListBillingDriftRequest.ProtoReflect.Descriptor instead.
+func (*ListBillingDriftRequest) Descriptor() ([]byte, []int) {
+	return file_usage_v1_billing_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ListBillingDriftRequest) GetFrom() *timestamppb.Timestamp {
+	if x != nil {
+		return x.From
+	}
+	return nil
+}
+
+func (x *ListBillingDriftRequest) GetTo() *timestamppb.Timestamp {
+	if x != nil {
+		return x.To
+	}
+	return nil
+}
+
+type ListBillingDriftResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// checked_attribution_ids is the number of cost centers whose reported usage was compared with the ledger.
+	CheckedAttributionIds int32           `protobuf:"varint,1,opt,name=checked_attribution_ids,json=checkedAttributionIds,proto3" json:"checked_attribution_ids,omitempty"`
+	Mismatches            []*BillingDrift `protobuf:"bytes,2,rep,name=mismatches,proto3" json:"mismatches,omitempty"`
+}
+
+func (x *ListBillingDriftResponse) Reset() {
+	*x = ListBillingDriftResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_usage_v1_billing_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ListBillingDriftResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListBillingDriftResponse) ProtoMessage() {}
+
+func (x *ListBillingDriftResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_usage_v1_billing_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListBillingDriftResponse.ProtoReflect.Descriptor instead.
+func (*ListBillingDriftResponse) Descriptor() ([]byte, []int) {
+	return file_usage_v1_billing_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ListBillingDriftResponse) GetCheckedAttributionIds() int32 {
+	if x != nil {
+		return x.CheckedAttributionIds
+	}
+	return 0
+}
+
+func (x *ListBillingDriftResponse) GetMismatches() []*BillingDrift {
+	if x != nil {
+		return x.Mismatches
+	}
+	return nil
+}
+
+// BillingDrift is a cost center whose usage reported to the billing system does not match the credits used in the
+// ledger for the billing period.
+type BillingDrift struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	AttributionId   string                 `protobuf:"bytes,1,opt,name=attribution_id,json=attributionId,proto3" json:"attribution_id,omitempty"`
+	CustomerId      string                 `protobuf:"bytes,2,opt,name=customer_id,json=customerId,proto3" json:"customer_id,omitempty"`
+	PeriodStart     *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=period_start,json=periodStart,proto3" json:"period_start,omitempty"`
+	LedgerCredits   int64                  `protobuf:"varint,4,opt,name=ledger_credits,json=ledgerCredits,proto3" json:"ledger_credits,omitempty"`
+	ReportedCredits int64                  `protobuf:"varint,5,opt,name=reported_credits,json=reportedCredits,proto3" json:"reported_credits,omitempty"`
+}
+
+func (x *BillingDrift) Reset() {
+	*x = BillingDrift{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_usage_v1_billing_proto_msgTypes[7]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *BillingDrift) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BillingDrift) ProtoMessage() {}
+
+func (x *BillingDrift) ProtoReflect() protoreflect.Message {
+	mi := &file_usage_v1_billing_proto_msgTypes[7]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BillingDrift.ProtoReflect.Descriptor instead.
+func (*BillingDrift) Descriptor() ([]byte, []int) {
+	return file_usage_v1_billing_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *BillingDrift) GetAttributionId() string {
+	if x != nil {
+		return x.AttributionId
+	}
+	return ""
+}
+
+func (x *BillingDrift) GetCustomerId() string {
+	if x != nil {
+		return x.CustomerId
+	}
+	return ""
+}
+
+func (x *BillingDrift) GetPeriodStart() *timestamppb.Timestamp {
+	if x != nil {
+		return x.PeriodStart
+	}
+	return nil
+}
+
+func (x *BillingDrift) GetLedgerCredits() int64 {
+	if x != nil {
+		return x.LedgerCredits
+	}
+	return 0
+}
+
+func (x *BillingDrift) GetReportedCredits() int64 {
+	if x != nil {
+		return x.ReportedCredits
+	}
+	return 0
+}
+
+type VoidUsageRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	UsageId string `protobuf:"bytes,1,opt,name=usage_id,json=usageId,proto3" json:"usage_id,omitempty"`
+	Reason  string `protobuf:"bytes,2,opt,name=reason,proto3" json:"reason,omitempty"`
+}
+
+func (x *VoidUsageRequest) Reset() {
+	*x = VoidUsageRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_usage_v1_billing_proto_msgTypes[8]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *VoidUsageRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VoidUsageRequest) ProtoMessage() {}
+
+func (x *VoidUsageRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_usage_v1_billing_proto_msgTypes[8]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VoidUsageRequest.ProtoReflect.Descriptor instead.
+func (*VoidUsageRequest) Descriptor() ([]byte, []int) {
+	return file_usage_v1_billing_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *VoidUsageRequest) GetUsageId() string {
+	if x != nil {
+		return x.UsageId
+	}
+	return ""
+}
+
+func (x *VoidUsageRequest) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+type VoidUsageResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// credit_note_id is empty when the usage was not invoiced yet, in which case
+	// the next invoice reconciliation reflects the voided usage.
+	CreditNoteId string `protobuf:"bytes,1,opt,name=credit_note_id,json=creditNoteId,proto3" json:"credit_note_id,omitempty"`
+}
+
+func (x *VoidUsageResponse) Reset() {
+	*x = VoidUsageResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_usage_v1_billing_proto_msgTypes[9]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *VoidUsageResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VoidUsageResponse) ProtoMessage() {}
+
+func (x *VoidUsageResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_usage_v1_billing_proto_msgTypes[9]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VoidUsageResponse.ProtoReflect.Descriptor instead.
+func (*VoidUsageResponse) Descriptor() ([]byte, []int) {
+	return file_usage_v1_billing_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *VoidUsageResponse) GetCreditNoteId() string {
+	if x != nil {
+		return x.CreditNoteId
+	}
+	return ""
+}
+
+type CreateStripeSubscriptionRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	AttributionId string `protobuf:"bytes,1,opt,name=attribution_id,json=attributionId,proto3" json:"attribution_id,omitempty"`
+	SetupIntentId string `protobuf:"bytes,2,opt,name=setup_intent_id,json=setupIntentId,proto3" json:"setup_intent_id,omitempty"`
+	// customer_name, customer_email and currency are used when the Stripe customer needs to be created.
+	CustomerName  string `protobuf:"bytes,3,opt,name=customer_name,json=customerName,proto3" json:"customer_name,omitempty"`
+	CustomerEmail string `protobuf:"bytes,4,opt,name=customer_email,json=customerEmail,proto3" json:"customer_email,omitempty"`
+	Currency      string `protobuf:"bytes,5,opt,name=currency,proto3" json:"currency,omitempty"`
+}
+
+func (x *CreateStripeSubscriptionRequest) Reset() {
+	*x = CreateStripeSubscriptionRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_usage_v1_billing_proto_msgTypes[10]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *CreateStripeSubscriptionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateStripeSubscriptionRequest) ProtoMessage() {}
+
+func (x *CreateStripeSubscriptionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_usage_v1_billing_proto_msgTypes[10]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateStripeSubscriptionRequest.ProtoReflect.Descriptor instead.
+func (*CreateStripeSubscriptionRequest) Descriptor() ([]byte, []int) {
+	return file_usage_v1_billing_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *CreateStripeSubscriptionRequest) GetAttributionId() string {
+	if x != nil {
+		return x.AttributionId
+	}
+	return ""
+}
+
+func (x *CreateStripeSubscriptionRequest) GetSetupIntentId() string {
+	if x != nil {
+		return x.SetupIntentId
+	}
+	return ""
+}
+
+func (x *CreateStripeSubscriptionRequest) GetCustomerName() string {
+	if x != nil {
+		return x.CustomerName
+	}
+	return ""
+}
+
+func (x *CreateStripeSubscriptionRequest) GetCustomerEmail() string {
+	if x != nil {
+		return x.CustomerEmail
+	}
+	return ""
+}
+
+func (x *CreateStripeSubscriptionRequest) GetCurrency() string {
+	if x != nil {
+		return x.Currency
+	}
+	return ""
+}
+
+type CreateStripeSubscriptionResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Customer       *StripeCustomer `protobuf:"bytes,1,opt,name=customer,proto3" json:"customer,omitempty"`
+	SubscriptionId string          `protobuf:"bytes,2,opt,name=subscription_id,json=subscriptionId,proto3" json:"subscription_id,omitempty"`
+}
+
+func (x *CreateStripeSubscriptionResponse) Reset() {
+	*x = CreateStripeSubscriptionResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_usage_v1_billing_proto_msgTypes[11]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *CreateStripeSubscriptionResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateStripeSubscriptionResponse) ProtoMessage() {}
+
+func (x *CreateStripeSubscriptionResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_usage_v1_billing_proto_msgTypes[11]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateStripeSubscriptionResponse.ProtoReflect.Descriptor instead.
+func (*CreateStripeSubscriptionResponse) Descriptor() ([]byte, []int) {
+	return file_usage_v1_billing_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *CreateStripeSubscriptionResponse) GetCustomer() *StripeCustomer {
+	if x != nil {
+		return x.Customer
+	}
+	return nil
+}
+
+func (x *CreateStripeSubscriptionResponse) GetSubscriptionId() string {
+	if x != nil {
+		return x.SubscriptionId
+	}
+	return ""
+}
+
+type GetStripeCustomerRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	AttributionId string `protobuf:"bytes,1,opt,name=attribution_id,json=attributionId,proto3" json:"attribution_id,omitempty"`
+}
+
+func (x *GetStripeCustomerRequest) Reset() {
+	*x = GetStripeCustomerRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_usage_v1_billing_proto_msgTypes[12]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *GetStripeCustomerRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetStripeCustomerRequest) ProtoMessage() {}
+
+func (x *GetStripeCustomerRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_usage_v1_billing_proto_msgTypes[12]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetStripeCustomerRequest.ProtoReflect.Descriptor instead.
+func (*GetStripeCustomerRequest) Descriptor() ([]byte, []int) {
+	return file_usage_v1_billing_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *GetStripeCustomerRequest) GetAttributionId() string {
+	if x != nil {
+		return x.AttributionId
+	}
+	return ""
+}
+
+type GetStripeCustomerResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Customer *StripeCustomer `protobuf:"bytes,1,opt,name=customer,proto3" json:"customer,omitempty"`
+}
+
+func (x *GetStripeCustomerResponse) Reset() {
+	*x = GetStripeCustomerResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_usage_v1_billing_proto_msgTypes[13]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *GetStripeCustomerResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetStripeCustomerResponse) ProtoMessage() {}
+
+func (x *GetStripeCustomerResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_usage_v1_billing_proto_msgTypes[13]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetStripeCustomerResponse.ProtoReflect.Descriptor instead.
+func (*GetStripeCustomerResponse) Descriptor() ([]byte, []int) {
+	return file_usage_v1_billing_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *GetStripeCustomerResponse) GetCustomer() *StripeCustomer {
+	if x != nil {
+		return x.Customer
+	}
+	return nil
+}
+
+type StripeCustomer struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Id       string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Currency string `protobuf:"bytes,2,opt,name=currency,proto3" json:"currency,omitempty"`
+}
+
+func (x *StripeCustomer) Reset() {
+	*x = StripeCustomer{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_usage_v1_billing_proto_msgTypes[14]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *StripeCustomer) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StripeCustomer) ProtoMessage() {}
+
+func (x *StripeCustomer) ProtoReflect() protoreflect.Message {
+	mi := &file_usage_v1_billing_proto_msgTypes[14]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StripeCustomer.ProtoReflect.Descriptor instead.
+func (*StripeCustomer) Descriptor() ([]byte, []int) {
+	return file_usage_v1_billing_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *StripeCustomer) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *StripeCustomer) GetCurrency() string {
+	if x != nil {
+		return x.Currency
+	}
+	return ""
+}
+
+type ReconcileInvoicesRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// from and to specify the billing period to reconcile.
+	From *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=from,proto3" json:"from,omitempty"`
+	To   *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=to,proto3" json:"to,omitempty"`
+}
+
+func (x *ReconcileInvoicesRequest) Reset() {
+	*x = ReconcileInvoicesRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_usage_v1_billing_proto_msgTypes[15]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ReconcileInvoicesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReconcileInvoicesRequest) ProtoMessage() {}
+
+func (x *ReconcileInvoicesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_usage_v1_billing_proto_msgTypes[15]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReconcileInvoicesRequest.ProtoReflect.Descriptor instead.
+func (*ReconcileInvoicesRequest) Descriptor() ([]byte, []int) {
+	return file_usage_v1_billing_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *ReconcileInvoicesRequest) GetFrom() *timestamppb.Timestamp {
+	if x != nil {
+		return x.From
+	}
+	return nil
+}
+
+func (x *ReconcileInvoicesRequest) GetTo() *timestamppb.Timestamp {
+	if x != nil {
+		return x.To
+	}
+	return nil
+}
+
+type ReconcileInvoicesResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *ReconcileInvoicesResponse) Reset() {
+	*x = ReconcileInvoicesResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_usage_v1_billing_proto_msgTypes[16]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ReconcileInvoicesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReconcileInvoicesResponse) ProtoMessage() {}
+
+func (x *ReconcileInvoicesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_usage_v1_billing_proto_msgTypes[16]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReconcileInvoicesResponse.ProtoReflect.Descriptor instead.
+func (*ReconcileInvoicesResponse) Descriptor() ([]byte, []int) {
+	return file_usage_v1_billing_proto_rawDescGZIP(), []int{16}
+}
+
 type UpdateInvoicesRequest struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -90,7 +1095,7 @@ type UpdateInvoicesRequest struct {
 func (x *UpdateInvoicesRequest) Reset() {
 	*x = UpdateInvoicesRequest{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_usage_v1_billing_proto_msgTypes[0]
+		mi := &file_usage_v1_billing_proto_msgTypes[17]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -103,7 +1108,7 @@ func (x *UpdateInvoicesRequest) String() string {
 func (*UpdateInvoicesRequest) ProtoMessage() {}
 
 func (x *UpdateInvoicesRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_usage_v1_billing_proto_msgTypes[0]
+	mi := &file_usage_v1_billing_proto_msgTypes[17]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -116,7 +1121,7 @@ func (x *UpdateInvoicesRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use UpdateInvoicesRequest.ProtoReflect.Descriptor instead.
 func (*UpdateInvoicesRequest) Descriptor() ([]byte, []int) {
-	return file_usage_v1_billing_proto_rawDescGZIP(), []int{0}
+	return file_usage_v1_billing_proto_rawDescGZIP(), []int{17}
 }
 
 func (x *UpdateInvoicesRequest) GetStartTime() *timestamppb.Timestamp {
@@ -157,7 +1162,7 @@ type UpdateInvoicesResponse struct {
 func (x *UpdateInvoicesResponse) Reset() {
 	*x = UpdateInvoicesResponse{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_usage_v1_billing_proto_msgTypes[1]
+		mi := &file_usage_v1_billing_proto_msgTypes[18]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -170,7 +1175,7 @@ func (x *UpdateInvoicesResponse) String() string {
 func (*UpdateInvoicesResponse) ProtoMessage() {}
 
 func (x *UpdateInvoicesResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_usage_v1_billing_proto_msgTypes[1]
+	mi := &file_usage_v1_billing_proto_msgTypes[18]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -183,7 +1188,7 @@ func (x *UpdateInvoicesResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use UpdateInvoicesResponse.ProtoReflect.Descriptor instead.
 func (*UpdateInvoicesResponse) Descriptor() ([]byte, []int) {
-	return file_usage_v1_billing_proto_rawDescGZIP(), []int{1}
+	return file_usage_v1_billing_proto_rawDescGZIP(), []int{18}
 }
 
 type GetUpcomingInvoiceRequest struct {
@@ -195,13 +1200,14 @@ type GetUpcomingInvoiceRequest struct {
 	//
 	//	*GetUpcomingInvoiceRequest_TeamId
 	//	*GetUpcomingInvoiceRequest_UserId
+	//	*GetUpcomingInvoiceRequest_AttributionId
 	Identifier isGetUpcomingInvoiceRequest_Identifier `protobuf_oneof:"identifier"`
 }
 
 func (x *GetUpcomingInvoiceRequest) Reset() {
 	*x = GetUpcomingInvoiceRequest{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_usage_v1_billing_proto_msgTypes[2]
+		mi := &file_usage_v1_billing_proto_msgTypes[19]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -214,7 +1220,7 @@ func (x *GetUpcomingInvoiceRequest) String() string {
 func (*GetUpcomingInvoiceRequest) ProtoMessage() {}
 
 func (x *GetUpcomingInvoiceRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_usage_v1_billing_proto_msgTypes[2]
+	mi := &file_usage_v1_billing_proto_msgTypes[19]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -227,7 +1233,7 @@ func (x *GetUpcomingInvoiceRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use GetUpcomingInvoiceRequest.ProtoReflect.Descriptor instead.
 func (*GetUpcomingInvoiceRequest) Descriptor() ([]byte, []int) {
-	return file_usage_v1_billing_proto_rawDescGZIP(), []int{2}
+	return file_usage_v1_billing_proto_rawDescGZIP(), []int{19}
 }
 
 func (m *GetUpcomingInvoiceRequest) GetIdentifier() isGetUpcomingInvoiceRequest_Identifier {
@@ -244,57 +1250,224 @@ func (x *GetUpcomingInvoiceRequest) GetTeamId() string {
 	return ""
 }
 
-func (x *GetUpcomingInvoiceRequest) GetUserId() string {
-	if x, ok := x.GetIdentifier().(*GetUpcomingInvoiceRequest_UserId); ok {
-		return x.UserId
+func (x *GetUpcomingInvoiceRequest) GetUserId() string {
+	if x, ok := x.GetIdentifier().(*GetUpcomingInvoiceRequest_UserId); ok {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *GetUpcomingInvoiceRequest) GetAttributionId() string {
+	if x, ok := x.GetIdentifier().(*GetUpcomingInvoiceRequest_AttributionId); ok {
+		return x.AttributionId
+	}
+	return ""
+}
+
+type isGetUpcomingInvoiceRequest_Identifier interface {
+	isGetUpcomingInvoiceRequest_Identifier()
+}
+
+type GetUpcomingInvoiceRequest_TeamId struct {
+	TeamId string `protobuf:"bytes,1,opt,name=team_id,json=teamId,proto3,oneof"`
+}
+
+type GetUpcomingInvoiceRequest_UserId struct {
+	UserId string `protobuf:"bytes,2,opt,name=user_id,json=userId,proto3,oneof"`
+}
+
+type GetUpcomingInvoiceRequest_AttributionId struct {
+	AttributionId string `protobuf:"bytes,3,opt,name=attribution_id,json=attributionId,proto3,oneof"`
+}
+
+func (*GetUpcomingInvoiceRequest_TeamId) isGetUpcomingInvoiceRequest_Identifier() {}
+
+func (*GetUpcomingInvoiceRequest_UserId) isGetUpcomingInvoiceRequest_Identifier() {}
+
+func (*GetUpcomingInvoiceRequest_AttributionId) isGetUpcomingInvoiceRequest_Identifier() {}
+
+type GetUpcomingInvoiceResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	InvoiceId string `protobuf:"bytes,1,opt,name=invoice_id,json=invoiceId,proto3" json:"invoice_id,omitempty"`
+	Currency  string `protobuf:"bytes,2,opt,name=currency,proto3" json:"currency,omitempty"`
+	// amount is the amount due, in the smallest unit of the currency.
+	Amount    float64                    `protobuf:"fixed64,3,opt,name=amount,proto3" json:"amount,omitempty"`
+	Credits   int64                      `protobuf:"varint,4,opt,name=credits,proto3" json:"credits,omitempty"`
+	LineItems []*UpcomingInvoiceLineItem `protobuf:"bytes,5,rep,name=line_items,json=lineItems,proto3" json:"line_items,omitempty"`
+	// due_date is when payment of the invoice is due, or attempted for automatically charged invoices.
+	DueDate     *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=due_date,json=dueDate,proto3" json:"due_date,omitempty"`
+	PeriodStart *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=period_start,json=periodStart,proto3" json:"period_start,omitempty"`
+	PeriodEnd   *timestamppb.Timestamp `protobuf:"bytes,8,opt,name=period_end,json=periodEnd,proto3" json:"period_end,omitempty"`
+	// ledger_credits are the credits recorded in the ledger for the current period, including usage
+	// which has not been reported to the billing system yet.
+	LedgerCredits float64 `protobuf:"fixed64,9,opt,name=ledger_credits,json=ledgerCredits,proto3" json:"ledger_credits,omitempty"`
+	// tax_rate is the rate in percent for the country of the customer's billing address.
+	TaxRate float64 `protobuf:"fixed64,10,opt,name=tax_rate,json=taxRate,proto3" json:"tax_rate,omitempty"`
+	// tax is the tax on amount, in the smallest unit of the currency.
+	Tax float64 `protobuf:"fixed64,11,opt,name=tax,proto3" json:"tax,omitempty"`
+	// total is amount including tax, in the smallest unit of the currency.
+	Total float64 `protobuf:"fixed64,12,opt,name=total,proto3" json:"total,omitempty"`
+	// ledger_amount is ledger_credits converted to currency, in the smallest unit of the currency, excluding tax.
+	// It is zero when no price per credit is configured for the currency.
+	LedgerAmount float64 `protobuf:"fixed64,13,opt,name=ledger_amount,json=ledgerAmount,proto3" json:"ledger_amount,omitempty"`
+}
+
+func (x *GetUpcomingInvoiceResponse) Reset() {
+	*x = GetUpcomingInvoiceResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_usage_v1_billing_proto_msgTypes[20]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *GetUpcomingInvoiceResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetUpcomingInvoiceResponse) ProtoMessage() {}
+
+func (x *GetUpcomingInvoiceResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_usage_v1_billing_proto_msgTypes[20]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetUpcomingInvoiceResponse.ProtoReflect.Descriptor instead.
+func (*GetUpcomingInvoiceResponse) Descriptor() ([]byte, []int) {
+	return file_usage_v1_billing_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *GetUpcomingInvoiceResponse) GetInvoiceId() string {
+	if x != nil {
+		return x.InvoiceId
+	}
+	return ""
+}
+
+func (x *GetUpcomingInvoiceResponse) GetCurrency() string {
+	if x != nil {
+		return x.Currency
+	}
+	return ""
+}
+
+func (x *GetUpcomingInvoiceResponse) GetAmount() float64 {
+	if x != nil {
+		return x.Amount
+	}
+	return 0
+}
+
+func (x *GetUpcomingInvoiceResponse) GetCredits() int64 {
+	if x != nil {
+		return x.Credits
+	}
+	return 0
+}
+
+func (x *GetUpcomingInvoiceResponse) GetLineItems() []*UpcomingInvoiceLineItem {
+	if x != nil {
+		return x.LineItems
+	}
+	return nil
+}
+
+func (x *GetUpcomingInvoiceResponse) GetDueDate() *timestamppb.Timestamp {
+	if x != nil {
+		return x.DueDate
+	}
+	return nil
+}
+
+func (x *GetUpcomingInvoiceResponse) GetPeriodStart() *timestamppb.Timestamp {
+	if x != nil {
+		return x.PeriodStart
+	}
+	return nil
+}
+
+func (x *GetUpcomingInvoiceResponse) GetPeriodEnd() *timestamppb.Timestamp {
+	if x != nil {
+		return x.PeriodEnd
+	}
+	return nil
+}
+
+func (x *GetUpcomingInvoiceResponse) GetLedgerCredits() float64 {
+	if x != nil {
+		return x.LedgerCredits
 	}
-	return ""
+	return 0
 }
 
-type isGetUpcomingInvoiceRequest_Identifier interface {
-	isGetUpcomingInvoiceRequest_Identifier()
+func (x *GetUpcomingInvoiceResponse) GetTaxRate() float64 {
+	if x != nil {
+		return x.TaxRate
+	}
+	return 0
 }
 
-type GetUpcomingInvoiceRequest_TeamId struct {
-	TeamId string `protobuf:"bytes,1,opt,name=team_id,json=teamId,proto3,oneof"`
+func (x *GetUpcomingInvoiceResponse) GetTax() float64 {
+	if x != nil {
+		return x.Tax
+	}
+	return 0
 }
 
-type GetUpcomingInvoiceRequest_UserId struct {
-	UserId string `protobuf:"bytes,2,opt,name=user_id,json=userId,proto3,oneof"`
+func (x *GetUpcomingInvoiceResponse) GetTotal() float64 {
+	if x != nil {
+		return x.Total
+	}
+	return 0
 }
 
-func (*GetUpcomingInvoiceRequest_TeamId) isGetUpcomingInvoiceRequest_Identifier() {}
-
-func (*GetUpcomingInvoiceRequest_UserId) isGetUpcomingInvoiceRequest_Identifier() {}
+func (x *GetUpcomingInvoiceResponse) GetLedgerAmount() float64 {
+	if x != nil {
+		return x.LedgerAmount
+	}
+	return 0
+}
 
-type GetUpcomingInvoiceResponse struct {
+type UpcomingInvoiceLineItem struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	InvoiceId string  `protobuf:"bytes,1,opt,name=invoice_id,json=invoiceId,proto3" json:"invoice_id,omitempty"`
-	Currency  string  `protobuf:"bytes,2,opt,name=currency,proto3" json:"currency,omitempty"`
-	Amount    float64 `protobuf:"fixed64,3,opt,name=amount,proto3" json:"amount,omitempty"`
-	Credits   int64   `protobuf:"varint,4,opt,name=credits,proto3" json:"credits,omitempty"`
+	Description string `protobuf:"bytes,1,opt,name=description,proto3" json:"description,omitempty"`
+	Quantity    int64  `protobuf:"varint,2,opt,name=quantity,proto3" json:"quantity,omitempty"`
+	// amount is in the smallest unit of the currency, excluding tax.
+	Amount float64 `protobuf:"fixed64,3,opt,name=amount,proto3" json:"amount,omitempty"`
+	// tax is the tax on amount, in the smallest unit of the currency.
+	Tax float64 `protobuf:"fixed64,4,opt,name=tax,proto3" json:"tax,omitempty"`
 }
 
-func (x *GetUpcomingInvoiceResponse) Reset() {
-	*x = GetUpcomingInvoiceResponse{}
+func (x *UpcomingInvoiceLineItem) Reset() {
+	*x = UpcomingInvoiceLineItem{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_usage_v1_billing_proto_msgTypes[3]
+		mi := &file_usage_v1_billing_proto_msgTypes[21]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
 }
 
-func (x *GetUpcomingInvoiceResponse) String() string {
+func (x *UpcomingInvoiceLineItem) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*GetUpcomingInvoiceResponse) ProtoMessage() {}
+func (*UpcomingInvoiceLineItem) ProtoMessage() {}
 
-func (x *GetUpcomingInvoiceResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_usage_v1_billing_proto_msgTypes[3]
+func (x *UpcomingInvoiceLineItem) ProtoReflect() protoreflect.Message {
+	mi := &file_usage_v1_billing_proto_msgTypes[21]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -305,35 +1478,35 @@ func (x *GetUpcomingInvoiceResponse) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use GetUpcomingInvoiceResponse.ProtoReflect.Descriptor instead.
-func (*GetUpcomingInvoiceResponse) Descriptor() ([]byte, []int) {
-	return file_usage_v1_billing_proto_rawDescGZIP(), []int{3}
+// Deprecated: Use UpcomingInvoiceLineItem.ProtoReflect.Descriptor instead.
+func (*UpcomingInvoiceLineItem) Descriptor() ([]byte, []int) {
+	return file_usage_v1_billing_proto_rawDescGZIP(), []int{21}
 }
 
-func (x *GetUpcomingInvoiceResponse) GetInvoiceId() string {
+func (x *UpcomingInvoiceLineItem) GetDescription() string {
 	if x != nil {
-		return x.InvoiceId
+		return x.Description
 	}
 	return ""
 }
 
-func (x *GetUpcomingInvoiceResponse) GetCurrency() string {
+func (x *UpcomingInvoiceLineItem) GetQuantity() int64 {
 	if x != nil {
-		return x.Currency
+		return x.Quantity
 	}
-	return ""
+	return 0
 }
 
-func (x *GetUpcomingInvoiceResponse) GetAmount() float64 {
+func (x *UpcomingInvoiceLineItem) GetAmount() float64 {
 	if x != nil {
 		return x.Amount
 	}
 	return 0
 }
 
-func (x *GetUpcomingInvoiceResponse) GetCredits() int64 {
+func (x *UpcomingInvoiceLineItem) GetTax() float64 {
 	if x != nil {
-		return x.Credits
+		return x.Tax
 	}
 	return 0
 }
@@ -349,7 +1522,7 @@ type FinalizeInvoiceRequest struct {
 func (x *FinalizeInvoiceRequest) Reset() {
 	*x = FinalizeInvoiceRequest{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_usage_v1_billing_proto_msgTypes[4]
+		mi := &file_usage_v1_billing_proto_msgTypes[22]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -362,7 +1535,7 @@ func (x *FinalizeInvoiceRequest) String() string {
 func (*FinalizeInvoiceRequest) ProtoMessage() {}
 
 func (x *FinalizeInvoiceRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_usage_v1_billing_proto_msgTypes[4]
+	mi := &file_usage_v1_billing_proto_msgTypes[22]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -375,7 +1548,7 @@ func (x *FinalizeInvoiceRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use FinalizeInvoiceRequest.ProtoReflect.Descriptor instead.
 func (*FinalizeInvoiceRequest) Descriptor() ([]byte, []int) {
-	return file_usage_v1_billing_proto_rawDescGZIP(), []int{4}
+	return file_usage_v1_billing_proto_rawDescGZIP(), []int{22}
 }
 
 func (x *FinalizeInvoiceRequest) GetInvoiceId() string {
@@ -394,7 +1567,7 @@ type FinalizeInvoiceResponse struct {
 func (x *FinalizeInvoiceResponse) Reset() {
 	*x = FinalizeInvoiceResponse{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_usage_v1_billing_proto_msgTypes[5]
+		mi := &file_usage_v1_billing_proto_msgTypes[23]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -407,7 +1580,7 @@ func (x *FinalizeInvoiceResponse) String() string {
 func (*FinalizeInvoiceResponse) ProtoMessage() {}
 
 func (x *FinalizeInvoiceResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_usage_v1_billing_proto_msgTypes[5]
+	mi := &file_usage_v1_billing_proto_msgTypes[23]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -420,7 +1593,7 @@ func (x *FinalizeInvoiceResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use FinalizeInvoiceResponse.ProtoReflect.Descriptor instead.
 func (*FinalizeInvoiceResponse) Descriptor() ([]byte, []int) {
-	return file_usage_v1_billing_proto_rawDescGZIP(), []int{5}
+	return file_usage_v1_billing_proto_rawDescGZIP(), []int{23}
 }
 
 // If there are two billable sessions for this instance ID,
@@ -438,7 +1611,7 @@ type SetBilledSessionRequest struct {
 func (x *SetBilledSessionRequest) Reset() {
 	*x = SetBilledSessionRequest{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_usage_v1_billing_proto_msgTypes[6]
+		mi := &file_usage_v1_billing_proto_msgTypes[24]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -451,7 +1624,7 @@ func (x *SetBilledSessionRequest) String() string {
 func (*SetBilledSessionRequest) ProtoMessage() {}
 
 func (x *SetBilledSessionRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_usage_v1_billing_proto_msgTypes[6]
+	mi := &file_usage_v1_billing_proto_msgTypes[24]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -464,7 +1637,7 @@ func (x *SetBilledSessionRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use SetBilledSessionRequest.ProtoReflect.Descriptor instead.
 func (*SetBilledSessionRequest) Descriptor() ([]byte, []int) {
-	return file_usage_v1_billing_proto_rawDescGZIP(), []int{6}
+	return file_usage_v1_billing_proto_rawDescGZIP(), []int{24}
 }
 
 func (x *SetBilledSessionRequest) GetInstanceId() string {
@@ -497,7 +1670,7 @@ type SetBilledSessionResponse struct {
 func (x *SetBilledSessionResponse) Reset() {
 	*x = SetBilledSessionResponse{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_usage_v1_billing_proto_msgTypes[7]
+		mi := &file_usage_v1_billing_proto_msgTypes[25]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -510,7 +1683,7 @@ func (x *SetBilledSessionResponse) String() string {
 func (*SetBilledSessionResponse) ProtoMessage() {}
 
 func (x *SetBilledSessionResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_usage_v1_billing_proto_msgTypes[7]
+	mi := &file_usage_v1_billing_proto_msgTypes[25]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -523,7 +1696,7 @@ func (x *SetBilledSessionResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use SetBilledSessionResponse.ProtoReflect.Descriptor instead.
 func (*SetBilledSessionResponse) Descriptor() ([]byte, []int) {
-	return file_usage_v1_billing_proto_rawDescGZIP(), []int{7}
+	return file_usage_v1_billing_proto_rawDescGZIP(), []int{25}
 }
 
 var File_usage_v1_billing_proto protoreflect.FileDescriptor
@@ -534,86 +1707,297 @@ var file_usage_v1_billing_proto_rawDesc = []byte{
 	0x76, 0x31, 0x1a, 0x1f, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f,
 	0x62, 0x75, 0x66, 0x2f, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x2e, 0x70, 0x72,
 	0x6f, 0x74, 0x6f, 0x1a, 0x14, 0x75, 0x73, 0x61, 0x67, 0x65, 0x2f, 0x76, 0x31, 0x2f, 0x75, 0x73,
-	0x61, 0x67, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0xdf, 0x01, 0x0a, 0x15, 0x55, 0x70,
-	0x64, 0x61, 0x74, 0x65, 0x49, 0x6e, 0x76, 0x6f, 0x69, 0x63, 0x65, 0x73, 0x52, 0x65, 0x71, 0x75,
-	0x65, 0x73, 0x74, 0x12, 0x39, 0x0a, 0x0a, 0x73, 0x74, 0x61, 0x72, 0x74, 0x5f, 0x74, 0x69, 0x6d,
-	0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65,
-	0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74,
-	0x61, 0x6d, 0x70, 0x52, 0x09, 0x73, 0x74, 0x61, 0x72, 0x74, 0x54, 0x69, 0x6d, 0x65, 0x12, 0x35,
-	0x0a, 0x08, 0x65, 0x6e, 0x64, 0x5f, 0x74, 0x69, 0x6d, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b,
+	0x61, 0x67, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x7a, 0x0a, 0x16, 0x50, 0x75, 0x72,
+	0x63, 0x68, 0x61, 0x73, 0x65, 0x43, 0x72, 0x65, 0x64, 0x69, 0x74, 0x73, 0x52, 0x65, 0x71, 0x75,
+	0x65, 0x73, 0x74, 0x12, 0x25, 0x0a, 0x0e, 0x61, 0x74, 0x74, 0x72, 0x69, 0x62, 0x75, 0x74, 0x69,
+	0x6f, 0x6e, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0d, 0x61, 0x74, 0x74,
+	0x72, 0x69, 0x62, 0x75, 0x74, 0x69, 0x6f, 0x6e, 0x49, 0x64, 0x12, 0x18, 0x0a, 0x07, 0x63, 0x72,
+	0x65, 0x64, 0x69, 0x74, 0x73, 0x18, 0x02, 0x20, 0x01, 0x28, 0x01, 0x52, 0x07, 0x63, 0x72, 0x65,
+	0x64, 0x69, 0x74, 0x73, 0x12, 0x1f, 0x0a, 0x0b, 0x70, 0x75, 0x72, 0x63, 0x68, 0x61, 0x73, 0x65,
+	0x5f, 0x69, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x70, 0x75, 0x72, 0x63, 0x68,
+	0x61, 0x73, 0x65, 0x49, 0x64, 0x22, 0x91, 0x01, 0x0a, 0x17, 0x50, 0x75, 0x72, 0x63, 0x68, 0x61,
+	0x73, 0x65, 0x43, 0x72, 0x65, 0x64, 0x69, 0x74, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73,
+	0x65, 0x12, 0x2a, 0x0a, 0x11, 0x70, 0x61, 0x79, 0x6d, 0x65, 0x6e, 0x74, 0x5f, 0x69, 0x6e, 0x74,
+	0x65, 0x6e, 0x74, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0f, 0x70, 0x61,
+	0x79, 0x6d, 0x65, 0x6e, 0x74, 0x49, 0x6e, 0x74, 0x65, 0x6e, 0x74, 0x49, 0x64, 0x12, 0x16, 0x0a,
+	0x06, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x73,
+	0x74, 0x61, 0x74, 0x75, 0x73, 0x12, 0x16, 0x0a, 0x06, 0x61, 0x6d, 0x6f, 0x75, 0x6e, 0x74, 0x18,
+	0x03, 0x20, 0x01, 0x28, 0x03, 0x52, 0x06, 0x61, 0x6d, 0x6f, 0x75, 0x6e, 0x74, 0x12, 0x1a, 0x0a,
+	0x08, 0x63, 0x75, 0x72, 0x72, 0x65, 0x6e, 0x63, 0x79, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x08, 0x63, 0x75, 0x72, 0x72, 0x65, 0x6e, 0x63, 0x79, 0x22, 0x80, 0x01, 0x0a, 0x22, 0x52, 0x65,
+	0x63, 0x6f, 0x6e, 0x63, 0x69, 0x6c, 0x65, 0x4c, 0x65, 0x64, 0x67, 0x65, 0x72, 0x57, 0x69, 0x74,
+	0x68, 0x49, 0x6e, 0x76, 0x6f, 0x69, 0x63, 0x65, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
+	0x12, 0x2e, 0x0a, 0x04, 0x66, 0x72, 0x6f, 0x6d, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a,
+	0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66,
+	0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x04, 0x66, 0x72, 0x6f, 0x6d,
+	0x12, 0x2a, 0x0a, 0x02, 0x74, 0x6f, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67,
+	0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54,
+	0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x02, 0x74, 0x6f, 0x22, 0x96, 0x01, 0x0a,
+	0x23, 0x52, 0x65, 0x63, 0x6f, 0x6e, 0x63, 0x69, 0x6c, 0x65, 0x4c, 0x65, 0x64, 0x67, 0x65, 0x72,
+	0x57, 0x69, 0x74, 0x68, 0x49, 0x6e, 0x76, 0x6f, 0x69, 0x63, 0x65, 0x73, 0x52, 0x65, 0x73, 0x70,
+	0x6f, 0x6e, 0x73, 0x65, 0x12, 0x2e, 0x0a, 0x13, 0x63, 0x72, 0x65, 0x61, 0x74, 0x65, 0x64, 0x5f,
+	0x69, 0x6e, 0x76, 0x6f, 0x69, 0x63, 0x65, 0x5f, 0x69, 0x64, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28,
+	0x09, 0x52, 0x11, 0x63, 0x72, 0x65, 0x61, 0x74, 0x65, 0x64, 0x49, 0x6e, 0x76, 0x6f, 0x69, 0x63,
+	0x65, 0x49, 0x64, 0x73, 0x12, 0x3f, 0x0a, 0x0a, 0x6d, 0x69, 0x73, 0x6d, 0x61, 0x74, 0x63, 0x68,
+	0x65, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x1f, 0x2e, 0x75, 0x73, 0x61, 0x67, 0x65,
+	0x2e, 0x76, 0x31, 0x2e, 0x49, 0x6e, 0x76, 0x6f, 0x69, 0x63, 0x65, 0x4c, 0x65, 0x64, 0x67, 0x65,
+	0x72, 0x4d, 0x69, 0x73, 0x6d, 0x61, 0x74, 0x63, 0x68, 0x52, 0x0a, 0x6d, 0x69, 0x73, 0x6d, 0x61,
+	0x74, 0x63, 0x68, 0x65, 0x73, 0x22, 0xe1, 0x01, 0x0a, 0x15, 0x49, 0x6e, 0x76, 0x6f, 0x69, 0x63,
+	0x65, 0x4c, 0x65, 0x64, 0x67, 0x65, 0x72, 0x4d, 0x69, 0x73, 0x6d, 0x61, 0x74, 0x63, 0x68, 0x12,
+	0x1d, 0x0a, 0x0a, 0x69, 0x6e, 0x76, 0x6f, 0x69, 0x63, 0x65, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x09, 0x69, 0x6e, 0x76, 0x6f, 0x69, 0x63, 0x65, 0x49, 0x64, 0x12, 0x25,
+	0x0a, 0x0e, 0x61, 0x74, 0x74, 0x72, 0x69, 0x62, 0x75, 0x74, 0x69, 0x6f, 0x6e, 0x5f, 0x69, 0x64,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0d, 0x61, 0x74, 0x74, 0x72, 0x69, 0x62, 0x75, 0x74,
+	0x69, 0x6f, 0x6e, 0x49, 0x64, 0x12, 0x27, 0x0a, 0x0f, 0x69, 0x6e, 0x76, 0x6f, 0x69, 0x63, 0x65,
+	0x5f, 0x63, 0x72, 0x65, 0x64, 0x69, 0x74, 0x73, 0x18, 0x03, 0x20, 0x01, 0x28, 0x01, 0x52, 0x0e,
+	0x69, 0x6e, 0x76, 0x6f, 0x69, 0x63, 0x65, 0x43, 0x72, 0x65, 0x64, 0x69, 0x74, 0x73, 0x12, 0x32,
+	0x0a, 0x15, 0x6c, 0x65, 0x64, 0x67, 0x65, 0x72, 0x5f, 0x61, 0x74, 0x74, 0x72, 0x69, 0x62, 0x75,
+	0x74, 0x69, 0x6f, 0x6e, 0x5f, 0x69, 0x64, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x13, 0x6c,
+	0x65, 0x64, 0x67, 0x65, 0x72, 0x41, 0x74, 0x74, 0x72, 0x69, 0x62, 0x75, 0x74, 0x69, 0x6f, 0x6e,
+	0x49, 0x64, 0x12, 0x25, 0x0a, 0x0e, 0x6c, 0x65, 0x64, 0x67, 0x65, 0x72, 0x5f, 0x63, 0x72, 0x65,
+	0x64, 0x69, 0x74, 0x73, 0x18, 0x05, 0x20, 0x01, 0x28, 0x01, 0x52, 0x0d, 0x6c, 0x65, 0x64, 0x67,
+	0x65, 0x72, 0x43, 0x72, 0x65, 0x64, 0x69, 0x74, 0x73, 0x22, 0x75, 0x0a, 0x17, 0x4c, 0x69, 0x73,
+	0x74, 0x42, 0x69, 0x6c, 0x6c, 0x69, 0x6e, 0x67, 0x44, 0x72, 0x69, 0x66, 0x74, 0x52, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x12, 0x2e, 0x0a, 0x04, 0x66, 0x72, 0x6f, 0x6d, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x04,
+	0x66, 0x72, 0x6f, 0x6d, 0x12, 0x2a, 0x0a, 0x02, 0x74, 0x6f, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62,
+	0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x02, 0x74, 0x6f,
+	0x22, 0x8a, 0x01, 0x0a, 0x18, 0x4c, 0x69, 0x73, 0x74, 0x42, 0x69, 0x6c, 0x6c, 0x69, 0x6e, 0x67,
+	0x44, 0x72, 0x69, 0x66, 0x74, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x36, 0x0a,
+	0x17, 0x63, 0x68, 0x65, 0x63, 0x6b, 0x65, 0x64, 0x5f, 0x61, 0x74, 0x74, 0x72, 0x69, 0x62, 0x75,
+	0x74, 0x69, 0x6f, 0x6e, 0x5f, 0x69, 0x64, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x05, 0x52, 0x15,
+	0x63, 0x68, 0x65, 0x63, 0x6b, 0x65, 0x64, 0x41, 0x74, 0x74, 0x72, 0x69, 0x62, 0x75, 0x74, 0x69,
+	0x6f, 0x6e, 0x49, 0x64, 0x73, 0x12, 0x36, 0x0a, 0x0a, 0x6d, 0x69, 0x73, 0x6d, 0x61, 0x74, 0x63,
+	0x68, 0x65, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x16, 0x2e, 0x75, 0x73, 0x61, 0x67,
+	0x65, 0x2e, 0x76, 0x31, 0x2e, 0x42, 0x69, 0x6c, 0x6c, 0x69, 0x6e, 0x67, 0x44, 0x72, 0x69, 0x66,
+	0x74, 0x52, 0x0a, 0x6d, 0x69, 0x73, 0x6d, 0x61, 0x74, 0x63, 0x68, 0x65, 0x73, 0x22, 0xe7, 0x01,
+	0x0a, 0x0c, 0x42, 0x69, 0x6c, 0x6c, 0x69, 0x6e, 0x67, 0x44, 0x72, 0x69, 0x66, 0x74, 0x12, 0x25,
+	0x0a, 0x0e, 0x61, 0x74, 0x74, 0x72, 0x69, 0x62, 0x75, 0x74, 0x69, 0x6f, 0x6e, 0x5f, 0x69, 0x64,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0d, 0x61, 0x74, 0x74, 0x72, 0x69, 0x62, 0x75, 0x74,
+	0x69, 0x6f, 0x6e, 0x49, 0x64, 0x12, 0x1f, 0x0a, 0x0b, 0x63, 0x75, 0x73, 0x74, 0x6f, 0x6d, 0x65,
+	0x72, 0x5f, 0x69, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x63, 0x75, 0x73, 0x74,
+	0x6f, 0x6d, 0x65, 0x72, 0x49, 0x64, 0x12, 0x3d, 0x0a, 0x0c, 0x70, 0x65, 0x72, 0x69, 0x6f, 0x64,
+	0x5f, 0x73, 0x74, 0x61, 0x72, 0x74, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67,
+	0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54,
+	0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x0b, 0x70, 0x65, 0x72, 0x69, 0x6f, 0x64,
+	0x53, 0x74, 0x61, 0x72, 0x74, 0x12, 0x25, 0x0a, 0x0e, 0x6c, 0x65, 0x64, 0x67, 0x65, 0x72, 0x5f,
+	0x63, 0x72, 0x65, 0x64, 0x69, 0x74, 0x73, 0x18, 0x04, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0d, 0x6c,
+	0x65, 0x64, 0x67, 0x65, 0x72, 0x43, 0x72, 0x65, 0x64, 0x69, 0x74, 0x73, 0x12, 0x29, 0x0a, 0x10,
+	0x72, 0x65, 0x70, 0x6f, 0x72, 0x74, 0x65, 0x64, 0x5f, 0x63, 0x72, 0x65, 0x64, 0x69, 0x74, 0x73,
+	0x18, 0x05, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0f, 0x72, 0x65, 0x70, 0x6f, 0x72, 0x74, 0x65, 0x64,
+	0x43, 0x72, 0x65, 0x64, 0x69, 0x74, 0x73, 0x22, 0x45, 0x0a, 0x10, 0x56, 0x6f, 0x69, 0x64, 0x55,
+	0x73, 0x61, 0x67, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x19, 0x0a, 0x08, 0x75,
+	0x73, 0x61, 0x67, 0x65, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x75,
+	0x73, 0x61, 0x67, 0x65, 0x49, 0x64, 0x12, 0x16, 0x0a, 0x06, 0x72, 0x65, 0x61, 0x73, 0x6f, 0x6e,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x72, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x22, 0x39,
+	0x0a, 0x11, 0x56, 0x6f, 0x69, 0x64, 0x55, 0x73, 0x61, 0x67, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f,
+	0x6e, 0x73, 0x65, 0x12, 0x24, 0x0a, 0x0e, 0x63, 0x72, 0x65, 0x64, 0x69, 0x74, 0x5f, 0x6e, 0x6f,
+	0x74, 0x65, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0c, 0x63, 0x72, 0x65,
+	0x64, 0x69, 0x74, 0x4e, 0x6f, 0x74, 0x65, 0x49, 0x64, 0x22, 0xd8, 0x01, 0x0a, 0x1f, 0x43, 0x72,
+	0x65, 0x61, 0x74, 0x65, 0x53, 0x74, 0x72, 0x69, 0x70, 0x65, 0x53, 0x75, 0x62, 0x73, 0x63, 0x72,
+	0x69, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x25, 0x0a,
+	0x0e, 0x61, 0x74, 0x74, 0x72, 0x69, 0x62, 0x75, 0x74, 0x69, 0x6f, 0x6e, 0x5f, 0x69, 0x64, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0d, 0x61, 0x74, 0x74, 0x72, 0x69, 0x62, 0x75, 0x74, 0x69,
+	0x6f, 0x6e, 0x49, 0x64, 0x12, 0x26, 0x0a, 0x0f, 0x73, 0x65, 0x74, 0x75, 0x70, 0x5f, 0x69, 0x6e,
+	0x74, 0x65, 0x6e, 0x74, 0x5f, 0x69, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0d, 0x73,
+	0x65, 0x74, 0x75, 0x70, 0x49, 0x6e, 0x74, 0x65, 0x6e, 0x74, 0x49, 0x64, 0x12, 0x23, 0x0a, 0x0d,
+	0x63, 0x75, 0x73, 0x74, 0x6f, 0x6d, 0x65, 0x72, 0x5f, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x03, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x0c, 0x63, 0x75, 0x73, 0x74, 0x6f, 0x6d, 0x65, 0x72, 0x4e, 0x61, 0x6d,
+	0x65, 0x12, 0x25, 0x0a, 0x0e, 0x63, 0x75, 0x73, 0x74, 0x6f, 0x6d, 0x65, 0x72, 0x5f, 0x65, 0x6d,
+	0x61, 0x69, 0x6c, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0d, 0x63, 0x75, 0x73, 0x74, 0x6f,
+	0x6d, 0x65, 0x72, 0x45, 0x6d, 0x61, 0x69, 0x6c, 0x12, 0x1a, 0x0a, 0x08, 0x63, 0x75, 0x72, 0x72,
+	0x65, 0x6e, 0x63, 0x79, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x63, 0x75, 0x72, 0x72,
+	0x65, 0x6e, 0x63, 0x79, 0x22, 0x81, 0x01, 0x0a, 0x20, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x53,
+	0x74, 0x72, 0x69, 0x70, 0x65, 0x53, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x70, 0x74, 0x69, 0x6f,
+	0x6e, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x34, 0x0a, 0x08, 0x63, 0x75, 0x73,
+	0x74, 0x6f, 0x6d, 0x65, 0x72, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x18, 0x2e, 0x75, 0x73,
+	0x61, 0x67, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x53, 0x74, 0x72, 0x69, 0x70, 0x65, 0x43, 0x75, 0x73,
+	0x74, 0x6f, 0x6d, 0x65, 0x72, 0x52, 0x08, 0x63, 0x75, 0x73, 0x74, 0x6f, 0x6d, 0x65, 0x72, 0x12,
+	0x27, 0x0a, 0x0f, 0x73, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x5f,
+	0x69, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0e, 0x73, 0x75, 0x62, 0x73, 0x63, 0x72,
+	0x69, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x49, 0x64, 0x22, 0x41, 0x0a, 0x18, 0x47, 0x65, 0x74, 0x53,
+	0x74, 0x72, 0x69, 0x70, 0x65, 0x43, 0x75, 0x73, 0x74, 0x6f, 0x6d, 0x65, 0x72, 0x52, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x12, 0x25, 0x0a, 0x0e, 0x61, 0x74, 0x74, 0x72, 0x69, 0x62, 0x75, 0x74,
+	0x69, 0x6f, 0x6e, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0d, 0x61, 0x74,
+	0x74, 0x72, 0x69, 0x62, 0x75, 0x74, 0x69, 0x6f, 0x6e, 0x49, 0x64, 0x22, 0x51, 0x0a, 0x19, 0x47,
+	0x65, 0x74, 0x53, 0x74, 0x72, 0x69, 0x70, 0x65, 0x43, 0x75, 0x73, 0x74, 0x6f, 0x6d, 0x65, 0x72,
+	0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x34, 0x0a, 0x08, 0x63, 0x75, 0x73, 0x74,
+	0x6f, 0x6d, 0x65, 0x72, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x18, 0x2e, 0x75, 0x73, 0x61,
+	0x67, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x53, 0x74, 0x72, 0x69, 0x70, 0x65, 0x43, 0x75, 0x73, 0x74,
+	0x6f, 0x6d, 0x65, 0x72, 0x52, 0x08, 0x63, 0x75, 0x73, 0x74, 0x6f, 0x6d, 0x65, 0x72, 0x22, 0x3c,
+	0x0a, 0x0e, 0x53, 0x74, 0x72, 0x69, 0x70, 0x65, 0x43, 0x75, 0x73, 0x74, 0x6f, 0x6d, 0x65, 0x72,
+	0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x02, 0x69, 0x64,
+	0x12, 0x1a, 0x0a, 0x08, 0x63, 0x75, 0x72, 0x72, 0x65, 0x6e, 0x63, 0x79, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x08, 0x63, 0x75, 0x72, 0x72, 0x65, 0x6e, 0x63, 0x79, 0x22, 0x76, 0x0a, 0x18,
+	0x52, 0x65, 0x63, 0x6f, 0x6e, 0x63, 0x69, 0x6c, 0x65, 0x49, 0x6e, 0x76, 0x6f, 0x69, 0x63, 0x65,
+	0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x2e, 0x0a, 0x04, 0x66, 0x72, 0x6f, 0x6d,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61,
+	0x6d, 0x70, 0x52, 0x04, 0x66, 0x72, 0x6f, 0x6d, 0x12, 0x2a, 0x0a, 0x02, 0x74, 0x6f, 0x18, 0x02,
+	0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72,
+	0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70,
+	0x52, 0x02, 0x74, 0x6f, 0x22, 0x1b, 0x0a, 0x19, 0x52, 0x65, 0x63, 0x6f, 0x6e, 0x63, 0x69, 0x6c,
+	0x65, 0x49, 0x6e, 0x76, 0x6f, 0x69, 0x63, 0x65, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73,
+	0x65, 0x22, 0xdf, 0x01, 0x0a, 0x15, 0x55, 0x70, 0x64, 0x61, 0x74, 0x65, 0x49, 0x6e, 0x76, 0x6f,
+	0x69, 0x63, 0x65, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x39, 0x0a, 0x0a, 0x73,
+	0x74, 0x61, 0x72, 0x74, 0x5f, 0x74, 0x69, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32,
+	0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75,
+	0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x09, 0x73, 0x74, 0x61,
+	0x72, 0x74, 0x54, 0x69, 0x6d, 0x65, 0x12, 0x35, 0x0a, 0x08, 0x65, 0x6e, 0x64, 0x5f, 0x74, 0x69,
+	0x6d, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c,
+	0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73,
+	0x74, 0x61, 0x6d, 0x70, 0x52, 0x07, 0x65, 0x6e, 0x64, 0x54, 0x69, 0x6d, 0x65, 0x12, 0x37, 0x0a,
+	0x08, 0x73, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0x03, 0x20, 0x03, 0x28, 0x0b, 0x32,
+	0x17, 0x2e, 0x75, 0x73, 0x61, 0x67, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x42, 0x69, 0x6c, 0x6c, 0x65,
+	0x64, 0x53, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x42, 0x02, 0x18, 0x01, 0x52, 0x08, 0x73, 0x65,
+	0x73, 0x73, 0x69, 0x6f, 0x6e, 0x73, 0x12, 0x1b, 0x0a, 0x09, 0x72, 0x65, 0x70, 0x6f, 0x72, 0x74,
+	0x5f, 0x69, 0x64, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x72, 0x65, 0x70, 0x6f, 0x72,
+	0x74, 0x49, 0x64, 0x22, 0x18, 0x0a, 0x16, 0x55, 0x70, 0x64, 0x61, 0x74, 0x65, 0x49, 0x6e, 0x76,
+	0x6f, 0x69, 0x63, 0x65, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x88, 0x01,
+	0x0a, 0x19, 0x47, 0x65, 0x74, 0x55, 0x70, 0x63, 0x6f, 0x6d, 0x69, 0x6e, 0x67, 0x49, 0x6e, 0x76,
+	0x6f, 0x69, 0x63, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x19, 0x0a, 0x07, 0x74,
+	0x65, 0x61, 0x6d, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x48, 0x00, 0x52, 0x06,
+	0x74, 0x65, 0x61, 0x6d, 0x49, 0x64, 0x12, 0x19, 0x0a, 0x07, 0x75, 0x73, 0x65, 0x72, 0x5f, 0x69,
+	0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x48, 0x00, 0x52, 0x06, 0x75, 0x73, 0x65, 0x72, 0x49,
+	0x64, 0x12, 0x27, 0x0a, 0x0e, 0x61, 0x74, 0x74, 0x72, 0x69, 0x62, 0x75, 0x74, 0x69, 0x6f, 0x6e,
+	0x5f, 0x69, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x48, 0x00, 0x52, 0x0d, 0x61, 0x74, 0x74,
+	0x72, 0x69, 0x62, 0x75, 0x74, 0x69, 0x6f, 0x6e, 0x49, 0x64, 0x42, 0x0c, 0x0a, 0x0a, 0x69, 0x64,
+	0x65, 0x6e, 0x74, 0x69, 0x66, 0x69, 0x65, 0x72, 0x22, 0x8b, 0x04, 0x0a, 0x1a, 0x47, 0x65, 0x74,
+	0x55, 0x70, 0x63, 0x6f, 0x6d, 0x69, 0x6e, 0x67, 0x49, 0x6e, 0x76, 0x6f, 0x69, 0x63, 0x65, 0x52,
+	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x1d, 0x0a, 0x0a, 0x69, 0x6e, 0x76, 0x6f, 0x69,
+	0x63, 0x65, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x69, 0x6e, 0x76,
+	0x6f, 0x69, 0x63, 0x65, 0x49, 0x64, 0x12, 0x1a, 0x0a, 0x08, 0x63, 0x75, 0x72, 0x72, 0x65, 0x6e,
+	0x63, 0x79, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x63, 0x75, 0x72, 0x72, 0x65, 0x6e,
+	0x63, 0x79, 0x12, 0x16, 0x0a, 0x06, 0x61, 0x6d, 0x6f, 0x75, 0x6e, 0x74, 0x18, 0x03, 0x20, 0x01,
+	0x28, 0x01, 0x52, 0x06, 0x61, 0x6d, 0x6f, 0x75, 0x6e, 0x74, 0x12, 0x18, 0x0a, 0x07, 0x63, 0x72,
+	0x65, 0x64, 0x69, 0x74, 0x73, 0x18, 0x04, 0x20, 0x01, 0x28, 0x03, 0x52, 0x07, 0x63, 0x72, 0x65,
+	0x64, 0x69, 0x74, 0x73, 0x12, 0x40, 0x0a, 0x0a, 0x6c, 0x69, 0x6e, 0x65, 0x5f, 0x69, 0x74, 0x65,
+	0x6d, 0x73, 0x18, 0x05, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x21, 0x2e, 0x75, 0x73, 0x61, 0x67, 0x65,
+	0x2e, 0x76, 0x31, 0x2e, 0x55, 0x70, 0x63, 0x6f, 0x6d, 0x69, 0x6e, 0x67, 0x49, 0x6e, 0x76, 0x6f,
+	0x69, 0x63, 0x65, 0x4c, 0x69, 0x6e, 0x65, 0x49, 0x74, 0x65, 0x6d, 0x52, 0x09, 0x6c, 0x69, 0x6e,
+	0x65, 0x49, 0x74, 0x65, 0x6d, 0x73, 0x12, 0x35, 0x0a, 0x08, 0x64, 0x75, 0x65, 0x5f, 0x64, 0x61,
+	0x74, 0x65, 0x18, 0x06, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c,
+	0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73,
+	0x74, 0x61, 0x6d, 0x70, 0x52, 0x07, 0x64, 0x75, 0x65, 0x44, 0x61, 0x74, 0x65, 0x12, 0x3d, 0x0a,
+	0x0c, 0x70, 0x65, 0x72, 0x69, 0x6f, 0x64, 0x5f, 0x73, 0x74, 0x61, 0x72, 0x74, 0x18, 0x07, 0x20,
+	0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52,
+	0x0b, 0x70, 0x65, 0x72, 0x69, 0x6f, 0x64, 0x53, 0x74, 0x61, 0x72, 0x74, 0x12, 0x39, 0x0a, 0x0a,
+	0x70, 0x65, 0x72, 0x69, 0x6f, 0x64, 0x5f, 0x65, 0x6e, 0x64, 0x18, 0x08, 0x20, 0x01, 0x28, 0x0b,
 	0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62,
-	0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x07, 0x65, 0x6e,
-	0x64, 0x54, 0x69, 0x6d, 0x65, 0x12, 0x37, 0x0a, 0x08, 0x73, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e,
-	0x73, 0x18, 0x03, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x17, 0x2e, 0x75, 0x73, 0x61, 0x67, 0x65, 0x2e,
-	0x76, 0x31, 0x2e, 0x42, 0x69, 0x6c, 0x6c, 0x65, 0x64, 0x53, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e,
-	0x42, 0x02, 0x18, 0x01, 0x52, 0x08, 0x73, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x73, 0x12, 0x1b,
-	0x0a, 0x09, 0x72, 0x65, 0x70, 0x6f, 0x72, 0x74, 0x5f, 0x69, 0x64, 0x18, 0x04, 0x20, 0x01, 0x28,
-	0x09, 0x52, 0x08, 0x72, 0x65, 0x70, 0x6f, 0x72, 0x74, 0x49, 0x64, 0x22, 0x18, 0x0a, 0x16, 0x55,
-	0x70, 0x64, 0x61, 0x74, 0x65, 0x49, 0x6e, 0x76, 0x6f, 0x69, 0x63, 0x65, 0x73, 0x52, 0x65, 0x73,
-	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x5f, 0x0a, 0x19, 0x47, 0x65, 0x74, 0x55, 0x70, 0x63, 0x6f,
-	0x6d, 0x69, 0x6e, 0x67, 0x49, 0x6e, 0x76, 0x6f, 0x69, 0x63, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65,
-	0x73, 0x74, 0x12, 0x19, 0x0a, 0x07, 0x74, 0x65, 0x61, 0x6d, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20,
-	0x01, 0x28, 0x09, 0x48, 0x00, 0x52, 0x06, 0x74, 0x65, 0x61, 0x6d, 0x49, 0x64, 0x12, 0x19, 0x0a,
-	0x07, 0x75, 0x73, 0x65, 0x72, 0x5f, 0x69, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x48, 0x00,
-	0x52, 0x06, 0x75, 0x73, 0x65, 0x72, 0x49, 0x64, 0x42, 0x0c, 0x0a, 0x0a, 0x69, 0x64, 0x65, 0x6e,
-	0x74, 0x69, 0x66, 0x69, 0x65, 0x72, 0x22, 0x89, 0x01, 0x0a, 0x1a, 0x47, 0x65, 0x74, 0x55, 0x70,
-	0x63, 0x6f, 0x6d, 0x69, 0x6e, 0x67, 0x49, 0x6e, 0x76, 0x6f, 0x69, 0x63, 0x65, 0x52, 0x65, 0x73,
-	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x1d, 0x0a, 0x0a, 0x69, 0x6e, 0x76, 0x6f, 0x69, 0x63, 0x65,
-	0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x69, 0x6e, 0x76, 0x6f, 0x69,
-	0x63, 0x65, 0x49, 0x64, 0x12, 0x1a, 0x0a, 0x08, 0x63, 0x75, 0x72, 0x72, 0x65, 0x6e, 0x63, 0x79,
-	0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x63, 0x75, 0x72, 0x72, 0x65, 0x6e, 0x63, 0x79,
+	0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x09, 0x70, 0x65,
+	0x72, 0x69, 0x6f, 0x64, 0x45, 0x6e, 0x64, 0x12, 0x25, 0x0a, 0x0e, 0x6c, 0x65, 0x64, 0x67, 0x65,
+	0x72, 0x5f, 0x63, 0x72, 0x65, 0x64, 0x69, 0x74, 0x73, 0x18, 0x09, 0x20, 0x01, 0x28, 0x01, 0x52,
+	0x0d, 0x6c, 0x65, 0x64, 0x67, 0x65, 0x72, 0x43, 0x72, 0x65, 0x64, 0x69, 0x74, 0x73, 0x12, 0x19,
+	0x0a, 0x08, 0x74, 0x61, 0x78, 0x5f, 0x72, 0x61, 0x74, 0x65, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x01,
+	0x52, 0x07, 0x74, 0x61, 0x78, 0x52, 0x61, 0x74, 0x65, 0x12, 0x10, 0x0a, 0x03, 0x74, 0x61, 0x78,
+	0x18, 0x0b, 0x20, 0x01, 0x28, 0x01, 0x52, 0x03, 0x74, 0x61, 0x78, 0x12, 0x14, 0x0a, 0x05, 0x74,
+	0x6f, 0x74, 0x61, 0x6c, 0x18, 0x0c, 0x20, 0x01, 0x28, 0x01, 0x52, 0x05, 0x74, 0x6f, 0x74, 0x61,
+	0x6c, 0x12, 0x23, 0x0a, 0x0d, 0x6c, 0x65, 0x64, 0x67, 0x65, 0x72, 0x5f, 0x61, 0x6d, 0x6f, 0x75,
+	0x6e, 0x74, 0x18, 0x0d, 0x20, 0x01, 0x28, 0x01, 0x52, 0x0c, 0x6c, 0x65, 0x64, 0x67, 0x65, 0x72,
+	0x41, 0x6d, 0x6f, 0x75, 0x6e, 0x74, 0x22, 0x81, 0x01, 0x0a, 0x17, 0x55, 0x70, 0x63, 0x6f, 0x6d,
+	0x69, 0x6e, 0x67, 0x49, 0x6e, 0x76, 0x6f, 0x69, 0x63, 0x65, 0x4c, 0x69, 0x6e, 0x65, 0x49, 0x74,
+	0x65, 0x6d, 0x12, 0x20, 0x0a, 0x0b, 0x64, 0x65, 0x73, 0x63, 0x72, 0x69, 0x70, 0x74, 0x69, 0x6f,
+	0x6e, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x64, 0x65, 0x73, 0x63, 0x72, 0x69, 0x70,
+	0x74, 0x69, 0x6f, 0x6e, 0x12, 0x1a, 0x0a, 0x08, 0x71, 0x75, 0x61, 0x6e, 0x74, 0x69, 0x74, 0x79,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x08, 0x71, 0x75, 0x61, 0x6e, 0x74, 0x69, 0x74, 0x79,
 	0x12, 0x16, 0x0a, 0x06, 0x61, 0x6d, 0x6f, 0x75, 0x6e, 0x74, 0x18, 0x03, 0x20, 0x01, 0x28, 0x01,
-	0x52, 0x06, 0x61, 0x6d, 0x6f, 0x75, 0x6e, 0x74, 0x12, 0x18, 0x0a, 0x07, 0x63, 0x72, 0x65, 0x64,
-	0x69, 0x74, 0x73, 0x18, 0x04, 0x20, 0x01, 0x28, 0x03, 0x52, 0x07, 0x63, 0x72, 0x65, 0x64, 0x69,
-	0x74, 0x73, 0x22, 0x37, 0x0a, 0x16, 0x46, 0x69, 0x6e, 0x61, 0x6c, 0x69, 0x7a, 0x65, 0x49, 0x6e,
-	0x76, 0x6f, 0x69, 0x63, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x1d, 0x0a, 0x0a,
-	0x69, 0x6e, 0x76, 0x6f, 0x69, 0x63, 0x65, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09,
-	0x52, 0x09, 0x69, 0x6e, 0x76, 0x6f, 0x69, 0x63, 0x65, 0x49, 0x64, 0x22, 0x19, 0x0a, 0x17, 0x46,
-	0x69, 0x6e, 0x61, 0x6c, 0x69, 0x7a, 0x65, 0x49, 0x6e, 0x76, 0x6f, 0x69, 0x63, 0x65, 0x52, 0x65,
-	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x94, 0x01, 0x0a, 0x17, 0x53, 0x65, 0x74, 0x42, 0x69,
-	0x6c, 0x6c, 0x65, 0x64, 0x53, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x52, 0x65, 0x71, 0x75, 0x65,
-	0x73, 0x74, 0x12, 0x1f, 0x0a, 0x0b, 0x69, 0x6e, 0x73, 0x74, 0x61, 0x6e, 0x63, 0x65, 0x5f, 0x69,
-	0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x69, 0x6e, 0x73, 0x74, 0x61, 0x6e, 0x63,
-	0x65, 0x49, 0x64, 0x12, 0x2e, 0x0a, 0x04, 0x66, 0x72, 0x6f, 0x6d, 0x18, 0x02, 0x20, 0x01, 0x28,
-	0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
-	0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x04, 0x66,
-	0x72, 0x6f, 0x6d, 0x12, 0x28, 0x0a, 0x06, 0x73, 0x79, 0x73, 0x74, 0x65, 0x6d, 0x18, 0x03, 0x20,
-	0x01, 0x28, 0x0e, 0x32, 0x10, 0x2e, 0x75, 0x73, 0x61, 0x67, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x53,
-	0x79, 0x73, 0x74, 0x65, 0x6d, 0x52, 0x06, 0x73, 0x79, 0x73, 0x74, 0x65, 0x6d, 0x22, 0x1a, 0x0a,
-	0x18, 0x53, 0x65, 0x74, 0x42, 0x69, 0x6c, 0x6c, 0x65, 0x64, 0x53, 0x65, 0x73, 0x73, 0x69, 0x6f,
-	0x6e, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x2a, 0x45, 0x0a, 0x06, 0x53, 0x79, 0x73,
-	0x74, 0x65, 0x6d, 0x12, 0x12, 0x0a, 0x0e, 0x53, 0x59, 0x53, 0x54, 0x45, 0x4d, 0x5f, 0x55, 0x4e,
-	0x4b, 0x4e, 0x4f, 0x57, 0x4e, 0x10, 0x00, 0x12, 0x14, 0x0a, 0x10, 0x53, 0x59, 0x53, 0x54, 0x45,
-	0x4d, 0x5f, 0x43, 0x48, 0x41, 0x52, 0x47, 0x45, 0x42, 0x45, 0x45, 0x10, 0x01, 0x12, 0x11, 0x0a,
-	0x0d, 0x53, 0x59, 0x53, 0x54, 0x45, 0x4d, 0x5f, 0x53, 0x54, 0x52, 0x49, 0x50, 0x45, 0x10, 0x02,
-	0x32, 0x81, 0x03, 0x0a, 0x0e, 0x42, 0x69, 0x6c, 0x6c, 0x69, 0x6e, 0x67, 0x53, 0x65, 0x72, 0x76,
-	0x69, 0x63, 0x65, 0x12, 0x55, 0x0a, 0x0e, 0x55, 0x70, 0x64, 0x61, 0x74, 0x65, 0x49, 0x6e, 0x76,
-	0x6f, 0x69, 0x63, 0x65, 0x73, 0x12, 0x1f, 0x2e, 0x75, 0x73, 0x61, 0x67, 0x65, 0x2e, 0x76, 0x31,
-	0x2e, 0x55, 0x70, 0x64, 0x61, 0x74, 0x65, 0x49, 0x6e, 0x76, 0x6f, 0x69, 0x63, 0x65, 0x73, 0x52,
-	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x20, 0x2e, 0x75, 0x73, 0x61, 0x67, 0x65, 0x2e, 0x76,
-	0x31, 0x2e, 0x55, 0x70, 0x64, 0x61, 0x74, 0x65, 0x49, 0x6e, 0x76, 0x6f, 0x69, 0x63, 0x65, 0x73,
-	0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x12, 0x61, 0x0a, 0x12, 0x47, 0x65,
-	0x74, 0x55, 0x70, 0x63, 0x6f, 0x6d, 0x69, 0x6e, 0x67, 0x49, 0x6e, 0x76, 0x6f, 0x69, 0x63, 0x65,
-	0x12, 0x23, 0x2e, 0x75, 0x73, 0x61, 0x67, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x47, 0x65, 0x74, 0x55,
-	0x70, 0x63, 0x6f, 0x6d, 0x69, 0x6e, 0x67, 0x49, 0x6e, 0x76, 0x6f, 0x69, 0x63, 0x65, 0x52, 0x65,
-	0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x24, 0x2e, 0x75, 0x73, 0x61, 0x67, 0x65, 0x2e, 0x76, 0x31,
-	0x2e, 0x47, 0x65, 0x74, 0x55, 0x70, 0x63, 0x6f, 0x6d, 0x69, 0x6e, 0x67, 0x49, 0x6e, 0x76, 0x6f,
-	0x69, 0x63, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x12, 0x58, 0x0a,
-	0x0f, 0x46, 0x69, 0x6e, 0x61, 0x6c, 0x69, 0x7a, 0x65, 0x49, 0x6e, 0x76, 0x6f, 0x69, 0x63, 0x65,
-	0x12, 0x20, 0x2e, 0x75, 0x73, 0x61, 0x67, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x46, 0x69, 0x6e, 0x61,
-	0x6c, 0x69, 0x7a, 0x65, 0x49, 0x6e, 0x76, 0x6f, 0x69, 0x63, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65,
-	0x73, 0x74, 0x1a, 0x21, 0x2e, 0x75, 0x73, 0x61, 0x67, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x46, 0x69,
-	0x6e, 0x61, 0x6c, 0x69, 0x7a, 0x65, 0x49, 0x6e, 0x76, 0x6f, 0x69, 0x63, 0x65, 0x52, 0x65, 0x73,
-	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x12, 0x5b, 0x0a, 0x10, 0x53, 0x65, 0x74, 0x42, 0x69,
-	0x6c, 0x6c, 0x65, 0x64, 0x53, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x21, 0x2e, 0x75, 0x73,
-	0x61, 0x67, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x53, 0x65, 0x74, 0x42, 0x69, 0x6c, 0x6c, 0x65, 0x64,
-	0x53, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x22,
-	0x2e, 0x75, 0x73, 0x61, 0x67, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x53, 0x65, 0x74, 0x42, 0x69, 0x6c,
-	0x6c, 0x65, 0x64, 0x53, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e,
-	0x73, 0x65, 0x22, 0x00, 0x42, 0x2a, 0x5a, 0x28, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63,
-	0x6f, 0x6d, 0x2f, 0x67, 0x69, 0x74, 0x70, 0x6f, 0x64, 0x2d, 0x69, 0x6f, 0x2f, 0x67, 0x69, 0x74,
-	0x70, 0x6f, 0x64, 0x2f, 0x75, 0x73, 0x61, 0x67, 0x65, 0x2d, 0x61, 0x70, 0x69, 0x2f, 0x76, 0x31,
-	0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x52, 0x06, 0x61, 0x6d, 0x6f, 0x75, 0x6e, 0x74, 0x12, 0x10, 0x0a, 0x03, 0x74, 0x61, 0x78, 0x18,
+	0x04, 0x20, 0x01, 0x28, 0x01, 0x52, 0x03, 0x74, 0x61, 0x78, 0x22, 0x37, 0x0a, 0x16, 0x46, 0x69,
+	0x6e, 0x61, 0x6c, 0x69, 0x7a, 0x65, 0x49, 0x6e, 0x76, 0x6f, 0x69, 0x63, 0x65, 0x52, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x12, 0x1d, 0x0a, 0x0a, 0x69, 0x6e, 0x76, 0x6f, 0x69, 0x63, 0x65, 0x5f,
+	0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x69, 0x6e, 0x76, 0x6f, 0x69, 0x63,
+	0x65, 0x49, 0x64, 0x22, 0x19, 0x0a, 0x17, 0x46, 0x69, 0x6e, 0x61, 0x6c, 0x69, 0x7a, 0x65, 0x49,
+	0x6e, 0x76, 0x6f, 0x69, 0x63, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x94,
+	0x01, 0x0a, 0x17, 0x53, 0x65, 0x74, 0x42, 0x69, 0x6c, 0x6c, 0x65, 0x64, 0x53, 0x65, 0x73, 0x73,
+	0x69, 0x6f, 0x6e, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x1f, 0x0a, 0x0b, 0x69, 0x6e,
+	0x73, 0x74, 0x61, 0x6e, 0x63, 0x65, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x0a, 0x69, 0x6e, 0x73, 0x74, 0x61, 0x6e, 0x63, 0x65, 0x49, 0x64, 0x12, 0x2e, 0x0a, 0x04, 0x66,
+	0x72, 0x6f, 0x6d, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x6f, 0x6f, 0x67,
+	0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x54, 0x69, 0x6d, 0x65,
+	0x73, 0x74, 0x61, 0x6d, 0x70, 0x52, 0x04, 0x66, 0x72, 0x6f, 0x6d, 0x12, 0x28, 0x0a, 0x06, 0x73,
+	0x79, 0x73, 0x74, 0x65, 0x6d, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x10, 0x2e, 0x75, 0x73,
+	0x61, 0x67, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x53, 0x79, 0x73, 0x74, 0x65, 0x6d, 0x52, 0x06, 0x73,
+	0x79, 0x73, 0x74, 0x65, 0x6d, 0x22, 0x1a, 0x0a, 0x18, 0x53, 0x65, 0x74, 0x42, 0x69, 0x6c, 0x6c,
+	0x65, 0x64, 0x53, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73,
+	0x65, 0x2a, 0x45, 0x0a, 0x06, 0x53, 0x79, 0x73, 0x74, 0x65, 0x6d, 0x12, 0x12, 0x0a, 0x0e, 0x53,
+	0x59, 0x53, 0x54, 0x45, 0x4d, 0x5f, 0x55, 0x4e, 0x4b, 0x4e, 0x4f, 0x57, 0x4e, 0x10, 0x00, 0x12,
+	0x14, 0x0a, 0x10, 0x53, 0x59, 0x53, 0x54, 0x45, 0x4d, 0x5f, 0x43, 0x48, 0x41, 0x52, 0x47, 0x45,
+	0x42, 0x45, 0x45, 0x10, 0x01, 0x12, 0x11, 0x0a, 0x0d, 0x53, 0x59, 0x53, 0x54, 0x45, 0x4d, 0x5f,
+	0x53, 0x54, 0x52, 0x49, 0x50, 0x45, 0x10, 0x02, 0x32, 0xb3, 0x08, 0x0a, 0x0e, 0x42, 0x69, 0x6c,
+	0x6c, 0x69, 0x6e, 0x67, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x12, 0x55, 0x0a, 0x0e, 0x55,
+	0x70, 0x64, 0x61, 0x74, 0x65, 0x49, 0x6e, 0x76, 0x6f, 0x69, 0x63, 0x65, 0x73, 0x12, 0x1f, 0x2e,
+	0x75, 0x73, 0x61, 0x67, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x55, 0x70, 0x64, 0x61, 0x74, 0x65, 0x49,
+	0x6e, 0x76, 0x6f, 0x69, 0x63, 0x65, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x20,
+	0x2e, 0x75, 0x73, 0x61, 0x67, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x55, 0x70, 0x64, 0x61, 0x74, 0x65,
+	0x49, 0x6e, 0x76, 0x6f, 0x69, 0x63, 0x65, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65,
+	0x22, 0x00, 0x12, 0x61, 0x0a, 0x12, 0x47, 0x65, 0x74, 0x55, 0x70, 0x63, 0x6f, 0x6d, 0x69, 0x6e,
+	0x67, 0x49, 0x6e, 0x76, 0x6f, 0x69, 0x63, 0x65, 0x12, 0x23, 0x2e, 0x75, 0x73, 0x61, 0x67, 0x65,
+	0x2e, 0x76, 0x31, 0x2e, 0x47, 0x65, 0x74, 0x55, 0x70, 0x63, 0x6f, 0x6d, 0x69, 0x6e, 0x67, 0x49,
+	0x6e, 0x76, 0x6f, 0x69, 0x63, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x24, 0x2e,
+	0x75, 0x73, 0x61, 0x67, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x47, 0x65, 0x74, 0x55, 0x70, 0x63, 0x6f,
+	0x6d, 0x69, 0x6e, 0x67, 0x49, 0x6e, 0x76, 0x6f, 0x69, 0x63, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f,
+	0x6e, 0x73, 0x65, 0x22, 0x00, 0x12, 0x58, 0x0a, 0x0f, 0x46, 0x69, 0x6e, 0x61, 0x6c, 0x69, 0x7a,
+	0x65, 0x49, 0x6e, 0x76, 0x6f, 0x69, 0x63, 0x65, 0x12, 0x20, 0x2e, 0x75, 0x73, 0x61, 0x67, 0x65,
+	0x2e, 0x76, 0x31, 0x2e, 0x46, 0x69, 0x6e, 0x61, 0x6c, 0x69, 0x7a, 0x65, 0x49, 0x6e, 0x76, 0x6f,
+	0x69, 0x63, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x21, 0x2e, 0x75, 0x73, 0x61,
+	0x67, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x46, 0x69, 0x6e, 0x61, 0x6c, 0x69, 0x7a, 0x65, 0x49, 0x6e,
+	0x76, 0x6f, 0x69, 0x63, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x12,
+	0x5b, 0x0a, 0x10, 0x53, 0x65, 0x74, 0x42, 0x69, 0x6c, 0x6c, 0x65, 0x64, 0x53, 0x65, 0x73, 0x73,
+	0x69, 0x6f, 0x6e, 0x12, 0x21, 0x2e, 0x75, 0x73, 0x61, 0x67, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x53,
+	0x65, 0x74, 0x42, 0x69, 0x6c, 0x6c, 0x65, 0x64, 0x53, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x52,
+	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x22, 0x2e, 0x75, 0x73, 0x61, 0x67, 0x65, 0x2e, 0x76,
+	0x31, 0x2e, 0x53, 0x65, 0x74, 0x42, 0x69, 0x6c, 0x6c, 0x65, 0x64, 0x53, 0x65, 0x73, 0x73, 0x69,
+	0x6f, 0x6e, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x12, 0x5e, 0x0a, 0x11,
+	0x52, 0x65, 0x63, 0x6f, 0x6e, 0x63, 0x69, 0x6c, 0x65, 0x49, 0x6e, 0x76, 0x6f, 0x69, 0x63, 0x65,
+	0x73, 0x12, 0x22, 0x2e, 0x75, 0x73, 0x61, 0x67, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x52, 0x65, 0x63,
+	0x6f, 0x6e, 0x63, 0x69, 0x6c, 0x65, 0x49, 0x6e, 0x76, 0x6f, 0x69, 0x63, 0x65, 0x73, 0x52, 0x65,
+	0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x23, 0x2e, 0x75, 0x73, 0x61, 0x67, 0x65, 0x2e, 0x76, 0x31,
+	0x2e, 0x52, 0x65, 0x63, 0x6f, 0x6e, 0x63, 0x69, 0x6c, 0x65, 0x49, 0x6e, 0x76, 0x6f, 0x69, 0x63,
+	0x65, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x12, 0x5e, 0x0a, 0x11,
+	0x47, 0x65, 0x74, 0x53, 0x74, 0x72, 0x69, 0x70, 0x65, 0x43, 0x75, 0x73, 0x74, 0x6f, 0x6d, 0x65,
+	0x72, 0x12, 0x22, 0x2e, 0x75, 0x73, 0x61, 0x67, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x47, 0x65, 0x74,
+	0x53, 0x74, 0x72, 0x69, 0x70, 0x65, 0x43, 0x75, 0x73, 0x74, 0x6f, 0x6d, 0x65, 0x72, 0x52, 0x65,
+	0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x23, 0x2e, 0x75, 0x73, 0x61, 0x67, 0x65, 0x2e, 0x76, 0x31,
+	0x2e, 0x47, 0x65, 0x74, 0x53, 0x74, 0x72, 0x69, 0x70, 0x65, 0x43, 0x75, 0x73, 0x74, 0x6f, 0x6d,
+	0x65, 0x72, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x12, 0x73, 0x0a, 0x18,
+	0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x53, 0x74, 0x72, 0x69, 0x70, 0x65, 0x53, 0x75, 0x62, 0x73,
+	0x63, 0x72, 0x69, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x29, 0x2e, 0x75, 0x73, 0x61, 0x67, 0x65,
+	0x2e, 0x76, 0x31, 0x2e, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x53, 0x74, 0x72, 0x69, 0x70, 0x65,
+	0x53, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x65, 0x71, 0x75,
+	0x65, 0x73, 0x74, 0x1a, 0x2a, 0x2e, 0x75, 0x73, 0x61, 0x67, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x43,
+	0x72, 0x65, 0x61, 0x74, 0x65, 0x53, 0x74, 0x72, 0x69, 0x70, 0x65, 0x53, 0x75, 0x62, 0x73, 0x63,
+	0x72, 0x69, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22,
+	0x00, 0x12, 0x46, 0x0a, 0x09, 0x56, 0x6f, 0x69, 0x64, 0x55, 0x73, 0x61, 0x67, 0x65, 0x12, 0x1a,
+	0x2e, 0x75, 0x73, 0x61, 0x67, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x56, 0x6f, 0x69, 0x64, 0x55, 0x73,
+	0x61, 0x67, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x1b, 0x2e, 0x75, 0x73, 0x61,
+	0x67, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x56, 0x6f, 0x69, 0x64, 0x55, 0x73, 0x61, 0x67, 0x65, 0x52,
+	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x12, 0x7c, 0x0a, 0x1b, 0x52, 0x65, 0x63,
+	0x6f, 0x6e, 0x63, 0x69, 0x6c, 0x65, 0x4c, 0x65, 0x64, 0x67, 0x65, 0x72, 0x57, 0x69, 0x74, 0x68,
+	0x49, 0x6e, 0x76, 0x6f, 0x69, 0x63, 0x65, 0x73, 0x12, 0x2c, 0x2e, 0x75, 0x73, 0x61, 0x67, 0x65,
+	0x2e, 0x76, 0x31, 0x2e, 0x52, 0x65, 0x63, 0x6f, 0x6e, 0x63, 0x69, 0x6c, 0x65, 0x4c, 0x65, 0x64,
+	0x67, 0x65, 0x72, 0x57, 0x69, 0x74, 0x68, 0x49, 0x6e, 0x76, 0x6f, 0x69, 0x63, 0x65, 0x73, 0x52,
+	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x2d, 0x2e, 0x75, 0x73, 0x61, 0x67, 0x65, 0x2e, 0x76,
+	0x31, 0x2e, 0x52, 0x65, 0x63, 0x6f, 0x6e, 0x63, 0x69, 0x6c, 0x65, 0x4c, 0x65, 0x64, 0x67, 0x65,
+	0x72, 0x57, 0x69, 0x74, 0x68, 0x49, 0x6e, 0x76, 0x6f, 0x69, 0x63, 0x65, 0x73, 0x52, 0x65, 0x73,
+	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x12, 0x5b, 0x0a, 0x10, 0x4c, 0x69, 0x73, 0x74, 0x42,
+	0x69, 0x6c, 0x6c, 0x69, 0x6e, 0x67, 0x44, 0x72, 0x69, 0x66, 0x74, 0x12, 0x21, 0x2e, 0x75, 0x73,
+	0x61, 0x67, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x42, 0x69, 0x6c, 0x6c, 0x69,
+	0x6e, 0x67, 0x44, 0x72, 0x69, 0x66, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x22,
+	0x2e, 0x75, 0x73, 0x61, 0x67, 0x65, 0x2e, 0x76, 0x31, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x42, 0x69,
+	0x6c, 0x6c, 0x69, 0x6e, 0x67, 0x44, 0x72, 0x69, 0x66, 0x74, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e,
+	0x73, 0x65, 0x22, 0x00, 0x12, 0x58, 0x0a, 0x0f, 0x50, 0x75, 0x72, 0x63, 0x68, 0x61, 0x73, 0x65,
+	0x43, 0x72, 0x65, 0x64, 0x69, 0x74, 0x73, 0x12, 0x20, 0x2e, 0x75, 0x73, 0x61, 0x67, 0x65, 0x2e,
+	0x76, 0x31, 0x2e, 0x50, 0x75, 0x72, 0x63, 0x68, 0x61, 0x73, 0x65, 0x43, 0x72, 0x65, 0x64, 0x69,
+	0x74, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x21, 0x2e, 0x75, 0x73, 0x61, 0x67,
+	0x65, 0x2e, 0x76, 0x31, 0x2e, 0x50, 0x75, 0x72, 0x63, 0x68, 0x61, 0x73, 0x65, 0x43, 0x72, 0x65,
+	0x64, 0x69, 0x74, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x42, 0x2a,
+	0x5a, 0x28, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x67, 0x69, 0x74,
+	0x70, 0x6f, 0x64, 0x2d, 0x69, 0x6f, 0x2f, 0x67, 0x69, 0x74, 0x70, 0x6f, 0x64, 0x2f, 0x75, 0x73,
+	0x61, 0x67, 0x65, 0x2d, 0x61, 0x70, 0x69, 0x2f, 0x76, 0x31, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x33,
 }
 
 var (
@@ -629,39 +2013,86 @@ func file_usage_v1_billing_proto_rawDescGZIP() []byte {
 }
 
 var file_usage_v1_billing_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
-var file_usage_v1_billing_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
+var file_usage_v1_billing_proto_msgTypes = make([]protoimpl.MessageInfo, 26)
 var file_usage_v1_billing_proto_goTypes = []interface{}{
-	(System)(0),                        // 0: usage.v1.System
-	(*UpdateInvoicesRequest)(nil),      // 1: usage.v1.UpdateInvoicesRequest
-	(*UpdateInvoicesResponse)(nil),     // 2: usage.v1.UpdateInvoicesResponse
-	(*GetUpcomingInvoiceRequest)(nil),  // 3: usage.v1.GetUpcomingInvoiceRequest
-	(*GetUpcomingInvoiceResponse)(nil), // 4: usage.v1.GetUpcomingInvoiceResponse
-	(*FinalizeInvoiceRequest)(nil),     // 5: usage.v1.FinalizeInvoiceRequest
-	(*FinalizeInvoiceResponse)(nil),    // 6: usage.v1.FinalizeInvoiceResponse
-	(*SetBilledSessionRequest)(nil),    // 7: usage.v1.SetBilledSessionRequest
-	(*SetBilledSessionResponse)(nil),   // 8: usage.v1.SetBilledSessionResponse
-	(*timestamppb.Timestamp)(nil),      // 9: google.protobuf.Timestamp
-	(*BilledSession)(nil),              // 10: usage.v1.BilledSession
+	(System)(0),                                 // 0: usage.v1.System
+	(*PurchaseCreditsRequest)(nil),              // 1: usage.v1.PurchaseCreditsRequest
+	(*PurchaseCreditsResponse)(nil),             // 2: usage.v1.PurchaseCreditsResponse
+	(*ReconcileLedgerWithInvoicesRequest)(nil),  // 3: usage.v1.ReconcileLedgerWithInvoicesRequest
+	(*ReconcileLedgerWithInvoicesResponse)(nil), // 4: usage.v1.ReconcileLedgerWithInvoicesResponse
+	(*InvoiceLedgerMismatch)(nil),               // 5: usage.v1.InvoiceLedgerMismatch
+	(*ListBillingDriftRequest)(nil),             // 6: usage.v1.ListBillingDriftRequest
+	(*ListBillingDriftResponse)(nil),            // 7: usage.v1.ListBillingDriftResponse
+	(*BillingDrift)(nil),                        // 8: usage.v1.BillingDrift
+	(*VoidUsageRequest)(nil),                    // 9: usage.v1.VoidUsageRequest
+	(*VoidUsageResponse)(nil),                   // 10: usage.v1.VoidUsageResponse
+	(*CreateStripeSubscriptionRequest)(nil),     // 11: usage.v1.CreateStripeSubscriptionRequest
+	(*CreateStripeSubscriptionResponse)(nil),    // 12: usage.v1.CreateStripeSubscriptionResponse
+	(*GetStripeCustomerRequest)(nil),            // 13: usage.v1.GetStripeCustomerRequest
+	(*GetStripeCustomerResponse)(nil),           // 14: usage.v1.GetStripeCustomerResponse
+	(*StripeCustomer)(nil),                      // 15: usage.v1.StripeCustomer
+	(*ReconcileInvoicesRequest)(nil),            // 16: usage.v1.ReconcileInvoicesRequest
+	(*ReconcileInvoicesResponse)(nil),           // 17: usage.v1.ReconcileInvoicesResponse
+	(*UpdateInvoicesRequest)(nil),               // 18: usage.v1.UpdateInvoicesRequest
+	(*UpdateInvoicesResponse)(nil),              // 19: usage.v1.UpdateInvoicesResponse
+	(*GetUpcomingInvoiceRequest)(nil),           // 20: usage.v1.GetUpcomingInvoiceRequest
+	(*GetUpcomingInvoiceResponse)(nil),          // 21: usage.v1.GetUpcomingInvoiceResponse
+	(*UpcomingInvoiceLineItem)(nil),             // 22: usage.v1.UpcomingInvoiceLineItem
+	(*FinalizeInvoiceRequest)(nil),              // 23: usage.v1.FinalizeInvoiceRequest
+	(*FinalizeInvoiceResponse)(nil),             // 24: usage.v1.FinalizeInvoiceResponse
+	(*SetBilledSessionRequest)(nil),             // 25: usage.v1.SetBilledSessionRequest
+	(*SetBilledSessionResponse)(nil),            // 26: usage.v1.SetBilledSessionResponse
+	(*timestamppb.Timestamp)(nil),               // 27: google.protobuf.Timestamp
+	(*BilledSession)(nil),                       // 28: usage.v1.BilledSession
 }
 var file_usage_v1_billing_proto_depIdxs = []int32{
-	9,  // 0: usage.v1.UpdateInvoicesRequest.start_time:type_name -> google.protobuf.Timestamp
-	9,  // 1: usage.v1.UpdateInvoicesRequest.end_time:type_name -> google.protobuf.Timestamp
-	10, // 2: usage.v1.UpdateInvoicesRequest.sessions:type_name -> usage.v1.BilledSession
-	9,  // 3: usage.v1.SetBilledSessionRequest.from:type_name -> google.protobuf.Timestamp
-	0,  // 4: usage.v1.SetBilledSessionRequest.system:type_name -> usage.v1.System
-	1,  // 5: usage.v1.BillingService.UpdateInvoices:input_type -> usage.v1.UpdateInvoicesRequest
-	3,  // 6: usage.v1.BillingService.GetUpcomingInvoice:input_type -> usage.v1.GetUpcomingInvoiceRequest
-	5,  // 7: usage.v1.BillingService.FinalizeInvoice:input_type -> usage.v1.FinalizeInvoiceRequest
-	7,  // 8: usage.v1.BillingService.SetBilledSession:input_type -> usage.v1.SetBilledSessionRequest
-	2,  // 9: usage.v1.BillingService.UpdateInvoices:output_type -> usage.v1.UpdateInvoicesResponse
-	4,  // 10: usage.v1.BillingService.GetUpcomingInvoice:output_type -> usage.v1.GetUpcomingInvoiceResponse
-	6,  // 11: usage.v1.BillingService.FinalizeInvoice:output_type -> usage.v1.FinalizeInvoiceResponse
-	8,  // 12: usage.v1.BillingService.SetBilledSession:output_type -> usage.v1.SetBilledSessionResponse
-	9,  // [9:13] is the sub-list for method output_type
-	5,  // [5:9] is the sub-list for method input_type
-	5,  // [5:5] is the sub-list for extension type_name
-	5,  // [5:5] is the sub-list for extension extendee
-	0,  // [0:5] is the sub-list for field type_name
+	27, // 0: usage.v1.ReconcileLedgerWithInvoicesRequest.from:type_name -> google.protobuf.Timestamp
+	27, // 1: usage.v1.ReconcileLedgerWithInvoicesRequest.to:type_name -> google.protobuf.Timestamp
+	5,  // 2: usage.v1.ReconcileLedgerWithInvoicesResponse.mismatches:type_name -> usage.v1.InvoiceLedgerMismatch
+	27, // 3: usage.v1.ListBillingDriftRequest.from:type_name -> google.protobuf.Timestamp
+	27, // 4: usage.v1.ListBillingDriftRequest.to:type_name -> google.protobuf.Timestamp
+	8,  // 5: usage.v1.ListBillingDriftResponse.mismatches:type_name -> usage.v1.BillingDrift
+	27, // 6: usage.v1.BillingDrift.period_start:type_name -> google.protobuf.Timestamp
+	15, // 7: usage.v1.CreateStripeSubscriptionResponse.customer:type_name -> usage.v1.StripeCustomer
+	15, // 8: usage.v1.GetStripeCustomerResponse.customer:type_name -> usage.v1.StripeCustomer
+	27, // 9: usage.v1.ReconcileInvoicesRequest.from:type_name -> google.protobuf.Timestamp
+	27, // 10: usage.v1.ReconcileInvoicesRequest.to:type_name -> google.protobuf.Timestamp
+	27, // 11: usage.v1.UpdateInvoicesRequest.start_time:type_name -> google.protobuf.Timestamp
+	27, // 12: usage.v1.UpdateInvoicesRequest.end_time:type_name -> google.protobuf.Timestamp
+	28, // 13: usage.v1.UpdateInvoicesRequest.sessions:type_name -> usage.v1.BilledSession
+	22, // 14: usage.v1.GetUpcomingInvoiceResponse.line_items:type_name -> usage.v1.UpcomingInvoiceLineItem
+	27, // 15: usage.v1.GetUpcomingInvoiceResponse.due_date:type_name -> google.protobuf.Timestamp
+	27, // 16: usage.v1.GetUpcomingInvoiceResponse.period_start:type_name -> google.protobuf.Timestamp
+	27, // 17: usage.v1.GetUpcomingInvoiceResponse.period_end:type_name -> google.protobuf.Timestamp
+	27, // 18: usage.v1.SetBilledSessionRequest.from:type_name -> google.protobuf.Timestamp
+	0,  // 19: usage.v1.SetBilledSessionRequest.system:type_name -> usage.v1.System
+	18, // 20: usage.v1.BillingService.UpdateInvoices:input_type -> usage.v1.UpdateInvoicesRequest
+	20, // 21: usage.v1.BillingService.GetUpcomingInvoice:input_type -> usage.v1.GetUpcomingInvoiceRequest
+	23, // 22: usage.v1.BillingService.FinalizeInvoice:input_type -> usage.v1.FinalizeInvoiceRequest
+	25, // 23: usage.v1.BillingService.SetBilledSession:input_type -> usage.v1.SetBilledSessionRequest
+	16, // 24: usage.v1.BillingService.ReconcileInvoices:input_type -> usage.v1.ReconcileInvoicesRequest
+	13, // 25: usage.v1.BillingService.GetStripeCustomer:input_type -> usage.v1.GetStripeCustomerRequest
+	11, // 26: usage.v1.BillingService.CreateStripeSubscription:input_type -> usage.v1.CreateStripeSubscriptionRequest
+	9,  // 27: usage.v1.BillingService.VoidUsage:input_type -> usage.v1.VoidUsageRequest
+	3,  // 28: usage.v1.BillingService.ReconcileLedgerWithInvoices:input_type -> usage.v1.ReconcileLedgerWithInvoicesRequest
+	6,  // 29: usage.v1.BillingService.ListBillingDrift:input_type -> usage.v1.ListBillingDriftRequest
+	1,  // 30: usage.v1.BillingService.PurchaseCredits:input_type -> usage.v1.PurchaseCreditsRequest
+	19, // 31: usage.v1.BillingService.UpdateInvoices:output_type -> usage.v1.UpdateInvoicesResponse
+	21, // 32: usage.v1.BillingService.GetUpcomingInvoice:output_type -> usage.v1.GetUpcomingInvoiceResponse
+	24, // 33: usage.v1.BillingService.FinalizeInvoice:output_type -> usage.v1.FinalizeInvoiceResponse
+	26, // 34: usage.v1.BillingService.SetBilledSession:output_type -> usage.v1.SetBilledSessionResponse
+	17, // 35: usage.v1.BillingService.ReconcileInvoices:output_type -> usage.v1.ReconcileInvoicesResponse
+	14, // 36: usage.v1.BillingService.GetStripeCustomer:output_type -> usage.v1.GetStripeCustomerResponse
+	12, // 37: usage.v1.BillingService.CreateStripeSubscription:output_type -> usage.v1.CreateStripeSubscriptionResponse
+	10, // 38: usage.v1.BillingService.VoidUsage:output_type -> usage.v1.VoidUsageResponse
+	4,  // 39: usage.v1.BillingService.ReconcileLedgerWithInvoices:output_type -> usage.v1.ReconcileLedgerWithInvoicesResponse
+	7,  // 40: usage.v1.BillingService.ListBillingDrift:output_type -> usage.v1.ListBillingDriftResponse
+	2,  // 41: usage.v1.BillingService.PurchaseCredits:output_type -> usage.v1.PurchaseCreditsResponse
+	31, // [31:42] is the sub-list for method output_type
+	20, // [20:31] is the sub-list for method input_type
+	20, // [20:20] is the sub-list for extension type_name
+	20, // [20:20] is the sub-list for extension extendee
+	0,  // [0:20] is the sub-list for field type_name
 }
 
 func init() { file_usage_v1_billing_proto_init() }
@@ -672,7 +2103,7 @@ func file_usage_v1_billing_proto_init() {
 	file_usage_v1_usage_proto_init()
 	if !protoimpl.UnsafeEnabled {
 		file_usage_v1_billing_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*UpdateInvoicesRequest); i {
+			switch v := v.(*PurchaseCreditsRequest); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -684,7 +2115,7 @@ func file_usage_v1_billing_proto_init() {
 			}
 		}
 		file_usage_v1_billing_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*UpdateInvoicesResponse); i {
+			switch v := v.(*PurchaseCreditsResponse); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -696,7 +2127,7 @@ func file_usage_v1_billing_proto_init() {
 			}
 		}
 		file_usage_v1_billing_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*GetUpcomingInvoiceRequest); i {
+			switch v := v.(*ReconcileLedgerWithInvoicesRequest); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -708,7 +2139,7 @@ func file_usage_v1_billing_proto_init() {
 			}
 		}
 		file_usage_v1_billing_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*GetUpcomingInvoiceResponse); i {
+			switch v := v.(*ReconcileLedgerWithInvoicesResponse); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -720,7 +2151,7 @@ func file_usage_v1_billing_proto_init() {
 			}
 		}
 		file_usage_v1_billing_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*FinalizeInvoiceRequest); i {
+			switch v := v.(*InvoiceLedgerMismatch); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -732,7 +2163,7 @@ func file_usage_v1_billing_proto_init() {
 			}
 		}
 		file_usage_v1_billing_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*FinalizeInvoiceResponse); i {
+			switch v := v.(*ListBillingDriftRequest); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -744,7 +2175,7 @@ func file_usage_v1_billing_proto_init() {
 			}
 		}
 		file_usage_v1_billing_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*SetBilledSessionRequest); i {
+			switch v := v.(*ListBillingDriftResponse); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -756,6 +2187,222 @@ func file_usage_v1_billing_proto_init() {
 			}
 		}
 		file_usage_v1_billing_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*BillingDrift); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_usage_v1_billing_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*VoidUsageRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_usage_v1_billing_proto_msgTypes[9].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*VoidUsageResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_usage_v1_billing_proto_msgTypes[10].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*CreateStripeSubscriptionRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_usage_v1_billing_proto_msgTypes[11].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*CreateStripeSubscriptionResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_usage_v1_billing_proto_msgTypes[12].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*GetStripeCustomerRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_usage_v1_billing_proto_msgTypes[13].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*GetStripeCustomerResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_usage_v1_billing_proto_msgTypes[14].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*StripeCustomer); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_usage_v1_billing_proto_msgTypes[15].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ReconcileInvoicesRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_usage_v1_billing_proto_msgTypes[16].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ReconcileInvoicesResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_usage_v1_billing_proto_msgTypes[17].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*UpdateInvoicesRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_usage_v1_billing_proto_msgTypes[18].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*UpdateInvoicesResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_usage_v1_billing_proto_msgTypes[19].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*GetUpcomingInvoiceRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_usage_v1_billing_proto_msgTypes[20].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*GetUpcomingInvoiceResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_usage_v1_billing_proto_msgTypes[21].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*UpcomingInvoiceLineItem); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_usage_v1_billing_proto_msgTypes[22].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*FinalizeInvoiceRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_usage_v1_billing_proto_msgTypes[23].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*FinalizeInvoiceResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_usage_v1_billing_proto_msgTypes[24].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SetBilledSessionRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_usage_v1_billing_proto_msgTypes[25].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*SetBilledSessionResponse); i {
 			case 0:
 				return &v.state
@@ -768,9 +2415,10 @@ func file_usage_v1_billing_proto_init() {
 			}
 		}
 	}
-	file_usage_v1_billing_proto_msgTypes[2].OneofWrappers = []interface{}{
+	file_usage_v1_billing_proto_msgTypes[19].OneofWrappers = []interface{}{
 		(*GetUpcomingInvoiceRequest_TeamId)(nil),
 		(*GetUpcomingInvoiceRequest_UserId)(nil),
+		(*GetUpcomingInvoiceRequest_AttributionId)(nil),
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
@@ -778,7 +2426,7 @@ func file_usage_v1_billing_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_usage_v1_billing_proto_rawDesc,
 			NumEnums:      1,
-			NumMessages:   8,
+			NumMessages:   26,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -30,13 +30,39 @@ type BillingServiceClient interface {
 	// in a billing system.
 	// This is an Internal RPC used by the usage reconciler and not intended for general consumption.
 	UpdateInvoices(ctx context.Context, in *UpdateInvoicesRequest, opts ...grpc.CallOption) (*UpdateInvoicesResponse, error)
-	// GetUpcomingInvoice retrieves the latest invoice for a given query.
+	// GetUpcomingInvoice retrieves the latest invoice for a given query, combined with the credits
+	// recorded in the ledger for the current period.
 	GetUpcomingInvoice(ctx context.Context, in *GetUpcomingInvoiceRequest, opts ...grpc.CallOption) (*GetUpcomingInvoiceResponse, error)
 	// FinalizeInvoice marks all sessions occurring in the given Stripe invoice as
 	// having been invoiced.
 	FinalizeInvoice(ctx context.Context, in *FinalizeInvoiceRequest, opts ...grpc.CallOption) (*FinalizeInvoiceResponse, error)
 	// SetBilledSession marks an instance as billed with a billing system
 	SetBilledSession(ctx context.Context, in *SetBilledSessionRequest, opts ...grpc.CallOption) (*SetBilledSessionResponse, error)
+	// ReconcileInvoices reflects the finalized usage recorded in the ledger for the given period in the billing system.
+	// This is an Internal RPC used by the ledger reconciler and not intended for general consumption.
+	ReconcileInvoices(ctx context.Context, in *ReconcileInvoicesRequest, opts ...grpc.CallOption) (*ReconcileInvoicesResponse, error)
+	// GetStripeCustomer retrieves the Stripe customer of the given attribution ID.
+	// Lookups are cached, including lookups for attribution IDs without a customer.
+	GetStripeCustomer(ctx context.Context, in *GetStripeCustomerRequest, opts ...grpc.CallOption) (*GetStripeCustomerResponse, error)
+	// CreateStripeSubscription subscribes the given attribution ID to usage-based billing in Stripe.
+	// It creates the Stripe customer if needed, attaches the payment method of the setup intent,
+	// creates the subscription and switches the cost center to Stripe billing.
+	CreateStripeSubscription(ctx context.Context, in *CreateStripeSubscriptionRequest, opts ...grpc.CallOption) (*CreateStripeSubscriptionResponse, error)
+	// VoidUsage reverses a finalized usage entry in the ledger. When the usage was already invoiced,
+	// a credit note is issued on the invoice, such that the invoice matches the ledger.
+	VoidUsage(ctx context.Context, in *VoidUsageRequest, opts ...grpc.CallOption) (*VoidUsageResponse, error)
+	// ReconcileLedgerWithInvoices ensures that every invoice finalized in the billing system in the given period is
+	// credited in the ledger. Missing ledger entries are created, ledger entries which do not match their invoice are
+	// reported as mismatches.
+	// This is an Internal RPC used by the invoice ledger reconciler and not intended for general consumption.
+	ReconcileLedgerWithInvoices(ctx context.Context, in *ReconcileLedgerWithInvoicesRequest, opts ...grpc.CallOption) (*ReconcileLedgerWithInvoicesResponse, error)
+	// ListBillingDrift compares the credits each team used according to the ledger with the usage reported to the
+	// billing system for the same billing period, and lists the teams whose usage differs. Nothing is corrected.
+	// This is an Internal RPC used by the billing drift reconciler and for investigating billing issues.
+	ListBillingDrift(ctx context.Context, in *ListBillingDriftRequest, opts ...grpc.CallOption) (*ListBillingDriftResponse, error)
+	// PurchaseCredits charges the default payment method of the Stripe customer of the given attribution ID once.
+	// The credits are granted in the ledger when Stripe confirms the payment.
+	PurchaseCredits(ctx context.Context, in *PurchaseCreditsRequest, opts ...grpc.CallOption) (*PurchaseCreditsResponse, error)
 }
 
 type billingServiceClient struct {
@@ -83,6 +109,69 @@ func (c *billingServiceClient) SetBilledSession(ctx context.Context, in *SetBill
 	return out, nil
 }
 
+func (c *billingServiceClient) ReconcileInvoices(ctx context.Context, in *ReconcileInvoicesRequest, opts ...grpc.CallOption) (*ReconcileInvoicesResponse, error) {
+	out := new(ReconcileInvoicesResponse)
+	err := c.cc.Invoke(ctx, "/usage.v1.BillingService/ReconcileInvoices", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *billingServiceClient) GetStripeCustomer(ctx context.Context, in *GetStripeCustomerRequest, opts ...grpc.CallOption) (*GetStripeCustomerResponse, error) {
+	out := new(GetStripeCustomerResponse)
+	err := c.cc.Invoke(ctx, "/usage.v1.BillingService/GetStripeCustomer", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *billingServiceClient) CreateStripeSubscription(ctx context.Context, in *CreateStripeSubscriptionRequest, opts ...grpc.CallOption) (*CreateStripeSubscriptionResponse, error) {
+	out := new(CreateStripeSubscriptionResponse)
+	err := c.cc.Invoke(ctx, "/usage.v1.BillingService/CreateStripeSubscription", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *billingServiceClient) VoidUsage(ctx context.Context, in *VoidUsageRequest, opts ...grpc.CallOption) (*VoidUsageResponse, error) {
+	out := new(VoidUsageResponse)
+	err := c.cc.Invoke(ctx, "/usage.v1.BillingService/VoidUsage", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *billingServiceClient) ReconcileLedgerWithInvoices(ctx context.Context, in *ReconcileLedgerWithInvoicesRequest, opts ...grpc.CallOption) (*ReconcileLedgerWithInvoicesResponse, error) {
+	out := new(ReconcileLedgerWithInvoicesResponse)
+	err := c.cc.Invoke(ctx, "/usage.v1.BillingService/ReconcileLedgerWithInvoices", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *billingServiceClient) ListBillingDrift(ctx context.Context, in *ListBillingDriftRequest, opts ...grpc.CallOption) (*ListBillingDriftResponse, error) {
+	out := new(ListBillingDriftResponse)
+	err := c.cc.Invoke(ctx, "/usage.v1.BillingService/ListBillingDrift", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *billingServiceClient) PurchaseCredits(ctx context.Context, in *PurchaseCreditsRequest, opts ...grpc.CallOption) (*PurchaseCreditsResponse, error) {
+	out := new(PurchaseCreditsResponse)
+	err := c.cc.Invoke(ctx, "/usage.v1.BillingService/PurchaseCredits", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // BillingServiceServer is the server API for BillingService service.
 // All implementations must embed UnimplementedBillingServiceServer
 // for forward compatibility
@@ -91,13 +180,39 @@ type BillingServiceServer interface {
 	// in a billing system.
 	// This is an Internal RPC used by the usage reconciler and not intended for general consumption.
 	UpdateInvoices(context.Context, *UpdateInvoicesRequest) (*UpdateInvoicesResponse, error)
-	// GetUpcomingInvoice retrieves the latest invoice for a given query.
+	// GetUpcomingInvoice retrieves the latest invoice for a given query, combined with the credits
+	// recorded in the ledger for the current period.
 	GetUpcomingInvoice(context.Context, *GetUpcomingInvoiceRequest) (*GetUpcomingInvoiceResponse, error)
 	// FinalizeInvoice marks all sessions occurring in the given Stripe invoice as
 	// having been invoiced.
 	FinalizeInvoice(context.Context, *FinalizeInvoiceRequest) (*FinalizeInvoiceResponse, error)
 	// SetBilledSession marks an instance as billed with a billing system
 	SetBilledSession(context.Context, *SetBilledSessionRequest) (*SetBilledSessionResponse, error)
+	// ReconcileInvoices reflects the finalized usage recorded in the ledger for the given period in the billing system.
+	// This is an Internal RPC used by the ledger reconciler and not intended for general consumption.
+	ReconcileInvoices(context.Context, *ReconcileInvoicesRequest) (*ReconcileInvoicesResponse, error)
+	// GetStripeCustomer retrieves the Stripe customer of the given attribution ID.
+	// Lookups are cached, including lookups for attribution IDs without a customer.
+	GetStripeCustomer(context.Context, *GetStripeCustomerRequest) (*GetStripeCustomerResponse, error)
+	// CreateStripeSubscription subscribes the given attribution ID to usage-based billing in Stripe.
+	// It creates the Stripe customer if needed, attaches the payment method of the setup intent,
+	// creates the subscription and switches the cost center to Stripe billing.
+	CreateStripeSubscription(context.Context, *CreateStripeSubscriptionRequest) (*CreateStripeSubscriptionResponse, error)
+	// VoidUsage reverses a finalized usage entry in the ledger. When the usage was already invoiced,
+	// a credit note is issued on the invoice, such that the invoice matches the ledger.
+	VoidUsage(context.Context, *VoidUsageRequest) (*VoidUsageResponse, error)
+	// ReconcileLedgerWithInvoices ensures that every invoice finalized in the billing system in the given period is
+	// credited in the ledger. Missing ledger entries are created, ledger entries which do not match their invoice are
+	// reported as mismatches.
+	// This is an Internal RPC used by the invoice ledger reconciler and not intended for general consumption.
+	ReconcileLedgerWithInvoices(context.Context, *ReconcileLedgerWithInvoicesRequest) (*ReconcileLedgerWithInvoicesResponse, error)
+	// ListBillingDrift compares the credits each team used according to the ledger with the usage reported to the
+	// billing system for the same billing period, and lists the teams whose usage differs. Nothing is corrected.
+	// This is an Internal RPC used by the billing drift reconciler and for investigating billing issues.
+	ListBillingDrift(context.Context, *ListBillingDriftRequest) (*ListBillingDriftResponse, error)
+	// PurchaseCredits charges the default payment method of the Stripe customer of the given attribution ID once.
+	// The credits are granted in the ledger when Stripe confirms the payment.
+	PurchaseCredits(context.Context, *PurchaseCreditsRequest) (*PurchaseCreditsResponse, error)
 	mustEmbedUnimplementedBillingServiceServer()
 }
 
@@ -117,6 +232,27 @@ func (UnimplementedBillingServiceServer) FinalizeInvoice(context.Context, *Final
 func (UnimplementedBillingServiceServer) SetBilledSession(context.Context, *SetBilledSessionRequest) (*SetBilledSessionResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method SetBilledSession not implemented")
 }
+func (UnimplementedBillingServiceServer) ReconcileInvoices(context.Context, *ReconcileInvoicesRequest) (*ReconcileInvoicesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReconcileInvoices not implemented")
+}
+func (UnimplementedBillingServiceServer) GetStripeCustomer(context.Context, *GetStripeCustomerRequest) (*GetStripeCustomerResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetStripeCustomer not implemented")
+}
+func (UnimplementedBillingServiceServer) CreateStripeSubscription(context.Context, *CreateStripeSubscriptionRequest) (*CreateStripeSubscriptionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateStripeSubscription not implemented")
+}
+func (UnimplementedBillingServiceServer) VoidUsage(context.Context, *VoidUsageRequest) (*VoidUsageResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method VoidUsage not implemented")
+}
+func (UnimplementedBillingServiceServer) ReconcileLedgerWithInvoices(context.Context, *ReconcileLedgerWithInvoicesRequest) (*ReconcileLedgerWithInvoicesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReconcileLedgerWithInvoices not implemented")
+}
+func (UnimplementedBillingServiceServer) ListBillingDrift(context.Context, *ListBillingDriftRequest) (*ListBillingDriftResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListBillingDrift not implemented")
+}
+func (UnimplementedBillingServiceServer) PurchaseCredits(context.Context, *PurchaseCreditsRequest) (*PurchaseCreditsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PurchaseCredits not implemented")
+}
 func (UnimplementedBillingServiceServer) mustEmbedUnimplementedBillingServiceServer() {}
 
 // UnsafeBillingServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -202,6 +338,132 @@ func _BillingService_SetBilledSession_Handler(srv interface{}, ctx context.Conte
 	return interceptor(ctx, in, info, handler)
 }
 
+func _BillingService_ReconcileInvoices_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReconcileInvoicesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BillingServiceServer).ReconcileInvoices(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/usage.v1.BillingService/ReconcileInvoices",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BillingServiceServer).ReconcileInvoices(ctx, req.(*ReconcileInvoicesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BillingService_GetStripeCustomer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetStripeCustomerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BillingServiceServer).GetStripeCustomer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/usage.v1.BillingService/GetStripeCustomer",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BillingServiceServer).GetStripeCustomer(ctx, req.(*GetStripeCustomerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BillingService_CreateStripeSubscription_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateStripeSubscriptionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BillingServiceServer).CreateStripeSubscription(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/usage.v1.BillingService/CreateStripeSubscription",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BillingServiceServer).CreateStripeSubscription(ctx, req.(*CreateStripeSubscriptionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BillingService_VoidUsage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(VoidUsageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BillingServiceServer).VoidUsage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/usage.v1.BillingService/VoidUsage",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BillingServiceServer).VoidUsage(ctx, req.(*VoidUsageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BillingService_ReconcileLedgerWithInvoices_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReconcileLedgerWithInvoicesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BillingServiceServer).ReconcileLedgerWithInvoices(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/usage.v1.BillingService/ReconcileLedgerWithInvoices",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BillingServiceServer).ReconcileLedgerWithInvoices(ctx, req.(*ReconcileLedgerWithInvoicesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BillingService_ListBillingDrift_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListBillingDriftRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BillingServiceServer).ListBillingDrift(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/usage.v1.BillingService/ListBillingDrift",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BillingServiceServer).ListBillingDrift(ctx, req.(*ListBillingDriftRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BillingService_PurchaseCredits_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PurchaseCreditsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BillingServiceServer).PurchaseCredits(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/usage.v1.BillingService/PurchaseCredits",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BillingServiceServer).PurchaseCredits(ctx, req.(*PurchaseCreditsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // BillingService_ServiceDesc is the grpc.ServiceDesc for BillingService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -225,6 +487,34 @@ var BillingService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "SetBilledSession",
 			Handler:    _BillingService_SetBilledSession_Handler,
 		},
+		{
+			MethodName: "ReconcileInvoices",
+			Handler:    _BillingService_ReconcileInvoices_Handler,
+		},
+		{
+			MethodName: "GetStripeCustomer",
+			Handler:    _BillingService_GetStripeCustomer_Handler,
+		},
+		{
+			MethodName: "CreateStripeSubscription",
+			Handler:    _BillingService_CreateStripeSubscription_Handler,
+		},
+		{
+			MethodName: "VoidUsage",
+			Handler:    _BillingService_VoidUsage_Handler,
+		},
+		{
+			MethodName: "ReconcileLedgerWithInvoices",
+			Handler:    _BillingService_ReconcileLedgerWithInvoices_Handler,
+		},
+		{
+			MethodName: "ListBillingDrift",
+			Handler:    _BillingService_ListBillingDrift_Handler,
+		},
+		{
+			MethodName: "PurchaseCredits",
+			Handler:    _BillingService_PurchaseCredits_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "usage/v1/billing.proto",
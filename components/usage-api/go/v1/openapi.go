@@ -0,0 +1,13 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package v1
+
+import _ "embed"
+
+// OpenAPISpec is the OpenAPI v2 specification of the REST endpoints of the UsageService, generated from usage.proto and
+// usage_rest.yaml.
+//
+//go:embed usage.swagger.json
+var OpenAPISpec []byte
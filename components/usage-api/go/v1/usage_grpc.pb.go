@@ -36,6 +36,89 @@ type UsageServiceClient interface {
 	ReconcileUsageWithLedger(ctx context.Context, in *ReconcileUsageWithLedgerRequest, opts ...grpc.CallOption) (*ReconcileUsageWithLedgerResponse, error)
 	// ListUsage retrieves all usage for the specified attributionId and theb given time range
 	ListUsage(ctx context.Context, in *ListUsageRequest, opts ...grpc.CallOption) (*ListUsageResponse, error)
+	// GetReportJob retrieves the state and progress of a report generation job.
+	GetReportJob(ctx context.Context, in *GetReportJobRequest, opts ...grpc.CallOption) (*GetReportJobResponse, error)
+	// CancelReportJob cancels a running report generation job.
+	CancelReportJob(ctx context.Context, in *CancelReportJobRequest, opts ...grpc.CallOption) (*CancelReportJobResponse, error)
+	// GetBalance retrieves the usage of an attributionId in the current billing period, compared to its spending limit.
+	GetBalance(ctx context.Context, in *GetBalanceRequest, opts ...grpc.CallOption) (*GetBalanceResponse, error)
+	// GrantCredits grants promotional credits to an attributionId, which are consumed by its usage before it is billed.
+	GrantCredits(ctx context.Context, in *GrantCreditsRequest, opts ...grpc.CallOption) (*GrantCreditsResponse, error)
+	// ExpireCreditGrants expires the unused remainder of all credit grants which expired.
+	ExpireCreditGrants(ctx context.Context, in *ExpireCreditGrantsRequest, opts ...grpc.CallOption) (*ExpireCreditGrantsResponse, error)
+	// ResetFreeTier grants the free tier credits of the new billing period to all cost centers whose billing period ended, and advances their next billing time.
+	ResetFreeTier(ctx context.Context, in *ResetFreeTierRequest, opts ...grpc.CallOption) (*ResetFreeTierResponse, error)
+	// SetProjectBudget sets the budget of a project within the spending limit of its team.
+	SetProjectBudget(ctx context.Context, in *SetProjectBudgetRequest, opts ...grpc.CallOption) (*SetProjectBudgetResponse, error)
+	// DeleteProjectBudget removes the budget of a project.
+	DeleteProjectBudget(ctx context.Context, in *DeleteProjectBudgetRequest, opts ...grpc.CallOption) (*DeleteProjectBudgetResponse, error)
+	// CheckCachedBalances compares the cached balances with the ledger, and invalidates the ones which do not match.
+	CheckCachedBalances(ctx context.Context, in *CheckCachedBalancesRequest, opts ...grpc.CallOption) (*CheckCachedBalancesResponse, error)
+	// ListCostCenters lists the cost centers matching all of the given filters, ordered by attribution ID.
+	// This is an admin RPC, intended for support.
+	ListCostCenters(ctx context.Context, in *ListCostCentersRequest, opts ...grpc.CallOption) (*ListCostCentersResponse, error)
+	// SetSpendingLimit changes the spending limit of a cost center, and records the change in its spending limit history.
+	// Lowering the spending limit to or below the credits used in the current billing period requires force.
+	SetSpendingLimit(ctx context.Context, in *SetSpendingLimitRequest, opts ...grpc.CallOption) (*SetSpendingLimitResponse, error)
+	// ListSpendingLimitChanges lists the spending limit history of a cost center, most recent first.
+	ListSpendingLimitChanges(ctx context.Context, in *ListSpendingLimitChangesRequest, opts ...grpc.CallOption) (*ListSpendingLimitChangesResponse, error)
+	// MigrateAttribution re-attributes the usage history of an attribution ID to another one, for example when a
+	// personal account is converted into a team, or teams are merged. Drafts of running instances are not
+	// re-attributed, their usage is charged to the attribution ID the instances were started with.
+	MigrateAttribution(ctx context.Context, in *MigrateAttributionRequest, opts ...grpc.CallOption) (*MigrateAttributionResponse, error)
+	// SetCostCenterSplits replaces the splits of a cost center. The percentages of all splits must not exceed 100,
+	// the cost center is charged the remaining share of its workspace usage.
+	SetCostCenterSplits(ctx context.Context, in *SetCostCenterSplitsRequest, opts ...grpc.CallOption) (*SetCostCenterSplitsResponse, error)
+	// TransferUsage moves finalized workspace usage to another attribution ID, for example because workspaces were
+	// started under the wrong team. The transferred entries are not changed, they are offset by compensating entries.
+	// This is an admin RPC, intended for support.
+	TransferUsage(ctx context.Context, in *TransferUsageRequest, opts ...grpc.CallOption) (*TransferUsageResponse, error)
+	// RunJanitor expires the unused remainder of expired credit grants, finalizes stale draft usage whose workspace
+	// instances no longer exist, and purges data older than the retention policy allows. Every run is recorded in the
+	// reconciliation audit.
+	RunJanitor(ctx context.Context, in *RunJanitorRequest, opts ...grpc.CallOption) (*RunJanitorResponse, error)
+	// DeleteUsageForAttribution soft-deletes all usage of an attribution ID, for example when its owner requests the
+	// deletion of their data. Soft-deleted usage is ignored by all other RPCs.
+	// This is an admin RPC, intended for support.
+	DeleteUsageForAttribution(ctx context.Context, in *DeleteUsageForAttributionRequest, opts ...grpc.CallOption) (*DeleteUsageForAttributionResponse, error)
+	// PurgeUsageForAttribution permanently deletes the usage of an attribution ID which was soft-deleted longer ago
+	// than the retention period.
+	// This is an admin RPC, intended for support.
+	PurgeUsageForAttribution(ctx context.Context, in *PurgeUsageForAttributionRequest, opts ...grpc.CallOption) (*PurgeUsageForAttributionResponse, error)
+	// ListAuditEvents lists the audit events of mutating RPCs matching all of the given filters, most recent first.
+	// This is an admin RPC, intended for support.
+	ListAuditEvents(ctx context.Context, in *ListAuditEventsRequest, opts ...grpc.CallOption) (*ListAuditEventsResponse, error)
+	// CreateUsageWebhook registers an endpoint which receives the usage summaries and budget threshold events of an
+	// attribution ID, signed with the returned secret. Callers must check that the caller may manage the attribution
+	// ID, e.g. is an owner of the team.
+	CreateUsageWebhook(ctx context.Context, in *CreateUsageWebhookRequest, opts ...grpc.CallOption) (*CreateUsageWebhookResponse, error)
+	// ListUsageWebhooks lists the webhooks of an attribution ID, oldest first. Secrets are not listed.
+	ListUsageWebhooks(ctx context.Context, in *ListUsageWebhooksRequest, opts ...grpc.CallOption) (*ListUsageWebhooksResponse, error)
+	// DeleteUsageWebhook deletes a webhook of an attribution ID, events which were not delivered yet are dropped.
+	DeleteUsageWebhook(ctx context.Context, in *DeleteUsageWebhookRequest, opts ...grpc.CallOption) (*DeleteUsageWebhookResponse, error)
+	// EnqueueUsageWebhookSummaries schedules the delivery of the usage summary of a day to all webhooks. Every summary
+	// is delivered at most once.
+	EnqueueUsageWebhookSummaries(ctx context.Context, in *EnqueueUsageWebhookSummariesRequest, opts ...grpc.CallOption) (*EnqueueUsageWebhookSummariesResponse, error)
+	// DeliverUsageWebhooks delivers the events which are due to the webhooks. Failed deliveries are retried with
+	// exponential backoff by later calls, until they are given up.
+	DeliverUsageWebhooks(ctx context.Context, in *DeliverUsageWebhooksRequest, opts ...grpc.CallOption) (*DeliverUsageWebhooksResponse, error)
+	// ExportUsage exports the usage of every day in the time range to the configured analytics stores, e.g. BigQuery or
+	// the external stage of a warehouse. Every export of a day replaces the previously exported usage of the day.
+	ExportUsage(ctx context.Context, in *ExportUsageRequest, opts ...grpc.CallOption) (*ExportUsageResponse, error)
+	// RecordInstanceEvents updates the usage of workspace instances from a stream of their lifecycle events, e.g. pushed
+	// by ws-manager, such that drafts are updated as instances start and stop instead of on the next reconciliation.
+	// Events of instances which are not known yet are skipped, reconciliation picks up their usage later.
+	RecordInstanceEvents(ctx context.Context, opts ...grpc.CallOption) (UsageService_RecordInstanceEventsClient, error)
+	// ImportUsageAdjustments validates a CSV file of manual adjustments of balances and summarizes them. Unless dry_run
+	// is set, the adjustments are inserted into the ledger in one transaction. Importing the same file again does not
+	// adjust balances twice.
+	ImportUsageAdjustments(ctx context.Context, in *ImportUsageAdjustmentsRequest, opts ...grpc.CallOption) (*ImportUsageAdjustmentsResponse, error)
+	// GetRetentionPolicy returns the retention periods of the installation, and the minimum periods they are bound by.
+	GetRetentionPolicy(ctx context.Context, in *GetRetentionPolicyRequest, opts ...grpc.CallOption) (*GetRetentionPolicyResponse, error)
+	// SetRetentionPolicy sets the retention periods of the installation. The janitor permanently deletes data once it
+	// is older than its retention period. Periods below the minimum are rejected.
+	// This is an admin RPC, intended for self-hosted installations.
+	SetRetentionPolicy(ctx context.Context, in *SetRetentionPolicyRequest, opts ...grpc.CallOption) (*SetRetentionPolicyResponse, error)
 }
 
 type usageServiceClient struct {
@@ -91,6 +174,292 @@ func (c *usageServiceClient) ListUsage(ctx context.Context, in *ListUsageRequest
 	return out, nil
 }
 
+func (c *usageServiceClient) GetReportJob(ctx context.Context, in *GetReportJobRequest, opts ...grpc.CallOption) (*GetReportJobResponse, error) {
+	out := new(GetReportJobResponse)
+	err := c.cc.Invoke(ctx, "/usage.v1.UsageService/GetReportJob", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usageServiceClient) CancelReportJob(ctx context.Context, in *CancelReportJobRequest, opts ...grpc.CallOption) (*CancelReportJobResponse, error) {
+	out := new(CancelReportJobResponse)
+	err := c.cc.Invoke(ctx, "/usage.v1.UsageService/CancelReportJob", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usageServiceClient) GetBalance(ctx context.Context, in *GetBalanceRequest, opts ...grpc.CallOption) (*GetBalanceResponse, error) {
+	out := new(GetBalanceResponse)
+	err := c.cc.Invoke(ctx, "/usage.v1.UsageService/GetBalance", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usageServiceClient) GrantCredits(ctx context.Context, in *GrantCreditsRequest, opts ...grpc.CallOption) (*GrantCreditsResponse, error) {
+	out := new(GrantCreditsResponse)
+	err := c.cc.Invoke(ctx, "/usage.v1.UsageService/GrantCredits", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usageServiceClient) ExpireCreditGrants(ctx context.Context, in *ExpireCreditGrantsRequest, opts ...grpc.CallOption) (*ExpireCreditGrantsResponse, error) {
+	out := new(ExpireCreditGrantsResponse)
+	err := c.cc.Invoke(ctx, "/usage.v1.UsageService/ExpireCreditGrants", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usageServiceClient) ResetFreeTier(ctx context.Context, in *ResetFreeTierRequest, opts ...grpc.CallOption) (*ResetFreeTierResponse, error) {
+	out := new(ResetFreeTierResponse)
+	err := c.cc.Invoke(ctx, "/usage.v1.UsageService/ResetFreeTier", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usageServiceClient) SetProjectBudget(ctx context.Context, in *SetProjectBudgetRequest, opts ...grpc.CallOption) (*SetProjectBudgetResponse, error) {
+	out := new(SetProjectBudgetResponse)
+	err := c.cc.Invoke(ctx, "/usage.v1.UsageService/SetProjectBudget", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usageServiceClient) DeleteProjectBudget(ctx context.Context, in *DeleteProjectBudgetRequest, opts ...grpc.CallOption) (*DeleteProjectBudgetResponse, error) {
+	out := new(DeleteProjectBudgetResponse)
+	err := c.cc.Invoke(ctx, "/usage.v1.UsageService/DeleteProjectBudget", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usageServiceClient) CheckCachedBalances(ctx context.Context, in *CheckCachedBalancesRequest, opts ...grpc.CallOption) (*CheckCachedBalancesResponse, error) {
+	out := new(CheckCachedBalancesResponse)
+	err := c.cc.Invoke(ctx, "/usage.v1.UsageService/CheckCachedBalances", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usageServiceClient) ListCostCenters(ctx context.Context, in *ListCostCentersRequest, opts ...grpc.CallOption) (*ListCostCentersResponse, error) {
+	out := new(ListCostCentersResponse)
+	err := c.cc.Invoke(ctx, "/usage.v1.UsageService/ListCostCenters", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usageServiceClient) SetSpendingLimit(ctx context.Context, in *SetSpendingLimitRequest, opts ...grpc.CallOption) (*SetSpendingLimitResponse, error) {
+	out := new(SetSpendingLimitResponse)
+	err := c.cc.Invoke(ctx, "/usage.v1.UsageService/SetSpendingLimit", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usageServiceClient) ListSpendingLimitChanges(ctx context.Context, in *ListSpendingLimitChangesRequest, opts ...grpc.CallOption) (*ListSpendingLimitChangesResponse, error) {
+	out := new(ListSpendingLimitChangesResponse)
+	err := c.cc.Invoke(ctx, "/usage.v1.UsageService/ListSpendingLimitChanges", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usageServiceClient) MigrateAttribution(ctx context.Context, in *MigrateAttributionRequest, opts ...grpc.CallOption) (*MigrateAttributionResponse, error) {
+	out := new(MigrateAttributionResponse)
+	err := c.cc.Invoke(ctx, "/usage.v1.UsageService/MigrateAttribution", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usageServiceClient) SetCostCenterSplits(ctx context.Context, in *SetCostCenterSplitsRequest, opts ...grpc.CallOption) (*SetCostCenterSplitsResponse, error) {
+	out := new(SetCostCenterSplitsResponse)
+	err := c.cc.Invoke(ctx, "/usage.v1.UsageService/SetCostCenterSplits", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usageServiceClient) TransferUsage(ctx context.Context, in *TransferUsageRequest, opts ...grpc.CallOption) (*TransferUsageResponse, error) {
+	out := new(TransferUsageResponse)
+	err := c.cc.Invoke(ctx, "/usage.v1.UsageService/TransferUsage", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usageServiceClient) RunJanitor(ctx context.Context, in *RunJanitorRequest, opts ...grpc.CallOption) (*RunJanitorResponse, error) {
+	out := new(RunJanitorResponse)
+	err := c.cc.Invoke(ctx, "/usage.v1.UsageService/RunJanitor", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usageServiceClient) DeleteUsageForAttribution(ctx context.Context, in *DeleteUsageForAttributionRequest, opts ...grpc.CallOption) (*DeleteUsageForAttributionResponse, error) {
+	out := new(DeleteUsageForAttributionResponse)
+	err := c.cc.Invoke(ctx, "/usage.v1.UsageService/DeleteUsageForAttribution", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usageServiceClient) PurgeUsageForAttribution(ctx context.Context, in *PurgeUsageForAttributionRequest, opts ...grpc.CallOption) (*PurgeUsageForAttributionResponse, error) {
+	out := new(PurgeUsageForAttributionResponse)
+	err := c.cc.Invoke(ctx, "/usage.v1.UsageService/PurgeUsageForAttribution", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usageServiceClient) ListAuditEvents(ctx context.Context, in *ListAuditEventsRequest, opts ...grpc.CallOption) (*ListAuditEventsResponse, error) {
+	out := new(ListAuditEventsResponse)
+	err := c.cc.Invoke(ctx, "/usage.v1.UsageService/ListAuditEvents", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usageServiceClient) CreateUsageWebhook(ctx context.Context, in *CreateUsageWebhookRequest, opts ...grpc.CallOption) (*CreateUsageWebhookResponse, error) {
+	out := new(CreateUsageWebhookResponse)
+	err := c.cc.Invoke(ctx, "/usage.v1.UsageService/CreateUsageWebhook", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usageServiceClient) ListUsageWebhooks(ctx context.Context, in *ListUsageWebhooksRequest, opts ...grpc.CallOption) (*ListUsageWebhooksResponse, error) {
+	out := new(ListUsageWebhooksResponse)
+	err := c.cc.Invoke(ctx, "/usage.v1.UsageService/ListUsageWebhooks", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usageServiceClient) DeleteUsageWebhook(ctx context.Context, in *DeleteUsageWebhookRequest, opts ...grpc.CallOption) (*DeleteUsageWebhookResponse, error) {
+	out := new(DeleteUsageWebhookResponse)
+	err := c.cc.Invoke(ctx, "/usage.v1.UsageService/DeleteUsageWebhook", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usageServiceClient) EnqueueUsageWebhookSummaries(ctx context.Context, in *EnqueueUsageWebhookSummariesRequest, opts ...grpc.CallOption) (*EnqueueUsageWebhookSummariesResponse, error) {
+	out := new(EnqueueUsageWebhookSummariesResponse)
+	err := c.cc.Invoke(ctx, "/usage.v1.UsageService/EnqueueUsageWebhookSummaries", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usageServiceClient) DeliverUsageWebhooks(ctx context.Context, in *DeliverUsageWebhooksRequest, opts ...grpc.CallOption) (*DeliverUsageWebhooksResponse, error) {
+	out := new(DeliverUsageWebhooksResponse)
+	err := c.cc.Invoke(ctx, "/usage.v1.UsageService/DeliverUsageWebhooks", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usageServiceClient) ExportUsage(ctx context.Context, in *ExportUsageRequest, opts ...grpc.CallOption) (*ExportUsageResponse, error) {
+	out := new(ExportUsageResponse)
+	err := c.cc.Invoke(ctx, "/usage.v1.UsageService/ExportUsage", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usageServiceClient) RecordInstanceEvents(ctx context.Context, opts ...grpc.CallOption) (UsageService_RecordInstanceEventsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &UsageService_ServiceDesc.Streams[0], "/usage.v1.UsageService/RecordInstanceEvents", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &usageServiceRecordInstanceEventsClient{stream}
+	return x, nil
+}
+
+type UsageService_RecordInstanceEventsClient interface {
+	Send(*InstanceEvent) error
+	CloseAndRecv() (*RecordInstanceEventsResponse, error)
+	grpc.ClientStream
+}
+
+type usageServiceRecordInstanceEventsClient struct {
+	grpc.ClientStream
+}
+
+func (x *usageServiceRecordInstanceEventsClient) Send(m *InstanceEvent) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *usageServiceRecordInstanceEventsClient) CloseAndRecv() (*RecordInstanceEventsResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(RecordInstanceEventsResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *usageServiceClient) ImportUsageAdjustments(ctx context.Context, in *ImportUsageAdjustmentsRequest, opts ...grpc.CallOption) (*ImportUsageAdjustmentsResponse, error) {
+	out := new(ImportUsageAdjustmentsResponse)
+	err := c.cc.Invoke(ctx, "/usage.v1.UsageService/ImportUsageAdjustments", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usageServiceClient) GetRetentionPolicy(ctx context.Context, in *GetRetentionPolicyRequest, opts ...grpc.CallOption) (*GetRetentionPolicyResponse, error) {
+	out := new(GetRetentionPolicyResponse)
+	err := c.cc.Invoke(ctx, "/usage.v1.UsageService/GetRetentionPolicy", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *usageServiceClient) SetRetentionPolicy(ctx context.Context, in *SetRetentionPolicyRequest, opts ...grpc.CallOption) (*SetRetentionPolicyResponse, error) {
+	out := new(SetRetentionPolicyResponse)
+	err := c.cc.Invoke(ctx, "/usage.v1.UsageService/SetRetentionPolicy", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // UsageServiceServer is the server API for UsageService service.
 // All implementations must embed UnimplementedUsageServiceServer
 // for forward compatibility
@@ -105,6 +474,89 @@ type UsageServiceServer interface {
 	ReconcileUsageWithLedger(context.Context, *ReconcileUsageWithLedgerRequest) (*ReconcileUsageWithLedgerResponse, error)
 	// ListUsage retrieves all usage for the specified attributionId and theb given time range
 	ListUsage(context.Context, *ListUsageRequest) (*ListUsageResponse, error)
+	// GetReportJob retrieves the state and progress of a report generation job.
+	GetReportJob(context.Context, *GetReportJobRequest) (*GetReportJobResponse, error)
+	// CancelReportJob cancels a running report generation job.
+	CancelReportJob(context.Context, *CancelReportJobRequest) (*CancelReportJobResponse, error)
+	// GetBalance retrieves the usage of an attributionId in the current billing period, compared to its spending limit.
+	GetBalance(context.Context, *GetBalanceRequest) (*GetBalanceResponse, error)
+	// GrantCredits grants promotional credits to an attributionId, which are consumed by its usage before it is billed.
+	GrantCredits(context.Context, *GrantCreditsRequest) (*GrantCreditsResponse, error)
+	// ExpireCreditGrants expires the unused remainder of all credit grants which expired.
+	ExpireCreditGrants(context.Context, *ExpireCreditGrantsRequest) (*ExpireCreditGrantsResponse, error)
+	// ResetFreeTier grants the free tier credits of the new billing period to all cost centers whose billing period ended, and advances their next billing time.
+	ResetFreeTier(context.Context, *ResetFreeTierRequest) (*ResetFreeTierResponse, error)
+	// SetProjectBudget sets the budget of a project within the spending limit of its team.
+	SetProjectBudget(context.Context, *SetProjectBudgetRequest) (*SetProjectBudgetResponse, error)
+	// DeleteProjectBudget removes the budget of a project.
+	DeleteProjectBudget(context.Context, *DeleteProjectBudgetRequest) (*DeleteProjectBudgetResponse, error)
+	// CheckCachedBalances compares the cached balances with the ledger, and invalidates the ones which do not match.
+	CheckCachedBalances(context.Context, *CheckCachedBalancesRequest) (*CheckCachedBalancesResponse, error)
+	// ListCostCenters lists the cost centers matching all of the given filters, ordered by attribution ID.
+	// This is an admin RPC, intended for support.
+	ListCostCenters(context.Context, *ListCostCentersRequest) (*ListCostCentersResponse, error)
+	// SetSpendingLimit changes the spending limit of a cost center, and records the change in its spending limit history.
+	// Lowering the spending limit to or below the credits used in the current billing period requires force.
+	SetSpendingLimit(context.Context, *SetSpendingLimitRequest) (*SetSpendingLimitResponse, error)
+	// ListSpendingLimitChanges lists the spending limit history of a cost center, most recent first.
+	ListSpendingLimitChanges(context.Context, *ListSpendingLimitChangesRequest) (*ListSpendingLimitChangesResponse, error)
+	// MigrateAttribution re-attributes the usage history of an attribution ID to another one, for example when a
+	// personal account is converted into a team, or teams are merged. Drafts of running instances are not
+	// re-attributed, their usage is charged to the attribution ID the instances were started with.
+	MigrateAttribution(context.Context, *MigrateAttributionRequest) (*MigrateAttributionResponse, error)
+	// SetCostCenterSplits replaces the splits of a cost center. The percentages of all splits must not exceed 100,
+	// the cost center is charged the remaining share of its workspace usage.
+	SetCostCenterSplits(context.Context, *SetCostCenterSplitsRequest) (*SetCostCenterSplitsResponse, error)
+	// TransferUsage moves finalized workspace usage to another attribution ID, for example because workspaces were
+	// started under the wrong team. The transferred entries are not changed, they are offset by compensating entries.
+	// This is an admin RPC, intended for support.
+	TransferUsage(context.Context, *TransferUsageRequest) (*TransferUsageResponse, error)
+	// RunJanitor expires the unused remainder of expired credit grants, finalizes stale draft usage whose workspace
+	// instances no longer exist, and purges data older than the retention policy allows. Every run is recorded in the
+	// reconciliation audit.
+	RunJanitor(context.Context, *RunJanitorRequest) (*RunJanitorResponse, error)
+	// DeleteUsageForAttribution soft-deletes all usage of an attribution ID, for example when its owner requests the
+	// deletion of their data. Soft-deleted usage is ignored by all other RPCs.
+	// This is an admin RPC, intended for support.
+	DeleteUsageForAttribution(context.Context, *DeleteUsageForAttributionRequest) (*DeleteUsageForAttributionResponse, error)
+	// PurgeUsageForAttribution permanently deletes the usage of an attribution ID which was soft-deleted longer ago
+	// than the retention period.
+	// This is an admin RPC, intended for support.
+	PurgeUsageForAttribution(context.Context, *PurgeUsageForAttributionRequest) (*PurgeUsageForAttributionResponse, error)
+	// ListAuditEvents lists the audit events of mutating RPCs matching all of the given filters, most recent first.
+	// This is an admin RPC, intended for support.
+	ListAuditEvents(context.Context, *ListAuditEventsRequest) (*ListAuditEventsResponse, error)
+	// CreateUsageWebhook registers an endpoint which receives the usage summaries and budget threshold events of an
+	// attribution ID, signed with the returned secret. Callers must check that the caller may manage the attribution
+	// ID, e.g. is an owner of the team.
+	CreateUsageWebhook(context.Context, *CreateUsageWebhookRequest) (*CreateUsageWebhookResponse, error)
+	// ListUsageWebhooks lists the webhooks of an attribution ID, oldest first. Secrets are not listed.
+	ListUsageWebhooks(context.Context, *ListUsageWebhooksRequest) (*ListUsageWebhooksResponse, error)
+	// DeleteUsageWebhook deletes a webhook of an attribution ID, events which were not delivered yet are dropped.
+	DeleteUsageWebhook(context.Context, *DeleteUsageWebhookRequest) (*DeleteUsageWebhookResponse, error)
+	// EnqueueUsageWebhookSummaries schedules the delivery of the usage summary of a day to all webhooks. Every summary
+	// is delivered at most once.
+	EnqueueUsageWebhookSummaries(context.Context, *EnqueueUsageWebhookSummariesRequest) (*EnqueueUsageWebhookSummariesResponse, error)
+	// DeliverUsageWebhooks delivers the events which are due to the webhooks. Failed deliveries are retried with
+	// exponential backoff by later calls, until they are given up.
+	DeliverUsageWebhooks(context.Context, *DeliverUsageWebhooksRequest) (*DeliverUsageWebhooksResponse, error)
+	// ExportUsage exports the usage of every day in the time range to the configured analytics stores, e.g. BigQuery or
+	// the external stage of a warehouse. Every export of a day replaces the previously exported usage of the day.
+	ExportUsage(context.Context, *ExportUsageRequest) (*ExportUsageResponse, error)
+	// RecordInstanceEvents updates the usage of workspace instances from a stream of their lifecycle events, e.g. pushed
+	// by ws-manager, such that drafts are updated as instances start and stop instead of on the next reconciliation.
+	// Events of instances which are not known yet are skipped, reconciliation picks up their usage later.
+	RecordInstanceEvents(UsageService_RecordInstanceEventsServer) error
+	// ImportUsageAdjustments validates a CSV file of manual adjustments of balances and summarizes them. Unless dry_run
+	// is set, the adjustments are inserted into the ledger in one transaction. Importing the same file again does not
+	// adjust balances twice.
+	ImportUsageAdjustments(context.Context, *ImportUsageAdjustmentsRequest) (*ImportUsageAdjustmentsResponse, error)
+	// GetRetentionPolicy returns the retention periods of the installation, and the minimum periods they are bound by.
+	GetRetentionPolicy(context.Context, *GetRetentionPolicyRequest) (*GetRetentionPolicyResponse, error)
+	// SetRetentionPolicy sets the retention periods of the installation. The janitor permanently deletes data once it
+	// is older than its retention period. Periods below the minimum are rejected.
+	// This is an admin RPC, intended for self-hosted installations.
+	SetRetentionPolicy(context.Context, *SetRetentionPolicyRequest) (*SetRetentionPolicyResponse, error)
 	mustEmbedUnimplementedUsageServiceServer()
 }
 
@@ -127,6 +579,93 @@ func (UnimplementedUsageServiceServer) ReconcileUsageWithLedger(context.Context,
 func (UnimplementedUsageServiceServer) ListUsage(context.Context, *ListUsageRequest) (*ListUsageResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method ListUsage not implemented")
 }
+func (UnimplementedUsageServiceServer) GetReportJob(context.Context, *GetReportJobRequest) (*GetReportJobResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetReportJob not implemented")
+}
+func (UnimplementedUsageServiceServer) CancelReportJob(context.Context, *CancelReportJobRequest) (*CancelReportJobResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CancelReportJob not implemented")
+}
+func (UnimplementedUsageServiceServer) GetBalance(context.Context, *GetBalanceRequest) (*GetBalanceResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetBalance not implemented")
+}
+func (UnimplementedUsageServiceServer) GrantCredits(context.Context, *GrantCreditsRequest) (*GrantCreditsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GrantCredits not implemented")
+}
+func (UnimplementedUsageServiceServer) ExpireCreditGrants(context.Context, *ExpireCreditGrantsRequest) (*ExpireCreditGrantsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ExpireCreditGrants not implemented")
+}
+func (UnimplementedUsageServiceServer) ResetFreeTier(context.Context, *ResetFreeTierRequest) (*ResetFreeTierResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ResetFreeTier not implemented")
+}
+func (UnimplementedUsageServiceServer) SetProjectBudget(context.Context, *SetProjectBudgetRequest) (*SetProjectBudgetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetProjectBudget not implemented")
+}
+func (UnimplementedUsageServiceServer) DeleteProjectBudget(context.Context, *DeleteProjectBudgetRequest) (*DeleteProjectBudgetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteProjectBudget not implemented")
+}
+func (UnimplementedUsageServiceServer) CheckCachedBalances(context.Context, *CheckCachedBalancesRequest) (*CheckCachedBalancesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CheckCachedBalances not implemented")
+}
+func (UnimplementedUsageServiceServer) ListCostCenters(context.Context, *ListCostCentersRequest) (*ListCostCentersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListCostCenters not implemented")
+}
+func (UnimplementedUsageServiceServer) SetSpendingLimit(context.Context, *SetSpendingLimitRequest) (*SetSpendingLimitResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetSpendingLimit not implemented")
+}
+func (UnimplementedUsageServiceServer) ListSpendingLimitChanges(context.Context, *ListSpendingLimitChangesRequest) (*ListSpendingLimitChangesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListSpendingLimitChanges not implemented")
+}
+func (UnimplementedUsageServiceServer) MigrateAttribution(context.Context, *MigrateAttributionRequest) (*MigrateAttributionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method MigrateAttribution not implemented")
+}
+func (UnimplementedUsageServiceServer) SetCostCenterSplits(context.Context, *SetCostCenterSplitsRequest) (*SetCostCenterSplitsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetCostCenterSplits not implemented")
+}
+func (UnimplementedUsageServiceServer) TransferUsage(context.Context, *TransferUsageRequest) (*TransferUsageResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method TransferUsage not implemented")
+}
+func (UnimplementedUsageServiceServer) RunJanitor(context.Context, *RunJanitorRequest) (*RunJanitorResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RunJanitor not implemented")
+}
+func (UnimplementedUsageServiceServer) DeleteUsageForAttribution(context.Context, *DeleteUsageForAttributionRequest) (*DeleteUsageForAttributionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteUsageForAttribution not implemented")
+}
+func (UnimplementedUsageServiceServer) PurgeUsageForAttribution(context.Context, *PurgeUsageForAttributionRequest) (*PurgeUsageForAttributionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PurgeUsageForAttribution not implemented")
+}
+func (UnimplementedUsageServiceServer) ListAuditEvents(context.Context, *ListAuditEventsRequest) (*ListAuditEventsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListAuditEvents not implemented")
+}
+func (UnimplementedUsageServiceServer) CreateUsageWebhook(context.Context, *CreateUsageWebhookRequest) (*CreateUsageWebhookResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateUsageWebhook not implemented")
+}
+func (UnimplementedUsageServiceServer) ListUsageWebhooks(context.Context, *ListUsageWebhooksRequest) (*ListUsageWebhooksResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListUsageWebhooks not implemented")
+}
+func (UnimplementedUsageServiceServer) DeleteUsageWebhook(context.Context, *DeleteUsageWebhookRequest) (*DeleteUsageWebhookResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteUsageWebhook not implemented")
+}
+func (UnimplementedUsageServiceServer) EnqueueUsageWebhookSummaries(context.Context, *EnqueueUsageWebhookSummariesRequest) (*EnqueueUsageWebhookSummariesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method EnqueueUsageWebhookSummaries not implemented")
+}
+func (UnimplementedUsageServiceServer) DeliverUsageWebhooks(context.Context, *DeliverUsageWebhooksRequest) (*DeliverUsageWebhooksResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeliverUsageWebhooks not implemented")
+}
+func (UnimplementedUsageServiceServer) ExportUsage(context.Context, *ExportUsageRequest) (*ExportUsageResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ExportUsage not implemented")
+}
+func (UnimplementedUsageServiceServer) RecordInstanceEvents(UsageService_RecordInstanceEventsServer) error {
+	return status.Errorf(codes.Unimplemented, "method RecordInstanceEvents not implemented")
+}
+func (UnimplementedUsageServiceServer) ImportUsageAdjustments(context.Context, *ImportUsageAdjustmentsRequest) (*ImportUsageAdjustmentsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ImportUsageAdjustments not implemented")
+}
+func (UnimplementedUsageServiceServer) GetRetentionPolicy(context.Context, *GetRetentionPolicyRequest) (*GetRetentionPolicyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetRetentionPolicy not implemented")
+}
+func (UnimplementedUsageServiceServer) SetRetentionPolicy(context.Context, *SetRetentionPolicyRequest) (*SetRetentionPolicyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetRetentionPolicy not implemented")
+}
 func (UnimplementedUsageServiceServer) mustEmbedUnimplementedUsageServiceServer() {}
 
 // UnsafeUsageServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -230,32 +769,861 @@ func _UsageService_ListUsage_Handler(srv interface{}, ctx context.Context, dec f
 	return interceptor(ctx, in, info, handler)
 }
 
-// UsageService_ServiceDesc is the grpc.ServiceDesc for UsageService service.
-// It's only intended for direct use with grpc.RegisterService,
-// and not to be introspected or modified (even as a copy)
-var UsageService_ServiceDesc = grpc.ServiceDesc{
-	ServiceName: "usage.v1.UsageService",
-	HandlerType: (*UsageServiceServer)(nil),
-	Methods: []grpc.MethodDesc{
-		{
-			MethodName: "ListBilledUsage",
-			Handler:    _UsageService_ListBilledUsage_Handler,
-		},
-		{
-			MethodName: "ReconcileUsage",
-			Handler:    _UsageService_ReconcileUsage_Handler,
-		},
-		{
-			MethodName: "GetCostCenter",
-			Handler:    _UsageService_GetCostCenter_Handler,
-		},
-		{
-			MethodName: "ReconcileUsageWithLedger",
-			Handler:    _UsageService_ReconcileUsageWithLedger_Handler,
-		},
-		{
-			MethodName: "ListUsage",
-			Handler:    _UsageService_ListUsage_Handler,
+func _UsageService_GetReportJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetReportJobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsageServiceServer).GetReportJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/usage.v1.UsageService/GetReportJob",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsageServiceServer).GetReportJob(ctx, req.(*GetReportJobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UsageService_CancelReportJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CancelReportJobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsageServiceServer).CancelReportJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/usage.v1.UsageService/CancelReportJob",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsageServiceServer).CancelReportJob(ctx, req.(*CancelReportJobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UsageService_GetBalance_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetBalanceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsageServiceServer).GetBalance(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/usage.v1.UsageService/GetBalance",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsageServiceServer).GetBalance(ctx, req.(*GetBalanceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UsageService_GrantCredits_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GrantCreditsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsageServiceServer).GrantCredits(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/usage.v1.UsageService/GrantCredits",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsageServiceServer).GrantCredits(ctx, req.(*GrantCreditsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UsageService_ExpireCreditGrants_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExpireCreditGrantsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsageServiceServer).ExpireCreditGrants(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/usage.v1.UsageService/ExpireCreditGrants",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsageServiceServer).ExpireCreditGrants(ctx, req.(*ExpireCreditGrantsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UsageService_ResetFreeTier_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ResetFreeTierRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsageServiceServer).ResetFreeTier(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/usage.v1.UsageService/ResetFreeTier",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsageServiceServer).ResetFreeTier(ctx, req.(*ResetFreeTierRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UsageService_SetProjectBudget_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetProjectBudgetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsageServiceServer).SetProjectBudget(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/usage.v1.UsageService/SetProjectBudget",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsageServiceServer).SetProjectBudget(ctx, req.(*SetProjectBudgetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UsageService_DeleteProjectBudget_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteProjectBudgetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsageServiceServer).DeleteProjectBudget(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/usage.v1.UsageService/DeleteProjectBudget",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsageServiceServer).DeleteProjectBudget(ctx, req.(*DeleteProjectBudgetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UsageService_CheckCachedBalances_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CheckCachedBalancesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsageServiceServer).CheckCachedBalances(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/usage.v1.UsageService/CheckCachedBalances",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsageServiceServer).CheckCachedBalances(ctx, req.(*CheckCachedBalancesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UsageService_ListCostCenters_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListCostCentersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsageServiceServer).ListCostCenters(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/usage.v1.UsageService/ListCostCenters",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsageServiceServer).ListCostCenters(ctx, req.(*ListCostCentersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UsageService_SetSpendingLimit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetSpendingLimitRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsageServiceServer).SetSpendingLimit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/usage.v1.UsageService/SetSpendingLimit",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsageServiceServer).SetSpendingLimit(ctx, req.(*SetSpendingLimitRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UsageService_ListSpendingLimitChanges_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListSpendingLimitChangesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsageServiceServer).ListSpendingLimitChanges(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/usage.v1.UsageService/ListSpendingLimitChanges",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsageServiceServer).ListSpendingLimitChanges(ctx, req.(*ListSpendingLimitChangesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UsageService_MigrateAttribution_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MigrateAttributionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsageServiceServer).MigrateAttribution(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/usage.v1.UsageService/MigrateAttribution",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsageServiceServer).MigrateAttribution(ctx, req.(*MigrateAttributionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UsageService_SetCostCenterSplits_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetCostCenterSplitsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsageServiceServer).SetCostCenterSplits(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/usage.v1.UsageService/SetCostCenterSplits",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsageServiceServer).SetCostCenterSplits(ctx, req.(*SetCostCenterSplitsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UsageService_TransferUsage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TransferUsageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsageServiceServer).TransferUsage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/usage.v1.UsageService/TransferUsage",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsageServiceServer).TransferUsage(ctx, req.(*TransferUsageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UsageService_RunJanitor_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RunJanitorRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsageServiceServer).RunJanitor(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/usage.v1.UsageService/RunJanitor",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsageServiceServer).RunJanitor(ctx, req.(*RunJanitorRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UsageService_DeleteUsageForAttribution_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteUsageForAttributionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsageServiceServer).DeleteUsageForAttribution(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/usage.v1.UsageService/DeleteUsageForAttribution",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsageServiceServer).DeleteUsageForAttribution(ctx, req.(*DeleteUsageForAttributionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UsageService_PurgeUsageForAttribution_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PurgeUsageForAttributionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsageServiceServer).PurgeUsageForAttribution(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/usage.v1.UsageService/PurgeUsageForAttribution",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsageServiceServer).PurgeUsageForAttribution(ctx, req.(*PurgeUsageForAttributionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UsageService_ListAuditEvents_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListAuditEventsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsageServiceServer).ListAuditEvents(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/usage.v1.UsageService/ListAuditEvents",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsageServiceServer).ListAuditEvents(ctx, req.(*ListAuditEventsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UsageService_CreateUsageWebhook_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateUsageWebhookRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsageServiceServer).CreateUsageWebhook(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/usage.v1.UsageService/CreateUsageWebhook",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsageServiceServer).CreateUsageWebhook(ctx, req.(*CreateUsageWebhookRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UsageService_ListUsageWebhooks_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListUsageWebhooksRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsageServiceServer).ListUsageWebhooks(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/usage.v1.UsageService/ListUsageWebhooks",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsageServiceServer).ListUsageWebhooks(ctx, req.(*ListUsageWebhooksRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UsageService_DeleteUsageWebhook_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteUsageWebhookRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsageServiceServer).DeleteUsageWebhook(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/usage.v1.UsageService/DeleteUsageWebhook",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsageServiceServer).DeleteUsageWebhook(ctx, req.(*DeleteUsageWebhookRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UsageService_EnqueueUsageWebhookSummaries_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EnqueueUsageWebhookSummariesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsageServiceServer).EnqueueUsageWebhookSummaries(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/usage.v1.UsageService/EnqueueUsageWebhookSummaries",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsageServiceServer).EnqueueUsageWebhookSummaries(ctx, req.(*EnqueueUsageWebhookSummariesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UsageService_DeliverUsageWebhooks_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeliverUsageWebhooksRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsageServiceServer).DeliverUsageWebhooks(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/usage.v1.UsageService/DeliverUsageWebhooks",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsageServiceServer).DeliverUsageWebhooks(ctx, req.(*DeliverUsageWebhooksRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UsageService_ExportUsage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExportUsageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsageServiceServer).ExportUsage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/usage.v1.UsageService/ExportUsage",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsageServiceServer).ExportUsage(ctx, req.(*ExportUsageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UsageService_RecordInstanceEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(UsageServiceServer).RecordInstanceEvents(&usageServiceRecordInstanceEventsServer{stream})
+}
+
+type UsageService_RecordInstanceEventsServer interface {
+	SendAndClose(*RecordInstanceEventsResponse) error
+	Recv() (*InstanceEvent, error)
+	grpc.ServerStream
+}
+
+type usageServiceRecordInstanceEventsServer struct {
+	grpc.ServerStream
+}
+
+func (x *usageServiceRecordInstanceEventsServer) SendAndClose(m *RecordInstanceEventsResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *usageServiceRecordInstanceEventsServer) Recv() (*InstanceEvent, error) {
+	m := new(InstanceEvent)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _UsageService_ImportUsageAdjustments_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ImportUsageAdjustmentsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsageServiceServer).ImportUsageAdjustments(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/usage.v1.UsageService/ImportUsageAdjustments",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsageServiceServer).ImportUsageAdjustments(ctx, req.(*ImportUsageAdjustmentsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UsageService_GetRetentionPolicy_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRetentionPolicyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsageServiceServer).GetRetentionPolicy(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/usage.v1.UsageService/GetRetentionPolicy",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsageServiceServer).GetRetentionPolicy(ctx, req.(*GetRetentionPolicyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UsageService_SetRetentionPolicy_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetRetentionPolicyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsageServiceServer).SetRetentionPolicy(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/usage.v1.UsageService/SetRetentionPolicy",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsageServiceServer).SetRetentionPolicy(ctx, req.(*SetRetentionPolicyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// UsageService_ServiceDesc is the grpc.ServiceDesc for UsageService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var UsageService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "usage.v1.UsageService",
+	HandlerType: (*UsageServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListBilledUsage",
+			Handler:    _UsageService_ListBilledUsage_Handler,
+		},
+		{
+			MethodName: "ReconcileUsage",
+			Handler:    _UsageService_ReconcileUsage_Handler,
+		},
+		{
+			MethodName: "GetCostCenter",
+			Handler:    _UsageService_GetCostCenter_Handler,
+		},
+		{
+			MethodName: "ReconcileUsageWithLedger",
+			Handler:    _UsageService_ReconcileUsageWithLedger_Handler,
+		},
+		{
+			MethodName: "ListUsage",
+			Handler:    _UsageService_ListUsage_Handler,
+		},
+		{
+			MethodName: "GetReportJob",
+			Handler:    _UsageService_GetReportJob_Handler,
+		},
+		{
+			MethodName: "CancelReportJob",
+			Handler:    _UsageService_CancelReportJob_Handler,
+		},
+		{
+			MethodName: "GetBalance",
+			Handler:    _UsageService_GetBalance_Handler,
+		},
+		{
+			MethodName: "GrantCredits",
+			Handler:    _UsageService_GrantCredits_Handler,
+		},
+		{
+			MethodName: "ExpireCreditGrants",
+			Handler:    _UsageService_ExpireCreditGrants_Handler,
+		},
+		{
+			MethodName: "ResetFreeTier",
+			Handler:    _UsageService_ResetFreeTier_Handler,
+		},
+		{
+			MethodName: "SetProjectBudget",
+			Handler:    _UsageService_SetProjectBudget_Handler,
+		},
+		{
+			MethodName: "DeleteProjectBudget",
+			Handler:    _UsageService_DeleteProjectBudget_Handler,
+		},
+		{
+			MethodName: "CheckCachedBalances",
+			Handler:    _UsageService_CheckCachedBalances_Handler,
+		},
+		{
+			MethodName: "ListCostCenters",
+			Handler:    _UsageService_ListCostCenters_Handler,
+		},
+		{
+			MethodName: "SetSpendingLimit",
+			Handler:    _UsageService_SetSpendingLimit_Handler,
+		},
+		{
+			MethodName: "ListSpendingLimitChanges",
+			Handler:    _UsageService_ListSpendingLimitChanges_Handler,
+		},
+		{
+			MethodName: "MigrateAttribution",
+			Handler:    _UsageService_MigrateAttribution_Handler,
+		},
+		{
+			MethodName: "SetCostCenterSplits",
+			Handler:    _UsageService_SetCostCenterSplits_Handler,
+		},
+		{
+			MethodName: "TransferUsage",
+			Handler:    _UsageService_TransferUsage_Handler,
+		},
+		{
+			MethodName: "RunJanitor",
+			Handler:    _UsageService_RunJanitor_Handler,
+		},
+		{
+			MethodName: "DeleteUsageForAttribution",
+			Handler:    _UsageService_DeleteUsageForAttribution_Handler,
+		},
+		{
+			MethodName: "PurgeUsageForAttribution",
+			Handler:    _UsageService_PurgeUsageForAttribution_Handler,
+		},
+		{
+			MethodName: "ListAuditEvents",
+			Handler:    _UsageService_ListAuditEvents_Handler,
+		},
+		{
+			MethodName: "CreateUsageWebhook",
+			Handler:    _UsageService_CreateUsageWebhook_Handler,
+		},
+		{
+			MethodName: "ListUsageWebhooks",
+			Handler:    _UsageService_ListUsageWebhooks_Handler,
+		},
+		{
+			MethodName: "DeleteUsageWebhook",
+			Handler:    _UsageService_DeleteUsageWebhook_Handler,
+		},
+		{
+			MethodName: "EnqueueUsageWebhookSummaries",
+			Handler:    _UsageService_EnqueueUsageWebhookSummaries_Handler,
+		},
+		{
+			MethodName: "DeliverUsageWebhooks",
+			Handler:    _UsageService_DeliverUsageWebhooks_Handler,
+		},
+		{
+			MethodName: "ExportUsage",
+			Handler:    _UsageService_ExportUsage_Handler,
+		},
+		{
+			MethodName: "ImportUsageAdjustments",
+			Handler:    _UsageService_ImportUsageAdjustments_Handler,
+		},
+		{
+			MethodName: "GetRetentionPolicy",
+			Handler:    _UsageService_GetRetentionPolicy_Handler,
+		},
+		{
+			MethodName: "SetRetentionPolicy",
+			Handler:    _UsageService_SetRetentionPolicy_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "RecordInstanceEvents",
+			Handler:       _UsageService_RecordInstanceEvents_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "usage/v1/usage.proto",
+}
+
+// PricingServiceClient is the client API for PricingService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type PricingServiceClient interface {
+	// GetCreditsPerMinute returns the rate at which workspaces of the class are priced for the attribution ID on the
+	// plan. It is called while reconciling usage, and must respond quickly.
+	GetCreditsPerMinute(ctx context.Context, in *GetCreditsPerMinuteRequest, opts ...grpc.CallOption) (*GetCreditsPerMinuteResponse, error)
+}
+
+type pricingServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewPricingServiceClient(cc grpc.ClientConnInterface) PricingServiceClient {
+	return &pricingServiceClient{cc}
+}
+
+func (c *pricingServiceClient) GetCreditsPerMinute(ctx context.Context, in *GetCreditsPerMinuteRequest, opts ...grpc.CallOption) (*GetCreditsPerMinuteResponse, error) {
+	out := new(GetCreditsPerMinuteResponse)
+	err := c.cc.Invoke(ctx, "/usage.v1.PricingService/GetCreditsPerMinute", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// PricingServiceServer is the server API for PricingService service.
+// All implementations must embed UnimplementedPricingServiceServer
+// for forward compatibility
+type PricingServiceServer interface {
+	// GetCreditsPerMinute returns the rate at which workspaces of the class are priced for the attribution ID on the
+	// plan. It is called while reconciling usage, and must respond quickly.
+	GetCreditsPerMinute(context.Context, *GetCreditsPerMinuteRequest) (*GetCreditsPerMinuteResponse, error)
+	mustEmbedUnimplementedPricingServiceServer()
+}
+
+// UnimplementedPricingServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedPricingServiceServer struct {
+}
+
+func (UnimplementedPricingServiceServer) GetCreditsPerMinute(context.Context, *GetCreditsPerMinuteRequest) (*GetCreditsPerMinuteResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetCreditsPerMinute not implemented")
+}
+func (UnimplementedPricingServiceServer) mustEmbedUnimplementedPricingServiceServer() {}
+
+// UnsafePricingServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to PricingServiceServer will
+// result in compilation errors.
+type UnsafePricingServiceServer interface {
+	mustEmbedUnimplementedPricingServiceServer()
+}
+
+func RegisterPricingServiceServer(s grpc.ServiceRegistrar, srv PricingServiceServer) {
+	s.RegisterService(&PricingService_ServiceDesc, srv)
+}
+
+func _PricingService_GetCreditsPerMinute_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetCreditsPerMinuteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PricingServiceServer).GetCreditsPerMinute(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/usage.v1.PricingService/GetCreditsPerMinute",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PricingServiceServer).GetCreditsPerMinute(ctx, req.(*GetCreditsPerMinuteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// PricingService_ServiceDesc is the grpc.ServiceDesc for PricingService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var PricingService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "usage.v1.PricingService",
+	HandlerType: (*PricingServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetCreditsPerMinute",
+			Handler:    _PricingService_GetCreditsPerMinute_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "usage/v1/usage.proto",
+}
+
+// UsageNotificationServiceClient is the client API for UsageNotificationService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type UsageNotificationServiceClient interface {
+	// SpendingLimitStateChanged is called after the spending limit state of an attribution ID changed, in either
+	// direction. Calls are not retried, the next change or GetBalance is authoritative.
+	SpendingLimitStateChanged(ctx context.Context, in *SpendingLimitStateChangedRequest, opts ...grpc.CallOption) (*SpendingLimitStateChangedResponse, error)
+}
+
+type usageNotificationServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewUsageNotificationServiceClient(cc grpc.ClientConnInterface) UsageNotificationServiceClient {
+	return &usageNotificationServiceClient{cc}
+}
+
+func (c *usageNotificationServiceClient) SpendingLimitStateChanged(ctx context.Context, in *SpendingLimitStateChangedRequest, opts ...grpc.CallOption) (*SpendingLimitStateChangedResponse, error) {
+	out := new(SpendingLimitStateChangedResponse)
+	err := c.cc.Invoke(ctx, "/usage.v1.UsageNotificationService/SpendingLimitStateChanged", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// UsageNotificationServiceServer is the server API for UsageNotificationService service.
+// All implementations must embed UnimplementedUsageNotificationServiceServer
+// for forward compatibility
+type UsageNotificationServiceServer interface {
+	// SpendingLimitStateChanged is called after the spending limit state of an attribution ID changed, in either
+	// direction. Calls are not retried, the next change or GetBalance is authoritative.
+	SpendingLimitStateChanged(context.Context, *SpendingLimitStateChangedRequest) (*SpendingLimitStateChangedResponse, error)
+	mustEmbedUnimplementedUsageNotificationServiceServer()
+}
+
+// UnimplementedUsageNotificationServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedUsageNotificationServiceServer struct {
+}
+
+func (UnimplementedUsageNotificationServiceServer) SpendingLimitStateChanged(context.Context, *SpendingLimitStateChangedRequest) (*SpendingLimitStateChangedResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SpendingLimitStateChanged not implemented")
+}
+func (UnimplementedUsageNotificationServiceServer) mustEmbedUnimplementedUsageNotificationServiceServer() {
+}
+
+// UnsafeUsageNotificationServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to UsageNotificationServiceServer will
+// result in compilation errors.
+type UnsafeUsageNotificationServiceServer interface {
+	mustEmbedUnimplementedUsageNotificationServiceServer()
+}
+
+func RegisterUsageNotificationServiceServer(s grpc.ServiceRegistrar, srv UsageNotificationServiceServer) {
+	s.RegisterService(&UsageNotificationService_ServiceDesc, srv)
+}
+
+func _UsageNotificationService_SpendingLimitStateChanged_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SpendingLimitStateChangedRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UsageNotificationServiceServer).SpendingLimitStateChanged(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/usage.v1.UsageNotificationService/SpendingLimitStateChanged",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UsageNotificationServiceServer).SpendingLimitStateChanged(ctx, req.(*SpendingLimitStateChangedRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// UsageNotificationService_ServiceDesc is the grpc.ServiceDesc for UsageNotificationService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var UsageNotificationService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "usage.v1.UsageNotificationService",
+	HandlerType: (*UsageNotificationServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "SpendingLimitStateChanged",
+			Handler:    _UsageNotificationService_SpendingLimitStateChanged_Handler,
 		},
 	},
 	Streams:  []grpc.StreamDesc{},
@@ -0,0 +1,51 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package cmd
+
+import (
+	"os"
+	"path"
+
+	"github.com/gitpod-io/gitpod/common-go/log"
+	"github.com/gitpod-io/gitpod/usage/pkg/server"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(reencryptMetadata())
+}
+
+func reencryptMetadata() *cobra.Command {
+	var (
+		verbose    bool
+		configPath string
+	)
+
+	cmd := &cobra.Command{
+		Use:     "reencrypt-metadata",
+		Short:   "Encrypts the metadata of all usage with the primary metadata encryption key",
+		Version: Version,
+		Run: func(cmd *cobra.Command, args []string) {
+			log.Init(ServiceName, Version, true, verbose)
+
+			cfg, err := parseConfig(configPath)
+			if err != nil {
+				log.WithError(err).Fatal("Failed to get config. Did you specify --config correctly?")
+			}
+
+			err = server.ReencryptUsageMetadata(cmd.Context(), cfg)
+			if err != nil {
+				log.WithError(err).Fatal("Failed to re-encrypt usage metadata.")
+			}
+		},
+	}
+
+	localConfig := path.Join(os.ExpandEnv("GOMOD"), "..", "config.json")
+
+	cmd.Flags().BoolVar(&verbose, "verbose", false, "Toggle verbose logging (debug level)")
+	cmd.Flags().StringVar(&configPath, "config", localConfig, "Configuration file for running usage component")
+
+	return cmd
+}
@@ -9,6 +9,7 @@ import (
 	"os"
 
 	"github.com/gitpod-io/gitpod/common-go/log"
+	"github.com/gitpod-io/gitpod/common-go/tracing"
 	"github.com/spf13/cobra"
 )
 
@@ -26,6 +27,11 @@ var rootCmd = &cobra.Command{
 }
 
 func Execute() {
+	closer := tracing.Init(ServiceName)
+	if closer != nil {
+		defer closer.Close()
+	}
+
 	if err := rootCmd.ExecuteContext(context.Background()); err != nil {
 		log.WithError(err).Error("Failed to execute command.")
 		os.Exit(1)
@@ -0,0 +1,139 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"context"
+	"time"
+
+	"github.com/gitpod-io/gitpod/common-go/analytics"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/requestid"
+	"github.com/google/uuid"
+)
+
+// Analytics events which reconciliation publishes, such that usage signals are available without querying the
+// billing database.
+const (
+	analyticsEvent_SessionBilled  = "usage_session_billed"
+	analyticsEvent_LimitCrossed   = "usage_limit_crossed"
+	analyticsEvent_FirstPaidUsage = "usage_first_paid"
+)
+
+// Limits which usage_limit_crossed events report as `limit`.
+const (
+	analyticsLimit_SpendingLimit   = "spending_limit"
+	analyticsLimit_HardLimit       = "hard_limit"
+	analyticsLimit_BudgetThreshold = "budget_threshold"
+)
+
+// attributionIdentity identifies events of an attribution ID. Users are identified by their ID. Teams have no
+// analytics identity of their own, their events are identified anonymously by the attribution ID.
+func attributionIdentity(attributionID db.AttributionID) analytics.Identity {
+	entity, id := attributionID.Values()
+	if entity == db.AttributionEntity_User {
+		return analytics.Identity{UserID: id}
+	}
+	return analytics.Identity{AnonymousID: string(attributionID)}
+}
+
+// trackSessionsBilled publishes an event for every workspace instance usage which was finalized, identified by the
+// owner of the workspace instance.
+func (s *UsageService) trackSessionsBilled(instances []db.WorkspaceInstanceForUsage, written []db.Usage) {
+	owners := map[uuid.UUID]uuid.UUID{}
+	for _, instance := range instances {
+		owners[instance.ID] = instance.OwnerID
+	}
+
+	for _, usage := range written {
+		if usage.Draft || usage.Kind != db.WorkspaceInstanceUsageKind {
+			continue
+		}
+
+		properties := map[string]interface{}{
+			"attributionId": string(usage.AttributionID),
+			"instanceId":    usage.WorkspaceInstanceID.String(),
+			"projectId":     usage.ProjectID,
+			"credits":       usage.CreditCents.ToCredits(),
+		}
+		data, err := usage.GetMetadataAsWorkspaceInstanceData()
+		if err == nil {
+			properties["workspaceId"] = data.WorkspaceId
+			properties["workspaceClass"] = data.WorkspaceClass
+			properties["workspaceType"] = string(data.WorkspaceType)
+			if data.SplitFromAttributionId != "" {
+				properties["splitFromAttributionId"] = string(data.SplitFromAttributionId)
+			}
+		}
+
+		identity := attributionIdentity(usage.AttributionID)
+		if owner, ok := owners[usage.WorkspaceInstanceID]; ok {
+			identity = analytics.Identity{UserID: owner.String()}
+		}
+
+		s.analytics.Track(analytics.TrackMessage{
+			Identity:   identity,
+			Event:      analyticsEvent_SessionBilled,
+			Properties: properties,
+			Timestamp:  usage.EffectiveTime.Time(),
+		})
+	}
+}
+
+// trackLimitCrossed publishes an event for a balance which crossed one of its limits.
+func (s *UsageService) trackLimitCrossed(b balance, limit string, thresholdPercent int32, now time.Time) {
+	properties := map[string]interface{}{
+		"attributionId":      string(b.attributionID),
+		"limit":              limit,
+		"spendingLimit":      b.spendingLimit,
+		"spendingLimitType":  string(b.limitType),
+		"creditsUsed":        b.creditsUsed.ToCredits(),
+		"billingPeriodStart": b.periodStart,
+	}
+	if limit == analyticsLimit_BudgetThreshold {
+		properties["thresholdPercent"] = thresholdPercent
+	}
+
+	s.analytics.Track(analytics.TrackMessage{
+		Identity:   attributionIdentity(b.attributionID),
+		Event:      analyticsEvent_LimitCrossed,
+		Properties: properties,
+		Timestamp:  now,
+	})
+}
+
+// trackFirstPaidUsage publishes an event for every balance billed through Stripe which used credits beyond its credit
+// grants for the first time. The milestone is recorded, such that it is published at most once per attribution ID.
+func (s *UsageService) trackFirstPaidUsage(ctx context.Context, before, after map[db.AttributionID]balance, now time.Time) {
+	for attributionId, b := range after {
+		if b.billingStrategy != db.CostCenter_Stripe || b.creditsUsed <= 0 || before[attributionId].creditsUsed > 0 {
+			continue
+		}
+
+		recorded, err := db.RecordUsageMilestone(ctx, s.conn, db.UsageMilestone{
+			AttributionID: attributionId,
+			Milestone:     db.UsageMilestone_FirstPaidUsage,
+			ReachedAt:     db.NewVarcharTime(now),
+		})
+		if err != nil {
+			requestid.Log(ctx).WithError(err).WithField("attribution_id", attributionId).Error("Failed to record first paid usage.")
+			continue
+		}
+		if !recorded {
+			continue
+		}
+
+		s.analytics.Track(analytics.TrackMessage{
+			Identity:  attributionIdentity(attributionId),
+			Event:     analyticsEvent_FirstPaidUsage,
+			Timestamp: now,
+			Properties: map[string]interface{}{
+				"attributionId":      string(attributionId),
+				"creditsUsed":        b.creditsUsed.ToCredits(),
+				"billingPeriodStart": b.periodStart,
+			},
+		})
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gitpod-io/gitpod/common-go/analytics"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/db/dbtest"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingAnalytics struct {
+	tracked []analytics.TrackMessage
+}
+
+func (a *recordingAnalytics) Identify(m analytics.IdentifyMessage) {}
+
+func (a *recordingAnalytics) Track(m analytics.TrackMessage) {
+	a.tracked = append(a.tracked, m)
+}
+
+func (a *recordingAnalytics) Close() error { return nil }
+
+func TestAttributionIdentity(t *testing.T) {
+	userID := uuid.New().String()
+	require.Equal(t, analytics.Identity{UserID: userID}, attributionIdentity(db.NewUserAttributionID(userID)))
+
+	team := db.NewTeamAttributionID(uuid.New().String())
+	require.Equal(t, analytics.Identity{AnonymousID: string(team)}, attributionIdentity(team))
+}
+
+func TestTrackSessionsBilled(t *testing.T) {
+	attributionID := db.NewTeamAttributionID(uuid.New().String())
+	instance := db.WorkspaceInstanceForUsage{
+		ID:                 uuid.New(),
+		WorkspaceID:        "gitpodio-gitpod-2cx8kvvqn6o",
+		OwnerID:            uuid.New(),
+		UsageAttributionID: attributionID,
+	}
+	stoppedAt := time.Date(2022, 10, 11, 8, 0, 0, 0, time.UTC)
+
+	billed := dbtest.NewUsage(t, db.Usage{
+		AttributionID:       attributionID,
+		WorkspaceInstanceID: instance.ID,
+		Kind:                db.WorkspaceInstanceUsageKind,
+		CreditCents:         db.NewCreditCents(12.5),
+		EffectiveTime:       db.NewVarcharTime(stoppedAt),
+	})
+	require.NoError(t, billed.SetMetadataWithWorkspaceInstance(db.WorkspaceInstanceUsageData{
+		WorkspaceId:    instance.WorkspaceID,
+		WorkspaceType:  db.WorkspaceType_Regular,
+		WorkspaceClass: defaultWorkspaceClass,
+	}))
+	running := dbtest.NewUsage(t, db.Usage{
+		AttributionID: attributionID,
+		Kind:          db.WorkspaceInstanceUsageKind,
+		Draft:         true,
+	})
+
+	writer := &recordingAnalytics{}
+	service := &UsageService{analytics: writer}
+	service.trackSessionsBilled([]db.WorkspaceInstanceForUsage{instance}, []db.Usage{billed, running})
+
+	require.Equal(t, []analytics.TrackMessage{{
+		Identity:  analytics.Identity{UserID: instance.OwnerID.String()},
+		Event:     analyticsEvent_SessionBilled,
+		Timestamp: stoppedAt,
+		Properties: map[string]interface{}{
+			"attributionId":  string(attributionID),
+			"instanceId":     instance.ID.String(),
+			"projectId":      billed.ProjectID,
+			"credits":        12.5,
+			"workspaceId":    instance.WorkspaceID,
+			"workspaceClass": defaultWorkspaceClass,
+			"workspaceType":  string(db.WorkspaceType_Regular),
+		},
+	}}, writer.tracked, "must only track usage which is no longer a draft")
+}
+
+func TestTrackFirstPaidUsage(t *testing.T) {
+	conn := dbtest.ConnectInMemoryForTests(t)
+	now := time.Date(2022, 10, 11, 8, 0, 0, 0, time.UTC)
+	paid := db.NewTeamAttributionID(uuid.New().String())
+	other := db.NewTeamAttributionID(uuid.New().String())
+
+	writer := &recordingAnalytics{}
+	service := &UsageService{conn: conn, analytics: writer}
+
+	before := map[db.AttributionID]balance{
+		paid: {attributionID: paid, billingStrategy: db.CostCenter_Stripe},
+	}
+	after := map[db.AttributionID]balance{
+		paid:  {attributionID: paid, billingStrategy: db.CostCenter_Stripe, creditsUsed: db.NewCreditCents(5)},
+		other: {attributionID: other, billingStrategy: db.CostCenter_Other, creditsUsed: db.NewCreditCents(5)},
+	}
+	service.trackFirstPaidUsage(context.Background(), before, after, now)
+	require.Len(t, writer.tracked, 1)
+	require.Equal(t, analyticsEvent_FirstPaidUsage, writer.tracked[0].Event)
+	require.Equal(t, analytics.Identity{AnonymousID: string(paid)}, writer.tracked[0].Identity)
+	require.Equal(t, 5.0, writer.tracked[0].Properties["creditsUsed"])
+
+	// The next billing period starts without paid usage again.
+	service.trackFirstPaidUsage(context.Background(), before, after, now.AddDate(0, 1, 0))
+	require.Len(t, writer.tracked, 1, "must track first paid usage at most once")
+}
+
+func TestNotifyBudgetThresholds_TracksAnalytics(t *testing.T) {
+	conn := dbtest.ConnectInMemoryForTests(t)
+	now := time.Date(2022, 10, 15, 0, 0, 0, 0, time.UTC)
+	attributionID := db.NewTeamAttributionID(uuid.New().String())
+
+	dbtest.CreateCostCenters(t, conn, db.CostCenter{ID: attributionID, SpendingLimit: 100})
+	dbtest.CreateUsageRecords(t, conn, dbtest.NewUsage(t, db.Usage{
+		AttributionID: attributionID,
+		CreditCents:   db.NewCreditCents(85),
+		EffectiveTime: db.NewVarcharTime(now.Add(-time.Hour)),
+	}))
+
+	writer := &recordingAnalytics{}
+	service := NewUsageService(conn, nil, nil, DefaultWorkspacePricer, nil, SpendingLimitGraceMargin{}, nil, DefaultDunningPeriods, DefaultDeletedUsageRetention, nil, LogSamplingConfig{}, writer, nil, nil, nil, nil, nil)
+
+	balances, err := service.getBalances(context.Background(), []db.AttributionID{attributionID}, now)
+	require.NoError(t, err)
+
+	service.notifyBudgetThresholds(context.Background(), balances, now)
+	var thresholds []interface{}
+	for _, message := range writer.tracked {
+		require.Equal(t, analyticsEvent_LimitCrossed, message.Event)
+		require.Equal(t, analyticsLimit_BudgetThreshold, message.Properties["limit"])
+		thresholds = append(thresholds, message.Properties["thresholdPercent"])
+	}
+	require.ElementsMatch(t, []interface{}{int32(50), int32(80)}, thresholds)
+
+	service.notifyBudgetThresholds(context.Background(), balances, now)
+	require.Len(t, writer.tracked, 2, "must track every threshold at most once per billing period")
+}
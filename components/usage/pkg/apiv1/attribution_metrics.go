@@ -0,0 +1,126 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gitpod-io/gitpod/common-go/log"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// MaxAttributionMetrics bounds the number of attribution IDs with metrics, which are labelled by attribution ID.
+	MaxAttributionMetrics = 50
+
+	attributionMetricsTimeout = 5 * time.Second
+)
+
+// AttributionMetricsConfig lists the attribution IDs whose balance in the current billing period is exported as metrics,
+// for example the few teams of a self-hosted installation.
+type AttributionMetricsConfig struct {
+	AttributionIDs []string `json:"attributionIds"`
+}
+
+func (c AttributionMetricsConfig) Validate() error {
+	if len(c.AttributionIDs) > MaxAttributionMetrics {
+		return fmt.Errorf("metrics can be exported for at most %d attribution IDs, got %d", MaxAttributionMetrics, len(c.AttributionIDs))
+	}
+	seen := map[string]bool{}
+	for _, id := range c.AttributionIDs {
+		if _, err := db.ParseAttributionID(id); err != nil {
+			return fmt.Errorf("invalid attribution ID %q: %w", id, err)
+		}
+		if seen[id] {
+			return fmt.Errorf("duplicate attribution ID %q", id)
+		}
+		seen[id] = true
+	}
+	return nil
+}
+
+// attributionUsageCollector reads the balances of the configured attribution IDs when metrics are scraped. Balances are
+// read from the cached balances where possible, such that scrapes do not aggregate the ledger.
+type attributionUsageCollector struct {
+	usageService   *UsageService
+	attributionIDs []db.AttributionID
+
+	creditsUsed    *prometheus.Desc
+	creditsCovered *prometheus.Desc
+	spendingLimit  *prometheus.Desc
+	debt           *prometheus.Desc
+	periodEnd      *prometheus.Desc
+	scrapeErrors   *prometheus.Desc
+}
+
+// NewAttributionUsageCollector returns a collector of the balances of the configured attribution IDs. Attribution IDs
+// without cost center are skipped.
+func NewAttributionUsageCollector(usageService *UsageService, cfg AttributionMetricsConfig) (prometheus.Collector, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid attribution metrics config: %w", err)
+	}
+
+	c := &attributionUsageCollector{
+		usageService: usageService,
+
+		creditsUsed: prometheus.NewDesc(prometheus.BuildFQName(namespace, subsystem, "attribution_credits_used"),
+			"Credits used in the current billing period which were not covered by credit grants", []string{"attribution_id"}, nil),
+		creditsCovered: prometheus.NewDesc(prometheus.BuildFQName(namespace, subsystem, "attribution_credits_covered_by_grants"),
+			"Credits used in the current billing period which were covered by credit grants", []string{"attribution_id"}, nil),
+		spendingLimit: prometheus.NewDesc(prometheus.BuildFQName(namespace, subsystem, "attribution_spending_limit_credits"),
+			"Spending limit of the cost center in credits", []string{"attribution_id"}, nil),
+		debt: prometheus.NewDesc(prometheus.BuildFQName(namespace, subsystem, "attribution_debt_credits"),
+			"Overage carried over from previous billing periods, which counts towards the spending limit", []string{"attribution_id"}, nil),
+		periodEnd: prometheus.NewDesc(prometheus.BuildFQName(namespace, subsystem, "attribution_billing_period_end_timestamp_seconds"),
+			"End of the current billing period of the cost center", []string{"attribution_id"}, nil),
+		scrapeErrors: prometheus.NewDesc(prometheus.BuildFQName(namespace, subsystem, "attribution_metrics_errors"),
+			"Number of attribution IDs whose balance could not be read in the last scrape", nil, nil),
+	}
+	for _, id := range cfg.AttributionIDs {
+		c.attributionIDs = append(c.attributionIDs, db.AttributionID(id))
+	}
+	return c, nil
+}
+
+func (c *attributionUsageCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.creditsUsed
+	ch <- c.creditsCovered
+	ch <- c.spendingLimit
+	ch <- c.debt
+	ch <- c.periodEnd
+	ch <- c.scrapeErrors
+}
+
+func (c *attributionUsageCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(db.WithCaller(context.Background(), "attribution_metrics"), attributionMetricsTimeout)
+	defer cancel()
+
+	now := c.usageService.nowFunc()
+	var errorCount int
+	for _, attributionID := range c.attributionIDs {
+		b, err := c.usageService.getBalance(ctx, attributionID, now)
+		if errors.Is(err, db.CostCenterNotFound) {
+			continue
+		}
+		if err != nil {
+			log.Log.WithError(err).WithField("attribution_id", attributionID).Warn("Failed to get balance for metrics.")
+			errorCount++
+			continue
+		}
+
+		id := string(attributionID)
+		ch <- prometheus.MustNewConstMetric(c.creditsUsed, prometheus.GaugeValue, b.creditsUsed.ToCredits(), id)
+		ch <- prometheus.MustNewConstMetric(c.creditsCovered, prometheus.GaugeValue, b.creditsCovered.ToCredits(), id)
+		ch <- prometheus.MustNewConstMetric(c.spendingLimit, prometheus.GaugeValue, float64(b.spendingLimit), id)
+		ch <- prometheus.MustNewConstMetric(c.debt, prometheus.GaugeValue, b.debt.ToCredits(), id)
+		ch <- prometheus.MustNewConstMetric(c.periodEnd, prometheus.GaugeValue, float64(b.periodEnd.Unix()), id)
+	}
+	ch <- prometheus.MustNewConstMetric(c.scrapeErrors, prometheus.GaugeValue, float64(errorCount))
+}
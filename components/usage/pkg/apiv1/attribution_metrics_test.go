@@ -0,0 +1,69 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/db/dbtest"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAttributionMetricsConfig_Validate(t *testing.T) {
+	team := string(db.NewTeamAttributionID(uuid.New().String()))
+
+	require.NoError(t, AttributionMetricsConfig{AttributionIDs: []string{team}}.Validate())
+	require.Error(t, AttributionMetricsConfig{AttributionIDs: []string{"invalid"}}.Validate())
+	require.Error(t, AttributionMetricsConfig{AttributionIDs: []string{team, team}}.Validate())
+
+	var tooMany []string
+	for i := 0; i <= MaxAttributionMetrics; i++ {
+		tooMany = append(tooMany, string(db.NewTeamAttributionID(uuid.New().String())))
+	}
+	require.Error(t, AttributionMetricsConfig{AttributionIDs: tooMany}.Validate())
+}
+
+func TestAttributionUsageCollector(t *testing.T) {
+	conn := dbtest.ConnectInMemoryForTests(t)
+	now := time.Date(2022, 10, 15, 0, 0, 0, 0, time.UTC)
+	attributionID := db.NewTeamAttributionID("0d4f5e7c-9f4a-4a5b-8a7e-6b8f1c2d3e4f")
+	withoutCostCenter := db.NewTeamAttributionID(uuid.New().String())
+
+	dbtest.CreateCostCenters(t, conn, db.CostCenter{ID: attributionID, SpendingLimit: 100})
+	dbtest.CreateUsageRecords(t, conn, dbtest.NewUsage(t, db.Usage{
+		AttributionID: attributionID,
+		CreditCents:   db.NewCreditCents(20),
+		EffectiveTime: db.NewVarcharTime(now.Add(-time.Hour)),
+	}))
+
+	service := NewUsageService(conn, nil, nil, DefaultWorkspacePricer, nil, SpendingLimitGraceMargin{}, nil, DefaultDunningPeriods, DefaultDeletedUsageRetention, nil, LogSamplingConfig{}, nil, nil, nil, nil, nil, nil)
+	service.nowFunc = func() time.Time { return now }
+
+	collector, err := NewAttributionUsageCollector(service, AttributionMetricsConfig{AttributionIDs: []string{string(attributionID), string(withoutCostCenter)}})
+	require.NoError(t, err)
+
+	expected := `
+# HELP gitpod_usage_attribution_credits_used Credits used in the current billing period which were not covered by credit grants
+# TYPE gitpod_usage_attribution_credits_used gauge
+gitpod_usage_attribution_credits_used{attribution_id="team:0d4f5e7c-9f4a-4a5b-8a7e-6b8f1c2d3e4f"} 20
+# HELP gitpod_usage_attribution_spending_limit_credits Spending limit of the cost center in credits
+# TYPE gitpod_usage_attribution_spending_limit_credits gauge
+gitpod_usage_attribution_spending_limit_credits{attribution_id="team:0d4f5e7c-9f4a-4a5b-8a7e-6b8f1c2d3e4f"} 100
+# HELP gitpod_usage_attribution_metrics_errors Number of attribution IDs whose balance could not be read in the last scrape
+# TYPE gitpod_usage_attribution_metrics_errors gauge
+gitpod_usage_attribution_metrics_errors 0
+`
+	require.NoError(t, testutil.CollectAndCompare(collector, strings.NewReader(expected),
+		"gitpod_usage_attribution_credits_used",
+		"gitpod_usage_attribution_spending_limit_credits",
+		"gitpod_usage_attribution_metrics_errors",
+	))
+	require.Equal(t, 6, testutil.CollectAndCount(collector), "attribution IDs without cost center must be skipped")
+}
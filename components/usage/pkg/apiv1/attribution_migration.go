@@ -0,0 +1,56 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"context"
+
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/requestid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *UsageService) MigrateAttribution(ctx context.Context, in *v1.MigrateAttributionRequest) (*v1.MigrateAttributionResponse, error) {
+	from, err := db.ParseAttributionID(in.GetFromAttributionId())
+	if err != nil {
+		return nil, invalidAttributionIDError("Failed to parse from attribution ID: %s", err.Error())
+	}
+	to, err := db.ParseAttributionID(in.GetToAttributionId())
+	if err != nil {
+		return nil, invalidAttributionIDError("Failed to parse to attribution ID: %s", err.Error())
+	}
+	if from == to {
+		return nil, status.Errorf(codes.InvalidArgument, "Usage history must be migrated to a different attribution ID")
+	}
+	if in.GetActor() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "Actor must be specified")
+	}
+	if in.GetReason() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "Reason must be specified")
+	}
+
+	logger := requestid.Log(ctx).
+		WithField("from_attribution_id", from).
+		WithField("to_attribution_id", to).
+		WithField("actor", in.GetActor())
+
+	migration, err := db.MigrateAttribution(ctx, s.conn, from, to, in.GetActor(), in.GetReason())
+	if err != nil {
+		logger.WithError(err).Error("Failed to migrate usage history.")
+		return nil, status.Errorf(codes.Internal, "Failed to migrate usage history of %s to %s", from, to)
+	}
+	logger.
+		WithField("usage_entries", migration.UsageEntries).
+		WithField("workspace_instance_usage_entries", migration.WorkspaceInstanceUsageEntries).
+		Info("Migrated usage history.")
+
+	return &v1.MigrateAttributionResponse{
+		MigrationId:                   migration.ID.String(),
+		UsageEntries:                  migration.UsageEntries,
+		WorkspaceInstanceUsageEntries: migration.WorkspaceInstanceUsageEntries,
+	}, nil
+}
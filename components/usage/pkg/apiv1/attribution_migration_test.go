@@ -0,0 +1,56 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"context"
+	"testing"
+
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestMigrateAttribution_Validation(t *testing.T) {
+	user := string(db.NewUserAttributionID(uuid.New().String()))
+	team := string(db.NewTeamAttributionID(uuid.New().String()))
+
+	scenarios := []struct {
+		Name    string
+		Request *v1.MigrateAttributionRequest
+	}{
+		{
+			Name:    "invalid from attribution ID",
+			Request: &v1.MigrateAttributionRequest{FromAttributionId: "invalid", ToAttributionId: team, Actor: "user", Reason: "reason"},
+		},
+		{
+			Name:    "invalid to attribution ID",
+			Request: &v1.MigrateAttributionRequest{FromAttributionId: user, ToAttributionId: "invalid", Actor: "user", Reason: "reason"},
+		},
+		{
+			Name:    "same attribution ID",
+			Request: &v1.MigrateAttributionRequest{FromAttributionId: team, ToAttributionId: team, Actor: "user", Reason: "reason"},
+		},
+		{
+			Name:    "missing actor",
+			Request: &v1.MigrateAttributionRequest{FromAttributionId: user, ToAttributionId: team, Reason: "reason"},
+		},
+		{
+			Name:    "missing reason",
+			Request: &v1.MigrateAttributionRequest{FromAttributionId: user, ToAttributionId: team, Actor: "user"},
+		},
+	}
+
+	service := &UsageService{}
+	for _, s := range scenarios {
+		t.Run(s.Name, func(t *testing.T) {
+			_, err := service.MigrateAttribution(context.Background(), s.Request)
+			require.Equal(t, codes.InvalidArgument, status.Code(err))
+		})
+	}
+}
@@ -0,0 +1,258 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"time"
+
+	"github.com/gitpod-io/gitpod/common-go/log"
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/requestid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gorm.io/gorm"
+)
+
+const (
+	// AuditActorMetadataKey is the gRPC metadata key identifying who calls a mutating RPC, for RPCs whose request has
+	// no actor.
+	AuditActorMetadataKey = "x-gitpod-actor"
+
+	// maxAuditFieldLength is the size of the text columns of audit events.
+	maxAuditFieldLength = 65535
+
+	auditEventWriteTimeout = 5 * time.Second
+)
+
+// auditedMethods are the full method names of the RPCs which change state, and are recorded as audit events.
+var auditedMethods = func() map[string]bool {
+	methods := map[string]bool{}
+	for _, name := range []string{
+		"ReconcileUsage",
+		"ReconcileUsageWithLedger",
+		"CancelReportJob",
+		"GrantCredits",
+		"ExpireCreditGrants",
+		"ResetFreeTier",
+		"SetProjectBudget",
+		"DeleteProjectBudget",
+		"CheckCachedBalances",
+		"SetSpendingLimit",
+		"MigrateAttribution",
+		"SetCostCenterSplits",
+		"TransferUsage",
+		"RunJanitor",
+		"DeleteUsageForAttribution",
+		"PurgeUsageForAttribution",
+		"CreateUsageWebhook",
+		"DeleteUsageWebhook",
+		"EnqueueUsageWebhookSummaries",
+		"DeliverUsageWebhooks",
+		"ExportUsage",
+		"ImportUsageAdjustments",
+		"SetRetentionPolicy",
+	} {
+		methods["/"+v1.UsageService_ServiceDesc.ServiceName+"/"+name] = true
+	}
+	for _, name := range []string{
+		"UpdateInvoices",
+		"FinalizeInvoice",
+		"SetBilledSession",
+		"ReconcileInvoices",
+		"CreateStripeSubscription",
+		"VoidUsage",
+		"ReconcileLedgerWithInvoices",
+		"PurchaseCredits",
+	} {
+		methods["/"+v1.BillingService_ServiceDesc.ServiceName+"/"+name] = true
+	}
+	return methods
+}()
+
+type auditRecordKey struct{}
+
+// auditRecord collects the summary of the change of an audited RPC, while it is handled.
+type auditRecord struct {
+	attributionID db.AttributionID
+	before        string
+	after         string
+}
+
+// auditChange summarizes the change of the audited RPC handled with ctx. Before and after are recorded as JSON, nil
+// values are omitted. Outside of audited RPCs, auditChange has no effect.
+func auditChange(ctx context.Context, attributionID db.AttributionID, before, after interface{}) {
+	record, ok := ctx.Value(auditRecordKey{}).(*auditRecord)
+	if !ok {
+		return
+	}
+
+	record.attributionID = attributionID
+	if before != nil {
+		record.before = auditJSON(before)
+	}
+	if after != nil {
+		record.after = auditJSON(after)
+	}
+}
+
+// NewAuditInterceptor returns an interceptor recording an audit event for every call of a mutating RPC, whether it
+// succeeds or not. Failing to record an event does not fail the RPC.
+func NewAuditInterceptor(conn *gorm.DB) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !auditedMethods[info.FullMethod] {
+			return handler(ctx, req)
+		}
+
+		record := &auditRecord{}
+		resp, err := handler(context.WithValue(ctx, auditRecordKey{}, record), req)
+
+		event := db.AuditEvent{
+			RPC:           info.FullMethod,
+			Actor:         auditActor(ctx, req),
+			AttributionID: record.attributionID,
+			StatusCode:    status.Code(err).String(),
+			Request:       auditJSON(req),
+			Before:        record.before,
+			After:         record.after,
+		}
+		if event.AttributionID == "" {
+			event.AttributionID = auditAttributionID(req)
+		}
+		if event.After == "" && err == nil {
+			event.After = auditJSON(resp)
+		}
+		event.Request = truncateAuditField(event.Request)
+		event.Before = truncateAuditField(event.Before)
+		event.After = truncateAuditField(event.After)
+
+		// The event is recorded even when the call was cancelled by the client.
+		writeCtx := db.WithCaller(requestid.WithID(context.Background(), requestid.FromContext(ctx)), info.FullMethod)
+		writeCtx, cancel := context.WithTimeout(writeCtx, auditEventWriteTimeout)
+		defer cancel()
+		if auditErr := db.RecordAuditEvent(writeCtx, conn, event); auditErr != nil {
+			requestid.Log(ctx).WithError(auditErr).WithField("rpc", info.FullMethod).WithField("actor", event.Actor).Error("Failed to record audit event.")
+		}
+
+		return resp, err
+	}
+}
+
+func auditActor(ctx context.Context, req interface{}) string {
+	if r, ok := req.(interface{ GetActor() string }); ok && r.GetActor() != "" {
+		return r.GetActor()
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(AuditActorMetadataKey); len(values) > 0 && values[0] != "" {
+			return values[0]
+		}
+	}
+	return db.AuditActor_System
+}
+
+func auditAttributionID(req interface{}) db.AttributionID {
+	if r, ok := req.(interface{ GetAttributionId() string }); ok && r.GetAttributionId() != "" {
+		return db.AttributionID(r.GetAttributionId())
+	}
+	if r, ok := req.(interface{ GetFromAttributionId() string }); ok && r.GetFromAttributionId() != "" {
+		return db.AttributionID(r.GetFromAttributionId())
+	}
+	return ""
+}
+
+func auditJSON(v interface{}) string {
+	var (
+		b   []byte
+		err error
+	)
+	if m, ok := v.(proto.Message); ok {
+		b, err = protojson.Marshal(m)
+	} else {
+		b, err = json.Marshal(v)
+	}
+	if err != nil {
+		log.Log.WithError(err).Warn("Failed to marshal audit event summary.")
+		return ""
+	}
+	return string(b)
+}
+
+func truncateAuditField(s string) string {
+	if len(s) <= maxAuditFieldLength {
+		return s
+	}
+	return s[:maxAuditFieldLength]
+}
+
+func (s *UsageService) ListAuditEvents(ctx context.Context, in *v1.ListAuditEventsRequest) (*v1.ListAuditEventsResponse, error) {
+	var filter db.AuditEventFilter
+	if in.GetAttributionId() != "" {
+		attributionId, err := db.ParseAttributionID(in.GetAttributionId())
+		if err != nil {
+			return nil, invalidAttributionIDError("Failed to parse attribution ID: %s", err.Error())
+		}
+		filter.AttributionID = attributionId
+	}
+	filter.RPC = in.GetRpc()
+	filter.Actor = in.GetActor()
+	if in.GetFrom() != nil {
+		filter.From = in.GetFrom().AsTime()
+	}
+	if in.GetTo() != nil {
+		filter.To = in.GetTo().AsTime()
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return nil, invalidTimeRangeError("From must be before to")
+	}
+	if in.GetPagination().GetPerPage() < 0 {
+		return nil, invalidPaginationError("Number of items perPage needs to be positive (was %d).", in.GetPagination().GetPerPage())
+	}
+	if in.GetPagination().GetPage() < 0 {
+		return nil, invalidPaginationError("Page number needs to be 0 or greater (was %d).", in.GetPagination().GetPage())
+	}
+
+	var perPage int64 = 50
+	if in.GetPagination().GetPerPage() > 0 {
+		perPage = in.GetPagination().GetPerPage()
+	}
+	page := in.GetPagination().GetPage()
+
+	events, total, err := db.FindAuditEvents(ctx, s.conn, filter, page*perPage, perPage)
+	if err != nil {
+		requestid.Log(ctx).WithError(err).WithField("attribution_id", filter.AttributionID).Error("Failed to find audit events.")
+		return nil, status.Errorf(codes.Internal, "Failed to find audit events")
+	}
+
+	resp := &v1.ListAuditEventsResponse{
+		Pagination: &v1.PaginatedResponse{
+			PerPage:    perPage,
+			Page:       page,
+			TotalPages: int64(math.Ceil(float64(total) / float64(perPage))),
+			Total:      total,
+		},
+	}
+	for _, event := range events {
+		resp.Events = append(resp.Events, &v1.AuditEvent{
+			Id:            event.ID.String(),
+			Rpc:           event.RPC,
+			Actor:         event.Actor,
+			AttributionId: string(event.AttributionID),
+			StatusCode:    event.StatusCode,
+			Request:       event.Request,
+			Before:        event.Before,
+			After:         event.After,
+			EventTime:     timestamppb.New(event.EventTime),
+		})
+	}
+	return resp, nil
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"context"
+	"testing"
+
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/db/dbtest"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestAuditInterceptor(t *testing.T) {
+	conn := dbtest.ConnectInMemoryForTests(t)
+	interceptor := NewAuditInterceptor(conn)
+	svc := &UsageService{conn: conn}
+	attributionID := db.NewTeamAttributionID(uuid.New().String())
+
+	t.Run("records change summarized by the handler", func(t *testing.T) {
+		req := &v1.SetSpendingLimitRequest{AttributionId: string(attributionID), SpendingLimit: 500, Actor: "user-a", Reason: "Hackathon"}
+		_, err := interceptor(context.Background(), req, &grpc.UnaryServerInfo{FullMethod: "/usage.v1.UsageService/SetSpendingLimit"},
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				auditChange(ctx, attributionID, db.CostCenter{ID: attributionID, SpendingLimit: 100}, db.CostCenter{ID: attributionID, SpendingLimit: 500})
+				return &v1.SetSpendingLimitResponse{}, nil
+			})
+		require.NoError(t, err)
+
+		resp, err := svc.ListAuditEvents(context.Background(), &v1.ListAuditEventsRequest{Rpc: "/usage.v1.UsageService/SetSpendingLimit"})
+		require.NoError(t, err)
+		require.Len(t, resp.Events, 1)
+		event := resp.Events[0]
+		require.Equal(t, "user-a", event.Actor)
+		require.Equal(t, string(attributionID), event.AttributionId)
+		require.Equal(t, codes.OK.String(), event.StatusCode)
+		require.Contains(t, event.Request, `"spendingLimit":500`)
+		require.Contains(t, event.Before, `"spendingLimit":100`)
+		require.Contains(t, event.After, `"spendingLimit":500`)
+	})
+
+	t.Run("records failed calls with the actor from metadata", func(t *testing.T) {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(AuditActorMetadataKey, "user-b"))
+		req := &v1.GrantCreditsRequest{AttributionId: string(attributionID)}
+		_, err := interceptor(ctx, req, &grpc.UnaryServerInfo{FullMethod: "/usage.v1.UsageService/GrantCredits"},
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				return nil, status.Error(codes.InvalidArgument, "invalid grant")
+			})
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+		resp, err := svc.ListAuditEvents(context.Background(), &v1.ListAuditEventsRequest{Actor: "user-b"})
+		require.NoError(t, err)
+		require.Len(t, resp.Events, 1)
+		require.Equal(t, string(attributionID), resp.Events[0].AttributionId)
+		require.Equal(t, codes.InvalidArgument.String(), resp.Events[0].StatusCode)
+		require.Empty(t, resp.Events[0].After)
+	})
+
+	t.Run("defaults to the system actor and the response", func(t *testing.T) {
+		_, err := interceptor(context.Background(), &v1.ReconcileUsageRequest{}, &grpc.UnaryServerInfo{FullMethod: "/usage.v1.UsageService/ReconcileUsage"},
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				return &v1.ReconcileUsageResponse{}, nil
+			})
+		require.NoError(t, err)
+
+		resp, err := svc.ListAuditEvents(context.Background(), &v1.ListAuditEventsRequest{Rpc: "/usage.v1.UsageService/ReconcileUsage"})
+		require.NoError(t, err)
+		require.Len(t, resp.Events, 1)
+		require.Equal(t, db.AuditActor_System, resp.Events[0].Actor)
+		require.Equal(t, "{}", resp.Events[0].After)
+	})
+
+	t.Run("does not record read-only calls", func(t *testing.T) {
+		_, err := interceptor(context.Background(), &v1.GetCostCenterRequest{AttributionId: string(attributionID)}, &grpc.UnaryServerInfo{FullMethod: "/usage.v1.UsageService/GetCostCenter"},
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				return &v1.GetCostCenterResponse{}, nil
+			})
+		require.NoError(t, err)
+
+		resp, err := svc.ListAuditEvents(context.Background(), &v1.ListAuditEventsRequest{AttributionId: string(attributionID)})
+		require.NoError(t, err)
+		require.EqualValues(t, 2, resp.Pagination.Total)
+	})
+}
+
+func TestListAuditEvents_InvalidArguments(t *testing.T) {
+	svc := &UsageService{}
+
+	_, err := svc.ListAuditEvents(context.Background(), &v1.ListAuditEventsRequest{AttributionId: "invalid"})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = svc.ListAuditEvents(context.Background(), &v1.ListAuditEventsRequest{Pagination: &v1.PaginatedRequest{PerPage: -1}})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
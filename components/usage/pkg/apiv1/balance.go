@@ -0,0 +1,386 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/notifier"
+	"github.com/gitpod-io/gitpod/usage/pkg/requestid"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gorm.io/gorm"
+)
+
+// SpendingLimitNotifier is informed whenever the balance of a cost center reaches its spending limit, and when it
+// exceeds the grace margin on top of it. It is also informed when the balance reaches one of the budgetThresholds.
+type SpendingLimitNotifier interface {
+	NotifySpendingLimitReached(ctx context.Context, limit notifier.SpendingLimit) error
+	NotifySpendingLimitExceeded(ctx context.Context, limit notifier.SpendingLimit) error
+	NotifyBudgetThresholdReached(ctx context.Context, limit notifier.SpendingLimit) error
+}
+
+// budgetThresholds are the percentages of the spending limit which are notified once per billing period when usage
+// reaches them, such that teams are warned before workspaces stop starting.
+var budgetThresholds = []int32{50, 80, 100}
+
+// SpendingLimitGraceMargin is the overage on top of the spending limit during which workspaces can still be started.
+// At most one of Percent and Credits can be set.
+type SpendingLimitGraceMargin struct {
+	// Percent is the margin relative to the spending limit, e.g. 10 to allow usage up to 110% of the limit.
+	Percent float64 `json:"percent,omitempty"`
+	// Credits is the margin in absolute credits.
+	Credits float64 `json:"credits,omitempty"`
+}
+
+func (m SpendingLimitGraceMargin) Validate() error {
+	if m.Percent < 0 || m.Credits < 0 {
+		return errors.New("grace margin must not be negative")
+	}
+	if m.Percent > 0 && m.Credits > 0 {
+		return errors.New("grace margin can be specified in percent or credits, but not both")
+	}
+	return nil
+}
+
+// HardLimit returns the usage in credits at which the spending limit including the grace margin is exceeded.
+func (m SpendingLimitGraceMargin) HardLimit(spendingLimit int32) float64 {
+	limit := float64(spendingLimit)
+	if m.Percent > 0 {
+		return limit + limit*m.Percent/100
+	}
+	return limit + m.Credits
+}
+
+type spendingLimitState int
+
+const (
+	spendingLimitState_WithinLimit spendingLimitState = iota
+	spendingLimitState_Grace
+	spendingLimitState_Exceeded
+)
+
+func (s spendingLimitState) toAPI() v1.GetBalanceResponse_SpendingLimitState {
+	switch s {
+	case spendingLimitState_WithinLimit:
+		return v1.GetBalanceResponse_SPENDING_LIMIT_STATE_WITHIN_LIMIT
+	case spendingLimitState_Grace:
+		return v1.GetBalanceResponse_SPENDING_LIMIT_STATE_GRACE
+	case spendingLimitState_Exceeded:
+		return v1.GetBalanceResponse_SPENDING_LIMIT_STATE_EXCEEDED
+	}
+	return v1.GetBalanceResponse_SPENDING_LIMIT_STATE_UNSPECIFIED
+}
+
+func spendingLimitTypeToAPI(limitType db.SpendingLimitType) v1.SpendingLimitType {
+	switch limitType {
+	case db.SpendingLimitType_Soft:
+		return v1.SpendingLimitType_SPENDING_LIMIT_TYPE_SOFT
+	case db.SpendingLimitType_Hard:
+		return v1.SpendingLimitType_SPENDING_LIMIT_TYPE_HARD
+	}
+	return v1.SpendingLimitType_SPENDING_LIMIT_TYPE_UNSPECIFIED
+}
+
+type balance struct {
+	attributionID db.AttributionID
+	spendingLimit int32
+	limitType     db.SpendingLimitType
+	currency      string
+	hardLimit     float64
+	// billingStrategy is how the cost center is billed, usage is paid when it is billed through Stripe.
+	billingStrategy db.BillingStrategy
+	// creditsUsed is the workspace usage in the billing period which was not covered by credit grants.
+	creditsUsed db.CreditCents
+	// creditsCovered is the workspace usage in the billing period which was covered by credit grants.
+	creditsCovered db.CreditCents
+	// creditsGrantedRemaining is the unused remainder of the credit grants which did not expire yet.
+	creditsGrantedRemaining db.CreditCents
+	// debt is the overage carried over from previous billing periods, it counts towards the spending limit.
+	debt        db.CreditCents
+	periodStart time.Time
+	periodEnd   time.Time
+}
+
+// creditsOwed is the usage which counts towards the spending limit.
+func (b balance) creditsOwed() db.CreditCents {
+	return b.creditsUsed + b.debt
+}
+
+func (b balance) limitReached() bool {
+	return b.creditsOwed().ToCredits() >= float64(b.spendingLimit)
+}
+
+func (b balance) state() spendingLimitState {
+	switch {
+	case b.creditsOwed().ToCredits() >= b.hardLimit:
+		return spendingLimitState_Exceeded
+	case b.limitReached():
+		return spendingLimitState_Grace
+	default:
+		return spendingLimitState_WithinLimit
+	}
+}
+
+// reachedBudgetThresholds returns the budgetThresholds which the usage reached.
+func (b balance) reachedBudgetThresholds() []int32 {
+	if b.spendingLimit <= 0 {
+		return nil
+	}
+
+	var reached []int32
+	for _, threshold := range budgetThresholds {
+		if b.creditsOwed().ToCredits()*100 >= float64(b.spendingLimit)*float64(threshold) {
+			reached = append(reached, threshold)
+		}
+	}
+	return reached
+}
+
+func (b balance) toNotification() notifier.SpendingLimit {
+	return notifier.SpendingLimit{
+		AttributionID:      string(b.attributionID),
+		SpendingLimit:      b.spendingLimit,
+		LimitType:          string(b.limitType),
+		HardLimit:          b.hardLimit,
+		CreditsUsed:        b.creditsUsed.ToCredits(),
+		BillingPeriodStart: b.periodStart,
+		BillingPeriodEnd:   b.periodEnd,
+	}
+}
+
+// crossed is true when the balance moved from below `state` to at least `state` between `before` and `after`.
+func crossed(before, after balance, state spendingLimitState) bool {
+	return before.state() < state && after.state() >= state
+}
+
+func (s *UsageService) GetBalance(ctx context.Context, in *v1.GetBalanceRequest) (*v1.GetBalanceResponse, error) {
+	attributionId, err := db.ParseAttributionID(in.GetAttributionId())
+	if err != nil {
+		return nil, invalidAttributionIDError("Failed to parse attribution ID: %s", err.Error())
+	}
+
+	b, err := s.getBalance(ctx, attributionId, s.nowFunc())
+	if err != nil {
+		if errors.Is(err, db.CostCenterNotFound) {
+			return nil, attributionNotFoundError(attributionId, err)
+		}
+		requestid.Log(ctx).WithError(err).WithField("attribution_id", attributionId).Error("Failed to get balance.")
+		return nil, status.Errorf(codes.Internal, "Failed to get balance of %s", attributionId)
+	}
+
+	projectBalances, err := s.projectBalances(ctx, attributionId, b.periodStart, b.periodEnd)
+	if err != nil {
+		requestid.Log(ctx).WithError(err).WithField("attribution_id", attributionId).Error("Failed to get project balances.")
+		return nil, status.Errorf(codes.Internal, "Failed to get project balances of %s", attributionId)
+	}
+
+	amountUsed, _ := s.creditPrices.Amount(b.creditsUsed.ToCredits(), b.currency)
+
+	return &v1.GetBalanceResponse{
+		CreditsUsed:        b.creditsUsed.ToCredits(),
+		SpendingLimit:      b.spendingLimit,
+		LimitReached:       b.limitReached(),
+		BillingPeriodStart: timestamppb.New(b.periodStart),
+		BillingPeriodEnd:   timestamppb.New(b.periodEnd),
+		State:              b.state().toAPI(),
+		HardLimit:          b.hardLimit,
+		SpendingLimitType:  spendingLimitTypeToAPI(b.limitType),
+		Currency:           b.currency,
+		AmountUsed:         float64(amountUsed),
+
+		CreditsCoveredByGrants:  b.creditsCovered.ToCredits(),
+		CreditsGrantedRemaining: b.creditsGrantedRemaining.ToCredits(),
+		ProjectBalances:         projectBalances,
+		Debt:                    b.debt.ToCredits(),
+	}, nil
+}
+
+func (s *UsageService) getBalance(ctx context.Context, attributionId db.AttributionID, now time.Time) (balance, error) {
+	costCenter, err := db.GetCostCenter(ctx, s.conn, attributionId)
+	if err != nil {
+		return balance{}, err
+	}
+
+	periodStart, periodEnd := costCenter.BillingPeriodAt(now)
+	ledger, err := s.ledgerBalance(ctx, attributionId, periodStart, periodEnd, now)
+	if err != nil {
+		return balance{}, err
+	}
+
+	return balance{
+		attributionID:           attributionId,
+		spendingLimit:           costCenter.SpendingLimit,
+		limitType:               costCenter.SpendingLimitType,
+		currency:                costCenterCurrency(costCenter),
+		hardLimit:               s.graceMargin.HardLimit(costCenter.SpendingLimit),
+		billingStrategy:         costCenter.BillingStrategy,
+		creditsUsed:             ledger.CreditsUsed,
+		creditsCovered:          ledger.CreditsCovered,
+		creditsGrantedRemaining: ledger.CreditsGrantedRemaining,
+		debt:                    costCenter.Debt,
+		periodStart:             periodStart,
+		periodEnd:               periodEnd,
+	}, nil
+}
+
+// getBalances returns the balances of all attribution IDs which have a cost center.
+func (s *UsageService) getBalances(ctx context.Context, attributionIds []db.AttributionID, now time.Time) (map[db.AttributionID]balance, error) {
+	balances := map[db.AttributionID]balance{}
+	for _, attributionId := range attributionIds {
+		b, err := s.getBalance(ctx, attributionId, now)
+		if errors.Is(err, db.CostCenterNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get balance of %s: %w", attributionId, err)
+		}
+		balances[attributionId] = b
+	}
+	return balances, nil
+}
+
+// notifySpendingLimits informs the spending limit notifier and analytics about every balance which reached its spending
+// limit, or exceeded the grace margin, between `before` and `after`. Delivery failures are logged, the usage is already
+// recorded at this point.
+func (s *UsageService) notifySpendingLimits(ctx context.Context, before, after map[db.AttributionID]balance, now time.Time) {
+	reached := newRecordLogSampler(s.logSampling, requestid.Log(ctx), logrus.InfoLevel, "Spending limit reached.")
+	defer reached.Close()
+	exceeded := newRecordLogSampler(s.logSampling, requestid.Log(ctx), logrus.InfoLevel, "Spending limit exceeded.")
+	defer exceeded.Close()
+	failures := newRecordLogSampler(s.logSampling, requestid.Log(ctx), logrus.ErrorLevel, "Failed to notify about spending limit.")
+	defer failures.Close()
+
+	for attributionId, b := range after {
+		logger := requestid.Log(ctx).WithField("attribution_id", attributionId)
+		limit := b.toNotification()
+
+		if crossed(before[attributionId], b, spendingLimitState_Grace) {
+			reached.Log(logger, attributionId)
+			if s.analytics != nil {
+				s.trackLimitCrossed(b, analyticsLimit_SpendingLimit, 0, now)
+			}
+			if s.spendingLimitNotifier != nil {
+				err := s.spendingLimitNotifier.NotifySpendingLimitReached(ctx, limit)
+				if err != nil {
+					failures.Log(logger.WithError(err).WithField("state", "reached"), attributionId)
+				}
+			}
+			_, err := s.enqueueUsageWebhookEvent(ctx, s.conn, attributionId, db.TimeToISO8601(b.periodStart), notifier.WebhookEvent{Event: notifier.SpendingLimitReachedEvent, SpendingLimit: &limit})
+			if err != nil {
+				failures.Log(logger.WithError(err).WithField("state", "reached"), attributionId)
+			}
+		}
+
+		if crossed(before[attributionId], b, spendingLimitState_Exceeded) {
+			exceeded.Log(logger, attributionId)
+			if s.analytics != nil {
+				s.trackLimitCrossed(b, analyticsLimit_HardLimit, 0, now)
+			}
+			if s.spendingLimitNotifier != nil {
+				err := s.spendingLimitNotifier.NotifySpendingLimitExceeded(ctx, limit)
+				if err != nil {
+					failures.Log(logger.WithError(err).WithField("state", "exceeded"), attributionId)
+				}
+			}
+			_, err := s.enqueueUsageWebhookEvent(ctx, s.conn, attributionId, db.TimeToISO8601(b.periodStart), notifier.WebhookEvent{Event: notifier.SpendingLimitExceededEvent, SpendingLimit: &limit})
+			if err != nil {
+				failures.Log(logger.WithError(err).WithField("state", "exceeded"), attributionId)
+			}
+		}
+	}
+}
+
+// notifySpendingLimitStates calls the server for every attribution ID whose spending limit state changed between
+// `before` and `after`, in either direction, such that it can unblock workspace starts when usage drops below the hard
+// limit again. Attribution IDs without a balance before are skipped. Failed calls are logged and not retried.
+func (s *UsageService) notifySpendingLimitStates(ctx context.Context, before, after map[db.AttributionID]balance) {
+	failures := newRecordLogSampler(s.logSampling, requestid.Log(ctx), logrus.ErrorLevel, "Failed to notify server about spending limit state.")
+	defer failures.Close()
+
+	for attributionId, b := range after {
+		previous, ok := before[attributionId]
+		if !ok || previous.state() == b.state() {
+			continue
+		}
+		err := s.notifySpendingLimitState(ctx, previous, b)
+		if err != nil {
+			failures.Log(requestid.Log(ctx).WithError(err).WithField("attribution_id", attributionId).WithField("state", b.state().toAPI().String()), attributionId)
+		}
+	}
+}
+
+func (s *UsageService) notifySpendingLimitState(ctx context.Context, previous, current balance) error {
+	_, err := s.limitStates.SpendingLimitStateChanged(ctx, &v1.SpendingLimitStateChangedRequest{
+		AttributionId:      string(current.attributionID),
+		PreviousState:      previous.state().toAPI(),
+		State:              current.state().toAPI(),
+		CreditsUsed:        current.creditsUsed.ToCredits(),
+		SpendingLimit:      current.spendingLimit,
+		HardLimit:          current.hardLimit,
+		SpendingLimitType:  spendingLimitTypeToAPI(current.limitType),
+		BillingPeriodStart: timestamppb.New(current.periodStart),
+		BillingPeriodEnd:   timestamppb.New(current.periodEnd),
+	})
+	return err
+}
+
+// notifyBudgetThresholds emits an event for every budget threshold which a balance reached, and informs the spending
+// limit notifier and analytics if there are any. Every threshold is notified at most once per billing period. When the
+// notifier fails, the threshold is notified again after the next reconciliation.
+func (s *UsageService) notifyBudgetThresholds(ctx context.Context, balances map[db.AttributionID]balance, now time.Time) {
+	reached := newRecordLogSampler(s.logSampling, requestid.Log(ctx), logrus.InfoLevel, "Budget threshold reached.")
+	defer reached.Close()
+	failures := newRecordLogSampler(s.logSampling, requestid.Log(ctx), logrus.ErrorLevel, "Failed to notify about reached budget threshold.")
+	defer failures.Close()
+
+	for attributionId, b := range balances {
+		for _, threshold := range b.reachedBudgetThresholds() {
+			logger := requestid.Log(ctx).WithField("attribution_id", attributionId).WithField("threshold_percent", threshold)
+			limit := b.toNotification()
+			limit.ThresholdPercent = threshold
+
+			var notified bool
+			err := s.conn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+				recorded, err := db.RecordBudgetNotification(ctx, tx, db.BudgetNotification{
+					AttributionID:      attributionId,
+					BillingPeriodStart: db.NewVarcharTime(b.periodStart),
+					ThresholdPercent:   threshold,
+					NotifiedAt:         db.NewVarcharTime(now),
+				})
+				if err != nil || !recorded {
+					return err
+				}
+
+				reached.Log(logger.WithField("credits_used", limit.CreditsUsed), attributionId)
+				notified = true
+				key := fmt.Sprintf("%s/%d", db.TimeToISO8601(b.periodStart), threshold)
+				_, err = s.enqueueUsageWebhookEvent(ctx, tx, attributionId, key, notifier.WebhookEvent{Event: notifier.BudgetThresholdReachedEvent, SpendingLimit: &limit})
+				if err != nil {
+					return err
+				}
+				if s.spendingLimitNotifier == nil {
+					return nil
+				}
+				return s.spendingLimitNotifier.NotifyBudgetThresholdReached(ctx, limit)
+			})
+			if err != nil {
+				failures.Log(logger.WithError(err), attributionId)
+				continue
+			}
+			// Analytics are only informed once the notification is recorded, failed notifications are retried.
+			if notified && s.analytics != nil {
+				s.trackLimitCrossed(b, analyticsLimit_BudgetThreshold, threshold, now)
+			}
+		}
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+func TestBalance_State(t *testing.T) {
+	scenarios := []struct {
+		Name     string
+		Balance  balance
+		Expected spendingLimitState
+	}{
+		{
+			Name:     "below limit",
+			Balance:  balance{spendingLimit: 100, hardLimit: 110, creditsUsed: 9999},
+			Expected: spendingLimitState_WithinLimit,
+		},
+		{
+			Name:     "reached limit within grace margin",
+			Balance:  balance{spendingLimit: 100, hardLimit: 110, creditsUsed: 10000},
+			Expected: spendingLimitState_Grace,
+		},
+		{
+			Name:     "exceeded grace margin",
+			Balance:  balance{spendingLimit: 100, hardLimit: 110, creditsUsed: 11000},
+			Expected: spendingLimitState_Exceeded,
+		},
+		{
+			Name:     "no grace margin",
+			Balance:  balance{spendingLimit: 100, hardLimit: 100, creditsUsed: 10000},
+			Expected: spendingLimitState_Exceeded,
+		},
+		{
+			Name:     "debt counts towards the limit",
+			Balance:  balance{spendingLimit: 100, hardLimit: 110, creditsUsed: 5000, debt: 5000},
+			Expected: spendingLimitState_Grace,
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.Name, func(t *testing.T) {
+			require.Equal(t, s.Expected, s.Balance.state())
+		})
+	}
+}
+
+func TestCrossed(t *testing.T) {
+	scenarios := []struct {
+		Name             string
+		Before           balance
+		After            balance
+		ExpectedReached  bool
+		ExpectedExceeded bool
+	}{
+		{
+			Name:   "below limit",
+			Before: balance{spendingLimit: 100, hardLimit: 110, creditsUsed: 5000},
+			After:  balance{spendingLimit: 100, hardLimit: 110, creditsUsed: 9999},
+		},
+		{
+			Name:            "reaches limit",
+			Before:          balance{spendingLimit: 100, hardLimit: 110, creditsUsed: 9999},
+			After:           balance{spendingLimit: 100, hardLimit: 110, creditsUsed: 10000},
+			ExpectedReached: true,
+		},
+		{
+			Name:             "exceeds grace margin",
+			Before:           balance{spendingLimit: 100, hardLimit: 110, creditsUsed: 10500},
+			After:            balance{spendingLimit: 100, hardLimit: 110, creditsUsed: 11000},
+			ExpectedExceeded: true,
+		},
+		{
+			Name:             "reaches limit and exceeds grace margin at once",
+			Before:           balance{spendingLimit: 100, hardLimit: 110, creditsUsed: 5000},
+			After:            balance{spendingLimit: 100, hardLimit: 110, creditsUsed: 12000},
+			ExpectedReached:  true,
+			ExpectedExceeded: true,
+		},
+		{
+			Name:   "already exceeded",
+			Before: balance{spendingLimit: 100, hardLimit: 110, creditsUsed: 11000},
+			After:  balance{spendingLimit: 100, hardLimit: 110, creditsUsed: 12000},
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.Name, func(t *testing.T) {
+			require.Equal(t, s.ExpectedReached, crossed(s.Before, s.After, spendingLimitState_Grace))
+			require.Equal(t, s.ExpectedExceeded, crossed(s.Before, s.After, spendingLimitState_Exceeded))
+		})
+	}
+}
+
+func TestBalance_ReachedBudgetThresholds(t *testing.T) {
+	require.Empty(t, balance{spendingLimit: 100, creditsUsed: 4999}.reachedBudgetThresholds())
+	require.Equal(t, []int32{50}, balance{spendingLimit: 100, creditsUsed: 5000}.reachedBudgetThresholds())
+	require.Equal(t, []int32{50, 80}, balance{spendingLimit: 100, creditsUsed: 9999}.reachedBudgetThresholds())
+	require.Equal(t, []int32{50, 80, 100}, balance{spendingLimit: 100, creditsUsed: 12000}.reachedBudgetThresholds())
+	require.Empty(t, balance{spendingLimit: 0, creditsUsed: 12000}.reachedBudgetThresholds(), "cost centers without a spending limit have no budget")
+}
+
+func TestSpendingLimitGraceMargin(t *testing.T) {
+	require.Equal(t, float64(100), SpendingLimitGraceMargin{}.HardLimit(100))
+	require.Equal(t, float64(110), SpendingLimitGraceMargin{Percent: 10}.HardLimit(100))
+	require.Equal(t, float64(125), SpendingLimitGraceMargin{Credits: 25}.HardLimit(100))
+
+	require.NoError(t, SpendingLimitGraceMargin{Percent: 10}.Validate())
+	require.Error(t, SpendingLimitGraceMargin{Percent: 10, Credits: 25}.Validate())
+	require.Error(t, SpendingLimitGraceMargin{Credits: -1}.Validate())
+}
+
+func TestSpendingLimitTypeToAPI(t *testing.T) {
+	require.Equal(t, v1.SpendingLimitType_SPENDING_LIMIT_TYPE_SOFT, spendingLimitTypeToAPI(db.SpendingLimitType_Soft))
+	require.Equal(t, v1.SpendingLimitType_SPENDING_LIMIT_TYPE_HARD, spendingLimitTypeToAPI(db.SpendingLimitType_Hard))
+	require.Equal(t, v1.SpendingLimitType_SPENDING_LIMIT_TYPE_UNSPECIFIED, spendingLimitTypeToAPI(""))
+}
+
+type recordingLimitStates struct {
+	requests []*v1.SpendingLimitStateChangedRequest
+	err      error
+}
+
+func (r *recordingLimitStates) SpendingLimitStateChanged(ctx context.Context, in *v1.SpendingLimitStateChangedRequest, opts ...grpc.CallOption) (*v1.SpendingLimitStateChangedResponse, error) {
+	r.requests = append(r.requests, in)
+	return &v1.SpendingLimitStateChangedResponse{}, r.err
+}
+
+func TestNotifySpendingLimitStates(t *testing.T) {
+	warned := db.NewTeamAttributionID(uuid.New().String())
+	recovered := db.NewTeamAttributionID(uuid.New().String())
+	unchanged := db.NewTeamAttributionID(uuid.New().String())
+	created := db.NewTeamAttributionID(uuid.New().String())
+
+	limitStates := &recordingLimitStates{}
+	service := &UsageService{limitStates: limitStates}
+
+	before := map[db.AttributionID]balance{
+		warned:    {attributionID: warned, spendingLimit: 100, hardLimit: 110, creditsUsed: 9000},
+		recovered: {attributionID: recovered, spendingLimit: 100, hardLimit: 100, creditsUsed: 10000},
+		unchanged: {attributionID: unchanged, spendingLimit: 100, hardLimit: 110, creditsUsed: 1000},
+	}
+	after := map[db.AttributionID]balance{
+		warned:    {attributionID: warned, spendingLimit: 100, hardLimit: 110, limitType: db.SpendingLimitType_Hard, creditsUsed: 10500},
+		recovered: {attributionID: recovered, spendingLimit: 200, hardLimit: 200, creditsUsed: 10000},
+		unchanged: {attributionID: unchanged, spendingLimit: 100, hardLimit: 110, creditsUsed: 2000},
+		created:   {attributionID: created, spendingLimit: 100, hardLimit: 110},
+	}
+	service.notifySpendingLimitStates(context.Background(), before, after)
+
+	byAttributionID := map[string]*v1.SpendingLimitStateChangedRequest{}
+	for _, req := range limitStates.requests {
+		byAttributionID[req.GetAttributionId()] = req
+	}
+	require.Len(t, byAttributionID, 2, "must only notify about changed states of known balances")
+
+	require.Equal(t, v1.GetBalanceResponse_SPENDING_LIMIT_STATE_WITHIN_LIMIT, byAttributionID[string(warned)].GetPreviousState())
+	require.Equal(t, v1.GetBalanceResponse_SPENDING_LIMIT_STATE_GRACE, byAttributionID[string(warned)].GetState())
+	require.Equal(t, 105.0, byAttributionID[string(warned)].GetCreditsUsed())
+	require.Equal(t, 110.0, byAttributionID[string(warned)].GetHardLimit())
+	require.Equal(t, v1.SpendingLimitType_SPENDING_LIMIT_TYPE_HARD, byAttributionID[string(warned)].GetSpendingLimitType())
+
+	require.Equal(t, v1.GetBalanceResponse_SPENDING_LIMIT_STATE_EXCEEDED, byAttributionID[string(recovered)].GetPreviousState())
+	require.Equal(t, v1.GetBalanceResponse_SPENDING_LIMIT_STATE_WITHIN_LIMIT, byAttributionID[string(recovered)].GetState(), "must notify when usage drops below the limit again")
+	require.EqualValues(t, 200, byAttributionID[string(recovered)].GetSpendingLimit())
+}
+
+func TestNotifySpendingLimitStates_Fails(t *testing.T) {
+	attributionID := db.NewTeamAttributionID(uuid.New().String())
+	limitStates := &recordingLimitStates{err: errors.New("unavailable")}
+	service := &UsageService{limitStates: limitStates}
+
+	before := map[db.AttributionID]balance{attributionID: {attributionID: attributionID, spendingLimit: 100, hardLimit: 100}}
+	after := map[db.AttributionID]balance{attributionID: {attributionID: attributionID, spendingLimit: 100, hardLimit: 100, creditsUsed: 10000}}
+	require.NotPanics(t, func() {
+		service.notifySpendingLimitStates(context.Background(), before, after)
+	})
+	require.Len(t, limitStates.requests, 1, "must not retry failed calls")
+}
@@ -6,14 +6,15 @@ package apiv1
 
 import (
 	"context"
-
+	"errors"
+	"fmt"
 	"math"
 	"time"
 
-	"github.com/gitpod-io/gitpod/common-go/log"
 	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
 	"github.com/gitpod-io/gitpod/usage/pkg/contentservice"
 	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/requestid"
 	"github.com/gitpod-io/gitpod/usage/pkg/stripe"
 	"github.com/google/uuid"
 	stripesdk "github.com/stripe/stripe-go/v72"
@@ -23,20 +24,35 @@ import (
 	"gorm.io/gorm"
 )
 
-func NewBillingService(stripeClient *stripe.Client, billInstancesAfter time.Time, conn *gorm.DB, contentService contentservice.Interface) *BillingService {
+func NewBillingService(stripeClient *stripe.Client, billInstancesAfter time.Time, conn *gorm.DB, contentService contentservice.Interface, stripePrices map[string]string, taxRates stripe.TaxRates, creditPrices CreditPrices, events UsageEventPublisher) *BillingService {
 	return &BillingService{
 		stripeClient:       stripeClient,
+		stripePrices:       stripePrices,
+		taxRates:           taxRates,
+		creditPrices:       creditPrices,
+		customers:          stripe.NewCustomerCache(customerByAttributionID(stripeClient), stripe.DefaultCustomerCacheTTL, stripe.DefaultCustomerCacheNegativeTTL),
 		billInstancesAfter: billInstancesAfter,
 		conn:               conn,
 		contentService:     contentService,
+		events:             events,
 	}
 }
 
 type BillingService struct {
 	conn           *gorm.DB
 	stripeClient   *stripe.Client
+	customers      *stripe.CustomerCache
 	contentService contentservice.Interface
 
+	// stripePrices maps currencies to the ID of the usage-based Stripe price in that currency.
+	stripePrices map[string]string
+	// taxRates are applied to invoice amounts based on the country of the customer's billing address.
+	taxRates stripe.TaxRates
+	// creditPrices convert credits recorded in the ledger to the currency of the invoice.
+	creditPrices CreditPrices
+	// events receives invoices which reconciliation credited in the ledger. It is optional.
+	events UsageEventPublisher
+
 	billInstancesAfter time.Time
 
 	v1.UnimplementedBillingServiceServer
@@ -54,21 +70,125 @@ func (s *BillingService) UpdateInvoices(ctx context.Context, in *v1.UpdateInvoic
 
 	credits, err := s.creditSummaryForTeams(report.UsageRecords, in.GetReportId())
 	if err != nil {
-		log.Log.WithError(err).Errorf("Failed to compute credit summary.")
+		requestid.Log(ctx).WithError(err).Errorf("Failed to compute credit summary.")
 		return nil, status.Errorf(codes.InvalidArgument, "failed to compute credit summary")
 	}
 
 	err = s.stripeClient.UpdateUsage(ctx, credits)
 	if err != nil {
-		log.Log.WithError(err).Errorf("Failed to update stripe invoices.")
+		requestid.Log(ctx).WithError(err).Errorf("Failed to update stripe invoices.")
 		return nil, status.Errorf(codes.Internal, "failed to update stripe invoices")
 	}
 
 	return &v1.UpdateInvoicesResponse{}, nil
 }
 
+func (s *BillingService) ReconcileInvoices(ctx context.Context, in *v1.ReconcileInvoicesRequest) (*v1.ReconcileInvoicesResponse, error) {
+	if in.GetFrom() == nil || in.GetTo() == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "From and To must be specified")
+	}
+	from, to := in.GetFrom().AsTime(), in.GetTo().AsTime()
+	if !from.Before(to) {
+		return nil, invalidTimeRangeError("From must be before To")
+	}
+
+	creditsByPeriod, err := s.teamCreditsByBillingPeriod(ctx, from, to)
+	if err != nil {
+		requestid.Log(ctx).WithError(err).Errorf("Failed to compute usage to bill.")
+		return nil, status.Errorf(codes.Internal, "failed to compute usage to bill")
+	}
+
+	for periodStart, credits := range creditsByPeriod {
+		err = s.stripeClient.SetUsageForPeriod(ctx, credits, periodStart)
+		if err != nil {
+			requestid.Log(ctx).WithError(err).WithField("period_start", periodStart).Errorf("Failed to push usage to stripe.")
+			return nil, status.Errorf(codes.Internal, "failed to push usage to stripe")
+		}
+	}
+
+	return &v1.ReconcileInvoicesResponse{}, nil
+}
+
+// teamCreditsByBillingPeriod returns the whole credits each team used in [from, to), by the start of the billing
+// period the credits are billed for. Cost centers with a billing cycle anchor are billed for their own billing period
+// instead, see billingPeriodReference.
+func (s *BillingService) teamCreditsByBillingPeriod(ctx context.Context, from, to time.Time) (map[time.Time]map[string]int64, error) {
+	anchored, err := db.FindCostCentersWithBillingCycleAnchor(ctx, s.conn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve cost centers with billing cycle anchor: %w", err)
+	}
+
+	usage, err := db.GetFinalizedWorkspaceUsageByAttribution(ctx, s.conn, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve finalized usage: %w", err)
+	}
+	for _, costCenter := range anchored {
+		delete(usage, costCenter.ID)
+	}
+	usage, err = withoutCreditGrants(ctx, s.conn, usage, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply credit grants to finalized usage: %w", err)
+	}
+
+	result := map[time.Time]map[string]int64{from.UTC(): creditsForTeams(usage)}
+
+	ref := billingPeriodReference(from, to, time.Now())
+	for period, attributionIDs := range costCentersByBillingPeriod(anchored, ref) {
+		periodUsage, err := db.GetFinalizedWorkspaceUsageByAttribution(ctx, s.conn, period.start, period.end)
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve finalized usage for billing period starting at %s: %w", period.start, err)
+		}
+
+		usageInPeriod := map[db.AttributionID]db.CreditCents{}
+		for _, attributionID := range attributionIDs {
+			usageInPeriod[attributionID] = periodUsage[attributionID]
+		}
+		usageInPeriod, err = withoutCreditGrants(ctx, s.conn, usageInPeriod, period.start, period.end)
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply credit grants to finalized usage for billing period starting at %s: %w", period.start, err)
+		}
+
+		periodStart := period.start.UTC()
+		if result[periodStart] == nil {
+			result[periodStart] = map[string]int64{}
+		}
+		for teamID, credits := range creditsForTeams(usageInPeriod) {
+			result[periodStart][teamID] = credits
+		}
+	}
+	return result, nil
+}
+
+type billingPeriod struct {
+	start, end time.Time
+}
+
+// costCentersByBillingPeriod groups cost centers by their billing period which contains ref.
+func costCentersByBillingPeriod(costCenters []db.CostCenter, ref time.Time) map[billingPeriod][]db.AttributionID {
+	result := map[billingPeriod][]db.AttributionID{}
+	for _, costCenter := range costCenters {
+		start, end := costCenter.BillingPeriodAt(ref)
+		period := billingPeriod{start: start, end: end}
+		result[period] = append(result[period], costCenter.ID)
+	}
+	return result
+}
+
+// billingPeriodReference returns the point in time within [from, to) which determines the billing period of
+// anchored cost centers. Billing periods which have not started yet are never reconciled.
+func billingPeriodReference(from, to, now time.Time) time.Time {
+	ref := to.Add(-time.Nanosecond)
+	if now.Before(ref) {
+		ref = now
+	}
+	if ref.Before(from) {
+		ref = from
+	}
+	return ref
+}
+
 func (s *BillingService) FinalizeInvoice(ctx context.Context, in *v1.FinalizeInvoiceRequest) (*v1.FinalizeInvoiceResponse, error) {
-	logger := log.WithField("invoice_id", in.GetInvoiceId())
+	logger := requestid.Log(ctx).WithField("invoice_id", in.GetInvoiceId())
 
 	if in.GetInvoiceId() == "" {
 		return nil, status.Errorf(codes.InvalidArgument, "Missing InvoiceID")
@@ -133,35 +253,292 @@ func (s *BillingService) FinalizeInvoice(ctx context.Context, in *v1.FinalizeInv
 }
 
 func (s *BillingService) GetUpcomingInvoice(ctx context.Context, in *v1.GetUpcomingInvoiceRequest) (*v1.GetUpcomingInvoiceResponse, error) {
-	if in.GetTeamId() == "" && in.GetUserId() == "" {
-		return nil, status.Errorf(codes.InvalidArgument, "teamId or userId is required")
+	var attributionID db.AttributionID
+	switch {
+	case in.GetTeamId() != "":
+		attributionID = db.NewTeamAttributionID(in.GetTeamId())
+	case in.GetUserId() != "":
+		attributionID = db.NewUserAttributionID(in.GetUserId())
+	case in.GetAttributionId() != "":
+		parsed, err := db.ParseAttributionID(in.GetAttributionId())
+		if err != nil {
+			return nil, invalidAttributionIDError("Invalid attribution ID %q", in.GetAttributionId())
+		}
+		attributionID = parsed
+	default:
+		return nil, invalidAttributionIDError("teamId, userId or attributionId is required")
 	}
+	logger := requestid.Log(ctx).WithField("attribution_id", attributionID)
 
-	var customer *stripesdk.Customer
-	var err error
-	if teamID := in.GetTeamId(); teamID != "" {
-		customer, err = s.stripeClient.GetCustomerByTeamID(ctx, teamID)
-	} else {
-		customer, err = s.stripeClient.GetCustomerByUserID(ctx, in.GetUserId())
-	}
+	customer, err := s.customers.Get(ctx, string(attributionID))
 	if err != nil {
+		if errors.Is(err, stripe.ErrCustomerNotFound) {
+			return nil, errorWithReason(codes.NotFound, ErrorReason_BillingAccountNotFound, map[string]string{"attribution_id": string(attributionID)}, "No Stripe customer found for %s", attributionID)
+		}
 		return nil, status.Errorf(codes.Internal, "failed to find customer")
 	}
 
 	invoice, err := s.stripeClient.GetUpcomingInvoice(ctx, customer.ID)
 	if err != nil {
-		log.Log.WithError(err).Errorf("Failed to fetch upcoming invoice from stripe.")
+		logger.WithError(err).Errorf("Failed to fetch upcoming invoice from stripe.")
 		return nil, status.Errorf(codes.Internal, "failed to fetcht upcoming invoice from stripe")
 	}
 
-	return &v1.GetUpcomingInvoiceResponse{
-		InvoiceId: invoice.ID,
-		Currency:  invoice.Currency,
-		Amount:    float64(invoice.Amount),
-		Credits:   invoice.Credits,
+	ledgerCreditCents, err := db.GetWorkspaceUsageForAttribution(ctx, s.conn, attributionID, invoice.PeriodStart, invoice.PeriodEnd)
+	if err != nil {
+		logger.WithError(err).Errorf("Failed to sum usage for the invoice period.")
+		return nil, status.Errorf(codes.Internal, "failed to sum usage for the invoice period")
+	}
+
+	return upcomingInvoiceToAPI(invoice, ledgerCreditCents, s.taxRates.ForCustomer(customer), s.creditPrices), nil
+}
+
+func upcomingInvoiceToAPI(invoice *stripe.Invoice, ledgerCreditCents db.CreditCents, taxRate float64, creditPrices CreditPrices) *v1.GetUpcomingInvoiceResponse {
+	tax := stripe.Tax(invoice.Amount, taxRate)
+	ledgerAmount, _ := creditPrices.Amount(ledgerCreditCents.ToCredits(), invoice.Currency)
+	response := &v1.GetUpcomingInvoiceResponse{
+		InvoiceId:     invoice.ID,
+		Currency:      invoice.Currency,
+		Amount:        float64(invoice.Amount),
+		Credits:       invoice.Credits,
+		PeriodStart:   timestamppb.New(invoice.PeriodStart),
+		PeriodEnd:     timestamppb.New(invoice.PeriodEnd),
+		LedgerCredits: ledgerCreditCents.ToCredits(),
+		TaxRate:       taxRate,
+		Tax:           float64(tax),
+		Total:         float64(invoice.Amount + tax),
+		LedgerAmount:  float64(ledgerAmount),
+	}
+	if !invoice.DueDate.IsZero() {
+		response.DueDate = timestamppb.New(invoice.DueDate)
+	}
+	for _, line := range invoice.LineItems {
+		response.LineItems = append(response.LineItems, &v1.UpcomingInvoiceLineItem{
+			Description: line.Description,
+			Quantity:    line.Quantity,
+			Amount:      float64(line.Amount),
+			Tax:         float64(stripe.Tax(line.Amount, taxRate)),
+		})
+	}
+	return response
+}
+
+func (s *BillingService) GetStripeCustomer(ctx context.Context, in *v1.GetStripeCustomerRequest) (*v1.GetStripeCustomerResponse, error) {
+	attributionID, err := db.ParseAttributionID(in.GetAttributionId())
+	if err != nil {
+		return nil, invalidAttributionIDError("Invalid attribution ID %q", in.GetAttributionId())
+	}
+
+	customer, err := s.customers.Get(ctx, string(attributionID))
+	if err != nil {
+		if errors.Is(err, stripe.ErrCustomerNotFound) {
+			return nil, errorWithReason(codes.NotFound, ErrorReason_BillingAccountNotFound, map[string]string{"attribution_id": string(attributionID)}, "No Stripe customer found for %s", attributionID)
+		}
+		requestid.Log(ctx).WithError(err).WithField("attribution_id", attributionID).Errorf("Failed to look up Stripe customer.")
+		return nil, status.Errorf(codes.Internal, "failed to look up stripe customer")
+	}
+
+	return &v1.GetStripeCustomerResponse{
+		Customer: &v1.StripeCustomer{
+			Id:       customer.ID,
+			Currency: string(customer.Currency),
+		},
+	}, nil
+}
+
+func (s *BillingService) CreateStripeSubscription(ctx context.Context, in *v1.CreateStripeSubscriptionRequest) (*v1.CreateStripeSubscriptionResponse, error) {
+	attributionID, err := db.ParseAttributionID(in.GetAttributionId())
+	if err != nil {
+		return nil, invalidAttributionIDError("Invalid attribution ID %q", in.GetAttributionId())
+	}
+	if in.GetSetupIntentId() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "Missing setup intent ID")
+	}
+	logger := requestid.Log(ctx).WithField("attribution_id", attributionID)
+
+	customer, err := s.customers.Get(ctx, string(attributionID))
+	if errors.Is(err, stripe.ErrCustomerNotFound) {
+		customer, err = s.stripeClient.CreateCustomer(ctx, stripe.CreateCustomerParams{
+			Metadata: customerMetadata(attributionID),
+			Name:     in.GetCustomerName(),
+			Email:    in.GetCustomerEmail(),
+			Currency: in.GetCurrency(),
+		})
+		s.customers.Invalidate(string(attributionID))
+	}
+	if err != nil {
+		logger.WithError(err).Error("Failed to find or create Stripe customer.")
+		return nil, status.Errorf(codes.Internal, "failed to find or create stripe customer")
+	}
+	logger = logger.WithField("customer_id", customer.ID)
+
+	err = s.stripeClient.SetDefaultPaymentMethodForCustomer(ctx, customer.ID, in.GetSetupIntentId())
+	if err != nil {
+		logger.WithError(err).Error("Failed to set default payment method.")
+		return nil, status.Errorf(codes.InvalidArgument, "failed to set default payment method from setup intent %s", in.GetSetupIntentId())
+	}
+
+	var subscriptionID string
+	if customer.Subscriptions != nil && len(customer.Subscriptions.Data) > 0 {
+		// The customer is already subscribed, for example because a previous attempt failed to update the cost center.
+		subscriptionID = customer.Subscriptions.Data[0].ID
+	} else {
+		priceID, err := stripe.PriceIDForCurrency(s.stripePrices, customer)
+		if err != nil {
+			logger.WithError(err).Error("Failed to select Stripe price.")
+			return nil, status.Errorf(codes.FailedPrecondition, "%s", err.Error())
+		}
+
+		now := time.Now().UTC()
+		startOfNextMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, 1, 0)
+		subscription, err := s.stripeClient.CreateSubscription(ctx, customer.ID, priceID, startOfNextMonth)
+		if err != nil {
+			logger.WithError(err).Error("Failed to create Stripe subscription.")
+			return nil, status.Errorf(codes.Internal, "failed to create stripe subscription")
+		}
+		subscriptionID = subscription.ID
+		s.customers.Invalidate(string(attributionID))
+	}
+
+	_, err = db.SwitchToStripeBilling(ctx, s.conn, attributionID, defaultSpendingLimit, stripe.PreferredCurrency(customer), time.Now(), snapshotBalance(ctx))
+	if err != nil {
+		logger.WithError(err).Error("Failed to switch cost center to Stripe billing.")
+		return nil, status.Errorf(codes.Internal, "failed to switch cost center to stripe billing")
+	}
+
+	return &v1.CreateStripeSubscriptionResponse{
+		Customer: &v1.StripeCustomer{
+			Id:       customer.ID,
+			Currency: string(customer.Currency),
+		},
+		SubscriptionId: subscriptionID,
+	}, nil
+}
+
+func (s *BillingService) VoidUsage(ctx context.Context, in *v1.VoidUsageRequest) (*v1.VoidUsageResponse, error) {
+	usageID, err := uuid.Parse(in.GetUsageId())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid usage ID %q", in.GetUsageId())
+	}
+	if in.GetReason() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "Missing reason")
+	}
+	logger := requestid.Log(ctx).WithField("usage_id", usageID)
+
+	usage, err := db.GetUsage(ctx, s.conn, usageID)
+	if err != nil {
+		if errors.Is(err, db.UsageNotFound) {
+			return nil, status.Errorf(codes.NotFound, "Usage %s not found", usageID)
+		}
+		logger.WithError(err).Error("Failed to get usage.")
+		return nil, status.Errorf(codes.Internal, "failed to get usage")
+	}
+	if usage.Draft {
+		return nil, status.Errorf(codes.FailedPrecondition, "Usage %s is still a draft", usageID)
+	}
+	if usage.Kind != db.WorkspaceInstanceUsageKind || usage.CreditCents <= 0 {
+		return nil, status.Errorf(codes.FailedPrecondition, "Usage %s is not billable workspace usage", usageID)
+	}
+	logger = logger.WithField("attribution_id", usage.AttributionID)
+
+	for _, reversalID := range []uuid.UUID{db.VoidingUsageID(usageID), db.TransferReversalID(usageID)} {
+		_, err = db.GetUsage(ctx, s.conn, reversalID)
+		if err == nil {
+			return nil, status.Errorf(codes.FailedPrecondition, "Usage %s was already voided or transferred", usageID)
+		}
+		if !errors.Is(err, db.UsageNotFound) {
+			logger.WithError(err).Error("Failed to get reversal of usage.")
+			return nil, status.Errorf(codes.Internal, "failed to get usage")
+		}
+	}
+
+	voiding := db.NewVoidingUsage(usage, in.GetReason())
+	// The credit note must only be issued when the voiding entry was stored.
+	err = db.CreateUsage(ctx, s.conn, voiding)
+	if errors.Is(err, db.UsageAlreadyExists) {
+		return nil, status.Errorf(codes.FailedPrecondition, "Usage %s was already voided or transferred", usageID)
+	}
+	if err != nil {
+		logger.WithError(err).Error("Failed to insert voiding usage.")
+		return nil, status.Errorf(codes.Internal, "failed to void usage")
+	}
+	auditChange(ctx, usage.AttributionID, usage, voiding)
+
+	customer, err := s.customers.Get(ctx, string(usage.AttributionID))
+	if errors.Is(err, stripe.ErrCustomerNotFound) {
+		logger.Info("Voided usage of an attribution ID without Stripe customer, no credit note needed.")
+		return &v1.VoidUsageResponse{}, nil
+	}
+	if err != nil {
+		logger.WithError(err).Error("Failed to look up Stripe customer.")
+		return nil, status.Errorf(codes.Internal, "failed to look up stripe customer")
+	}
+
+	credits := int64(math.Ceil(usage.CreditCents.ToCredits()))
+	creditNote, err := s.stripeClient.CreateCreditNoteForUsage(ctx, customer.ID, usage.EffectiveTime.Time(), credits,
+		fmt.Sprintf("Voided usage: %s", in.GetReason()), fmt.Sprintf("credit-note-%s", usage.ID))
+	if errors.Is(err, stripe.ErrInvoiceNotFound) {
+		// the usage was not invoiced yet, the next ReconcileInvoices pushes the reduced usage instead
+		logger.Info("Voided usage which was not invoiced yet, no credit note needed.")
+		return &v1.VoidUsageResponse{}, nil
+	}
+	if err != nil {
+		logger.WithError(err).Error("Failed to create credit note.")
+		return nil, status.Errorf(codes.Internal, "failed to create credit note")
+	}
+
+	logger.WithField("credit_note_id", creditNote.ID).Info("Issued credit note for voided usage.")
+	return &v1.VoidUsageResponse{
+		CreditNoteId: creditNote.ID,
 	}, nil
 }
 
+// snapshotBalance computes the balance of a cost center in the billing period which is closed out when it switches to
+// Stripe billing.
+func snapshotBalance(ctx context.Context) db.BalanceSnapshotFunc {
+	return func(tx *gorm.DB, costCenter db.CostCenter, periodStart, switchTime time.Time) (db.BillingStrategyTransition, error) {
+		used, err := db.GetWorkspaceUsageForAttribution(ctx, tx, costCenter.ID, periodStart, switchTime)
+		if err != nil {
+			return db.BillingStrategyTransition{}, err
+		}
+		grants, err := allocateCreditGrants(ctx, tx, costCenter.ID, switchTime)
+		if err != nil {
+			return db.BillingStrategyTransition{}, fmt.Errorf("failed to allocate credit grants: %w", err)
+		}
+		return db.BillingStrategyTransition{
+			CreditsUsed:             used,
+			CreditsCovered:          grants.covered(periodStart, switchTime, false),
+			CreditsGrantedRemaining: grants.remaining(switchTime),
+		}, nil
+	}
+}
+
+// defaultSpendingLimit is the spending limit, in credits, of cost centers created when subscribing to Stripe.
+const defaultSpendingLimit = 100
+
+func customerMetadata(attributionID db.AttributionID) map[string]string {
+	entity, id := attributionID.Values()
+	if entity == db.AttributionEntity_User {
+		return map[string]string{stripe.UserIDMetadataKey: id}
+	}
+	return map[string]string{stripe.TeamIDMetadataKey: id}
+}
+
+// customerByAttributionID looks up Stripe customers by the team or user of an attribution ID.
+func customerByAttributionID(stripeClient *stripe.Client) stripe.CustomerLookupFunc {
+	return func(ctx context.Context, key string) (*stripesdk.Customer, error) {
+		entity, id := db.AttributionID(key).Values()
+		switch entity {
+		case db.AttributionEntity_Team:
+			return stripeClient.GetCustomerByTeamID(ctx, id)
+		case db.AttributionEntity_User:
+			return stripeClient.GetCustomerByUserID(ctx, id)
+		default:
+			return nil, fmt.Errorf("unknown attribution entity %q", entity)
+		}
+	}
+}
+
 func (s *BillingService) creditSummaryForTeams(sessions []db.WorkspaceInstanceUsage, reportID string) (map[string]stripe.CreditSummary, error) {
 	creditsPerTeamID := map[string]float64{}
 
@@ -193,6 +570,21 @@ func (s *BillingService) creditSummaryForTeams(sessions []db.WorkspaceInstanceUs
 	return rounded, nil
 }
 
+// creditsForTeams converts finalized usage into whole credits per team. Credits are rounded up, consistent with
+// creditSummaryForTeams.
+func creditsForTeams(usage map[db.AttributionID]db.CreditCents) map[string]int64 {
+	credits := map[string]int64{}
+	for attributionID, creditCents := range usage {
+		entity, id := attributionID.Values()
+		if entity != db.AttributionEntity_Team {
+			continue
+		}
+
+		credits[id] = int64(math.Ceil(creditCents.ToCredits()))
+	}
+	return credits
+}
+
 func (s *BillingService) SetBilledSession(ctx context.Context, in *v1.SetBilledSessionRequest) (*v1.SetBilledSessionResponse, error) {
 	var from time.Time
 	if in.From != nil {
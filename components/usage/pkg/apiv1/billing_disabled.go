@@ -0,0 +1,64 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"context"
+
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"google.golang.org/grpc/codes"
+)
+
+var errBillingDisabled = errorWithReason(codes.Unimplemented, ErrorReason_BillingDisabled, nil, "Billing is disabled in this installation. Usage is tracked, but not billed through a payment provider.")
+
+// BillingServiceDisabled is used for installations which track usage without a payment provider. Unlike
+// BillingServiceNoop, every RPC fails with Unimplemented, such that callers can tell that billing is not available.
+type BillingServiceDisabled struct {
+	v1.UnimplementedBillingServiceServer
+}
+
+func (s *BillingServiceDisabled) UpdateInvoices(context.Context, *v1.UpdateInvoicesRequest) (*v1.UpdateInvoicesResponse, error) {
+	return nil, errBillingDisabled
+}
+
+func (s *BillingServiceDisabled) GetUpcomingInvoice(context.Context, *v1.GetUpcomingInvoiceRequest) (*v1.GetUpcomingInvoiceResponse, error) {
+	return nil, errBillingDisabled
+}
+
+func (s *BillingServiceDisabled) FinalizeInvoice(context.Context, *v1.FinalizeInvoiceRequest) (*v1.FinalizeInvoiceResponse, error) {
+	return nil, errBillingDisabled
+}
+
+func (s *BillingServiceDisabled) SetBilledSession(context.Context, *v1.SetBilledSessionRequest) (*v1.SetBilledSessionResponse, error) {
+	return nil, errBillingDisabled
+}
+
+func (s *BillingServiceDisabled) ReconcileInvoices(context.Context, *v1.ReconcileInvoicesRequest) (*v1.ReconcileInvoicesResponse, error) {
+	return nil, errBillingDisabled
+}
+
+func (s *BillingServiceDisabled) GetStripeCustomer(context.Context, *v1.GetStripeCustomerRequest) (*v1.GetStripeCustomerResponse, error) {
+	return nil, errBillingDisabled
+}
+
+func (s *BillingServiceDisabled) CreateStripeSubscription(context.Context, *v1.CreateStripeSubscriptionRequest) (*v1.CreateStripeSubscriptionResponse, error) {
+	return nil, errBillingDisabled
+}
+
+func (s *BillingServiceDisabled) VoidUsage(context.Context, *v1.VoidUsageRequest) (*v1.VoidUsageResponse, error) {
+	return nil, errBillingDisabled
+}
+
+func (s *BillingServiceDisabled) ReconcileLedgerWithInvoices(context.Context, *v1.ReconcileLedgerWithInvoicesRequest) (*v1.ReconcileLedgerWithInvoicesResponse, error) {
+	return nil, errBillingDisabled
+}
+
+func (s *BillingServiceDisabled) ListBillingDrift(context.Context, *v1.ListBillingDriftRequest) (*v1.ListBillingDriftResponse, error) {
+	return nil, errBillingDisabled
+}
+
+func (s *BillingServiceDisabled) PurchaseCredits(context.Context, *v1.PurchaseCreditsRequest) (*v1.PurchaseCreditsResponse, error) {
+	return nil, errBillingDisabled
+}
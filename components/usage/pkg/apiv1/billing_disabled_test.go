@@ -0,0 +1,36 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"context"
+	"testing"
+
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestBillingServiceDisabled(t *testing.T) {
+	ctx := context.Background()
+	svc := &BillingServiceDisabled{}
+
+	_, err := svc.GetUpcomingInvoice(ctx, &v1.GetUpcomingInvoiceRequest{})
+	require.Equal(t, codes.Unimplemented, status.Code(err))
+	require.Contains(t, status.Convert(err).Message(), "Billing is disabled")
+
+	_, err = svc.CreateStripeSubscription(ctx, &v1.CreateStripeSubscriptionRequest{})
+	require.Equal(t, codes.Unimplemented, status.Code(err))
+
+	_, err = svc.ReconcileInvoices(ctx, &v1.ReconcileInvoicesRequest{})
+	require.Equal(t, codes.Unimplemented, status.Code(err))
+
+	_, err = svc.ListBillingDrift(ctx, &v1.ListBillingDriftRequest{})
+	require.Equal(t, codes.Unimplemented, status.Code(err))
+
+	_, err = svc.PurchaseCredits(ctx, &v1.PurchaseCreditsRequest{})
+	require.Equal(t, codes.Unimplemented, status.Code(err))
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/requestid"
+	"github.com/gitpod-io/gitpod/usage/pkg/stripe"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func (s *BillingService) ListBillingDrift(ctx context.Context, in *v1.ListBillingDriftRequest) (*v1.ListBillingDriftResponse, error) {
+	if in.GetFrom() == nil || in.GetTo() == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "From and To must be specified")
+	}
+	from, to := in.GetFrom().AsTime(), in.GetTo().AsTime()
+	if !from.Before(to) {
+		return nil, invalidTimeRangeError("From must be before To")
+	}
+
+	logger := requestid.Log(ctx).WithField("from", from).WithField("to", to)
+
+	// The ledger is compared with what ReconcileInvoices reports for the same period.
+	creditsByPeriod, err := s.teamCreditsByBillingPeriod(ctx, from, to)
+	if err != nil {
+		logger.WithError(err).Error("Failed to compute billed usage.")
+		return nil, status.Errorf(codes.Internal, "failed to compute billed usage")
+	}
+
+	resp := &v1.ListBillingDriftResponse{}
+	for periodStart, credits := range creditsByPeriod {
+		teamIDs := make([]string, 0, len(credits))
+		for teamID := range credits {
+			teamIDs = append(teamIDs, teamID)
+		}
+		if len(teamIDs) == 0 {
+			continue
+		}
+
+		reported, err := s.stripeClient.GetUsageForPeriod(ctx, teamIDs, periodStart)
+		if err != nil {
+			logger.WithError(err).WithField("period_start", periodStart).Error("Failed to get usage reported to stripe.")
+			return nil, status.Errorf(codes.Internal, "failed to get usage reported to stripe")
+		}
+
+		checked, mismatches := billingDrift(periodStart, credits, reported)
+		resp.CheckedAttributionIds += int32(checked)
+		resp.Mismatches = append(resp.Mismatches, mismatches...)
+	}
+	sort.Slice(resp.Mismatches, func(i, j int) bool {
+		return resp.Mismatches[i].GetAttributionId() < resp.Mismatches[j].GetAttributionId()
+	})
+
+	for _, mismatch := range resp.Mismatches {
+		logger.
+			WithField("attribution_id", mismatch.AttributionId).
+			WithField("customer_id", mismatch.CustomerId).
+			WithField("period_start", mismatch.PeriodStart.AsTime()).
+			WithField("ledger_credits", mismatch.LedgerCredits).
+			WithField("reported_credits", mismatch.ReportedCredits).
+			Warn("Usage reported to stripe does not match the ledger.")
+	}
+
+	return resp, nil
+}
+
+// billingDrift compares the credits of each team in the ledger with the usage reported for the billing period. Teams
+// without a Stripe customer are not billed through Stripe, and are not compared.
+func billingDrift(periodStart time.Time, ledgerCredits map[string]int64, reported map[string]stripe.ReportedUsage) (int, []*v1.BillingDrift) {
+	checked := 0
+	var mismatches []*v1.BillingDrift
+	for teamID, credits := range ledgerCredits {
+		usage, ok := reported[teamID]
+		if !ok {
+			continue
+		}
+		checked++
+
+		if usage.Credits == credits {
+			continue
+		}
+		mismatches = append(mismatches, &v1.BillingDrift{
+			AttributionId:   string(db.NewTeamAttributionID(teamID)),
+			CustomerId:      usage.CustomerID,
+			PeriodStart:     timestamppb.New(periodStart),
+			LedgerCredits:   credits,
+			ReportedCredits: usage.Credits,
+		})
+	}
+	return checked, mismatches
+}
@@ -0,0 +1,39 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"testing"
+	"time"
+
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/stripe"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestBillingDrift(t *testing.T) {
+	periodStart := time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)
+	ledger := map[string]int64{
+		"team-in-sync":     100,
+		"team-underbilled": 250,
+		"team-no-customer": 80,
+	}
+	reported := map[string]stripe.ReportedUsage{
+		"team-in-sync":     {CustomerID: "cus_1", Credits: 100},
+		"team-underbilled": {CustomerID: "cus_2", Credits: 200},
+	}
+
+	checked, mismatches := billingDrift(periodStart, ledger, reported)
+	require.Equal(t, 2, checked, "teams without a customer are not billed through stripe")
+	require.Equal(t, []*v1.BillingDrift{{
+		AttributionId:   string(db.NewTeamAttributionID("team-underbilled")),
+		CustomerId:      "cus_2",
+		PeriodStart:     timestamppb.New(periodStart),
+		LedgerCredits:   250,
+		ReportedCredits: 200,
+	}}, mismatches)
+}
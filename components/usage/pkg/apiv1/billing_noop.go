@@ -19,3 +19,18 @@ func (s *BillingServiceNoop) UpdateInvoices(_ context.Context, _ *v1.UpdateInvoi
 	log.Log.Infof("UpdateInvoices RPC invoked in no-op mode, no invoices will be updated.")
 	return &v1.UpdateInvoicesResponse{}, nil
 }
+
+func (s *BillingServiceNoop) ReconcileInvoices(_ context.Context, _ *v1.ReconcileInvoicesRequest) (*v1.ReconcileInvoicesResponse, error) {
+	log.Log.Infof("ReconcileInvoices RPC invoked in no-op mode, no usage will be pushed to Stripe.")
+	return &v1.ReconcileInvoicesResponse{}, nil
+}
+
+func (s *BillingServiceNoop) ReconcileLedgerWithInvoices(_ context.Context, _ *v1.ReconcileLedgerWithInvoicesRequest) (*v1.ReconcileLedgerWithInvoicesResponse, error) {
+	log.Log.Infof("ReconcileLedgerWithInvoices RPC invoked in no-op mode, no invoices will be reconciled.")
+	return &v1.ReconcileLedgerWithInvoicesResponse{}, nil
+}
+
+func (s *BillingServiceNoop) ListBillingDrift(_ context.Context, _ *v1.ListBillingDriftRequest) (*v1.ListBillingDriftResponse, error) {
+	log.Log.Infof("ListBillingDrift RPC invoked in no-op mode, no usage is reported to Stripe.")
+	return &v1.ListBillingDriftResponse{}, nil
+}
@@ -5,13 +5,19 @@
 package apiv1
 
 import (
+	"context"
 	"testing"
 	"time"
 
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
 	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/db/dbtest"
 	"github.com/gitpod-io/gitpod/usage/pkg/stripe"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/require"
+	stripesdk "github.com/stripe/stripe-go/v72"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"gorm.io/gorm"
 )
 
@@ -120,10 +126,133 @@ func TestCreditSummaryForTeams(t *testing.T) {
 
 	for _, s := range scenarios {
 		t.Run(s.Name, func(t *testing.T) {
-			svc := NewBillingService(&stripe.Client{}, s.BillSessionsAfter, &gorm.DB{}, nil)
+			svc := NewBillingService(&stripe.Client{}, s.BillSessionsAfter, &gorm.DB{}, nil, nil, nil, nil, nil)
 			actual, err := svc.creditSummaryForTeams(s.Sessions, reportID)
 			require.NoError(t, err)
 			require.Equal(t, s.Expected, actual)
 		})
 	}
 }
+
+func TestCreditsForTeams(t *testing.T) {
+	teamID_A, teamID_B := uuid.New().String(), uuid.New().String()
+
+	credits := creditsForTeams(map[db.AttributionID]db.CreditCents{
+		db.NewTeamAttributionID(teamID_A):            48000,
+		db.NewTeamAttributionID(teamID_B):            1001,
+		db.NewUserAttributionID(uuid.New().String()): 500,
+	})
+
+	require.Equal(t, map[string]int64{
+		teamID_A: 480,
+		// partial credits are rounded up
+		teamID_B: 11,
+	}, credits)
+}
+
+func TestCostCentersByBillingPeriod(t *testing.T) {
+	teamA := db.NewTeamAttributionID(uuid.New().String())
+	teamB := db.NewTeamAttributionID(uuid.New().String())
+	teamC := db.NewTeamAttributionID(uuid.New().String())
+
+	periods := costCentersByBillingPeriod([]db.CostCenter{
+		{ID: teamA, BillingCycleAnchor: db.NewVarcharTime(time.Date(2022, 1, 15, 0, 0, 0, 0, time.UTC))},
+		{ID: teamB, BillingCycleAnchor: db.NewVarcharTime(time.Date(2022, 3, 15, 0, 0, 0, 0, time.UTC))},
+		{ID: teamC, BillingCycleAnchor: db.NewVarcharTime(time.Date(2022, 5, 3, 0, 0, 0, 0, time.UTC))},
+	}, time.Date(2022, 9, 20, 0, 0, 0, 0, time.UTC))
+
+	require.Equal(t, map[billingPeriod][]db.AttributionID{
+		{start: time.Date(2022, 9, 15, 0, 0, 0, 0, time.UTC), end: time.Date(2022, 10, 15, 0, 0, 0, 0, time.UTC)}: {teamA, teamB},
+		{start: time.Date(2022, 9, 3, 0, 0, 0, 0, time.UTC), end: time.Date(2022, 10, 3, 0, 0, 0, 0, time.UTC)}:   {teamC},
+	}, periods)
+}
+
+func TestBillingPeriodReference(t *testing.T) {
+	from := time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	now := time.Date(2022, 9, 12, 0, 0, 0, 0, time.UTC)
+	require.Equal(t, now, billingPeriodReference(from, to, now))
+	require.Equal(t, to.Add(-time.Nanosecond), billingPeriodReference(from, to, time.Date(2022, 10, 2, 0, 0, 0, 0, time.UTC)))
+	require.Equal(t, from, billingPeriodReference(from, to, time.Date(2022, 8, 2, 0, 0, 0, 0, time.UTC)))
+}
+
+func TestGetStripeCustomer(t *testing.T) {
+	teamAttributionID := db.NewTeamAttributionID(uuid.New().String())
+	lookups := 0
+	s := &BillingService{
+		customers: stripe.NewCustomerCache(func(ctx context.Context, key string) (*stripesdk.Customer, error) {
+			lookups++
+			if key == string(teamAttributionID) {
+				return &stripesdk.Customer{ID: "cus_123", Currency: stripesdk.CurrencyEUR}, nil
+			}
+			return nil, stripe.ErrCustomerNotFound
+		}, time.Minute, time.Minute),
+	}
+
+	for i := 0; i < 2; i++ {
+		resp, err := s.GetStripeCustomer(context.Background(), &v1.GetStripeCustomerRequest{AttributionId: string(teamAttributionID)})
+		require.NoError(t, err)
+		require.Equal(t, "cus_123", resp.GetCustomer().GetId())
+		require.Equal(t, "eur", resp.GetCustomer().GetCurrency())
+
+		_, err = s.GetStripeCustomer(context.Background(), &v1.GetStripeCustomerRequest{AttributionId: string(db.NewUserAttributionID(uuid.New().String()))})
+		require.Equal(t, codes.NotFound, status.Code(err))
+	}
+	require.Equal(t, 3, lookups, "repeated lookups of the same customer must be cached")
+
+	_, err := s.GetStripeCustomer(context.Background(), &v1.GetStripeCustomerRequest{AttributionId: "invalid"})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestUpcomingInvoiceToAPI(t *testing.T) {
+	periodStart := time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC)
+	periodEnd := periodStart.AddDate(0, 1, 0)
+
+	response := upcomingInvoiceToAPI(&stripe.Invoice{
+		ID:       "in_123",
+		Currency: "eur",
+		Amount:   4800,
+		Credits:  480,
+		LineItems: []stripe.InvoiceLineItem{
+			{Description: "480 credits", Quantity: 480, Amount: 4800},
+		},
+		DueDate:     periodEnd.Add(time.Hour),
+		PeriodStart: periodStart,
+		PeriodEnd:   periodEnd,
+	}, 51234, 19, CreditPrices{"EUR": 10})
+
+	require.Equal(t, "in_123", response.GetInvoiceId())
+	require.Equal(t, float64(4800), response.GetAmount())
+	require.Equal(t, periodEnd.Add(time.Hour), response.GetDueDate().AsTime())
+	require.Equal(t, periodStart, response.GetPeriodStart().AsTime())
+	require.Equal(t, periodEnd, response.GetPeriodEnd().AsTime())
+	require.Equal(t, 512.34, response.GetLedgerCredits())
+	require.Equal(t, float64(5123), response.GetLedgerAmount(), "must convert ledger credits to the invoice currency")
+	require.Len(t, response.GetLineItems(), 1)
+	require.EqualValues(t, 480, response.GetLineItems()[0].GetQuantity())
+	require.Equal(t, float64(19), response.GetTaxRate())
+	require.Equal(t, float64(912), response.GetTax())
+	require.Equal(t, float64(5712), response.GetTotal())
+	require.Equal(t, float64(912), response.GetLineItems()[0].GetTax())
+
+	untaxed := upcomingInvoiceToAPI(&stripe.Invoice{Amount: 4800}, 0, 0, nil)
+	require.Equal(t, float64(0), untaxed.GetTax())
+	require.Equal(t, float64(4800), untaxed.GetTotal())
+
+	require.Nil(t, upcomingInvoiceToAPI(&stripe.Invoice{}, 0, 0, nil).GetDueDate(), "invoices without due date have no due date")
+}
+
+func TestVoidUsage_AlreadyVoided(t *testing.T) {
+	conn := dbtest.ConnectInMemoryForTests(t)
+	svc := NewBillingService(&stripe.Client{}, time.Time{}, conn, nil, nil, nil, nil, nil)
+
+	usage := dbtest.CreateUsageRecords(t, conn, dbtest.NewUsage(t, db.Usage{
+		CreditCents:   100,
+		EffectiveTime: db.NewVarcharTime(time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC)),
+	}))[0]
+	dbtest.CreateUsageRecords(t, conn, db.NewVoidingUsage(usage, "refund"))
+
+	_, err := svc.VoidUsage(context.Background(), &v1.VoidUsageRequest{UsageId: usage.ID.String(), Reason: "refund"})
+	require.Equal(t, codes.FailedPrecondition, status.Code(err), "must not void usage twice")
+}
@@ -0,0 +1,132 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/requestid"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+// ledgerBalance returns the balance of the attribution ID in the billing period [periodStart, periodEnd). The cached
+// balance is used while no ledger entries of the attribution ID were written since it was computed, otherwise the
+// balance is computed from the ledger and cached.
+func (s *UsageService) ledgerBalance(ctx context.Context, attributionId db.AttributionID, periodStart, periodEnd, now time.Time) (db.CachedBalance, error) {
+	cached, err := db.GetCachedBalance(ctx, s.conn, attributionId)
+	if err != nil && !errors.Is(err, db.CachedBalanceNotFound) {
+		return db.CachedBalance{}, err
+	}
+	if err == nil && cached.ValidAt(periodStart, now) {
+		return cached, nil
+	}
+
+	computed, err := computeLedgerBalance(ctx, s.conn, attributionId, periodStart, periodEnd, now)
+	if err != nil {
+		return db.CachedBalance{}, err
+	}
+	// The ledger is read after the version, such that the balance is not stored when the ledger was written since.
+	computed.Version = cached.Version
+	_, err = db.StoreCachedBalance(ctx, s.conn, computed)
+	if err != nil {
+		// The computed balance is correct regardless, it is computed again next time.
+		requestid.Log(ctx).WithError(err).WithField("attribution_id", attributionId).Warn("Failed to cache balance.")
+	}
+	return computed, nil
+}
+
+// computeLedgerBalance aggregates the ledger of the attribution ID for the billing period [periodStart, periodEnd).
+func computeLedgerBalance(ctx context.Context, conn *gorm.DB, attributionId db.AttributionID, periodStart, periodEnd, now time.Time) (db.CachedBalance, error) {
+	creditsUsed, err := db.GetWorkspaceUsageForAttribution(ctx, conn, attributionId, periodStart, periodEnd)
+	if err != nil {
+		return db.CachedBalance{}, fmt.Errorf("failed to get usage in billing period: %w", err)
+	}
+
+	// Usage consumes credit grants first, only the remaining usage counts towards the spending limit.
+	grants, err := allocateCreditGrants(ctx, conn, attributionId, periodEnd)
+	if err != nil {
+		return db.CachedBalance{}, fmt.Errorf("failed to allocate credit grants: %w", err)
+	}
+	creditsCovered := grants.covered(periodStart, periodEnd, false)
+
+	return db.CachedBalance{
+		AttributionID:           attributionId,
+		BillingPeriodStart:      db.NewVarcharTime(periodStart),
+		ValidUntil:              db.NewVarcharTime(grants.nextChange(now, periodEnd)),
+		CreditsUsed:             creditsUsed - creditsCovered,
+		CreditsCovered:          creditsCovered,
+		CreditsGrantedRemaining: grants.remaining(now),
+	}, nil
+}
+
+// CheckCachedBalances compares every valid cached balance with the balance computed from the ledger. Cached balances
+// which do not match are reported and invalidated, such that they are computed again on the next read.
+func (s *UsageService) CheckCachedBalances(ctx context.Context, in *v1.CheckCachedBalancesRequest) (*v1.CheckCachedBalancesResponse, error) {
+	cachedBalances, err := db.ListCachedBalances(ctx, s.conn)
+	if err != nil {
+		requestid.Log(ctx).WithError(err).Error("Failed to list cached balances.")
+		return nil, status.Errorf(codes.Internal, "Failed to list cached balances")
+	}
+
+	now := s.nowFunc()
+	mismatches := newRecordLogSampler(s.logSampling, requestid.Log(ctx), logrus.WarnLevel, "Cached balance does not match the ledger, invalidating it.")
+	defer mismatches.Close()
+
+	resp := &v1.CheckCachedBalancesResponse{}
+	for _, cached := range cachedBalances {
+		logger := requestid.Log(ctx).WithField("attribution_id", cached.AttributionID)
+
+		costCenter, err := db.GetCostCenter(ctx, s.conn, cached.AttributionID)
+		if errors.Is(err, db.CostCenterNotFound) {
+			continue
+		}
+		if err != nil {
+			logger.WithError(err).Error("Failed to get cost center.")
+			return nil, status.Errorf(codes.Internal, "Failed to get cost center of %s", cached.AttributionID)
+		}
+
+		periodStart, periodEnd := costCenter.BillingPeriodAt(now)
+		if !cached.ValidAt(periodStart, now) {
+			continue
+		}
+		resp.Checked++
+
+		computed, err := computeLedgerBalance(ctx, s.conn, cached.AttributionID, periodStart, periodEnd, now)
+		if err != nil {
+			logger.WithError(err).Error("Failed to compute balance from ledger.")
+			return nil, status.Errorf(codes.Internal, "Failed to compute balance of %s", cached.AttributionID)
+		}
+		if computed.CreditsUsed == cached.CreditsUsed &&
+			computed.CreditsCovered == cached.CreditsCovered &&
+			computed.CreditsGrantedRemaining == cached.CreditsGrantedRemaining {
+			continue
+		}
+
+		mismatches.Log(logger.
+			WithField("cached_credits_used", cached.CreditsUsed.ToCredits()).
+			WithField("computed_credits_used", computed.CreditsUsed.ToCredits()).
+			WithField("cached_credits_covered", cached.CreditsCovered.ToCredits()).
+			WithField("computed_credits_covered", computed.CreditsCovered.ToCredits()).
+			WithField("cached_credits_granted_remaining", cached.CreditsGrantedRemaining.ToCredits()).
+			WithField("computed_credits_granted_remaining", computed.CreditsGrantedRemaining.ToCredits()),
+			cached.AttributionID)
+		err = db.InvalidateCachedBalances(ctx, s.conn, cached.AttributionID)
+		if err != nil {
+			logger.WithError(err).Error("Failed to invalidate cached balance.")
+			return nil, status.Errorf(codes.Internal, "Failed to invalidate cached balance of %s", cached.AttributionID)
+		}
+		resp.MismatchedAttributionIds = append(resp.MismatchedAttributionIds, string(cached.AttributionID))
+	}
+
+	return resp, nil
+}
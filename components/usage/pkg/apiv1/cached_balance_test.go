@@ -0,0 +1,83 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/db/dbtest"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreditGrants_NextChange(t *testing.T) {
+	now := time.Date(2022, 10, 15, 0, 0, 0, 0, time.UTC)
+	periodEnd := time.Date(2022, 11, 1, 0, 0, 0, 0, time.UTC)
+	team := db.NewTeamAttributionID(uuid.New().String())
+
+	active, err := db.NewCreditGrant(team, 10, "active", now.AddDate(0, 0, -1), now.AddDate(0, 0, 5))
+	require.NoError(t, err)
+	future, err := db.NewCreditGrant(team, 10, "future", now.AddDate(0, 0, 2), periodEnd.AddDate(0, 1, 0))
+	require.NoError(t, err)
+
+	require.Equal(t, periodEnd, creditGrants{}.nextChange(now, periodEnd))
+	require.Equal(t, now.AddDate(0, 0, 5), creditGrants{grants: []db.CreditGrant{active}}.nextChange(now, periodEnd))
+	require.Equal(t, now.AddDate(0, 0, 2), creditGrants{grants: []db.CreditGrant{active, future}}.nextChange(now, periodEnd))
+}
+
+func TestGetBalance_UsesCachedBalanceUntilLedgerWrites(t *testing.T) {
+	conn := dbtest.ConnectForTests(t)
+	ctx := context.Background()
+	attributionID := db.NewTeamAttributionID(uuid.New().String())
+	now := time.Date(2022, 10, 15, 0, 0, 0, 0, time.UTC)
+	t.Cleanup(func() {
+		require.NoError(t, conn.Where("attributionId = ?", attributionID).Delete(&db.CachedBalance{}).Error)
+	})
+
+	dbtest.CreateCostCenters(t, conn, db.CostCenter{ID: attributionID, SpendingLimit: 100})
+	dbtest.CreateUsageRecords(t, conn, dbtest.NewUsage(t, db.Usage{
+		AttributionID: attributionID,
+		CreditCents:   db.NewCreditCents(20),
+		EffectiveTime: db.NewVarcharTime(now.Add(-time.Hour)),
+	}))
+
+	service := NewUsageService(conn, nil, nil, DefaultWorkspacePricer, nil, SpendingLimitGraceMargin{}, nil, DefaultDunningPeriods, DefaultDeletedUsageRetention, nil, LogSamplingConfig{}, nil, nil, nil, nil, nil, nil)
+	service.nowFunc = func() time.Time { return now }
+
+	resp, err := service.GetBalance(ctx, &v1.GetBalanceRequest{AttributionId: string(attributionID)})
+	require.NoError(t, err)
+	require.Equal(t, float64(20), resp.GetCreditsUsed())
+
+	// Corrupt the cached balance, to tell whether it is used.
+	require.NoError(t, conn.Model(&db.CachedBalance{}).Where("attributionId = ?", attributionID).Update("creditsUsed", 9900).Error)
+	resp, err = service.GetBalance(ctx, &v1.GetBalanceRequest{AttributionId: string(attributionID)})
+	require.NoError(t, err)
+	require.Equal(t, float64(99), resp.GetCreditsUsed(), "must use the cached balance")
+
+	check, err := service.CheckCachedBalances(ctx, &v1.CheckCachedBalancesRequest{})
+	require.NoError(t, err)
+	require.Contains(t, check.GetMismatchedAttributionIds(), string(attributionID))
+
+	resp, err = service.GetBalance(ctx, &v1.GetBalanceRequest{AttributionId: string(attributionID)})
+	require.NoError(t, err)
+	require.Equal(t, float64(20), resp.GetCreditsUsed(), "must compute mismatched balances again")
+
+	dbtest.CreateUsageRecords(t, conn, dbtest.NewUsage(t, db.Usage{
+		AttributionID: attributionID,
+		CreditCents:   db.NewCreditCents(10),
+		EffectiveTime: db.NewVarcharTime(now.Add(-time.Minute)),
+	}))
+	resp, err = service.GetBalance(ctx, &v1.GetBalanceRequest{AttributionId: string(attributionID)})
+	require.NoError(t, err)
+	require.Equal(t, float64(30), resp.GetCreditsUsed(), "ledger writes must invalidate the cached balance")
+
+	check, err = service.CheckCachedBalances(ctx, &v1.CheckCachedBalancesRequest{})
+	require.NoError(t, err)
+	require.NotContains(t, check.GetMismatchedAttributionIds(), string(attributionID))
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"context"
+	"errors"
+
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/requestid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *UsageService) SetCostCenterSplits(ctx context.Context, in *v1.SetCostCenterSplitsRequest) (*v1.SetCostCenterSplitsResponse, error) {
+	attributionId, err := db.ParseAttributionID(in.GetAttributionId())
+	if err != nil {
+		return nil, invalidAttributionIDError("Failed to parse attribution ID: %s", err.Error())
+	}
+	splits, err := costCenterSplitsFromAPI(attributionId, in.GetSplits())
+	if err != nil {
+		return nil, err
+	}
+
+	costCenter, err := db.GetCostCenter(ctx, s.conn, attributionId)
+	if err != nil {
+		if errors.Is(err, db.CostCenterNotFound) {
+			return nil, attributionNotFoundError(attributionId, err)
+		}
+		return nil, status.Errorf(codes.Internal, "Failed to get cost center %s from DB: %s", attributionId, err.Error())
+	}
+
+	logger := requestid.Log(ctx).WithField("attribution_id", attributionId)
+	previous, err := db.FindCostCenterSplitsByAttributionIDs(ctx, s.conn, []db.AttributionID{attributionId})
+	if err != nil {
+		logger.WithError(err).Error("Failed to find cost center splits.")
+		return nil, status.Errorf(codes.Internal, "Failed to find splits of %s", attributionId)
+	}
+
+	err = db.SetCostCenterSplits(ctx, s.conn, attributionId, splits)
+	if err != nil {
+		logger.WithError(err).Error("Failed to set cost center splits.")
+		return nil, status.Errorf(codes.Internal, "Failed to set splits of %s", attributionId)
+	}
+	logger.WithField("splits", len(splits)).Info("Set cost center splits.")
+	auditChange(ctx, attributionId, previous[attributionId], splits)
+
+	result, err := s.costCenterToAPI(ctx, costCenter)
+	if err != nil {
+		logger.WithError(err).Error("Failed to get usage of cost center.")
+		return nil, status.Errorf(codes.Internal, "Failed to get usage in billing period of cost center %s", attributionId)
+	}
+	return &v1.SetCostCenterSplitsResponse{CostCenter: result}, nil
+}
+
+// costCenterSplitsFromAPI validates the splits of the attribution ID. Every target must be charged a positive share,
+// at most once, and the shares must not exceed the whole usage.
+func costCenterSplitsFromAPI(attributionId db.AttributionID, in []*v1.CostCenterSplit) ([]db.CostCenterSplit, error) {
+	var splits []db.CostCenterSplit
+	var total int32
+	seen := map[db.AttributionID]bool{}
+	for _, split := range in {
+		target, err := db.ParseAttributionID(split.GetTargetAttributionId())
+		if err != nil {
+			return nil, invalidAttributionIDError("Failed to parse target attribution ID: %s", err.Error())
+		}
+		if target == attributionId {
+			return nil, status.Errorf(codes.InvalidArgument, "Cost center cannot be split with itself")
+		}
+		if seen[target] {
+			return nil, status.Errorf(codes.InvalidArgument, "Target %s must only be specified once", target)
+		}
+		seen[target] = true
+		if split.GetPercentage() <= 0 || split.GetPercentage() > 100 {
+			return nil, status.Errorf(codes.InvalidArgument, "Percentage must be between 1 and 100")
+		}
+		total += split.GetPercentage()
+		splits = append(splits, db.CostCenterSplit{
+			AttributionID:       attributionId,
+			TargetAttributionID: target,
+			Percentage:          split.GetPercentage(),
+		})
+	}
+	if total > 100 {
+		return nil, errorWithReason(codes.InvalidArgument, ErrorReason_LimitExceeded, map[string]string{"limit": "100"}, "Percentages of all splits must not exceed 100 (was %d)", total)
+	}
+	return splits, nil
+}
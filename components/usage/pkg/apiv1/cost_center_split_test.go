@@ -0,0 +1,90 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"testing"
+
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCostCenterSplitsFromAPI(t *testing.T) {
+	attributionID := db.NewTeamAttributionID(uuid.New().String())
+	platform := string(db.NewTeamAttributionID(uuid.New().String()))
+	other := string(db.NewTeamAttributionID(uuid.New().String()))
+
+	scenarios := []struct {
+		Name   string
+		Splits []*v1.CostCenterSplit
+		Valid  bool
+	}{
+		{
+			Name:  "no splits",
+			Valid: true,
+		},
+		{
+			Name:   "splits up to 100 percent",
+			Splits: []*v1.CostCenterSplit{{TargetAttributionId: platform, Percentage: 50}, {TargetAttributionId: other, Percentage: 50}},
+			Valid:  true,
+		},
+		{
+			Name:   "splits exceeding 100 percent",
+			Splits: []*v1.CostCenterSplit{{TargetAttributionId: platform, Percentage: 60}, {TargetAttributionId: other, Percentage: 50}},
+		},
+		{
+			Name:   "split without percentage",
+			Splits: []*v1.CostCenterSplit{{TargetAttributionId: platform}},
+		},
+		{
+			Name:   "split with itself",
+			Splits: []*v1.CostCenterSplit{{TargetAttributionId: string(attributionID), Percentage: 50}},
+		},
+		{
+			Name:   "duplicate target",
+			Splits: []*v1.CostCenterSplit{{TargetAttributionId: platform, Percentage: 10}, {TargetAttributionId: platform, Percentage: 10}},
+		},
+		{
+			Name:   "invalid target",
+			Splits: []*v1.CostCenterSplit{{TargetAttributionId: "invalid", Percentage: 10}},
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.Name, func(t *testing.T) {
+			splits, err := costCenterSplitsFromAPI(attributionID, s.Splits)
+			if !s.Valid {
+				require.Equal(t, codes.InvalidArgument, status.Code(err))
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, splits, len(s.Splits))
+			for _, split := range splits {
+				require.Equal(t, attributionID, split.AttributionID)
+			}
+		})
+	}
+}
+
+func TestSplitUsage_PreservesTotal(t *testing.T) {
+	attributionID := db.NewTeamAttributionID(uuid.New().String())
+	usage := db.Usage{ID: uuid.New(), AttributionID: attributionID, CreditCents: 1001}
+	splits := []db.CostCenterSplit{
+		{AttributionID: attributionID, TargetAttributionID: db.NewTeamAttributionID(uuid.New().String()), Percentage: 33},
+		{AttributionID: attributionID, TargetAttributionID: db.NewTeamAttributionID(uuid.New().String()), Percentage: 33},
+	}
+
+	entries, err := splitUsage(usage, splits, nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	require.Equal(t, usage.ID, entries[0].ID)
+	require.EqualValues(t, 330, entries[1].CreditCents)
+	require.EqualValues(t, 330, entries[2].CreditCents)
+	require.EqualValues(t, 341, entries[0].CreditCents, "rounding remainders stay with the cost center")
+}
@@ -0,0 +1,152 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"context"
+	"math"
+
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/requestid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *UsageService) ListCostCenters(ctx context.Context, in *v1.ListCostCentersRequest) (*v1.ListCostCentersResponse, error) {
+	if in.GetPagination().GetPerPage() < 0 {
+		return nil, invalidPaginationError("Number of items perPage needs to be positive (was %d).", in.GetPagination().GetPerPage())
+	}
+	if in.GetPagination().GetPage() < 0 {
+		return nil, invalidPaginationError("Page number needs to be 0 or greater (was %d).", in.GetPagination().GetPage())
+	}
+
+	params := &db.FindCostCentersParams{}
+	if in.GetBillingStrategy() != v1.BillingStrategy_BILLING_STRATEGY_UNSPECIFIED {
+		strategy, ok := billingStrategyFromAPI(in.GetBillingStrategy())
+		if !ok {
+			return nil, status.Errorf(codes.InvalidArgument, "Unknown billing strategy %s", in.GetBillingStrategy())
+		}
+		params.BillingStrategy = strategy
+	}
+	if limitRange := in.GetSpendingLimit(); limitRange != nil {
+		if limitRange.GetMin() > limitRange.GetMax() {
+			return nil, status.Errorf(codes.InvalidArgument, "Minimum spending limit must not be greater than the maximum")
+		}
+		minLimit, maxLimit := limitRange.GetMin(), limitRange.GetMax()
+		params.MinSpendingLimit = &minLimit
+		params.MaxSpendingLimit = &maxLimit
+	}
+
+	var perPage int64 = 50
+	if in.GetPagination().GetPerPage() > 0 {
+		perPage = in.GetPagination().GetPerPage()
+	}
+	page := in.GetPagination().GetPage()
+
+	logger := requestid.Log(ctx).
+		WithField("billing_strategy", params.BillingStrategy).
+		WithField("over_limit", in.GetOverLimit()).
+		WithField("perPage", perPage).
+		WithField("page", page)
+
+	var costCenters []db.CostCenter
+	var total int64
+	var err error
+	if in.GetOverLimit() {
+		costCenters, err = s.findCostCentersOverLimit(ctx, params)
+		if err != nil {
+			logger.WithError(err).Error("Failed to find cost centers over their spending limit.")
+			return nil, status.Errorf(codes.Internal, "Failed to find cost centers")
+		}
+		total = int64(len(costCenters))
+		costCenters = pageOf(costCenters, page, perPage)
+	} else {
+		total, err = db.CountCostCenters(ctx, s.conn, params)
+		if err != nil {
+			logger.WithError(err).Error("Failed to count cost centers.")
+			return nil, status.Errorf(codes.Internal, "Failed to find cost centers")
+		}
+		params.Offset = page * perPage
+		params.Limit = perPage
+		costCenters, err = db.FindCostCenters(ctx, s.conn, params)
+		if err != nil {
+			logger.WithError(err).Error("Failed to find cost centers.")
+			return nil, status.Errorf(codes.Internal, "Failed to find cost centers")
+		}
+	}
+
+	resp := &v1.ListCostCentersResponse{
+		Pagination: &v1.PaginatedResponse{
+			PerPage:    perPage,
+			Page:       page,
+			TotalPages: int64(math.Ceil(float64(total) / float64(perPage))),
+			Total:      total,
+		},
+	}
+	for i := range costCenters {
+		costCenter, err := s.costCenterToAPI(ctx, &costCenters[i])
+		if err != nil {
+			logger.WithError(err).WithField("attribution_id", costCenters[i].ID).Error("Failed to get usage of cost center.")
+			return nil, status.Errorf(codes.Internal, "Failed to get usage in billing period of cost center %s", costCenters[i].ID)
+		}
+		resp.CostCenters = append(resp.CostCenters, costCenter)
+	}
+	return resp, nil
+}
+
+// findCostCentersOverLimit returns the cost centers matching params whose usage reached their spending limit. The
+// balance depends on credit grants and debt, so every matching cost center is checked.
+func (s *UsageService) findCostCentersOverLimit(ctx context.Context, params *db.FindCostCentersParams) ([]db.CostCenter, error) {
+	candidates, err := db.FindCostCenters(ctx, s.conn, params)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.nowFunc()
+	var overLimit []db.CostCenter
+	for _, costCenter := range candidates {
+		b, err := s.getBalance(ctx, costCenter.ID, now)
+		if err != nil {
+			return nil, err
+		}
+		if b.limitReached() {
+			overLimit = append(overLimit, costCenter)
+		}
+	}
+	return overLimit, nil
+}
+
+func pageOf(costCenters []db.CostCenter, page, perPage int64) []db.CostCenter {
+	start := page * perPage
+	if start >= int64(len(costCenters)) {
+		return nil
+	}
+	end := start + perPage
+	if end > int64(len(costCenters)) {
+		end = int64(len(costCenters))
+	}
+	return costCenters[start:end]
+}
+
+func billingStrategyToAPI(strategy db.BillingStrategy) v1.BillingStrategy {
+	switch strategy {
+	case db.CostCenter_Stripe:
+		return v1.BillingStrategy_BILLING_STRATEGY_STRIPE
+	case db.CostCenter_Other:
+		return v1.BillingStrategy_BILLING_STRATEGY_OTHER
+	}
+	return v1.BillingStrategy_BILLING_STRATEGY_UNSPECIFIED
+}
+
+func billingStrategyFromAPI(strategy v1.BillingStrategy) (db.BillingStrategy, bool) {
+	switch strategy {
+	case v1.BillingStrategy_BILLING_STRATEGY_STRIPE:
+		return db.CostCenter_Stripe, true
+	case v1.BillingStrategy_BILLING_STRATEGY_OTHER:
+		return db.CostCenter_Other, true
+	}
+	return "", false
+}
@@ -0,0 +1,238 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/db/dbtest"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestBillingStrategyToAPI(t *testing.T) {
+	for _, strategy := range []db.BillingStrategy{db.CostCenter_Stripe, db.CostCenter_Other} {
+		converted, ok := billingStrategyFromAPI(billingStrategyToAPI(strategy))
+		require.True(t, ok)
+		require.Equal(t, strategy, converted)
+	}
+	require.Equal(t, v1.BillingStrategy_BILLING_STRATEGY_UNSPECIFIED, billingStrategyToAPI("unknown"))
+}
+
+func TestPageOf(t *testing.T) {
+	costCenters := []db.CostCenter{{ID: "team:a"}, {ID: "team:b"}, {ID: "team:c"}}
+
+	require.Equal(t, costCenters[:2], pageOf(costCenters, 0, 2))
+	require.Equal(t, costCenters[2:], pageOf(costCenters, 1, 2))
+	require.Empty(t, pageOf(costCenters, 2, 2))
+}
+
+func TestListCostCenters_Validation(t *testing.T) {
+	service := &UsageService{nowFunc: time.Now}
+
+	_, err := service.ListCostCenters(context.Background(), &v1.ListCostCentersRequest{
+		SpendingLimit: &v1.ListCostCentersRequest_SpendingLimitRange{Min: 100, Max: 10},
+	})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = service.ListCostCenters(context.Background(), &v1.ListCostCentersRequest{
+		Pagination: &v1.PaginatedRequest{Page: -1},
+	})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestListCostCenters(t *testing.T) {
+	conn := dbtest.ConnectForTests(t)
+	now := time.Date(2022, 10, 15, 0, 0, 0, 0, time.UTC)
+	// A spending limit no other test uses, such that only the cost centers of this test are listed.
+	const limit = 987654
+
+	stripe := db.NewTeamAttributionID(uuid.New().String())
+	other := db.NewTeamAttributionID(uuid.New().String())
+	overLimit := db.NewTeamAttributionID(uuid.New().String())
+	dbtest.CreateCostCenters(t, conn,
+		db.CostCenter{ID: stripe, SpendingLimit: limit, BillingStrategy: db.CostCenter_Stripe},
+		db.CostCenter{ID: other, SpendingLimit: limit, BillingStrategy: db.CostCenter_Other},
+		db.CostCenter{ID: overLimit, SpendingLimit: limit, BillingStrategy: db.CostCenter_Other},
+	)
+	dbtest.CreateUsageRecords(t, conn, dbtest.NewUsage(t, db.Usage{
+		AttributionID: overLimit,
+		CreditCents:   db.NewCreditCents(limit),
+		EffectiveTime: db.NewVarcharTime(now.Add(-time.Hour)),
+	}))
+	t.Cleanup(func() {
+		require.NoError(t, conn.Where("attributionId = ?", overLimit).Delete(&db.CachedBalance{}).Error)
+	})
+
+	service := NewUsageService(conn, nil, nil, DefaultWorkspacePricer, nil, SpendingLimitGraceMargin{}, nil, DefaultDunningPeriods, DefaultDeletedUsageRetention, nil, LogSamplingConfig{}, nil, nil, nil, nil, nil, nil)
+	service.nowFunc = func() time.Time { return now }
+
+	list := func(req *v1.ListCostCentersRequest) ([]string, *v1.PaginatedResponse) {
+		req.SpendingLimit = &v1.ListCostCentersRequest_SpendingLimitRange{Min: limit, Max: limit}
+		resp, err := service.ListCostCenters(context.Background(), req)
+		require.NoError(t, err)
+		var ids []string
+		for _, costCenter := range resp.GetCostCenters() {
+			ids = append(ids, costCenter.GetAttributionId())
+		}
+		return ids, resp.GetPagination()
+	}
+
+	ids, pagination := list(&v1.ListCostCentersRequest{})
+	require.ElementsMatch(t, []string{string(stripe), string(other), string(overLimit)}, ids)
+	require.Equal(t, int64(3), pagination.GetTotal())
+
+	ids, _ = list(&v1.ListCostCentersRequest{BillingStrategy: v1.BillingStrategy_BILLING_STRATEGY_STRIPE})
+	require.Equal(t, []string{string(stripe)}, ids)
+
+	ids, pagination = list(&v1.ListCostCentersRequest{OverLimit: true})
+	require.Equal(t, []string{string(overLimit)}, ids)
+	require.Equal(t, int64(1), pagination.GetTotal())
+
+	ids, pagination = list(&v1.ListCostCentersRequest{Pagination: &v1.PaginatedRequest{PerPage: 2, Page: 1}})
+	require.Len(t, ids, 1)
+	require.Equal(t, int64(2), pagination.GetTotalPages())
+}
+
+func TestSetSpendingLimit_Validation(t *testing.T) {
+	service := &UsageService{nowFunc: time.Now}
+	attributionId := string(db.NewTeamAttributionID(uuid.New().String()))
+
+	for _, req := range []*v1.SetSpendingLimitRequest{
+		{AttributionId: "invalid", SpendingLimit: 100, Actor: "user", Reason: "reason"},
+		{AttributionId: attributionId, SpendingLimit: -1, Actor: "user", Reason: "reason"},
+		{AttributionId: attributionId, SpendingLimit: 100, Reason: "reason"},
+		{AttributionId: attributionId, SpendingLimit: 100, Actor: "user"},
+	} {
+		_, err := service.SetSpendingLimit(context.Background(), req)
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+}
+
+func TestSetSpendingLimit(t *testing.T) {
+	conn := dbtest.ConnectForTests(t)
+	costCenter := dbtest.CreateCostCenters(t, conn, db.CostCenter{SpendingLimit: 100})[0]
+	t.Cleanup(func() {
+		require.NoError(t, conn.Where("attributionId = ?", costCenter.ID).Delete(&db.SpendingLimitChange{}).Error)
+	})
+
+	service := NewUsageService(conn, nil, nil, DefaultWorkspacePricer, nil, SpendingLimitGraceMargin{}, nil, DefaultDunningPeriods, DefaultDeletedUsageRetention, nil, LogSamplingConfig{}, nil, nil, nil, nil, nil, nil)
+
+	resp, err := service.SetSpendingLimit(context.Background(), &v1.SetSpendingLimitRequest{
+		AttributionId: string(costCenter.ID),
+		SpendingLimit: 300,
+		Actor:         "user-a",
+		Reason:        "Growing team",
+	})
+	require.NoError(t, err)
+	require.EqualValues(t, 300, resp.GetCostCenter().GetSpendingLimit())
+
+	changes, err := service.ListSpendingLimitChanges(context.Background(), &v1.ListSpendingLimitChangesRequest{
+		AttributionId: string(costCenter.ID),
+	})
+	require.NoError(t, err)
+	require.EqualValues(t, 1, changes.GetPagination().GetTotal())
+	require.Len(t, changes.GetChanges(), 1)
+	require.EqualValues(t, 100, changes.GetChanges()[0].GetOldSpendingLimit())
+	require.EqualValues(t, 300, changes.GetChanges()[0].GetNewSpendingLimit())
+	require.Equal(t, "user-a", changes.GetChanges()[0].GetActor())
+	require.Equal(t, "Growing team", changes.GetChanges()[0].GetReason())
+
+	_, err = service.SetSpendingLimit(context.Background(), &v1.SetSpendingLimitRequest{
+		AttributionId: string(db.NewTeamAttributionID(uuid.New().String())),
+		SpendingLimit: 300,
+		Actor:         "user-a",
+		Reason:        "Missing",
+	})
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestSetSpendingLimit_NotifiesLimitState(t *testing.T) {
+	conn := dbtest.ConnectForTests(t)
+	now := time.Date(2022, 10, 15, 0, 0, 0, 0, time.UTC)
+	costCenter := dbtest.CreateCostCenters(t, conn, db.CostCenter{SpendingLimit: 100})[0]
+	dbtest.CreateUsageRecords(t, conn, dbtest.NewUsage(t, db.Usage{
+		AttributionID: costCenter.ID,
+		CreditCents:   db.NewCreditCents(120),
+		EffectiveTime: db.NewVarcharTime(now.Add(-time.Hour)),
+	}))
+	t.Cleanup(func() {
+		require.NoError(t, conn.Where("attributionId = ?", costCenter.ID).Delete(&db.SpendingLimitChange{}).Error)
+		require.NoError(t, conn.Where("attributionId = ?", costCenter.ID).Delete(&db.CachedBalance{}).Error)
+	})
+
+	limitStates := &recordingLimitStates{}
+	service := NewUsageService(conn, nil, nil, DefaultWorkspacePricer, nil, SpendingLimitGraceMargin{}, nil, DefaultDunningPeriods, DefaultDeletedUsageRetention, nil, LogSamplingConfig{}, nil, nil, nil, nil, limitStates, nil)
+	service.nowFunc = func() time.Time { return now }
+	setSpendingLimit := func(limit int32) {
+		_, err := service.SetSpendingLimit(context.Background(), &v1.SetSpendingLimitRequest{
+			AttributionId: string(costCenter.ID),
+			SpendingLimit: limit,
+			Actor:         "user-a",
+			Reason:        "Growing team",
+		})
+		require.NoError(t, err)
+	}
+
+	setSpendingLimit(200)
+	require.Len(t, limitStates.requests, 1)
+	require.Equal(t, v1.GetBalanceResponse_SPENDING_LIMIT_STATE_EXCEEDED, limitStates.requests[0].GetPreviousState())
+	require.Equal(t, v1.GetBalanceResponse_SPENDING_LIMIT_STATE_WITHIN_LIMIT, limitStates.requests[0].GetState())
+
+	setSpendingLimit(300)
+	require.Len(t, limitStates.requests, 1, "must not notify when the state does not change")
+}
+
+func TestSetSpendingLimit_BelowUsage(t *testing.T) {
+	conn := dbtest.ConnectForTests(t)
+	now := time.Date(2022, 10, 15, 0, 0, 0, 0, time.UTC)
+	costCenter := dbtest.CreateCostCenters(t, conn, db.CostCenter{SpendingLimit: 100})[0]
+	dbtest.CreateUsageRecords(t, conn, dbtest.NewUsage(t, db.Usage{
+		AttributionID: costCenter.ID,
+		CreditCents:   db.NewCreditCents(60),
+		EffectiveTime: db.NewVarcharTime(now.Add(-time.Hour)),
+	}))
+	t.Cleanup(func() {
+		require.NoError(t, conn.Where("attributionId = ?", costCenter.ID).Delete(&db.SpendingLimitChange{}).Error)
+		require.NoError(t, conn.Where("attributionId = ?", costCenter.ID).Delete(&db.CachedBalance{}).Error)
+	})
+
+	service := NewUsageService(conn, nil, nil, DefaultWorkspacePricer, nil, SpendingLimitGraceMargin{}, nil, DefaultDunningPeriods, DefaultDeletedUsageRetention, nil, LogSamplingConfig{}, nil, nil, nil, nil, nil, nil)
+	service.nowFunc = func() time.Time { return now }
+	setSpendingLimit := func(limit int32, force bool) error {
+		_, err := service.SetSpendingLimit(context.Background(), &v1.SetSpendingLimitRequest{
+			AttributionId: string(costCenter.ID),
+			SpendingLimit: limit,
+			Actor:         "user-a",
+			Reason:        "Cost cutting",
+			Force:         force,
+		})
+		return err
+	}
+
+	err := setSpendingLimit(50, false)
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+	details := status.Convert(err).Details()
+	require.Len(t, details, 2)
+	belowUsage, ok := details[0].(*v1.SpendingLimitBelowUsage)
+	require.True(t, ok)
+	require.EqualValues(t, 50, belowUsage.GetSpendingLimit())
+	require.Equal(t, 60.0, belowUsage.GetCreditsUsed())
+	require.Equal(t, ErrorReason_SpendingLimitBelowUsage, errorReason(status.Convert(err)))
+
+	require.NoError(t, setSpendingLimit(70, false), "must allow lowering the limit above the usage")
+	require.NoError(t, setSpendingLimit(200, false), "must always allow raising the limit")
+	require.NoError(t, setSpendingLimit(10, true), "must allow lowering the limit below the usage when forced")
+
+	read, err := db.GetCostCenter(context.Background(), conn, costCenter.ID)
+	require.NoError(t, err)
+	require.EqualValues(t, 10, read.SpendingLimit)
+}
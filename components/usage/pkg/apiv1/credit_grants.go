@@ -0,0 +1,226 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/requestid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gorm.io/gorm"
+)
+
+func (s *UsageService) GrantCredits(ctx context.Context, in *v1.GrantCreditsRequest) (*v1.GrantCreditsResponse, error) {
+	attributionId, err := db.ParseAttributionID(in.GetAttributionId())
+	if err != nil {
+		return nil, invalidAttributionIDError("Failed to parse attribution ID: %s", err.Error())
+	}
+	if in.GetCredits() <= 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "Credits must be positive")
+	}
+	if in.GetReason() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "Reason must be specified")
+	}
+	now := s.nowFunc()
+	if in.GetExpirationTime() == nil || !in.GetExpirationTime().AsTime().After(now) {
+		return nil, status.Errorf(codes.InvalidArgument, "Expiration time must be in the future")
+	}
+
+	grant, err := db.NewCreditGrant(attributionId, in.GetCredits(), in.GetReason(), now, in.GetExpirationTime().AsTime())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to construct credit grant: %s", err.Error())
+	}
+
+	err = db.InsertUsage(ctx, s.conn, grant.Usage)
+	if err != nil {
+		requestid.Log(ctx).WithError(err).WithField("attribution_id", attributionId).Error("Failed to insert credit grant.")
+		return nil, status.Errorf(codes.Internal, "Failed to grant credits to %s", attributionId)
+	}
+	requestid.Log(ctx).
+		WithField("attribution_id", attributionId).
+		WithField("credits", in.GetCredits()).
+		WithField("expires_at", grant.ExpiresAt).
+		Info("Granted credits.")
+
+	return &v1.GrantCreditsResponse{
+		Grant: &v1.Usage{
+			Id:            grant.ID.String(),
+			AttributionId: string(grant.AttributionID),
+			Description:   grant.Description,
+			Credits:       grant.CreditCents.ToCredits(),
+			EffectiveTime: timestamppb.New(grant.EffectiveTime.Time()),
+			Kind:          v1.Usage_KIND_CREDIT_GRANT,
+			Metadata:      string(grant.Metadata),
+		},
+	}, nil
+}
+
+func (s *UsageService) ExpireCreditGrants(ctx context.Context, in *v1.ExpireCreditGrantsRequest) (*v1.ExpireCreditGrantsResponse, error) {
+	now := s.nowFunc()
+	expired, err := db.FindExpiredCreditGrants(ctx, s.conn, now)
+	if err != nil {
+		requestid.Log(ctx).WithError(err).Error("Failed to find expired credit grants.")
+		return nil, status.Errorf(codes.Internal, "Failed to find expired credit grants")
+	}
+
+	expiredByAttribution := map[db.AttributionID][]db.CreditGrant{}
+	for _, grant := range expired {
+		expiredByAttribution[grant.AttributionID] = append(expiredByAttribution[grant.AttributionID], grant)
+	}
+
+	var expiredCreditCents db.CreditCents
+	for attributionId, grants := range expiredByAttribution {
+		logger := requestid.Log(ctx).WithField("attribution_id", attributionId)
+
+		allocated, err := allocateCreditGrants(ctx, s.conn, attributionId, now)
+		if err != nil {
+			logger.WithError(err).Error("Failed to allocate credit grants.")
+			return nil, status.Errorf(codes.Internal, "Failed to allocate credit grants of %s", attributionId)
+		}
+
+		var expiries []db.Usage
+		for _, grant := range grants {
+			remainder := allocated.allocation.Remaining[grant.ID]
+			// Fully consumed grants are expired too, such that they are not considered again.
+			expiry, err := db.NewCreditGrantExpiry(grant, remainder)
+			if err != nil {
+				return nil, status.Errorf(codes.Internal, "Failed to construct credit grant expiry: %s", err.Error())
+			}
+			expiries = append(expiries, expiry)
+			expiredCreditCents += remainder
+		}
+
+		err = db.InsertUsage(ctx, s.conn, expiries...)
+		if err != nil {
+			logger.WithError(err).Error("Failed to insert credit grant expiries.")
+			return nil, status.Errorf(codes.Internal, "Failed to expire credit grants of %s", attributionId)
+		}
+		logger.WithField("grants", len(expiries)).Info("Expired credit grants.")
+	}
+
+	return &v1.ExpireCreditGrantsResponse{
+		ExpiredCredits: expiredCreditCents.ToCredits(),
+	}, nil
+}
+
+// creditGrants is the allocation of the credit grants of an attribution ID to its workspace usage.
+type creditGrants struct {
+	grants     []db.CreditGrant
+	usage      []db.Usage
+	allocation db.CreditGrantAllocation
+}
+
+// allocateCreditGrants consumes the credit grants of the attribution ID with its workspace usage up to `to`.
+func allocateCreditGrants(ctx context.Context, conn *gorm.DB, attributionId db.AttributionID, to time.Time) (creditGrants, error) {
+	grants, err := db.FindCreditGrants(ctx, conn, attributionId)
+	if err != nil {
+		return creditGrants{}, err
+	}
+	return allocateGrants(ctx, conn, attributionId, grants, to)
+}
+
+func allocateGrants(ctx context.Context, conn *gorm.DB, attributionId db.AttributionID, grants []db.CreditGrant, to time.Time) (creditGrants, error) {
+	if len(grants) == 0 {
+		return creditGrants{}, nil
+	}
+
+	// Grants are ordered by the time they were granted, earlier usage cannot consume any of them.
+	usage, err := db.FindUsage(ctx, conn, &db.FindUsageParams{
+		AttributionId: attributionId,
+		From:          grants[0].EffectiveTime.Time(),
+		To:            to,
+		Order:         db.AscendingOrder,
+	})
+	if err != nil {
+		return creditGrants{}, fmt.Errorf("failed to find usage consuming credit grants: %w", err)
+	}
+
+	return creditGrants{
+		grants:     grants,
+		usage:      usage,
+		allocation: db.AllocateCreditGrants(grants, usage),
+	}, nil
+}
+
+// covered returns the workspace usage in [from, to) which was paid for with granted credits.
+func (g creditGrants) covered(from, to time.Time, excludeDrafts bool) db.CreditCents {
+	var covered db.CreditCents
+	for _, entry := range g.usage {
+		if excludeDrafts && entry.Draft {
+			continue
+		}
+		t := entry.EffectiveTime.Time()
+		if t.Before(from) || !t.Before(to) {
+			continue
+		}
+		covered += g.allocation.Covered[entry.ID]
+	}
+	return covered
+}
+
+// remaining returns the unused remainder of the credit grants which are active at `t`.
+func (g creditGrants) remaining(t time.Time) db.CreditCents {
+	var remaining db.CreditCents
+	for _, grant := range g.grants {
+		if grant.ActiveAt(t) {
+			remaining += g.allocation.Remaining[grant.ID]
+		}
+	}
+	return remaining
+}
+
+// nextChange returns the first time after `now` and before `until` at which a credit grant becomes active or expires,
+// or `until` if there is none. Until then, remaining(t) does not change without new usage or grants.
+func (g creditGrants) nextChange(now, until time.Time) time.Time {
+	next := until
+	for _, grant := range g.grants {
+		for _, t := range []time.Time{grant.EffectiveTime.Time(), grant.ExpiresAt} {
+			if t.After(now) && t.Before(next) {
+				next = t
+			}
+		}
+	}
+	return next
+}
+
+// withoutCreditGrants subtracts the finalized usage in [from, to) which was covered by credit grants, such that only
+// the remaining usage is billed.
+func withoutCreditGrants(ctx context.Context, conn *gorm.DB, usage map[db.AttributionID]db.CreditCents, from, to time.Time) (map[db.AttributionID]db.CreditCents, error) {
+	if len(usage) == 0 {
+		return usage, nil
+	}
+
+	attributionIds := make([]db.AttributionID, 0, len(usage))
+	for attributionId := range usage {
+		attributionIds = append(attributionIds, attributionId)
+	}
+	grants, err := db.FindCreditGrants(ctx, conn, attributionIds...)
+	if err != nil {
+		return nil, err
+	}
+	grantsByAttribution := map[db.AttributionID][]db.CreditGrant{}
+	for _, grant := range grants {
+		grantsByAttribution[grant.AttributionID] = append(grantsByAttribution[grant.AttributionID], grant)
+	}
+
+	result := make(map[db.AttributionID]db.CreditCents, len(usage))
+	for attributionId, creditCents := range usage {
+		result[attributionId] = creditCents
+	}
+	for attributionId, attributionGrants := range grantsByAttribution {
+		allocated, err := allocateGrants(ctx, conn, attributionId, attributionGrants, to)
+		if err != nil {
+			return nil, err
+		}
+		result[attributionId] -= allocated.covered(from, to, true)
+	}
+	return result, nil
+}
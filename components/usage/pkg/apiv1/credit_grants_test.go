@@ -0,0 +1,101 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/db/dbtest"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestGrantCredits_Validation(t *testing.T) {
+	now := time.Date(2022, 9, 15, 0, 0, 0, 0, time.UTC)
+	service := &UsageService{nowFunc: func() time.Time { return now }}
+	attributionID := string(db.NewTeamAttributionID(uuid.New().String()))
+
+	scenarios := []struct {
+		Name    string
+		Request *v1.GrantCreditsRequest
+	}{
+		{
+			Name:    "invalid attribution ID",
+			Request: &v1.GrantCreditsRequest{AttributionId: "foo", Credits: 10, Reason: "campaign", ExpirationTime: timestamppb.New(now.Add(time.Hour))},
+		},
+		{
+			Name:    "no credits",
+			Request: &v1.GrantCreditsRequest{AttributionId: attributionID, Reason: "campaign", ExpirationTime: timestamppb.New(now.Add(time.Hour))},
+		},
+		{
+			Name:    "no reason",
+			Request: &v1.GrantCreditsRequest{AttributionId: attributionID, Credits: 10, ExpirationTime: timestamppb.New(now.Add(time.Hour))},
+		},
+		{
+			Name:    "no expiration time",
+			Request: &v1.GrantCreditsRequest{AttributionId: attributionID, Credits: 10, Reason: "campaign"},
+		},
+		{
+			Name:    "expired",
+			Request: &v1.GrantCreditsRequest{AttributionId: attributionID, Credits: 10, Reason: "campaign", ExpirationTime: timestamppb.New(now)},
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.Name, func(t *testing.T) {
+			_, err := service.GrantCredits(context.Background(), s.Request)
+			require.Equal(t, codes.InvalidArgument, status.Code(err))
+		})
+	}
+}
+
+func TestCreditGrants_ConsumedBeforeSpendingLimit(t *testing.T) {
+	conn := dbtest.ConnectForTests(t)
+	attributionID := db.NewTeamAttributionID(uuid.New().String())
+	now := time.Date(2022, 9, 15, 0, 0, 0, 0, time.UTC)
+
+	dbtest.CreateCostCenters(t, conn, db.CostCenter{ID: attributionID, SpendingLimit: 100})
+
+	service := NewUsageService(conn, nil, nil, DefaultWorkspacePricer, nil, SpendingLimitGraceMargin{}, nil, DefaultDunningPeriods, DefaultDeletedUsageRetention, nil, LogSamplingConfig{}, nil, nil, nil, nil, nil, nil)
+	service.nowFunc = func() time.Time { return now }
+
+	resp, err := service.GrantCredits(context.Background(), &v1.GrantCreditsRequest{
+		AttributionId:  string(attributionID),
+		Credits:        30,
+		Reason:         "support goodwill",
+		ExpirationTime: timestamppb.New(now.Add(24 * time.Hour)),
+	})
+	require.NoError(t, err)
+	grantID := uuid.MustParse(resp.GetGrant().GetId())
+	t.Cleanup(func() {
+		require.NoError(t, conn.Where("attributionId = ?", attributionID).Delete(&db.Usage{}).Error)
+	})
+
+	dbtest.CreateUsageRecords(t, conn,
+		dbtest.NewUsage(t, db.Usage{AttributionID: attributionID, CreditCents: 12000, EffectiveTime: db.NewVarcharTime(now.Add(time.Hour))}),
+	)
+
+	service.nowFunc = func() time.Time { return now.Add(2 * time.Hour) }
+	b, err := service.getBalance(context.Background(), attributionID, service.nowFunc())
+	require.NoError(t, err)
+	require.Equal(t, db.CreditCents(9000), b.creditsUsed, "usage must consume the grant first")
+	require.Equal(t, db.CreditCents(3000), b.creditsCovered)
+	require.Equal(t, db.CreditCents(0), b.creditsGrantedRemaining)
+
+	service.nowFunc = func() time.Time { return now.Add(48 * time.Hour) }
+	_, err = service.ExpireCreditGrants(context.Background(), &v1.ExpireCreditGrantsRequest{})
+	require.NoError(t, err)
+
+	expiry, err := db.GetUsage(context.Background(), conn, uuid.NewSHA1(grantID, []byte("expire")))
+	require.NoError(t, err)
+	require.Equal(t, db.CreditCents(0), expiry.CreditCents, "fully consumed grants expire without a remainder")
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"context"
+	"errors"
+
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/requestid"
+	"github.com/gitpod-io/gitpod/usage/pkg/stripe"
+	stripesdk "github.com/stripe/stripe-go/v72"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *BillingService) PurchaseCredits(ctx context.Context, in *v1.PurchaseCreditsRequest) (*v1.PurchaseCreditsResponse, error) {
+	attributionID, err := db.ParseAttributionID(in.GetAttributionId())
+	if err != nil {
+		return nil, invalidAttributionIDError("Invalid attribution ID %q", in.GetAttributionId())
+	}
+	if in.GetCredits() <= 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "Credits must be positive")
+	}
+	if in.GetPurchaseId() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "Missing purchase ID")
+	}
+	logger := requestid.Log(ctx).WithField("attribution_id", attributionID).WithField("purchase_id", in.GetPurchaseId())
+
+	customer, err := s.customers.Get(ctx, string(attributionID))
+	if err != nil {
+		if errors.Is(err, stripe.ErrCustomerNotFound) {
+			return nil, errorWithReason(codes.FailedPrecondition, ErrorReason_BillingAccountNotFound, map[string]string{"attribution_id": string(attributionID)}, "No Stripe customer found for %s", attributionID)
+		}
+		logger.WithError(err).Error("Failed to look up Stripe customer.")
+		return nil, status.Errorf(codes.Internal, "failed to look up stripe customer")
+	}
+	logger = logger.WithField("customer_id", customer.ID)
+
+	paymentMethodID := defaultPaymentMethodID(customer)
+	if paymentMethodID == "" {
+		return nil, errorWithReason(codes.FailedPrecondition, ErrorReason_PaymentMethodMissing, map[string]string{"attribution_id": string(attributionID)}, "Stripe customer of %s has no default payment method", attributionID)
+	}
+
+	currency := stripe.PreferredCurrency(customer)
+	amount, ok := s.creditPrices.Amount(in.GetCredits(), currency)
+	if !ok {
+		return nil, status.Errorf(codes.FailedPrecondition, "No credit price configured for currency %s", currency)
+	}
+
+	paymentIntent, err := s.stripeClient.CreateCreditPurchase(ctx, stripe.CreditPurchaseParams{
+		CustomerID:      customer.ID,
+		PaymentMethodID: paymentMethodID,
+		PurchaseID:      in.GetPurchaseId(),
+		AttributionID:   string(attributionID),
+		Credits:         in.GetCredits(),
+		Amount:          amount,
+		Currency:        currency,
+	})
+	if err != nil {
+		var stripeErr *stripesdk.Error
+		if errors.As(err, &stripeErr) && stripeErr.Type == stripesdk.ErrorTypeCard {
+			logger.WithError(err).Info("Payment for credit purchase was declined.")
+			return nil, errorWithReason(codes.FailedPrecondition, ErrorReason_PaymentDeclined, map[string]string{"decline_code": string(stripeErr.DeclineCode)}, "Payment was declined: %s", stripeErr.Msg)
+		}
+		logger.WithError(err).Error("Failed to charge credit purchase.")
+		return nil, status.Errorf(codes.Internal, "failed to charge credit purchase")
+	}
+
+	logger.
+		WithField("payment_intent_id", paymentIntent.ID).
+		WithField("status", paymentIntent.Status).
+		Info("Charged credit purchase, credits are granted once the payment succeeded.")
+	return &v1.PurchaseCreditsResponse{
+		PaymentIntentId: paymentIntent.ID,
+		Status:          string(paymentIntent.Status),
+		Amount:          paymentIntent.Amount,
+		Currency:        string(paymentIntent.Currency),
+	}, nil
+}
+
+func defaultPaymentMethodID(customer *stripesdk.Customer) string {
+	if customer.InvoiceSettings == nil || customer.InvoiceSettings.DefaultPaymentMethod == nil {
+		return ""
+	}
+	return customer.InvoiceSettings.DefaultPaymentMethod.ID
+}
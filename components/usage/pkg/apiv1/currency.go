@@ -0,0 +1,46 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+)
+
+// CreditPrices maps ISO 4217 currency codes to the price of a single credit, in the smallest unit of the currency.
+// For example, {"USD": 3.6, "EUR": 3.6, "INR": 290} prices a credit at 3.6 cents, 3.6 euro cents and 290 paise.
+type CreditPrices map[string]float64
+
+func (p CreditPrices) Validate() error {
+	for currency, price := range p {
+		if len(currency) != 3 || strings.ToUpper(currency) != currency {
+			return fmt.Errorf("invalid currency %q, expected upper-case ISO 4217 code", currency)
+		}
+		if price <= 0 {
+			return fmt.Errorf("invalid price per credit %v for %s, must be positive", price, currency)
+		}
+	}
+	return nil
+}
+
+// Amount converts credits to the smallest unit of the currency, rounded half up. It returns false when no price is
+// configured for the currency.
+func (p CreditPrices) Amount(credits float64, currency string) (int64, bool) {
+	price, ok := p[strings.ToUpper(currency)]
+	if !ok {
+		return 0, false
+	}
+	return int64(math.Round(credits * price)), true
+}
+
+func costCenterCurrency(costCenter *db.CostCenter) string {
+	if costCenter.Currency == "" {
+		return db.DefaultCurrency
+	}
+	return strings.ToUpper(costCenter.Currency)
+}
@@ -0,0 +1,39 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"testing"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreditPrices_Amount(t *testing.T) {
+	prices := CreditPrices{"USD": 3.6, "INR": 290}
+
+	amount, ok := prices.Amount(100, "USD")
+	require.True(t, ok)
+	require.EqualValues(t, 360, amount)
+
+	amount, ok = prices.Amount(12.5, "inr")
+	require.True(t, ok)
+	require.EqualValues(t, 3625, amount)
+
+	_, ok = prices.Amount(100, "GBP")
+	require.False(t, ok, "currencies without a price cannot be converted")
+}
+
+func TestCreditPrices_Validate(t *testing.T) {
+	require.NoError(t, CreditPrices{"EUR": 3.6}.Validate())
+	require.Error(t, CreditPrices{"eur": 3.6}.Validate())
+	require.Error(t, CreditPrices{"EURO": 3.6}.Validate())
+	require.Error(t, CreditPrices{"EUR": 0}.Validate())
+}
+
+func TestCostCenterCurrency(t *testing.T) {
+	require.Equal(t, "USD", costCenterCurrency(&db.CostCenter{}))
+	require.Equal(t, "EUR", costCenterCurrency(&db.CostCenter{Currency: "eur"}))
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gitpod-io/gitpod/common-go/util"
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+)
+
+// DunningPeriods configures how long a cost center stays in each dunning state after an invoice payment failed.
+// Cost centers start in grace, are restricted once the grace period ends, and are suspended once the restricted
+// period ends. Paying the invoice ends dunning in any state.
+type DunningPeriods struct {
+	Grace      util.Duration `json:"grace"`
+	Restricted util.Duration `json:"restricted"`
+}
+
+var DefaultDunningPeriods = DunningPeriods{
+	Grace:      util.Duration(7 * 24 * time.Hour),
+	Restricted: util.Duration(7 * 24 * time.Hour),
+}
+
+func (p DunningPeriods) Validate() error {
+	if p.Grace < 0 || p.Restricted < 0 {
+		return errors.New("dunning periods must not be negative")
+	}
+	return nil
+}
+
+type dunningState int
+
+const (
+	dunningState_None dunningState = iota
+	dunningState_Grace
+	dunningState_Restricted
+	dunningState_Suspended
+)
+
+func (s dunningState) toAPI() v1.CostCenter_DunningState {
+	switch s {
+	case dunningState_None:
+		return v1.CostCenter_DUNNING_STATE_NONE
+	case dunningState_Grace:
+		return v1.CostCenter_DUNNING_STATE_GRACE
+	case dunningState_Restricted:
+		return v1.CostCenter_DUNNING_STATE_RESTRICTED
+	case dunningState_Suspended:
+		return v1.CostCenter_DUNNING_STATE_SUSPENDED
+	}
+	return v1.CostCenter_DUNNING_STATE_UNSPECIFIED
+}
+
+// stateAt returns the dunning state of a cost center whose invoice payment failed at `paymentFailedAt`, and when it
+// escalates to the next state. The returned end time is zero for states which do not escalate.
+func (p DunningPeriods) stateAt(paymentFailedAt db.VarcharTime, now time.Time) (dunningState, time.Time) {
+	if !paymentFailedAt.IsSet() {
+		return dunningState_None, time.Time{}
+	}
+
+	graceEnd := paymentFailedAt.Time().Add(time.Duration(p.Grace))
+	if now.Before(graceEnd) {
+		return dunningState_Grace, graceEnd
+	}
+
+	restrictedEnd := graceEnd.Add(time.Duration(p.Restricted))
+	if now.Before(restrictedEnd) {
+		return dunningState_Restricted, restrictedEnd
+	}
+
+	return dunningState_Suspended, time.Time{}
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gitpod-io/gitpod/common-go/util"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDunningPeriods_StateAt(t *testing.T) {
+	failedAt := time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)
+	periods := DunningPeriods{
+		Grace:      util.Duration(3 * 24 * time.Hour),
+		Restricted: util.Duration(4 * 24 * time.Hour),
+	}
+
+	scenarios := []struct {
+		Name            string
+		PaymentFailedAt db.VarcharTime
+		Now             time.Time
+		ExpectedState   dunningState
+		ExpectedEndsAt  time.Time
+	}{
+		{
+			Name:          "no failed payment",
+			Now:           failedAt,
+			ExpectedState: dunningState_None,
+		},
+		{
+			Name:            "within grace period",
+			PaymentFailedAt: db.NewVarcharTime(failedAt),
+			Now:             failedAt.Add(24 * time.Hour),
+			ExpectedState:   dunningState_Grace,
+			ExpectedEndsAt:  failedAt.Add(3 * 24 * time.Hour),
+		},
+		{
+			Name:            "grace period ended",
+			PaymentFailedAt: db.NewVarcharTime(failedAt),
+			Now:             failedAt.Add(3 * 24 * time.Hour),
+			ExpectedState:   dunningState_Restricted,
+			ExpectedEndsAt:  failedAt.Add(7 * 24 * time.Hour),
+		},
+		{
+			Name:            "restricted period ended",
+			PaymentFailedAt: db.NewVarcharTime(failedAt),
+			Now:             failedAt.Add(7 * 24 * time.Hour),
+			ExpectedState:   dunningState_Suspended,
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.Name, func(t *testing.T) {
+			state, endsAt := periods.stateAt(s.PaymentFailedAt, s.Now)
+			require.Equal(t, s.ExpectedState, state)
+			require.Equal(t, s.ExpectedEndsAt, endsAt)
+		})
+	}
+}
+
+func TestDunningPeriods_Validate(t *testing.T) {
+	require.NoError(t, DefaultDunningPeriods.Validate())
+	require.NoError(t, DunningPeriods{}.Validate())
+	require.Error(t, DunningPeriods{Grace: util.Duration(-time.Hour)}.Validate())
+}
@@ -0,0 +1,133 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrorDomain is the domain of the errdetails.ErrorInfo in the details of errors returned by the usage component.
+const ErrorDomain = "usage.gitpod.io"
+
+// Reasons of errors returned by the usage component. Clients rely on the reason rather than on the message to tell
+// users how to resolve an error. Errors without a specific reason have the name of their code as reason, e.g. INTERNAL.
+const (
+	// ErrorReason_InvalidAttributionID is the reason of errors for attribution IDs which can not be parsed.
+	ErrorReason_InvalidAttributionID = "INVALID_ATTRIBUTION_ID"
+	// ErrorReason_AttributionNotFound is the reason of errors for attribution IDs without a cost center.
+	ErrorReason_AttributionNotFound = "ATTRIBUTION_NOT_FOUND"
+	// ErrorReason_InvalidTimeRange is the reason of errors for time ranges which end before they start.
+	ErrorReason_InvalidTimeRange = "INVALID_TIME_RANGE"
+	// ErrorReason_UsageWindowTooLarge is the reason of errors for time ranges longer than can be listed at once. The
+	// metadata contains the longest window as max_window.
+	ErrorReason_UsageWindowTooLarge = "USAGE_WINDOW_TOO_LARGE"
+	// ErrorReason_InvalidPagination is the reason of errors for negative pages or page sizes.
+	ErrorReason_InvalidPagination = "INVALID_PAGINATION"
+	// ErrorReason_LimitExceeded is the reason of errors for values above the limit they are bound by, e.g. a project
+	// budget above the spending limit of its team. The metadata contains the limit as limit.
+	ErrorReason_LimitExceeded = "LIMIT_EXCEEDED"
+	// ErrorReason_SpendingLimitBelowUsage is the reason of errors for spending limits below the credits already used.
+	// The details also contain v1.SpendingLimitBelowUsage.
+	ErrorReason_SpendingLimitBelowUsage = "SPENDING_LIMIT_BELOW_USAGE"
+	// ErrorReason_BillingAccountNotFound is the reason of errors for attribution IDs without a Stripe customer.
+	ErrorReason_BillingAccountNotFound = "BILLING_ACCOUNT_NOT_FOUND"
+	// ErrorReason_PaymentMethodMissing is the reason of errors for Stripe customers without a default payment method.
+	ErrorReason_PaymentMethodMissing = "PAYMENT_METHOD_MISSING"
+	// ErrorReason_PaymentDeclined is the reason of errors for payments which were declined.
+	ErrorReason_PaymentDeclined = "PAYMENT_DECLINED"
+	// ErrorReason_BillingDisabled is the reason of errors of BillingServiceDisabled.
+	ErrorReason_BillingDisabled = "BILLING_DISABLED"
+	// ErrorReason_InvalidWebhookURL is the reason of errors for webhook URLs which are not public https URLs.
+	ErrorReason_InvalidWebhookURL = "INVALID_WEBHOOK_URL"
+	// ErrorReason_UsageWebhooksDisabled is the reason of errors for registering usage webhooks while they are disabled.
+	ErrorReason_UsageWebhooksDisabled = "USAGE_WEBHOOKS_DISABLED"
+	// ErrorReason_UsageExportDisabled is the reason of errors for exporting usage while no export is configured.
+	ErrorReason_UsageExportDisabled = "USAGE_EXPORT_DISABLED"
+	// ErrorReason_InvalidUsageAdjustments is the reason of errors for importing adjustments with invalid lines. The
+	// metadata contains the first invalid line as line, and the number of invalid lines as invalid_lines.
+	ErrorReason_InvalidUsageAdjustments = "INVALID_USAGE_ADJUSTMENTS"
+	// ErrorReason_RetentionBelowMinimum is the reason of errors for retention periods below their minimum. The metadata
+	// contains the field as field, and its minimum as minimum_days.
+	ErrorReason_RetentionBelowMinimum = "RETENTION_BELOW_MINIMUM"
+)
+
+// errorWithReason returns a status error whose details contain an errdetails.ErrorInfo with the reason and metadata.
+func errorWithReason(c codes.Code, reason string, metadata map[string]string, format string, args ...interface{}) error {
+	st, err := status.New(c, fmt.Sprintf(format, args...)).WithDetails(&errdetails.ErrorInfo{
+		Reason:   reason,
+		Domain:   ErrorDomain,
+		Metadata: metadata,
+	})
+	if err != nil {
+		return status.Errorf(c, format, args...)
+	}
+	return st.Err()
+}
+
+func invalidAttributionIDError(format string, args ...interface{}) error {
+	return errorWithReason(codes.InvalidArgument, ErrorReason_InvalidAttributionID, nil, format, args...)
+}
+
+func attributionNotFoundError(attributionID db.AttributionID, err error) error {
+	return errorWithReason(codes.NotFound, ErrorReason_AttributionNotFound, map[string]string{"attribution_id": string(attributionID)},
+		"Cost center not found: %s", err.Error())
+}
+
+func invalidTimeRangeError(format string, args ...interface{}) error {
+	return errorWithReason(codes.InvalidArgument, ErrorReason_InvalidTimeRange, nil, format, args...)
+}
+
+func invalidPaginationError(format string, args ...interface{}) error {
+	return errorWithReason(codes.InvalidArgument, ErrorReason_InvalidPagination, nil, format, args...)
+}
+
+// NewErrorReasonInterceptor returns an interceptor which adds an errdetails.ErrorInfo to errors without one, whose
+// reason is the name of their code. Every error returned by the usage component has a reason that way.
+func NewErrorReasonInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		resp, err := handler(ctx, req)
+		if err == nil {
+			return resp, nil
+		}
+		return resp, withDefaultErrorReason(err)
+	}
+}
+
+func withDefaultErrorReason(err error) error {
+	st := status.Convert(err)
+	if st.Code() == codes.OK {
+		return err
+	}
+	if errorReason(st) != "" {
+		return err
+	}
+
+	withReason, detailsErr := st.WithDetails(&errdetails.ErrorInfo{
+		Reason: code.Code_name[int32(st.Code())],
+		Domain: ErrorDomain,
+	})
+	if detailsErr != nil {
+		return err
+	}
+	return withReason.Err()
+}
+
+// errorReason returns the reason of the errdetails.ErrorInfo in the details of the status, or the empty string.
+func errorReason(st *status.Status) string {
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			return info.GetReason()
+		}
+	}
+	return ""
+}
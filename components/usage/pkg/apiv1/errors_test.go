@@ -0,0 +1,92 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestErrorWithReason(t *testing.T) {
+	attributionID := db.NewTeamAttributionID("team-a")
+	err := attributionNotFoundError(attributionID, db.CostCenterNotFound)
+
+	st := status.Convert(err)
+	require.Equal(t, codes.NotFound, st.Code())
+	require.Contains(t, st.Message(), "Cost center not found")
+	require.Len(t, st.Details(), 1)
+	info, ok := st.Details()[0].(*errdetails.ErrorInfo)
+	require.True(t, ok)
+	require.Equal(t, ErrorReason_AttributionNotFound, info.GetReason())
+	require.Equal(t, ErrorDomain, info.GetDomain())
+	require.Equal(t, map[string]string{"attribution_id": string(attributionID)}, info.GetMetadata())
+}
+
+func TestErrorReasonInterceptor(t *testing.T) {
+	interceptor := NewErrorReasonInterceptor()
+	call := func(err error) error {
+		_, err = interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/usage.v1.UsageService/GetBalance"}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, err
+		})
+		return err
+	}
+
+	require.NoError(t, call(nil))
+
+	t.Run("errors without reason get the name of their code", func(t *testing.T) {
+		err := call(status.Errorf(codes.Internal, "Failed to get balance"))
+		require.Equal(t, codes.Internal, status.Code(err))
+		require.Equal(t, "INTERNAL", errorReason(status.Convert(err)))
+
+		require.Equal(t, "UNKNOWN", errorReason(status.Convert(call(errors.New("connection reset")))))
+	})
+
+	t.Run("reasons are kept", func(t *testing.T) {
+		err := call(invalidAttributionIDError("Failed to parse attribution ID: %s", "invalid"))
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+		require.Len(t, status.Convert(err).Details(), 1)
+		require.Equal(t, ErrorReason_InvalidAttributionID, errorReason(status.Convert(err)))
+	})
+
+	t.Run("billing disabled", func(t *testing.T) {
+		_, err := (&BillingServiceDisabled{}).PurchaseCredits(context.Background(), &v1.PurchaseCreditsRequest{})
+		require.Equal(t, ErrorReason_BillingDisabled, errorReason(status.Convert(call(err))))
+	})
+}
+
+func TestListUsage_ErrorReasons(t *testing.T) {
+	service := &UsageService{}
+	to := time.Date(2022, 10, 31, 0, 0, 0, 0, time.UTC)
+	listUsage := func(attributionID string, from time.Time) error {
+		_, err := service.ListUsage(context.Background(), &v1.ListUsageRequest{
+			AttributionId: attributionID,
+			From:          timestamppb.New(from),
+			To:            timestamppb.New(to),
+			Pagination:    &v1.PaginatedRequest{},
+		})
+		return err
+	}
+	teamA := string(db.NewTeamAttributionID("team-a"))
+
+	require.Equal(t, ErrorReason_InvalidAttributionID, errorReason(status.Convert(listUsage("team-a", to))))
+	require.Equal(t, ErrorReason_InvalidTimeRange, errorReason(status.Convert(listUsage(teamA, to.Add(time.Hour)))))
+
+	err := listUsage(teamA, to.AddDate(0, -3, 0))
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	require.Equal(t, ErrorReason_UsageWindowTooLarge, errorReason(status.Convert(err)))
+	info := status.Convert(err).Details()[0].(*errdetails.ErrorInfo)
+	require.Equal(t, maxQuerySize.String(), info.GetMetadata()["max_window"])
+}
@@ -0,0 +1,161 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/requestid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+func (s *UsageService) ResetFreeTier(ctx context.Context, in *v1.ResetFreeTierRequest) (*v1.ResetFreeTierResponse, error) {
+	if in.GetFreeTierCredits() < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "Free tier credits must not be negative")
+	}
+
+	now := s.nowFunc()
+	due, err := db.ListCostCentersDueForBilling(ctx, s.conn, now)
+	if err != nil {
+		requestid.Log(ctx).WithError(err).Error("Failed to list cost centers due for billing.")
+		return nil, status.Errorf(codes.Internal, "Failed to list cost centers due for billing")
+	}
+
+	resp := &v1.ResetFreeTierResponse{}
+	for _, costCenter := range due {
+		logger := requestid.Log(ctx).WithField("attribution_id", costCenter.ID)
+
+		reset, err := s.resetFreeTier(ctx, costCenter, in.GetFreeTierCredits(), now)
+		if err != nil {
+			logger.WithError(err).Error("Failed to reset free tier.")
+			return nil, status.Errorf(codes.Internal, "Failed to reset free tier of %s", costCenter.ID)
+		}
+		if !reset {
+			logger.Info("Billing period was already advanced concurrently.")
+			continue
+		}
+		resp.ResetAttributionIds = append(resp.ResetAttributionIds, string(costCenter.ID))
+	}
+
+	return resp, nil
+}
+
+// resetFreeTier grants the free tier credits of the billing period which contains `now`, and advances the next billing
+// time of the cost center to the end of that period. Both happen in one transaction, and only when the next billing
+// time was not advanced since the cost center was read, such that repeated or concurrent runs grant at most once.
+// When the cost center has a rollover limit, the unused credits of the previous billing period are granted again, up
+// to the limit, in the same transaction. Usage of the previous billing period in excess of the spending limit is
+// carried into the new billing period as debt.
+func (s *UsageService) resetFreeTier(ctx context.Context, costCenter db.CostCenter, credits float64, now time.Time) (bool, error) {
+	periodStart, periodEnd := costCenter.BillingPeriodAt(now)
+
+	var advanced bool
+	err := s.conn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		advanced, err = db.AdvanceNextBillingTime(ctx, tx, costCenter.ID, costCenter.NextBillingTime.Time(), periodEnd)
+		if err != nil || !advanced {
+			return err
+		}
+
+		debt, err := debtAfterBillingPeriod(ctx, tx, costCenter)
+		if err != nil {
+			return err
+		}
+		if debt != costCenter.Debt {
+			_, err = db.SetDebt(ctx, tx, costCenter.ID, debt)
+			if err != nil {
+				return err
+			}
+			requestid.Log(ctx).WithField("attribution_id", costCenter.ID).WithField("debt", debt.ToCredits()).Info("Carried debt into the next billing period.")
+		}
+
+		var grants []db.Usage
+		rollover, err := rolloverCredits(ctx, tx, costCenter, periodStart)
+		if err != nil {
+			return err
+		}
+		if rollover > 0 {
+			grant, err := db.NewRolloverCreditGrant(costCenter.ID, rollover, periodStart, periodEnd)
+			if err != nil {
+				return err
+			}
+			grants = append(grants, grant.Usage)
+		}
+		if credits > 0 {
+			grant, err := db.NewFreeTierCreditGrant(costCenter.ID, credits, periodStart, periodEnd)
+			if err != nil {
+				return err
+			}
+			grants = append(grants, grant.Usage)
+		}
+		if len(grants) == 0 {
+			return nil
+		}
+		return db.InsertUsage(ctx, tx, grants...)
+	})
+	return advanced, err
+}
+
+// debtAfterBillingPeriod returns the debt the cost center carries out of the billing period which ends at its
+// NextBillingTime: the usage of that period which was not covered by credit grants, plus the debt carried into it, in
+// excess of the spending limit. Cost centers billed through Stripe are invoiced for all of their usage, and never
+// carry debt.
+func debtAfterBillingPeriod(ctx context.Context, conn *gorm.DB, costCenter db.CostCenter) (db.CreditCents, error) {
+	if costCenter.BillingStrategy == db.CostCenter_Stripe {
+		return 0, nil
+	}
+
+	periodEnd := costCenter.NextBillingTime.Time()
+	periodStart, _ := costCenter.BillingPeriodAt(periodEnd.Add(-time.Nanosecond))
+	used, err := db.GetWorkspaceUsageForAttribution(ctx, conn, costCenter.ID, periodStart, periodEnd)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get usage in billing period: %w", err)
+	}
+	grants, err := allocateCreditGrants(ctx, conn, costCenter.ID, periodEnd)
+	if err != nil {
+		return 0, fmt.Errorf("failed to allocate credit grants: %w", err)
+	}
+
+	owed := used - grants.covered(periodStart, periodEnd, false) + costCenter.Debt
+	overage := owed - db.NewCreditCents(float64(costCenter.SpendingLimit))
+	if overage < 0 {
+		return 0, nil
+	}
+	return overage, nil
+}
+
+// rolloverCredits returns the unused credits of the grants which expire at the end of the billing period preceding
+// `periodStart`, capped at the rollover limit of the cost center. The unused credits are still debited when the grants
+// expire, such that the ledger records both the expiry and the rollover.
+func rolloverCredits(ctx context.Context, conn *gorm.DB, costCenter db.CostCenter, periodStart time.Time) (db.CreditCents, error) {
+	previousEnd := costCenter.NextBillingTime.Time()
+	if costCenter.RolloverLimit <= 0 || !costCenter.NextBillingTime.IsSet() || !previousEnd.Equal(periodStart) {
+		// Credits only roll over into the period which directly follows the one they were granted for.
+		return 0, nil
+	}
+
+	allocated, err := allocateCreditGrants(ctx, conn, costCenter.ID, previousEnd)
+	if err != nil {
+		return 0, err
+	}
+	var unused db.CreditCents
+	for _, grant := range allocated.grants {
+		if grant.ExpiresAt.Equal(previousEnd) {
+			unused += allocated.allocation.Remaining[grant.ID]
+		}
+	}
+
+	limit := db.NewCreditCents(float64(costCenter.RolloverLimit))
+	if unused > limit {
+		return limit, nil
+	}
+	return unused, nil
+}
@@ -0,0 +1,178 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/db/dbtest"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResetFreeTier(t *testing.T) {
+	conn := dbtest.ConnectForTests(t)
+	attributionID := db.NewTeamAttributionID(uuid.New().String())
+	periodStart := time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)
+	periodEnd := periodStart.AddDate(0, 1, 0)
+
+	dbtest.CreateCostCenters(t, conn, db.CostCenter{ID: attributionID, NextBillingTime: db.NewVarcharTime(periodStart)})
+	t.Cleanup(func() {
+		require.NoError(t, conn.Where("attributionId = ?", attributionID).Delete(&db.Usage{}).Error)
+	})
+
+	service := NewUsageService(conn, nil, nil, DefaultWorkspacePricer, nil, SpendingLimitGraceMargin{}, nil, DefaultDunningPeriods, DefaultDeletedUsageRetention, nil, LogSamplingConfig{}, nil, nil, nil, nil, nil, nil)
+	service.nowFunc = func() time.Time { return periodStart.Add(time.Hour) }
+
+	resp, err := service.ResetFreeTier(context.Background(), &v1.ResetFreeTierRequest{FreeTierCredits: 50})
+	require.NoError(t, err)
+	require.Contains(t, resp.GetResetAttributionIds(), string(attributionID))
+
+	// A second run within the same billing period must not grant the free tier again.
+	resp, err = service.ResetFreeTier(context.Background(), &v1.ResetFreeTierRequest{FreeTierCredits: 50})
+	require.NoError(t, err)
+	require.NotContains(t, resp.GetResetAttributionIds(), string(attributionID))
+
+	grants, err := db.FindCreditGrants(context.Background(), conn, attributionID)
+	require.NoError(t, err)
+	require.Len(t, grants, 1)
+	require.Equal(t, db.CreditCents(5000), grants[0].Credits())
+	require.Equal(t, periodEnd, grants[0].ExpiresAt)
+
+	costCenter, err := db.GetCostCenter(context.Background(), conn, attributionID)
+	require.NoError(t, err)
+	require.Equal(t, db.TimeToISO8601(periodEnd), costCenter.NextBillingTime.String())
+}
+
+func TestResetFreeTier_RollsOverUnusedCredits(t *testing.T) {
+	conn := dbtest.ConnectForTests(t)
+	attributionID := db.NewTeamAttributionID(uuid.New().String())
+	previousStart := time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC)
+	periodStart := previousStart.AddDate(0, 1, 0)
+	periodEnd := periodStart.AddDate(0, 1, 0)
+
+	dbtest.CreateCostCenters(t, conn, db.CostCenter{ID: attributionID, NextBillingTime: db.NewVarcharTime(periodStart), RolloverLimit: 10})
+	t.Cleanup(func() {
+		require.NoError(t, conn.Where("attributionId = ?", attributionID).Delete(&db.Usage{}).Error)
+	})
+
+	previousGrant, err := db.NewFreeTierCreditGrant(attributionID, 50, previousStart, periodStart)
+	require.NoError(t, err)
+	dbtest.CreateUsageRecords(t, conn,
+		previousGrant.Usage,
+		dbtest.NewUsage(t, db.Usage{
+			AttributionID: attributionID,
+			CreditCents:   db.NewCreditCents(20),
+			EffectiveTime: db.NewVarcharTime(previousStart.Add(time.Hour)),
+			Kind:          db.WorkspaceInstanceUsageKind,
+		}),
+	)
+
+	service := NewUsageService(conn, nil, nil, DefaultWorkspacePricer, nil, SpendingLimitGraceMargin{}, nil, DefaultDunningPeriods, DefaultDeletedUsageRetention, nil, LogSamplingConfig{}, nil, nil, nil, nil, nil, nil)
+	service.nowFunc = func() time.Time { return periodStart.Add(time.Hour) }
+
+	resp, err := service.ResetFreeTier(context.Background(), &v1.ResetFreeTierRequest{FreeTierCredits: 50})
+	require.NoError(t, err)
+	require.Contains(t, resp.GetResetAttributionIds(), string(attributionID))
+
+	grants, err := db.FindCreditGrants(context.Background(), conn, attributionID)
+	require.NoError(t, err)
+	credits := map[uuid.UUID]db.CreditCents{}
+	for _, grant := range grants {
+		credits[grant.ID] = grant.Credits()
+	}
+
+	rollover, err := db.NewRolloverCreditGrant(attributionID, 0, periodStart, periodEnd)
+	require.NoError(t, err)
+	freeTier, err := db.NewFreeTierCreditGrant(attributionID, 50, periodStart, periodEnd)
+	require.NoError(t, err)
+	require.Equal(t, map[uuid.UUID]db.CreditCents{
+		previousGrant.ID: 5000,
+		// 30 credits remained unused, capped at the rollover limit of 10.
+		rollover.ID: 1000,
+		freeTier.ID: 5000,
+	}, credits)
+}
+
+func TestResetFreeTier_CarriesDebt(t *testing.T) {
+	conn := dbtest.ConnectForTests(t)
+	previousStart := time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC)
+	periodStart := previousStart.AddDate(0, 1, 0)
+
+	scenarios := []struct {
+		Name         string
+		CostCenter   db.CostCenter
+		UsedCredits  float64
+		ExpectedDebt db.CreditCents
+	}{
+		{
+			Name:         "within spending limit",
+			CostCenter:   db.CostCenter{SpendingLimit: 100},
+			UsedCredits:  80,
+			ExpectedDebt: 0,
+		},
+		{
+			Name:         "exceeds spending limit",
+			CostCenter:   db.CostCenter{SpendingLimit: 100},
+			UsedCredits:  130,
+			ExpectedDebt: 3000,
+		},
+		{
+			Name:         "carried debt counts towards the spending limit",
+			CostCenter:   db.CostCenter{SpendingLimit: 100, Debt: 3000},
+			UsedCredits:  80,
+			ExpectedDebt: 1000,
+		},
+		{
+			Name:         "carried debt is paid off",
+			CostCenter:   db.CostCenter{SpendingLimit: 100, Debt: 3000},
+			UsedCredits:  50,
+			ExpectedDebt: 0,
+		},
+		{
+			Name:         "stripe invoices the overage",
+			CostCenter:   db.CostCenter{SpendingLimit: 100, BillingStrategy: db.CostCenter_Stripe},
+			UsedCredits:  130,
+			ExpectedDebt: 0,
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.Name, func(t *testing.T) {
+			attributionID := db.NewTeamAttributionID(uuid.New().String())
+			costCenter := s.CostCenter
+			costCenter.ID = attributionID
+			costCenter.NextBillingTime = db.NewVarcharTime(periodStart)
+			dbtest.CreateCostCenters(t, conn, costCenter)
+			t.Cleanup(func() {
+				require.NoError(t, conn.Where("attributionId = ?", attributionID).Delete(&db.Usage{}).Error)
+			})
+			dbtest.CreateUsageRecords(t, conn, dbtest.NewUsage(t, db.Usage{
+				AttributionID: attributionID,
+				CreditCents:   db.NewCreditCents(s.UsedCredits),
+				EffectiveTime: db.NewVarcharTime(previousStart.Add(time.Hour)),
+				Kind:          db.WorkspaceInstanceUsageKind,
+			}))
+
+			service := NewUsageService(conn, nil, nil, DefaultWorkspacePricer, nil, SpendingLimitGraceMargin{}, nil, DefaultDunningPeriods, DefaultDeletedUsageRetention, nil, LogSamplingConfig{}, nil, nil, nil, nil, nil, nil)
+			service.nowFunc = func() time.Time { return periodStart.Add(time.Hour) }
+
+			_, err := service.ResetFreeTier(context.Background(), &v1.ResetFreeTierRequest{})
+			require.NoError(t, err)
+
+			updated, err := db.GetCostCenter(context.Background(), conn, attributionID)
+			require.NoError(t, err)
+			require.Equal(t, s.ExpectedDebt, updated.Debt)
+
+			resp, err := service.GetBalance(context.Background(), &v1.GetBalanceRequest{AttributionId: string(attributionID)})
+			require.NoError(t, err)
+			require.Equal(t, s.ExpectedDebt.ToCredits(), resp.GetDebt())
+		})
+	}
+}
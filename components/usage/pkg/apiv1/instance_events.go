@@ -0,0 +1,190 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/notifier"
+	"github.com/gitpod-io/gitpod/usage/pkg/requestid"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// instanceEventBatchSize is the number of events which RecordInstanceEvents buffers before it updates usage.
+const instanceEventBatchSize = 100
+
+// instanceTimes are the times of the phases of an instance, as reported by its events.
+type instanceTimes struct {
+	started  time.Time
+	stopping time.Time
+}
+
+func (s *UsageService) RecordInstanceEvents(stream v1.UsageService_RecordInstanceEventsServer) error {
+	ctx := stream.Context()
+	resp := &v1.RecordInstanceEventsResponse{}
+
+	batch := map[uuid.UUID]instanceTimes{}
+	var buffered int
+	for {
+		event, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		resp.Received++
+
+		instanceID, err := uuid.Parse(event.GetInstanceId())
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "Invalid instance ID %q", event.GetInstanceId())
+		}
+		if event.GetTime() == nil {
+			return status.Errorf(codes.InvalidArgument, "Time of the event of instance %s must be specified", instanceID)
+		}
+		times := batch[instanceID]
+		switch event.GetPhase() {
+		case v1.InstanceEvent_PHASE_RUNNING:
+			times.started = event.GetTime().AsTime()
+		case v1.InstanceEvent_PHASE_STOPPING, v1.InstanceEvent_PHASE_STOPPED:
+			// The usage of an instance ends when it starts to stop, later events do not move the end.
+			if times.stopping.IsZero() || event.GetTime().AsTime().Before(times.stopping) {
+				times.stopping = event.GetTime().AsTime()
+			}
+		default:
+			return status.Errorf(codes.InvalidArgument, "Phase of the event of instance %s must be specified", instanceID)
+		}
+		batch[instanceID] = times
+
+		buffered++
+		if buffered >= instanceEventBatchSize {
+			if err := s.updateUsageFromInstanceEvents(ctx, batch, resp); err != nil {
+				return err
+			}
+			batch = map[uuid.UUID]instanceTimes{}
+			buffered = 0
+		}
+	}
+
+	if err := s.updateUsageFromInstanceEvents(ctx, batch, resp); err != nil {
+		return err
+	}
+	return stream.SendAndClose(resp)
+}
+
+// updateUsageFromInstanceEvents writes the usage of the instances of the events. Times of the events take precedence
+// over times which are not recorded for the instance yet. Usage which is already final is not changed.
+//
+// With a write queue, the usage is written in the background, see writeInstanceEventUsage. Events of an instance whose
+// usage is still pending compute it from the same drafts again, and the queue only writes the last update.
+//
+// ReconcileUsageWithLedger writes the usage of the same instances concurrently. Both derive the ID of new usage from
+// the instance and its attribution ID, and UpsertUsage serializes inserts of the same ID, so usage which one of them
+// inserted after the other looked for existing usage is updated instead of recorded twice.
+func (s *UsageService) updateUsageFromInstanceEvents(ctx context.Context, events map[uuid.UUID]instanceTimes, resp *v1.RecordInstanceEventsResponse) error {
+	if len(events) == 0 {
+		return nil
+	}
+	logger := requestid.Log(ctx)
+	now := s.nowFunc()
+
+	var ids []uuid.UUID
+	for id := range events {
+		ids = append(ids, id)
+	}
+	instances, err := db.FindWorkspaceInstancesByIds(ctx, s.conn, ids)
+	if err != nil {
+		logger.WithError(err).Error("Failed to find workspace instances of events.")
+		return status.Errorf(codes.Internal, "Failed to find workspace instances")
+	}
+	existing, err := db.FindWorkspaceInstanceUsage(ctx, s.conn, ids)
+	if err != nil {
+		logger.WithError(err).Error("Failed to find usage of workspace instances of events.")
+		return status.Errorf(codes.Internal, "Failed to find usage of workspace instances")
+	}
+
+	final := map[uuid.UUID]bool{}
+	var drafts []db.Usage
+	for _, usage := range existing {
+		if usage.Draft {
+			drafts = append(drafts, usage)
+		} else {
+			final[usage.WorkspaceInstanceID] = true
+		}
+	}
+
+	var updating []db.WorkspaceInstanceForUsage
+	for _, instance := range instances {
+		if final[instance.ID] {
+			continue
+		}
+		times := events[instance.ID]
+		if !instance.StartedTime.IsSet() && !times.started.IsZero() {
+			instance.StartedTime = db.NewVarcharTime(times.started)
+		}
+		if !instance.StoppingTime.IsSet() && !times.stopping.IsZero() {
+			instance.StoppingTime = db.NewVarcharTime(times.stopping)
+		}
+		// Instances which did not start yet have no usage.
+		if !instance.StartedTime.IsSet() {
+			continue
+		}
+		updating = append(updating, instance)
+	}
+	resp.Skipped += int32(len(events) - len(updating))
+	if len(updating) == 0 {
+		return nil
+	}
+
+	planChanges, err := db.FindPlanChangesByAttributionIDs(ctx, s.conn, collectAttributionIDs(updating))
+	if err != nil {
+		logger.WithError(err).Error("Failed to find plan changes.")
+		return status.Errorf(codes.Internal, "Failed to find plan changes")
+	}
+	splits, err := db.FindCostCenterSplitsByAttributionIDs(ctx, s.conn, collectAttributionIDs(updating))
+	if err != nil {
+		logger.WithError(err).Error("Failed to find cost center splits.")
+		return status.Errorf(codes.Internal, "Failed to find cost center splits")
+	}
+
+	inserts, updates, err := reconcileUsageWithLedger(ctx, updating, drafts, s.pricer, planChanges, splits, now)
+	if err != nil {
+		logger.WithError(err).Error("Failed to compute usage from instance events.")
+		return status.Errorf(codes.Internal, "Failed to compute usage")
+	}
+	written := append(inserts, updates...)
+	err = s.writeInstanceEventUsage(ctx, written)
+	if errors.Is(err, db.UsageVersionConflict) {
+		return status.Errorf(codes.Aborted, "Usage records were updated concurrently, retry the events.")
+	}
+	if err != nil {
+		logger.WithError(err).Error("Failed to write usage from instance events.")
+		return status.Errorf(codes.Internal, "Failed to write usage")
+	}
+	publishUsageEvents(ctx, s.events, notifier.UsageInstanceBilledEvent, billedInstanceUsage(written))
+
+	resp.Updated += int32(len(updating))
+	return nil
+}
+
+// writeInstanceEventUsage enqueues the usage into the write queue, or writes it when there is no write queue, or the
+// queue is full or closed.
+func (s *UsageService) writeInstanceEventUsage(ctx context.Context, usage []db.Usage) error {
+	if s.writeQueue != nil {
+		err := s.writeQueue.Enqueue(usage...)
+		if err == nil {
+			return nil
+		}
+		requestid.Log(ctx).WithError(err).Warn("Failed to enqueue usage from instance events, writing it directly.")
+	}
+	return db.UpsertUsage(ctx, s.conn, usage...)
+}
@@ -0,0 +1,162 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/db/dbtest"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type fakeInstanceEventStream struct {
+	grpc.ServerStream
+	events []*v1.InstanceEvent
+	resp   *v1.RecordInstanceEventsResponse
+}
+
+func (s *fakeInstanceEventStream) Context() context.Context {
+	return context.Background()
+}
+
+func (s *fakeInstanceEventStream) Recv() (*v1.InstanceEvent, error) {
+	if len(s.events) == 0 {
+		return nil, io.EOF
+	}
+	event := s.events[0]
+	s.events = s.events[1:]
+	return event, nil
+}
+
+func (s *fakeInstanceEventStream) SendAndClose(resp *v1.RecordInstanceEventsResponse) error {
+	s.resp = resp
+	return nil
+}
+
+func TestUsageService_RecordInstanceEvents(t *testing.T) {
+	conn := dbtest.ConnectForTests(t)
+	now := time.Date(2022, 10, 12, 10, 0, 0, 0, time.UTC)
+	attributionID := db.NewTeamAttributionID(uuid.New().String())
+	// UpsertUsage writes usage with raw SQL, which the cleanup of ConnectForTests does not track.
+	t.Cleanup(func() {
+		require.NoError(t, conn.Where("attributionId = ?", attributionID).Delete(&db.Usage{}).Error)
+		require.NoError(t, conn.Where("attributionId = ?", attributionID).Delete(&db.CachedBalance{}).Error)
+	})
+
+	workspace := dbtest.CreateWorkspaces(t, conn, dbtest.NewWorkspace(t, db.Workspace{}))[0]
+	// The instance table does not know yet that the instances stopped.
+	running := dbtest.NewWorkspaceInstance(t, db.WorkspaceInstance{
+		WorkspaceID:        workspace.ID,
+		UsageAttributionID: attributionID,
+		StartedTime:        db.NewVarcharTime(now.Add(-2 * time.Hour)),
+	})
+	stopped := dbtest.NewWorkspaceInstance(t, db.WorkspaceInstance{
+		WorkspaceID:        workspace.ID,
+		UsageAttributionID: attributionID,
+		StartedTime:        db.NewVarcharTime(now.Add(-2 * time.Hour)),
+	})
+	final := dbtest.NewWorkspaceInstance(t, db.WorkspaceInstance{
+		WorkspaceID:        workspace.ID,
+		UsageAttributionID: attributionID,
+		StartedTime:        db.NewVarcharTime(now.Add(-2 * time.Hour)),
+	})
+	dbtest.CreateWorkspaceInstances(t, conn, running, stopped, final)
+	finalUsage := dbtest.CreateUsageRecords(t, conn, dbtest.NewUsage(t, db.Usage{
+		AttributionID:       attributionID,
+		WorkspaceInstanceID: final.ID,
+		Kind:                db.WorkspaceInstanceUsageKind,
+		CreditCents:         100,
+		EffectiveTime:       db.NewVarcharTime(now.Add(-time.Hour)),
+	}))[0]
+
+	service := NewUsageService(conn, nil, nil, DefaultWorkspacePricer, nil, SpendingLimitGraceMargin{}, nil, DefaultDunningPeriods, DefaultDeletedUsageRetention, nil, LogSamplingConfig{}, nil, nil, nil, nil, nil, nil)
+	service.nowFunc = func() time.Time { return now }
+
+	stream := &fakeInstanceEventStream{events: []*v1.InstanceEvent{
+		{InstanceId: running.ID.String(), Phase: v1.InstanceEvent_PHASE_RUNNING, Time: timestamppb.New(now.Add(-2 * time.Hour))},
+		{InstanceId: stopped.ID.String(), Phase: v1.InstanceEvent_PHASE_STOPPING, Time: timestamppb.New(now.Add(-time.Hour))},
+		{InstanceId: stopped.ID.String(), Phase: v1.InstanceEvent_PHASE_STOPPED, Time: timestamppb.New(now.Add(-time.Hour + time.Minute))},
+		{InstanceId: final.ID.String(), Phase: v1.InstanceEvent_PHASE_STOPPED, Time: timestamppb.New(now)},
+		{InstanceId: uuid.New().String(), Phase: v1.InstanceEvent_PHASE_RUNNING, Time: timestamppb.New(now)},
+	}}
+	require.NoError(t, service.RecordInstanceEvents(stream))
+	require.Equal(t, int32(5), stream.resp.GetReceived())
+	require.Equal(t, int32(2), stream.resp.GetUpdated())
+	require.Equal(t, int32(2), stream.resp.GetSkipped(), "must skip unknown instances and final usage")
+
+	usage, err := db.FindWorkspaceInstanceUsage(context.Background(), conn, []uuid.UUID{running.ID, stopped.ID, final.ID})
+	require.NoError(t, err)
+	byInstance := map[uuid.UUID]db.Usage{}
+	for _, u := range usage {
+		byInstance[u.WorkspaceInstanceID] = u
+	}
+	require.Len(t, byInstance, 3)
+	require.Equal(t, db.WorkspaceInstanceUsageID(running.ID, attributionID), byInstance[running.ID].ID, "must use the same usage ID as the reconciliation")
+	require.True(t, byInstance[running.ID].Draft, "usage of running instances must be a draft")
+	require.False(t, byInstance[stopped.ID].Draft, "usage of stopped instances must be final")
+	require.Equal(t, now.Add(-time.Hour), byInstance[stopped.ID].EffectiveTime.Time(), "usage must end when the instance starts to stop")
+	require.Equal(t, finalUsage.CreditCents, byInstance[final.ID].CreditCents, "final usage must not change")
+	require.Equal(t, 2*byInstance[stopped.ID].CreditCents, byInstance[running.ID].CreditCents)
+}
+
+func TestUsageService_RecordInstanceEvents_WriteQueue(t *testing.T) {
+	conn := dbtest.ConnectForTests(t)
+	now := time.Date(2022, 10, 12, 10, 0, 0, 0, time.UTC)
+	attributionID := db.NewTeamAttributionID(uuid.New().String())
+	t.Cleanup(func() {
+		require.NoError(t, conn.Where("attributionId = ?", attributionID).Delete(&db.Usage{}).Error)
+		require.NoError(t, conn.Where("attributionId = ?", attributionID).Delete(&db.CachedBalance{}).Error)
+	})
+
+	workspace := dbtest.CreateWorkspaces(t, conn, dbtest.NewWorkspace(t, db.Workspace{}))[0]
+	instance := dbtest.NewWorkspaceInstance(t, db.WorkspaceInstance{
+		WorkspaceID:        workspace.ID,
+		UsageAttributionID: attributionID,
+		StartedTime:        db.NewVarcharTime(now.Add(-2 * time.Hour)),
+	})
+	dbtest.CreateWorkspaceInstances(t, conn, instance)
+
+	queue, err := db.NewUsageWriteQueue(conn, db.UsageWriteQueueConfig{})
+	require.NoError(t, err)
+	service := NewUsageService(conn, nil, nil, DefaultWorkspacePricer, nil, SpendingLimitGraceMargin{}, nil, DefaultDunningPeriods, DefaultDeletedUsageRetention, nil, LogSamplingConfig{}, nil, nil, nil, nil, nil, queue)
+	service.nowFunc = func() time.Time { return now }
+
+	stream := &fakeInstanceEventStream{events: []*v1.InstanceEvent{
+		{InstanceId: instance.ID.String(), Phase: v1.InstanceEvent_PHASE_STOPPING, Time: timestamppb.New(now.Add(-time.Hour))},
+	}}
+	require.NoError(t, service.RecordInstanceEvents(stream))
+	require.Equal(t, int32(1), stream.resp.GetUpdated())
+	require.Equal(t, 1, queue.Pending(), "usage must be written by the queue")
+
+	// Closing the queue on shutdown writes the pending usage.
+	require.NoError(t, queue.Close(context.Background()))
+	usage, err := db.GetUsage(context.Background(), conn, db.WorkspaceInstanceUsageID(instance.ID, attributionID))
+	require.NoError(t, err)
+	require.False(t, usage.Draft)
+	require.Equal(t, now.Add(-time.Hour), usage.EffectiveTime.Time())
+}
+
+func TestUsageService_RecordInstanceEvents_InvalidEvent(t *testing.T) {
+	service := NewUsageService(nil, nil, nil, DefaultWorkspacePricer, nil, SpendingLimitGraceMargin{}, nil, DefaultDunningPeriods, DefaultDeletedUsageRetention, nil, LogSamplingConfig{}, nil, nil, nil, nil, nil, nil)
+
+	for _, event := range []*v1.InstanceEvent{
+		{InstanceId: "not-a-uuid", Phase: v1.InstanceEvent_PHASE_RUNNING, Time: timestamppb.Now()},
+		{InstanceId: uuid.New().String(), Phase: v1.InstanceEvent_PHASE_RUNNING},
+		{InstanceId: uuid.New().String(), Time: timestamppb.Now()},
+	} {
+		err := service.RecordInstanceEvents(&fakeInstanceEventStream{events: []*v1.InstanceEvent{event}})
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+}
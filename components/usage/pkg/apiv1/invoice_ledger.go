@@ -0,0 +1,119 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/notifier"
+	"github.com/gitpod-io/gitpod/usage/pkg/requestid"
+	"github.com/gitpod-io/gitpod/usage/pkg/stripe"
+	stripesdk "github.com/stripe/stripe-go/v72"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *BillingService) ReconcileLedgerWithInvoices(ctx context.Context, in *v1.ReconcileLedgerWithInvoicesRequest) (*v1.ReconcileLedgerWithInvoicesResponse, error) {
+	from := in.GetFrom().AsTime()
+	to := in.GetTo().AsTime()
+	if to.Before(from) {
+		return nil, invalidTimeRangeError("From %s is after To %s", from, to)
+	}
+
+	logger := requestid.Log(ctx).WithField("from", from).WithField("to", to)
+
+	invoices, err := s.stripeClient.ListFinalizedInvoices(ctx, from, to)
+	if err != nil {
+		logger.WithError(err).Error("Failed to list finalized invoices.")
+		return nil, status.Errorf(codes.Internal, "failed to list finalized invoices")
+	}
+
+	resp := &v1.ReconcileLedgerWithInvoicesResponse{}
+	for _, invoice := range invoices {
+		invoiceLogger := logger.WithField("invoice_id", invoice.ID)
+
+		expected, err := usageForInvoice(invoice)
+		if err != nil {
+			invoiceLogger.WithError(err).Error("Failed to construct usage entry for invoice.")
+			return nil, status.Errorf(codes.Internal, "failed to construct usage entry for invoice %s", invoice.ID)
+		}
+
+		actual, err := db.GetUsage(ctx, s.conn, expected.ID)
+		if errors.Is(err, db.UsageNotFound) {
+			err = db.InsertUsage(ctx, s.conn, expected)
+			if err != nil {
+				invoiceLogger.WithError(err).Error("Failed to insert missing usage entry for invoice.")
+				return nil, status.Errorf(codes.Internal, "failed to insert usage entry for invoice %s", invoice.ID)
+			}
+			invoiceLogger.WithField("attribution_id", expected.AttributionID).Warn("Credited invoice which was missing in the ledger.")
+			publishUsageEvents(ctx, s.events, notifier.UsageInvoiceRecordedEvent, []db.Usage{expected})
+			resp.CreatedInvoiceIds = append(resp.CreatedInvoiceIds, invoice.ID)
+			continue
+		}
+		if err != nil {
+			invoiceLogger.WithError(err).Error("Failed to get usage entry for invoice.")
+			return nil, status.Errorf(codes.Internal, "failed to get usage entry for invoice %s", invoice.ID)
+		}
+
+		if mismatch := invoiceLedgerMismatch(invoice.ID, expected, actual); mismatch != nil {
+			invoiceLogger.
+				WithField("invoice_credits", mismatch.InvoiceCredits).
+				WithField("ledger_credits", mismatch.LedgerCredits).
+				WithField("attribution_id", mismatch.AttributionId).
+				WithField("ledger_attribution_id", mismatch.LedgerAttributionId).
+				Error("Ledger entry does not match invoice.")
+			resp.Mismatches = append(resp.Mismatches, mismatch)
+		}
+	}
+
+	return resp, nil
+}
+
+// usageForInvoice constructs the usage entry which credits the invoice against the cost center of its customer.
+// The customer of the invoice must be expanded.
+func usageForInvoice(invoice *stripesdk.Invoice) (db.Usage, error) {
+	if invoice.Customer == nil {
+		return db.Usage{}, fmt.Errorf("invoice %s has no customer", invoice.ID)
+	}
+
+	attributionID, err := attributionIDForCustomer(invoice.Customer)
+	if err != nil {
+		return db.Usage{}, err
+	}
+
+	return db.NewInvoiceUsage(invoice.ID, attributionID, stripe.InvoiceCredits(invoice), time.Unix(invoice.StatusTransitions.FinalizedAt, 0),
+		time.Unix(invoice.PeriodStart, 0), time.Unix(invoice.PeriodEnd, 0))
+}
+
+// attributionIDForCustomer is the inverse of customerMetadata.
+func attributionIDForCustomer(customer *stripesdk.Customer) (db.AttributionID, error) {
+	if teamID, ok := customer.Metadata[stripe.TeamIDMetadataKey]; ok {
+		return db.NewTeamAttributionID(teamID), nil
+	}
+	if userID, ok := customer.Metadata[stripe.UserIDMetadataKey]; ok {
+		return db.NewUserAttributionID(userID), nil
+	}
+	return "", fmt.Errorf("customer %s has neither team nor user metadata", customer.ID)
+}
+
+// invoiceLedgerMismatch returns nil when the usage entry in the ledger credits the invoice as expected.
+func invoiceLedgerMismatch(invoiceID string, expected, actual db.Usage) *v1.InvoiceLedgerMismatch {
+	if expected.AttributionID == actual.AttributionID && expected.CreditCents == actual.CreditCents {
+		return nil
+	}
+	// Invoice entries credit the cost center, so their credits are negative.
+	return &v1.InvoiceLedgerMismatch{
+		InvoiceId:           invoiceID,
+		AttributionId:       string(expected.AttributionID),
+		InvoiceCredits:      -expected.CreditCents.ToCredits(),
+		LedgerAttributionId: string(actual.AttributionID),
+		LedgerCredits:       -actual.CreditCents.ToCredits(),
+	}
+}
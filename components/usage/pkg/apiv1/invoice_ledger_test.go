@@ -0,0 +1,90 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"testing"
+	"time"
+
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/stretchr/testify/require"
+	stripesdk "github.com/stripe/stripe-go/v72"
+)
+
+func TestUsageForInvoice(t *testing.T) {
+	teamID := "e1d5a7b4-2f7e-4f3c-8d6a-0c9b1a2e3f4d"
+	invoice := &stripesdk.Invoice{
+		ID:                "in_123",
+		Customer:          &stripesdk.Customer{ID: "cus_123", Metadata: map[string]string{"teamId": teamID}},
+		PeriodStart:       1661990400,
+		PeriodEnd:         1664582400,
+		StatusTransitions: stripesdk.InvoiceStatusTransitions{FinalizedAt: 1664586000},
+		Lines: &stripesdk.InvoiceLineList{Data: []*stripesdk.InvoiceLine{
+			{Quantity: 400},
+			{Quantity: 80},
+		}},
+	}
+
+	usage, err := usageForInvoice(invoice)
+	require.NoError(t, err)
+	require.Equal(t, db.InvoiceUsageID("in_123"), usage.ID)
+	require.Equal(t, db.NewTeamAttributionID(teamID), usage.AttributionID)
+	require.Equal(t, db.InvoiceUsageKind, usage.Kind)
+	require.Equal(t, db.CreditCents(-48000), usage.CreditCents)
+	require.Equal(t, time.Unix(1664586000, 0).UTC(), usage.EffectiveTime.Time())
+
+	invoice.Customer.Metadata = map[string]string{}
+	_, err = usageForInvoice(invoice)
+	require.Error(t, err, "must fail for customers without attribution metadata")
+}
+
+func TestInvoiceLedgerMismatch(t *testing.T) {
+	teamA := db.NewTeamAttributionID("a")
+	teamB := db.NewTeamAttributionID("b")
+
+	scenarios := []struct {
+		Name     string
+		Expected db.Usage
+		Actual   db.Usage
+		Mismatch *v1.InvoiceLedgerMismatch
+	}{
+		{
+			Name:     "matches",
+			Expected: db.Usage{AttributionID: teamA, CreditCents: -48000},
+			Actual:   db.Usage{AttributionID: teamA, CreditCents: -48000},
+		},
+		{
+			Name:     "different credits",
+			Expected: db.Usage{AttributionID: teamA, CreditCents: -48000},
+			Actual:   db.Usage{AttributionID: teamA, CreditCents: -40000},
+			Mismatch: &v1.InvoiceLedgerMismatch{
+				InvoiceId:           "in_123",
+				AttributionId:       string(teamA),
+				InvoiceCredits:      480,
+				LedgerAttributionId: string(teamA),
+				LedgerCredits:       400,
+			},
+		},
+		{
+			Name:     "different attribution ID",
+			Expected: db.Usage{AttributionID: teamA, CreditCents: -48000},
+			Actual:   db.Usage{AttributionID: teamB, CreditCents: -48000},
+			Mismatch: &v1.InvoiceLedgerMismatch{
+				InvoiceId:           "in_123",
+				AttributionId:       string(teamA),
+				InvoiceCredits:      480,
+				LedgerAttributionId: string(teamB),
+				LedgerCredits:       480,
+			},
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.Name, func(t *testing.T) {
+			require.Equal(t, s.Mismatch, invoiceLedgerMismatch("in_123", s.Expected, s.Actual))
+		})
+	}
+}
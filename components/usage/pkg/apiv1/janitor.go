@@ -0,0 +1,129 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/notifier"
+	"github.com/gitpod-io/gitpod/usage/pkg/requestid"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// janitorSummary is the summary of a janitor run, as recorded in the reconciliation audit.
+type janitorSummary struct {
+	ExpiredCredits     float64        `json:"expiredCredits"`
+	DraftsBefore       string         `json:"draftsBefore"`
+	ClosedDraftIDs     []string       `json:"closedDraftIds"`
+	ClosedDraftCredits float64        `json:"closedDraftCredits"`
+	Purged             retentionPurge `json:"purged"`
+}
+
+func (s *UsageService) RunJanitor(ctx context.Context, in *v1.RunJanitorRequest) (*v1.RunJanitorResponse, error) {
+	if in.GetDraftsBefore() == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Drafts before must be specified")
+	}
+	draftsBefore := in.GetDraftsBefore().AsTime()
+
+	expired, err := s.ExpireCreditGrants(ctx, &v1.ExpireCreditGrantsRequest{})
+	if err != nil {
+		return nil, err
+	}
+
+	closed, err := s.closeStaleDrafts(ctx, draftsBefore)
+	if err != nil {
+		requestid.Log(ctx).WithError(err).Error("Failed to close stale drafts.")
+		return nil, status.Errorf(codes.Internal, "Failed to close stale drafts")
+	}
+	publishUsageEvents(ctx, s.events, notifier.UsageDraftFinalizedEvent, closed)
+
+	purged, err := s.applyRetentionPolicy(ctx, s.nowFunc())
+	if err != nil {
+		requestid.Log(ctx).WithError(err).Error("Failed to apply retention policy.")
+		return nil, status.Errorf(codes.Internal, "Failed to apply retention policy")
+	}
+
+	summary := janitorSummary{
+		ExpiredCredits: expired.GetExpiredCredits(),
+		DraftsBefore:   db.TimeToISO8601(draftsBefore),
+		ClosedDraftIDs: []string{},
+		Purged:         purged,
+	}
+	var closedCreditCents db.CreditCents
+	for _, draft := range closed {
+		summary.ClosedDraftIDs = append(summary.ClosedDraftIDs, draft.ID.String())
+		closedCreditCents += draft.CreditCents
+	}
+	summary.ClosedDraftCredits = closedCreditCents.ToCredits()
+
+	audit, err := db.RecordReconciliationAudit(ctx, s.conn, db.JanitorReconciler, summary)
+	if err != nil {
+		requestid.Log(ctx).WithError(err).Error("Failed to record janitor run.")
+		return nil, status.Errorf(codes.Internal, "Failed to record janitor run")
+	}
+	requestid.Log(ctx).
+		WithField("expired_credits", summary.ExpiredCredits).
+		WithField("closed_drafts", len(closed)).
+		WithField("purged_sessions", purged.Sessions).
+		WithField("purged_ledger_entries", purged.LedgerEntries).
+		WithField("purged_report_jobs", purged.ReportJobs).
+		WithField("audit_id", audit.ID).
+		Info("Janitor run finished.")
+
+	return &v1.RunJanitorResponse{
+		ExpiredCredits:      summary.ExpiredCredits,
+		ClosedDraftIds:      summary.ClosedDraftIDs,
+		AuditId:             audit.ID.String(),
+		PurgedSessions:      purged.Sessions,
+		PurgedLedgerEntries: purged.LedgerEntries,
+		PurgedReportJobs:    purged.ReportJobs,
+	}, nil
+}
+
+// closeStaleDrafts finalizes draft usage with an effective time before `before` whose workspace instance no longer
+// exists. Such drafts are never updated by usage reconciliation again, because it only updates drafts of instances it
+// can find. The drafts keep the credits they were last reconciled with.
+func (s *UsageService) closeStaleDrafts(ctx context.Context, before time.Time) ([]db.Usage, error) {
+	drafts, err := db.FindDraftUsageBefore(ctx, s.conn, before)
+	if err != nil {
+		return nil, err
+	}
+	if len(drafts) == 0 {
+		return nil, nil
+	}
+
+	instances, err := db.FindWorkspaceInstancesByIds(ctx, s.conn, collectWorkspaceInstanceIDs(drafts))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find workspace instances of stale drafts: %w", err)
+	}
+	existing := map[uuid.UUID]bool{}
+	for _, instance := range instances {
+		existing[instance.ID] = true
+	}
+
+	var stale []db.Usage
+	for _, draft := range drafts {
+		if existing[draft.WorkspaceInstanceID] {
+			continue
+		}
+		draft.Draft = false
+		stale = append(stale, draft)
+	}
+	if len(stale) == 0 {
+		return nil, nil
+	}
+
+	err = db.UpdateUsage(ctx, s.conn, stale...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to finalize stale drafts: %w", err)
+	}
+	return stale, nil
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/db/dbtest"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestRunJanitor_Validation(t *testing.T) {
+	_, err := (&UsageService{}).RunJanitor(context.Background(), &v1.RunJanitorRequest{})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestRunJanitor_ClosesStaleDrafts(t *testing.T) {
+	conn := dbtest.ConnectForTests(t)
+	now := time.Date(2022, 9, 30, 0, 0, 0, 0, time.UTC)
+	attributionID := db.NewTeamAttributionID(uuid.New().String())
+
+	instance := dbtest.CreateWorkspaceInstances(t, conn, dbtest.NewWorkspaceInstance(t, db.WorkspaceInstance{
+		UsageAttributionID: attributionID,
+	}))[0]
+	old := db.NewVarcharTime(now.AddDate(0, 0, -10))
+	drafts := dbtest.CreateUsageRecords(t, conn,
+		// The instance is gone, and the draft is old.
+		dbtest.NewUsage(t, db.Usage{AttributionID: attributionID, CreditCents: 500, EffectiveTime: old, Draft: true}),
+		// The instance still exists, usage reconciliation finalizes the draft.
+		dbtest.NewUsage(t, db.Usage{AttributionID: attributionID, WorkspaceInstanceID: instance.ID, EffectiveTime: old, Draft: true}),
+		// The instance is gone, but the draft is recent.
+		dbtest.NewUsage(t, db.Usage{AttributionID: attributionID, EffectiveTime: db.NewVarcharTime(now.Add(-time.Hour)), Draft: true}),
+	)
+	t.Cleanup(func() {
+		require.NoError(t, conn.Where("attributionId = ?", attributionID).Delete(&db.CachedBalance{}).Error)
+	})
+
+	service := NewUsageService(conn, nil, nil, DefaultWorkspacePricer, nil, SpendingLimitGraceMargin{}, nil, DefaultDunningPeriods, DefaultDeletedUsageRetention, nil, LogSamplingConfig{}, nil, nil, nil, nil, nil, nil)
+	service.nowFunc = func() time.Time { return now }
+	resp, err := service.RunJanitor(context.Background(), &v1.RunJanitorRequest{
+		DraftsBefore: timestamppb.New(now.AddDate(0, 0, -7)),
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{drafts[0].ID.String()}, resp.GetClosedDraftIds())
+	t.Cleanup(func() {
+		require.NoError(t, conn.Where("id = ?", resp.GetAuditId()).Delete(&db.ReconciliationAudit{}).Error)
+	})
+
+	for i, draft := range []bool{false, true, true} {
+		usage, err := db.GetUsage(context.Background(), conn, drafts[i].ID)
+		require.NoError(t, err)
+		require.Equal(t, draft, usage.Draft)
+		require.Equal(t, drafts[i].CreditCents, usage.CreditCents, "credits must not change")
+	}
+
+	audits, err := db.FindReconciliationAudits(context.Background(), conn, db.JanitorReconciler, 10)
+	require.NoError(t, err)
+	var audit *db.ReconciliationAudit
+	for i := range audits {
+		if audits[i].ID.String() == resp.GetAuditId() {
+			audit = &audits[i]
+		}
+	}
+	require.NotNil(t, audit, "janitor run must be recorded")
+
+	var summary janitorSummary
+	require.NoError(t, json.Unmarshal(audit.Summary, &summary))
+	require.Equal(t, resp.GetClosedDraftIds(), summary.ClosedDraftIDs)
+	require.Equal(t, 5.0, summary.ClosedDraftCredits)
+}
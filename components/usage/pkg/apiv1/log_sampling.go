@@ -0,0 +1,148 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultLogSamplingRecordLines        = 20
+	DefaultLogSamplingSummaryInterval    = 1000
+	DefaultLogSamplingRollupAttributions = 10
+)
+
+// LogSamplingConfig bounds the lines which reconciliation logs per record, e.g. per workspace instance or attribution
+// ID. Records beyond the first RecordLines of a run are counted instead, and summarized per attribution ID.
+//
+// Sampling is bypassed while the log level is debug, which can be set at runtime on the /debug/logging endpoint of the
+// debug listener.
+type LogSamplingConfig struct {
+	// RecordLines is the number of records per run and message which are logged individually. When RecordLines is 0,
+	// DefaultLogSamplingRecordLines applies.
+	RecordLines int `json:"recordLines,omitempty"`
+
+	// SummaryInterval is the number of suppressed records after which an intermediate summary is logged, such that
+	// long runs show progress. When SummaryInterval is 0, DefaultLogSamplingSummaryInterval applies.
+	SummaryInterval int `json:"summaryInterval,omitempty"`
+
+	// RollupAttributions is the number of attribution IDs with the most records which summaries list. When
+	// RollupAttributions is 0, DefaultLogSamplingRollupAttributions applies.
+	RollupAttributions int `json:"rollupAttributions,omitempty"`
+}
+
+func (c LogSamplingConfig) Validate() error {
+	if c.RecordLines < 0 {
+		return fmt.Errorf("record lines must not be negative, was %d", c.RecordLines)
+	}
+	if c.SummaryInterval < 0 {
+		return fmt.Errorf("summary interval must not be negative, was %d", c.SummaryInterval)
+	}
+	if c.RollupAttributions < 0 {
+		return fmt.Errorf("rollup attributions must not be negative, was %d", c.RollupAttributions)
+	}
+	return nil
+}
+
+func (c LogSamplingConfig) withDefaults() LogSamplingConfig {
+	if c.RecordLines == 0 {
+		c.RecordLines = DefaultLogSamplingRecordLines
+	}
+	if c.SummaryInterval == 0 {
+		c.SummaryInterval = DefaultLogSamplingSummaryInterval
+	}
+	if c.RollupAttributions == 0 {
+		c.RollupAttributions = DefaultLogSamplingRollupAttributions
+	}
+	return c
+}
+
+// recordLogSampler logs a message once per record, for the first records of a run only. It is not safe for
+// concurrent use, every run uses its own sampler.
+type recordLogSampler struct {
+	cfg     LogSamplingConfig
+	logger  *logrus.Entry
+	level   logrus.Level
+	message string
+
+	records       int
+	byAttribution map[db.AttributionID]int
+}
+
+// newRecordLogSampler returns a sampler of message, whose summaries are logged with logger.
+func newRecordLogSampler(cfg LogSamplingConfig, logger *logrus.Entry, level logrus.Level, message string) *recordLogSampler {
+	return &recordLogSampler{
+		cfg:           cfg.withDefaults(),
+		logger:        logger,
+		level:         level,
+		message:       message,
+		byAttribution: map[db.AttributionID]int{},
+	}
+}
+
+// Log logs the message with the fields of entry, unless the run logged enough records already.
+func (s *recordLogSampler) Log(entry *logrus.Entry, attributionID db.AttributionID) {
+	s.records++
+	s.byAttribution[attributionID]++
+
+	if s.records <= s.cfg.RecordLines || entry.Logger.IsLevelEnabled(logrus.DebugLevel) {
+		entry.Log(s.level, s.message)
+		return
+	}
+	if (s.records-s.cfg.RecordLines)%s.cfg.SummaryInterval == 0 {
+		s.summarize()
+	}
+}
+
+// Close logs the summary of the run, if records were suppressed.
+func (s *recordLogSampler) Close() {
+	if s.suppressed() == 0 || s.suppressed()%s.cfg.SummaryInterval == 0 {
+		return
+	}
+	s.summarize()
+}
+
+func (s *recordLogSampler) suppressed() int {
+	if s.records <= s.cfg.RecordLines || s.logger.Logger.IsLevelEnabled(logrus.DebugLevel) {
+		return 0
+	}
+	return s.records - s.cfg.RecordLines
+}
+
+func (s *recordLogSampler) summarize() {
+	s.logger.
+		WithField("records", s.records).
+		WithField("suppressed_records", s.suppressed()).
+		WithField("attribution_ids", len(s.byAttribution)).
+		WithField("records_by_attribution", s.rollup()).
+		Logf(s.level, "%s (%d records, only the first %d were logged)", s.message, s.records, s.cfg.RecordLines)
+}
+
+// rollup returns the record counts of the attribution IDs with the most records.
+func (s *recordLogSampler) rollup() map[db.AttributionID]int {
+	ids := make([]db.AttributionID, 0, len(s.byAttribution))
+	for id := range s.byAttribution {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if s.byAttribution[ids[i]] != s.byAttribution[ids[j]] {
+			return s.byAttribution[ids[i]] > s.byAttribution[ids[j]]
+		}
+		return ids[i] < ids[j]
+	})
+	if len(ids) > s.cfg.RollupAttributions {
+		ids = ids[:s.cfg.RollupAttributions]
+	}
+
+	rollup := make(map[db.AttributionID]int, len(ids))
+	for _, id := range ids {
+		rollup[id] = s.byAttribution[id]
+	}
+	return rollup
+}
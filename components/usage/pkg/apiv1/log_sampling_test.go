@@ -0,0 +1,88 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"testing"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogSamplingConfig_Validate(t *testing.T) {
+	require.NoError(t, LogSamplingConfig{}.Validate())
+	require.NoError(t, LogSamplingConfig{RecordLines: 5, SummaryInterval: 100, RollupAttributions: 3}.Validate())
+	require.Error(t, LogSamplingConfig{RecordLines: -1}.Validate())
+	require.Error(t, LogSamplingConfig{SummaryInterval: -1}.Validate())
+	require.Error(t, LogSamplingConfig{RollupAttributions: -1}.Validate())
+}
+
+func TestRecordLogSampler(t *testing.T) {
+	teamA := db.NewTeamAttributionID("a")
+	teamB := db.NewTeamAttributionID("b")
+	teamC := db.NewTeamAttributionID("c")
+
+	logger, hook := test.NewNullLogger()
+	logger.SetLevel(logrus.InfoLevel)
+	entry := logrus.NewEntry(logger)
+
+	sampler := newRecordLogSampler(LogSamplingConfig{RecordLines: 2, SummaryInterval: 3, RollupAttributions: 2}, entry, logrus.WarnLevel, "Record.")
+	for _, id := range []db.AttributionID{teamA, teamB, teamA, teamA, teamC, teamB, teamA} {
+		sampler.Log(entry.WithField("attribution_id", id), id)
+	}
+	sampler.Close()
+
+	entries := hook.AllEntries()
+	require.Len(t, entries, 4, "two records, one intermediate summary and the final summary")
+
+	require.Equal(t, "Record.", entries[0].Message)
+	require.Equal(t, teamA, entries[0].Data["attribution_id"])
+	require.Equal(t, logrus.WarnLevel, entries[0].Level)
+	require.Equal(t, "Record.", entries[1].Message)
+	require.Equal(t, teamB, entries[1].Data["attribution_id"])
+
+	require.Equal(t, 5, entries[2].Data["records"])
+	require.Equal(t, 3, entries[2].Data["suppressed_records"])
+
+	summary := entries[3]
+	require.Equal(t, logrus.WarnLevel, summary.Level)
+	require.Equal(t, "Record. (7 records, only the first 2 were logged)", summary.Message)
+	require.Equal(t, 7, summary.Data["records"])
+	require.Equal(t, 5, summary.Data["suppressed_records"])
+	require.Equal(t, 3, summary.Data["attribution_ids"])
+	require.Equal(t, map[db.AttributionID]int{teamA: 4, teamB: 2}, summary.Data["records_by_attribution"])
+}
+
+func TestRecordLogSampler_NoSummaryWithinRecordLines(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	entry := logrus.NewEntry(logger)
+
+	sampler := newRecordLogSampler(LogSamplingConfig{}, entry, logrus.InfoLevel, "Record.")
+	for i := 0; i < DefaultLogSamplingRecordLines; i++ {
+		sampler.Log(entry, db.NewTeamAttributionID("a"))
+	}
+	sampler.Close()
+
+	require.Len(t, hook.AllEntries(), DefaultLogSamplingRecordLines)
+}
+
+func TestRecordLogSampler_DebugLogsEveryRecord(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	logger.SetLevel(logrus.DebugLevel)
+	entry := logrus.NewEntry(logger)
+
+	sampler := newRecordLogSampler(LogSamplingConfig{RecordLines: 1}, entry, logrus.InfoLevel, "Record.")
+	for i := 0; i < 10; i++ {
+		sampler.Log(entry, db.NewTeamAttributionID("a"))
+	}
+	sampler.Close()
+
+	require.Len(t, hook.AllEntries(), 10)
+	for _, e := range hook.AllEntries() {
+		require.Equal(t, "Record.", e.Message)
+	}
+}
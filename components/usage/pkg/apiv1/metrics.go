@@ -0,0 +1,196 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/codes"
+)
+
+const (
+	namespace = "gitpod"
+	subsystem = "usage"
+
+	sloAvailability = "availability"
+	sloLatency      = "latency"
+
+	// otherMetricLabel replaces label values outside of the known set, such that the cardinality of metrics is bounded
+	// by the configuration, not by the data.
+	otherMetricLabel = "other"
+)
+
+var (
+	// oldestDraftEffectiveTime is the effective time of the draft usage which was written longest ago, in unix
+	// nanoseconds, as of the last ledger reconciliation. It is 0 when there were no drafts.
+	oldestDraftEffectiveTime int64
+
+	creditsBilledTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "credits_billed_total",
+		Help:      "Credits of workspace usage written to the ledger by reconciliation, by workspace class and type. Workspace classes without configured price are reported as other.",
+	}, []string{"workspace_class", "workspace_type"})
+
+	oldestDraftAgeSeconds = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "oldest_draft_age_seconds",
+		Help:      "Seconds since the effective time of the oldest unfinalized draft usage, as of the last ledger reconciliation. Reconciliation moves the effective time of drafts to the present, the age grows when drafts are not reconciled.",
+	}, func() float64 {
+		return oldestDraftAge(time.Now()).Seconds()
+	})
+
+	sloRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "slo_requests_total",
+		Help:      "Calls of RPCs with service level objectives, by method and objective",
+	}, []string{"method", "slo"})
+
+	sloFailedRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "slo_failed_requests_total",
+		Help:      "Calls of RPCs which count against the error budget of the objective: server errors for availability, calls slower than the threshold for latency",
+	}, []string{"method", "slo"})
+
+	sloObjectiveRatio = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "slo_objective_ratio",
+		Help:      "Ratio of calls which must meet the objective",
+	}, []string{"method", "slo"})
+
+	sloLatencyThresholdSeconds = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "slo_latency_threshold_seconds",
+		Help:      "Duration within which calls meet the latency objective",
+	}, []string{"method"})
+
+	externalPricingRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "external_pricing_requests_total",
+		Help:      "Calls of the external pricing service, by outcome: priced, static when it deferred to the static rates, or failed. Rates served from the cache are not counted",
+	}, []string{"outcome"})
+)
+
+func RegisterMetrics(reg *prometheus.Registry) error {
+	metrics := []prometheus.Collector{
+		creditsBilledTotal,
+		oldestDraftAgeSeconds,
+		sloRequestsTotal,
+		sloFailedRequestsTotal,
+		sloObjectiveRatio,
+		sloLatencyThresholdSeconds,
+		externalPricingRequestsTotal,
+	}
+	for _, metric := range metrics {
+		err := reg.Register(metric)
+		if err != nil {
+			return fmt.Errorf("failed to register metric: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// reportCreditsBilled counts the credits which reconciliation writes to the ledger. Updated drafts count with the
+// credits added since they were written last, decreases are not counted.
+func reportCreditsBilled(pricer *WorkspacePricer, drafts []db.Usage, written []db.Usage) {
+	previous := map[uuid.UUID]db.CreditCents{}
+	for _, draft := range drafts {
+		previous[draft.ID] = draft.CreditCents
+	}
+
+	for _, usage := range written {
+		added := usage.CreditCents - previous[usage.ID]
+		if added <= 0 {
+			continue
+		}
+		class, workspaceType := workspaceUsageMetricLabels(pricer, usage)
+		creditsBilledTotal.WithLabelValues(class, workspaceType).Add(added.ToCredits())
+	}
+}
+
+func workspaceUsageMetricLabels(pricer *WorkspacePricer, usage db.Usage) (class string, workspaceType string) {
+	data, err := usage.GetMetadataAsWorkspaceInstanceData()
+	if err != nil {
+		return otherMetricLabel, otherMetricLabel
+	}
+
+	class = data.WorkspaceClass
+	if class == "" {
+		class = defaultWorkspaceClass
+	}
+	if !pricer.hasWorkspaceClass(class) {
+		class = otherMetricLabel
+	}
+
+	switch data.WorkspaceType {
+	case db.WorkspaceType_Regular, db.WorkspaceType_Prebuild, db.WorkspaceType_Probe:
+		workspaceType = string(data.WorkspaceType)
+	default:
+		workspaceType = otherMetricLabel
+	}
+	return class, workspaceType
+}
+
+// reportOldestDraft records the oldest effective time of the drafts which remain after reconciliation wrote the
+// usage. Written usage supersedes the draft with the same ID.
+func reportOldestDraft(drafts []db.Usage, written []db.Usage) {
+	remaining := map[uuid.UUID]db.Usage{}
+	for _, draft := range drafts {
+		remaining[draft.ID] = draft
+	}
+	for _, usage := range written {
+		remaining[usage.ID] = usage
+	}
+
+	var oldest time.Time
+	for _, usage := range remaining {
+		if !usage.Draft || !usage.EffectiveTime.IsSet() {
+			continue
+		}
+		if oldest.IsZero() || usage.EffectiveTime.Time().Before(oldest) {
+			oldest = usage.EffectiveTime.Time()
+		}
+	}
+
+	var nanos int64
+	if !oldest.IsZero() {
+		nanos = oldest.UnixNano()
+	}
+	atomic.StoreInt64(&oldestDraftEffectiveTime, nanos)
+}
+
+func oldestDraftAge(now time.Time) time.Duration {
+	nanos := atomic.LoadInt64(&oldestDraftEffectiveTime)
+	if nanos == 0 {
+		return 0
+	}
+	return now.Sub(time.Unix(0, nanos))
+}
+
+func reportSLORequest(method string, objective SLOObjective, duration time.Duration, code codes.Code) {
+	sloRequestsTotal.WithLabelValues(method, sloAvailability).Inc()
+	if countsAgainstAvailability(code) {
+		// Failed calls only count against availability, they often fail fast.
+		sloFailedRequestsTotal.WithLabelValues(method, sloAvailability).Inc()
+		return
+	}
+
+	sloRequestsTotal.WithLabelValues(method, sloLatency).Inc()
+	if duration > time.Duration(objective.Latency) {
+		sloFailedRequestsTotal.WithLabelValues(method, sloLatency).Inc()
+	}
+}
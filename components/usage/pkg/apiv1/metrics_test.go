@@ -0,0 +1,78 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReportCreditsBilled(t *testing.T) {
+	pricer, err := NewWorkspacePricer(map[string]float64{
+		"default":          0.1666666667,
+		"g1-large":         0.3333333333,
+		"g1-xlarge-custom": 0.5,
+	})
+	require.NoError(t, err)
+
+	usage := func(creditCents db.CreditCents, class string, workspaceType db.WorkspaceType) db.Usage {
+		u := db.Usage{ID: uuid.New(), CreditCents: creditCents, Kind: db.WorkspaceInstanceUsageKind}
+		require.NoError(t, u.SetMetadataWithWorkspaceInstance(db.WorkspaceInstanceUsageData{WorkspaceClass: class, WorkspaceType: workspaceType}))
+		return u
+	}
+	counter := func(class, workspaceType string) float64 {
+		return testutil.ToFloat64(creditsBilledTotal.WithLabelValues(class, workspaceType))
+	}
+
+	draft := usage(150, "g1-large", db.WorkspaceType_Regular)
+	updated := draft
+	updated.CreditCents = 400
+	shrunk := usage(300, "g1-large", db.WorkspaceType_Regular)
+	shrunkDraft := shrunk
+	shrunkDraft.CreditCents = 500
+
+	largeRegular := counter("g1-large", "regular")
+	defaultPrebuild := counter("default", "prebuild")
+	other := counter(otherMetricLabel, "regular")
+
+	reportCreditsBilled(pricer, []db.Usage{draft, shrunkDraft}, []db.Usage{
+		usage(100, "", db.WorkspaceType_Prebuild),
+		usage(200, "g1-large", db.WorkspaceType_Regular),
+		usage(50, "unpriced-class", db.WorkspaceType_Regular),
+		updated,
+		shrunk,
+	})
+
+	require.InDelta(t, 4.5, counter("g1-large", "regular")-largeRegular, 0.0001, "inserts count fully, updates count with the added credits")
+	require.InDelta(t, 1, counter("default", "prebuild")-defaultPrebuild, 0.0001, "usage without class is priced at the default class")
+	require.InDelta(t, 0.5, counter(otherMetricLabel, "regular")-other, 0.0001, "classes without price are reported as other")
+}
+
+func TestReportOldestDraft(t *testing.T) {
+	now := time.Date(2022, 10, 7, 12, 0, 0, 0, time.UTC)
+	draft := func(effectiveTime time.Time) db.Usage {
+		return db.Usage{ID: uuid.New(), Draft: true, EffectiveTime: db.NewVarcharTime(effectiveTime)}
+	}
+
+	reconciled := draft(now.Add(-2 * time.Hour))
+	finalized := draft(now.Add(-3 * time.Hour))
+	stale := draft(now.Add(-1 * time.Hour))
+
+	updated := reconciled
+	updated.EffectiveTime = db.NewVarcharTime(now)
+	closed := finalized
+	closed.Draft = false
+
+	reportOldestDraft([]db.Usage{reconciled, finalized, stale}, []db.Usage{updated, closed, draft(now)})
+	require.Equal(t, time.Hour, oldestDraftAge(now), "must report the oldest draft which was not updated")
+
+	reportOldestDraft(nil, []db.Usage{closed})
+	require.Zero(t, oldestDraftAge(now), "must report no age without drafts")
+}
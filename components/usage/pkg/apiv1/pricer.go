@@ -5,7 +5,12 @@
 package apiv1
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/gitpod-io/gitpod/usage/pkg/db"
@@ -13,6 +18,8 @@ import (
 
 const (
 	defaultWorkspaceClass = "default"
+	// defaultPlan is the plan of cost centers which never changed their plan.
+	defaultPlan = "default"
 )
 
 var (
@@ -20,29 +27,64 @@ var (
 		// 1 credit = 6 minutes
 		"default": float64(1) / float64(6),
 	})
+
+	// errPricingUnavailable is returned when the external pricing service could not price an instance. The instance must
+	// be priced again later, the static rates must not be used instead.
+	errPricingUnavailable = errors.New("pricing service is unavailable")
 )
 
 func NewWorkspacePricer(creditMinutesByWorkspaceClass map[string]float64) (*WorkspacePricer, error) {
+	return NewWorkspacePricerWithPlans(creditMinutesByWorkspaceClass, nil)
+}
+
+// NewWorkspacePricerWithPlans creates a pricer which prices the usage of cost centers on a plan listed in
+// `creditMinutesByPlan` at the rates of that plan, instead of the default `creditMinutesByWorkspaceClass`.
+func NewWorkspacePricerWithPlans(creditMinutesByWorkspaceClass map[string]float64, creditMinutesByPlan map[string]map[string]float64) (*WorkspacePricer, error) {
 	if _, ok := creditMinutesByWorkspaceClass[defaultWorkspaceClass]; !ok {
 		return nil, fmt.Errorf("credits per minute not defined for expected workspace class 'default'")
 	}
+	for plan, rates := range creditMinutesByPlan {
+		if _, ok := rates[defaultWorkspaceClass]; !ok {
+			return nil, fmt.Errorf("credits per minute not defined for expected workspace class 'default' of plan %q", plan)
+		}
+	}
 
-	return &WorkspacePricer{creditMinutesByWorkspaceClass: creditMinutesByWorkspaceClass}, nil
+	return &WorkspacePricer{
+		creditMinutesByWorkspaceClass: creditMinutesByWorkspaceClass,
+		creditMinutesByPlan:           creditMinutesByPlan,
+	}, nil
 }
 
 type WorkspacePricer struct {
 	creditMinutesByWorkspaceClass map[string]float64
+	creditMinutesByPlan           map[string]map[string]float64
+
+	// external is asked for the rates of instances before the static rates, see WithExternalPricing. It is optional.
+	external *externalPricer
 }
 
-func (p *WorkspacePricer) CreditsUsedByInstance(instance *db.WorkspaceInstanceForUsage, maxStopTime time.Time) float64 {
+func (p *WorkspacePricer) CreditsUsedByInstance(ctx context.Context, instance *db.WorkspaceInstanceForUsage, maxStopTime time.Time) (float64, error) {
 	runtime := instance.WorkspaceRuntimeSeconds(maxStopTime)
 	class := defaultWorkspaceClass
 	if instance.WorkspaceClass != "" {
 		class = instance.WorkspaceClass
 	}
-	return p.Credits(class, runtime)
+	rate, err := p.creditsPerMinute(ctx, instance.UsageAttributionID, defaultPlan, class, p.CreditsPerMinuteForClass(class))
+	if err != nil {
+		return 0, err
+	}
+	return rate * float64(runtime) / 60, nil
 }
 
+// creditsPerMinute returns the rate of the external pricing service if there is one, otherwise the static rate.
+func (p *WorkspacePricer) creditsPerMinute(ctx context.Context, attributionID db.AttributionID, plan, workspaceClass string, static float64) (float64, error) {
+	if p.external == nil {
+		return static, nil
+	}
+	return p.external.creditsPerMinute(ctx, attributionID, plan, workspaceClass, static)
+}
+
+// Credits prices the runtime at the static rate of the workspace class.
 func (p *WorkspacePricer) Credits(workspaceClass string, runtimeInSeconds int64) float64 {
 	inMinutes := float64(runtimeInSeconds) / 60
 	return p.CreditsPerMinuteForClass(workspaceClass) * inMinutes
@@ -54,3 +96,130 @@ func (p *WorkspacePricer) CreditsPerMinuteForClass(workspaceClass string) float6
 	}
 	return p.creditMinutesByWorkspaceClass[defaultWorkspaceClass]
 }
+
+// hasWorkspaceClass returns whether credits per minute are configured for the workspace class, by default or by a plan.
+func (p *WorkspacePricer) hasWorkspaceClass(workspaceClass string) bool {
+	if _, ok := p.creditMinutesByWorkspaceClass[workspaceClass]; ok {
+		return true
+	}
+	for _, rates := range p.creditMinutesByPlan {
+		if _, ok := rates[workspaceClass]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// CreditsPerMinuteForPlan returns the rate of the workspace class for cost centers on the given plan. Plans without
+// configured rates use the default rates.
+func (p *WorkspacePricer) CreditsPerMinuteForPlan(plan, workspaceClass string) float64 {
+	rates, ok := p.creditMinutesByPlan[plan]
+	if !ok {
+		return p.CreditsPerMinuteForClass(workspaceClass)
+	}
+	if creditsForClass, ok := rates[workspaceClass]; ok {
+		return creditsForClass
+	}
+	return rates[defaultWorkspaceClass]
+}
+
+// CreditsUsedByInstanceWithPlanChanges prices the runtime of the instance at the plan which was active at the time,
+// splitting the runtime at each of the plan changes. `changes` must be ordered by effective time. Runtime before the
+// first change is priced at the default rates.
+func (p *WorkspacePricer) CreditsUsedByInstanceWithPlanChanges(ctx context.Context, instance *db.WorkspaceInstanceForUsage, changes []db.PlanChange, maxStopTime time.Time) (float64, []db.PricingSegment, error) {
+	if len(changes) == 0 {
+		credits, err := p.CreditsUsedByInstance(ctx, instance, maxStopTime)
+		return credits, nil, err
+	}
+
+	class := defaultWorkspaceClass
+	if instance.WorkspaceClass != "" {
+		class = instance.WorkspaceClass
+	}
+
+	start := instance.StartedTime.Time()
+	stop := maxStopTime
+	if instance.StoppingTime.IsSet() && instance.StoppingTime.Time().Before(maxStopTime) {
+		stop = instance.StoppingTime.Time()
+	}
+
+	var total float64
+	var segments []db.PricingSegment
+	addSegment := func(plan string, from, to time.Time) error {
+		rate, err := p.creditsPerMinute(ctx, instance.UsageAttributionID, plan, class, p.CreditsPerMinuteForPlan(plan, class))
+		if err != nil {
+			return err
+		}
+		runtime := int64(to.Sub(from).Round(time.Second).Seconds())
+		credits := rate * float64(runtime) / 60
+
+		total += credits
+		segments = append(segments, db.PricingSegment{
+			Plan:             plan,
+			StartTime:        db.TimeToISO8601(from),
+			EndTime:          db.TimeToISO8601(to),
+			CreditsPerMinute: rate,
+			Credits:          credits,
+		})
+		return nil
+	}
+
+	plan := defaultPlan
+	segmentStart := start
+	for _, change := range changes {
+		effective := change.EffectiveTime.Time()
+		if !effective.After(segmentStart) {
+			// the change happened before the instance started, it determines the plan of the first segment
+			plan = change.Plan
+			continue
+		}
+		if !effective.Before(stop) {
+			break
+		}
+
+		if err := addSegment(plan, segmentStart, effective); err != nil {
+			return 0, nil, err
+		}
+		plan = change.Plan
+		segmentStart = effective
+	}
+	if err := addSegment(plan, segmentStart, stop); err != nil {
+		return 0, nil, err
+	}
+
+	return total, segments, nil
+}
+
+// ConfigHash returns a stable hash of the pricing configuration, such that reports generated with different prices can be told apart.
+func (p *WorkspacePricer) ConfigHash() string {
+	var classes []string
+	for class := range p.creditMinutesByWorkspaceClass {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+
+	h := sha256.New()
+	for _, class := range classes {
+		fmt.Fprintf(h, "%s=%v\n", class, p.creditMinutesByWorkspaceClass[class])
+	}
+
+	var plans []string
+	for plan := range p.creditMinutesByPlan {
+		plans = append(plans, plan)
+	}
+	sort.Strings(plans)
+	for _, plan := range plans {
+		var planClasses []string
+		for class := range p.creditMinutesByPlan[plan] {
+			planClasses = append(planClasses, class)
+		}
+		sort.Strings(planClasses)
+		for _, class := range planClasses {
+			fmt.Fprintf(h, "%s/%s=%v\n", plan, class, p.creditMinutesByPlan[plan][class])
+		}
+	}
+	if p.external != nil {
+		fmt.Fprintf(h, "external=%s\n", p.external.address)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
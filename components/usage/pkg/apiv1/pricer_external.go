@@ -0,0 +1,166 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/gitpod-io/gitpod/common-go/util"
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+)
+
+const (
+	defaultExternalPricingTimeout  = 2 * time.Second
+	defaultExternalPricingCacheTTL = 5 * time.Minute
+	// externalPricingRetryAfter is how long pricing fails without calling the pricing service after a call failed, such
+	// that reconciliation does not wait for the timeout of every instance while the service is unavailable.
+	externalPricingRetryAfter = 30 * time.Second
+	// maxExternalPricingCacheEntries bounds the memory of the cache, it is cleared when it grows larger.
+	maxExternalPricingCacheEntries = 100000
+)
+
+// ExternalPricingConfig configures a v1.PricingService, which the pricer asks for the rates of workspace classes. The
+// static rates only apply when the pricing service defers to them.
+type ExternalPricingConfig struct {
+	// Address is the gRPC address of the pricing service.
+	Address string `json:"address"`
+	// Timeout bounds each call of the pricing service. When Timeout is 0, calls time out after 2 seconds.
+	Timeout util.Duration `json:"timeout,omitempty"`
+	// CacheTTL is how long rates of the pricing service are used before they are requested again. When CacheTTL is 0,
+	// rates are cached for 5 minutes.
+	CacheTTL util.Duration `json:"cacheTTL,omitempty"`
+}
+
+type externalRateKey struct {
+	attributionID  db.AttributionID
+	plan           string
+	workspaceClass string
+}
+
+type externalRate struct {
+	creditsPerMinute float64
+	// static is true when the pricing service deferred to the static rates.
+	static  bool
+	expires time.Time
+}
+
+// externalPricer asks a pricing service for rates, and caches them.
+type externalPricer struct {
+	address string
+	client  v1.PricingServiceClient
+	timeout time.Duration
+	ttl     time.Duration
+	nowFunc func() time.Time
+
+	mu               sync.Mutex
+	cache            map[externalRateKey]externalRate
+	unavailableUntil time.Time
+}
+
+// WithExternalPricing returns a copy of the pricer which asks the pricing service for rates, and uses its own rates
+// when the pricing service defers to them. Pricing fails with errPricingUnavailable while the pricing service is
+// unavailable.
+func (p *WorkspacePricer) WithExternalPricing(client v1.PricingServiceClient, cfg ExternalPricingConfig) (*WorkspacePricer, error) {
+	if cfg.Address == "" {
+		return nil, errors.New("no pricing service address specified")
+	}
+	timeout := time.Duration(cfg.Timeout)
+	if timeout < 0 {
+		return nil, fmt.Errorf("invalid pricing service timeout of %s", timeout)
+	}
+	if timeout == 0 {
+		timeout = defaultExternalPricingTimeout
+	}
+	ttl := time.Duration(cfg.CacheTTL)
+	if ttl < 0 {
+		return nil, fmt.Errorf("invalid pricing cache TTL of %s", ttl)
+	}
+	if ttl == 0 {
+		ttl = defaultExternalPricingCacheTTL
+	}
+
+	return &WorkspacePricer{
+		creditMinutesByWorkspaceClass: p.creditMinutesByWorkspaceClass,
+		creditMinutesByPlan:           p.creditMinutesByPlan,
+		external: &externalPricer{
+			address: cfg.Address,
+			client:  client,
+			timeout: timeout,
+			ttl:     ttl,
+			nowFunc: time.Now,
+			cache:   map[externalRateKey]externalRate{},
+		},
+	}, nil
+}
+
+// creditsPerMinute returns the rate of the pricing service, or `static` when it defers to the static rates. It fails
+// with errPricingUnavailable when the pricing service fails, responds with an invalid rate, or failed less than
+// externalPricingRetryAfter ago.
+func (e *externalPricer) creditsPerMinute(ctx context.Context, attributionID db.AttributionID, plan, workspaceClass string, static float64) (float64, error) {
+	key := externalRateKey{attributionID: attributionID, plan: plan, workspaceClass: workspaceClass}
+	now := e.nowFunc()
+
+	e.mu.Lock()
+	cached, ok := e.cache[key]
+	unavailableUntil := e.unavailableUntil
+	e.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		if cached.static {
+			return static, nil
+		}
+		return cached.creditsPerMinute, nil
+	}
+	if now.Before(unavailableUntil) {
+		return 0, fmt.Errorf("%w: retrying after %s", errPricingUnavailable, unavailableUntil.Format(time.RFC3339))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+	resp, err := e.client.GetCreditsPerMinute(ctx, &v1.GetCreditsPerMinuteRequest{
+		AttributionId:  string(attributionID),
+		Plan:           plan,
+		WorkspaceClass: workspaceClass,
+	})
+	if err == nil && !resp.GetUseStaticRate() && (resp.GetCreditsPerMinute() < 0 || math.IsNaN(resp.GetCreditsPerMinute()) || math.IsInf(resp.GetCreditsPerMinute(), 0)) {
+		err = fmt.Errorf("invalid rate of %v credits per minute", resp.GetCreditsPerMinute())
+	}
+	if err != nil {
+		externalPricingRequestsTotal.WithLabelValues("failed").Inc()
+
+		e.mu.Lock()
+		e.unavailableUntil = now.Add(externalPricingRetryAfter)
+		e.mu.Unlock()
+		return 0, fmt.Errorf("%w: failed to get rate of workspace class %s for %s from %s: %v", errPricingUnavailable, workspaceClass, attributionID, e.address, err)
+	}
+
+	rate := externalRate{
+		creditsPerMinute: resp.GetCreditsPerMinute(),
+		static:           resp.GetUseStaticRate(),
+		expires:          now.Add(e.ttl),
+	}
+	if rate.static {
+		externalPricingRequestsTotal.WithLabelValues("static").Inc()
+	} else {
+		externalPricingRequestsTotal.WithLabelValues("priced").Inc()
+	}
+
+	e.mu.Lock()
+	if len(e.cache) >= maxExternalPricingCacheEntries {
+		e.cache = map[externalRateKey]externalRate{}
+	}
+	e.cache[key] = rate
+	e.mu.Unlock()
+
+	if rate.static {
+		return static, nil
+	}
+	return rate.creditsPerMinute, nil
+}
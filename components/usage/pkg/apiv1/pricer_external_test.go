@@ -0,0 +1,176 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/gitpod-io/gitpod/common-go/util"
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+type fakePricingService struct {
+	requests []*v1.GetCreditsPerMinuteRequest
+	contexts []context.Context
+	resp     *v1.GetCreditsPerMinuteResponse
+	err      error
+}
+
+func (f *fakePricingService) GetCreditsPerMinute(ctx context.Context, in *v1.GetCreditsPerMinuteRequest, opts ...grpc.CallOption) (*v1.GetCreditsPerMinuteResponse, error) {
+	f.requests = append(f.requests, in)
+	f.contexts = append(f.contexts, ctx)
+	return f.resp, f.err
+}
+
+func newExternalPricerForTests(t *testing.T, service *fakePricingService, now *time.Time) *WorkspacePricer {
+	t.Helper()
+
+	static, err := NewWorkspacePricerWithPlans(map[string]float64{"default": 0.1, "large": 0.2}, map[string]map[string]float64{
+		"enterprise": {"default": 0.05},
+	})
+	require.NoError(t, err)
+	pricer, err := static.WithExternalPricing(service, ExternalPricingConfig{Address: "pricing:9000", CacheTTL: util.Duration(time.Minute)})
+	require.NoError(t, err)
+	pricer.external.nowFunc = func() time.Time { return *now }
+	return pricer
+}
+
+func TestWorkspacePricer_ExternalPricing(t *testing.T) {
+	now := time.Date(2022, 10, 15, 12, 0, 0, 0, time.UTC)
+	service := &fakePricingService{resp: &v1.GetCreditsPerMinuteResponse{CreditsPerMinute: 1}}
+	pricer := newExternalPricerForTests(t, service, &now)
+
+	start := now.Add(-2 * time.Hour)
+	instance := &db.WorkspaceInstanceForUsage{
+		UsageAttributionID: db.NewTeamAttributionID("team-a"),
+		WorkspaceClass:     "large",
+		StartedTime:        db.NewVarcharTime(start),
+		StoppingTime:       db.NewVarcharTime(start.Add(time.Hour)),
+	}
+	require.InDelta(t, 60, creditsUsedByInstance(t, pricer, instance, now), 0.0000001)
+	require.Len(t, service.requests, 1)
+	require.Equal(t, "team:team-a", service.requests[0].GetAttributionId())
+	require.Equal(t, "default", service.requests[0].GetPlan())
+	require.Equal(t, "large", service.requests[0].GetWorkspaceClass())
+
+	require.InDelta(t, 60, creditsUsedByInstance(t, pricer, instance, now), 0.0000001)
+	require.Len(t, service.requests, 1, "must use cached rates")
+
+	now = now.Add(2 * time.Minute)
+	service.resp = &v1.GetCreditsPerMinuteResponse{UseStaticRate: true}
+	require.InDelta(t, 12, creditsUsedByInstance(t, pricer, instance, now), 0.0000001, "must use the static rate when the pricing service defers to it")
+	require.Len(t, service.requests, 2, "must request rates again once they expired")
+
+	credits, segments, err := pricer.CreditsUsedByInstanceWithPlanChanges(context.Background(), instance, []db.PlanChange{
+		{Plan: "enterprise", EffectiveTime: db.NewVarcharTime(start.Add(30 * time.Minute))},
+	}, now)
+	require.NoError(t, err)
+	require.Equal(t, "enterprise", service.requests[len(service.requests)-1].GetPlan())
+	require.Len(t, segments, 2)
+	require.InDelta(t, 0.2, segments[0].CreditsPerMinute, 0.0000001)
+	require.InDelta(t, 0.05, segments[1].CreditsPerMinute, 0.0000001, "must fall back to the static rate of the plan")
+	require.InDelta(t, 7.5, credits, 0.0000001)
+
+	require.NotEqual(t, pricer.ConfigHash(), DefaultWorkspacePricer.ConfigHash())
+}
+
+func TestWorkspacePricer_ExternalPricingUnavailable(t *testing.T) {
+	now := time.Date(2022, 10, 15, 12, 0, 0, 0, time.UTC)
+	service := &fakePricingService{err: errors.New("unavailable")}
+	pricer := newExternalPricerForTests(t, service, &now)
+
+	instance := &db.WorkspaceInstanceForUsage{
+		UsageAttributionID: db.NewTeamAttributionID("team-a"),
+		StartedTime:        db.NewVarcharTime(now.Add(-time.Hour)),
+		StoppingTime:       db.NewVarcharTime(now),
+	}
+	_, err := pricer.CreditsUsedByInstance(context.Background(), instance, now)
+	require.ErrorIs(t, err, errPricingUnavailable, "must not fall back to the static rates")
+	_, err = pricer.CreditsUsedByInstance(context.Background(), instance, now)
+	require.ErrorIs(t, err, errPricingUnavailable)
+	require.Len(t, service.requests, 1, "must not call an unavailable pricing service again right away")
+
+	now = now.Add(externalPricingRetryAfter)
+	service.err = nil
+	service.resp = &v1.GetCreditsPerMinuteResponse{CreditsPerMinute: math.NaN()}
+	_, err = pricer.CreditsUsedByInstance(context.Background(), instance, now)
+	require.ErrorIs(t, err, errPricingUnavailable, "must reject invalid rates")
+	require.Len(t, service.requests, 2)
+}
+
+func TestWorkspacePricer_ExternalPricingUsesCallerContext(t *testing.T) {
+	now := time.Date(2022, 10, 15, 12, 0, 0, 0, time.UTC)
+	service := &fakePricingService{resp: &v1.GetCreditsPerMinuteResponse{CreditsPerMinute: 1}}
+	pricer := newExternalPricerForTests(t, service, &now)
+
+	type key struct{}
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), key{}, "caller"))
+	_, err := pricer.CreditsUsedByInstance(ctx, &db.WorkspaceInstanceForUsage{
+		UsageAttributionID: db.NewTeamAttributionID("team-a"),
+		StartedTime:        db.NewVarcharTime(now.Add(-time.Hour)),
+		StoppingTime:       db.NewVarcharTime(now),
+	}, now)
+	require.NoError(t, err)
+	require.Len(t, service.contexts, 1)
+	require.Equal(t, "caller", service.contexts[0].Value(key{}))
+
+	cancel()
+	require.Error(t, service.contexts[0].Err(), "must cancel calls with the caller")
+}
+
+func TestReconcileUsageWithLedger_PricingUnavailable(t *testing.T) {
+	now := time.Date(2022, 10, 15, 12, 0, 0, 0, time.UTC)
+	service := &fakePricingService{err: errors.New("unavailable")}
+	pricer := newExternalPricerForTests(t, service, &now)
+
+	attributionID := db.NewTeamAttributionID("team-a")
+	stopped := db.WorkspaceInstanceForUsage{
+		ID:                 uuid.New(),
+		UsageAttributionID: attributionID,
+		StartedTime:        db.NewVarcharTime(now.Add(-2 * time.Hour)),
+		StoppingTime:       db.NewVarcharTime(now.Add(-time.Hour)),
+	}
+	withDraft := db.WorkspaceInstanceForUsage{
+		ID:                 uuid.New(),
+		UsageAttributionID: attributionID,
+		StartedTime:        db.NewVarcharTime(now.Add(-2 * time.Hour)),
+		StoppingTime:       db.NewVarcharTime(now.Add(-time.Hour)),
+	}
+	draft := db.Usage{
+		ID:                  db.WorkspaceInstanceUsageID(withDraft.ID, attributionID),
+		AttributionID:       attributionID,
+		CreditCents:         500,
+		Kind:                db.WorkspaceInstanceUsageKind,
+		WorkspaceInstanceID: withDraft.ID,
+		Draft:               true,
+	}
+
+	inserts, updates, err := reconcileUsageWithLedger(context.Background(), []db.WorkspaceInstanceForUsage{stopped, withDraft}, []db.Usage{draft}, pricer, nil, nil, now)
+	require.NoError(t, err)
+	require.Empty(t, updates, "must leave existing drafts unchanged")
+	require.Len(t, inserts, 1)
+	require.Equal(t, stopped.ID, inserts[0].WorkspaceInstanceID)
+	require.True(t, inserts[0].Draft, "must not finalize usage which could not be priced")
+	require.Zero(t, inserts[0].CreditCents)
+}
+
+func TestWorkspacePricer_WithExternalPricingValidation(t *testing.T) {
+	_, err := DefaultWorkspacePricer.WithExternalPricing(&fakePricingService{}, ExternalPricingConfig{})
+	require.Error(t, err, "must require an address")
+
+	_, err = DefaultWorkspacePricer.WithExternalPricing(&fakePricingService{}, ExternalPricingConfig{Address: "pricing:9000", Timeout: util.Duration(-time.Second)})
+	require.Error(t, err)
+
+	_, err = DefaultWorkspacePricer.WithExternalPricing(&fakePricingService{}, ExternalPricingConfig{Address: "pricing:9000", CacheTTL: util.Duration(-time.Second)})
+	require.Error(t, err)
+}
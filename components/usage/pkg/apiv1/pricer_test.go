@@ -5,8 +5,11 @@
 package apiv1
 
 import (
+	"context"
 	"testing"
+	"time"
 
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/stretchr/testify/require"
@@ -68,3 +71,84 @@ func TestWorkspacePricer_Default(t *testing.T) {
 		})
 	}
 }
+
+func TestWorkspacePricer_ConfigHash(t *testing.T) {
+	a, err := NewWorkspacePricer(map[string]float64{"default": 0.1666666667, "large": 0.3333333333})
+	require.NoError(t, err)
+	b, err := NewWorkspacePricer(map[string]float64{"large": 0.3333333333, "default": 0.1666666667})
+	require.NoError(t, err)
+	c, err := NewWorkspacePricer(map[string]float64{"default": 0.1666666667, "large": 0.5})
+	require.NoError(t, err)
+
+	require.Equal(t, a.ConfigHash(), b.ConfigHash(), "hash must not depend on map ordering")
+	require.NotEqual(t, a.ConfigHash(), c.ConfigHash(), "hash must change with prices")
+}
+
+func TestWorkspacePricer_CreditsUsedByInstanceWithPlanChanges(t *testing.T) {
+	pricer, err := NewWorkspacePricerWithPlans(
+		map[string]float64{"default": 0.1},
+		map[string]map[string]float64{
+			"professional": {"default": 0.2},
+		},
+	)
+	require.NoError(t, err)
+
+	start := time.Date(2022, 9, 15, 10, 0, 0, 0, time.UTC)
+	instance := &db.WorkspaceInstanceForUsage{
+		StartedTime:  db.NewVarcharTime(start),
+		StoppingTime: db.NewVarcharTime(start.Add(2 * time.Hour)),
+	}
+	now := start.Add(24 * time.Hour)
+
+	t.Run("no plan changes use the default rates", func(t *testing.T) {
+		credits, segments, err := pricer.CreditsUsedByInstanceWithPlanChanges(context.Background(), instance, nil, now)
+		require.NoError(t, err)
+		require.InDelta(t, 12, credits, 0.0000001)
+		require.Empty(t, segments)
+	})
+
+	t.Run("plan change before the instance started", func(t *testing.T) {
+		credits, segments, err := pricer.CreditsUsedByInstanceWithPlanChanges(context.Background(), instance, []db.PlanChange{
+			{Plan: "professional", EffectiveTime: db.NewVarcharTime(start.Add(-time.Hour))},
+		}, now)
+		require.NoError(t, err)
+		require.InDelta(t, 24, credits, 0.0000001)
+		require.Len(t, segments, 1)
+		require.Equal(t, "professional", segments[0].Plan)
+	})
+
+	t.Run("plan change while the instance was running splits the runtime", func(t *testing.T) {
+		credits, segments, err := pricer.CreditsUsedByInstanceWithPlanChanges(context.Background(), instance, []db.PlanChange{
+			{Plan: "professional", EffectiveTime: db.NewVarcharTime(start.Add(30 * time.Minute))},
+			// after the instance stopped, not relevant
+			{Plan: "default", EffectiveTime: db.NewVarcharTime(start.Add(3 * time.Hour))},
+		}, now)
+		require.NoError(t, err)
+		// 30 minutes at 0.1, 90 minutes at 0.2
+		require.InDelta(t, 3+18, credits, 0.0000001)
+		require.Equal(t, []db.PricingSegment{
+			{
+				Plan:             defaultPlan,
+				StartTime:        db.TimeToISO8601(start),
+				EndTime:          db.TimeToISO8601(start.Add(30 * time.Minute)),
+				CreditsPerMinute: 0.1,
+				Credits:          3,
+			},
+			{
+				Plan:             "professional",
+				StartTime:        db.TimeToISO8601(start.Add(30 * time.Minute)),
+				EndTime:          db.TimeToISO8601(start.Add(2 * time.Hour)),
+				CreditsPerMinute: 0.2,
+				Credits:          18,
+			},
+		}, segments)
+	})
+}
+
+func TestNewWorkspacePricerWithPlans_RequiresDefaultClassPerPlan(t *testing.T) {
+	_, err := NewWorkspacePricerWithPlans(
+		map[string]float64{"default": 0.1},
+		map[string]map[string]float64{"professional": {"g1-large": 0.2}},
+	)
+	require.Error(t, err)
+}
@@ -0,0 +1,122 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/requestid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *UsageService) SetProjectBudget(ctx context.Context, in *v1.SetProjectBudgetRequest) (*v1.SetProjectBudgetResponse, error) {
+	attributionId, err := parseTeamAttributionID(in.GetAttributionId())
+	if err != nil {
+		return nil, err
+	}
+	if in.GetProjectId() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "Project ID must be specified")
+	}
+	if in.GetSpendingLimit() <= 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "Spending limit must be positive")
+	}
+
+	costCenter, err := db.GetCostCenter(ctx, s.conn, attributionId)
+	if err != nil {
+		if errors.Is(err, db.CostCenterNotFound) {
+			return nil, attributionNotFoundError(attributionId, err)
+		}
+		return nil, status.Errorf(codes.Internal, "Failed to get cost center %s from DB: %s", attributionId, err.Error())
+	}
+	if in.GetSpendingLimit() > costCenter.SpendingLimit {
+		return nil, errorWithReason(codes.InvalidArgument, ErrorReason_LimitExceeded, map[string]string{"limit": strconv.Itoa(int(costCenter.SpendingLimit))}, "Budget of project must not exceed the spending limit of the team of %d credits", costCenter.SpendingLimit)
+	}
+
+	err = db.SetProjectBudget(ctx, s.conn, db.ProjectBudget{
+		AttributionID: attributionId,
+		ProjectID:     in.GetProjectId(),
+		SpendingLimit: in.GetSpendingLimit(),
+	})
+	if err != nil {
+		requestid.Log(ctx).WithError(err).WithField("attribution_id", attributionId).Error("Failed to set project budget.")
+		return nil, status.Errorf(codes.Internal, "Failed to set budget of project %s", in.GetProjectId())
+	}
+
+	return &v1.SetProjectBudgetResponse{}, nil
+}
+
+func (s *UsageService) DeleteProjectBudget(ctx context.Context, in *v1.DeleteProjectBudgetRequest) (*v1.DeleteProjectBudgetResponse, error) {
+	attributionId, err := parseTeamAttributionID(in.GetAttributionId())
+	if err != nil {
+		return nil, err
+	}
+	if in.GetProjectId() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "Project ID must be specified")
+	}
+
+	err = db.DeleteProjectBudget(ctx, s.conn, attributionId, in.GetProjectId())
+	if err != nil {
+		if errors.Is(err, db.ProjectBudgetNotFound) {
+			return nil, status.Errorf(codes.NotFound, "Project %s has no budget", in.GetProjectId())
+		}
+		requestid.Log(ctx).WithError(err).WithField("attribution_id", attributionId).Error("Failed to delete project budget.")
+		return nil, status.Errorf(codes.Internal, "Failed to delete budget of project %s", in.GetProjectId())
+	}
+
+	return &v1.DeleteProjectBudgetResponse{}, nil
+}
+
+// parseTeamAttributionID parses the attribution ID, which must belong to a team because only teams have projects.
+func parseTeamAttributionID(attributionID string) (db.AttributionID, error) {
+	attributionId, err := db.ParseAttributionID(attributionID)
+	if err != nil {
+		return "", invalidAttributionIDError("Failed to parse attribution ID: %s", err.Error())
+	}
+	if entity, _ := attributionId.Values(); entity != db.AttributionEntity_Team {
+		return "", status.Errorf(codes.InvalidArgument, "Project budgets are only supported for teams")
+	}
+	return attributionId, nil
+}
+
+// projectBalances returns the balances of the projects of the attribution ID which have a budget, for the billing
+// period [from, to).
+func (s *UsageService) projectBalances(ctx context.Context, attributionId db.AttributionID, from, to time.Time) ([]*v1.ProjectBalance, error) {
+	budgets, err := db.FindProjectBudgets(ctx, s.conn, attributionId)
+	if err != nil {
+		return nil, err
+	}
+	if len(budgets) == 0 {
+		return nil, nil
+	}
+
+	usage, err := db.GetWorkspaceUsageByProject(ctx, s.conn, attributionId, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get usage by project: %w", err)
+	}
+
+	return toProjectBalances(budgets, usage), nil
+}
+
+func toProjectBalances(budgets []db.ProjectBudget, usage map[string]db.CreditCents) []*v1.ProjectBalance {
+	var balances []*v1.ProjectBalance
+	for _, budget := range budgets {
+		creditsUsed := usage[budget.ProjectID].ToCredits()
+		balances = append(balances, &v1.ProjectBalance{
+			ProjectId:        budget.ProjectID,
+			SpendingLimit:    budget.SpendingLimit,
+			CreditsUsed:      creditsUsed,
+			CreditsRemaining: float64(budget.SpendingLimit) - creditsUsed,
+			LimitExceeded:    creditsUsed >= float64(budget.SpendingLimit),
+		})
+	}
+	return balances
+}
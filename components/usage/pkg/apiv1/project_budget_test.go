@@ -0,0 +1,73 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"context"
+	"testing"
+
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestSetProjectBudget_Validation(t *testing.T) {
+	service := &UsageService{}
+	teamID := string(db.NewTeamAttributionID(uuid.New().String()))
+
+	scenarios := []struct {
+		Name    string
+		Request *v1.SetProjectBudgetRequest
+	}{
+		{
+			Name:    "user attribution",
+			Request: &v1.SetProjectBudgetRequest{AttributionId: string(db.NewUserAttributionID(uuid.New().String())), ProjectId: "project", SpendingLimit: 10},
+		},
+		{
+			Name:    "no project",
+			Request: &v1.SetProjectBudgetRequest{AttributionId: teamID, SpendingLimit: 10},
+		},
+		{
+			Name:    "no spending limit",
+			Request: &v1.SetProjectBudgetRequest{AttributionId: teamID, ProjectId: "project"},
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.Name, func(t *testing.T) {
+			_, err := service.SetProjectBudget(context.Background(), s.Request)
+			require.Equal(t, codes.InvalidArgument, status.Code(err))
+		})
+	}
+}
+
+func TestToProjectBalances(t *testing.T) {
+	budgets := []db.ProjectBudget{
+		{ProjectID: "project-a", SpendingLimit: 10},
+		{ProjectID: "project-b", SpendingLimit: 20},
+		{ProjectID: "project-c", SpendingLimit: 5},
+	}
+	usage := map[string]db.CreditCents{
+		"project-a": 400,
+		"project-b": 2500,
+		"":          10000,
+	}
+
+	balances := toProjectBalances(budgets, usage)
+	require.Len(t, balances, 3)
+
+	require.Equal(t, float64(4), balances[0].CreditsUsed)
+	require.Equal(t, float64(6), balances[0].CreditsRemaining)
+	require.False(t, balances[0].LimitExceeded)
+
+	require.Equal(t, float64(-5), balances[1].CreditsRemaining)
+	require.True(t, balances[1].LimitExceeded)
+
+	require.Zero(t, balances[2].CreditsUsed, "projects without usage have their full budget remaining")
+	require.Equal(t, float64(5), balances[2].CreditsRemaining)
+}
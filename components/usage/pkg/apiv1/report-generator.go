@@ -11,63 +11,116 @@ import (
 
 	"github.com/gitpod-io/gitpod/usage/pkg/contentservice"
 
-	"github.com/gitpod-io/gitpod/common-go/log"
 	"github.com/gitpod-io/gitpod/usage/pkg/db"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
+	"github.com/gitpod-io/gitpod/usage/pkg/requestid"
+	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 )
 
-func NewReportGenerator(conn *gorm.DB, pricer *WorkspacePricer) *ReportGenerator {
+func NewReportGenerator(conn *gorm.DB, pricer *WorkspacePricer, replica *db.ReplicaRouter, logSampling LogSamplingConfig) *ReportGenerator {
 	return &ReportGenerator{
-		conn:    conn,
-		pricer:  pricer,
-		nowFunc: time.Now,
+		conn:        conn,
+		replica:     replica,
+		pricer:      pricer,
+		logSampling: logSampling,
+		nowFunc:     time.Now,
 	}
 }
 
 type ReportGenerator struct {
-	conn    *gorm.DB
+	conn *gorm.DB
+	// replica routes reading workspace instances to a read replica. It is optional.
+	replica *db.ReplicaRouter
 	pricer  *WorkspacePricer
-	nowFunc func() time.Time
+	// logSampling bounds the lines which are logged per invalid workspace instance.
+	logSampling LogSamplingConfig
+	nowFunc     func() time.Time
 }
 
+func (g *ReportGenerator) readConn(ctx context.Context) *gorm.DB {
+	if g.replica == nil {
+		return g.conn
+	}
+	return g.replica.Reader(ctx)
+}
+
+// ReportProgressFunc is called with the number of instances processed so far, and the total number of instances to process.
+type ReportProgressFunc func(processed, total int64)
+
 func (g *ReportGenerator) GenerateUsageReport(ctx context.Context, from, to time.Time) (contentservice.UsageReport, error) {
+	return g.GenerateUsageReportWithProgress(ctx, from, to, nil)
+}
+
+// GenerateUsageReportWithProgress generates a report like GenerateUsageReport, reporting progress to the optional progress func.
+// Generation stops once ctx is cancelled.
+func (g *ReportGenerator) GenerateUsageReportWithProgress(ctx context.Context, from, to time.Time, progress ReportProgressFunc) (contentservice.UsageReport, error) {
 	now := g.nowFunc().UTC()
 
 	// Sanity check: from <= now
 	if now.Before(from) {
-		return contentservice.UsageReport{}, status.Errorf(codes.InvalidArgument, "Now must be after (or be equal to) from")
+		return contentservice.UsageReport{}, invalidTimeRangeError("Now must be after (or be equal to) from")
 	}
 
+	// The generation ID is derived from the requested window, such that repeated runs for the same window share it.
+	generationID := contentservice.NewGenerationID(from, to, g.pricer.ConfigHash())
+
 	// Enforce: to <= now
 	if now.Before(to) {
 		to = now
 	}
-	log.Infof("Gathering usage data from %s to %s (%s)", from, to, now)
+	requestid.Log(ctx).Infof("Gathering usage data from %s to %s (%s)", from, to, now)
 
 	report := contentservice.UsageReport{
+		GenerationID:   generationID,
 		GenerationTime: now,
 		From:           from,
 		To:             to,
 	}
 
-	instances, err := db.ListWorkspaceInstancesInRange(ctx, g.conn, from, to)
+	var total int64
+	var onBatch func(listed int)
+	if progress != nil {
+		var err error
+		total, err = db.CountWorkspaceInstancesInRange(ctx, g.readConn(ctx), from, to)
+		if err != nil {
+			return report, fmt.Errorf("failed to count instances in db: %w", err)
+		}
+		progress(0, total)
+		onBatch = func(listed int) {
+			progress(int64(listed), total)
+		}
+	}
+
+	instances, err := db.ListWorkspaceInstancesInRangeWithProgress(ctx, g.readConn(ctx), from, to, onBatch)
 	if err != nil {
 		return report, fmt.Errorf("failed to list instances from db: %w", err)
 	}
+	if err := ctx.Err(); err != nil {
+		return report, err
+	}
 
 	valid, invalid := validateInstances(instances)
 	report.InvalidSessions = invalid
 
 	if len(invalid) > 0 {
-		log.WithField("invalid_workspace_instances", invalid).Errorf("Detected %d invalid instances. These will be skipped in the current run.", len(invalid))
+		requestid.Log(ctx).Errorf("Detected %d invalid instances. These will be skipped in the current run.", len(invalid))
+		sampler := newRecordLogSampler(g.logSampling, requestid.Log(ctx), logrus.ErrorLevel, "Skipping invalid workspace instance.")
+		for _, session := range invalid {
+			sampler.Log(requestid.Log(ctx).WithField("invalid_workspace_instance", session), session.Session.UsageAttributionID)
+		}
+		sampler.Close()
 	}
-	log.WithField("workspace_instances", instances).Debug("Successfully loaded workspace instances.")
+	requestid.Log(ctx).WithField("workspace_instances", instances).Debug("Successfully loaded workspace instances.")
 
 	trimmed := trimStartStopTime(valid, from, to)
 
-	report.UsageRecords = instancesToUsageRecords(trimmed, g.pricer, to)
+	report.UsageRecords, err = instancesToUsageRecords(ctx, trimmed, g.pricer, to)
+	if err != nil {
+		return report, err
+	}
+	if progress != nil {
+		progress(int64(len(instances)), total)
+	}
 	return report, nil
 }
 
@@ -0,0 +1,140 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// runningReportJobs holds the cancel funcs of report jobs running in this process.
+type runningReportJobs struct {
+	mu   sync.Mutex
+	jobs map[uuid.UUID]context.CancelFunc
+}
+
+func (r *runningReportJobs) add(id uuid.UUID, cancel context.CancelFunc) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.jobs == nil {
+		r.jobs = map[uuid.UUID]context.CancelFunc{}
+	}
+	if _, exists := r.jobs[id]; exists {
+		return false
+	}
+	r.jobs[id] = cancel
+	return true
+}
+
+func (r *runningReportJobs) remove(id uuid.UUID) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.jobs, id)
+}
+
+func (r *runningReportJobs) cancel(id uuid.UUID) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if cancel, ok := r.jobs[id]; ok {
+		cancel()
+	}
+}
+
+func (s *UsageService) GetReportJob(ctx context.Context, in *v1.GetReportJobRequest) (*v1.GetReportJobResponse, error) {
+	job, err := s.getReportJob(ctx, in.GetJobId())
+	if err != nil {
+		return nil, err
+	}
+
+	return &v1.GetReportJobResponse{
+		Job: reportJobToAPI(job),
+	}, nil
+}
+
+func (s *UsageService) CancelReportJob(ctx context.Context, in *v1.CancelReportJobRequest) (*v1.CancelReportJobResponse, error) {
+	job, err := s.getReportJob(ctx, in.GetJobId())
+	if err != nil {
+		return nil, err
+	}
+
+	if job.State != db.ReportJobState_Running {
+		return nil, status.Errorf(codes.FailedPrecondition, "Report job %s is not running, it is %s", job.ID, job.State)
+	}
+
+	// Jobs which are no longer running in this process, for example because the process restarted, are only marked as cancelled.
+	s.reportJobs.cancel(job.ID)
+	err = db.FinishReportJob(ctx, s.conn, job.ID, db.ReportJobState_Cancelled, "", "cancelled", s.nowFunc())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to cancel report job %s", job.ID)
+	}
+
+	job, err = s.getReportJob(ctx, in.GetJobId())
+	if err != nil {
+		return nil, err
+	}
+
+	return &v1.CancelReportJobResponse{
+		Job: reportJobToAPI(job),
+	}, nil
+}
+
+func (s *UsageService) getReportJob(ctx context.Context, jobID string) (db.ReportJob, error) {
+	id, err := uuid.Parse(jobID)
+	if err != nil {
+		return db.ReportJob{}, status.Errorf(codes.InvalidArgument, "Invalid job ID %q", jobID)
+	}
+
+	job, err := db.GetReportJob(ctx, s.conn, id)
+	if err != nil {
+		if errors.Is(err, db.ReportJobNotFound) {
+			return db.ReportJob{}, status.Errorf(codes.NotFound, "Report job %s not found", id)
+		}
+		return db.ReportJob{}, status.Errorf(codes.Internal, "Failed to get report job %s", id)
+	}
+
+	return job, nil
+}
+
+func reportJobToAPI(job db.ReportJob) *v1.ReportJob {
+	state := v1.ReportJob_STATE_UNSPECIFIED
+	switch job.State {
+	case db.ReportJobState_Running:
+		state = v1.ReportJob_STATE_RUNNING
+	case db.ReportJobState_Completed:
+		state = v1.ReportJob_STATE_COMPLETED
+	case db.ReportJobState_Failed:
+		state = v1.ReportJob_STATE_FAILED
+	case db.ReportJobState_Cancelled:
+		state = v1.ReportJob_STATE_CANCELLED
+	}
+
+	result := &v1.ReportJob{
+		Id:                 job.ID.String(),
+		State:              state,
+		From:               timestamppb.New(job.From),
+		To:                 timestamppb.New(job.To),
+		InstancesProcessed: job.InstancesProcessed,
+		InstancesTotal:     job.InstancesTotal,
+		ReportId:           job.ReportID,
+		Error:              job.Error,
+		StartedAt:          timestamppb.New(job.StartedAt),
+	}
+	if job.FinishedAt.Valid {
+		result.FinishedAt = timestamppb.New(job.FinishedAt.Time)
+	}
+
+	return result
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gitpod-io/gitpod/common-go/baseserver"
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/db/dbtest"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+func TestUsageService_GetAndCancelReportJob(t *testing.T) {
+	dbconn := dbtest.ConnectForTests(t)
+	ctx := context.Background()
+
+	job := db.ReportJob{
+		ID:                 uuid.New(),
+		State:              db.ReportJobState_Running,
+		From:               time.Date(2022, 8, 1, 0, 0, 0, 0, time.UTC),
+		To:                 time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC),
+		InstancesProcessed: 1000,
+		InstancesTotal:     4000,
+		StartedAt:          time.Now().UTC().Truncate(time.Second),
+	}
+	require.NoError(t, db.CreateReportJob(ctx, dbconn, job))
+	t.Cleanup(func() {
+		require.NoError(t, dbconn.Where("id = ?", job.ID.String()).Delete(&db.ReportJob{}).Error)
+	})
+
+	srv := baseserver.NewForTests(t,
+		baseserver.WithGRPC(baseserver.MustUseRandomLocalAddress(t)),
+	)
+
+	usageService := NewUsageService(dbconn, nil, nil, DefaultWorkspacePricer, nil, SpendingLimitGraceMargin{}, nil, DefaultDunningPeriods, DefaultDeletedUsageRetention, nil, LogSamplingConfig{}, nil, nil, nil, nil, nil, nil)
+	cancelled := false
+	usageService.reportJobs.add(job.ID, func() { cancelled = true })
+	v1.RegisterUsageServiceServer(srv.GRPC(), usageService)
+	baseserver.StartServerForTests(t, srv)
+
+	conn, err := grpc.Dial(srv.GRPCAddress(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+
+	client := v1.NewUsageServiceClient(conn)
+
+	getResp, err := client.GetReportJob(ctx, &v1.GetReportJobRequest{JobId: job.ID.String()})
+	require.NoError(t, err)
+	require.Equal(t, v1.ReportJob_STATE_RUNNING, getResp.GetJob().GetState())
+	require.EqualValues(t, 1000, getResp.GetJob().GetInstancesProcessed())
+	require.EqualValues(t, 4000, getResp.GetJob().GetInstancesTotal())
+
+	cancelResp, err := client.CancelReportJob(ctx, &v1.CancelReportJobRequest{JobId: job.ID.String()})
+	require.NoError(t, err)
+	require.True(t, cancelled, "must cancel the context of the running job")
+	require.Equal(t, v1.ReportJob_STATE_CANCELLED, cancelResp.GetJob().GetState())
+	require.NotNil(t, cancelResp.GetJob().GetFinishedAt())
+
+	_, err = client.CancelReportJob(ctx, &v1.CancelReportJobRequest{JobId: job.ID.String()})
+	require.Equal(t, codes.FailedPrecondition, status.Code(err), "finished jobs cannot be cancelled")
+
+	_, err = client.GetReportJob(ctx, &v1.GetReportJobRequest{JobId: uuid.New().String()})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = client.GetReportJob(ctx, &v1.GetReportJobRequest{JobId: "not-a-uuid"})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
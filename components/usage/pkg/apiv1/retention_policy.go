@@ -0,0 +1,154 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/requestid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// MinimumRetentionPolicy is the shortest retention period of each kind of data which installations can set.
+var MinimumRetentionPolicy = &v1.RetentionPolicy{
+	// Workspace instance usage is needed to reconcile billing periods which may still be invoiced.
+	SessionRetentionDays: 90,
+	// Usage entries are the records invoices are based on, and are kept as long as accounting records must be kept in
+	// the strictest jurisdictions, e.g. 10 years in Germany.
+	LedgerRetentionDays: 3650,
+	// Report jobs tell support which reports of the past year were generated.
+	ReportRetentionDays: 365,
+}
+
+// retentionPurge is the number of rows which were deleted by the retention policy.
+type retentionPurge struct {
+	Sessions      int64 `json:"sessions"`
+	LedgerEntries int64 `json:"ledgerEntries"`
+	ReportJobs    int64 `json:"reportJobs"`
+}
+
+func (s *UsageService) GetRetentionPolicy(ctx context.Context, in *v1.GetRetentionPolicyRequest) (*v1.GetRetentionPolicyResponse, error) {
+	policy, err := db.GetRetentionPolicy(ctx, s.conn)
+	if err != nil {
+		requestid.Log(ctx).WithError(err).Error("Failed to get retention policy.")
+		return nil, status.Errorf(codes.Internal, "Failed to get retention policy")
+	}
+
+	resp := &v1.GetRetentionPolicyResponse{
+		Policy:  retentionPolicyToAPI(policy),
+		Minimum: MinimumRetentionPolicy,
+	}
+	if policy.UpdatedAt.IsSet() {
+		resp.UpdatedAt = timestamppb.New(policy.UpdatedAt.Time())
+	}
+	return resp, nil
+}
+
+func (s *UsageService) SetRetentionPolicy(ctx context.Context, in *v1.SetRetentionPolicyRequest) (*v1.SetRetentionPolicyResponse, error) {
+	if in.GetPolicy() == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Policy must be specified")
+	}
+	for _, period := range []struct {
+		field   string
+		days    int32
+		minimum int32
+	}{
+		{"session_retention_days", in.GetPolicy().GetSessionRetentionDays(), MinimumRetentionPolicy.GetSessionRetentionDays()},
+		{"ledger_retention_days", in.GetPolicy().GetLedgerRetentionDays(), MinimumRetentionPolicy.GetLedgerRetentionDays()},
+		{"report_retention_days", in.GetPolicy().GetReportRetentionDays(), MinimumRetentionPolicy.GetReportRetentionDays()},
+	} {
+		if period.days < 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "%s must not be negative", period.field)
+		}
+		if period.days != 0 && period.days < period.minimum {
+			return nil, errorWithReason(codes.InvalidArgument, ErrorReason_RetentionBelowMinimum,
+				map[string]string{"field": period.field, "minimum_days": strconv.Itoa(int(period.minimum))},
+				"%s must be at least %d days, or 0 to retain data indefinitely", period.field, period.minimum)
+		}
+	}
+
+	before, err := db.GetRetentionPolicy(ctx, s.conn)
+	if err != nil {
+		requestid.Log(ctx).WithError(err).Error("Failed to get retention policy.")
+		return nil, status.Errorf(codes.Internal, "Failed to get retention policy")
+	}
+
+	policy := db.RetentionPolicy{
+		SessionRetentionDays: in.GetPolicy().GetSessionRetentionDays(),
+		LedgerRetentionDays:  in.GetPolicy().GetLedgerRetentionDays(),
+		ReportRetentionDays:  in.GetPolicy().GetReportRetentionDays(),
+		UpdatedAt:            db.NewVarcharTime(s.nowFunc()),
+	}
+	err = db.SetRetentionPolicy(ctx, s.conn, policy)
+	if err != nil {
+		requestid.Log(ctx).WithError(err).Error("Failed to set retention policy.")
+		return nil, status.Errorf(codes.Internal, "Failed to set retention policy")
+	}
+	auditChange(ctx, "", retentionPolicyToAPI(before), retentionPolicyToAPI(policy))
+	requestid.Log(ctx).
+		WithField("session_retention_days", policy.SessionRetentionDays).
+		WithField("ledger_retention_days", policy.LedgerRetentionDays).
+		WithField("report_retention_days", policy.ReportRetentionDays).
+		Info("Set retention policy.")
+
+	return &v1.SetRetentionPolicyResponse{
+		Policy: retentionPolicyToAPI(policy),
+	}, nil
+}
+
+// applyRetentionPolicy permanently deletes the data which is older than its retention period at `now`. Periods below
+// the minimum are raised to the minimum, in case the policy was written to the database directly.
+func (s *UsageService) applyRetentionPolicy(ctx context.Context, now time.Time) (retentionPurge, error) {
+	var purged retentionPurge
+	policy, err := db.GetRetentionPolicy(ctx, s.conn)
+	if err != nil {
+		return purged, err
+	}
+
+	if before, ok := retentionCutoff(now, policy.SessionRetentionDays, MinimumRetentionPolicy.GetSessionRetentionDays()); ok {
+		purged.Sessions, err = db.PurgeWorkspaceInstanceUsage(ctx, s.conn, before)
+		if err != nil {
+			return purged, err
+		}
+	}
+	if before, ok := retentionCutoff(now, policy.LedgerRetentionDays, MinimumRetentionPolicy.GetLedgerRetentionDays()); ok {
+		purged.LedgerEntries, err = db.PurgeLedgerUsage(ctx, s.conn, before)
+		if err != nil {
+			return purged, err
+		}
+	}
+	if before, ok := retentionCutoff(now, policy.ReportRetentionDays, MinimumRetentionPolicy.GetReportRetentionDays()); ok {
+		purged.ReportJobs, err = db.PurgeReportJobs(ctx, s.conn, before)
+		if err != nil {
+			return purged, err
+		}
+	}
+	return purged, nil
+}
+
+// retentionCutoff returns the time before which data is purged, and false when the data is retained indefinitely.
+func retentionCutoff(now time.Time, days, minimum int32) (time.Time, bool) {
+	if days <= 0 {
+		return time.Time{}, false
+	}
+	if days < minimum {
+		days = minimum
+	}
+	return now.AddDate(0, 0, -int(days)), true
+}
+
+func retentionPolicyToAPI(policy db.RetentionPolicy) *v1.RetentionPolicy {
+	return &v1.RetentionPolicy{
+		SessionRetentionDays: policy.SessionRetentionDays,
+		LedgerRetentionDays:  policy.LedgerRetentionDays,
+		ReportRetentionDays:  policy.ReportRetentionDays,
+	}
+}
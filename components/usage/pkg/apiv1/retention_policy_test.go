@@ -0,0 +1,94 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/db/dbtest"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestUsageService_SetRetentionPolicy(t *testing.T) {
+	conn := dbtest.ConnectInMemoryForTests(t)
+	now := time.Date(2022, 10, 15, 12, 0, 0, 0, time.UTC)
+	service := NewUsageService(conn, nil, nil, DefaultWorkspacePricer, nil, SpendingLimitGraceMargin{}, nil, DefaultDunningPeriods, DefaultDeletedUsageRetention, nil, LogSamplingConfig{}, nil, nil, nil, nil, nil, nil)
+	service.nowFunc = func() time.Time { return now }
+
+	resp, err := service.GetRetentionPolicy(context.Background(), &v1.GetRetentionPolicyRequest{})
+	require.NoError(t, err)
+	require.True(t, proto.Equal(&v1.RetentionPolicy{}, resp.GetPolicy()), "must retain everything by default")
+	require.True(t, proto.Equal(MinimumRetentionPolicy, resp.GetMinimum()))
+	require.Nil(t, resp.GetUpdatedAt())
+
+	policy := &v1.RetentionPolicy{SessionRetentionDays: 180, ReportRetentionDays: 365}
+	set, err := service.SetRetentionPolicy(context.Background(), &v1.SetRetentionPolicyRequest{Policy: policy})
+	require.NoError(t, err)
+	require.True(t, proto.Equal(policy, set.GetPolicy()))
+
+	resp, err = service.GetRetentionPolicy(context.Background(), &v1.GetRetentionPolicyRequest{})
+	require.NoError(t, err)
+	require.True(t, proto.Equal(policy, resp.GetPolicy()))
+	require.Equal(t, now, resp.GetUpdatedAt().AsTime())
+}
+
+func TestUsageService_SetRetentionPolicy_Validation(t *testing.T) {
+	service := NewUsageService(nil, nil, nil, DefaultWorkspacePricer, nil, SpendingLimitGraceMargin{}, nil, DefaultDunningPeriods, DefaultDeletedUsageRetention, nil, LogSamplingConfig{}, nil, nil, nil, nil, nil, nil)
+
+	_, err := service.SetRetentionPolicy(context.Background(), &v1.SetRetentionPolicyRequest{})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = service.SetRetentionPolicy(context.Background(), &v1.SetRetentionPolicyRequest{Policy: &v1.RetentionPolicy{ReportRetentionDays: -1}})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = service.SetRetentionPolicy(context.Background(), &v1.SetRetentionPolicyRequest{Policy: &v1.RetentionPolicy{LedgerRetentionDays: 365}})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	require.Equal(t, ErrorReason_RetentionBelowMinimum, errorReason(status.Convert(err)))
+}
+
+func TestUsageService_ApplyRetentionPolicy(t *testing.T) {
+	conn := dbtest.ConnectInMemoryForTests(t)
+	now := time.Date(2022, 10, 15, 12, 0, 0, 0, time.UTC)
+	attributionID := db.NewTeamAttributionID(uuid.New().String())
+	service := NewUsageService(conn, nil, nil, DefaultWorkspacePricer, nil, SpendingLimitGraceMargin{}, nil, DefaultDunningPeriods, DefaultDeletedUsageRetention, nil, LogSamplingConfig{}, nil, nil, nil, nil, nil, nil)
+
+	stoppedAt := func(daysAgo int) sql.NullTime {
+		return sql.NullTime{Time: now.AddDate(0, 0, -daysAgo), Valid: true}
+	}
+	dbtest.CreateWorkspaceInstanceUsageRecords(t, conn,
+		dbtest.NewWorkspaceInstanceUsage(t, db.WorkspaceInstanceUsage{AttributionID: attributionID, StartedAt: now.AddDate(0, 0, -201), StoppedAt: stoppedAt(200)}),
+		dbtest.NewWorkspaceInstanceUsage(t, db.WorkspaceInstanceUsage{AttributionID: attributionID, StartedAt: now.AddDate(0, 0, -101), StoppedAt: stoppedAt(100)}),
+		dbtest.NewWorkspaceInstanceUsage(t, db.WorkspaceInstanceUsage{AttributionID: attributionID, StartedAt: now.AddDate(0, 0, -2), StoppedAt: stoppedAt(1)}),
+	)
+	dbtest.CreateUsageRecords(t, conn,
+		dbtest.NewUsage(t, db.Usage{AttributionID: attributionID, EffectiveTime: db.NewVarcharTime(now.AddDate(0, 0, -200))}),
+	)
+
+	purged, err := service.applyRetentionPolicy(context.Background(), now)
+	require.NoError(t, err)
+	require.Equal(t, retentionPurge{}, purged, "must not purge anything without a policy")
+
+	// A session retention below the minimum can only be written to the database directly, it is raised to the minimum.
+	require.NoError(t, db.SetRetentionPolicy(context.Background(), conn, db.RetentionPolicy{SessionRetentionDays: 30, ReportRetentionDays: 365}))
+	purged, err = service.applyRetentionPolicy(context.Background(), now)
+	require.NoError(t, err)
+	require.Equal(t, retentionPurge{Sessions: 2}, purged, "must only purge sessions which stopped before the minimum retention")
+
+	var sessions int64
+	require.NoError(t, conn.Model(&db.WorkspaceInstanceUsage{}).Where("attributionId = ?", attributionID).Count(&sessions).Error)
+	require.EqualValues(t, 1, sessions)
+	var entries int64
+	require.NoError(t, conn.Model(&db.Usage{}).Where("attributionId = ?", attributionID).Count(&entries).Error)
+	require.EqualValues(t, 1, entries, "must retain ledger entries without a ledger retention")
+}
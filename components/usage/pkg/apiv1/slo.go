@@ -0,0 +1,122 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gitpod-io/gitpod/common-go/util"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// SLOObjective is the service level objective of an RPC, over any window the alerts evaluate.
+type SLOObjective struct {
+	// Availability is the ratio of calls which must not fail with a server error, e.g. 0.999.
+	Availability float64 `json:"availability"`
+
+	// Latency is the duration within which LatencyTarget of the calls must complete.
+	Latency util.Duration `json:"latency"`
+
+	// LatencyTarget is the ratio of calls which must complete within Latency, e.g. 0.99.
+	LatencyTarget float64 `json:"latencyTarget"`
+}
+
+func (o SLOObjective) Validate() error {
+	if o.Availability <= 0 || o.Availability >= 1 {
+		return fmt.Errorf("availability objective must be between 0 and 1, was %v", o.Availability)
+	}
+	if o.Latency <= 0 {
+		return fmt.Errorf("latency must be positive, was %s", time.Duration(o.Latency))
+	}
+	if o.LatencyTarget <= 0 || o.LatencyTarget >= 1 {
+		return fmt.Errorf("latency target must be between 0 and 1, was %v", o.LatencyTarget)
+	}
+	return nil
+}
+
+// SLOs maps full method names, e.g. /usage.v1.UsageService/GetBalance, to their objectives. Methods without
+// objective are not tracked.
+type SLOs map[string]SLOObjective
+
+func (s SLOs) Validate() error {
+	for method, objective := range s {
+		if err := objective.Validate(); err != nil {
+			return fmt.Errorf("invalid objective of %s: %w", method, err)
+		}
+	}
+	return nil
+}
+
+// DefaultSLOs are the objectives of the RPCs which server calls while users wait, for example on workspace starts.
+var DefaultSLOs = SLOs{
+	"/usage.v1.UsageService/GetBalance": {
+		Availability:  0.999,
+		Latency:       util.Duration(250 * time.Millisecond),
+		LatencyTarget: 0.99,
+	},
+	"/usage.v1.UsageService/GetCostCenter": {
+		Availability:  0.999,
+		Latency:       util.Duration(250 * time.Millisecond),
+		LatencyTarget: 0.99,
+	},
+	"/usage.v1.UsageService/ListUsage": {
+		Availability:  0.995,
+		Latency:       util.Duration(time.Second),
+		LatencyTarget: 0.99,
+	},
+	"/usage.v1.UsageService/SetSpendingLimit": {
+		Availability:  0.995,
+		Latency:       util.Duration(time.Second),
+		LatencyTarget: 0.99,
+	},
+}
+
+// NewSLOInterceptor returns an interceptor which counts the calls of the RPCs with objectives, and the calls which
+// count against their error budgets. The objectives are exported alongside, such that burn rates are
+// (errors / calls) / (1 - objective).
+func NewSLOInterceptor(slos SLOs) (grpc.UnaryServerInterceptor, error) {
+	err := slos.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid SLOs: %w", err)
+	}
+
+	for method, objective := range slos {
+		sloObjectiveRatio.WithLabelValues(method, sloAvailability).Set(objective.Availability)
+		sloObjectiveRatio.WithLabelValues(method, sloLatency).Set(objective.LatencyTarget)
+		sloLatencyThresholdSeconds.WithLabelValues(method).Set(time.Duration(objective.Latency).Seconds())
+		for _, slo := range []string{sloAvailability, sloLatency} {
+			// Initialize the series, such that ratios are 0 rather than absent until the first failure.
+			sloRequestsTotal.WithLabelValues(method, slo)
+			sloFailedRequestsTotal.WithLabelValues(method, slo)
+		}
+	}
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		objective, ok := slos[info.FullMethod]
+		if !ok {
+			return handler(ctx, req)
+		}
+
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		reportSLORequest(info.FullMethod, objective, time.Since(start), status.Code(err))
+		return resp, err
+	}, nil
+}
+
+// countsAgainstAvailability returns whether a call with the code is a failure of the service. Errors caused by the
+// request, like InvalidArgument or NotFound, do not count against the error budget.
+func countsAgainstAvailability(code codes.Code) bool {
+	switch code {
+	case codes.Unknown, codes.DeadlineExceeded, codes.Internal, codes.Unavailable, codes.DataLoss, codes.Unimplemented:
+		return true
+	default:
+		return false
+	}
+}
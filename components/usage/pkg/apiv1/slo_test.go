@@ -0,0 +1,64 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gitpod-io/gitpod/common-go/util"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestSLOs_Validate(t *testing.T) {
+	require.NoError(t, DefaultSLOs.Validate())
+
+	valid := SLOObjective{Availability: 0.99, Latency: util.Duration(time.Second), LatencyTarget: 0.9}
+	require.NoError(t, valid.Validate())
+
+	for name, objective := range map[string]SLOObjective{
+		"availability of 1":   {Availability: 1, Latency: valid.Latency, LatencyTarget: valid.LatencyTarget},
+		"no latency":          {Availability: valid.Availability, LatencyTarget: valid.LatencyTarget},
+		"no latency target":   {Availability: valid.Availability, Latency: valid.Latency},
+		"negative objectives": {Availability: -0.5, Latency: valid.Latency, LatencyTarget: valid.LatencyTarget},
+	} {
+		require.Error(t, SLOs{"/test.v1.Service/Method": objective}.Validate(), name)
+	}
+}
+
+func TestSLOInterceptor(t *testing.T) {
+	method := "/usage.v1.UsageService/TestSLOInterceptor"
+	interceptor, err := NewSLOInterceptor(SLOs{
+		method: {Availability: 0.99, Latency: util.Duration(10 * time.Millisecond), LatencyTarget: 0.9},
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, 0.99, testutil.ToFloat64(sloObjectiveRatio.WithLabelValues(method, sloAvailability)))
+	require.Equal(t, 0.01, testutil.ToFloat64(sloLatencyThresholdSeconds.WithLabelValues(method)))
+	require.Zero(t, testutil.ToFloat64(sloFailedRequestsTotal.WithLabelValues(method, sloAvailability)), "series must be initialized")
+
+	call := func(fullMethod string, delay time.Duration, err error) {
+		_, _ = interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: fullMethod}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			time.Sleep(delay)
+			return nil, err
+		})
+	}
+	call(method, 0, nil)
+	call(method, 20*time.Millisecond, nil)
+	call(method, 0, status.Error(codes.NotFound, "not found"))
+	call(method, 0, status.Error(codes.Internal, "failed"))
+	call("/usage.v1.UsageService/WithoutObjective", 0, status.Error(codes.Internal, "failed"))
+
+	require.Equal(t, float64(4), testutil.ToFloat64(sloRequestsTotal.WithLabelValues(method, sloAvailability)))
+	require.Equal(t, float64(1), testutil.ToFloat64(sloFailedRequestsTotal.WithLabelValues(method, sloAvailability)), "client errors must not count against availability")
+	require.Equal(t, float64(3), testutil.ToFloat64(sloRequestsTotal.WithLabelValues(method, sloLatency)), "server errors must not count towards latency")
+	require.Equal(t, float64(1), testutil.ToFloat64(sloFailedRequestsTotal.WithLabelValues(method, sloLatency)))
+	require.Zero(t, testutil.ToFloat64(sloRequestsTotal.WithLabelValues("/usage.v1.UsageService/WithoutObjective", sloAvailability)))
+}
@@ -0,0 +1,170 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/requestid"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func (s *UsageService) SetSpendingLimit(ctx context.Context, in *v1.SetSpendingLimitRequest) (*v1.SetSpendingLimitResponse, error) {
+	attributionId, err := db.ParseAttributionID(in.GetAttributionId())
+	if err != nil {
+		return nil, invalidAttributionIDError("Failed to parse attribution ID: %s", err.Error())
+	}
+	if in.GetSpendingLimit() < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "Spending limit must not be negative")
+	}
+	if in.GetActor() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "Actor must be specified")
+	}
+	if in.GetReason() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "Reason must be specified")
+	}
+
+	logger := requestid.Log(ctx).WithField("attribution_id", attributionId).WithField("actor", in.GetActor())
+	if !in.GetForce() {
+		err = s.checkSpendingLimitAboveUsage(ctx, attributionId, in.GetSpendingLimit())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	previous, err := db.GetCostCenter(ctx, s.conn, attributionId)
+	if err != nil {
+		if errors.Is(err, db.CostCenterNotFound) {
+			return nil, attributionNotFoundError(attributionId, err)
+		}
+		logger.WithError(err).Error("Failed to get cost center.")
+		return nil, status.Errorf(codes.Internal, "Failed to get cost center %s", attributionId)
+	}
+
+	var balanceBefore map[db.AttributionID]balance
+	if s.limitStates != nil {
+		balanceBefore, err = s.getBalances(ctx, []db.AttributionID{attributionId}, s.nowFunc())
+		if err != nil {
+			logger.WithError(err).Error("Failed to get balance before setting spending limit.")
+			return nil, status.Errorf(codes.Internal, "Failed to get balance of %s", attributionId)
+		}
+	}
+
+	costCenter, err := db.SetSpendingLimit(ctx, s.conn, attributionId, in.GetSpendingLimit(), in.GetActor(), in.GetReason())
+	if err != nil {
+		if errors.Is(err, db.CostCenterNotFound) {
+			return nil, attributionNotFoundError(attributionId, err)
+		}
+		logger.WithError(err).Error("Failed to set spending limit.")
+		return nil, status.Errorf(codes.Internal, "Failed to set spending limit of %s", attributionId)
+	}
+	logger.WithField("spending_limit", costCenter.SpendingLimit).Info("Set spending limit.")
+	auditChange(ctx, attributionId, previous, costCenter)
+
+	if s.limitStates != nil {
+		// The spending limit is already set at this point, only the notification is skipped.
+		balanceAfter, err := s.getBalances(ctx, []db.AttributionID{attributionId}, s.nowFunc())
+		if err != nil {
+			logger.WithError(err).Error("Failed to get balance after setting spending limit.")
+		} else {
+			s.notifySpendingLimitStates(ctx, balanceBefore, balanceAfter)
+		}
+	}
+
+	result, err := s.costCenterToAPI(ctx, costCenter)
+	if err != nil {
+		logger.WithError(err).Error("Failed to get usage of cost center.")
+		return nil, status.Errorf(codes.Internal, "Failed to get usage in billing period of cost center %s", attributionId)
+	}
+	return &v1.SetSpendingLimitResponse{CostCenter: result}, nil
+}
+
+// checkSpendingLimitAboveUsage returns a FailedPrecondition error with SpendingLimitBelowUsage details when lowering the
+// spending limit of the cost center to `spendingLimit` would block its workspace starts right away, because the
+// credits used in the current billing period already reach it.
+func (s *UsageService) checkSpendingLimitAboveUsage(ctx context.Context, attributionId db.AttributionID, spendingLimit int32) error {
+	b, err := s.getBalance(ctx, attributionId, s.nowFunc())
+	if err != nil {
+		if errors.Is(err, db.CostCenterNotFound) {
+			return attributionNotFoundError(attributionId, err)
+		}
+		requestid.Log(ctx).WithError(err).WithField("attribution_id", attributionId).Error("Failed to get balance.")
+		return status.Errorf(codes.Internal, "Failed to get balance of %s", attributionId)
+	}
+	if spendingLimit >= b.spendingLimit {
+		return nil
+	}
+
+	creditsUsed := b.creditsOwed().ToCredits()
+	if creditsUsed < float64(spendingLimit) {
+		return nil
+	}
+	st, err := status.New(codes.FailedPrecondition, fmt.Sprintf("Spending limit of %d credits must be above the %.2f credits already used in the current billing period, unless forced", spendingLimit, creditsUsed)).
+		WithDetails(&v1.SpendingLimitBelowUsage{
+			SpendingLimit: spendingLimit,
+			CreditsUsed:   creditsUsed,
+		}, &errdetails.ErrorInfo{
+			Reason: ErrorReason_SpendingLimitBelowUsage,
+			Domain: ErrorDomain,
+		})
+	if err != nil {
+		return status.Errorf(codes.Internal, "Failed to construct error details: %s", err.Error())
+	}
+	return st.Err()
+}
+
+func (s *UsageService) ListSpendingLimitChanges(ctx context.Context, in *v1.ListSpendingLimitChangesRequest) (*v1.ListSpendingLimitChangesResponse, error) {
+	attributionId, err := db.ParseAttributionID(in.GetAttributionId())
+	if err != nil {
+		return nil, invalidAttributionIDError("Failed to parse attribution ID: %s", err.Error())
+	}
+	if in.GetPagination().GetPerPage() < 0 {
+		return nil, invalidPaginationError("Number of items perPage needs to be positive (was %d).", in.GetPagination().GetPerPage())
+	}
+	if in.GetPagination().GetPage() < 0 {
+		return nil, invalidPaginationError("Page number needs to be 0 or greater (was %d).", in.GetPagination().GetPage())
+	}
+
+	var perPage int64 = 50
+	if in.GetPagination().GetPerPage() > 0 {
+		perPage = in.GetPagination().GetPerPage()
+	}
+	page := in.GetPagination().GetPage()
+
+	changes, total, err := db.FindSpendingLimitChanges(ctx, s.conn, attributionId, page*perPage, perPage)
+	if err != nil {
+		requestid.Log(ctx).WithError(err).WithField("attribution_id", attributionId).Error("Failed to find spending limit changes.")
+		return nil, status.Errorf(codes.Internal, "Failed to find spending limit changes of %s", attributionId)
+	}
+
+	resp := &v1.ListSpendingLimitChangesResponse{
+		Pagination: &v1.PaginatedResponse{
+			PerPage:    perPage,
+			Page:       page,
+			TotalPages: int64(math.Ceil(float64(total) / float64(perPage))),
+			Total:      total,
+		},
+	}
+	for _, change := range changes {
+		resp.Changes = append(resp.Changes, &v1.SpendingLimitChange{
+			Id:               change.ID.String(),
+			AttributionId:    string(change.AttributionID),
+			OldSpendingLimit: change.OldSpendingLimit,
+			NewSpendingLimit: change.NewSpendingLimit,
+			Actor:            change.Actor,
+			Reason:           change.Reason,
+			ChangeTime:       timestamppb.New(change.ChangeTime),
+		})
+	}
+	return resp, nil
+}
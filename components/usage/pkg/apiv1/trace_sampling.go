@@ -0,0 +1,151 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gitpod-io/gitpod/common-go/log"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// traceContextHeader carries the trace of the caller as {trace-id}:{span-id}:{parent-span-id}:{flags}.
+	traceContextHeader = "uber-trace-id"
+	// traceDebugHeader starts a new trace which is sampled regardless of the sampler, and tagged with the header value.
+	traceDebugHeader = "jaeger-debug-id"
+	// traceFlagsSampledAndDebug marks a trace as sampled, and as exempt from sampling decisions down the line.
+	traceFlagsSampledAndDebug = "3"
+)
+
+// TraceSampling forces the traces of RPCs for a set of attribution IDs to be sampled, e.g. for a customer under
+// investigation, while the sampler keeps sampling all other traces at a low rate. The attribution IDs can be changed
+// at runtime on the /debug/trace-sampling endpoint of the debug listener.
+//
+// Only RPCs whose request has an attribution ID are sampled.
+type TraceSampling struct {
+	mu             sync.RWMutex
+	attributionIDs map[db.AttributionID]struct{}
+}
+
+func NewTraceSampling(attributionIDs []string) (*TraceSampling, error) {
+	t := &TraceSampling{}
+	if err := t.Set(attributionIDs); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Set replaces the attribution IDs whose traces are sampled.
+func (t *TraceSampling) Set(attributionIDs []string) error {
+	ids := make(map[db.AttributionID]struct{}, len(attributionIDs))
+	for _, id := range attributionIDs {
+		attributionID, err := db.ParseAttributionID(id)
+		if err != nil {
+			return fmt.Errorf("invalid attribution ID %q: %w", id, err)
+		}
+		ids[attributionID] = struct{}{}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.attributionIDs = ids
+	return nil
+}
+
+// AttributionIDs returns the attribution IDs whose traces are sampled, in order.
+func (t *TraceSampling) AttributionIDs() []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	ids := make([]string, 0, len(t.attributionIDs))
+	for id := range t.attributionIDs {
+		ids = append(ids, string(id))
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (t *TraceSampling) sampled(attributionID db.AttributionID) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	_, ok := t.attributionIDs[attributionID]
+	return ok
+}
+
+type traceSamplingState struct {
+	AttributionIDs []string `json:"attributionIds"`
+}
+
+// ServeHTTP lists the attribution IDs whose traces are sampled on GET, and replaces them on PUT with a body like
+// {"attributionIds": ["team:<id>"]}.
+func (t *TraceSampling) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var state traceSamplingState
+		if err := json.NewDecoder(req.Body).Decode(&state); err != nil {
+			http.Error(w, fmt.Sprintf("invalid body: %s", err), http.StatusBadRequest)
+			return
+		}
+		if err := t.Set(state.AttributionIDs); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.WithField("attribution_ids", state.AttributionIDs).Info("Changed attribution IDs whose traces are sampled.")
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(traceSamplingState{AttributionIDs: t.AttributionIDs()})
+}
+
+// UnaryServerInterceptor forces the trace of RPCs for the sampled attribution IDs to be sampled. The server span is
+// started after the interceptor from the trace headers of the call, so the headers are changed rather than the span:
+// calls without a trace start a debug trace tagged with the attribution ID, traces of callers are marked as sampled.
+func (t *TraceSampling) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		r, ok := req.(interface{ GetAttributionId() string })
+		if !ok {
+			return handler(ctx, req)
+		}
+		attributionID, err := db.ParseAttributionID(r.GetAttributionId())
+		if err != nil || !t.sampled(attributionID) {
+			return handler(ctx, req)
+		}
+		return handler(withSampledTrace(ctx, attributionID), req)
+	}
+}
+
+func withSampledTrace(ctx context.Context, attributionID db.AttributionID) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+	md = md.Copy()
+
+	if values := md.Get(traceContextHeader); len(values) > 0 {
+		// Trace headers are URL encoded, see opentracing.HTTPHeaders.
+		traceContext, err := url.QueryUnescape(values[0])
+		if err == nil {
+			if parts := strings.Split(traceContext, ":"); len(parts) == 4 {
+				parts[3] = traceFlagsSampledAndDebug
+				md.Set(traceContextHeader, strings.Join(parts, ":"))
+				return metadata.NewIncomingContext(ctx, md)
+			}
+		}
+		md.Delete(traceContextHeader)
+	}
+	md.Set(traceDebugHeader, string(attributionID))
+	return metadata.NewIncomingContext(ctx, md)
+}
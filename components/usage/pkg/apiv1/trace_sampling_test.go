@@ -0,0 +1,92 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	grpc_opentracing "github.com/grpc-ecosystem/go-grpc-middleware/tracing/opentracing"
+	"github.com/opentracing/opentracing-go"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/jaeger-client-go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestTraceSampling_Interceptor(t *testing.T) {
+	// The sampler samples no trace, like a low sampling rate does for most.
+	tracer, closer := jaeger.NewTracer("usage", jaeger.NewConstSampler(false), jaeger.NewNullReporter())
+	defer closer.Close()
+	tracingInterceptor := grpc_opentracing.UnaryServerInterceptor(grpc_opentracing.WithTracer(tracer))
+
+	investigated := db.NewTeamAttributionID("investigated")
+	sampling, err := NewTraceSampling([]string{string(investigated)})
+	require.NoError(t, err)
+	interceptor := sampling.UnaryServerInterceptor()
+
+	call := func(ctx context.Context, req interface{}) jaeger.SpanContext {
+		var spanContext jaeger.SpanContext
+		info := &grpc.UnaryServerInfo{FullMethod: "/usage.v1.UsageService/GetBalance"}
+		_, err := interceptor(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			// The tracing interceptor of the server runs after the interceptors of the usage component.
+			return tracingInterceptor(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+				spanContext = opentracing.SpanFromContext(ctx).Context().(jaeger.SpanContext)
+				return nil, nil
+			})
+		})
+		require.NoError(t, err)
+		return spanContext
+	}
+
+	require.False(t, call(context.Background(), &v1.GetBalanceRequest{AttributionId: string(db.NewTeamAttributionID("other"))}).IsSampled())
+	require.False(t, call(context.Background(), &v1.RunJanitorRequest{}).IsSampled(), "requests without attribution ID must not be sampled")
+
+	t.Run("calls without trace start a debug trace", func(t *testing.T) {
+		spanContext := call(context.Background(), &v1.GetBalanceRequest{AttributionId: string(investigated)})
+		require.True(t, spanContext.IsSampled())
+		require.True(t, spanContext.IsDebug())
+	})
+
+	t.Run("traces of callers are sampled", func(t *testing.T) {
+		caller := jaeger.NewSpanContext(jaeger.TraceID{Low: 42}, jaeger.SpanID(7), 0, false, nil)
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(traceContextHeader, caller.String()))
+
+		spanContext := call(ctx, &v1.GetBalanceRequest{AttributionId: string(investigated)})
+		require.True(t, spanContext.IsSampled())
+		require.Equal(t, caller.TraceID(), spanContext.TraceID(), "must continue the trace of the caller")
+
+		require.False(t, call(ctx, &v1.GetBalanceRequest{AttributionId: string(db.NewTeamAttributionID("other"))}).IsSampled())
+	})
+}
+
+func TestTraceSampling_ServeHTTP(t *testing.T) {
+	sampling, err := NewTraceSampling(nil)
+	require.NoError(t, err)
+
+	request := func(method, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		sampling.ServeHTTP(rec, httptest.NewRequest(method, "/debug/trace-sampling", strings.NewReader(body)))
+		return rec
+	}
+
+	rec := request(http.MethodPut, `{"attributionIds": ["team:b", "team:a"]}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `{"attributionIds": ["team:a", "team:b"]}`, rec.Body.String())
+	require.True(t, sampling.sampled(db.NewTeamAttributionID("a")))
+
+	require.Equal(t, http.StatusBadRequest, request(http.MethodPut, `{"attributionIds": ["a"]}`).Code)
+	require.Equal(t, []string{"team:a", "team:b"}, sampling.AttributionIDs(), "invalid attribution IDs must not change the sampling")
+
+	require.Equal(t, http.StatusOK, request(http.MethodPut, `{"attributionIds": []}`).Code)
+	require.False(t, sampling.sampled(db.NewTeamAttributionID("a")))
+	require.JSONEq(t, `{"attributionIds": []}`, request(http.MethodGet, "").Body.String())
+	require.Equal(t, http.StatusMethodNotAllowed, request(http.MethodDelete, "").Code)
+}
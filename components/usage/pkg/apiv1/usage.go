@@ -14,11 +14,15 @@ import (
 
 	"github.com/google/uuid"
 
+	"github.com/gitpod-io/gitpod/common-go/analytics"
 	"github.com/gitpod-io/gitpod/common-go/log"
 	"github.com/gitpod-io/gitpod/usage/pkg/contentservice"
 
 	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
 	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/notifier"
+	"github.com/gitpod-io/gitpod/usage/pkg/requestid"
+	"github.com/sirupsen/logrus"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/timestamppb"
@@ -35,6 +39,32 @@ type UsageService struct {
 	contentService contentservice.Interface
 
 	reportGenerator *ReportGenerator
+	reportJobs      runningReportJobs
+
+	// spendingLimitNotifier is informed when reconciliation makes a cost center reach its spending limit. It is optional.
+	spendingLimitNotifier SpendingLimitNotifier
+	graceMargin           SpendingLimitGraceMargin
+	creditPrices          CreditPrices
+	dunningPeriods        DunningPeriods
+	// deletedUsageRetention is how long soft-deleted usage is retained before it can be purged.
+	deletedUsageRetention time.Duration
+	// replica routes listing usage to a read replica. It is optional.
+	replica *db.ReplicaRouter
+	// logSampling bounds the lines which reconciliation logs per record.
+	logSampling LogSamplingConfig
+	// analytics receives usage milestones which reconciliation reaches. It is optional.
+	analytics analytics.Writer
+	// events receives usage which reconciliation and the janitor wrote to the ledger. It is optional.
+	events UsageEventPublisher
+	// webhooks configures the delivery of usage events to the webhooks of attribution IDs. Usage webhooks are disabled
+	// when it is nil.
+	webhooks *UsageWebhookConfig
+	// exporters receive the usage of every day which is exported. Usage export is disabled when there are none.
+	exporters []UsageExporter
+	// limitStates is called whenever the spending limit state of an attribution ID changes. It is optional.
+	limitStates v1.UsageNotificationServiceClient
+	// writeQueue buffers the usage which RecordInstanceEvents writes. When it is nil, the usage is written directly.
+	writeQueue *db.UsageWriteQueue
 
 	v1.UnimplementedUsageServiceServer
 }
@@ -52,11 +82,11 @@ func (s *UsageService) ListBilledUsage(ctx context.Context, in *v1.ListBilledUsa
 	}
 
 	if from.After(to) {
-		return nil, status.Errorf(codes.InvalidArgument, "Specified From timestamp is after To. Please ensure From is always before To")
+		return nil, invalidTimeRangeError("Specified From timestamp is after To. Please ensure From is always before To")
 	}
 
 	if to.Sub(from) > maxQuerySize {
-		return nil, status.Errorf(codes.InvalidArgument, "Maximum range exceeded. Range specified can be at most %s", maxQuerySize.String())
+		return nil, errorWithReason(codes.InvalidArgument, ErrorReason_UsageWindowTooLarge, map[string]string{"max_window": maxQuerySize.String()}, "Maximum range exceeded. Range specified can be at most %s", maxQuerySize.String())
 	}
 
 	var order db.Order = db.DescendingOrder
@@ -73,9 +103,9 @@ func (s *UsageService) ListBilledUsage(ctx context.Context, in *v1.ListBilledUsa
 		offset = limit * (int64(math.Max(0, float64(page-1))))
 	}
 
-	listUsageResult, err := db.ListUsage(ctx, s.conn, db.AttributionID(in.GetAttributionId()), from, to, order, offset, limit)
+	listUsageResult, err := db.ListUsage(ctx, s.readConn(ctx), db.AttributionID(in.GetAttributionId()), from, to, order, offset, limit)
 	if err != nil {
-		log.Log.
+		requestid.Log(ctx).
 			WithField("attribution_id", in.AttributionId).
 			WithField("perPage", limit).
 			WithField("page", page).
@@ -123,6 +153,11 @@ func (s *UsageService) ListBilledUsage(ctx context.Context, in *v1.ListBilledUsa
 }
 
 func (s *UsageService) ListUsage(ctx context.Context, in *v1.ListUsageRequest) (*v1.ListUsageResponse, error) {
+	attributionId, err := db.ParseAttributionID(in.AttributionId)
+	if err != nil {
+		return nil, invalidAttributionIDError("AttributionID '%s' couldn't be parsed (error: %s).", in.AttributionId, err)
+	}
+
 	to := time.Now()
 	if in.To != nil {
 		to = in.To.AsTime()
@@ -132,25 +167,31 @@ func (s *UsageService) ListUsage(ctx context.Context, in *v1.ListUsageRequest) (
 		from = in.From.AsTime()
 	}
 
+	if in.From == nil && in.To == nil {
+		// Default to the current billing period of the cost center, if there is one.
+		costCenter, err := db.GetCostCenter(ctx, s.readConn(ctx), attributionId)
+		if err == nil {
+			from, to = costCenter.BillingPeriodAt(s.nowFunc())
+		} else if !errors.Is(err, db.CostCenterNotFound) {
+			requestid.Log(ctx).WithError(err).WithField("attribution_id", in.AttributionId).Error("Failed to get cost center.")
+			return nil, status.Error(codes.Internal, "unable to retrieve cost center")
+		}
+	}
+
 	if from.After(to) {
-		return nil, status.Errorf(codes.InvalidArgument, "Specified From timestamp is after To. Please ensure From is always before To")
+		return nil, invalidTimeRangeError("Specified From timestamp is after To. Please ensure From is always before To")
 	}
 
 	if to.Sub(from) > maxQuerySize {
-		return nil, status.Errorf(codes.InvalidArgument, "Maximum range exceeded. Range specified can be at most %s", maxQuerySize.String())
+		return nil, errorWithReason(codes.InvalidArgument, ErrorReason_UsageWindowTooLarge, map[string]string{"max_window": maxQuerySize.String()}, "Maximum range exceeded. Range specified can be at most %s", maxQuerySize.String())
 	}
 
 	if in.Pagination.PerPage < 0 {
-		return nil, status.Errorf(codes.InvalidArgument, "Number of items perPage needs to be positive (was %d).", in.Pagination.PerPage)
+		return nil, invalidPaginationError("Number of items perPage needs to be positive (was %d).", in.Pagination.PerPage)
 	}
 
 	if in.Pagination.Page < 0 {
-		return nil, status.Errorf(codes.InvalidArgument, "Page number needs to be 0 or greater (was %d).", in.Pagination.Page)
-	}
-
-	attributionId, err := db.ParseAttributionID(in.AttributionId)
-	if err != nil {
-		return nil, status.Errorf(codes.InvalidArgument, "AttributionID '%s' couldn't be parsed (error: %s).", in.AttributionId, err)
+		return nil, invalidPaginationError("Page number needs to be 0 or greater (was %d).", in.Pagination.Page)
 	}
 
 	order := db.DescendingOrder
@@ -165,7 +206,7 @@ func (s *UsageService) ListUsage(ctx context.Context, in *v1.ListUsageRequest) (
 	var page int64 = in.Pagination.Page
 	var offset int64 = perPage * page
 
-	listUsageResult, err := db.FindUsage(ctx, s.conn, &db.FindUsageParams{
+	listUsageResult, err := db.FindUsage(ctx, s.readConn(ctx), &db.FindUsageParams{
 		AttributionId: db.AttributionID(in.GetAttributionId()),
 		From:          from,
 		To:            to,
@@ -173,7 +214,7 @@ func (s *UsageService) ListUsage(ctx context.Context, in *v1.ListUsageRequest) (
 		Offset:        offset,
 		Limit:         perPage,
 	})
-	logger := log.Log.
+	logger := requestid.Log(ctx).
 		WithField("attribution_id", in.AttributionId).
 		WithField("perPage", perPage).
 		WithField("page", page).
@@ -187,8 +228,17 @@ func (s *UsageService) ListUsage(ctx context.Context, in *v1.ListUsageRequest) (
 	var usageData []*v1.Usage
 	for _, usageRecord := range listUsageResult {
 		kind := v1.Usage_KIND_WORKSPACE_INSTANCE
-		if usageRecord.Kind == db.InvoiceUsageKind {
+		switch usageRecord.Kind {
+		case db.InvoiceUsageKind:
 			kind = v1.Usage_KIND_INVOICE
+		case db.DisputeUsageKind:
+			kind = v1.Usage_KIND_DISPUTE
+		case db.CreditGrantUsageKind:
+			kind = v1.Usage_KIND_CREDIT_GRANT
+		case db.CreditGrantExpiryUsageKind:
+			kind = v1.Usage_KIND_CREDIT_GRANT_EXPIRY
+		case db.AdjustmentUsageKind:
+			kind = v1.Usage_KIND_ADJUSTMENT
 		}
 		usageDataEntry := &v1.Usage{
 			Id:            usageRecord.ID.String(),
@@ -200,11 +250,12 @@ func (s *UsageService) ListUsage(ctx context.Context, in *v1.ListUsageRequest) (
 			WorkspaceInstanceId: usageRecord.WorkspaceInstanceID.String(),
 			Draft:               usageRecord.Draft,
 			Metadata:            string(usageRecord.Metadata),
+			ProjectId:           usageRecord.ProjectID,
 		}
 		usageData = append(usageData, usageDataEntry)
 	}
 
-	usageSummary, err := db.GetUsageSummary(ctx, s.conn,
+	usageSummary, err := db.GetUsageSummary(ctx, s.readConn(ctx),
 		db.AttributionID(string(attributionId)),
 		from,
 		to,
@@ -237,64 +288,184 @@ func (s *UsageService) ReconcileUsage(ctx context.Context, req *v1.ReconcileUsag
 	to := req.GetEndTime().AsTime()
 
 	if to.Before(from) {
-		return nil, status.Errorf(codes.InvalidArgument, "End time must be after start time")
+		return nil, invalidTimeRangeError("End time must be after start time")
+	}
+
+	jobID := uuid.New()
+	if req.GetJobId() != "" {
+		parsed, err := uuid.Parse(req.GetJobId())
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "Invalid job ID %q", req.GetJobId())
+		}
+		jobID = parsed
 	}
 
-	report, err := s.reportGenerator.GenerateUsageReport(ctx, from, to)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if !s.reportJobs.add(jobID, cancel) {
+		return nil, status.Errorf(codes.AlreadyExists, "Report job %s is already running", jobID)
+	}
+	defer s.reportJobs.remove(jobID)
+
+	logger := requestid.Log(ctx).WithField("job_id", jobID)
+
+	err := db.CreateReportJob(ctx, s.conn, db.ReportJob{
+		ID:        jobID,
+		State:     db.ReportJobState_Running,
+		From:      from,
+		To:        to,
+		StartedAt: s.nowFunc(),
+	})
 	if err != nil {
-		log.Log.WithError(err).Error("Failed to reconcile time range.")
-		return nil, status.Error(codes.Internal, "failed to reconcile time range")
+		logger.WithError(err).Error("Failed to create report job.")
+		return nil, status.Error(codes.Internal, "failed to create report job")
 	}
 
-	err = db.CreateUsageRecords(ctx, s.conn, report.UsageRecords)
+	reportID, err := s.reconcileUsage(ctx, jobID, from, to)
+
+	// The job state must be recorded even when the request context was cancelled.
+	finishCtx := db.WithCaller(requestid.WithID(context.Background(), requestid.FromContext(ctx)), "report_job")
 	if err != nil {
-		log.Log.WithError(err).Error("Failed to persist usage records.")
-		return nil, status.Error(codes.Internal, "failed to persist usage records")
+		state := db.ReportJobState_Failed
+		if ctx.Err() != nil {
+			state = db.ReportJobState_Cancelled
+		}
+		if finishErr := db.FinishReportJob(finishCtx, s.conn, jobID, state, "", err.Error(), s.nowFunc()); finishErr != nil {
+			logger.WithError(finishErr).Error("Failed to record report job failure.")
+		}
+		if state == db.ReportJobState_Cancelled {
+			return nil, status.Errorf(codes.Canceled, "report job %s was cancelled", jobID)
+		}
+		return nil, err
 	}
 
-	filename := fmt.Sprintf("%s.gz", time.Now().Format(time.RFC3339))
-	err = s.contentService.UploadUsageReport(ctx, filename, report)
+	err = db.FinishReportJob(finishCtx, s.conn, jobID, db.ReportJobState_Completed, reportID, "", s.nowFunc())
 	if err != nil {
-		log.Log.WithError(err).Error("Failed to persist usage report to content service.")
-		return nil, status.Error(codes.Internal, "failed to persist usage report to content service")
+		logger.WithError(err).Error("Failed to record report job completion.")
 	}
 
 	return &v1.ReconcileUsageResponse{
-		ReportId: filename,
+		ReportId: reportID,
+		JobId:    jobID.String(),
 	}, nil
+}
+
+func (s *UsageService) reconcileUsage(ctx context.Context, jobID uuid.UUID, from, to time.Time) (string, error) {
+	logger := requestid.Log(ctx).WithField("job_id", jobID)
+
+	report, err := s.reportGenerator.GenerateUsageReportWithProgress(ctx, from, to, func(processed, total int64) {
+		if err := db.UpdateReportJobProgress(ctx, s.conn, jobID, processed, total); err != nil {
+			logger.WithError(err).Warn("Failed to update report job progress.")
+		}
+	})
+	if err != nil {
+		logger.WithError(err).Error("Failed to reconcile time range.")
+		return "", status.Error(codes.Internal, "failed to reconcile time range")
+	}
 
+	err = db.CreateUsageRecords(ctx, s.conn, report.UsageRecords)
+	if err != nil {
+		logger.WithError(err).Error("Failed to persist usage records.")
+		return "", status.Error(codes.Internal, "failed to persist usage records")
+	}
+
+	filename, err := contentservice.PublishUsageReport(ctx, s.contentService, report)
+	if err != nil {
+		logger.WithError(err).Error("Failed to persist usage report to content service.")
+		return "", status.Error(codes.Internal, "failed to persist usage report to content service")
+	}
+
+	return filename, nil
 }
 
 func (s *UsageService) GetCostCenter(ctx context.Context, in *v1.GetCostCenterRequest) (*v1.GetCostCenterResponse, error) {
 	var attributionIdReq string
 
 	if in.AttributionId == "" {
-		return nil, status.Errorf(codes.InvalidArgument, "Empty attributionId")
+		return nil, invalidAttributionIDError("Empty attributionId")
 	}
 
 	attributionIdReq = in.AttributionId
 
 	attributionId, err := db.ParseAttributionID(attributionIdReq)
 	if err != nil {
-		return nil, status.Errorf(codes.InvalidArgument, "Failed to parse attribution ID: %s", err.Error())
+		return nil, invalidAttributionIDError("Failed to parse attribution ID: %s", err.Error())
 	}
 
-	result, err := db.GetCostCenter(ctx, s.conn, db.AttributionID(attributionIdReq))
+	result, err := db.GetCostCenter(ctx, s.conn, attributionId)
 	if err != nil {
 		if errors.Is(err, db.CostCenterNotFound) {
-			return nil, status.Errorf(codes.NotFound, "Cost center not found: %s", err.Error())
+			return nil, attributionNotFoundError(attributionId, err)
 		}
 		return nil, status.Errorf(codes.Internal, "Failed to get cost center %s from DB: %s", in.AttributionId, err.Error())
 	}
 
+	costCenter, err := s.costCenterToAPI(ctx, result)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to get usage in billing period of cost center %s: %s", in.AttributionId, err.Error())
+	}
+
 	return &v1.GetCostCenterResponse{
-		CostCenter: &v1.CostCenter{
-			AttributionId: string(attributionId),
-			SpendingLimit: result.SpendingLimit,
-		},
+		CostCenter: costCenter,
 	}, nil
 }
 
+// costCenterToAPI converts the cost center, including its usage in the current billing period and its dunning state.
+func (s *UsageService) costCenterToAPI(ctx context.Context, result *db.CostCenter) (*v1.CostCenter, error) {
+	periodStart, periodEnd := result.BillingPeriodAt(s.nowFunc())
+	creditsUsed, err := db.GetWorkspaceUsageForAttribution(ctx, s.conn, result.ID, periodStart, periodEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	costCenter := &v1.CostCenter{
+		AttributionId:      string(result.ID),
+		SpendingLimit:      result.SpendingLimit,
+		BillingPeriodStart: timestamppb.New(periodStart),
+		BillingPeriodEnd:   timestamppb.New(periodEnd),
+		CreditsUsed:        creditsUsed.ToCredits(),
+		SpendingLimitType:  spendingLimitTypeToAPI(result.SpendingLimitType),
+		Currency:           costCenterCurrency(result),
+		State:              costCenterStateToAPI(result.State),
+		RolloverLimit:      result.RolloverLimit,
+		BillingStrategy:    billingStrategyToAPI(result.BillingStrategy),
+	}
+	if result.BillingCycleAnchor.IsSet() {
+		costCenter.BillingCycleAnchor = timestamppb.New(result.BillingCycleAnchor.Time())
+	}
+
+	splits, err := db.FindCostCenterSplitsByAttributionIDs(ctx, s.conn, []db.AttributionID{result.ID})
+	if err != nil {
+		return nil, err
+	}
+	for _, split := range splits[result.ID] {
+		costCenter.Splits = append(costCenter.Splits, &v1.CostCenterSplit{
+			TargetAttributionId: string(split.TargetAttributionID),
+			Percentage:          split.Percentage,
+		})
+	}
+
+	dunningState, dunningStateEndsAt := s.dunningPeriods.stateAt(result.PaymentFailedAt, s.nowFunc())
+	costCenter.DunningState = dunningState.toAPI()
+	if result.PaymentFailedAt.IsSet() {
+		costCenter.PaymentFailedAt = timestamppb.New(result.PaymentFailedAt.Time())
+	}
+	if !dunningStateEndsAt.IsZero() {
+		costCenter.DunningStateEndsAt = timestamppb.New(dunningStateEndsAt)
+	}
+	return costCenter, nil
+}
+
+func costCenterStateToAPI(state db.CostCenterState) v1.CostCenter_State {
+	switch state {
+	case db.CostCenterState_Active:
+		return v1.CostCenter_STATE_ACTIVE
+	case db.CostCenterState_Disputed:
+		return v1.CostCenter_STATE_DISPUTED
+	}
+	return v1.CostCenter_STATE_UNSPECIFIED
+}
+
 func (s *UsageService) ReconcileUsageWithLedger(ctx context.Context, req *v1.ReconcileUsageWithLedgerRequest) (*v1.ReconcileUsageWithLedgerResponse, error) {
 	from := req.GetFrom().AsTime()
 	to := req.GetTo().AsTime()
@@ -304,7 +475,7 @@ func (s *UsageService) ReconcileUsageWithLedger(ctx context.Context, req *v1.Rec
 		WithField("to", to)
 
 	if to.Before(from) {
-		return nil, status.Errorf(codes.InvalidArgument, "To must not be before From")
+		return nil, invalidTimeRangeError("To must not be before From")
 	}
 
 	now := s.nowFunc()
@@ -341,84 +512,246 @@ func (s *UsageService) ReconcileUsageWithLedger(ctx context.Context, req *v1.Rec
 	logger.Infof("Found %d workspaces instances for usage records in draft.", len(instancesWithUsageInDraft))
 	instances = append(instances, instancesWithUsageInDraft...)
 
-	inserts, updates, err := reconcileUsageWithLedger(instances, usageDrafts, s.pricer, now)
+	planChanges, err := db.FindPlanChangesByAttributionIDs(ctx, s.conn, collectAttributionIDs(instances))
+	if err != nil {
+		logger.WithError(err).Errorf("Failed to find plan changes.")
+		return nil, status.Errorf(codes.Internal, "failed to find plan changes")
+	}
+
+	splits, err := db.FindCostCenterSplitsByAttributionIDs(ctx, s.conn, collectAttributionIDs(instances))
+	if err != nil {
+		logger.WithError(err).Errorf("Failed to find cost center splits.")
+		return nil, status.Errorf(codes.Internal, "failed to find cost center splits")
+	}
+
+	inserts, updates, err := reconcileUsageWithLedger(ctx, instances, usageDrafts, s.pricer, planChanges, splits, now)
 	if err != nil {
 		logger.WithError(err).Errorf("Failed to reconcile usage with ledger.")
 		return nil, status.Errorf(codes.Internal, "Failed to reconcile usage with ledger.")
 	}
+
+	// The usage of instances which stopped in range was finalized by an earlier reconciliation already.
+	existing, err := db.FindWorkspaceInstanceUsage(ctx, s.conn, collectWorkspaceInstanceIDs(inserts))
+	if err != nil {
+		logger.WithError(err).Errorf("Failed to find existing usage of workspace instances.")
+		return nil, status.Errorf(codes.Internal, "failed to find existing usage of workspace instances")
+	}
+	inserts = withoutExistingUsage(inserts, existing)
 	logger.Infof("Identified %d inserts and %d updates against usage records.", len(inserts), len(updates))
 
-	if len(inserts) > 0 {
-		err = db.InsertUsage(ctx, s.conn, inserts...)
+	var balancesBefore map[db.AttributionID]balance
+	if s.spendingLimitNotifier != nil || s.analytics != nil || s.webhooks != nil || s.limitStates != nil {
+		balancesBefore, err = s.getBalances(ctx, collectUsageAttributionIDs(append(inserts, updates...)), now)
 		if err != nil {
-			logger.WithError(err).Errorf("Failed to insert %d usage records into the database.", len(inserts))
-			return nil, status.Errorf(codes.Internal, "Failed to insert usage records into the database.")
+			logger.WithError(err).Errorf("Failed to get balances before reconciliation.")
+			return nil, status.Errorf(codes.Internal, "Failed to get balances.")
 		}
-		logger.Infof("Inserted %d new Usage records into the database.", len(inserts))
 	}
 
-	if len(updates) > 0 {
-		err = db.UpdateUsage(ctx, s.conn, updates...)
+	if len(inserts) > 0 || len(updates) > 0 {
+		err = db.UpsertUsage(ctx, s.conn, append(inserts, updates...)...)
+		if errors.Is(err, db.UsageVersionConflict) {
+			logger.WithError(err).Warn("Usage records were updated concurrently, reconciliation needs to be retried.")
+			return nil, status.Errorf(codes.Aborted, "Usage records were updated concurrently, retry reconciliation.")
+		}
 		if err != nil {
-			logger.WithError(err).Error("Failed to update usage records in the database.")
-			return nil, status.Errorf(codes.Internal, "Failed to update usage records in the database.")
+			logger.WithError(err).Errorf("Failed to write %d inserts and %d updates of usage records to the database.", len(inserts), len(updates))
+			return nil, status.Errorf(codes.Internal, "Failed to write usage records to the database.")
+		}
+		logger.Infof("Inserted %d and updated %d Usage records in the database.", len(inserts), len(updates))
+		reportCreditsBilled(s.pricer, usageDrafts, append(inserts, updates...))
+		if s.analytics != nil {
+			s.trackSessionsBilled(instances, append(inserts, updates...))
+		}
+		publishUsageEvents(ctx, s.events, notifier.UsageInstanceBilledEvent, billedInstanceUsage(append(inserts, updates...)))
+
+		// Days are only summarized once they are over, such that later usage of the current day does not invalidate them.
+		refreshFailures := newRecordLogSampler(s.logSampling, logger, logrus.ErrorLevel, "Failed to refresh daily usage summaries.")
+		for _, attributionID := range collectUsageAttributionIDs(append(inserts, updates...)) {
+			err := db.RefreshUsageDailySummaries(ctx, s.conn, attributionID, now)
+			if err != nil {
+				refreshFailures.Log(logger.WithError(err).WithField("attribution_id", attributionID), attributionID)
+			}
 		}
-		logger.Infof("Updated %d Usage records in the database.", len(updates))
+		refreshFailures.Close()
+	}
+	reportOldestDraft(usageDrafts, append(inserts, updates...))
+
+	balancesAfter, err := s.getBalances(ctx, collectUsageAttributionIDs(append(inserts, updates...)), now)
+	if err != nil {
+		// The usage is already recorded at this point, only notifications are skipped.
+		logger.WithError(err).Error("Failed to get balances after reconciliation.")
+		return &v1.ReconcileUsageWithLedgerResponse{}, nil
+	}
+	if s.spendingLimitNotifier != nil || s.analytics != nil || s.webhooks != nil {
+		s.notifySpendingLimits(ctx, balancesBefore, balancesAfter, now)
+	}
+	if s.limitStates != nil {
+		s.notifySpendingLimitStates(ctx, balancesBefore, balancesAfter)
+	}
+	s.notifyBudgetThresholds(ctx, balancesAfter, now)
+	if s.analytics != nil {
+		s.trackFirstPaidUsage(ctx, balancesBefore, balancesAfter, now)
 	}
 
 	return &v1.ReconcileUsageWithLedgerResponse{}, nil
 }
 
-func reconcileUsageWithLedger(instances []db.WorkspaceInstanceForUsage, drafts []db.Usage, pricer *WorkspacePricer, now time.Time) (inserts []db.Usage, updates []db.Usage, err error) {
+func reconcileUsageWithLedger(ctx context.Context, instances []db.WorkspaceInstanceForUsage, drafts []db.Usage, pricer *WorkspacePricer, planChanges map[db.AttributionID][]db.PlanChange, splits map[db.AttributionID][]db.CostCenterSplit, now time.Time) (inserts []db.Usage, updates []db.Usage, err error) {
 
 	instancesByID := dedupeWorkspaceInstancesForUsage(instances)
 
 	draftsByWorkspaceID := map[uuid.UUID]db.Usage{}
+	// splitDraftsByWorkspaceID holds the drafts charged to split targets, by workspace instance and target.
+	splitDraftsByWorkspaceID := map[uuid.UUID]map[db.AttributionID]db.Usage{}
 	for _, draft := range drafts {
-		draftsByWorkspaceID[draft.WorkspaceInstanceID] = draft
+		if !isSplitUsage(draft) {
+			draftsByWorkspaceID[draft.WorkspaceInstanceID] = draft
+			continue
+		}
+		if splitDraftsByWorkspaceID[draft.WorkspaceInstanceID] == nil {
+			splitDraftsByWorkspaceID[draft.WorkspaceInstanceID] = map[db.AttributionID]db.Usage{}
+		}
+		splitDraftsByWorkspaceID[draft.WorkspaceInstanceID][draft.AttributionID] = draft
 	}
 
 	for instanceID, instance := range instancesByID {
-		if usage, exists := draftsByWorkspaceID[instanceID]; exists {
-			updatedUsage, err := updateUsageFromInstance(instance, usage, pricer, now)
-			if err != nil {
-				return nil, nil, fmt.Errorf("failed to construct updated usage record: %w", err)
+		var usage db.Usage
+		draft, exists := draftsByWorkspaceID[instanceID]
+		if exists {
+			usage, err = updateUsageFromInstance(ctx, instance, draft, pricer, planChanges[instance.UsageAttributionID], now)
+		} else {
+			usage, err = newUsageFromInstance(ctx, instance, pricer, planChanges[instance.UsageAttributionID], now)
+		}
+		if errors.Is(err, errPricingUnavailable) {
+			// The usage must not be finalized at rates which do not apply. Drafts are reconciled again, until the
+			// instance can be priced.
+			requestid.Log(ctx).WithError(err).WithField("instance_id", instanceID).Warn("Failed to price workspace instance, leaving its usage in draft.")
+			if exists {
+				continue
 			}
-			updates = append(updates, updatedUsage)
-			continue
+			usage, err = newUnpricedUsageFromInstance(instance, now)
 		}
-
-		usage, err := newUsageFromInstance(instance, pricer, now)
 		if err != nil {
 			return nil, nil, fmt.Errorf("failed to construct usage record: %w", err)
 		}
-		inserts = append(inserts, usage)
+
+		splitDrafts := splitDraftsByWorkspaceID[instanceID]
+		entries, err := splitUsage(usage, splits[instance.UsageAttributionID], splitDrafts)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to split usage record: %w", err)
+		}
+		if exists {
+			updates = append(updates, entries[0])
+		} else {
+			inserts = append(inserts, entries[0])
+		}
+		for _, entry := range entries[1:] {
+			if _, isSplitDraft := splitDrafts[entry.AttributionID]; isSplitDraft {
+				updates = append(updates, entry)
+			} else {
+				inserts = append(inserts, entry)
+			}
+		}
 	}
 
 	return inserts, updates, nil
 }
 
+// splitUsage charges the shares of the usage to the split targets of its cost center, and returns the usage with the
+// remaining credits followed by one entry per target. Rounding remainders stay with the cost center of the usage, such
+// that the total is preserved. Drafts of targets which are no longer split targets are returned without credits.
+func splitUsage(usage db.Usage, splits []db.CostCenterSplit, splitDrafts map[db.AttributionID]db.Usage) ([]db.Usage, error) {
+	if len(splits) == 0 && len(splitDrafts) == 0 {
+		return []db.Usage{usage}, nil
+	}
+
+	var data db.WorkspaceInstanceUsageData
+	if len(usage.Metadata) > 0 {
+		var err error
+		data, err = usage.GetMetadataAsWorkspaceInstanceData()
+		if err != nil {
+			return nil, err
+		}
+	}
+	data.SplitFromAttributionId = usage.AttributionID
+
+	remaining := usage
+	var targets []db.Usage
+	charged := map[db.AttributionID]bool{}
+	for _, split := range splits {
+		charged[split.TargetAttributionID] = true
+		share := usage.CreditCents * db.CreditCents(split.Percentage) / 100
+		remaining.CreditCents -= share
+		targets = append(targets, splitEntry(usage, split.TargetAttributionID, share, splitDrafts))
+	}
+	for attributionId := range splitDrafts {
+		if !charged[attributionId] {
+			targets = append(targets, splitEntry(usage, attributionId, 0, splitDrafts))
+		}
+	}
+
+	for i := range targets {
+		if err := targets[i].SetMetadataWithWorkspaceInstance(data); err != nil {
+			return nil, err
+		}
+	}
+	return append([]db.Usage{remaining}, targets...), nil
+}
+
+func splitEntry(usage db.Usage, target db.AttributionID, creditCents db.CreditCents, splitDrafts map[db.AttributionID]db.Usage) db.Usage {
+	entry := usage
+	entry.ID = db.WorkspaceInstanceUsageID(usage.WorkspaceInstanceID, target)
+	entry.Version = 0
+	if draft, exists := splitDrafts[target]; exists {
+		entry.ID = draft.ID
+		entry.Version = draft.Version
+	}
+	entry.AttributionID = target
+	entry.CreditCents = creditCents
+	return entry
+}
+
+// isSplitUsage is true for usage which was charged to a split target of a cost center.
+func isSplitUsage(usage db.Usage) bool {
+	if len(usage.Metadata) == 0 {
+		return false
+	}
+	data, err := usage.GetMetadataAsWorkspaceInstanceData()
+	return err == nil && data.SplitFromAttributionId != ""
+}
+
 const usageDescriptionFromController = "Usage collected by automated system."
 
-func newUsageFromInstance(instance db.WorkspaceInstanceForUsage, pricer *WorkspacePricer, now time.Time) (db.Usage, error) {
-	draft := true
-	if instance.StoppingTime.IsSet() {
-		draft = false
+func newUsageFromInstance(ctx context.Context, instance db.WorkspaceInstanceForUsage, pricer *WorkspacePricer, planChanges []db.PlanChange, now time.Time) (db.Usage, error) {
+	credits, pricingSegments, err := pricer.CreditsUsedByInstanceWithPlanChanges(ctx, &instance, planChanges, now)
+	if err != nil {
+		return db.Usage{}, fmt.Errorf("failed to price workspace instance %s: %w", instance.ID, err)
 	}
+	return usageFromInstance(instance, credits, pricingSegments, !instance.StoppingTime.IsSet(), now)
+}
+
+// newUnpricedUsageFromInstance constructs a draft without credits for an instance which could not be priced, such that
+// the next reconciliation prices it.
+func newUnpricedUsageFromInstance(instance db.WorkspaceInstanceForUsage, now time.Time) (db.Usage, error) {
+	return usageFromInstance(instance, 0, nil, true, now)
+}
 
+func usageFromInstance(instance db.WorkspaceInstanceForUsage, credits float64, pricingSegments []db.PricingSegment, draft bool, now time.Time) (db.Usage, error) {
 	effectiveTime := now
 	if instance.StoppingTime.IsSet() {
 		effectiveTime = instance.StoppingTime.Time()
 	}
 
 	usage := db.Usage{
-		ID:                  uuid.New(),
+		ID:                  db.WorkspaceInstanceUsageID(instance.ID, instance.UsageAttributionID),
 		AttributionID:       instance.UsageAttributionID,
 		Description:         usageDescriptionFromController,
-		CreditCents:         db.NewCreditCents(pricer.CreditsUsedByInstance(&instance, now)),
+		CreditCents:         db.NewCreditCents(credits),
 		EffectiveTime:       db.NewVarcharTime(effectiveTime),
 		Kind:                db.WorkspaceInstanceUsageKind,
 		WorkspaceInstanceID: instance.ID,
+		ProjectID:           instance.ProjectID.String,
 		Draft:               draft,
 	}
 
@@ -431,14 +764,15 @@ func newUsageFromInstance(instance db.WorkspaceInstanceForUsage, pricer *Workspa
 		endTime = db.TimeToISO8601(instance.StoppingTime.Time())
 	}
 	err := usage.SetMetadataWithWorkspaceInstance(db.WorkspaceInstanceUsageData{
-		WorkspaceId:    instance.WorkspaceID,
-		WorkspaceType:  instance.Type,
-		WorkspaceClass: instance.WorkspaceClass,
-		ContextURL:     "",
-		StartTime:      startedTime,
-		EndTime:        endTime,
-		UserName:       "",
-		UserAvatarURL:  "",
+		WorkspaceId:     instance.WorkspaceID,
+		WorkspaceType:   instance.Type,
+		WorkspaceClass:  instance.WorkspaceClass,
+		ContextURL:      "",
+		StartTime:       startedTime,
+		EndTime:         endTime,
+		UserName:        "",
+		UserAvatarURL:   "",
+		PricingSegments: pricingSegments,
 	})
 	if err != nil {
 		return db.Usage{}, fmt.Errorf("failed to serialize workspace instance metadata: %w", err)
@@ -447,18 +781,41 @@ func newUsageFromInstance(instance db.WorkspaceInstanceForUsage, pricer *Workspa
 	return usage, nil
 }
 
-func updateUsageFromInstance(instance db.WorkspaceInstanceForUsage, usage db.Usage, pricer *WorkspacePricer, now time.Time) (db.Usage, error) {
+func updateUsageFromInstance(ctx context.Context, instance db.WorkspaceInstanceForUsage, usage db.Usage, pricer *WorkspacePricer, planChanges []db.PlanChange, now time.Time) (db.Usage, error) {
 	// We construct a new record to ensure we always take the data from the source of truth - the workspace instance
-	updated, err := newUsageFromInstance(instance, pricer, now)
+	updated, err := newUsageFromInstance(ctx, instance, pricer, planChanges, now)
 	if err != nil {
 		return db.Usage{}, fmt.Errorf("failed to construct updated usage record: %w", err)
 	}
-	// but we override the ID to the one we already have
+	// but we override the ID to the one we already have, and only update the version we read
 	updated.ID = usage.ID
+	updated.Version = usage.Version
 
 	return updated, nil
 }
 
+// withoutExistingUsage removes the inserts of workspace instances which were already charged to the attribution ID
+// of the insert, such that usage is recorded at most once per instance and attribution ID.
+func withoutExistingUsage(inserts []db.Usage, existing []db.Usage) []db.Usage {
+	type key struct {
+		workspaceInstanceID uuid.UUID
+		attributionID       db.AttributionID
+	}
+	recorded := map[key]bool{}
+	for _, usage := range existing {
+		recorded[key{usage.WorkspaceInstanceID, usage.AttributionID}] = true
+	}
+
+	var result []db.Usage
+	for _, insert := range inserts {
+		if recorded[key{insert.WorkspaceInstanceID, insert.AttributionID}] {
+			continue
+		}
+		result = append(result, insert)
+	}
+	return result
+}
+
 func collectWorkspaceInstanceIDs(usage []db.Usage) []uuid.UUID {
 	var ids []uuid.UUID
 	for _, u := range usage {
@@ -467,6 +824,32 @@ func collectWorkspaceInstanceIDs(usage []db.Usage) []uuid.UUID {
 	return ids
 }
 
+func collectUsageAttributionIDs(usage []db.Usage) []db.AttributionID {
+	seen := map[db.AttributionID]bool{}
+	var ids []db.AttributionID
+	for _, u := range usage {
+		if seen[u.AttributionID] {
+			continue
+		}
+		seen[u.AttributionID] = true
+		ids = append(ids, u.AttributionID)
+	}
+	return ids
+}
+
+func collectAttributionIDs(instances []db.WorkspaceInstanceForUsage) []db.AttributionID {
+	seen := map[db.AttributionID]bool{}
+	var ids []db.AttributionID
+	for _, instance := range instances {
+		if seen[instance.UsageAttributionID] {
+			continue
+		}
+		seen[instance.UsageAttributionID] = true
+		ids = append(ids, instance.UsageAttributionID)
+	}
+	return ids
+}
+
 func dedupeWorkspaceInstancesForUsage(instances []db.WorkspaceInstanceForUsage) map[uuid.UUID]db.WorkspaceInstanceForUsage {
 	set := map[uuid.UUID]db.WorkspaceInstanceForUsage{}
 	for _, instance := range instances {
@@ -475,19 +858,40 @@ func dedupeWorkspaceInstancesForUsage(instances []db.WorkspaceInstanceForUsage)
 	return set
 }
 
-func NewUsageService(conn *gorm.DB, reportGenerator *ReportGenerator, contentSvc contentservice.Interface, pricer *WorkspacePricer) *UsageService {
+func NewUsageService(conn *gorm.DB, reportGenerator *ReportGenerator, contentSvc contentservice.Interface, pricer *WorkspacePricer, spendingLimitNotifier SpendingLimitNotifier, graceMargin SpendingLimitGraceMargin, creditPrices CreditPrices, dunningPeriods DunningPeriods, deletedUsageRetention time.Duration, replica *db.ReplicaRouter, logSampling LogSamplingConfig, analytics analytics.Writer, events UsageEventPublisher, webhooks *UsageWebhookConfig, exporters []UsageExporter, limitStates v1.UsageNotificationServiceClient, writeQueue *db.UsageWriteQueue) *UsageService {
 	return &UsageService{
 		conn: conn,
 		nowFunc: func() time.Time {
 			return time.Now().UTC()
 		},
-		pricer:          pricer,
-		reportGenerator: reportGenerator,
-		contentService:  contentSvc,
+		pricer:                pricer,
+		reportGenerator:       reportGenerator,
+		contentService:        contentSvc,
+		spendingLimitNotifier: spendingLimitNotifier,
+		graceMargin:           graceMargin,
+		creditPrices:          creditPrices,
+		dunningPeriods:        dunningPeriods,
+		deletedUsageRetention: deletedUsageRetention,
+		replica:               replica,
+		logSampling:           logSampling,
+		analytics:             analytics,
+		events:                events,
+		webhooks:              webhooks,
+		exporters:             exporters,
+		limitStates:           limitStates,
+		writeQueue:            writeQueue,
 	}
 }
 
-func instancesToUsageRecords(instances []db.WorkspaceInstanceForUsage, pricer *WorkspacePricer, now time.Time) []db.WorkspaceInstanceUsage {
+// readConn returns the connection for queries which tolerate replication lag.
+func (s *UsageService) readConn(ctx context.Context) *gorm.DB {
+	if s.replica == nil {
+		return s.conn
+	}
+	return s.replica.Reader(ctx)
+}
+
+func instancesToUsageRecords(ctx context.Context, instances []db.WorkspaceInstanceForUsage, pricer *WorkspacePricer, now time.Time) ([]db.WorkspaceInstanceUsage, error) {
 	var usageRecords []db.WorkspaceInstanceUsage
 
 	for _, instance := range instances {
@@ -501,6 +905,11 @@ func instancesToUsageRecords(instances []db.WorkspaceInstanceForUsage, pricer *W
 			projectID = instance.ProjectID.String
 		}
 
+		creditsUsed, err := pricer.CreditsUsedByInstance(ctx, &instance, now)
+		if err != nil {
+			return nil, fmt.Errorf("failed to price workspace instance %s: %w", instance.ID, err)
+		}
+
 		usageRecords = append(usageRecords, db.WorkspaceInstanceUsage{
 			InstanceID:     instance.ID,
 			AttributionID:  instance.UsageAttributionID,
@@ -511,10 +920,10 @@ func instancesToUsageRecords(instances []db.WorkspaceInstanceForUsage, pricer *W
 			WorkspaceClass: instance.WorkspaceClass,
 			StartedAt:      instance.StartedTime.Time(),
 			StoppedAt:      stoppedAt,
-			CreditsUsed:    pricer.CreditsUsedByInstance(&instance, now),
+			CreditsUsed:    creditsUsed,
 			GenerationID:   0,
 		})
 	}
 
-	return usageRecords
+	return usageRecords, nil
 }
@@ -0,0 +1,268 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/requestid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxUsageAdjustments is the number of adjustments which can be imported at once.
+const maxUsageAdjustments = 10000
+
+// maxAdjustmentDescriptionLength is the length of the description column of the usage table.
+const maxAdjustmentDescriptionLength = 255
+
+// usageAdjustmentColumns are the columns which the header of an import must name.
+var usageAdjustmentColumns = []string{"attribution_id", "credits", "description", "effective_time"}
+
+type usageAdjustment struct {
+	line          int
+	attributionID db.AttributionID
+	credits       float64
+	description   string
+	effectiveTime time.Time
+}
+
+func (s *UsageService) ImportUsageAdjustments(ctx context.Context, in *v1.ImportUsageAdjustmentsRequest) (*v1.ImportUsageAdjustmentsResponse, error) {
+	if len(in.GetCsv()) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "CSV must be specified")
+	}
+	if in.GetActor() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "Actor must be specified")
+	}
+	if in.GetReason() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "Reason must be specified")
+	}
+
+	now := s.nowFunc()
+	adjustments, invalid, err := parseUsageAdjustments(in.GetCsv(), now)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Failed to parse CSV: %s", err.Error())
+	}
+	if len(adjustments)+len(invalid) > maxUsageAdjustments {
+		return nil, status.Errorf(codes.InvalidArgument, "At most %d adjustments can be imported at once", maxUsageAdjustments)
+	}
+
+	adjustments, missing, err := s.filterAdjustmentsWithCostCenter(ctx, adjustments)
+	if err != nil {
+		return nil, err
+	}
+	invalid = append(invalid, missing...)
+	sort.SliceStable(invalid, func(i, j int) bool {
+		return invalid[i].GetLine() < invalid[j].GetLine()
+	})
+
+	importID := fmt.Sprintf("%x", sha256.Sum256(in.GetCsv()))
+	resp := summarizeUsageAdjustments(importID, adjustments)
+	if len(invalid) > 0 {
+		if in.GetDryRun() {
+			resp.InvalidLines = invalid
+			return resp, nil
+		}
+		return nil, errorWithReason(codes.InvalidArgument, ErrorReason_InvalidUsageAdjustments,
+			map[string]string{"line": strconv.Itoa(int(invalid[0].GetLine())), "invalid_lines": strconv.Itoa(len(invalid))},
+			"Line %d is invalid: %s", invalid[0].GetLine(), invalid[0].GetMessage())
+	}
+	if in.GetDryRun() || len(adjustments) == 0 {
+		return resp, nil
+	}
+
+	logger := requestid.Log(ctx).WithField("import_id", importID).WithField("actor", in.GetActor())
+	var entries []db.Usage
+	for _, adjustment := range adjustments {
+		entry, err := db.NewAdjustmentUsage(adjustment.attributionID, adjustment.credits, adjustment.description, adjustment.effectiveTime, db.AdjustmentUsageData{
+			Actor:    in.GetActor(),
+			Reason:   in.GetReason(),
+			ImportID: importID,
+			Line:     adjustment.line,
+		})
+		if err != nil {
+			logger.WithError(err).Error("Failed to construct usage adjustment.")
+			return nil, status.Errorf(codes.Internal, "Failed to construct adjustment of line %d", adjustment.line)
+		}
+		entries = append(entries, entry)
+	}
+
+	// All adjustments are inserted in one transaction, adjustments which were imported before are skipped.
+	err = db.InsertUsage(ctx, s.conn, entries...)
+	if err != nil {
+		logger.WithError(err).Error("Failed to insert usage adjustments.")
+		return nil, status.Errorf(codes.Internal, "Failed to insert usage adjustments")
+	}
+	logger.
+		WithField("adjustments", resp.GetAdjustments()).
+		WithField("credits", resp.GetCredits()).
+		Info("Imported usage adjustments.")
+
+	resp.Applied = true
+	return resp, nil
+}
+
+// parseUsageAdjustments parses the adjustments of the CSV. Lines which can be parsed, but contain invalid values, are
+// returned as invalid lines. Errors are returned for CSV which can not be parsed at all, e.g. without a valid header.
+func parseUsageAdjustments(b []byte, now time.Time) ([]usageAdjustment, []*v1.ImportUsageAdjustmentsResponse_InvalidLine, error) {
+	r := csv.NewReader(bytes.NewReader(b))
+	r.TrimLeadingSpace = true
+	// Lines with missing columns are reported as invalid lines, instead of failing the whole import.
+	r.FieldsPerRecord = -1
+
+	header, err := r.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range usageAdjustmentColumns {
+		if _, ok := columns[name]; !ok {
+			return nil, nil, fmt.Errorf("header must name the column %s", name)
+		}
+	}
+
+	var adjustments []usageAdjustment
+	var invalid []*v1.ImportUsageAdjustmentsResponse_InvalidLine
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		line, _ := r.FieldPos(0)
+		if len(record) != len(header) {
+			invalid = append(invalid, &v1.ImportUsageAdjustmentsResponse_InvalidLine{Line: int32(line), Message: fmt.Sprintf("line must have %d columns, had %d", len(header), len(record))})
+			continue
+		}
+
+		adjustment, err := parseUsageAdjustment(record, columns, now)
+		if err != nil {
+			invalid = append(invalid, &v1.ImportUsageAdjustmentsResponse_InvalidLine{Line: int32(line), Message: err.Error()})
+			continue
+		}
+		adjustment.line = line
+		adjustments = append(adjustments, adjustment)
+	}
+	return adjustments, invalid, nil
+}
+
+func parseUsageAdjustment(record []string, columns map[string]int, now time.Time) (usageAdjustment, error) {
+	attributionID, err := db.ParseAttributionID(strings.TrimSpace(record[columns["attribution_id"]]))
+	if err != nil {
+		return usageAdjustment{}, fmt.Errorf("invalid attribution ID: %w", err)
+	}
+
+	credits, err := strconv.ParseFloat(strings.TrimSpace(record[columns["credits"]]), 64)
+	if err != nil || math.IsNaN(credits) || math.IsInf(credits, 0) {
+		return usageAdjustment{}, fmt.Errorf("credits must be a number, was %q", record[columns["credits"]])
+	}
+	if db.NewCreditCents(credits) == 0 {
+		return usageAdjustment{}, fmt.Errorf("credits must be at least 0.01 credits away from 0")
+	}
+
+	description := strings.TrimSpace(record[columns["description"]])
+	if description == "" {
+		return usageAdjustment{}, fmt.Errorf("description must be specified")
+	}
+	if utf8.RuneCountInString(description) > maxAdjustmentDescriptionLength {
+		return usageAdjustment{}, fmt.Errorf("description must be at most %d characters", maxAdjustmentDescriptionLength)
+	}
+
+	effectiveTime, err := time.Parse(time.RFC3339, strings.TrimSpace(record[columns["effective_time"]]))
+	if err != nil {
+		return usageAdjustment{}, fmt.Errorf("effective time must be an RFC 3339 timestamp, was %q", record[columns["effective_time"]])
+	}
+	if effectiveTime.After(now) {
+		return usageAdjustment{}, fmt.Errorf("effective time must not be in the future")
+	}
+
+	return usageAdjustment{
+		attributionID: attributionID,
+		credits:       credits,
+		description:   description,
+		effectiveTime: effectiveTime.UTC(),
+	}, nil
+}
+
+// filterAdjustmentsWithCostCenter returns the adjustments of attribution IDs with a cost center, and the adjustments of
+// attribution IDs without one as invalid lines.
+func (s *UsageService) filterAdjustmentsWithCostCenter(ctx context.Context, adjustments []usageAdjustment) ([]usageAdjustment, []*v1.ImportUsageAdjustmentsResponse_InvalidLine, error) {
+	exists := map[db.AttributionID]bool{}
+	var valid []usageAdjustment
+	var invalid []*v1.ImportUsageAdjustmentsResponse_InvalidLine
+	for _, adjustment := range adjustments {
+		found, checked := exists[adjustment.attributionID]
+		if !checked {
+			_, err := db.GetCostCenter(ctx, s.conn, adjustment.attributionID)
+			if err != nil && !errors.Is(err, db.CostCenterNotFound) {
+				requestid.Log(ctx).WithError(err).WithField("attribution_id", adjustment.attributionID).Error("Failed to get cost center.")
+				return nil, nil, status.Errorf(codes.Internal, "Failed to get cost center %s", adjustment.attributionID)
+			}
+			found = err == nil
+			exists[adjustment.attributionID] = found
+		}
+		if !found {
+			invalid = append(invalid, &v1.ImportUsageAdjustmentsResponse_InvalidLine{
+				Line:    int32(adjustment.line),
+				Message: fmt.Sprintf("cost center of %s not found", adjustment.attributionID),
+			})
+			continue
+		}
+		valid = append(valid, adjustment)
+	}
+	return valid, invalid, nil
+}
+
+// summarizeUsageAdjustments sums the adjustments in total, and by attribution ID in the order of attribution IDs.
+func summarizeUsageAdjustments(importID string, adjustments []usageAdjustment) *v1.ImportUsageAdjustmentsResponse {
+	var total db.CreditCents
+	byAttributionID := map[db.AttributionID]*v1.ImportUsageAdjustmentsResponse_AttributionSummary{}
+	centsByAttributionID := map[db.AttributionID]db.CreditCents{}
+	for _, adjustment := range adjustments {
+		cents := db.NewCreditCents(adjustment.credits)
+		total += cents
+
+		summary, ok := byAttributionID[adjustment.attributionID]
+		if !ok {
+			summary = &v1.ImportUsageAdjustmentsResponse_AttributionSummary{AttributionId: string(adjustment.attributionID)}
+			byAttributionID[adjustment.attributionID] = summary
+		}
+		summary.Adjustments++
+		centsByAttributionID[adjustment.attributionID] += cents
+		summary.Credits = centsByAttributionID[adjustment.attributionID].ToCredits()
+	}
+
+	resp := &v1.ImportUsageAdjustmentsResponse{
+		ImportId:    importID,
+		Adjustments: int32(len(adjustments)),
+		Credits:     total.ToCredits(),
+	}
+	for _, summary := range byAttributionID {
+		resp.Attributions = append(resp.Attributions, summary)
+	}
+	sort.Slice(resp.Attributions, func(i, j int) bool {
+		return resp.Attributions[i].GetAttributionId() < resp.Attributions[j].GetAttributionId()
+	})
+	return resp
+}
@@ -0,0 +1,150 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/db/dbtest"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestUsageService_ImportUsageAdjustments(t *testing.T) {
+	conn := dbtest.ConnectInMemoryForTests(t)
+	now := time.Date(2022, 10, 15, 12, 0, 0, 0, time.UTC)
+	teamA := db.NewTeamAttributionID(uuid.New().String())
+	teamB := db.NewTeamAttributionID(uuid.New().String())
+	dbtest.CreateCostCenters(t, conn,
+		db.CostCenter{ID: teamA, SpendingLimit: 100},
+		db.CostCenter{ID: teamB, SpendingLimit: 100},
+	)
+
+	service := NewUsageService(conn, nil, nil, DefaultWorkspacePricer, nil, SpendingLimitGraceMargin{}, nil, DefaultDunningPeriods, DefaultDeletedUsageRetention, nil, LogSamplingConfig{}, nil, nil, nil, nil, nil, nil)
+	service.nowFunc = func() time.Time { return now }
+
+	csv := fmt.Sprintf(`attribution_id,credits,description,effective_time
+%s,-20,"Outage on 2022-10-03, refunded",2022-10-04T00:00:00Z
+%s,5.5,Unbilled prebuilds,2022-10-05T00:00:00Z
+%s,12,Unbilled prebuilds,2022-10-05T00:00:00Z
+`, teamA, teamA, teamB)
+	importAdjustments := func(dryRun bool) *v1.ImportUsageAdjustmentsResponse {
+		resp, err := service.ImportUsageAdjustments(context.Background(), &v1.ImportUsageAdjustmentsRequest{
+			Csv:    []byte(csv),
+			DryRun: dryRun,
+			Actor:  "support-a",
+			Reason: "October corrections",
+		})
+		require.NoError(t, err)
+		return resp
+	}
+
+	dryRun := importAdjustments(true)
+	require.False(t, dryRun.GetApplied())
+	require.EqualValues(t, 3, dryRun.GetAdjustments())
+	require.Equal(t, -2.5, dryRun.GetCredits())
+	require.Len(t, dryRun.GetAttributions(), 2)
+	summaries := map[string]*v1.ImportUsageAdjustmentsResponse_AttributionSummary{}
+	for _, summary := range dryRun.GetAttributions() {
+		summaries[summary.GetAttributionId()] = summary
+	}
+	require.EqualValues(t, 2, summaries[string(teamA)].GetAdjustments())
+	require.Equal(t, -14.5, summaries[string(teamA)].GetCredits())
+	require.Equal(t, 12.0, summaries[string(teamB)].GetCredits())
+
+	balance, err := service.getBalance(context.Background(), teamB, now)
+	require.NoError(t, err)
+	require.Zero(t, balance.creditsUsed, "dry runs must not change balances")
+
+	applied := importAdjustments(false)
+	require.True(t, applied.GetApplied())
+	require.Equal(t, dryRun.GetImportId(), applied.GetImportId())
+
+	balance, err = service.getBalance(context.Background(), teamB, now)
+	require.NoError(t, err)
+	require.Equal(t, db.NewCreditCents(12), balance.creditsUsed, "adjustments must count towards the balance")
+
+	usage, err := db.GetUsage(context.Background(), conn, db.AdjustmentUsageID(applied.GetImportId(), 2))
+	require.NoError(t, err)
+	require.Equal(t, db.AdjustmentUsageKind, usage.Kind)
+	require.Equal(t, "Outage on 2022-10-03, refunded", usage.Description)
+	require.Equal(t, db.NewCreditCents(-20), usage.CreditCents)
+	data, err := usage.GetMetadataAsAdjustmentData()
+	require.NoError(t, err)
+	require.Equal(t, db.AdjustmentUsageData{Actor: "support-a", Reason: "October corrections", ImportID: applied.GetImportId(), Line: 2}, data)
+
+	importAdjustments(false)
+	balance, err = service.getBalance(context.Background(), teamB, now)
+	require.NoError(t, err)
+	require.Equal(t, db.NewCreditCents(12), balance.creditsUsed, "importing the same file again must not adjust balances twice")
+}
+
+func TestUsageService_ImportUsageAdjustments_InvalidLines(t *testing.T) {
+	conn := dbtest.ConnectInMemoryForTests(t)
+	now := time.Date(2022, 10, 15, 12, 0, 0, 0, time.UTC)
+	team := db.NewTeamAttributionID(uuid.New().String())
+	dbtest.CreateCostCenters(t, conn, db.CostCenter{ID: team, SpendingLimit: 100})
+
+	service := NewUsageService(conn, nil, nil, DefaultWorkspacePricer, nil, SpendingLimitGraceMargin{}, nil, DefaultDunningPeriods, DefaultDeletedUsageRetention, nil, LogSamplingConfig{}, nil, nil, nil, nil, nil, nil)
+	service.nowFunc = func() time.Time { return now }
+
+	csv := fmt.Sprintf(`effective_time,attribution_id,credits,description
+2022-10-04T00:00:00Z,%s,10,Valid
+2022-10-04T00:00:00Z,not-an-attribution-id,10,Invalid attribution ID
+2022-10-04T00:00:00Z,%s,0,Zero credits
+2022-10-04,%s,10,Invalid time
+2022-11-04T00:00:00Z,%s,10,Future
+2022-10-04T00:00:00Z,%s,10,
+2022-10-04T00:00:00Z,%s,10
+2022-10-04T00:00:00Z,%s,10,Missing cost center
+`, team, team, team, team, team, team, db.NewTeamAttributionID(uuid.New().String()))
+
+	resp, err := service.ImportUsageAdjustments(context.Background(), &v1.ImportUsageAdjustmentsRequest{
+		Csv:    []byte(csv),
+		DryRun: true,
+		Actor:  "support-a",
+		Reason: "Corrections",
+	})
+	require.NoError(t, err)
+	var lines []int32
+	for _, invalid := range resp.GetInvalidLines() {
+		lines = append(lines, invalid.GetLine())
+	}
+	require.Equal(t, []int32{3, 4, 5, 6, 7, 8, 9}, lines)
+	require.EqualValues(t, 1, resp.GetAdjustments(), "must summarize the valid lines of dry runs")
+
+	_, err = service.ImportUsageAdjustments(context.Background(), &v1.ImportUsageAdjustmentsRequest{
+		Csv:    []byte(csv),
+		Actor:  "support-a",
+		Reason: "Corrections",
+	})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	require.Equal(t, ErrorReason_InvalidUsageAdjustments, errorReason(status.Convert(err)))
+
+	balance, err := service.getBalance(context.Background(), team, now)
+	require.NoError(t, err)
+	require.Zero(t, balance.creditsUsed, "must not apply any adjustment when a line is invalid")
+}
+
+func TestUsageService_ImportUsageAdjustments_InvalidRequest(t *testing.T) {
+	service := NewUsageService(nil, nil, nil, DefaultWorkspacePricer, nil, SpendingLimitGraceMargin{}, nil, DefaultDunningPeriods, DefaultDeletedUsageRetention, nil, LogSamplingConfig{}, nil, nil, nil, nil, nil, nil)
+
+	for _, req := range []*v1.ImportUsageAdjustmentsRequest{
+		{Actor: "support-a", Reason: "Corrections"},
+		{Csv: []byte("attribution_id,credits,description,effective_time\n"), Reason: "Corrections"},
+		{Csv: []byte("attribution_id,credits,description,effective_time\n"), Actor: "support-a"},
+		{Csv: []byte("attribution_id,credits,effective_time\n"), Actor: "support-a", Reason: "Corrections"},
+	} {
+		_, err := service.ImportUsageAdjustments(context.Background(), req)
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"context"
+	"time"
+
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/requestid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// DefaultDeletedUsageRetention is how long soft-deleted usage is retained before it can be purged, unless configured
+// otherwise.
+const DefaultDeletedUsageRetention = 30 * 24 * time.Hour
+
+func (s *UsageService) DeleteUsageForAttribution(ctx context.Context, in *v1.DeleteUsageForAttributionRequest) (*v1.DeleteUsageForAttributionResponse, error) {
+	attributionId, err := db.ParseAttributionID(in.GetAttributionId())
+	if err != nil {
+		return nil, invalidAttributionIDError("Failed to parse attribution ID: %s", err.Error())
+	}
+
+	logger := requestid.Log(ctx).WithField("attribution_id", attributionId)
+	deleted, err := db.SoftDeleteUsage(ctx, s.conn, attributionId, s.nowFunc())
+	if err != nil {
+		logger.WithError(err).Error("Failed to soft-delete usage.")
+		return nil, status.Errorf(codes.Internal, "Failed to delete usage of %s", attributionId)
+	}
+	logger.
+		WithField("usage_entries", deleted.Usage).
+		WithField("workspace_instance_usage_entries", deleted.WorkspaceInstanceUsage).
+		Info("Soft-deleted usage.")
+
+	return &v1.DeleteUsageForAttributionResponse{
+		UsageEntries:                  deleted.Usage,
+		WorkspaceInstanceUsageEntries: deleted.WorkspaceInstanceUsage,
+	}, nil
+}
+
+func (s *UsageService) PurgeUsageForAttribution(ctx context.Context, in *v1.PurgeUsageForAttributionRequest) (*v1.PurgeUsageForAttributionResponse, error) {
+	attributionId, err := db.ParseAttributionID(in.GetAttributionId())
+	if err != nil {
+		return nil, invalidAttributionIDError("Failed to parse attribution ID: %s", err.Error())
+	}
+
+	softDeletedBefore := s.nowFunc().Add(-s.deletedUsageRetention)
+	logger := requestid.Log(ctx).
+		WithField("attribution_id", attributionId).
+		WithField("soft_deleted_before", softDeletedBefore).
+		WithField("dry_run", in.GetDryRun())
+
+	purged, err := db.PurgeUsage(ctx, s.conn, attributionId, softDeletedBefore, in.GetDryRun())
+	if err != nil {
+		logger.WithError(err).Error("Failed to purge usage.")
+		return nil, status.Errorf(codes.Internal, "Failed to purge usage of %s", attributionId)
+	}
+	logger.
+		WithField("usage_entries", purged.Usage).
+		WithField("workspace_instance_usage_entries", purged.WorkspaceInstanceUsage).
+		Info("Purged soft-deleted usage.")
+
+	return &v1.PurgeUsageForAttributionResponse{
+		UsageEntries:                  purged.Usage,
+		WorkspaceInstanceUsageEntries: purged.WorkspaceInstanceUsage,
+		SoftDeletedBefore:             timestamppb.New(softDeletedBefore),
+	}, nil
+}
@@ -0,0 +1,30 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"context"
+	"testing"
+
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestDeleteUsageForAttribution_Validation(t *testing.T) {
+	_, err := (&UsageService{}).DeleteUsageForAttribution(context.Background(), &v1.DeleteUsageForAttributionRequest{
+		AttributionId: "invalid",
+	})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestPurgeUsageForAttribution_Validation(t *testing.T) {
+	_, err := (&UsageService{}).PurgeUsageForAttribution(context.Background(), &v1.PurgeUsageForAttributionRequest{
+		AttributionId: "invalid",
+		DryRun:        true,
+	})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"context"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/notifier"
+	"github.com/gitpod-io/gitpod/usage/pkg/requestid"
+)
+
+// UsageEventPublisher publishes events for usage entries which were written to the ledger, such that other systems can
+// react to usage without polling the billing database.
+type UsageEventPublisher interface {
+	PublishUsageEvents(ctx context.Context, events ...notifier.UsageEvent) error
+}
+
+// publishUsageEvents publishes the event for every usage entry. The ledger is the source of truth: usage is written
+// before it is published, and failing to publish is logged rather than failing the write.
+func publishUsageEvents(ctx context.Context, publisher UsageEventPublisher, event string, usage []db.Usage) {
+	if publisher == nil || len(usage) == 0 {
+		return
+	}
+
+	events := make([]notifier.UsageEvent, 0, len(usage))
+	for _, u := range usage {
+		events = append(events, notifier.NewUsageEvent(event, u))
+	}
+	err := publisher.PublishUsageEvents(ctx, events...)
+	if err != nil {
+		requestid.Log(ctx).WithError(err).WithField("event", event).Errorf("Failed to publish %d usage events.", len(events))
+	}
+}
+
+// billedInstanceUsage returns the workspace instance usage which was finalized.
+func billedInstanceUsage(written []db.Usage) []db.Usage {
+	var billed []db.Usage
+	for _, usage := range written {
+		if usage.Draft || usage.Kind != db.WorkspaceInstanceUsageKind {
+			continue
+		}
+		billed = append(billed, usage)
+	}
+	return billed
+}
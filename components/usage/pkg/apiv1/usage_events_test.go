@@ -0,0 +1,48 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/db/dbtest"
+	"github.com/gitpod-io/gitpod/usage/pkg/notifier"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeUsageEventPublisher struct {
+	events []notifier.UsageEvent
+	err    error
+}
+
+func (p *fakeUsageEventPublisher) PublishUsageEvents(ctx context.Context, events ...notifier.UsageEvent) error {
+	p.events = append(p.events, events...)
+	return p.err
+}
+
+func TestPublishUsageEvents(t *testing.T) {
+	attributionID := db.NewTeamAttributionID("team-a")
+	billed := dbtest.NewUsage(t, db.Usage{AttributionID: attributionID, Kind: db.WorkspaceInstanceUsageKind})
+	draft := dbtest.NewUsage(t, db.Usage{AttributionID: attributionID, Kind: db.WorkspaceInstanceUsageKind, Draft: true})
+	invoice := dbtest.NewUsage(t, db.Usage{AttributionID: attributionID, Kind: db.InvoiceUsageKind})
+
+	require.Equal(t, []db.Usage{billed}, billedInstanceUsage([]db.Usage{billed, draft, invoice}))
+
+	publisher := &fakeUsageEventPublisher{}
+	publishUsageEvents(context.Background(), publisher, notifier.UsageInstanceBilledEvent, billedInstanceUsage([]db.Usage{billed, draft, invoice}))
+	require.Len(t, publisher.events, 1)
+	require.Equal(t, notifier.UsageInstanceBilledEvent, publisher.events[0].Event)
+	require.Equal(t, billed.ID.String(), publisher.events[0].UsageID)
+
+	publishUsageEvents(context.Background(), publisher, notifier.UsageInstanceBilledEvent, nil)
+	require.Len(t, publisher.events, 1, "no usage must not publish")
+
+	// Publishing failures must not fail the ledger write, and publishing is optional.
+	publishUsageEvents(context.Background(), &fakeUsageEventPublisher{err: errors.New("connection refused")}, notifier.UsageDraftFinalizedEvent, []db.Usage{draft})
+	publishUsageEvents(context.Background(), nil, notifier.UsageDraftFinalizedEvent, []db.Usage{draft})
+}
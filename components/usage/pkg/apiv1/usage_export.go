@@ -0,0 +1,105 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"context"
+	"time"
+
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/export"
+	"github.com/gitpod-io/gitpod/usage/pkg/requestid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// UsageExporter writes the usage of a day into an analytics store, replacing the usage previously exported for the day.
+type UsageExporter interface {
+	// Name identifies the store in the bookkeeping of exported days.
+	Name() string
+	ExportUsage(ctx context.Context, day time.Time, usage export.UsageIterator) (int64, error)
+}
+
+func (s *UsageService) ExportUsage(ctx context.Context, in *v1.ExportUsageRequest) (*v1.ExportUsageResponse, error) {
+	if len(s.exporters) == 0 {
+		return nil, errorWithReason(codes.FailedPrecondition, ErrorReason_UsageExportDisabled, nil, "Usage export is disabled")
+	}
+	if in.GetFrom() == nil || in.GetTo() == nil {
+		return nil, invalidTimeRangeError("From and To must be specified")
+	}
+	from := in.GetFrom().AsTime().UTC()
+	from = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	to := in.GetTo().AsTime().UTC()
+	if !from.Before(to) {
+		return nil, invalidTimeRangeError("Specified From timestamp is not before To. Please ensure From is always before To")
+	}
+	if to.Sub(from) > maxQuerySize {
+		return nil, errorWithReason(codes.InvalidArgument, ErrorReason_UsageWindowTooLarge, map[string]string{"max_window": maxQuerySize.String()}, "Maximum range exceeded. Range specified can be at most %s", maxQuerySize.String())
+	}
+
+	exported := map[string]map[string]db.UsageExport{}
+	if in.GetSkipExported() {
+		for _, exporter := range s.exporters {
+			exports, err := db.FindUsageExports(ctx, s.conn, exporter.Name(), from, to)
+			if err != nil {
+				requestid.Log(ctx).WithError(err).WithField("exporter", exporter.Name()).Error("Failed to find usage exports.")
+				return nil, status.Errorf(codes.Internal, "Failed to find usage exports")
+			}
+			exported[exporter.Name()] = exports
+		}
+	}
+
+	resp := &v1.ExportUsageResponse{}
+	for day := from; day.Before(to); day = day.AddDate(0, 0, 1) {
+		params := &db.FindUsageParams{
+			From:  day,
+			To:    day.AddDate(0, 0, 1),
+			Order: db.AscendingOrder,
+		}
+		usage := func(fn func(db.Usage) error) error {
+			return db.ForEachUsage(ctx, s.conn, params, fn)
+		}
+
+		logger := requestid.Log(ctx).WithField("day", db.UsageDay(day))
+		var (
+			rowsOfDay   int64
+			exportedDay bool
+		)
+		for _, exporter := range s.exporters {
+			if _, ok := exported[exporter.Name()][db.UsageDay(day)]; ok {
+				continue
+			}
+			rows, err := exporter.ExportUsage(ctx, day, usage)
+			if err != nil {
+				logger.WithError(err).WithField("exporter", exporter.Name()).Error("Failed to export usage.")
+				return nil, status.Errorf(codes.Internal, "Failed to export usage of %s", db.UsageDay(day))
+			}
+			err = db.RecordUsageExport(ctx, s.conn, db.UsageExport{
+				Exporter:   exporter.Name(),
+				Day:        db.UsageDay(day),
+				Rows:       rows,
+				ExportedAt: db.NewVarcharTime(s.nowFunc()),
+			})
+			if err != nil {
+				// The day is exported again by the next catch up, which replaces the exported usage.
+				logger.WithError(err).WithField("exporter", exporter.Name()).Error("Failed to record usage export.")
+				return nil, status.Errorf(codes.Internal, "Failed to record usage export of %s", db.UsageDay(day))
+			}
+			logger.WithField("exporter", exporter.Name()).WithField("exported", rows).Info("Exported usage.")
+
+			if rows > rowsOfDay {
+				rowsOfDay = rows
+			}
+			exportedDay = true
+		}
+
+		if exportedDay {
+			resp.Exported += rowsOfDay
+			resp.Days++
+		}
+	}
+	return resp, nil
+}
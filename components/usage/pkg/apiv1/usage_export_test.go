@@ -0,0 +1,99 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/db/dbtest"
+	"github.com/gitpod-io/gitpod/usage/pkg/export"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type fakeUsageExporter struct {
+	usageByDay map[string][]uuid.UUID
+	err        error
+}
+
+func (e *fakeUsageExporter) Name() string {
+	return "fake"
+}
+
+func (e *fakeUsageExporter) ExportUsage(_ context.Context, day time.Time, usage export.UsageIterator) (int64, error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+	var rows int64
+	err := usage(func(u db.Usage) error {
+		e.usageByDay[day.Format("2006-01-02")] = append(e.usageByDay[day.Format("2006-01-02")], u.ID)
+		rows++
+		return nil
+	})
+	return rows, err
+}
+
+func TestUsageService_ExportUsage(t *testing.T) {
+	conn := dbtest.ConnectInMemoryForTests(t)
+	ctx := context.Background()
+	day := time.Date(2022, 10, 10, 0, 0, 0, 0, time.UTC)
+
+	usage := dbtest.CreateUsageRecords(t, conn,
+		dbtest.NewUsage(t, db.Usage{AttributionID: db.NewTeamAttributionID(uuid.New().String()), EffectiveTime: db.NewVarcharTime(day.Add(time.Hour))}),
+		dbtest.NewUsage(t, db.Usage{AttributionID: db.NewUserAttributionID(uuid.New().String()), EffectiveTime: db.NewVarcharTime(day.Add(23 * time.Hour))}),
+		dbtest.NewUsage(t, db.Usage{AttributionID: db.NewTeamAttributionID(uuid.New().String()), EffectiveTime: db.NewVarcharTime(day.AddDate(0, 0, 1))}),
+		dbtest.NewUsage(t, db.Usage{AttributionID: db.NewTeamAttributionID(uuid.New().String()), EffectiveTime: db.NewVarcharTime(day.AddDate(0, 0, 2))}),
+	)
+	request := &v1.ExportUsageRequest{
+		From: timestamppb.New(day.Add(12 * time.Hour)),
+		To:   timestamppb.New(day.AddDate(0, 0, 2)),
+	}
+
+	disabled := NewUsageService(conn, nil, nil, DefaultWorkspacePricer, nil, SpendingLimitGraceMargin{}, nil, DefaultDunningPeriods, DefaultDeletedUsageRetention, nil, LogSamplingConfig{}, nil, nil, nil, nil, nil, nil)
+	_, err := disabled.ExportUsage(ctx, request)
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	exporter := &fakeUsageExporter{usageByDay: map[string][]uuid.UUID{}}
+	service := NewUsageService(conn, nil, nil, DefaultWorkspacePricer, nil, SpendingLimitGraceMargin{}, nil, DefaultDunningPeriods, DefaultDeletedUsageRetention, nil, LogSamplingConfig{}, nil, nil, nil, []UsageExporter{exporter}, nil, nil)
+
+	resp, err := service.ExportUsage(ctx, request)
+	require.NoError(t, err)
+	require.Equal(t, int32(2), resp.GetDays(), "must export whole days")
+	require.Equal(t, int64(3), resp.GetExported())
+	require.Equal(t, map[string][]uuid.UUID{
+		"2022-10-10": {usage[0].ID, usage[1].ID},
+		"2022-10-11": {usage[2].ID},
+	}, exporter.usageByDay, "must export the usage of all attribution IDs by day")
+
+	_, err = service.ExportUsage(ctx, &v1.ExportUsageRequest{From: timestamppb.New(day), To: timestamppb.New(day.AddDate(0, 2, 0))})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = service.ExportUsage(ctx, &v1.ExportUsageRequest{From: timestamppb.New(day), To: timestamppb.New(day)})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	exporter.usageByDay = map[string][]uuid.UUID{}
+	resp, err = service.ExportUsage(ctx, &v1.ExportUsageRequest{
+		From:         timestamppb.New(day),
+		To:           timestamppb.New(day.AddDate(0, 0, 3)),
+		SkipExported: true,
+	})
+	require.NoError(t, err)
+	require.Equal(t, int32(1), resp.GetDays())
+	require.Equal(t, map[string][]uuid.UUID{
+		"2022-10-12": {usage[3].ID},
+	}, exporter.usageByDay, "must only export days which were not exported yet")
+
+	exporter.err = errors.New("load job failed")
+	_, err = service.ExportUsage(ctx, request)
+	require.Equal(t, codes.Internal, status.Code(err))
+}
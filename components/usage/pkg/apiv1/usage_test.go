@@ -143,8 +143,8 @@ func TestUsageService_ListBilledUsage(t *testing.T) {
 				baseserver.WithGRPC(baseserver.MustUseRandomLocalAddress(t)),
 			)
 
-			generator := NewReportGenerator(dbconn, DefaultWorkspacePricer)
-			v1.RegisterUsageServiceServer(srv.GRPC(), NewUsageService(dbconn, generator, nil, DefaultWorkspacePricer))
+			generator := NewReportGenerator(dbconn, DefaultWorkspacePricer, nil, LogSamplingConfig{})
+			v1.RegisterUsageServiceServer(srv.GRPC(), NewUsageService(dbconn, generator, nil, DefaultWorkspacePricer, nil, SpendingLimitGraceMargin{}, nil, DefaultDunningPeriods, DefaultDeletedUsageRetention, nil, LogSamplingConfig{}, nil, nil, nil, nil, nil, nil))
 			baseserver.StartServerForTests(t, srv)
 
 			conn, err := grpc.Dial(srv.GRPCAddress(), grpc.WithTransportCredentials(insecure.NewCredentials()))
@@ -274,8 +274,8 @@ func TestUsageService_ListBilledUsage_Pagination(t *testing.T) {
 				baseserver.WithGRPC(baseserver.MustUseRandomLocalAddress(t)),
 			)
 
-			generator := NewReportGenerator(dbconn, DefaultWorkspacePricer)
-			v1.RegisterUsageServiceServer(srv.GRPC(), NewUsageService(dbconn, generator, nil, DefaultWorkspacePricer))
+			generator := NewReportGenerator(dbconn, DefaultWorkspacePricer, nil, LogSamplingConfig{})
+			v1.RegisterUsageServiceServer(srv.GRPC(), NewUsageService(dbconn, generator, nil, DefaultWorkspacePricer, nil, SpendingLimitGraceMargin{}, nil, DefaultDunningPeriods, DefaultDeletedUsageRetention, nil, LogSamplingConfig{}, nil, nil, nil, nil, nil, nil))
 			baseserver.StartServerForTests(t, srv)
 
 			conn, err := grpc.Dial(srv.GRPCAddress(), grpc.WithTransportCredentials(insecure.NewCredentials()))
@@ -369,12 +369,21 @@ func TestInstanceToUsageRecords(t *testing.T) {
 
 	for _, s := range scenarios {
 		t.Run(s.Name, func(t *testing.T) {
-			actual := instancesToUsageRecords(s.Records, DefaultWorkspacePricer, maxStopTime)
+			actual, err := instancesToUsageRecords(context.Background(), s.Records, DefaultWorkspacePricer, maxStopTime)
+			require.NoError(t, err)
 			require.Equal(t, s.Expected, actual)
 		})
 	}
 }
 
+func creditsUsedByInstance(t *testing.T, pricer *WorkspacePricer, instance *db.WorkspaceInstanceForUsage, now time.Time) float64 {
+	t.Helper()
+
+	credits, err := pricer.CreditsUsedByInstance(context.Background(), instance, now)
+	require.NoError(t, err)
+	return credits
+}
+
 func TestReportGenerator_GenerateUsageReport(t *testing.T) {
 	startOfMay := time.Date(2022, 05, 1, 0, 00, 00, 00, time.UTC)
 	startOfJune := time.Date(2022, 06, 1, 0, 00, 00, 00, time.UTC)
@@ -587,7 +596,7 @@ func TestUsageService_ReconcileUsageWithLedger(t *testing.T) {
 		baseserver.WithGRPC(baseserver.MustUseRandomLocalAddress(t)),
 	)
 
-	v1.RegisterUsageServiceServer(srv.GRPC(), NewUsageService(dbconn, nil, nil, DefaultWorkspacePricer))
+	v1.RegisterUsageServiceServer(srv.GRPC(), NewUsageService(dbconn, nil, nil, DefaultWorkspacePricer, nil, SpendingLimitGraceMargin{}, nil, DefaultDunningPeriods, DefaultDeletedUsageRetention, nil, LogSamplingConfig{}, nil, nil, nil, nil, nil, nil))
 	baseserver.StartServerForTests(t, srv)
 
 	conn, err := grpc.Dial(srv.GRPCAddress(), grpc.WithTransportCredentials(insecure.NewCredentials()))
@@ -624,7 +633,7 @@ func TestReconcileWithLedger(t *testing.T) {
 	require.NoError(t, err)
 
 	t.Run("no action with no instances and no drafts", func(t *testing.T) {
-		inserts, updates, err := reconcileUsageWithLedger(nil, nil, pricer, now)
+		inserts, updates, err := reconcileUsageWithLedger(context.Background(), nil, nil, pricer, nil, nil, now)
 		require.NoError(t, err)
 		require.Len(t, inserts, 0)
 		require.Len(t, updates, 0)
@@ -632,7 +641,7 @@ func TestReconcileWithLedger(t *testing.T) {
 
 	t.Run("no action with no instances but existing drafts", func(t *testing.T) {
 		drafts := []db.Usage{dbtest.NewUsage(t, db.Usage{})}
-		inserts, updates, err := reconcileUsageWithLedger(nil, drafts, pricer, now)
+		inserts, updates, err := reconcileUsageWithLedger(context.Background(), nil, drafts, pricer, nil, nil, now)
 		require.NoError(t, err)
 		require.Len(t, inserts, 0)
 		require.Len(t, updates, 0)
@@ -653,18 +662,19 @@ func TestReconcileWithLedger(t *testing.T) {
 			StartedTime:        db.NewVarcharTime(now.Add(1 * time.Minute)),
 		}
 
-		inserts, updates, err := reconcileUsageWithLedger([]db.WorkspaceInstanceForUsage{instance, instance}, nil, pricer, now)
+		inserts, updates, err := reconcileUsageWithLedger(context.Background(), []db.WorkspaceInstanceForUsage{instance, instance}, nil, pricer, nil, nil, now)
 		require.NoError(t, err)
 		require.Len(t, inserts, 1)
 		require.Len(t, updates, 0)
 		expectedUsage := db.Usage{
-			ID:                  inserts[0].ID,
+			ID:                  db.WorkspaceInstanceUsageID(instance.ID, instance.UsageAttributionID),
 			AttributionID:       instance.UsageAttributionID,
 			Description:         usageDescriptionFromController,
-			CreditCents:         db.NewCreditCents(pricer.CreditsUsedByInstance(&instance, now)),
+			CreditCents:         db.NewCreditCents(creditsUsedByInstance(t, pricer, &instance, now)),
 			EffectiveTime:       db.NewVarcharTime(now),
 			Kind:                db.WorkspaceInstanceUsageKind,
 			WorkspaceInstanceID: instance.ID,
+			ProjectID:           "my-project",
 			Draft:               true,
 			Metadata:            nil,
 		}
@@ -681,6 +691,25 @@ func TestReconcileWithLedger(t *testing.T) {
 		require.EqualValues(t, expectedUsage, inserts[0])
 	})
 
+	t.Run("derives the same usage ID in concurrent reconciliations", func(t *testing.T) {
+		instance := db.WorkspaceInstanceForUsage{
+			ID:                 uuid.New(),
+			WorkspaceID:        dbtest.GenerateWorkspaceID(),
+			WorkspaceClass:     db.WorkspaceClass_Default,
+			Type:               db.WorkspaceType_Regular,
+			UsageAttributionID: db.NewTeamAttributionID(uuid.New().String()),
+			StartedTime:        db.NewVarcharTime(now.Add(-time.Hour)),
+		}
+
+		first, _, err := reconcileUsageWithLedger(context.Background(), []db.WorkspaceInstanceForUsage{instance}, nil, pricer, nil, nil, now)
+		require.NoError(t, err)
+		second, _, err := reconcileUsageWithLedger(context.Background(), []db.WorkspaceInstanceForUsage{instance}, nil, pricer, nil, nil, now.Add(time.Minute))
+		require.NoError(t, err)
+		require.Len(t, first, 1)
+		require.Len(t, second, 1)
+		require.Equal(t, first[0].ID, second[0].ID, "writers which missed each other's usage must not record it twice")
+	})
+
 	t.Run("updates a usage record when a draft exists", func(t *testing.T) {
 		instance := db.WorkspaceInstanceForUsage{
 			ID:          uuid.New(),
@@ -708,9 +737,10 @@ func TestReconcileWithLedger(t *testing.T) {
 			WorkspaceInstanceID: instance.ID,
 			Draft:               true,
 			Metadata:            nil,
+			Version:             3,
 		})
 
-		inserts, updates, err := reconcileUsageWithLedger([]db.WorkspaceInstanceForUsage{instance}, []db.Usage{draft}, pricer, now)
+		inserts, updates, err := reconcileUsageWithLedger(context.Background(), []db.WorkspaceInstanceForUsage{instance}, []db.Usage{draft}, pricer, nil, nil, now)
 		require.NoError(t, err)
 		require.Len(t, inserts, 0)
 		require.Len(t, updates, 1)
@@ -719,12 +749,15 @@ func TestReconcileWithLedger(t *testing.T) {
 			ID:                  draft.ID,
 			AttributionID:       instance.UsageAttributionID,
 			Description:         usageDescriptionFromController,
-			CreditCents:         db.NewCreditCents(pricer.CreditsUsedByInstance(&instance, now)),
+			CreditCents:         db.NewCreditCents(creditsUsedByInstance(t, pricer, &instance, now)),
 			EffectiveTime:       db.NewVarcharTime(now),
 			Kind:                db.WorkspaceInstanceUsageKind,
 			WorkspaceInstanceID: instance.ID,
+			ProjectID:           "my-project",
 			Draft:               true,
 			Metadata:            nil,
+			// The update only applies to the version of the draft which was read.
+			Version: 3,
 		}
 		require.NoError(t, expectedUsage.SetMetadataWithWorkspaceInstance(db.WorkspaceInstanceUsageData{
 			WorkspaceId:    instance.WorkspaceID,
@@ -738,4 +771,110 @@ func TestReconcileWithLedger(t *testing.T) {
 		}))
 		require.EqualValues(t, expectedUsage, updates[0])
 	})
+	t.Run("documents the pricing split when the plan changed while the instance was running", func(t *testing.T) {
+		attributionID := db.NewTeamAttributionID(uuid.New().String())
+		instance := db.WorkspaceInstanceForUsage{
+			ID:                 uuid.New(),
+			WorkspaceID:        dbtest.GenerateWorkspaceID(),
+			WorkspaceClass:     db.WorkspaceClass_Default,
+			Type:               db.WorkspaceType_Regular,
+			UsageAttributionID: attributionID,
+			StartedTime:        db.NewVarcharTime(now.Add(-2 * time.Hour)),
+			StoppingTime:       db.NewVarcharTime(now.Add(-1 * time.Hour)),
+		}
+		planChanges := map[db.AttributionID][]db.PlanChange{
+			attributionID: {{Plan: "professional", EffectiveTime: db.NewVarcharTime(now.Add(-90 * time.Minute))}},
+		}
+
+		inserts, _, err := reconcileUsageWithLedger(context.Background(), []db.WorkspaceInstanceForUsage{instance}, nil, pricer, planChanges, nil, now)
+		require.NoError(t, err)
+		require.Len(t, inserts, 1)
+
+		data, err := inserts[0].GetMetadataAsWorkspaceInstanceData()
+		require.NoError(t, err)
+		require.Len(t, data.PricingSegments, 2)
+		require.Equal(t, defaultPlan, data.PricingSegments[0].Plan)
+		require.Equal(t, "professional", data.PricingSegments[1].Plan)
+		require.Equal(t, db.TimeToISO8601(now.Add(-90*time.Minute)), data.PricingSegments[1].StartTime)
+	})
+	t.Run("charges split targets their share of the usage", func(t *testing.T) {
+		attributionID := db.NewTeamAttributionID(uuid.New().String())
+		platform := db.NewTeamAttributionID(uuid.New().String())
+		instance := db.WorkspaceInstanceForUsage{
+			ID:                 uuid.New(),
+			WorkspaceID:        dbtest.GenerateWorkspaceID(),
+			WorkspaceClass:     db.WorkspaceClass_Default,
+			Type:               db.WorkspaceType_Regular,
+			UsageAttributionID: attributionID,
+			StartedTime:        db.NewVarcharTime(now.Add(-2 * time.Hour)),
+			StoppingTime:       db.NewVarcharTime(now.Add(-1 * time.Hour)),
+		}
+		splits := map[db.AttributionID][]db.CostCenterSplit{
+			attributionID: {{AttributionID: attributionID, TargetAttributionID: platform, Percentage: 50}},
+		}
+
+		inserts, updates, err := reconcileUsageWithLedger(context.Background(), []db.WorkspaceInstanceForUsage{instance}, nil, pricer, nil, splits, now)
+		require.NoError(t, err)
+		require.Len(t, updates, 0)
+		require.Len(t, inserts, 2)
+
+		total := db.NewCreditCents(creditsUsedByInstance(t, pricer, &instance, now))
+		require.Equal(t, attributionID, inserts[0].AttributionID)
+		require.Equal(t, platform, inserts[1].AttributionID)
+		require.Equal(t, total, inserts[0].CreditCents+inserts[1].CreditCents)
+		require.Equal(t, total/2, inserts[1].CreditCents)
+		require.Equal(t, instance.ID, inserts[1].WorkspaceInstanceID)
+		require.False(t, isSplitUsage(inserts[0]))
+		require.True(t, isSplitUsage(inserts[1]))
+	})
+	t.Run("updates drafts of split targets, and clears drafts of removed targets", func(t *testing.T) {
+		attributionID := db.NewTeamAttributionID(uuid.New().String())
+		platform := db.NewTeamAttributionID(uuid.New().String())
+		removed := db.NewTeamAttributionID(uuid.New().String())
+		instance := db.WorkspaceInstanceForUsage{
+			ID:                 uuid.New(),
+			WorkspaceID:        dbtest.GenerateWorkspaceID(),
+			WorkspaceClass:     db.WorkspaceClass_Default,
+			Type:               db.WorkspaceType_Regular,
+			UsageAttributionID: attributionID,
+			StartedTime:        db.NewVarcharTime(now.Add(-1 * time.Hour)),
+		}
+		draft := dbtest.NewUsage(t, db.Usage{AttributionID: attributionID, WorkspaceInstanceID: instance.ID, Draft: true})
+		splitDraft := func(target db.AttributionID) db.Usage {
+			usage := dbtest.NewUsage(t, db.Usage{AttributionID: target, WorkspaceInstanceID: instance.ID, Draft: true})
+			require.NoError(t, usage.SetMetadataWithWorkspaceInstance(db.WorkspaceInstanceUsageData{SplitFromAttributionId: attributionID}))
+			return usage
+		}
+		platformDraft, removedDraft := splitDraft(platform), splitDraft(removed)
+		splits := map[db.AttributionID][]db.CostCenterSplit{
+			attributionID: {{AttributionID: attributionID, TargetAttributionID: platform, Percentage: 25}},
+		}
+
+		inserts, updates, err := reconcileUsageWithLedger(context.Background(), []db.WorkspaceInstanceForUsage{instance}, []db.Usage{platformDraft, draft, removedDraft}, pricer, nil, splits, now)
+		require.NoError(t, err)
+		require.Len(t, inserts, 0)
+		require.Len(t, updates, 3)
+
+		total := db.NewCreditCents(creditsUsedByInstance(t, pricer, &instance, now))
+		require.Equal(t, draft.ID, updates[0].ID)
+		require.Equal(t, total-total/4, updates[0].CreditCents)
+		require.Equal(t, platformDraft.ID, updates[1].ID)
+		require.Equal(t, total/4, updates[1].CreditCents)
+		require.Equal(t, removedDraft.ID, updates[2].ID)
+		require.Zero(t, updates[2].CreditCents)
+	})
+}
+
+func TestWithoutExistingUsage(t *testing.T) {
+	instanceID := uuid.New()
+	team := db.NewTeamAttributionID(uuid.New().String())
+	splitTarget := db.NewTeamAttributionID(uuid.New().String())
+
+	recorded := dbtest.NewUsage(t, db.Usage{WorkspaceInstanceID: instanceID, AttributionID: team})
+	source := dbtest.NewUsage(t, db.Usage{WorkspaceInstanceID: instanceID, AttributionID: team})
+	target := dbtest.NewUsage(t, db.Usage{WorkspaceInstanceID: instanceID, AttributionID: splitTarget})
+	other := dbtest.NewUsage(t, db.Usage{AttributionID: team})
+
+	require.Equal(t, []db.Usage{target, other}, withoutExistingUsage([]db.Usage{source, target, other}, []db.Usage{recorded}))
+	require.Equal(t, []db.Usage{source}, withoutExistingUsage([]db.Usage{source}, nil))
 }
@@ -0,0 +1,109 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"context"
+	"errors"
+
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/requestid"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *UsageService) TransferUsage(ctx context.Context, in *v1.TransferUsageRequest) (*v1.TransferUsageResponse, error) {
+	to, err := db.ParseAttributionID(in.GetToAttributionId())
+	if err != nil {
+		return nil, invalidAttributionIDError("Failed to parse attribution ID: %s", err.Error())
+	}
+	if len(in.GetUsageIds()) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "Usage IDs must be specified")
+	}
+	if in.GetReason() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "Reason must be specified")
+	}
+
+	var usageIDs []uuid.UUID
+	seen := map[uuid.UUID]bool{}
+	for _, id := range in.GetUsageIds() {
+		usageID, err := uuid.Parse(id)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "Invalid usage ID %q", id)
+		}
+		if !seen[usageID] {
+			seen[usageID] = true
+			usageIDs = append(usageIDs, usageID)
+		}
+	}
+
+	logger := requestid.Log(ctx).WithField("to_attribution_id", to)
+
+	var entries []db.Usage
+	var transferred db.CreditCents
+	for _, usageID := range usageIDs {
+		usage, err := s.transferableUsage(ctx, usageID, to)
+		if err != nil {
+			return nil, err
+		}
+		reversal, transfer := db.NewTransferringUsage(usage, to, in.GetReason())
+		entries = append(entries, reversal, transfer)
+		transferred += usage.CreditCents
+	}
+
+	// Usage which was voided or transferred concurrently fails the whole transfer, instead of being skipped silently.
+	err = db.CreateUsage(ctx, s.conn, entries...)
+	if errors.Is(err, db.UsageAlreadyExists) {
+		return nil, status.Errorf(codes.FailedPrecondition, "Usage was already voided or transferred")
+	}
+	if err != nil {
+		logger.WithError(err).Error("Failed to insert usage transfers.")
+		return nil, status.Errorf(codes.Internal, "Failed to transfer usage to %s", to)
+	}
+	logger.
+		WithField("usage_entries", len(usageIDs)).
+		WithField("credits", transferred.ToCredits()).
+		Info("Transferred usage.")
+
+	return &v1.TransferUsageResponse{
+		TransferredCredits: transferred.ToCredits(),
+	}, nil
+}
+
+// transferableUsage returns the usage, if it is finalized workspace usage which was neither voided nor transferred
+// yet, and is not attributed to `to` already.
+func (s *UsageService) transferableUsage(ctx context.Context, usageID uuid.UUID, to db.AttributionID) (db.Usage, error) {
+	usage, err := db.GetUsage(ctx, s.conn, usageID)
+	if err != nil {
+		if errors.Is(err, db.UsageNotFound) {
+			return db.Usage{}, status.Errorf(codes.NotFound, "Usage %s not found", usageID)
+		}
+		requestid.Log(ctx).WithError(err).WithField("usage_id", usageID).Error("Failed to get usage.")
+		return db.Usage{}, status.Errorf(codes.Internal, "Failed to get usage %s", usageID)
+	}
+	if usage.Draft {
+		return db.Usage{}, status.Errorf(codes.FailedPrecondition, "Usage %s is still a draft", usageID)
+	}
+	if usage.Kind != db.WorkspaceInstanceUsageKind || usage.CreditCents <= 0 {
+		return db.Usage{}, status.Errorf(codes.FailedPrecondition, "Usage %s is not billable workspace usage", usageID)
+	}
+	if usage.AttributionID == to {
+		return db.Usage{}, status.Errorf(codes.FailedPrecondition, "Usage %s is already attributed to %s", usageID, to)
+	}
+
+	for _, reversalID := range []uuid.UUID{db.VoidingUsageID(usageID), db.TransferReversalID(usageID)} {
+		_, err := db.GetUsage(ctx, s.conn, reversalID)
+		if err == nil {
+			return db.Usage{}, status.Errorf(codes.FailedPrecondition, "Usage %s was already voided or transferred", usageID)
+		}
+		if !errors.Is(err, db.UsageNotFound) {
+			requestid.Log(ctx).WithError(err).WithField("usage_id", usageID).Error("Failed to get reversal of usage.")
+			return db.Usage{}, status.Errorf(codes.Internal, "Failed to get usage %s", usageID)
+		}
+	}
+	return usage, nil
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/db/dbtest"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestTransferUsage_Validation(t *testing.T) {
+	team := string(db.NewTeamAttributionID(uuid.New().String()))
+	usageID := uuid.New().String()
+
+	for _, req := range []*v1.TransferUsageRequest{
+		{UsageIds: []string{usageID}, ToAttributionId: "invalid", Reason: "wrong team"},
+		{ToAttributionId: team, Reason: "wrong team"},
+		{UsageIds: []string{usageID}, ToAttributionId: team},
+		{UsageIds: []string{"invalid"}, ToAttributionId: team, Reason: "wrong team"},
+	} {
+		_, err := (&UsageService{}).TransferUsage(context.Background(), req)
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+}
+
+func TestTransferUsage(t *testing.T) {
+	conn := dbtest.ConnectForTests(t)
+	now := time.Date(2022, 9, 15, 0, 0, 0, 0, time.UTC)
+	wrongTeam := db.NewTeamAttributionID(uuid.New().String())
+	rightTeam := db.NewTeamAttributionID(uuid.New().String())
+
+	usage := dbtest.CreateUsageRecords(t, conn,
+		dbtest.NewUsage(t, db.Usage{AttributionID: wrongTeam, CreditCents: 500, EffectiveTime: db.NewVarcharTime(now)}),
+		dbtest.NewUsage(t, db.Usage{AttributionID: wrongTeam, CreditCents: 300, EffectiveTime: db.NewVarcharTime(now)}),
+		dbtest.NewUsage(t, db.Usage{AttributionID: wrongTeam, CreditCents: 100, EffectiveTime: db.NewVarcharTime(now), Draft: true}),
+	)
+	t.Cleanup(func() {
+		require.NoError(t, conn.Where("attributionId IN ?", []db.AttributionID{wrongTeam, rightTeam}).Delete(&db.Usage{}).Error)
+		require.NoError(t, conn.Where("attributionId IN ?", []db.AttributionID{wrongTeam, rightTeam}).Delete(&db.CachedBalance{}).Error)
+	})
+
+	service := NewUsageService(conn, nil, nil, DefaultWorkspacePricer, nil, SpendingLimitGraceMargin{}, nil, DefaultDunningPeriods, DefaultDeletedUsageRetention, nil, LogSamplingConfig{}, nil, nil, nil, nil, nil, nil)
+	transfer := func(ids ...uuid.UUID) (*v1.TransferUsageResponse, error) {
+		req := &v1.TransferUsageRequest{ToAttributionId: string(rightTeam), Reason: "Started under the wrong team"}
+		for _, id := range ids {
+			req.UsageIds = append(req.UsageIds, id.String())
+		}
+		return service.TransferUsage(context.Background(), req)
+	}
+
+	_, err := transfer(usage[0].ID, usage[2].ID)
+	require.Equal(t, codes.FailedPrecondition, status.Code(err), "drafts must not be transferred")
+
+	resp, err := transfer(usage[0].ID, usage[1].ID)
+	require.NoError(t, err)
+	require.Equal(t, 8.0, resp.GetTransferredCredits())
+
+	from, to := now.Add(-time.Hour), now.Add(time.Hour)
+	wrongTeamUsage, err := db.GetWorkspaceUsageForAttribution(context.Background(), conn, wrongTeam, from, to)
+	require.NoError(t, err)
+	require.EqualValues(t, 100, wrongTeamUsage, "only the draft must remain")
+	rightTeamUsage, err := db.GetWorkspaceUsageForAttribution(context.Background(), conn, rightTeam, from, to)
+	require.NoError(t, err)
+	require.EqualValues(t, 800, rightTeamUsage)
+
+	original, err := db.GetUsage(context.Background(), conn, usage[0].ID)
+	require.NoError(t, err)
+	require.Equal(t, wrongTeam, original.AttributionID, "transferred usage must not be changed")
+
+	_, err = transfer(usage[0].ID)
+	require.Equal(t, codes.FailedPrecondition, status.Code(err), "usage must be transferred at most once")
+}
@@ -0,0 +1,340 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package apiv1
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/notifier"
+	"github.com/gitpod-io/gitpod/usage/pkg/requestid"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gorm.io/gorm"
+)
+
+// DefaultUsageWebhookMaxAttempts is how often a delivery to a usage webhook is attempted before it is given up. With
+// the backoff between attempts, failing deliveries are retried for about a day.
+const DefaultUsageWebhookMaxAttempts = 10
+
+const (
+	// maxUsageWebhooksPerAttribution bounds the deliveries of every event of an attribution ID.
+	maxUsageWebhooksPerAttribution = 5
+	// usageWebhookDeliveryBatch is the number of deliveries which DeliverUsageWebhooks attempts per call.
+	usageWebhookDeliveryBatch  = 100
+	usageWebhookInitialBackoff = time.Minute
+	usageWebhookMaxBackoff     = 6 * time.Hour
+	// maxUsageWebhookErrorLength is the size of the column of the last error of a delivery.
+	maxUsageWebhookErrorLength = 255
+)
+
+// UsageWebhookConfig configures the delivery of usage events to the webhooks which owners of attribution IDs register.
+type UsageWebhookConfig struct {
+	// MaxAttempts is how often a delivery is attempted before it is given up. When MaxAttempts is 0,
+	// DefaultUsageWebhookMaxAttempts applies.
+	MaxAttempts int `json:"maxAttempts,omitempty"`
+}
+
+func (c *UsageWebhookConfig) maxAttempts() int {
+	if c.MaxAttempts <= 0 {
+		return DefaultUsageWebhookMaxAttempts
+	}
+	return c.MaxAttempts
+}
+
+func (s *UsageService) CreateUsageWebhook(ctx context.Context, in *v1.CreateUsageWebhookRequest) (*v1.CreateUsageWebhookResponse, error) {
+	if s.webhooks == nil {
+		return nil, errorWithReason(codes.FailedPrecondition, ErrorReason_UsageWebhooksDisabled, nil, "Usage webhooks are disabled")
+	}
+	attributionId, err := db.ParseAttributionID(in.GetAttributionId())
+	if err != nil {
+		return nil, invalidAttributionIDError("Failed to parse attribution ID: %s", err.Error())
+	}
+	if err := validateUsageWebhookURL(in.GetUrl()); err != nil {
+		return nil, errorWithReason(codes.InvalidArgument, ErrorReason_InvalidWebhookURL, nil, "Invalid webhook URL: %s", err.Error())
+	}
+
+	logger := requestid.Log(ctx).WithField("attribution_id", attributionId)
+
+	existing, err := db.ListUsageWebhooks(ctx, s.conn, attributionId)
+	if err != nil {
+		logger.WithError(err).Error("Failed to list usage webhooks.")
+		return nil, status.Errorf(codes.Internal, "Failed to list usage webhooks")
+	}
+	if len(existing) >= maxUsageWebhooksPerAttribution {
+		return nil, errorWithReason(codes.FailedPrecondition, ErrorReason_LimitExceeded, map[string]string{"limit": strconv.Itoa(maxUsageWebhooksPerAttribution)},
+			"At most %d webhooks can be registered", maxUsageWebhooksPerAttribution)
+	}
+
+	secret, err := newUsageWebhookSecret()
+	if err != nil {
+		logger.WithError(err).Error("Failed to generate usage webhook secret.")
+		return nil, status.Errorf(codes.Internal, "Failed to generate webhook secret")
+	}
+	webhook := db.UsageWebhook{
+		ID:            uuid.New(),
+		AttributionID: attributionId,
+		URL:           in.GetUrl(),
+		Secret:        secret,
+		CreationTime:  db.NewVarcharTime(s.nowFunc()),
+	}
+	err = db.CreateUsageWebhook(ctx, s.conn, webhook)
+	if err != nil {
+		logger.WithError(err).Error("Failed to create usage webhook.")
+		return nil, status.Errorf(codes.Internal, "Failed to create usage webhook")
+	}
+
+	// The secret must not end up in the audit log.
+	created := toUsageWebhook(webhook)
+	auditChange(ctx, attributionId, nil, created)
+	return &v1.CreateUsageWebhookResponse{
+		Webhook: created,
+		Secret:  secret,
+	}, nil
+}
+
+func (s *UsageService) ListUsageWebhooks(ctx context.Context, in *v1.ListUsageWebhooksRequest) (*v1.ListUsageWebhooksResponse, error) {
+	attributionId, err := db.ParseAttributionID(in.GetAttributionId())
+	if err != nil {
+		return nil, invalidAttributionIDError("Failed to parse attribution ID: %s", err.Error())
+	}
+
+	webhooks, err := db.ListUsageWebhooks(ctx, s.conn, attributionId)
+	if err != nil {
+		requestid.Log(ctx).WithError(err).WithField("attribution_id", attributionId).Error("Failed to list usage webhooks.")
+		return nil, status.Errorf(codes.Internal, "Failed to list usage webhooks")
+	}
+
+	resp := &v1.ListUsageWebhooksResponse{}
+	for _, webhook := range webhooks {
+		resp.Webhooks = append(resp.Webhooks, toUsageWebhook(webhook))
+	}
+	return resp, nil
+}
+
+func (s *UsageService) DeleteUsageWebhook(ctx context.Context, in *v1.DeleteUsageWebhookRequest) (*v1.DeleteUsageWebhookResponse, error) {
+	attributionId, err := db.ParseAttributionID(in.GetAttributionId())
+	if err != nil {
+		return nil, invalidAttributionIDError("Failed to parse attribution ID: %s", err.Error())
+	}
+	webhookID, err := uuid.Parse(in.GetWebhookId())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Failed to parse webhook ID: %s", err.Error())
+	}
+
+	err = db.DeleteUsageWebhook(ctx, s.conn, attributionId, webhookID)
+	if err != nil {
+		if errors.Is(err, db.UsageWebhookNotFound) {
+			return nil, status.Errorf(codes.NotFound, "Webhook %s not found", webhookID)
+		}
+		requestid.Log(ctx).WithError(err).WithField("attribution_id", attributionId).Error("Failed to delete usage webhook.")
+		return nil, status.Errorf(codes.Internal, "Failed to delete usage webhook %s", webhookID)
+	}
+
+	auditChange(ctx, attributionId, nil, nil)
+	return &v1.DeleteUsageWebhookResponse{}, nil
+}
+
+func (s *UsageService) EnqueueUsageWebhookSummaries(ctx context.Context, in *v1.EnqueueUsageWebhookSummariesRequest) (*v1.EnqueueUsageWebhookSummariesResponse, error) {
+	if in.GetDay() == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Day must be specified")
+	}
+	if s.webhooks == nil {
+		return &v1.EnqueueUsageWebhookSummariesResponse{}, nil
+	}
+	day := in.GetDay().AsTime().UTC()
+	from := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 1)
+
+	attributionIds, err := db.ListUsageWebhookAttributionIDs(ctx, s.conn)
+	if err != nil {
+		requestid.Log(ctx).WithError(err).Error("Failed to list attribution IDs with usage webhooks.")
+		return nil, status.Errorf(codes.Internal, "Failed to list attribution IDs with usage webhooks")
+	}
+
+	resp := &v1.EnqueueUsageWebhookSummariesResponse{}
+	for _, attributionId := range attributionIds {
+		logger := requestid.Log(ctx).WithField("attribution_id", attributionId)
+
+		usage, err := db.GetWorkspaceUsageByProject(ctx, s.conn, attributionId, from, to)
+		if err != nil {
+			logger.WithError(err).Error("Failed to get usage by project.")
+			return nil, status.Errorf(codes.Internal, "Failed to summarize usage of %s", attributionId)
+		}
+		summary := notifier.UsageSummary{
+			AttributionID:        string(attributionId),
+			Day:                  db.UsageDay(from),
+			CreditsUsedByProject: map[string]float64{},
+		}
+		var creditsUsed db.CreditCents
+		for projectID, creditCents := range usage {
+			summary.CreditsUsedByProject[projectID] = creditCents.ToCredits()
+			creditsUsed += creditCents
+		}
+		summary.CreditsUsed = creditsUsed.ToCredits()
+
+		enqueued, err := s.enqueueUsageWebhookEvent(ctx, s.conn, attributionId, summary.Day, notifier.WebhookEvent{Event: notifier.UsageSummaryEvent, UsageSummary: &summary})
+		if err != nil {
+			logger.WithError(err).Error("Failed to enqueue usage summary.")
+			return nil, status.Errorf(codes.Internal, "Failed to enqueue usage summary of %s", attributionId)
+		}
+		resp.Enqueued += enqueued
+	}
+	return resp, nil
+}
+
+func (s *UsageService) DeliverUsageWebhooks(ctx context.Context, in *v1.DeliverUsageWebhooksRequest) (*v1.DeliverUsageWebhooksResponse, error) {
+	if s.webhooks == nil {
+		return &v1.DeliverUsageWebhooksResponse{}, nil
+	}
+
+	deliveries, err := db.FindDueUsageWebhookDeliveries(ctx, s.conn, s.nowFunc(), usageWebhookDeliveryBatch)
+	if err != nil {
+		requestid.Log(ctx).WithError(err).Error("Failed to find due usage webhook deliveries.")
+		return nil, status.Errorf(codes.Internal, "Failed to find due usage webhook deliveries")
+	}
+	var webhookIDs []uuid.UUID
+	for _, delivery := range deliveries {
+		webhookIDs = append(webhookIDs, delivery.WebhookID)
+	}
+	webhooks, err := db.FindUsageWebhooks(ctx, s.conn, webhookIDs)
+	if err != nil {
+		requestid.Log(ctx).WithError(err).Error("Failed to find usage webhooks of deliveries.")
+		return nil, status.Errorf(codes.Internal, "Failed to find usage webhooks")
+	}
+
+	resp := &v1.DeliverUsageWebhooksResponse{}
+	for _, delivery := range deliveries {
+		logger := requestid.Log(ctx).
+			WithField("delivery_id", delivery.ID).
+			WithField("webhook_id", delivery.WebhookID).
+			WithField("event", delivery.Event)
+
+		var deliveryErr error
+		webhook, ok := webhooks[delivery.WebhookID]
+		if ok {
+			deliveryErr = notifier.NewEndpointWebhook(webhook.URL, []byte(webhook.Secret)).Deliver(ctx, delivery.ID.String(), delivery.Payload)
+		} else {
+			deliveryErr = errors.New("webhook was deleted")
+		}
+
+		now := s.nowFunc()
+		delivery.Attempts++
+		switch {
+		case deliveryErr == nil:
+			delivery.DeliveredTime = db.NewVarcharTime(now)
+			delivery.LastError = ""
+			resp.Delivered++
+		case !ok || delivery.Attempts >= s.webhooks.maxAttempts():
+			delivery.FailedTime = db.NewVarcharTime(now)
+			delivery.LastError = truncateUsageWebhookError(deliveryErr)
+			logger.WithError(deliveryErr).WithField("attempts", delivery.Attempts).Warn("Gave up delivering usage webhook.")
+			resp.GivenUp++
+		default:
+			delivery.NextAttemptTime = db.NewVarcharTime(now.Add(usageWebhookBackoff(delivery.Attempts)))
+			delivery.LastError = truncateUsageWebhookError(deliveryErr)
+			logger.WithError(deliveryErr).WithField("attempts", delivery.Attempts).Info("Failed to deliver usage webhook, retrying later.")
+			resp.Failed++
+		}
+
+		err := db.UpdateUsageWebhookDelivery(ctx, s.conn, delivery)
+		if err != nil {
+			// Delivered events are delivered again, endpoints identify redeliveries by their delivery ID.
+			logger.WithError(err).Error("Failed to record usage webhook delivery.")
+			return nil, status.Errorf(codes.Internal, "Failed to record usage webhook delivery %s", delivery.ID)
+		}
+	}
+	return resp, nil
+}
+
+// enqueueUsageWebhookEvent schedules the delivery of the event to the webhooks of the attribution ID, unless usage
+// webhooks are disabled. The key identifies the occurrence of the event, see db.UsageWebhookDeliveryID.
+func (s *UsageService) enqueueUsageWebhookEvent(ctx context.Context, conn *gorm.DB, attributionId db.AttributionID, key string, event notifier.WebhookEvent) (int64, error) {
+	if s.webhooks == nil {
+		return 0, nil
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal %s event: %w", event.Event, err)
+	}
+	return db.EnqueueUsageWebhookDeliveries(ctx, conn, attributionId, event.Event, key, payload, s.nowFunc())
+}
+
+// usageWebhookBackoff is the delay before the next attempt, after the given number of failed attempts.
+func usageWebhookBackoff(attempts int) time.Duration {
+	backoff := usageWebhookInitialBackoff
+	for i := 1; i < attempts && backoff < usageWebhookMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > usageWebhookMaxBackoff {
+		return usageWebhookMaxBackoff
+	}
+	return backoff
+}
+
+// validateUsageWebhookURL only accepts https URLs of public hosts, such that webhooks can not reach internal services
+// through their IP address.
+func validateUsageWebhookURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "https" {
+		return errors.New("URL must use https")
+	}
+	if u.User != nil {
+		return errors.New("URL must not contain credentials")
+	}
+	host := u.Hostname()
+	if host == "" {
+		return errors.New("URL must have a host")
+	}
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return errors.New("URL must not point to localhost")
+	}
+	if ip := net.ParseIP(host); ip != nil && (ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsUnspecified()) {
+		return errors.New("URL must not point to a private address")
+	}
+	return nil
+}
+
+func truncateUsageWebhookError(err error) string {
+	msg := err.Error()
+	if len(msg) <= maxUsageWebhookErrorLength {
+		return msg
+	}
+	return msg[:maxUsageWebhookErrorLength]
+}
+
+func newUsageWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func toUsageWebhook(webhook db.UsageWebhook) *v1.UsageWebhook {
+	return &v1.UsageWebhook{
+		Id:            webhook.ID.String(),
+		AttributionId: string(webhook.AttributionID),
+		Url:           webhook.URL,
+		CreationTime:  timestamppb.New(webhook.CreationTime.Time()),
+	}
+}
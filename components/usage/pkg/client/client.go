@@ -0,0 +1,139 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+// Package client connects other components to the UsageService of the usage component. Calls carry the request ID of
+// their context, have a deadline, and are retried while the usage component is unavailable, e.g. during a rollout.
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gitpod-io/gitpod/common-go/util"
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/gitpod-io/gitpod/usage/pkg/requestid"
+	grpc_retry "github.com/grpc-ecosystem/go-grpc-middleware/retry"
+	grpc_opentracing "github.com/grpc-ecosystem/go-grpc-middleware/tracing/opentracing"
+	"github.com/opentracing/opentracing-go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const (
+	defaultTimeout    = 10 * time.Second
+	defaultMaxRetries = 3
+	defaultBackoff    = 100 * time.Millisecond
+	// backoffJitter varies the backoff by up to 10%, such that clients which failed at the same time do not retry at
+	// the same time.
+	backoffJitter = 0.1
+	// maxMessageSize matches the limit of the usage component, which sends large reports.
+	maxMessageSize = 100 * 1024 * 1024
+)
+
+type Config struct {
+	// Address is the gRPC address of the usage component, e.g. usage:9001.
+	Address string `json:"address"`
+
+	// Timeout is the deadline of unary calls whose context has no deadline of its own, including their retries.
+	// When Timeout is 0, calls time out after 10 seconds.
+	Timeout util.Duration `json:"timeout,omitempty"`
+
+	// MaxRetries is how often unary calls are retried when they fail with Unavailable. When MaxRetries is 0, calls are
+	// retried 3 times. Negative values disable retries.
+	MaxRetries int `json:"maxRetries,omitempty"`
+
+	// Backoff is the wait before the first retry, it doubles with every further retry. When Backoff is 0, the first
+	// retry waits 100 milliseconds.
+	Backoff util.Duration `json:"backoff,omitempty"`
+}
+
+// Client is a UsageServiceClient on a connection of its own, which is closed by Close.
+type Client struct {
+	v1.UsageServiceClient
+
+	conn *grpc.ClientConn
+}
+
+// New connects to the usage component. Calls which fail with Unavailable never reached the usage component or were
+// rejected before they were handled, hence all unary RPCs are retried, including those which change state. Streaming
+// RPCs are not retried, and have no default deadline. The options are applied after the defaults, e.g. to use TLS.
+func New(cfg Config, opts ...grpc.DialOption) (*Client, error) {
+	if cfg.Address == "" {
+		return nil, errors.New("no usage component address specified")
+	}
+
+	timeout := time.Duration(cfg.Timeout)
+	if timeout < 0 {
+		return nil, fmt.Errorf("invalid timeout of %s", timeout)
+	}
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	maxRetries := cfg.MaxRetries
+	if maxRetries < 0 {
+		maxRetries = 0
+	} else if maxRetries == 0 {
+		maxRetries = defaultMaxRetries
+	}
+	backoff := time.Duration(cfg.Backoff)
+	if backoff < 0 {
+		return nil, fmt.Errorf("invalid backoff of %s", backoff)
+	}
+	if backoff == 0 {
+		backoff = defaultBackoff
+	}
+
+	dialOpts := append([]grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithChainUnaryInterceptor(
+			// The deadline bounds all attempts, retries stop when it is exceeded.
+			deadlineUnaryClientInterceptor(timeout),
+			grpc_opentracing.UnaryClientInterceptor(grpc_opentracing.WithTracer(opentracing.GlobalTracer())),
+			grpc_retry.UnaryClientInterceptor(
+				grpc_retry.WithCodes(codes.Unavailable),
+				// The maximum includes the first attempt.
+				grpc_retry.WithMax(uint(maxRetries)+1),
+				grpc_retry.WithBackoff(grpc_retry.BackoffExponentialWithJitter(backoff, backoffJitter)),
+			),
+			requestid.UnaryClientInterceptor(),
+		),
+		grpc.WithChainStreamInterceptor(
+			grpc_opentracing.StreamClientInterceptor(grpc_opentracing.WithTracer(opentracing.GlobalTracer())),
+		),
+		grpc.WithDefaultCallOptions(
+			grpc.MaxCallRecvMsgSize(maxMessageSize),
+			grpc.MaxCallSendMsgSize(maxMessageSize),
+		),
+	}, opts...)
+
+	conn, err := grpc.Dial(cfg.Address, dialOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial usage component at %s: %w", cfg.Address, err)
+	}
+
+	return &Client{
+		UsageServiceClient: v1.NewUsageServiceClient(conn),
+		conn:               conn,
+	}, nil
+}
+
+// Close closes the connection, calls in flight fail with Canceled.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// deadlineUnaryClientInterceptor sets a deadline of `timeout` on calls whose context has no deadline.
+func deadlineUnaryClientInterceptor(timeout time.Duration) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if _, ok := ctx.Deadline(); !ok {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package client
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gitpod-io/gitpod/common-go/baseserver"
+	"github.com/gitpod-io/gitpod/common-go/util"
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/gitpod-io/gitpod/usage/pkg/requestid"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type fakeUsageService struct {
+	v1.UnimplementedUsageServiceServer
+
+	mu          sync.Mutex
+	unavailable int
+	calls       int
+	requestIDs  []string
+	deadlines   []bool
+	block       bool
+
+	costCenters    []*v1.CostCenter
+	billedSessions []*v1.BilledSession
+	pages          []*v1.PaginatedRequest
+}
+
+func (f *fakeUsageService) GetBalance(ctx context.Context, in *v1.GetBalanceRequest) (*v1.GetBalanceResponse, error) {
+	f.mu.Lock()
+	f.calls++
+	f.requestIDs = append(f.requestIDs, requestid.FromContext(ctx))
+	_, hasDeadline := ctx.Deadline()
+	f.deadlines = append(f.deadlines, hasDeadline)
+	fail := f.calls <= f.unavailable
+	block := f.block
+	f.mu.Unlock()
+
+	if block {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	if fail {
+		return nil, status.Error(codes.Unavailable, "unavailable")
+	}
+	return &v1.GetBalanceResponse{CreditsUsed: 42}, nil
+}
+
+func (f *fakeUsageService) SetSpendingLimit(ctx context.Context, in *v1.SetSpendingLimitRequest) (*v1.SetSpendingLimitResponse, error) {
+	f.mu.Lock()
+	f.calls++
+	f.mu.Unlock()
+	return nil, status.Error(codes.InvalidArgument, "invalid")
+}
+
+func (f *fakeUsageService) ListCostCenters(ctx context.Context, in *v1.ListCostCentersRequest) (*v1.ListCostCentersResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pages = append(f.pages, in.GetPagination())
+
+	costCenters, pagination := pageOf(f.costCenters, in.GetPagination(), 0)
+	return &v1.ListCostCentersResponse{CostCenters: costCenters, Pagination: pagination}, nil
+}
+
+// ListBilledUsage numbers pages from 1 like the usage service, see UsageService.ListBilledUsage.
+func (f *fakeUsageService) ListBilledUsage(ctx context.Context, in *v1.ListBilledUsageRequest) (*v1.ListBilledUsageResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pages = append(f.pages, in.GetPagination())
+
+	sessions, pagination := pageOf(f.billedSessions, in.GetPagination(), 1)
+	return &v1.ListBilledUsageResponse{Sessions: sessions, Pagination: pagination}, nil
+}
+
+// pageOf returns the requested page of items, where the first page is numbered firstPage. Pages before the first
+// page return the first page.
+func pageOf[T any](items []T, in *v1.PaginatedRequest, firstPage int64) ([]T, *v1.PaginatedResponse) {
+	perPage, page := in.GetPerPage(), in.GetPage()
+	total := int64(len(items))
+	index := page - firstPage
+	if index < 0 {
+		index = 0
+	}
+	start, end := index*perPage, (index+1)*perPage
+	if start > total {
+		start = total
+	}
+	if end > total {
+		end = total
+	}
+	return items[start:end], &v1.PaginatedResponse{
+		PerPage:    perPage,
+		Page:       page,
+		Total:      total,
+		TotalPages: (total + perPage - 1) / perPage,
+	}
+}
+
+func newClientForTests(t *testing.T, service *fakeUsageService, cfg Config) *Client {
+	t.Helper()
+
+	srv := baseserver.NewForTests(t,
+		baseserver.WithGRPC(baseserver.MustUseRandomLocalAddress(t)),
+		baseserver.WithGRPCUnaryInterceptors(requestid.UnaryServerInterceptor()),
+	)
+	v1.RegisterUsageServiceServer(srv.GRPC(), service)
+	baseserver.StartServerForTests(t, srv)
+
+	cfg.Address = srv.GRPCAddress()
+	client, err := New(cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, client.Close())
+	})
+	return client
+}
+
+func TestClient_RetriesUnavailable(t *testing.T) {
+	service := &fakeUsageService{unavailable: 2}
+	client := newClientForTests(t, service, Config{Backoff: util.Duration(time.Millisecond)})
+
+	ctx := requestid.WithID(context.Background(), "request-a")
+	resp, err := client.GetBalance(ctx, &v1.GetBalanceRequest{AttributionId: "team:a"})
+	require.NoError(t, err)
+	require.EqualValues(t, 42, resp.GetCreditsUsed())
+	require.Equal(t, 3, service.calls)
+	require.Equal(t, []string{"request-a", "request-a", "request-a"}, service.requestIDs, "must send the request ID with every attempt")
+	require.Equal(t, []bool{true, true, true}, service.deadlines, "must set a deadline on calls without one")
+}
+
+func TestClient_GivesUpAfterMaxRetries(t *testing.T) {
+	service := &fakeUsageService{unavailable: 10}
+	client := newClientForTests(t, service, Config{MaxRetries: 2, Backoff: util.Duration(time.Millisecond)})
+
+	_, err := client.GetBalance(context.Background(), &v1.GetBalanceRequest{AttributionId: "team:a"})
+	require.Equal(t, codes.Unavailable, status.Code(err))
+	require.Equal(t, 3, service.calls, "must retry twice")
+}
+
+func TestClient_RetriesDisabled(t *testing.T) {
+	service := &fakeUsageService{unavailable: 1}
+	client := newClientForTests(t, service, Config{MaxRetries: -1})
+
+	_, err := client.GetBalance(context.Background(), &v1.GetBalanceRequest{AttributionId: "team:a"})
+	require.Equal(t, codes.Unavailable, status.Code(err))
+	require.Equal(t, 1, service.calls)
+}
+
+func TestClient_DoesNotRetryOtherErrors(t *testing.T) {
+	service := &fakeUsageService{}
+	client := newClientForTests(t, service, Config{Backoff: util.Duration(time.Millisecond)})
+
+	_, err := client.SetSpendingLimit(context.Background(), &v1.SetSpendingLimitRequest{AttributionId: "team:a"})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	require.Equal(t, 1, service.calls)
+}
+
+func TestClient_DefaultDeadline(t *testing.T) {
+	service := &fakeUsageService{block: true}
+	client := newClientForTests(t, service, Config{Timeout: util.Duration(50 * time.Millisecond)})
+
+	start := time.Now()
+	_, err := client.GetBalance(context.Background(), &v1.GetBalanceRequest{AttributionId: "team:a"})
+	require.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	require.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestNew_Validation(t *testing.T) {
+	_, err := New(Config{})
+	require.Error(t, err, "must require an address")
+
+	_, err = New(Config{Address: "usage:9001", Timeout: util.Duration(-time.Second)})
+	require.Error(t, err)
+
+	_, err = New(Config{Address: "usage:9001", Backoff: util.Duration(-time.Second)})
+	require.Error(t, err)
+}
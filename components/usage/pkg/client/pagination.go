@@ -0,0 +1,113 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package client
+
+import (
+	"context"
+	"errors"
+
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// DefaultPerPage is the number of items which the list helpers request per page.
+const DefaultPerPage = 100
+
+// ListPageFunc lists one page of a paginated RPC, and returns its items with the pagination of the response.
+type ListPageFunc[T any] func(ctx context.Context, pagination *v1.PaginatedRequest) ([]T, *v1.PaginatedResponse, error)
+
+// EachPage calls list with every page of perPage items, starting at the first page, and calls fn with the items of
+// each page until all pages were listed, or list or fn fail. When perPage is 0, DefaultPerPage items are listed per
+// page. Items which are added while listing may be skipped, or returned twice.
+func EachPage[T any](ctx context.Context, perPage int64, list ListPageFunc[T], fn func(items []T) error) error {
+	if perPage < 0 {
+		return errors.New("number of items per page must not be negative")
+	}
+	if perPage == 0 {
+		perPage = DefaultPerPage
+	}
+
+	for page := int64(0); ; page++ {
+		items, pagination, err := list(ctx, &v1.PaginatedRequest{PerPage: perPage, Page: page})
+		if err != nil {
+			return err
+		}
+		if len(items) > 0 {
+			if err := fn(items); err != nil {
+				return err
+			}
+		}
+		// An empty page ends the listing even if the total suggests more pages, such that items which are deleted
+		// while listing do not lead to an endless loop.
+		if len(items) == 0 || page+1 >= pagination.GetTotalPages() {
+			return nil
+		}
+	}
+}
+
+// ListAll returns the items of all pages, see EachPage.
+func ListAll[T any](ctx context.Context, perPage int64, list ListPageFunc[T]) ([]T, error) {
+	var all []T
+	err := EachPage(ctx, perPage, list, func(items []T) error {
+		all = append(all, items...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return all, nil
+}
+
+// ListAllCostCenters returns the cost centers of all pages. Only the page size of the request is used.
+func (c *Client) ListAllCostCenters(ctx context.Context, in *v1.ListCostCentersRequest) ([]*v1.CostCenter, error) {
+	return ListAll(ctx, in.GetPagination().GetPerPage(), func(ctx context.Context, pagination *v1.PaginatedRequest) ([]*v1.CostCenter, *v1.PaginatedResponse, error) {
+		req := proto.Clone(in).(*v1.ListCostCentersRequest)
+		req.Pagination = pagination
+		resp, err := c.ListCostCenters(ctx, req)
+		return resp.GetCostCenters(), resp.GetPagination(), err
+	})
+}
+
+// ListAllUsage returns the usage entries of all pages. Only the page size of the request is used.
+func (c *Client) ListAllUsage(ctx context.Context, in *v1.ListUsageRequest) ([]*v1.Usage, error) {
+	return ListAll(ctx, in.GetPagination().GetPerPage(), func(ctx context.Context, pagination *v1.PaginatedRequest) ([]*v1.Usage, *v1.PaginatedResponse, error) {
+		req := proto.Clone(in).(*v1.ListUsageRequest)
+		req.Pagination = pagination
+		resp, err := c.ListUsage(ctx, req)
+		return resp.GetUsageEntries(), resp.GetPagination(), err
+	})
+}
+
+// ListAllBilledUsage returns the billed sessions of all pages. Only the page size of the request is used.
+func (c *Client) ListAllBilledUsage(ctx context.Context, in *v1.ListBilledUsageRequest) ([]*v1.BilledSession, error) {
+	return ListAll(ctx, in.GetPagination().GetPerPage(), func(ctx context.Context, pagination *v1.PaginatedRequest) ([]*v1.BilledSession, *v1.PaginatedResponse, error) {
+		req := proto.Clone(in).(*v1.ListBilledUsageRequest)
+		// Unlike the other RPCs, ListBilledUsage numbers pages from 1.
+		req.Pagination = &v1.PaginatedRequest{PerPage: pagination.GetPerPage(), Page: pagination.GetPage() + 1}
+		resp, err := c.ListBilledUsage(ctx, req)
+		return resp.GetSessions(), resp.GetPagination(), err
+	})
+}
+
+// ListAllSpendingLimitChanges returns the spending limit changes of all pages. Only the page size of the request is
+// used.
+func (c *Client) ListAllSpendingLimitChanges(ctx context.Context, in *v1.ListSpendingLimitChangesRequest) ([]*v1.SpendingLimitChange, error) {
+	return ListAll(ctx, in.GetPagination().GetPerPage(), func(ctx context.Context, pagination *v1.PaginatedRequest) ([]*v1.SpendingLimitChange, *v1.PaginatedResponse, error) {
+		req := proto.Clone(in).(*v1.ListSpendingLimitChangesRequest)
+		req.Pagination = pagination
+		resp, err := c.ListSpendingLimitChanges(ctx, req)
+		return resp.GetChanges(), resp.GetPagination(), err
+	})
+}
+
+// ListAllAuditEvents returns the audit events of all pages. Only the page size of the request is used.
+func (c *Client) ListAllAuditEvents(ctx context.Context, in *v1.ListAuditEventsRequest) ([]*v1.AuditEvent, error) {
+	return ListAll(ctx, in.GetPagination().GetPerPage(), func(ctx context.Context, pagination *v1.PaginatedRequest) ([]*v1.AuditEvent, *v1.PaginatedResponse, error) {
+		req := proto.Clone(in).(*v1.ListAuditEventsRequest)
+		req.Pagination = pagination
+		resp, err := c.ListAuditEvents(ctx, req)
+		return resp.GetEvents(), resp.GetPagination(), err
+	})
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_ListAllCostCenters(t *testing.T) {
+	service := &fakeUsageService{}
+	for i := 0; i < 5; i++ {
+		service.costCenters = append(service.costCenters, &v1.CostCenter{AttributionId: fmt.Sprintf("team:%d", i)})
+	}
+	client := newClientForTests(t, service, Config{})
+
+	in := &v1.ListCostCentersRequest{Pagination: &v1.PaginatedRequest{PerPage: 2, Page: 7}}
+	costCenters, err := client.ListAllCostCenters(context.Background(), in)
+	require.NoError(t, err)
+	require.Len(t, costCenters, 5)
+	for i, costCenter := range costCenters {
+		require.Equal(t, fmt.Sprintf("team:%d", i), costCenter.GetAttributionId())
+	}
+
+	var pages []int64
+	for _, pagination := range service.pages {
+		require.EqualValues(t, 2, pagination.GetPerPage())
+		pages = append(pages, pagination.GetPage())
+	}
+	require.Equal(t, []int64{0, 1, 2}, pages, "must list every page from the first one")
+	require.EqualValues(t, 7, in.GetPagination().GetPage(), "must not change the request")
+}
+
+func TestClient_ListAllBilledUsage(t *testing.T) {
+	service := &fakeUsageService{}
+	for i := 0; i < 5; i++ {
+		service.billedSessions = append(service.billedSessions, &v1.BilledSession{InstanceId: fmt.Sprintf("instance-%d", i)})
+	}
+	client := newClientForTests(t, service, Config{})
+
+	sessions, err := client.ListAllBilledUsage(context.Background(), &v1.ListBilledUsageRequest{Pagination: &v1.PaginatedRequest{PerPage: 2}})
+	require.NoError(t, err)
+	require.Len(t, sessions, 5)
+	for i, session := range sessions {
+		require.Equal(t, fmt.Sprintf("instance-%d", i), session.GetInstanceId(), "must list every session once")
+	}
+
+	var pages []int64
+	for _, pagination := range service.pages {
+		pages = append(pages, pagination.GetPage())
+	}
+	require.Equal(t, []int64{1, 2, 3}, pages, "must number pages from 1")
+}
+
+func TestEachPage(t *testing.T) {
+	t.Run("stops at an empty page", func(t *testing.T) {
+		var calls int
+		items, err := ListAll(context.Background(), 0, func(ctx context.Context, pagination *v1.PaginatedRequest) ([]int, *v1.PaginatedResponse, error) {
+			calls++
+			require.EqualValues(t, DefaultPerPage, pagination.GetPerPage())
+			if pagination.GetPage() > 0 {
+				return nil, &v1.PaginatedResponse{TotalPages: 3}, nil
+			}
+			return []int{1, 2}, &v1.PaginatedResponse{TotalPages: 3}, nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, []int{1, 2}, items)
+		require.Equal(t, 2, calls)
+	})
+
+	t.Run("stops when listing fails", func(t *testing.T) {
+		err := EachPage(context.Background(), 10, func(ctx context.Context, pagination *v1.PaginatedRequest) ([]int, *v1.PaginatedResponse, error) {
+			return nil, nil, errors.New("unavailable")
+		}, func(items []int) error {
+			t.Fatal("must not be called")
+			return nil
+		})
+		require.Error(t, err)
+	})
+
+	t.Run("rejects negative page sizes", func(t *testing.T) {
+		_, err := ListAll(context.Background(), -1, func(ctx context.Context, pagination *v1.PaginatedRequest) ([]int, *v1.PaginatedResponse, error) {
+			return nil, nil, nil
+		})
+		require.Error(t, err)
+	})
+}
@@ -20,14 +20,19 @@ import (
 type Interface interface {
 	UploadUsageReport(ctx context.Context, filename string, report UsageReport) error
 	DownloadUsageReport(ctx context.Context, filename string) (UsageReport, error)
+	ReportDownloadURL(ctx context.Context, filename string) (string, error)
+	LatestUsageReportManifest(ctx context.Context, generationID string) (UsageReportManifest, error)
 }
 
 type Client struct {
 	service api.UsageReportServiceClient
+
+	// summaryCurrency is used to show amounts in the human-readable report summary, optional.
+	summaryCurrency *Currency
 }
 
-func New(service api.UsageReportServiceClient) *Client {
-	return &Client{service: service}
+func New(service api.UsageReportServiceClient, summaryCurrency *Currency) *Client {
+	return &Client{service: service, summaryCurrency: summaryCurrency}
 }
 
 func (c *Client) UploadUsageReport(ctx context.Context, filename string, report UsageReport) (err error) {
@@ -36,39 +41,95 @@ func (c *Client) UploadUsageReport(ctx context.Context, filename string, report
 		observeReportUploadDuration(time.Since(start), err)
 	}()
 
-	uploadURLResp, err := c.service.UploadURL(ctx, &api.UsageReportUploadURLRequest{Name: filename})
+	reportJSON, err := json.Marshal(report)
 	if err != nil {
-		return fmt.Errorf("failed to get upload URL from usage report service: %w", err)
+		return fmt.Errorf("failed to marshal report to JSON: %w", err)
 	}
 
 	reportBytes := &bytes.Buffer{}
 	gz := gzip.NewWriter(reportBytes)
-	err = json.NewEncoder(gz).Encode(report)
+	_, err = gz.Write(reportJSON)
 	if err != nil {
-		return fmt.Errorf("failed to marshal report to JSON: %w", err)
+		return fmt.Errorf("failed to compress usage report: %w", err)
 	}
 	err = gz.Close()
 	if err != nil {
 		return fmt.Errorf("failed to compress usage report: %w", err)
 	}
 
-	req, err := http.NewRequest(http.MethodPut, uploadURLResp.GetUrl(), reportBytes)
+	log.Infof("Uploading %q to object storage...", filename)
+	err = c.upload(ctx, reportObject_Report, filename, reportBytes.Bytes(), "application/json", "gzip")
+	if err != nil {
+		return err
+	}
+
+	summary := NewUsageSummary(report, c.summaryCurrency)
+	summaryBytes := &bytes.Buffer{}
+	err = summary.RenderHTML(summaryBytes)
+	if err != nil {
+		return err
+	}
+	err = c.upload(ctx, reportObject_Summary, SummaryFilename(filename), summaryBytes.Bytes(), "text/html; charset=utf-8", "")
+	if err != nil {
+		return fmt.Errorf("failed to upload usage summary: %w", err)
+	}
+
+	// The manifest is uploaded after the report, such that its presence signals a complete upload to consumers.
+	manifest, err := NewUsageReportManifest(filename, report, reportJSON)
+	if err != nil {
+		return fmt.Errorf("failed to compute report manifest: %w", err)
+	}
+	manifestJSON, err := json.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("failed to marshal report manifest to JSON: %w", err)
+	}
+	err = c.upload(ctx, reportObject_Manifest, ManifestFilename(filename), manifestJSON, "application/json", "")
+	if err != nil {
+		return fmt.Errorf("failed to upload report manifest: %w", err)
+	}
+
+	if report.GenerationID != "" {
+		err = c.upload(ctx, reportObject_LatestManifest, LatestManifestFilename(report.GenerationID), manifestJSON, "application/json", "")
+		if err != nil {
+			return fmt.Errorf("failed to upload latest report manifest: %w", err)
+		}
+	}
+	log.Info("Upload complete")
+
+	return nil
+}
+
+// upload puts the body to object storage. Every upload is recorded by the type of the object, see
+// observeReportObjectUpload.
+func (c *Client) upload(ctx context.Context, objectType string, filename string, body []byte, contentType, contentEncoding string) (err error) {
+	start := time.Now()
+	defer func() {
+		observeReportObjectUpload(objectType, len(body), time.Since(start), err)
+	}()
+
+	uploadURLResp, err := c.service.UploadURL(ctx, &api.UsageReportUploadURLRequest{Name: filename})
+	if err != nil {
+		return fmt.Errorf("failed to get upload URL from usage report service: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPut, uploadURLResp.GetUrl(), bytes.NewReader(body))
 	if err != nil {
 		return fmt.Errorf("failed to construct http request: %w", err)
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("Content-Type", contentType)
+	if contentEncoding != "" {
+		req.Header.Set("Content-Encoding", contentEncoding)
+	}
 
-	log.Infof("Uploading %q to object storage...", filename)
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to make http request: %w", err)
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
 		return fmt.Errorf("unexpected http response code: %s", resp.Status)
 	}
-	log.Info("Upload complete")
 
 	return nil
 }
@@ -121,3 +182,49 @@ func (c *Client) DownloadUsageReport(ctx context.Context, filename string) (repo
 
 	return report, nil
 }
+
+// ReportDownloadURL returns a signed URL from which the report with the given filename can be downloaded.
+func (c *Client) ReportDownloadURL(ctx context.Context, filename string) (string, error) {
+	resp, err := c.service.DownloadURL(ctx, &api.UsageReportDownloadURLRequest{
+		Name: filename,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to get download URL: %w", err)
+	}
+
+	return resp.GetUrl(), nil
+}
+
+// LatestUsageReportManifest returns the manifest of the latest report uploaded for the generation ID.
+// When no report has been uploaded yet, ErrManifestNotFound is returned.
+func (c *Client) LatestUsageReportManifest(ctx context.Context, generationID string) (UsageReportManifest, error) {
+	url, err := c.ReportDownloadURL(ctx, LatestManifestFilename(generationID))
+	if err != nil {
+		return UsageReportManifest{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return UsageReportManifest{}, fmt.Errorf("failed to construct request: %w", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return UsageReportManifest{}, fmt.Errorf("failed to make request to download report manifest: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return UsageReportManifest{}, ErrManifestNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return UsageReportManifest{}, fmt.Errorf("request to download report manifest returned non 200 status code: %d", resp.StatusCode)
+	}
+
+	var manifest UsageReportManifest
+	if err := json.NewDecoder(resp.Body).Decode(&manifest); err != nil {
+		return UsageReportManifest{}, fmt.Errorf("failed to deserialize report manifest: %w", err)
+	}
+
+	return manifest, nil
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package contentservice
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const manifestSuffix = ".manifest.json"
+
+var ErrManifestNotFound = errors.New("report manifest not found")
+
+// ManifestFilename returns the name of the sidecar manifest uploaded alongside the report with the given filename.
+func ManifestFilename(reportFilename string) string {
+	return reportFilename + manifestSuffix
+}
+
+// LatestManifestFilename returns the name of the manifest describing the latest report revision for a generation ID.
+func LatestManifestFilename(generationID string) string {
+	return generationID + ".latest" + manifestSuffix
+}
+
+// UsageReportManifest describes an uploaded UsageReport, such that consumers can verify they have received the complete
+// report before importing it.
+type UsageReportManifest struct {
+	ReportFilename string `json:"reportFilename"`
+	GenerationID   string `json:"generationId,omitempty"`
+	// Supersedes is the filename of the report revision this report replaces, if any.
+	Supersedes string `json:"supersedes,omitempty"`
+
+	// SHA256 is the hex encoded checksum of the uncompressed JSON report.
+	SHA256 string `json:"sha256"`
+	// ContentSHA256 is the checksum of the report content, see UsageReport.ContentChecksum.
+	ContentSHA256 string `json:"contentSha256"`
+
+	RecordCount         int     `json:"recordCount"`
+	InvalidSessionCount int     `json:"invalidSessionCount"`
+	TotalCreditsUsed    float64 `json:"totalCreditsUsed"`
+
+	// Parameters the report was generated with.
+	GenerationTime time.Time `json:"generationTime"`
+	From           time.Time `json:"from"`
+	To             time.Time `json:"to"`
+}
+
+// NewUsageReportManifest computes the manifest for report, where data is the uncompressed JSON serialization of the report.
+func NewUsageReportManifest(reportFilename string, report UsageReport, data []byte) (UsageReportManifest, error) {
+	var totalCreditsUsed float64
+	for _, record := range report.UsageRecords {
+		totalCreditsUsed += record.CreditsUsed
+	}
+
+	contentChecksum, err := report.ContentChecksum()
+	if err != nil {
+		return UsageReportManifest{}, err
+	}
+
+	return UsageReportManifest{
+		ReportFilename:      reportFilename,
+		GenerationID:        report.GenerationID,
+		Supersedes:          report.Supersedes,
+		SHA256:              checksum(data),
+		ContentSHA256:       contentChecksum,
+		RecordCount:         len(report.UsageRecords),
+		InvalidSessionCount: len(report.InvalidSessions),
+		TotalCreditsUsed:    totalCreditsUsed,
+		GenerationTime:      report.GenerationTime,
+		From:                report.From,
+		To:                  report.To,
+	}, nil
+}
+
+// Verify checks that data, the uncompressed JSON serialization of a report, matches the manifest.
+func (m *UsageReportManifest) Verify(data []byte) error {
+	if actual := checksum(data); actual != m.SHA256 {
+		return fmt.Errorf("checksum mismatch for report %q: expected %s, got %s", m.ReportFilename, m.SHA256, actual)
+	}
+	return nil
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
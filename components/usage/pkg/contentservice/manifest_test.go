@@ -0,0 +1,50 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package contentservice
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/db/dbtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewUsageReportManifest(t *testing.T) {
+	report := UsageReport{
+		GenerationTime: time.Now().UTC(),
+		From:           time.Now().UTC().Add(-time.Hour),
+		To:             time.Now().UTC(),
+		InvalidSessions: []InvalidSession{
+			{Reason: "some-reason"},
+		},
+		UsageRecords: []db.WorkspaceInstanceUsage{
+			dbtest.NewWorkspaceInstanceUsage(t, db.WorkspaceInstanceUsage{CreditsUsed: 1.5}),
+			dbtest.NewWorkspaceInstanceUsage(t, db.WorkspaceInstanceUsage{CreditsUsed: 2.5}),
+		},
+	}
+	data, err := json.Marshal(report)
+	require.NoError(t, err)
+
+	manifest, err := NewUsageReportManifest("report.gz", report, data)
+	require.NoError(t, err)
+	require.Equal(t, "report.gz", manifest.ReportFilename)
+	require.Len(t, manifest.SHA256, 64)
+	require.Equal(t, 2, manifest.RecordCount)
+	require.Equal(t, 1, manifest.InvalidSessionCount)
+	require.Equal(t, float64(4), manifest.TotalCreditsUsed)
+	require.Equal(t, report.GenerationTime, manifest.GenerationTime)
+	require.Equal(t, report.From, manifest.From)
+	require.Equal(t, report.To, manifest.To)
+
+	require.NoError(t, manifest.Verify(data))
+	require.Error(t, manifest.Verify(data[:len(data)-1]))
+}
+
+func TestManifestFilename(t *testing.T) {
+	require.Equal(t, "2022-08-01T10:00:00Z.gz.manifest.json", ManifestFilename("2022-08-01T10:00:00Z.gz"))
+}
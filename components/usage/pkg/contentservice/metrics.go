@@ -6,8 +6,9 @@ package contentservice
 
 import (
 	"fmt"
-	"github.com/prometheus/client_golang/prometheus"
 	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 const (
@@ -15,6 +16,14 @@ const (
 	subsystem = "usage"
 )
 
+// Types of the objects which make up a usage report in object storage, by which uploads are labelled.
+const (
+	reportObject_Report         = "report"
+	reportObject_Summary        = "summary"
+	reportObject_Manifest       = "manifest"
+	reportObject_LatestManifest = "latest_manifest"
+)
+
 var (
 	reportUploadDurationSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
 		Namespace: namespace,
@@ -23,6 +32,36 @@ var (
 		Help:      "Histogram of time it takes (in seconds) to upload a usage report to content service",
 	}, []string{"outcome"})
 
+	reportObjectUploadsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "report_object_uploads_total",
+		Help:      "Counter of uploads of usage report objects to object storage, by object type and outcome",
+	}, []string{"type", "outcome"})
+
+	reportObjectUploadDurationSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "report_object_upload_duration_seconds",
+		Help:      "Histogram of time it takes (in seconds) to upload a usage report object to object storage, by object type and outcome",
+	}, []string{"type", "outcome"})
+
+	reportObjectUploadSizeBytes = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "report_object_upload_size_bytes",
+		Help:      "Histogram of the size (in bytes) of usage report objects uploaded to object storage, by object type",
+		// From 1KiB to 1GiB.
+		Buckets: prometheus.ExponentialBuckets(1024, 4, 11),
+	}, []string{"type"})
+
+	reportObjectLastUploadTimestampSeconds = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "report_object_last_successful_upload_timestamp_seconds",
+		Help:      "Unix time of the last successful upload of a usage report object to object storage, by object type",
+	}, []string{"type"})
+
 	reportDownloadDurationSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
 		Namespace: namespace,
 		Subsystem: subsystem,
@@ -34,6 +73,10 @@ var (
 func RegisterMetrics(reg *prometheus.Registry) error {
 	metrics := []prometheus.Collector{
 		reportUploadDurationSeconds,
+		reportObjectUploadsTotal,
+		reportObjectUploadDurationSeconds,
+		reportObjectUploadSizeBytes,
+		reportObjectLastUploadTimestampSeconds,
 		reportDownloadDurationSeconds,
 	}
 	for _, metric := range metrics {
@@ -54,6 +97,22 @@ func observeReportUploadDuration(d time.Duration, err error) {
 	reportUploadDurationSeconds.WithLabelValues(outcome).Observe(d.Seconds())
 }
 
+// observeReportObjectUpload records the upload of a single object of a usage report. Only successful uploads update the
+// time of the last successful upload, such that alerts fire when reports stop arriving.
+func observeReportObjectUpload(objectType string, size int, d time.Duration, err error) {
+	outcome := "ok"
+	if err != nil {
+		outcome = "error"
+	}
+	reportObjectUploadsTotal.WithLabelValues(objectType, outcome).Inc()
+	reportObjectUploadDurationSeconds.WithLabelValues(objectType, outcome).Observe(d.Seconds())
+	if err != nil {
+		return
+	}
+	reportObjectUploadSizeBytes.WithLabelValues(objectType).Observe(float64(size))
+	reportObjectLastUploadTimestampSeconds.WithLabelValues(objectType).SetToCurrentTime()
+}
+
 func observeReportDownloadDuration(d time.Duration, err error) {
 	outcome := "ok"
 	if err != nil {
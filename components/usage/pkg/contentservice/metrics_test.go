@@ -0,0 +1,52 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package contentservice
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gitpod-io/gitpod/content-service/api"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+// fakeUsageReportService hands out upload URLs of the object storage server under the object name.
+type fakeUsageReportService struct {
+	api.UsageReportServiceClient
+	url string
+}
+
+func (s *fakeUsageReportService) UploadURL(ctx context.Context, in *api.UsageReportUploadURLRequest, opts ...grpc.CallOption) (*api.UsageReportUploadURLResponse, error) {
+	return &api.UsageReportUploadURLResponse{Url: s.url + "/" + in.GetName()}, nil
+}
+
+func TestUploadUsageReport_Metrics(t *testing.T) {
+	storage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The summary can not be stored, such that the upload fails after the report.
+		if strings.HasSuffix(r.URL.Path, SummaryFilename("report.json")) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer storage.Close()
+
+	client := New(&fakeUsageReportService{url: storage.URL}, nil)
+	err := client.UploadUsageReport(context.Background(), "report.json", UsageReport{})
+	require.Error(t, err)
+
+	require.Equal(t, float64(1), testutil.ToFloat64(reportObjectUploadsTotal.WithLabelValues(reportObject_Report, "ok")))
+	require.Equal(t, float64(1), testutil.ToFloat64(reportObjectUploadsTotal.WithLabelValues(reportObject_Summary, "error")))
+	require.Equal(t, float64(0), testutil.ToFloat64(reportObjectUploadsTotal.WithLabelValues(reportObject_Manifest, "ok")), "must stop uploading after a failure")
+
+	require.Positive(t, testutil.ToFloat64(reportObjectLastUploadTimestampSeconds.WithLabelValues(reportObject_Report)))
+	require.Zero(t, testutil.ToFloat64(reportObjectLastUploadTimestampSeconds.WithLabelValues(reportObject_Summary)), "failed uploads must not count as successful")
+	require.Equal(t, 1, testutil.CollectAndCount(reportObjectUploadSizeBytes), "only successful uploads have a size")
+}
@@ -20,3 +20,11 @@ func (c *NoOpClient) UploadUsageReport(ctx context.Context, filename string, rep
 func (c *NoOpClient) DownloadUsageReport(ctx context.Context, filename string) (UsageReport, error) {
 	return UsageReport{}, notImplementedError
 }
+
+func (c *NoOpClient) ReportDownloadURL(ctx context.Context, filename string) (string, error) {
+	return "", notImplementedError
+}
+
+func (c *NoOpClient) LatestUsageReportManifest(ctx context.Context, generationID string) (UsageReportManifest, error) {
+	return UsageReportManifest{}, notImplementedError
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package contentservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/gitpod-io/gitpod/common-go/log"
+)
+
+// ReportFilename returns the filename of the report revision with the given content checksum.
+func ReportFilename(generationID, contentChecksum string) string {
+	if len(contentChecksum) > 12 {
+		contentChecksum = contentChecksum[:12]
+	}
+	return fmt.Sprintf("%s_%s.gz", generationID, contentChecksum)
+}
+
+// PublishUsageReport uploads the report keyed by its generation ID and returns the filename of the report.
+// When the latest revision for the generation ID has the same content, the upload is skipped and the filename of the
+// existing revision is returned. Otherwise, the report records the revision it supersedes.
+func PublishUsageReport(ctx context.Context, svc Interface, report UsageReport) (string, error) {
+	if report.GenerationID == "" {
+		return "", errors.New("report has no generation ID")
+	}
+
+	contentChecksum, err := report.ContentChecksum()
+	if err != nil {
+		return "", err
+	}
+
+	logger := log.WithField("generation_id", report.GenerationID)
+
+	latest, err := svc.LatestUsageReportManifest(ctx, report.GenerationID)
+	switch {
+	case errors.Is(err, ErrManifestNotFound):
+	case err != nil:
+		return "", fmt.Errorf("failed to get latest report manifest: %w", err)
+	case latest.ContentSHA256 == contentChecksum:
+		logger.WithField("report", latest.ReportFilename).Info("Usage report is unchanged, skipping upload.")
+		return latest.ReportFilename, nil
+	default:
+		logger.WithField("supersedes", latest.ReportFilename).Info("Usage report content changed, uploading new revision.")
+		report.Supersedes = latest.ReportFilename
+	}
+
+	filename := ReportFilename(report.GenerationID, contentChecksum)
+	err = svc.UploadUsageReport(ctx, filename, report)
+	if err != nil {
+		return "", err
+	}
+
+	return filename, nil
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package contentservice
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/db/dbtest"
+	"github.com/stretchr/testify/require"
+)
+
+// inMemoryContentService records uploads and serves the latest manifests from memory.
+type inMemoryContentService struct {
+	NoOpClient
+	uploads   map[string]UsageReport
+	manifests map[string]UsageReportManifest
+}
+
+func (s *inMemoryContentService) UploadUsageReport(ctx context.Context, filename string, report UsageReport) error {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	manifest, err := NewUsageReportManifest(filename, report, data)
+	if err != nil {
+		return err
+	}
+	s.uploads[filename] = report
+	s.manifests[report.GenerationID] = manifest
+	return nil
+}
+
+func (s *inMemoryContentService) LatestUsageReportManifest(ctx context.Context, generationID string) (UsageReportManifest, error) {
+	manifest, ok := s.manifests[generationID]
+	if !ok {
+		return UsageReportManifest{}, ErrManifestNotFound
+	}
+	return manifest, nil
+}
+
+func TestPublishUsageReport(t *testing.T) {
+	from := time.Date(2022, 8, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC)
+	generationID := NewGenerationID(from, to, "0123456789abcdef")
+	require.Equal(t, "20220801T000000Z_20220901T000000Z_0123456789ab", generationID)
+
+	svc := &inMemoryContentService{
+		uploads:   map[string]UsageReport{},
+		manifests: map[string]UsageReportManifest{},
+	}
+	record := dbtest.NewWorkspaceInstanceUsage(t, db.WorkspaceInstanceUsage{CreditsUsed: 1})
+	report := UsageReport{
+		GenerationID:   generationID,
+		GenerationTime: time.Now().UTC(),
+		From:           from,
+		To:             from.Add(24 * time.Hour),
+		UsageRecords:   []db.WorkspaceInstanceUsage{record},
+	}
+
+	first, err := PublishUsageReport(context.Background(), svc, report)
+	require.NoError(t, err)
+	require.Len(t, svc.uploads, 1)
+	require.Empty(t, svc.uploads[first].Supersedes)
+
+	// Re-generating the same content later must not upload another revision.
+	report.GenerationTime = report.GenerationTime.Add(time.Hour)
+	report.To = report.To.Add(time.Hour)
+	second, err := PublishUsageReport(context.Background(), svc, report)
+	require.NoError(t, err)
+	require.Equal(t, first, second)
+	require.Len(t, svc.uploads, 1)
+
+	// Changed content must be uploaded as a new revision which supersedes the previous one.
+	report.UsageRecords = append(report.UsageRecords, dbtest.NewWorkspaceInstanceUsage(t, db.WorkspaceInstanceUsage{CreditsUsed: 2}))
+	third, err := PublishUsageReport(context.Background(), svc, report)
+	require.NoError(t, err)
+	require.NotEqual(t, first, third)
+	require.Len(t, svc.uploads, 2)
+	require.Equal(t, first, svc.uploads[third].Supersedes)
+	require.Equal(t, first, svc.manifests[generationID].Supersedes)
+}
+
+func TestPublishUsageReport_RequiresGenerationID(t *testing.T) {
+	_, err := PublishUsageReport(context.Background(), &NoOpClient{}, UsageReport{})
+	require.Error(t, err)
+}
@@ -0,0 +1,167 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package contentservice
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"time"
+)
+
+const summarySuffix = ".summary.html"
+
+// SummaryFilename returns the name of the human-readable summary uploaded alongside the report with the given filename.
+func SummaryFilename(reportFilename string) string {
+	return reportFilename + summarySuffix
+}
+
+// Currency configures how credits are converted to money in usage summaries.
+type Currency struct {
+	// Code is the ISO 4217 currency code, for example USD.
+	Code           string  `json:"code"`
+	PricePerCredit float64 `json:"pricePerCredit"`
+}
+
+type SummaryLine struct {
+	Name     string
+	Sessions int
+	Credits  float64
+}
+
+// UsageSummary aggregates a UsageReport into totals for finance.
+type UsageSummary struct {
+	GenerationTime time.Time
+	From           time.Time
+	To             time.Time
+
+	ByWorkspaceClass []SummaryLine
+	ByProject        []SummaryLine
+	Total            SummaryLine
+
+	// Currency is optional, when nil totals are only shown in credits.
+	Currency *Currency
+}
+
+func NewUsageSummary(report UsageReport, currency *Currency) UsageSummary {
+	byClass := map[string]*SummaryLine{}
+	byProject := map[string]*SummaryLine{}
+	total := SummaryLine{Name: "Total"}
+
+	add := func(lines map[string]*SummaryLine, name string, credits float64) {
+		line, ok := lines[name]
+		if !ok {
+			line = &SummaryLine{Name: name}
+			lines[name] = line
+		}
+		line.Sessions++
+		line.Credits += credits
+	}
+
+	for _, record := range report.UsageRecords {
+		class := record.WorkspaceClass
+		if class == "" {
+			class = "default"
+		}
+		project := record.ProjectID
+		if project == "" {
+			project = "(no project)"
+		}
+
+		add(byClass, class, record.CreditsUsed)
+		add(byProject, project, record.CreditsUsed)
+		total.Sessions++
+		total.Credits += record.CreditsUsed
+	}
+
+	return UsageSummary{
+		GenerationTime:   report.GenerationTime,
+		From:             report.From,
+		To:               report.To,
+		ByWorkspaceClass: sortedSummaryLines(byClass),
+		ByProject:        sortedSummaryLines(byProject),
+		Total:            total,
+		Currency:         currency,
+	}
+}
+
+// sortedSummaryLines orders lines by credits used, largest first.
+func sortedSummaryLines(lines map[string]*SummaryLine) []SummaryLine {
+	var sorted []SummaryLine
+	for _, line := range lines {
+		sorted = append(sorted, *line)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Credits != sorted[j].Credits {
+			return sorted[i].Credits > sorted[j].Credits
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+	return sorted
+}
+
+// Amount formats credits in the configured currency.
+func (s *UsageSummary) Amount(credits float64) string {
+	if s.Currency == nil {
+		return ""
+	}
+	return fmt.Sprintf("%.2f %s", credits*s.Currency.PricePerCredit, s.Currency.Code)
+}
+
+// RenderHTML writes the summary as a standalone HTML document.
+func (s *UsageSummary) RenderHTML(w io.Writer) error {
+	err := summaryTemplate.Execute(w, s)
+	if err != nil {
+		return fmt.Errorf("failed to render usage summary: %w", err)
+	}
+	return nil
+}
+
+type summarySection struct {
+	Title   string
+	Lines   []SummaryLine
+	Summary *UsageSummary
+}
+
+var summaryTemplate = template.Must(template.New("summary").Funcs(template.FuncMap{
+	"credits": func(c float64) string { return fmt.Sprintf("%.2f", c) },
+	"date":    func(t time.Time) string { return t.UTC().Format(time.RFC3339) },
+	"section": func(title string, lines []SummaryLine, summary *UsageSummary) summarySection {
+		return summarySection{Title: title, Lines: lines, Summary: summary}
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Usage summary {{ date .From }} to {{ date .To }}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; min-width: 40em; }
+th, td { border-bottom: 1px solid #ddd; padding: 0.4em 0.8em; text-align: left; }
+td.num, th.num { text-align: right; }
+tfoot td { font-weight: bold; }
+</style>
+</head>
+<body>
+<h1>Usage summary</h1>
+<p>Period: {{ date .From }} to {{ date .To }}<br>Generated: {{ date .GenerationTime }}</p>
+<p><strong>Grand total: {{ credits .Total.Credits }} credits{{ if .Currency }} ({{ .Amount .Total.Credits }}){{ end }}</strong> across {{ .Total.Sessions }} sessions.</p>
+{{ define "lines" }}
+<table>
+<thead><tr><th>{{ .Title }}</th><th class="num">Sessions</th><th class="num">Credits</th>{{ if .Summary.Currency }}<th class="num">Amount</th>{{ end }}</tr></thead>
+<tbody>
+{{ range .Lines }}<tr><td>{{ .Name }}</td><td class="num">{{ .Sessions }}</td><td class="num">{{ credits .Credits }}</td>{{ if $.Summary.Currency }}<td class="num">{{ $.Summary.Amount .Credits }}</td>{{ end }}</tr>
+{{ end }}</tbody>
+<tfoot><tr><td>Total</td><td class="num">{{ .Summary.Total.Sessions }}</td><td class="num">{{ credits .Summary.Total.Credits }}</td>{{ if .Summary.Currency }}<td class="num">{{ .Summary.Amount .Summary.Total.Credits }}</td>{{ end }}</tr></tfoot>
+</table>
+{{ end }}
+<h2>By workspace class</h2>
+{{ template "lines" (section "Workspace class" .ByWorkspaceClass .) }}
+<h2>By project</h2>
+{{ template "lines" (section "Project" .ByProject .) }}
+</body>
+</html>
+`))
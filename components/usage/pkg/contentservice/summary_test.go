@@ -0,0 +1,59 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package contentservice
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/db/dbtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewUsageSummary(t *testing.T) {
+	report := UsageReport{
+		GenerationTime: time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC),
+		From:           time.Date(2022, 8, 1, 0, 0, 0, 0, time.UTC),
+		To:             time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC),
+		UsageRecords: []db.WorkspaceInstanceUsage{
+			dbtest.NewWorkspaceInstanceUsage(t, db.WorkspaceInstanceUsage{ProjectID: "project-a", WorkspaceClass: "default", CreditsUsed: 1}),
+			dbtest.NewWorkspaceInstanceUsage(t, db.WorkspaceInstanceUsage{ProjectID: "project-a", WorkspaceClass: "large", CreditsUsed: 4}),
+			dbtest.NewWorkspaceInstanceUsage(t, db.WorkspaceInstanceUsage{ProjectID: "project-b", WorkspaceClass: "large", CreditsUsed: 2}),
+		},
+	}
+
+	summary := NewUsageSummary(report, &Currency{Code: "USD", PricePerCredit: 0.5})
+
+	require.Equal(t, []SummaryLine{
+		{Name: "large", Sessions: 2, Credits: 6},
+		{Name: "default", Sessions: 1, Credits: 1},
+	}, summary.ByWorkspaceClass)
+	require.Equal(t, []SummaryLine{
+		{Name: "project-a", Sessions: 2, Credits: 5},
+		{Name: "project-b", Sessions: 1, Credits: 2},
+	}, summary.ByProject)
+	require.Equal(t, SummaryLine{Name: "Total", Sessions: 3, Credits: 7}, summary.Total)
+	require.Equal(t, "3.50 USD", summary.Amount(summary.Total.Credits))
+
+	out := &bytes.Buffer{}
+	require.NoError(t, summary.RenderHTML(out))
+	require.Contains(t, out.String(), "Grand total: 7.00 credits (3.50 USD)")
+	require.Contains(t, out.String(), "<td>project-b</td>")
+}
+
+func TestNewUsageSummary_WithoutCurrency(t *testing.T) {
+	summary := NewUsageSummary(UsageReport{
+		UsageRecords: []db.WorkspaceInstanceUsage{
+			dbtest.NewWorkspaceInstanceUsage(t, db.WorkspaceInstanceUsage{CreditsUsed: 1}),
+		},
+	}, nil)
+
+	out := &bytes.Buffer{}
+	require.NoError(t, summary.RenderHTML(out))
+	require.Contains(t, out.String(), "Grand total: 1.00 credits</strong>")
+	require.NotContains(t, out.String(), "Amount")
+}
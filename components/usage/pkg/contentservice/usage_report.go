@@ -5,8 +5,11 @@
 package contentservice
 
 import (
-	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"encoding/json"
+	"fmt"
 	"time"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
 )
 
 type InvalidSession struct {
@@ -15,8 +18,14 @@ type InvalidSession struct {
 }
 
 type UsageReport struct {
+	// GenerationID identifies the window and configuration the report was generated for. Reports with the same
+	// GenerationID are revisions of each other.
+	GenerationID   string    `json:"generationId,omitempty"`
 	GenerationTime time.Time `json:"generationTime"`
 
+	// Supersedes is the filename of the previous revision of this report, if any.
+	Supersedes string `json:"supersedes,omitempty"`
+
 	From time.Time `json:"from"`
 	To   time.Time `json:"to"`
 
@@ -35,3 +44,29 @@ func (r *UsageReport) GetUsageRecordsForAttributionID(attributionID db.Attributi
 
 	return sessions
 }
+
+// NewGenerationID returns a deterministic identifier for a report covering the window [from, to), generated with the
+// configuration identified by configHash.
+func NewGenerationID(from, to time.Time, configHash string) string {
+	const layout = "20060102T150405Z"
+	if len(configHash) > 12 {
+		configHash = configHash[:12]
+	}
+	return fmt.Sprintf("%s_%s_%s", from.UTC().Format(layout), to.UTC().Format(layout), configHash)
+}
+
+// ContentChecksum returns the checksum of the report content. It ignores when the report was generated, which is
+// also reflected in To for windows which had not ended yet, and which revision the report supersedes.
+func (r *UsageReport) ContentChecksum() (string, error) {
+	content := *r
+	content.GenerationTime = time.Time{}
+	content.To = time.Time{}
+	content.Supersedes = ""
+
+	data, err := json.Marshal(content)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal report to JSON: %w", err)
+	}
+
+	return checksum(data), nil
+}
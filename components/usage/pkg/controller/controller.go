@@ -13,15 +13,25 @@ import (
 )
 
 func New(schedule time.Duration, reconciler Reconciler) (*Controller, error) {
+	return NewWithSpec(fmt.Sprintf("@every %s", schedule.String()), reconciler)
+}
+
+// NewWithSpec constructs a Controller which runs the reconciler according to a cron spec, for example "@monthly".
+func NewWithSpec(spec string, reconciler Reconciler) (*Controller, error) {
+	_, err := cron.Parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule spec %q: %w", spec, err)
+	}
+
 	return &Controller{
-		schedule:   schedule,
+		spec:       spec,
 		reconciler: reconciler,
 		scheduler:  cron.NewWithLocation(time.UTC),
 	}, nil
 }
 
 type Controller struct {
-	schedule   time.Duration
+	spec       string
 	reconciler Reconciler
 
 	scheduler *cron.Cron
@@ -50,7 +60,7 @@ func (c *Controller) Start() error {
 		}
 	}()
 
-	err := c.scheduler.AddFunc(fmt.Sprintf("@every %s", c.schedule.String()), cron.FuncJob(func() {
+	err := c.scheduler.AddFunc(c.spec, cron.FuncJob(func() {
 		log.Info("Starting usage reconciliation.")
 
 		select {
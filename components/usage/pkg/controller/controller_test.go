@@ -53,3 +53,11 @@ func TestController_GracefullyHandlesPanic(t *testing.T) {
 	require.NoError(t, ctrl.Start())
 	ctrl.Stop()
 }
+
+func TestNewWithSpec(t *testing.T) {
+	_, err := NewWithSpec("@monthly", ReconcilerFunc(func() error { return nil }))
+	require.NoError(t, err)
+
+	_, err = NewWithSpec("not a spec", ReconcilerFunc(func() error { return nil }))
+	require.Error(t, err)
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package controller
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gitpod-io/gitpod/common-go/log"
+	"github.com/gitpod-io/gitpod/usage/pkg/notifier"
+)
+
+const (
+	// DefaultEscalationThreshold is the number of consecutive failures of a reconciler after which they are escalated.
+	DefaultEscalationThreshold = 3
+
+	escalationTimeout = 30 * time.Second
+)
+
+// FailureEscalator is informed when a reconciler keeps failing, and when it recovers afterwards.
+type FailureEscalator interface {
+	NotifyReconciliationFailing(ctx context.Context, failure notifier.ReconciliationFailure) error
+	NotifyReconciliationRecovered(ctx context.Context, failure notifier.ReconciliationFailure) error
+}
+
+// EscalateFailures returns a reconciler which counts the consecutive failures of reconciler. When they reach
+// threshold, the escalators are informed once, and again when a run succeeds afterwards. The consecutive failures are
+// exported as metric regardless of escalators. When threshold is 0, DefaultEscalationThreshold applies.
+func EscalateFailures(name string, reconciler Reconciler, threshold int, escalators ...FailureEscalator) Reconciler {
+	if threshold <= 0 {
+		threshold = DefaultEscalationThreshold
+	}
+	reportConsecutiveFailures(name, 0)
+	return &escalatingReconciler{
+		name:       name,
+		reconciler: reconciler,
+		threshold:  threshold,
+		escalators: escalators,
+		nowFunc:    time.Now,
+	}
+}
+
+type escalatingReconciler struct {
+	name       string
+	reconciler Reconciler
+	threshold  int
+	escalators []FailureEscalator
+	nowFunc    func() time.Time
+
+	mu        sync.Mutex
+	failure   notifier.ReconciliationFailure
+	escalated bool
+}
+
+func (r *escalatingReconciler) Reconcile() error {
+	err := r.reconciler.Reconcile()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err == nil {
+		if r.escalated {
+			log.WithField("reconciler", r.name).WithField("consecutive_failures", r.failure.ConsecutiveFailures).Info("Reconciliation recovered.")
+			r.notify(func(ctx context.Context, escalator FailureEscalator) error {
+				return escalator.NotifyReconciliationRecovered(ctx, r.failure)
+			})
+		}
+		r.failure = notifier.ReconciliationFailure{}
+		r.escalated = false
+		reportConsecutiveFailures(r.name, 0)
+		return nil
+	}
+
+	now := r.nowFunc()
+	if r.failure.ConsecutiveFailures == 0 {
+		r.failure.FailingSince = now
+	}
+	r.failure.Reconciler = r.name
+	r.failure.ConsecutiveFailures++
+	r.failure.LastError = err.Error()
+	r.failure.LastFailureAt = now
+	reportConsecutiveFailures(r.name, r.failure.ConsecutiveFailures)
+
+	if r.failure.ConsecutiveFailures >= r.threshold && !r.escalated {
+		r.escalated = true
+		reportEscalation(r.name)
+		log.WithError(err).
+			WithField("reconciler", r.name).
+			WithField("consecutive_failures", r.failure.ConsecutiveFailures).
+			WithField("failing_since", r.failure.FailingSince).
+			Error("Reconciliation keeps failing, escalating.")
+		r.notify(func(ctx context.Context, escalator FailureEscalator) error {
+			return escalator.NotifyReconciliationFailing(ctx, r.failure)
+		})
+	}
+	return err
+}
+
+// notify informs every escalator. Failures are logged, such that one unavailable escalator does not keep the others
+// from being informed.
+func (r *escalatingReconciler) notify(fn func(ctx context.Context, escalator FailureEscalator) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), escalationTimeout)
+	defer cancel()
+
+	for _, escalator := range r.escalators {
+		err := fn(ctx, escalator)
+		if err != nil {
+			log.WithError(err).WithField("reconciler", r.name).Error("Failed to escalate reconciliation failures.")
+		}
+	}
+}
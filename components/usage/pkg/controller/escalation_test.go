@@ -0,0 +1,95 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/notifier"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingEscalator struct {
+	failing   []notifier.ReconciliationFailure
+	recovered []notifier.ReconciliationFailure
+	err       error
+}
+
+func (e *recordingEscalator) NotifyReconciliationFailing(ctx context.Context, failure notifier.ReconciliationFailure) error {
+	e.failing = append(e.failing, failure)
+	return e.err
+}
+
+func (e *recordingEscalator) NotifyReconciliationRecovered(ctx context.Context, failure notifier.ReconciliationFailure) error {
+	e.recovered = append(e.recovered, failure)
+	return e.err
+}
+
+func TestEscalateFailures(t *testing.T) {
+	start := time.Date(2022, 10, 7, 12, 0, 0, 0, time.UTC)
+	now := start
+
+	var runErr error
+	escalator := &recordingEscalator{}
+	// A failing escalator does not keep the others from being informed.
+	broken := &recordingEscalator{err: errors.New("unavailable")}
+	reconciler := EscalateFailures("test_escalation", ReconcilerFunc(func() error {
+		return runErr
+	}), 3, broken, escalator).(*escalatingReconciler)
+	reconciler.nowFunc = func() time.Time { return now }
+
+	run := func(err error) {
+		runErr = err
+		now = now.Add(time.Hour)
+		require.Equal(t, err, reconciler.Reconcile())
+	}
+
+	run(errors.New("first"))
+	run(errors.New("second"))
+	require.Empty(t, escalator.failing, "must not escalate below the threshold")
+	require.Equal(t, float64(2), testutil.ToFloat64(reconcileConsecutiveFailures.WithLabelValues("test_escalation")))
+
+	run(errors.New("third"))
+	require.Equal(t, []notifier.ReconciliationFailure{{
+		Reconciler:          "test_escalation",
+		ConsecutiveFailures: 3,
+		LastError:           "third",
+		FailingSince:        start.Add(time.Hour),
+		LastFailureAt:       start.Add(3 * time.Hour),
+	}}, escalator.failing)
+	require.Len(t, broken.failing, 1)
+	require.Equal(t, float64(1), testutil.ToFloat64(reconcileEscalationsTotal.WithLabelValues("test_escalation")))
+
+	run(errors.New("fourth"))
+	require.Len(t, escalator.failing, 1, "must escalate once per outage")
+	require.Equal(t, float64(4), testutil.ToFloat64(reconcileConsecutiveFailures.WithLabelValues("test_escalation")))
+
+	run(nil)
+	require.Len(t, escalator.recovered, 1)
+	require.Equal(t, 4, escalator.recovered[0].ConsecutiveFailures)
+	require.Equal(t, "fourth", escalator.recovered[0].LastError)
+	require.Equal(t, float64(0), testutil.ToFloat64(reconcileConsecutiveFailures.WithLabelValues("test_escalation")))
+
+	run(errors.New("again"))
+	run(nil)
+	require.Len(t, escalator.failing, 1, "must not escalate failures below the threshold after recovering")
+	require.Len(t, escalator.recovered, 1, "must only report recoveries of escalated failures")
+}
+
+func TestEscalateFailures_DefaultThreshold(t *testing.T) {
+	escalator := &recordingEscalator{}
+	reconciler := EscalateFailures("test_default_threshold", ReconcilerFunc(func() error {
+		return errors.New("failed")
+	}), 0, escalator)
+
+	for i := 0; i < DefaultEscalationThreshold; i++ {
+		require.Error(t, reconciler.Reconcile())
+	}
+	require.Len(t, escalator.failing, 1)
+}
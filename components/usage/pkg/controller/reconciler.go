@@ -7,8 +7,9 @@ package controller
 import (
 	"context"
 	"fmt"
-	"github.com/gitpod-io/gitpod/common-go/log"
+	"github.com/gitpod-io/gitpod/common-go/tracing"
 	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/gitpod-io/gitpod/usage/pkg/requestid"
 	"google.golang.org/protobuf/types/known/timestamppb"
 	"time"
 )
@@ -23,6 +24,8 @@ func (f ReconcilerFunc) Reconcile() error {
 	return f()
 }
 
+// NewUsageAndBillingReconciler constructs a reconciler which generates usage reports and updates invoices. When
+// billingClient is nil, billing is disabled and only usage reports are generated.
 func NewUsageAndBillingReconciler(usageClient v1.UsageServiceClient, billingClient v1.BillingServiceClient) *UsageAndBillingReconciler {
 	return &UsageAndBillingReconciler{
 		nowFunc:       time.Now,
@@ -39,7 +42,8 @@ type UsageAndBillingReconciler struct {
 }
 
 func (r *UsageAndBillingReconciler) Reconcile() (err error) {
-	ctx := context.Background()
+	span, ctx := tracing.FromContext(requestid.WithNew(context.Background()), "UsageAndBillingReconciler.Reconcile")
+	defer tracing.FinishSpan(span, &err)
 	now := r.nowFunc().UTC()
 
 	reportUsageReconcileStarted()
@@ -60,6 +64,10 @@ func (r *UsageAndBillingReconciler) Reconcile() (err error) {
 
 	reportID := usageResp.GetReportId()
 
+	if r.billingClient == nil {
+		return nil
+	}
+
 	_, err = r.billingClient.UpdateInvoices(ctx, &v1.UpdateInvoicesRequest{
 		StartTime: timestamppb.New(startOfCurrentMonth),
 		EndTime:   timestamppb.New(startOfNextMonth),
@@ -72,28 +80,38 @@ func (r *UsageAndBillingReconciler) Reconcile() (err error) {
 	return nil
 }
 
-func NewLedgerReconciler(usageClient v1.UsageServiceClient) *LedgerReconciler {
+// NewLedgerReconciler constructs a reconciler which records usage in the ledger and pushes it to Stripe. When
+// billingClient is nil, billing is disabled and usage is only recorded in the ledger.
+func NewLedgerReconciler(usageClient v1.UsageServiceClient, billingClient v1.BillingServiceClient) *LedgerReconciler {
 	return &LedgerReconciler{
-		usageClient: usageClient,
+		nowFunc:       time.Now,
+		usageClient:   usageClient,
+		billingClient: billingClient,
 	}
 }
 
+// LedgerReconciler reconciles workspace instances into the usage ledger, and pushes the finalized usage of the
+// current month to Stripe.
 type LedgerReconciler struct {
-	usageClient v1.UsageServiceClient
+	nowFunc func() time.Time
+
+	usageClient   v1.UsageServiceClient
+	billingClient v1.BillingServiceClient
 }
 
-func (r *LedgerReconciler) Reconcile() error {
-	ctx := context.Background()
+func (r *LedgerReconciler) Reconcile() (err error) {
+	span, ctx := tracing.FromContext(requestid.WithNew(context.Background()), "LedgerReconciler.Reconcile")
+	defer tracing.FinishSpan(span, &err)
 
-	now := time.Now().UTC()
+	now := r.nowFunc().UTC()
 	hourAgo := now.Add(-1 * time.Hour)
 
-	logger := log.
+	logger := requestid.Log(ctx).
 		WithField("from", hourAgo).
 		WithField("to", now)
 
 	logger.Info("Starting ledger reconciliation.")
-	_, err := r.usageClient.ReconcileUsageWithLedger(ctx, &v1.ReconcileUsageWithLedgerRequest{
+	_, err = r.usageClient.ReconcileUsageWithLedger(ctx, &v1.ReconcileUsageWithLedgerRequest{
 		From: timestamppb.New(hourAgo),
 		To:   timestamppb.New(now),
 	})
@@ -101,6 +119,379 @@ func (r *LedgerReconciler) Reconcile() error {
 		logger.WithError(err).Errorf("Failed to reconcile usage with ledger.")
 		return fmt.Errorf("failed to reconcile usage with ledger: %w", err)
 	}
+	reportLedgerReconciled(r.nowFunc())
+
+	if r.billingClient == nil {
+		return nil
+	}
+
+	startOfCurrentMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	startOfNextMonth := startOfCurrentMonth.AddDate(0, 1, 0)
+
+	_, err = r.billingClient.ReconcileInvoices(ctx, &v1.ReconcileInvoicesRequest{
+		From: timestamppb.New(startOfCurrentMonth),
+		To:   timestamppb.New(startOfNextMonth),
+	})
+	if err != nil {
+		logger.WithError(err).Errorf("Failed to reconcile invoices.")
+		return fmt.Errorf("failed to reconcile invoices: %w", err)
+	}
+
+	return nil
+}
+
+func NewInvoiceLedgerReconciler(billingClient v1.BillingServiceClient, lookback time.Duration) *InvoiceLedgerReconciler {
+	return &InvoiceLedgerReconciler{
+		nowFunc:       time.Now,
+		billingClient: billingClient,
+		lookback:      lookback,
+	}
+}
+
+// InvoiceLedgerReconciler ensures that the invoices finalized within the lookback period are credited in the ledger,
+// such that missed Stripe webhook deliveries do not leave the ledger drifting from Stripe.
+type InvoiceLedgerReconciler struct {
+	nowFunc func() time.Time
+
+	billingClient v1.BillingServiceClient
+	lookback      time.Duration
+}
+
+func (r *InvoiceLedgerReconciler) Reconcile() (err error) {
+	span, ctx := tracing.FromContext(requestid.WithNew(context.Background()), "InvoiceLedgerReconciler.Reconcile")
+	defer tracing.FinishSpan(span, &err)
+
+	now := r.nowFunc().UTC()
+	from := now.Add(-r.lookback)
+
+	logger := requestid.Log(ctx).
+		WithField("from", from).
+		WithField("to", now)
+
+	logger.Info("Starting invoice ledger reconciliation.")
+	resp, err := r.billingClient.ReconcileLedgerWithInvoices(ctx, &v1.ReconcileLedgerWithInvoicesRequest{
+		From: timestamppb.New(from),
+		To:   timestamppb.New(now),
+	})
+	if err != nil {
+		logger.WithError(err).Errorf("Failed to reconcile ledger with invoices.")
+		return fmt.Errorf("failed to reconcile ledger with invoices: %w", err)
+	}
+
+	reportInvoiceLedgerReconciled(len(resp.GetCreatedInvoiceIds()), len(resp.GetMismatches()))
+	if len(resp.GetMismatches()) > 0 {
+		logger.WithField("mismatches", len(resp.GetMismatches())).Error("Ledger does not match finalized invoices.")
+	}
+
+	return nil
+}
+
+func NewBillingDriftReconciler(billingClient v1.BillingServiceClient) *BillingDriftReconciler {
+	return &BillingDriftReconciler{
+		nowFunc:       time.Now,
+		billingClient: billingClient,
+	}
+}
+
+// BillingDriftReconciler compares the usage of the current month in the ledger with the usage reported to Stripe, and
+// reports the teams whose usage drifted apart. Drift is not corrected, the next ReconcileInvoices sets the usage again.
+type BillingDriftReconciler struct {
+	nowFunc       func() time.Time
+	billingClient v1.BillingServiceClient
+}
+
+func (r *BillingDriftReconciler) Reconcile() (err error) {
+	span, ctx := tracing.FromContext(requestid.WithNew(context.Background()), "BillingDriftReconciler.Reconcile")
+	defer tracing.FinishSpan(span, &err)
+
+	now := r.nowFunc().UTC()
+	startOfCurrentMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	startOfNextMonth := startOfCurrentMonth.AddDate(0, 1, 0)
+
+	logger := requestid.Log(ctx).
+		WithField("from", startOfCurrentMonth).
+		WithField("to", startOfNextMonth)
+
+	resp, err := r.billingClient.ListBillingDrift(ctx, &v1.ListBillingDriftRequest{
+		From: timestamppb.New(startOfCurrentMonth),
+		To:   timestamppb.New(startOfNextMonth),
+	})
+	if err != nil {
+		logger.WithError(err).Errorf("Failed to list billing drift.")
+		return fmt.Errorf("failed to list billing drift: %w", err)
+	}
+
+	reportBillingDrift(resp.GetMismatches())
+	if len(resp.GetMismatches()) > 0 {
+		logger.
+			WithField("checked", resp.GetCheckedAttributionIds()).
+			WithField("mismatches", len(resp.GetMismatches())).
+			Error("Usage reported to Stripe does not match the ledger.")
+	}
+
+	return nil
+}
+
+func NewJanitorReconciler(usageClient v1.UsageServiceClient, staleDraftAge time.Duration) *JanitorReconciler {
+	return &JanitorReconciler{
+		nowFunc:       time.Now,
+		usageClient:   usageClient,
+		staleDraftAge: staleDraftAge,
+	}
+}
+
+// JanitorReconciler expires the unused remainder of credit grants once they expired, finalizes draft usage older
+// than staleDraftAge whose workspace instances are gone, and purges data older than the retention policy allows.
+type JanitorReconciler struct {
+	nowFunc       func() time.Time
+	usageClient   v1.UsageServiceClient
+	staleDraftAge time.Duration
+}
+
+func (r *JanitorReconciler) Reconcile() (err error) {
+	span, ctx := tracing.FromContext(requestid.WithNew(context.Background()), "JanitorReconciler.Reconcile")
+	defer tracing.FinishSpan(span, &err)
+
+	resp, err := r.usageClient.RunJanitor(ctx, &v1.RunJanitorRequest{
+		DraftsBefore: timestamppb.New(r.nowFunc().Add(-r.staleDraftAge)),
+	})
+	if err != nil {
+		requestid.Log(ctx).WithError(err).Errorf("Failed to run janitor.")
+		return fmt.Errorf("failed to run janitor: %w", err)
+	}
+
+	reportJanitorRun(resp)
+	if resp.GetExpiredCredits() > 0 {
+		requestid.Log(ctx).WithField("expired_credits", resp.GetExpiredCredits()).Info("Expired unused credits of credit grants.")
+	}
+	if len(resp.GetClosedDraftIds()) > 0 {
+		requestid.Log(ctx).WithField("closed_drafts", len(resp.GetClosedDraftIds())).Info("Finalized stale draft usage.")
+	}
+	if resp.GetPurgedSessions() > 0 || resp.GetPurgedLedgerEntries() > 0 || resp.GetPurgedReportJobs() > 0 {
+		requestid.Log(ctx).
+			WithField("sessions", resp.GetPurgedSessions()).
+			WithField("ledger_entries", resp.GetPurgedLedgerEntries()).
+			WithField("report_jobs", resp.GetPurgedReportJobs()).
+			Info("Purged data older than its retention period.")
+	}
+
+	return nil
+}
+
+func NewUsageWebhookReconciler(usageClient v1.UsageServiceClient) *UsageWebhookReconciler {
+	return &UsageWebhookReconciler{
+		usageClient: usageClient,
+	}
+}
+
+// UsageWebhookReconciler delivers the events which are due to the usage webhooks of attribution IDs. Failed deliveries
+// are retried by later runs.
+type UsageWebhookReconciler struct {
+	usageClient v1.UsageServiceClient
+}
+
+func (r *UsageWebhookReconciler) Reconcile() (err error) {
+	span, ctx := tracing.FromContext(requestid.WithNew(context.Background()), "UsageWebhookReconciler.Reconcile")
+	defer tracing.FinishSpan(span, &err)
+
+	resp, err := r.usageClient.DeliverUsageWebhooks(ctx, &v1.DeliverUsageWebhooksRequest{})
+	if err != nil {
+		requestid.Log(ctx).WithError(err).Errorf("Failed to deliver usage webhooks.")
+		return fmt.Errorf("failed to deliver usage webhooks: %w", err)
+	}
+
+	reportUsageWebhookDeliveries(resp)
+	if resp.GetFailed() > 0 || resp.GetGivenUp() > 0 {
+		requestid.Log(ctx).
+			WithField("delivered", resp.GetDelivered()).
+			WithField("failed", resp.GetFailed()).
+			WithField("given_up", resp.GetGivenUp()).
+			Warn("Failed to deliver some usage webhooks.")
+	}
+
+	return nil
+}
+
+func NewUsageSummaryWebhookReconciler(usageClient v1.UsageServiceClient) *UsageSummaryWebhookReconciler {
+	return &UsageSummaryWebhookReconciler{
+		nowFunc:     time.Now,
+		usageClient: usageClient,
+	}
+}
+
+// UsageSummaryWebhookReconciler schedules the delivery of the usage summary of the previous day to the usage webhooks.
+type UsageSummaryWebhookReconciler struct {
+	nowFunc     func() time.Time
+	usageClient v1.UsageServiceClient
+}
+
+func (r *UsageSummaryWebhookReconciler) Reconcile() (err error) {
+	span, ctx := tracing.FromContext(requestid.WithNew(context.Background()), "UsageSummaryWebhookReconciler.Reconcile")
+	defer tracing.FinishSpan(span, &err)
+
+	day := r.nowFunc().UTC().AddDate(0, 0, -1)
+	resp, err := r.usageClient.EnqueueUsageWebhookSummaries(ctx, &v1.EnqueueUsageWebhookSummariesRequest{
+		Day: timestamppb.New(day),
+	})
+	if err != nil {
+		requestid.Log(ctx).WithError(err).Errorf("Failed to enqueue usage summaries.")
+		return fmt.Errorf("failed to enqueue usage summaries: %w", err)
+	}
+
+	requestid.Log(ctx).WithField("day", day.Format("2006-01-02")).WithField("enqueued", resp.GetEnqueued()).Info("Enqueued usage summaries for usage webhooks.")
+	return nil
+}
+
+func NewUsageExportReconciler(usageClient v1.UsageServiceClient) *UsageExportReconciler {
+	return &UsageExportReconciler{
+		nowFunc:     time.Now,
+		usageClient: usageClient,
+	}
+}
+
+// usageExportCatchUpDays is how many days UsageExportReconciler looks back for days which failed to export.
+const usageExportCatchUpDays = 7
+
+// UsageExportReconciler exports the usage of the previous day to the configured analytics stores, and catches up on the
+// days before which failed to export.
+type UsageExportReconciler struct {
+	nowFunc     func() time.Time
+	usageClient v1.UsageServiceClient
+}
+
+func (r *UsageExportReconciler) Reconcile() (err error) {
+	span, ctx := tracing.FromContext(requestid.WithNew(context.Background()), "UsageExportReconciler.Reconcile")
+	defer tracing.FinishSpan(span, &err)
+
+	now := r.nowFunc().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	from := today.AddDate(0, 0, -usageExportCatchUpDays)
+	resp, err := r.usageClient.ExportUsage(ctx, &v1.ExportUsageRequest{
+		From:         timestamppb.New(from),
+		To:           timestamppb.New(today),
+		SkipExported: true,
+	})
+	if err != nil {
+		requestid.Log(ctx).WithError(err).Errorf("Failed to export usage.")
+		return fmt.Errorf("failed to export usage: %w", err)
+	}
+
+	usageExportedTotal.Add(float64(resp.GetExported()))
+	requestid.Log(ctx).WithField("days", resp.GetDays()).WithField("exported", resp.GetExported()).Info("Exported usage.")
+	return nil
+}
+
+func NewFreeTierReconciler(usageClient v1.UsageServiceClient, freeTierCredits float64) *FreeTierReconciler {
+	return &FreeTierReconciler{
+		usageClient:     usageClient,
+		freeTierCredits: freeTierCredits,
+	}
+}
+
+// FreeTierReconciler starts the next billing period of cost centers whose billing period ended, granting them the
+// free tier credits of the new period.
+type FreeTierReconciler struct {
+	usageClient     v1.UsageServiceClient
+	freeTierCredits float64
+}
+
+func (r *FreeTierReconciler) Reconcile() (err error) {
+	span, ctx := tracing.FromContext(requestid.WithNew(context.Background()), "FreeTierReconciler.Reconcile")
+	defer tracing.FinishSpan(span, &err)
+
+	resp, err := r.usageClient.ResetFreeTier(ctx, &v1.ResetFreeTierRequest{
+		FreeTierCredits: r.freeTierCredits,
+	})
+	if err != nil {
+		requestid.Log(ctx).WithError(err).Errorf("Failed to reset free tier.")
+		return fmt.Errorf("failed to reset free tier: %w", err)
+	}
+	if len(resp.GetResetAttributionIds()) > 0 {
+		requestid.Log(ctx).WithField("cost_centers", len(resp.GetResetAttributionIds())).Info("Started new billing periods.")
+	}
+
+	return nil
+}
+
+func NewCachedBalanceReconciler(usageClient v1.UsageServiceClient) *CachedBalanceReconciler {
+	return &CachedBalanceReconciler{
+		usageClient: usageClient,
+	}
+}
+
+// CachedBalanceReconciler checks that the cached balances match the ledger. Mismatches indicate ledger writes which
+// did not invalidate the cached balance, and are invalidated by the check.
+type CachedBalanceReconciler struct {
+	usageClient v1.UsageServiceClient
+}
+
+func (r *CachedBalanceReconciler) Reconcile() (err error) {
+	span, ctx := tracing.FromContext(requestid.WithNew(context.Background()), "CachedBalanceReconciler.Reconcile")
+	defer tracing.FinishSpan(span, &err)
+
+	resp, err := r.usageClient.CheckCachedBalances(ctx, &v1.CheckCachedBalancesRequest{})
+	if err != nil {
+		requestid.Log(ctx).WithError(err).Errorf("Failed to check cached balances.")
+		return fmt.Errorf("failed to check cached balances: %w", err)
+	}
+	reportCachedBalancesChecked(len(resp.GetMismatchedAttributionIds()))
+	if len(resp.GetMismatchedAttributionIds()) > 0 {
+		requestid.Log(ctx).
+			WithField("checked", resp.GetChecked()).
+			WithField("mismatched_attribution_ids", resp.GetMismatchedAttributionIds()).
+			Warn("Cached balances did not match the ledger.")
+	}
+
+	return nil
+}
+
+type ReportNotifier interface {
+	NotifyUsageReport(ctx context.Context, reportID string) error
+}
+
+func NewMonthlyReportReconciler(usageClient v1.UsageServiceClient, notifier ReportNotifier) *MonthlyReportReconciler {
+	return &MonthlyReportReconciler{
+		nowFunc:     time.Now,
+		usageClient: usageClient,
+		notifier:    notifier,
+	}
+}
+
+// MonthlyReportReconciler generates the usage report for the previous month and delivers it to billing contacts.
+// It is intended to run on a monthly schedule, shortly after the start of the month.
+type MonthlyReportReconciler struct {
+	nowFunc func() time.Time
+
+	usageClient v1.UsageServiceClient
+	notifier    ReportNotifier
+}
+
+func (r *MonthlyReportReconciler) Reconcile() (err error) {
+	span, ctx := tracing.FromContext(requestid.WithNew(context.Background()), "MonthlyReportReconciler.Reconcile")
+	defer tracing.FinishSpan(span, &err)
+	now := r.nowFunc().UTC()
+
+	startOfCurrentMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	startOfPreviousMonth := startOfCurrentMonth.AddDate(0, -1, 0)
+
+	logger := requestid.Log(ctx).
+		WithField("from", startOfPreviousMonth).
+		WithField("to", startOfCurrentMonth)
+
+	logger.Info("Generating monthly usage report.")
+	usageResp, err := r.usageClient.ReconcileUsage(ctx, &v1.ReconcileUsageRequest{
+		StartTime: timestamppb.New(startOfPreviousMonth),
+		EndTime:   timestamppb.New(startOfCurrentMonth),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to generate monthly usage report: %w", err)
+	}
+
+	err = r.notifier.NotifyUsageReport(ctx, usageResp.GetReportId())
+	if err != nil {
+		logger.WithError(err).Error("Failed to deliver monthly usage report.")
+		return fmt.Errorf("failed to deliver monthly usage report: %w", err)
+	}
 
 	return nil
 }
@@ -0,0 +1,177 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+type fakeUsageClient struct {
+	v1.UsageServiceClient
+
+	reconciledUsage  int
+	reconciledLedger int
+	janitorRuns      int
+	draftsBefore     time.Time
+	freeTierCredits  float64
+	checkedBalances  int
+	webhookRuns      int
+	summarizedDay    time.Time
+	exportFrom       time.Time
+	exportTo         time.Time
+	skipExported     bool
+}
+
+func (c *fakeUsageClient) ReconcileUsage(context.Context, *v1.ReconcileUsageRequest, ...grpc.CallOption) (*v1.ReconcileUsageResponse, error) {
+	c.reconciledUsage++
+	return &v1.ReconcileUsageResponse{ReportId: "report"}, nil
+}
+
+func (c *fakeUsageClient) ReconcileUsageWithLedger(context.Context, *v1.ReconcileUsageWithLedgerRequest, ...grpc.CallOption) (*v1.ReconcileUsageWithLedgerResponse, error) {
+	c.reconciledLedger++
+	return &v1.ReconcileUsageWithLedgerResponse{}, nil
+}
+
+func (c *fakeUsageClient) RunJanitor(_ context.Context, in *v1.RunJanitorRequest, _ ...grpc.CallOption) (*v1.RunJanitorResponse, error) {
+	c.janitorRuns++
+	c.draftsBefore = in.GetDraftsBefore().AsTime()
+	return &v1.RunJanitorResponse{ExpiredCredits: 10, ClosedDraftIds: []string{"draft"}}, nil
+}
+
+func (c *fakeUsageClient) ResetFreeTier(_ context.Context, in *v1.ResetFreeTierRequest, _ ...grpc.CallOption) (*v1.ResetFreeTierResponse, error) {
+	c.freeTierCredits = in.GetFreeTierCredits()
+	return &v1.ResetFreeTierResponse{}, nil
+}
+
+func (c *fakeUsageClient) CheckCachedBalances(context.Context, *v1.CheckCachedBalancesRequest, ...grpc.CallOption) (*v1.CheckCachedBalancesResponse, error) {
+	c.checkedBalances++
+	return &v1.CheckCachedBalancesResponse{Checked: 2, MismatchedAttributionIds: []string{"team:123"}}, nil
+}
+
+func (c *fakeUsageClient) DeliverUsageWebhooks(context.Context, *v1.DeliverUsageWebhooksRequest, ...grpc.CallOption) (*v1.DeliverUsageWebhooksResponse, error) {
+	c.webhookRuns++
+	return &v1.DeliverUsageWebhooksResponse{Delivered: 2, Failed: 1}, nil
+}
+
+func (c *fakeUsageClient) EnqueueUsageWebhookSummaries(_ context.Context, in *v1.EnqueueUsageWebhookSummariesRequest, _ ...grpc.CallOption) (*v1.EnqueueUsageWebhookSummariesResponse, error) {
+	c.summarizedDay = in.GetDay().AsTime()
+	return &v1.EnqueueUsageWebhookSummariesResponse{Enqueued: 3}, nil
+}
+
+func (c *fakeUsageClient) ExportUsage(_ context.Context, in *v1.ExportUsageRequest, _ ...grpc.CallOption) (*v1.ExportUsageResponse, error) {
+	c.exportFrom, c.exportTo = in.GetFrom().AsTime(), in.GetTo().AsTime()
+	c.skipExported = in.GetSkipExported()
+	return &v1.ExportUsageResponse{Exported: 42, Days: 1}, nil
+}
+
+func TestFreeTierReconciler(t *testing.T) {
+	usageClient := &fakeUsageClient{}
+
+	require.NoError(t, NewFreeTierReconciler(usageClient, 50).Reconcile())
+	require.Equal(t, float64(50), usageClient.freeTierCredits)
+}
+
+func TestJanitorReconciler(t *testing.T) {
+	usageClient := &fakeUsageClient{}
+	now := time.Date(2022, 9, 30, 12, 0, 0, 0, time.UTC)
+
+	reconciler := NewJanitorReconciler(usageClient, 7*24*time.Hour)
+	reconciler.nowFunc = func() time.Time { return now }
+	require.NoError(t, reconciler.Reconcile())
+	require.Equal(t, 1, usageClient.janitorRuns)
+	require.Equal(t, now.AddDate(0, 0, -7), usageClient.draftsBefore, "must only close drafts older than the stale draft age")
+}
+
+func TestUsageWebhookReconcilers(t *testing.T) {
+	usageClient := &fakeUsageClient{}
+	now := time.Date(2022, 10, 12, 0, 0, 5, 0, time.UTC)
+
+	require.NoError(t, NewUsageWebhookReconciler(usageClient).Reconcile())
+	require.Equal(t, 1, usageClient.webhookRuns)
+
+	reconciler := NewUsageSummaryWebhookReconciler(usageClient)
+	reconciler.nowFunc = func() time.Time { return now }
+	require.NoError(t, reconciler.Reconcile())
+	require.Equal(t, "2022-10-11", usageClient.summarizedDay.Format("2006-01-02"), "must summarize the previous day")
+}
+
+func TestUsageExportReconciler(t *testing.T) {
+	usageClient := &fakeUsageClient{}
+	now := time.Date(2022, 10, 12, 0, 0, 5, 0, time.UTC)
+
+	reconciler := NewUsageExportReconciler(usageClient)
+	reconciler.nowFunc = func() time.Time { return now }
+	require.NoError(t, reconciler.Reconcile())
+	require.Equal(t, time.Date(2022, 10, 5, 0, 0, 0, 0, time.UTC), usageClient.exportFrom, "must catch up on the previous week")
+	require.Equal(t, time.Date(2022, 10, 12, 0, 0, 0, 0, time.UTC), usageClient.exportTo, "must export up to the previous day")
+	require.True(t, usageClient.skipExported, "must not export days again")
+	require.Equal(t, float64(42), testutil.ToFloat64(usageExportedTotal))
+}
+
+func TestCachedBalanceReconciler(t *testing.T) {
+	usageClient := &fakeUsageClient{}
+
+	require.NoError(t, NewCachedBalanceReconciler(usageClient).Reconcile())
+	require.Equal(t, 1, usageClient.checkedBalances)
+}
+
+func TestReconcilers_WithBillingDisabled(t *testing.T) {
+	usageClient := &fakeUsageClient{}
+
+	require.NoError(t, NewUsageAndBillingReconciler(usageClient, nil).Reconcile())
+	require.Equal(t, 1, usageClient.reconciledUsage, "must generate the usage report")
+
+	require.NoError(t, NewLedgerReconciler(usageClient, nil).Reconcile())
+	require.Equal(t, 1, usageClient.reconciledLedger, "must reconcile usage with the ledger")
+}
+
+func TestLedgerReconciler_ReportsLag(t *testing.T) {
+	usageClient := &fakeUsageClient{}
+	now := time.Date(2022, 10, 7, 12, 0, 0, 0, time.UTC)
+
+	reconciler := NewLedgerReconciler(usageClient, nil)
+	reconciler.nowFunc = func() time.Time { return now }
+	require.NoError(t, reconciler.Reconcile())
+	require.Equal(t, 5*time.Minute, ledgerReconcileLag(now.Add(5*time.Minute)))
+}
+
+type fakeBillingClient struct {
+	v1.BillingServiceClient
+
+	driftFrom, driftTo time.Time
+}
+
+func (c *fakeBillingClient) ListBillingDrift(_ context.Context, in *v1.ListBillingDriftRequest, _ ...grpc.CallOption) (*v1.ListBillingDriftResponse, error) {
+	c.driftFrom, c.driftTo = in.GetFrom().AsTime(), in.GetTo().AsTime()
+	return &v1.ListBillingDriftResponse{
+		CheckedAttributionIds: 3,
+		Mismatches: []*v1.BillingDrift{
+			{AttributionId: "team:a", LedgerCredits: 250, ReportedCredits: 200},
+			{AttributionId: "team:b", LedgerCredits: 100, ReportedCredits: 120},
+		},
+	}, nil
+}
+
+func TestBillingDriftReconciler(t *testing.T) {
+	billingClient := &fakeBillingClient{}
+	now := time.Date(2022, 10, 14, 12, 0, 0, 0, time.UTC)
+
+	reconciler := NewBillingDriftReconciler(billingClient)
+	reconciler.nowFunc = func() time.Time { return now }
+	require.NoError(t, reconciler.Reconcile())
+	require.Equal(t, time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC), billingClient.driftFrom)
+	require.Equal(t, time.Date(2022, 11, 1, 0, 0, 0, 0, time.UTC), billingClient.driftTo)
+
+	require.Equal(t, float64(2), testutil.ToFloat64(billingDriftMismatches))
+	require.Equal(t, float64(50), testutil.ToFloat64(billingDriftCredits.WithLabelValues("under_reported")))
+	require.Equal(t, float64(20), testutil.ToFloat64(billingDriftCredits.WithLabelValues("over_reported")))
+}
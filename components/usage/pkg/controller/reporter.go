@@ -6,7 +6,9 @@ package controller
 
 import (
 	"fmt"
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
 	"github.com/prometheus/client_golang/prometheus"
+	"sync/atomic"
 	"time"
 )
 
@@ -16,6 +18,10 @@ const (
 )
 
 var (
+	// lastLedgerReconcileSuccess is the time of the last successful ledger reconciliation, in unix nanoseconds. Until a
+	// ledger reconciliation succeeds, it is the time the process started, such that the lag grows when none succeeds.
+	lastLedgerReconcileSuccess = time.Now().UnixNano()
+
 	reconcileStartedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Namespace: namespace,
 		Subsystem: subsystem,
@@ -30,12 +36,118 @@ var (
 		Help:      "Histogram of reconcile duration",
 		Buckets:   prometheus.LinearBuckets(30, 30, 10), // every 30 secs, starting at 30secs
 	}, []string{"outcome"})
+
+	invoiceLedgerMismatches = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "invoice_ledger_mismatches",
+		Help:      "Number of finalized invoices whose ledger entry did not match the invoice in the last invoice ledger reconciliation",
+	})
+
+	invoiceLedgerCreatedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "invoice_ledger_created_total",
+		Help:      "Number of finalized invoices which were missing in the ledger, and were credited by the invoice ledger reconciliation",
+	})
+
+	billingDriftMismatches = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "billing_drift_mismatches",
+		Help:      "Number of teams whose usage reported to Stripe did not match the ledger in the last billing drift check",
+	})
+
+	billingDriftCredits = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "billing_drift_credits",
+		Help:      "Credits by which the usage reported to Stripe differed from the ledger in the last billing drift check, summed over all teams. Under-reported usage is not billed, over-reported usage is billed in excess",
+	}, []string{"direction"})
+
+	cachedBalanceMismatches = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "cached_balance_mismatches",
+		Help:      "Number of cached balances which did not match the ledger in the last cached balance check",
+	})
+
+	janitorExpiredCreditsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "janitor_expired_credits_total",
+		Help:      "Unused credits of expired credit grants which were expired by the janitor",
+	})
+
+	janitorClosedDraftsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "janitor_closed_drafts_total",
+		Help:      "Number of stale draft usage entries whose workspace instances were gone, and which were finalized by the janitor",
+	})
+
+	janitorPurgedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "janitor_purged_total",
+		Help:      "Number of rows which were older than their retention period, and which were deleted by the janitor, by kind of data",
+	}, []string{"data"})
+
+	usageWebhookDeliveriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "usage_webhook_deliveries_total",
+		Help:      "Number of attempts to deliver events to usage webhooks, by outcome. Failed deliveries are retried, given up deliveries are not",
+	}, []string{"outcome"})
+
+	usageExportedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "usage_exported_total",
+		Help:      "Number of usage entries exported to analytics stores",
+	})
+
+	reconcileConsecutiveFailures = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "reconcile_consecutive_failures",
+		Help:      "Number of runs of a reconciler which failed in a row, 0 after a successful run",
+	}, []string{"reconciler"})
+
+	reconcileEscalationsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "reconcile_escalations_total",
+		Help:      "Number of times the consecutive failures of a reconciler reached the escalation threshold",
+	}, []string{"reconciler"})
+
+	ledgerReconcileLagSeconds = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "ledger_reconcile_lag_seconds",
+		Help:      "Seconds since the last successful ledger reconciliation, or since the process started when none succeeded yet",
+	}, func() float64 {
+		return ledgerReconcileLag(time.Now()).Seconds()
+	})
 )
 
 func RegisterMetrics(reg *prometheus.Registry) error {
 	metrics := []prometheus.Collector{
 		reconcileStartedTotal,
 		reconcileStartedDurationSeconds,
+		invoiceLedgerMismatches,
+		invoiceLedgerCreatedTotal,
+		billingDriftMismatches,
+		billingDriftCredits,
+		cachedBalanceMismatches,
+		janitorExpiredCreditsTotal,
+		janitorClosedDraftsTotal,
+		janitorPurgedTotal,
+		usageWebhookDeliveriesTotal,
+		usageExportedTotal,
+		ledgerReconcileLagSeconds,
+		reconcileConsecutiveFailures,
+		reconcileEscalationsTotal,
 	}
 	for _, metric := range metrics {
 		err := reg.Register(metric)
@@ -58,3 +170,57 @@ func reportUsageReconcileFinished(duration time.Duration, err error) {
 	}
 	reconcileStartedDurationSeconds.WithLabelValues(outcome).Observe(duration.Seconds())
 }
+
+func reportInvoiceLedgerReconciled(created, mismatches int) {
+	invoiceLedgerCreatedTotal.Add(float64(created))
+	invoiceLedgerMismatches.Set(float64(mismatches))
+}
+
+func reportBillingDrift(mismatches []*v1.BillingDrift) {
+	var under, over int64
+	for _, mismatch := range mismatches {
+		delta := mismatch.GetLedgerCredits() - mismatch.GetReportedCredits()
+		if delta > 0 {
+			under += delta
+		} else {
+			over -= delta
+		}
+	}
+	billingDriftMismatches.Set(float64(len(mismatches)))
+	billingDriftCredits.WithLabelValues("under_reported").Set(float64(under))
+	billingDriftCredits.WithLabelValues("over_reported").Set(float64(over))
+}
+
+func reportCachedBalancesChecked(mismatches int) {
+	cachedBalanceMismatches.Set(float64(mismatches))
+}
+
+func reportJanitorRun(resp *v1.RunJanitorResponse) {
+	janitorExpiredCreditsTotal.Add(resp.GetExpiredCredits())
+	janitorClosedDraftsTotal.Add(float64(len(resp.GetClosedDraftIds())))
+	janitorPurgedTotal.WithLabelValues("sessions").Add(float64(resp.GetPurgedSessions()))
+	janitorPurgedTotal.WithLabelValues("ledger_entries").Add(float64(resp.GetPurgedLedgerEntries()))
+	janitorPurgedTotal.WithLabelValues("report_jobs").Add(float64(resp.GetPurgedReportJobs()))
+}
+
+func reportUsageWebhookDeliveries(resp *v1.DeliverUsageWebhooksResponse) {
+	usageWebhookDeliveriesTotal.WithLabelValues("delivered").Add(float64(resp.GetDelivered()))
+	usageWebhookDeliveriesTotal.WithLabelValues("failed").Add(float64(resp.GetFailed()))
+	usageWebhookDeliveriesTotal.WithLabelValues("given_up").Add(float64(resp.GetGivenUp()))
+}
+
+func reportLedgerReconciled(t time.Time) {
+	atomic.StoreInt64(&lastLedgerReconcileSuccess, t.UnixNano())
+}
+
+func ledgerReconcileLag(now time.Time) time.Duration {
+	return now.Sub(time.Unix(0, atomic.LoadInt64(&lastLedgerReconcileSuccess)))
+}
+
+func reportConsecutiveFailures(reconciler string, failures int) {
+	reconcileConsecutiveFailures.WithLabelValues(reconciler).Set(float64(failures))
+}
+
+func reportEscalation(reconciler string) {
+	reconcileEscalationsTotal.WithLabelValues(reconciler).Inc()
+}
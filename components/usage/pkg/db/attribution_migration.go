@@ -0,0 +1,88 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AttributionMigration records that Actor re-attributed the usage history of FromAttributionID to ToAttributionID,
+// for example because a user converted their personal account into a team.
+type AttributionMigration struct {
+	ID                uuid.UUID     `gorm:"primary_key;column:id;type:char;size:36;" json:"id"`
+	FromAttributionID AttributionID `gorm:"column:fromAttributionId;type:varchar;size:255;" json:"fromAttributionId"`
+	ToAttributionID   AttributionID `gorm:"column:toAttributionId;type:varchar;size:255;" json:"toAttributionId"`
+	Actor             string        `gorm:"column:actor;type:varchar;size:255;" json:"actor"`
+	Reason            string        `gorm:"column:reason;type:varchar;size:255;" json:"reason"`
+	// UsageEntries and WorkspaceInstanceUsageEntries are the number of entries which were re-attributed.
+	UsageEntries                  int64 `gorm:"column:usageEntries;type:bigint;" json:"usageEntries"`
+	WorkspaceInstanceUsageEntries int64 `gorm:"column:workspaceInstanceUsageEntries;type:bigint;" json:"workspaceInstanceUsageEntries"`
+	// MigrationTime is set by the database when the migration is recorded.
+	MigrationTime time.Time `gorm:"->;column:migrationTime;type:timestamp;default:CURRENT_TIMESTAMP(6);" json:"migrationTime"`
+}
+
+// TableName sets the insert table name for this struct type
+func (m *AttributionMigration) TableName() string {
+	return "d_b_attribution_migration"
+}
+
+// MigrateAttribution re-attributes all usage and workspace instance usage of `from` to `to`, including archived usage,
+// and records the migration in the same transaction. The cached balances and daily usage summaries of both attribution
+// IDs are invalidated.
+//
+// Drafts stay with `from`: they belong to instances which are still running, and are reconciled from the attribution ID
+// of their instance, which is `from` until the instance stops.
+func MigrateAttribution(ctx context.Context, conn *gorm.DB, from, to AttributionID, actor, reason string) (AttributionMigration, error) {
+	migration := AttributionMigration{
+		ID:                uuid.New(),
+		FromAttributionID: from,
+		ToAttributionID:   to,
+		Actor:             actor,
+		Reason:            reason,
+	}
+
+	err := conn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, table := range []string{(&Usage{}).TableName(), UsageArchiveTableName} {
+			result := tx.Table(table).
+				Where("attributionId = ?", from).
+				Where("draft = ?", false).
+				UpdateColumns(map[string]interface{}{
+					"attributionId": to,
+					"version":       gorm.Expr("version + 1"),
+				})
+			if result.Error != nil {
+				return fmt.Errorf("failed to re-attribute usage of %s in %s: %w", from, table, result.Error)
+			}
+			migration.UsageEntries += result.RowsAffected
+		}
+
+		for _, table := range []string{(&WorkspaceInstanceUsage{}).TableName(), WorkspaceInstanceUsageArchiveTableName} {
+			result := tx.Table(table).
+				Where("attributionId = ?", from).
+				UpdateColumn("attributionId", to)
+			if result.Error != nil {
+				return fmt.Errorf("failed to re-attribute workspace instance usage of %s in %s: %w", from, table, result.Error)
+			}
+			migration.WorkspaceInstanceUsageEntries += result.RowsAffected
+		}
+
+		if err := tx.Create(&migration).Error; err != nil {
+			return fmt.Errorf("failed to record attribution migration from %s to %s: %w", from, to, err)
+		}
+		if err := InvalidateUsageDailySummaries(ctx, tx, from, to); err != nil {
+			return err
+		}
+		return InvalidateCachedBalances(ctx, tx, from, to)
+	})
+	if err != nil {
+		return AttributionMigration{}, err
+	}
+	return migration, nil
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/db/dbtest"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrateAttribution(t *testing.T) {
+	conn := dbtest.ConnectInMemoryForTests(t)
+	ctx := context.Background()
+
+	user := db.NewUserAttributionID(uuid.New().String())
+	team := db.NewTeamAttributionID(uuid.New().String())
+	other := db.NewTeamAttributionID(uuid.New().String())
+
+	usage := dbtest.CreateUsageRecords(t, conn,
+		dbtest.NewUsage(t, db.Usage{AttributionID: user}),
+		dbtest.NewUsage(t, db.Usage{AttributionID: user}),
+		dbtest.NewUsage(t, db.Usage{AttributionID: other}),
+		dbtest.NewUsage(t, db.Usage{AttributionID: user, Draft: true}),
+	)
+	instanceUsage := dbtest.CreateWorkspaceInstanceUsageRecords(t, conn,
+		dbtest.NewWorkspaceInstanceUsage(t, db.WorkspaceInstanceUsage{AttributionID: user}),
+		dbtest.NewWorkspaceInstanceUsage(t, db.WorkspaceInstanceUsage{AttributionID: other}),
+	)
+	archivedUsage := dbtest.NewUsage(t, db.Usage{AttributionID: user})
+	require.NoError(t, conn.Table(db.UsageArchiveTableName).Create(&archivedUsage).Error)
+	archivedInstanceUsage := dbtest.NewWorkspaceInstanceUsage(t, db.WorkspaceInstanceUsage{AttributionID: user})
+	require.NoError(t, conn.Table(db.WorkspaceInstanceUsageArchiveTableName).Create(&archivedInstanceUsage).Error)
+	t.Cleanup(func() {
+		require.NoError(t, conn.Table(db.UsageArchiveTableName).Where("id = ?", archivedUsage.ID).Delete(&db.Usage{}).Error)
+		require.NoError(t, conn.Table(db.WorkspaceInstanceUsageArchiveTableName).Where("instanceId = ?", archivedInstanceUsage.InstanceID).Delete(&db.WorkspaceInstanceUsage{}).Error)
+		require.NoError(t, conn.Where("fromAttributionId = ?", user).Delete(&db.AttributionMigration{}).Error)
+		require.NoError(t, conn.Where("attributionId IN ?", []db.AttributionID{user, team, other}).Delete(&db.CachedBalance{}).Error)
+	})
+
+	migration, err := db.MigrateAttribution(ctx, conn, user, team, "user-a", "Converted personal account into a team")
+	require.NoError(t, err)
+	require.EqualValues(t, 3, migration.UsageEntries)
+	require.EqualValues(t, 2, migration.WorkspaceInstanceUsageEntries)
+
+	for i, expected := range []db.AttributionID{team, team, other, user} {
+		entry, err := db.GetUsage(ctx, conn, usage[i].ID)
+		require.NoError(t, err)
+		require.Equal(t, expected, entry.AttributionID)
+	}
+	for i, expected := range []db.AttributionID{team, other} {
+		var entry db.WorkspaceInstanceUsage
+		require.NoError(t, conn.First(&entry, "instanceId = ?", instanceUsage[i].InstanceID).Error)
+		require.Equal(t, expected, entry.AttributionID)
+	}
+
+	var archived db.Usage
+	require.NoError(t, conn.Table(db.UsageArchiveTableName).First(&archived, "id = ?", archivedUsage.ID).Error)
+	require.Equal(t, team, archived.AttributionID, "archived usage must be re-attributed")
+	var archivedInstance db.WorkspaceInstanceUsage
+	require.NoError(t, conn.Table(db.WorkspaceInstanceUsageArchiveTableName).First(&archivedInstance, "instanceId = ?", archivedInstanceUsage.InstanceID).Error)
+	require.Equal(t, team, archivedInstance.AttributionID, "archived workspace instance usage must be re-attributed")
+
+	var recorded db.AttributionMigration
+	require.NoError(t, conn.First(&recorded, "id = ?", migration.ID).Error)
+	require.Equal(t, user, recorded.FromAttributionID)
+	require.Equal(t, team, recorded.ToAttributionID)
+	require.Equal(t, "user-a", recorded.Actor)
+	require.EqualValues(t, 3, recorded.UsageEntries)
+
+	for _, attributionId := range []db.AttributionID{user, team} {
+		cached, err := db.GetCachedBalance(ctx, conn, attributionId)
+		require.NoError(t, err)
+		require.NotEqual(t, cached.Version, cached.ComputedVersion, "cached balance must be invalidated")
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AuditActor_System is the actor of audit events of RPCs called by other components, without a user on whose behalf
+// they act.
+const AuditActor_System = "system"
+
+// AuditEvent records that Actor called a mutating RPC. Before and After summarize the state which the RPC changed, as
+// JSON. Audit events are append-only, they are never updated or deleted.
+type AuditEvent struct {
+	ID            uuid.UUID     `gorm:"primary_key;column:id;type:char;size:36;" json:"id"`
+	RPC           string        `gorm:"column:rpc;type:varchar;size:255;" json:"rpc"`
+	Actor         string        `gorm:"column:actor;type:varchar;size:255;" json:"actor"`
+	AttributionID AttributionID `gorm:"column:attributionId;type:varchar;size:255;" json:"attributionId"`
+	// StatusCode is the gRPC status code the RPC returned, e.g. OK.
+	StatusCode string `gorm:"column:statusCode;type:varchar;size:32;" json:"statusCode"`
+	Request    string `gorm:"column:request;type:text;size:65535;" json:"request"`
+	Before     string `gorm:"column:before;type:text;size:65535;" json:"before"`
+	After      string `gorm:"column:after;type:text;size:65535;" json:"after"`
+	// EventTime is set by the database when the event is recorded.
+	EventTime time.Time `gorm:"->;column:eventTime;type:timestamp;default:CURRENT_TIMESTAMP(6);" json:"eventTime"`
+}
+
+// TableName sets the insert table name for this struct type
+func (e *AuditEvent) TableName() string {
+	return "d_b_usage_audit_event"
+}
+
+// RecordAuditEvent stores the event, with a new ID unless it has one.
+func RecordAuditEvent(ctx context.Context, conn *gorm.DB, event AuditEvent) error {
+	if event.ID.ID() == 0 {
+		event.ID = uuid.New()
+	}
+	result := conn.WithContext(ctx).Create(&event)
+	if result.Error != nil {
+		return fmt.Errorf("failed to record audit event of %s: %w", event.RPC, result.Error)
+	}
+	return nil
+}
+
+// AuditEventFilter selects audit events. Empty fields match all events.
+type AuditEventFilter struct {
+	AttributionID AttributionID
+	RPC           string
+	Actor         string
+	From, To      time.Time
+}
+
+// FindAuditEvents returns the audit events matching the filter, most recent first, and the total number of matching
+// events. All events are returned when limit is 0.
+func FindAuditEvents(ctx context.Context, conn *gorm.DB, filter AuditEventFilter, offset, limit int64) ([]AuditEvent, int64, error) {
+	db := conn.WithContext(ctx).Model(&AuditEvent{})
+	if filter.AttributionID != "" {
+		db = db.Where("attributionId = ?", filter.AttributionID)
+	}
+	if filter.RPC != "" {
+		db = db.Where("rpc = ?", filter.RPC)
+	}
+	if filter.Actor != "" {
+		db = db.Where("actor = ?", filter.Actor)
+	}
+	if !filter.From.IsZero() {
+		db = db.Where("eventTime >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		db = db.Where("eventTime < ?", filter.To)
+	}
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count audit events: %w", err)
+	}
+
+	query := db.Order("eventTime DESC").Order("id ASC")
+	if offset != 0 {
+		query = query.Offset(int(offset))
+	}
+	if limit != 0 {
+		query = query.Limit(int(limit))
+	}
+	var events []AuditEvent
+	if err := query.Find(&events).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to find audit events: %w", err)
+	}
+	return events, total, nil
+}
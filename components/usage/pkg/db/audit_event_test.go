@@ -0,0 +1,60 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/db/dbtest"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindAuditEvents(t *testing.T) {
+	conn := dbtest.ConnectInMemoryForTests(t)
+	ctx := context.Background()
+	attributionID := db.NewTeamAttributionID(uuid.New().String())
+
+	events := []db.AuditEvent{
+		{RPC: "/usage.v1.UsageService/SetSpendingLimit", Actor: "user-a", AttributionID: attributionID, StatusCode: "OK", Before: `{"spendingLimit":100}`, After: `{"spendingLimit":500}`},
+		{RPC: "/usage.v1.UsageService/SetSpendingLimit", Actor: "user-b", AttributionID: attributionID, StatusCode: "NotFound"},
+		{RPC: "/usage.v1.BillingService/VoidUsage", Actor: db.AuditActor_System, AttributionID: attributionID, StatusCode: "OK"},
+		{RPC: "/usage.v1.UsageService/SetSpendingLimit", Actor: "user-a", AttributionID: db.NewUserAttributionID(uuid.New().String()), StatusCode: "OK"},
+	}
+	for _, event := range events {
+		require.NoError(t, db.RecordAuditEvent(ctx, conn, event))
+	}
+
+	found, total, err := db.FindAuditEvents(ctx, conn, db.AuditEventFilter{AttributionID: attributionID}, 0, 0)
+	require.NoError(t, err)
+	require.EqualValues(t, 3, total)
+	require.Len(t, found, 3)
+	for _, event := range found {
+		require.NotEqual(t, uuid.Nil, event.ID)
+		require.False(t, event.EventTime.IsZero(), "event time must be set by the database")
+	}
+
+	found, total, err = db.FindAuditEvents(ctx, conn, db.AuditEventFilter{
+		AttributionID: attributionID,
+		RPC:           "/usage.v1.UsageService/SetSpendingLimit",
+		Actor:         "user-a",
+	}, 0, 0)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, total)
+	require.Equal(t, `{"spendingLimit":100}`, found[0].Before)
+	require.Equal(t, `{"spendingLimit":500}`, found[0].After)
+
+	page, total, err := db.FindAuditEvents(ctx, conn, db.AuditEventFilter{Actor: "user-a"}, 1, 1)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, total)
+	require.Len(t, page, 1)
+
+	_, total, err = db.FindAuditEvents(ctx, conn, db.AuditEventFilter{From: time.Now().Add(time.Hour)}, 0, 0)
+	require.NoError(t, err)
+	require.Zero(t, total)
+}
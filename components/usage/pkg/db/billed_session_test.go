@@ -15,7 +15,7 @@ import (
 )
 
 func TestBilledSession_WriteRead(t *testing.T) {
-	conn := dbtest.ConnectForTests(t)
+	conn := dbtest.ConnectInMemoryForTests(t)
 
 	billedSession := &db.BilledSession{
 		InstanceID: uuid.New(),
@@ -0,0 +1,50 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// BillingStrategyTransition is a snapshot of the balance of a cost center at TransitionTime, when it switched from
+// FromStrategy to ToStrategy. The billing period which started at PeriodStart was closed out at TransitionTime, and
+// the cost center started a fresh billing period.
+type BillingStrategyTransition struct {
+	ID             uuid.UUID       `gorm:"primary_key;column:id;type:char;size:36;" json:"id"`
+	AttributionID  AttributionID   `gorm:"column:attributionId;type:varchar;size:255;" json:"attributionId"`
+	FromStrategy   BillingStrategy `gorm:"column:fromStrategy;type:varchar;size:255;" json:"fromStrategy"`
+	ToStrategy     BillingStrategy `gorm:"column:toStrategy;type:varchar;size:255;" json:"toStrategy"`
+	TransitionTime VarcharTime     `gorm:"column:transitionTime;type:varchar;size:255;" json:"transitionTime"`
+	PeriodStart    VarcharTime     `gorm:"column:periodStart;type:varchar;size:255;" json:"periodStart"`
+	// CreditsUsed is the workspace usage in [PeriodStart, TransitionTime), of which CreditsCovered was paid for with
+	// credit grants.
+	CreditsUsed             CreditCents `gorm:"column:creditsUsed;type:bigint;" json:"creditsUsed"`
+	CreditsCovered          CreditCents `gorm:"column:creditsCovered;type:bigint;" json:"creditsCovered"`
+	CreditsGrantedRemaining CreditCents `gorm:"column:creditsGrantedRemaining;type:bigint;" json:"creditsGrantedRemaining"`
+	// Debt is the debt the cost center carried when it switched. It is not carried into the fresh billing period.
+	Debt CreditCents `gorm:"column:debt;type:bigint;" json:"debt"`
+}
+
+// TableName sets the insert table name for this struct type
+func (t *BillingStrategyTransition) TableName() string {
+	return "d_b_billing_strategy_transition"
+}
+
+// FindBillingStrategyTransitions returns the billing strategy transitions of the attribution ID, ordered by time.
+func FindBillingStrategyTransitions(ctx context.Context, conn *gorm.DB, attributionId AttributionID) ([]BillingStrategyTransition, error) {
+	var transitions []BillingStrategyTransition
+	result := conn.WithContext(ctx).
+		Where("attributionId = ?", attributionId).
+		Order("transitionTime ASC").
+		Find(&transitions)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to find billing strategy transitions of %s: %w", attributionId, result.Error)
+	}
+	return transitions, nil
+}
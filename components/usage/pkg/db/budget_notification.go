@@ -0,0 +1,40 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// BudgetNotification records that an attribution ID was notified about reaching a percentage of its spending limit
+// within a billing period, such that every threshold is notified at most once per billing period.
+type BudgetNotification struct {
+	AttributionID      AttributionID `gorm:"primary_key;column:attributionId;type:varchar;size:255;" json:"attributionId"`
+	BillingPeriodStart VarcharTime   `gorm:"primary_key;column:billingPeriodStart;type:varchar;size:255;" json:"billingPeriodStart"`
+	// ThresholdPercent is the percentage of the spending limit which was reached, e.g. 80.
+	ThresholdPercent int32       `gorm:"primary_key;column:thresholdPercent;type:int;" json:"thresholdPercent"`
+	NotifiedAt       VarcharTime `gorm:"column:notifiedAt;type:varchar;size:255;" json:"notifiedAt"`
+}
+
+// TableName sets the insert table name for this struct type
+func (n *BudgetNotification) TableName() string {
+	return "d_b_budget_notification"
+}
+
+// RecordBudgetNotification stores the notification and returns false if the threshold was already notified in the
+// billing period.
+func RecordBudgetNotification(ctx context.Context, conn *gorm.DB, notification BudgetNotification) (bool, error) {
+	result := conn.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&notification)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to record budget notification for %s: %w", notification.AttributionID, result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
@@ -0,0 +1,52 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/db/dbtest"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordBudgetNotification(t *testing.T) {
+	conn := dbtest.ConnectInMemoryForTests(t)
+	ctx := context.Background()
+	attributionID := db.NewTeamAttributionID(uuid.New().String())
+	periodStart := time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Cleanup(func() {
+		require.NoError(t, conn.Where("attributionId = ?", attributionID).Delete(&db.BudgetNotification{}).Error)
+	})
+
+	notification := db.BudgetNotification{
+		AttributionID:      attributionID,
+		BillingPeriodStart: db.NewVarcharTime(periodStart),
+		ThresholdPercent:   80,
+		NotifiedAt:         db.NewVarcharTime(periodStart.Add(time.Hour)),
+	}
+
+	recorded, err := db.RecordBudgetNotification(ctx, conn, notification)
+	require.NoError(t, err)
+	require.True(t, recorded)
+
+	recorded, err = db.RecordBudgetNotification(ctx, conn, notification)
+	require.NoError(t, err)
+	require.False(t, recorded, "must notify every threshold at most once per billing period")
+
+	notification.ThresholdPercent = 100
+	recorded, err = db.RecordBudgetNotification(ctx, conn, notification)
+	require.NoError(t, err)
+	require.True(t, recorded)
+
+	notification.BillingPeriodStart = db.NewVarcharTime(periodStart.AddDate(0, 1, 0))
+	recorded, err = db.RecordBudgetNotification(ctx, conn, notification)
+	require.NoError(t, err)
+	require.True(t, recorded, "must notify again in the next billing period")
+}
@@ -0,0 +1,132 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var CachedBalanceNotFound = errors.New("CachedBalanceNotFound")
+
+// CachedBalance is the balance of an attribution ID in a billing period, as computed from its ledger. Every ledger
+// write of the attribution ID increments Version, which invalidates the cached balance until it is computed again.
+type CachedBalance struct {
+	AttributionID AttributionID `gorm:"primary_key;column:attributionId;type:varchar;size:255;" json:"attributionId"`
+	Version       int64         `gorm:"column:version;type:bigint;" json:"version"`
+	// ComputedVersion is the Version of the ledger the cached balance was computed from.
+	ComputedVersion    int64       `gorm:"column:computedVersion;type:bigint;" json:"computedVersion"`
+	BillingPeriodStart VarcharTime `gorm:"column:billingPeriodStart;type:varchar;size:255;" json:"billingPeriodStart"`
+	// ValidUntil is when the cached balance becomes invalid without any ledger writes, e.g. because a credit grant
+	// expires or the billing period ends.
+	ValidUntil              VarcharTime `gorm:"column:validUntil;type:varchar;size:255;" json:"validUntil"`
+	CreditsUsed             CreditCents `gorm:"column:creditsUsed;type:bigint;" json:"creditsUsed"`
+	CreditsCovered          CreditCents `gorm:"column:creditsCovered;type:bigint;" json:"creditsCovered"`
+	CreditsGrantedRemaining CreditCents `gorm:"column:creditsGrantedRemaining;type:bigint;" json:"creditsGrantedRemaining"`
+}
+
+// TableName sets the insert table name for this struct type
+func (b *CachedBalance) TableName() string {
+	return "d_b_cached_balance"
+}
+
+// ValidAt is true when the cached balance reflects the current ledger, and can be used for the billing period
+// starting at `periodStart` at time `t`.
+func (b CachedBalance) ValidAt(periodStart, t time.Time) bool {
+	return b.ComputedVersion == b.Version &&
+		b.BillingPeriodStart.IsSet() && b.BillingPeriodStart.Time().Equal(periodStart) &&
+		t.Before(b.ValidUntil.Time())
+}
+
+// GetCachedBalance returns the cached balance of the attribution ID, or CachedBalanceNotFound if the ledger of the
+// attribution ID was never written or cached.
+func GetCachedBalance(ctx context.Context, conn *gorm.DB, attributionId AttributionID) (CachedBalance, error) {
+	var cached CachedBalance
+	result := conn.WithContext(ctx).First(&cached, "attributionId = ?", attributionId)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return CachedBalance{}, CachedBalanceNotFound
+		}
+		return CachedBalance{}, fmt.Errorf("failed to get cached balance of %s: %w", attributionId, result.Error)
+	}
+	return cached, nil
+}
+
+// ListCachedBalances returns all cached balances.
+func ListCachedBalances(ctx context.Context, conn *gorm.DB) ([]CachedBalance, error) {
+	var cached []CachedBalance
+	result := conn.WithContext(ctx).Find(&cached)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list cached balances: %w", result.Error)
+	}
+	return cached, nil
+}
+
+// StoreCachedBalance stores a balance which was computed from Version of the ledger. It returns false without storing
+// the balance when the ledger was written since, because the balance is already outdated.
+func StoreCachedBalance(ctx context.Context, conn *gorm.DB, balance CachedBalance) (bool, error) {
+	balance.ComputedVersion = balance.Version
+
+	result := conn.WithContext(ctx).
+		Model(&CachedBalance{}).
+		Where("attributionId = ? AND version = ?", balance.AttributionID, balance.Version).
+		Updates(map[string]interface{}{
+			"computedVersion":         balance.ComputedVersion,
+			"billingPeriodStart":      balance.BillingPeriodStart,
+			"validUntil":              balance.ValidUntil,
+			"creditsUsed":             balance.CreditsUsed,
+			"creditsCovered":          balance.CreditsCovered,
+			"creditsGrantedRemaining": balance.CreditsGrantedRemaining,
+		})
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to store cached balance of %s: %w", balance.AttributionID, result.Error)
+	}
+	if result.RowsAffected == 1 || balance.Version != 0 {
+		return result.RowsAffected == 1, nil
+	}
+
+	// The ledger of the attribution ID was not written since caching was introduced, so there is no cached balance
+	// yet. Invalidations which happened concurrently win.
+	result = conn.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&balance)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to store cached balance of %s: %w", balance.AttributionID, result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// InvalidateCachedBalances increments the Version of the cached balances of the attribution IDs, such that balances
+// which are cached or being computed concurrently are not used anymore.
+func InvalidateCachedBalances(ctx context.Context, conn *gorm.DB, attributionIds ...AttributionID) error {
+	if len(attributionIds) == 0 {
+		return nil
+	}
+
+	seen := map[AttributionID]bool{}
+	var records []CachedBalance
+	for _, attributionId := range attributionIds {
+		if seen[attributionId] {
+			continue
+		}
+		seen[attributionId] = true
+		records = append(records, CachedBalance{AttributionID: attributionId, Version: 1})
+	}
+
+	result := conn.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			DoUpdates: clause.Assignments(map[string]interface{}{"version": gorm.Expr("version + 1")}),
+		}).
+		CreateInBatches(records, 1000)
+	if result.Error != nil {
+		return fmt.Errorf("failed to invalidate cached balances: %w", result.Error)
+	}
+	return nil
+}
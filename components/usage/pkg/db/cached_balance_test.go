@@ -0,0 +1,106 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/db/dbtest"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCachedBalance_ValidAt(t *testing.T) {
+	periodStart := time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)
+	cached := db.CachedBalance{
+		Version:            3,
+		ComputedVersion:    3,
+		BillingPeriodStart: db.NewVarcharTime(periodStart),
+		ValidUntil:         db.NewVarcharTime(periodStart.AddDate(0, 0, 10)),
+	}
+
+	require.True(t, cached.ValidAt(periodStart, periodStart.AddDate(0, 0, 5)))
+	require.False(t, cached.ValidAt(periodStart, periodStart.AddDate(0, 0, 10)), "must not be used once a credit grant changed")
+	require.False(t, cached.ValidAt(periodStart.AddDate(0, 1, 0), periodStart.AddDate(0, 0, 5)), "must not be used in another billing period")
+
+	cached.Version = 4
+	require.False(t, cached.ValidAt(periodStart, periodStart.AddDate(0, 0, 5)), "must not be used after ledger writes")
+}
+
+func TestStoreCachedBalance(t *testing.T) {
+	conn := dbtest.ConnectInMemoryForTests(t)
+	ctx := context.Background()
+	attributionID := db.NewTeamAttributionID(uuid.New().String())
+	t.Cleanup(func() {
+		require.NoError(t, conn.Where("attributionId = ?", attributionID).Delete(&db.CachedBalance{}).Error)
+	})
+	periodStart := time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)
+	computed := db.CachedBalance{
+		AttributionID:      attributionID,
+		BillingPeriodStart: db.NewVarcharTime(periodStart),
+		ValidUntil:         db.NewVarcharTime(periodStart.AddDate(0, 1, 0)),
+		CreditsUsed:        1000,
+	}
+
+	_, err := db.GetCachedBalance(ctx, conn, attributionID)
+	require.ErrorIs(t, err, db.CachedBalanceNotFound)
+
+	stored, err := db.StoreCachedBalance(ctx, conn, computed)
+	require.NoError(t, err)
+	require.True(t, stored)
+
+	cached, err := db.GetCachedBalance(ctx, conn, attributionID)
+	require.NoError(t, err)
+	require.True(t, cached.ValidAt(periodStart, periodStart))
+	require.Equal(t, db.CreditCents(1000), cached.CreditsUsed)
+
+	// A ledger write while the balance is computed from version 0 must win over the outdated balance.
+	require.NoError(t, db.InvalidateCachedBalances(ctx, conn, attributionID, attributionID))
+	stored, err = db.StoreCachedBalance(ctx, conn, computed)
+	require.NoError(t, err)
+	require.False(t, stored)
+
+	cached, err = db.GetCachedBalance(ctx, conn, attributionID)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), cached.Version)
+	require.False(t, cached.ValidAt(periodStart, periodStart))
+
+	computed.Version = cached.Version
+	computed.CreditsUsed = 2000
+	stored, err = db.StoreCachedBalance(ctx, conn, computed)
+	require.NoError(t, err)
+	require.True(t, stored)
+
+	cached, err = db.GetCachedBalance(ctx, conn, attributionID)
+	require.NoError(t, err)
+	require.True(t, cached.ValidAt(periodStart, periodStart))
+	require.Equal(t, db.CreditCents(2000), cached.CreditsUsed)
+}
+
+func TestInsertUsage_InvalidatesCachedBalance(t *testing.T) {
+	conn := dbtest.ConnectForTests(t)
+	ctx := context.Background()
+	attributionID := db.NewTeamAttributionID(uuid.New().String())
+	t.Cleanup(func() {
+		require.NoError(t, conn.Where("attributionId = ?", attributionID).Delete(&db.CachedBalance{}).Error)
+	})
+
+	dbtest.CreateUsageRecords(t, conn, dbtest.NewUsage(t, db.Usage{AttributionID: attributionID}))
+	cached, err := db.GetCachedBalance(ctx, conn, attributionID)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), cached.Version)
+
+	usage := dbtest.NewUsage(t, db.Usage{AttributionID: attributionID, Draft: true})
+	dbtest.CreateUsageRecords(t, conn, usage)
+	usage.Draft = false
+	require.NoError(t, db.UpdateUsage(ctx, conn, usage))
+
+	cached, err = db.GetCachedBalance(ctx, conn, attributionID)
+	require.NoError(t, err)
+	require.Equal(t, int64(3), cached.Version)
+}
@@ -5,8 +5,10 @@
 package db
 
 import (
+	"context"
 	"fmt"
 	"github.com/gitpod-io/gitpod/common-go/log"
+	"github.com/gitpod-io/gitpod/usage/pkg/requestid"
 	driver_mysql "github.com/go-sql-driver/mysql"
 	"github.com/sirupsen/logrus"
 	"gorm.io/driver/mysql"
@@ -23,6 +25,16 @@ type ConnectionParams struct {
 }
 
 func Connect(p ConnectionParams) (*gorm.DB, error) {
+	return connect(p, false)
+}
+
+// ConnectReplica connects to a read replica of the database. Unlike Connect, it does not verify that the replica is
+// reachable, such that the replica can become available after startup. See ReplicaRouter.
+func ConnectReplica(p ConnectionParams) (*gorm.DB, error) {
+	return connect(p, true)
+}
+
+func connect(p ConnectionParams, lazy bool) (*gorm.DB, error) {
 	loc, err := time.LoadLocation("UTC")
 	if err != nil {
 		return nil, fmt.Errorf("failed to load UT location: %w", err)
@@ -39,10 +51,16 @@ func Connect(p ConnectionParams) (*gorm.DB, error) {
 	}
 
 	// refer to https://github.com/go-sql-driver/mysql#dsn-data-source-name for details
-	return gorm.Open(mysql.Open(cfg.FormatDSN()), &gorm.Config{
-		Logger: logger.New(log.Log, logger.Config{
-			SlowThreshold: 200 * time.Millisecond,
-			Colorful:      false,
+	dialector := mysql.New(mysql.Config{
+		DSN: cfg.FormatDSN(),
+		// Determining the server version requires a connection.
+		SkipInitializeWithVersion: lazy,
+	})
+	return gorm.Open(dialector, &gorm.Config{
+		DisableAutomaticPing: lazy,
+		// Slow statements are logged with redacted parameters by CaptureSlowQueries instead.
+		Logger: requestLogger{config: logger.Config{
+			Colorful: false,
 			LogLevel: (func() logger.LogLevel {
 				switch log.Log.Level {
 				case logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel:
@@ -53,6 +71,36 @@ func Connect(p ConnectionParams) (*gorm.DB, error) {
 					return logger.Info
 				}
 			})(),
-		}),
+		}},
 	})
 }
+
+// requestLogger logs statements with the request ID of the context they are executed with, see requestid.Log.
+type requestLogger struct {
+	config logger.Config
+}
+
+func (l requestLogger) LogMode(level logger.LogLevel) logger.Interface {
+	l.config.LogLevel = level
+	return l
+}
+
+func (l requestLogger) Info(ctx context.Context, msg string, data ...interface{}) {
+	l.forContext(ctx).Info(ctx, msg, data...)
+}
+
+func (l requestLogger) Warn(ctx context.Context, msg string, data ...interface{}) {
+	l.forContext(ctx).Warn(ctx, msg, data...)
+}
+
+func (l requestLogger) Error(ctx context.Context, msg string, data ...interface{}) {
+	l.forContext(ctx).Error(ctx, msg, data...)
+}
+
+func (l requestLogger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	l.forContext(ctx).Trace(ctx, begin, fc, err)
+}
+
+func (l requestLogger) forContext(ctx context.Context) logger.Interface {
+	return logger.New(requestid.Log(ctx), l.config)
+}
@@ -10,15 +10,65 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 var CostCenterNotFound = errors.New("CostCenter not found")
 
+type BillingStrategy string
+
+const (
+	CostCenter_Stripe BillingStrategy = "stripe"
+	CostCenter_Other  BillingStrategy = "other"
+)
+
+// DefaultCurrency is the currency of cost centers which did not choose one.
+const DefaultCurrency = "USD"
+
+// SpendingLimitType determines whether reaching the spending limit blocks workspace starts.
+type SpendingLimitType string
+
+const (
+	// SpendingLimitType_Soft limits only warn when they are exceeded.
+	SpendingLimitType_Soft SpendingLimitType = "soft"
+	// SpendingLimitType_Hard limits block new workspace starts when they are exceeded.
+	SpendingLimitType_Hard SpendingLimitType = "hard"
+)
+
+// CostCenterState determines whether a cost center can consume paid features.
+type CostCenterState string
+
+const (
+	CostCenterState_Active CostCenterState = "active"
+	// CostCenterState_Disputed cost centers have an open payment dispute, and must not consume paid features.
+	CostCenterState_Disputed CostCenterState = "disputed"
+)
+
 type CostCenter struct {
-	ID            AttributionID `gorm:"primary_key;column:id;type:char;size:36;" json:"id"`
-	SpendingLimit int32         `gorm:"column:spendingLimit;type:int;default:0;" json:"spendingLimit"`
-	LastModified  time.Time     `gorm:"->:column:_lastModified;type:timestamp;default:CURRENT_TIMESTAMP(6);" json:"_lastModified"`
+	ID                AttributionID     `gorm:"primary_key;column:id;type:char;size:36;" json:"id"`
+	SpendingLimit     int32             `gorm:"column:spendingLimit;type:int;default:0;" json:"spendingLimit"`
+	BillingStrategy   BillingStrategy   `gorm:"column:billingStrategy;type:varchar;size:255;default:other;" json:"billingStrategy"`
+	SpendingLimitType SpendingLimitType `gorm:"column:spendingLimitType;type:varchar;size:255;default:hard;" json:"spendingLimitType"`
+	// Currency is the ISO 4217 code of the currency the cost center is billed in.
+	Currency string          `gorm:"column:currency;type:varchar;size:255;default:USD;" json:"currency"`
+	State    CostCenterState `gorm:"column:state;type:varchar;size:255;default:active;" json:"state"`
+	// BillingCycleAnchor is the start of the first billing period of the cost center. Subsequent billing periods start
+	// monthly on the same day and time. When BillingCycleAnchor is not set, billing periods are calendar months.
+	BillingCycleAnchor VarcharTime `gorm:"column:billingCycleAnchor;type:varchar;size:255;" json:"billingCycleAnchor"`
+	// PaymentFailedAt is when the payment of an invoice of the cost center first failed. It is cleared once the invoice
+	// is paid. While it is set, the cost center goes through dunning.
+	PaymentFailedAt VarcharTime `gorm:"column:paymentFailedAt;type:varchar;size:255;" json:"paymentFailedAt"`
+	// NextBillingTime is when the current billing period of the cost center ends, and its usage is billed next.
+	NextBillingTime VarcharTime `gorm:"column:nextBillingTime;type:varchar;size:255;" json:"nextBillingTime"`
+	// RolloverLimit is the maximum of credits which were granted for a billing period, but not used, that are carried
+	// over into the next billing period. When RolloverLimit is 0, unused credits expire.
+	RolloverLimit int32 `gorm:"column:rolloverLimit;type:int;default:0;" json:"rolloverLimit"`
+	// Debt is the usage in excess of the spending limit which was carried over from previous billing periods. It counts
+	// towards the spending limit of the current billing period.
+	Debt         CreditCents `gorm:"column:debt;type:bigint;default:0;" json:"debt"`
+	LastModified time.Time   `gorm:"->:column:_lastModified;type:timestamp;default:CURRENT_TIMESTAMP(6);" json:"_lastModified"`
 
 	// deleted is restricted for use by db-sync
 	_ bool `gorm:"column:deleted;type:tinyint;default:0;" json:"deleted"`
@@ -29,11 +79,16 @@ func (d *CostCenter) TableName() string {
 	return "d_b_cost_center"
 }
 
+// notDeleted excludes cost centers which were marked as deleted, and are pending removal by db-sync.
+func notDeleted(db *gorm.DB) *gorm.DB {
+	return db.Where("deleted = ?", false)
+}
+
 func GetCostCenter(ctx context.Context, conn *gorm.DB, attributionId AttributionID) (*CostCenter, error) {
 	db := conn.WithContext(ctx)
 	var costCenter CostCenter
 
-	result := db.First(&costCenter, attributionId)
+	result := db.Scopes(notDeleted).First(&costCenter, attributionId)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			return nil, CostCenterNotFound
@@ -44,3 +99,323 @@ func GetCostCenter(ctx context.Context, conn *gorm.DB, attributionId Attribution
 
 	return &costCenter, nil
 }
+
+// CreateCostCenter stores a new cost center, and records its initial spending limit. When NextBillingTime is not set,
+// it is set to the end of the billing period which contains `now`.
+func CreateCostCenter(ctx context.Context, conn *gorm.DB, costCenter CostCenter, now time.Time) (*CostCenter, error) {
+	if !costCenter.NextBillingTime.IsSet() {
+		_, periodEnd := costCenter.BillingPeriodAt(now)
+		costCenter.NextBillingTime = NewVarcharTime(periodEnd)
+	}
+
+	err := WithRetryableTx(ctx, conn, func(tx *gorm.DB) error {
+		if err := tx.Create(&costCenter).Error; err != nil {
+			return fmt.Errorf("failed to create cost center: %w", err)
+		}
+		return recordSpendingLimitChange(tx, costCenter.ID, 0, costCenter.SpendingLimit, SpendingLimitChangeActor_System, "Cost center created")
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &costCenter, nil
+}
+
+// UpdateCostCenter replaces an existing cost center, and returns CostCenterNotFound if there is none.
+func UpdateCostCenter(ctx context.Context, conn *gorm.DB, costCenter CostCenter) (*CostCenter, error) {
+	return updateCostCenterAs(ctx, conn, costCenter.ID, SpendingLimitChangeActor_System, "Cost center replaced", func(existing *CostCenter) {
+		*existing = costCenter
+	})
+}
+
+// SetSpendingLimit changes the spending limit of an existing cost center, and records who changed it and why. It
+// returns CostCenterNotFound if there is no cost center.
+func SetSpendingLimit(ctx context.Context, conn *gorm.DB, attributionId AttributionID, spendingLimit int32, actor, reason string) (*CostCenter, error) {
+	return updateCostCenterAs(ctx, conn, attributionId, actor, reason, func(costCenter *CostCenter) {
+		costCenter.SpendingLimit = spendingLimit
+	})
+}
+
+// DeleteCostCenter marks the cost center as deleted, such that db-sync removes it. Deleted cost centers are no longer
+// returned by GetCostCenter.
+func DeleteCostCenter(ctx context.Context, conn *gorm.DB, attributionId AttributionID) error {
+	result := conn.WithContext(ctx).
+		Model(&CostCenter{}).
+		Scopes(notDeleted).
+		Where("id = ?", attributionId).
+		Update("deleted", true)
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete cost center: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return CostCenterNotFound
+	}
+	return nil
+}
+
+// ListCostCentersDueForBilling returns the cost centers whose NextBillingTime is at or before `t`.
+func ListCostCentersDueForBilling(ctx context.Context, conn *gorm.DB, t time.Time) ([]CostCenter, error) {
+	var costCenters []CostCenter
+	result := conn.WithContext(ctx).
+		Scopes(notDeleted).
+		Where("nextBillingTime != ? AND nextBillingTime <= ?", "", TimeToISO8601(t)).
+		Find(&costCenters)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list cost centers due for billing: %w", result.Error)
+	}
+	return costCenters, nil
+}
+
+// AdvanceNextBillingTime moves the NextBillingTime of the cost center from `from` to `to`. It returns false without
+// changing the cost center when its NextBillingTime is no longer `from`, because it was advanced concurrently.
+func AdvanceNextBillingTime(ctx context.Context, conn *gorm.DB, attributionId AttributionID, from, to time.Time) (bool, error) {
+	result := conn.WithContext(ctx).
+		Model(&CostCenter{}).
+		Scopes(notDeleted).
+		Where("id = ? AND nextBillingTime = ?", attributionId, TimeToISO8601(from)).
+		Update("nextBillingTime", TimeToISO8601(to))
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to advance next billing time: %w", result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// SetDebt replaces the debt the cost center carries into its current billing period.
+func SetDebt(ctx context.Context, conn *gorm.DB, attributionId AttributionID, debt CreditCents) (*CostCenter, error) {
+	return updateCostCenter(ctx, conn, attributionId, func(costCenter *CostCenter) {
+		costCenter.Debt = debt
+	})
+}
+
+// BalanceSnapshotFunc computes the balance of a cost center which switches its billing strategy, up to the switch.
+type BalanceSnapshotFunc func(tx *gorm.DB, costCenter CostCenter, periodStart, switchTime time.Time) (BillingStrategyTransition, error)
+
+// SwitchToStripeBilling makes Stripe the billing strategy of the cost center in a single transaction, creating the
+// cost center with `defaultSpendingLimit` if it does not exist yet. The cost center is billed in `currency`.
+//
+// When an existing cost center switches from another billing strategy at `now`, its billing period is closed out: the
+// balance returned by snapshot is recorded as a BillingStrategyTransition, its debt is cleared, and a fresh billing
+// period starts at `now`, such that usage before the switch is not billed through Stripe.
+func SwitchToStripeBilling(ctx context.Context, conn *gorm.DB, attributionId AttributionID, defaultSpendingLimit int32, currency string, now time.Time, snapshot BalanceSnapshotFunc) (*CostCenter, error) {
+	var costCenter CostCenter
+	err := WithRetryableTx(ctx, conn, func(tx *gorm.DB) error {
+		created := false
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&costCenter, "id = ?", attributionId)
+		if result.Error != nil {
+			if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("failed to get cost center: %w", result.Error)
+			}
+			costCenter = CostCenter{
+				ID:            attributionId,
+				SpendingLimit: defaultSpendingLimit,
+			}
+			created = true
+		}
+
+		var transition *BillingStrategyTransition
+		if !created && costCenter.BillingStrategy != CostCenter_Stripe {
+			periodStart, _ := costCenter.BillingPeriodAt(now)
+			closed, err := snapshot(tx, costCenter, periodStart, now)
+			if err != nil {
+				return fmt.Errorf("failed to snapshot balance: %w", err)
+			}
+			closed.ID = uuid.New()
+			closed.AttributionID = attributionId
+			closed.FromStrategy = costCenter.BillingStrategy
+			closed.ToStrategy = CostCenter_Stripe
+			closed.TransitionTime = NewVarcharTime(now)
+			closed.PeriodStart = NewVarcharTime(periodStart)
+			closed.Debt = costCenter.Debt
+			transition = &closed
+
+			costCenter.BillingCycleAnchor = NewVarcharTime(now)
+			_, periodEnd := costCenter.BillingPeriodAt(now)
+			costCenter.NextBillingTime = NewVarcharTime(periodEnd)
+			costCenter.Debt = 0
+		}
+
+		costCenter.BillingStrategy = CostCenter_Stripe
+		costCenter.Currency = currency
+		if err := tx.Save(&costCenter).Error; err != nil {
+			return fmt.Errorf("failed to save cost center: %w", err)
+		}
+		if transition != nil {
+			if err := tx.Create(transition).Error; err != nil {
+				return fmt.Errorf("failed to record billing strategy transition: %w", err)
+			}
+		}
+		if !created {
+			return nil
+		}
+		return recordSpendingLimitChange(tx, attributionId, 0, costCenter.SpendingLimit, SpendingLimitChangeActor_System, "Switched to Stripe billing")
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &costCenter, nil
+}
+
+// SetCostCenterState changes the state of an existing cost center, and returns CostCenterNotFound if there is none.
+func SetCostCenterState(ctx context.Context, conn *gorm.DB, attributionId AttributionID, state CostCenterState) (*CostCenter, error) {
+	return updateCostCenter(ctx, conn, attributionId, func(costCenter *CostCenter) {
+		costCenter.State = state
+	})
+}
+
+// SetPaymentFailed records that an invoice payment of the cost center failed at `failedAt`. Subsequent failures do not
+// move PaymentFailedAt, such that dunning escalates from the first failure until the invoice is paid.
+func SetPaymentFailed(ctx context.Context, conn *gorm.DB, attributionId AttributionID, failedAt time.Time) (*CostCenter, error) {
+	return updateCostCenter(ctx, conn, attributionId, func(costCenter *CostCenter) {
+		if !costCenter.PaymentFailedAt.IsSet() {
+			costCenter.PaymentFailedAt = NewVarcharTime(failedAt)
+		}
+	})
+}
+
+// ClearPaymentFailed ends dunning of the cost center, after its unpaid invoice was paid.
+func ClearPaymentFailed(ctx context.Context, conn *gorm.DB, attributionId AttributionID) (*CostCenter, error) {
+	return updateCostCenter(ctx, conn, attributionId, func(costCenter *CostCenter) {
+		costCenter.PaymentFailedAt = VarcharTime{}
+	})
+}
+
+// updateCostCenter applies update to an existing cost center in a single transaction, and returns CostCenterNotFound
+// if there is none. update is applied again when the transaction is retried after a deadlock.
+func updateCostCenter(ctx context.Context, conn *gorm.DB, attributionId AttributionID, update func(costCenter *CostCenter)) (*CostCenter, error) {
+	return updateCostCenterAs(ctx, conn, attributionId, SpendingLimitChangeActor_System, "", update)
+}
+
+// updateCostCenterAs is updateCostCenter, which records a change of the spending limit by update as made by actor.
+func updateCostCenterAs(ctx context.Context, conn *gorm.DB, attributionId AttributionID, actor, reason string, update func(costCenter *CostCenter)) (*CostCenter, error) {
+	var costCenter CostCenter
+	err := WithRetryableTx(ctx, conn, func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Scopes(notDeleted).First(&costCenter, "id = ?", attributionId)
+		if result.Error != nil {
+			if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+				return CostCenterNotFound
+			}
+			return fmt.Errorf("failed to get cost center: %w", result.Error)
+		}
+
+		oldSpendingLimit := costCenter.SpendingLimit
+		update(&costCenter)
+		if err := tx.Save(&costCenter).Error; err != nil {
+			return fmt.Errorf("failed to save cost center: %w", err)
+		}
+		if costCenter.SpendingLimit == oldSpendingLimit {
+			return nil
+		}
+		return recordSpendingLimitChange(tx, attributionId, oldSpendingLimit, costCenter.SpendingLimit, actor, reason)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &costCenter, nil
+}
+
+type FindCostCentersParams struct {
+	// BillingStrategy only finds cost centers with the billing strategy, unless it is empty.
+	BillingStrategy BillingStrategy
+	// MinSpendingLimit and MaxSpendingLimit only find cost centers whose spending limit is in the range, inclusive,
+	// unless they are nil.
+	MinSpendingLimit, MaxSpendingLimit *int32
+	// Limit is the maximum number of cost centers to find, all are found when it is 0.
+	Offset, Limit int64
+}
+
+func (p *FindCostCentersParams) scope(db *gorm.DB) *gorm.DB {
+	db = db.Scopes(notDeleted)
+	if p.BillingStrategy != "" {
+		db = db.Where("billingStrategy = ?", p.BillingStrategy)
+	}
+	if p.MinSpendingLimit != nil {
+		db = db.Where("spendingLimit >= ?", *p.MinSpendingLimit)
+	}
+	if p.MaxSpendingLimit != nil {
+		db = db.Where("spendingLimit <= ?", *p.MaxSpendingLimit)
+	}
+	return db
+}
+
+// FindCostCenters returns the cost centers matching all params, ordered by attribution ID.
+func FindCostCenters(ctx context.Context, conn *gorm.DB, params *FindCostCentersParams) ([]CostCenter, error) {
+	db := conn.WithContext(ctx).
+		Scopes(params.scope).
+		Order("id ASC")
+	if params.Offset != 0 {
+		db = db.Offset(int(params.Offset))
+	}
+	if params.Limit != 0 {
+		db = db.Limit(int(params.Limit))
+	}
+
+	var costCenters []CostCenter
+	result := db.Find(&costCenters)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to find cost centers: %w", result.Error)
+	}
+	return costCenters, nil
+}
+
+// CountCostCenters returns the number of cost centers matching all params, regardless of Offset and Limit.
+func CountCostCenters(ctx context.Context, conn *gorm.DB, params *FindCostCentersParams) (int64, error) {
+	var count int64
+	result := conn.WithContext(ctx).
+		Model(&CostCenter{}).
+		Scopes(params.scope).
+		Count(&count)
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to count cost centers: %w", result.Error)
+	}
+	return count, nil
+}
+
+func FindCostCentersWithBillingCycleAnchor(ctx context.Context, conn *gorm.DB) ([]CostCenter, error) {
+	var costCenters []CostCenter
+	result := conn.WithContext(ctx).
+		Scopes(notDeleted).
+		Where("billingCycleAnchor IS NOT NULL AND billingCycleAnchor != ?", "").
+		Find(&costCenters)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to find cost centers with billing cycle anchor: %w", result.Error)
+	}
+	return costCenters, nil
+}
+
+// BillingPeriodAt returns the billing period [from, to) of the cost center which contains t.
+func (c *CostCenter) BillingPeriodAt(t time.Time) (from, to time.Time) {
+	return BillingPeriodAt(c.BillingCycleAnchor, t)
+}
+
+// BillingPeriodAt returns the monthly billing period [from, to) starting on the day of `anchor` which contains t.
+// Anchors on days which do not exist in a month, like the 31st, start the period on the last day of that month.
+// When anchor is not set, the billing period is the calendar month.
+func BillingPeriodAt(anchor VarcharTime, t time.Time) (from, to time.Time) {
+	t = t.UTC()
+	if !anchor.IsSet() {
+		from = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return from, from.AddDate(0, 1, 0)
+	}
+
+	a := anchor.Time().UTC()
+	months := (t.Year()-a.Year())*12 + int(t.Month()-a.Month())
+	from = periodStart(a, months)
+	if from.After(t) {
+		months--
+		from = periodStart(a, months)
+	}
+	return from, periodStart(a, months+1)
+}
+
+// periodStart returns the start of the billing period `months` months after the anchor.
+func periodStart(anchor time.Time, months int) time.Time {
+	firstOfMonth := time.Date(anchor.Year(), anchor.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, months, 0)
+	lastDay := firstOfMonth.AddDate(0, 1, -1).Day()
+
+	day := anchor.Day()
+	if day > lastDay {
+		day = lastDay
+	}
+	return time.Date(firstOfMonth.Year(), firstOfMonth.Month(), day, anchor.Hour(), anchor.Minute(), anchor.Second(), anchor.Nanosecond(), time.UTC)
+}
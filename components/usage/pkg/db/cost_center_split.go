@@ -0,0 +1,67 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// CostCenterSplit charges Percentage of the workspace usage of AttributionID to TargetAttributionID instead, for
+// example because a platform team subsidizes the workspaces of another team.
+type CostCenterSplit struct {
+	AttributionID       AttributionID `gorm:"primary_key;column:attributionId;type:varchar;size:255;" json:"attributionId"`
+	TargetAttributionID AttributionID `gorm:"primary_key;column:targetAttributionId;type:varchar;size:255;" json:"targetAttributionId"`
+	Percentage          int32         `gorm:"column:percentage;type:int;" json:"percentage"`
+}
+
+// TableName sets the insert table name for this struct type
+func (s *CostCenterSplit) TableName() string {
+	return "d_b_cost_center_split"
+}
+
+// SetCostCenterSplits replaces the splits of the attribution ID in a single transaction. Passing no splits removes
+// all of them.
+func SetCostCenterSplits(ctx context.Context, conn *gorm.DB, attributionId AttributionID, splits []CostCenterSplit) error {
+	return conn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("attributionId = ?", attributionId).Delete(&CostCenterSplit{}).Error; err != nil {
+			return fmt.Errorf("failed to delete splits of %s: %w", attributionId, err)
+		}
+		if len(splits) == 0 {
+			return nil
+		}
+		for i := range splits {
+			splits[i].AttributionID = attributionId
+		}
+		if err := tx.Create(&splits).Error; err != nil {
+			return fmt.Errorf("failed to create splits of %s: %w", attributionId, err)
+		}
+		return nil
+	})
+}
+
+// FindCostCenterSplitsByAttributionIDs returns the splits of the given attribution IDs, ordered by target attribution ID.
+func FindCostCenterSplitsByAttributionIDs(ctx context.Context, conn *gorm.DB, attributionIDs []AttributionID) (map[AttributionID][]CostCenterSplit, error) {
+	result := map[AttributionID][]CostCenterSplit{}
+	if len(attributionIDs) == 0 {
+		return result, nil
+	}
+
+	var splits []CostCenterSplit
+	tx := conn.WithContext(ctx).
+		Where("attributionId IN ?", attributionIDs).
+		Order("targetAttributionId ASC").
+		Find(&splits)
+	if tx.Error != nil {
+		return nil, fmt.Errorf("failed to find cost center splits: %w", tx.Error)
+	}
+
+	for _, split := range splits {
+		result[split.AttributionID] = append(result[split.AttributionID], split)
+	}
+	return result, nil
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/db/dbtest"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetCostCenterSplits(t *testing.T) {
+	conn := dbtest.ConnectInMemoryForTests(t)
+	ctx := context.Background()
+
+	team := db.NewTeamAttributionID(uuid.New().String())
+	platform := db.NewTeamAttributionID(uuid.New().String())
+	other := db.NewTeamAttributionID(uuid.New().String())
+	t.Cleanup(func() {
+		require.NoError(t, conn.Where("attributionId = ?", team).Delete(&db.CostCenterSplit{}).Error)
+	})
+
+	require.NoError(t, db.SetCostCenterSplits(ctx, conn, team, []db.CostCenterSplit{
+		{TargetAttributionID: platform, Percentage: 50},
+		{TargetAttributionID: other, Percentage: 10},
+	}))
+	splits, err := db.FindCostCenterSplitsByAttributionIDs(ctx, conn, []db.AttributionID{team})
+	require.NoError(t, err)
+	require.Len(t, splits[team], 2)
+
+	require.NoError(t, db.SetCostCenterSplits(ctx, conn, team, []db.CostCenterSplit{
+		{TargetAttributionID: platform, Percentage: 30},
+	}))
+	splits, err = db.FindCostCenterSplitsByAttributionIDs(ctx, conn, []db.AttributionID{team})
+	require.NoError(t, err)
+	require.Equal(t, []db.CostCenterSplit{{AttributionID: team, TargetAttributionID: platform, Percentage: 30}}, splits[team], "must replace existing splits")
+
+	require.NoError(t, db.SetCostCenterSplits(ctx, conn, team, nil))
+	splits, err = db.FindCostCenterSplitsByAttributionIDs(ctx, conn, []db.AttributionID{team})
+	require.NoError(t, err)
+	require.Empty(t, splits[team])
+}
@@ -7,11 +7,13 @@ package db_test
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/gitpod-io/gitpod/usage/pkg/db"
 	"github.com/gitpod-io/gitpod/usage/pkg/db/dbtest"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
 )
 
 func TestCostCenter_WriteRead(t *testing.T) {
@@ -55,3 +57,209 @@ func TestGetCostCenter(t *testing.T) {
 		conn.Model(&db.CostCenter{}).Delete(costCenter)
 	})
 }
+
+func TestSwitchToStripeBilling(t *testing.T) {
+	conn := dbtest.ConnectForTests(t)
+	now := time.Date(2022, 9, 20, 10, 0, 0, 0, time.UTC)
+
+	existing := &db.CostCenter{
+		ID:              db.NewTeamAttributionID(uuid.New().String()),
+		SpendingLimit:   500,
+		BillingStrategy: db.CostCenter_Other,
+		Debt:            300,
+	}
+	require.NoError(t, conn.Create(existing).Error)
+	missingID := db.NewTeamAttributionID(uuid.New().String())
+
+	t.Cleanup(func() {
+		conn.Where("id IN ?", []db.AttributionID{existing.ID, missingID}).Delete(&db.CostCenter{})
+		conn.Where("attributionId IN ?", []db.AttributionID{existing.ID, missingID}).Delete(&db.BillingStrategyTransition{})
+	})
+
+	var snapshots int
+	snapshot := func(tx *gorm.DB, costCenter db.CostCenter, periodStart, switchTime time.Time) (db.BillingStrategyTransition, error) {
+		snapshots++
+		require.Equal(t, existing.ID, costCenter.ID)
+		require.Equal(t, time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC), periodStart)
+		require.Equal(t, now, switchTime)
+		return db.BillingStrategyTransition{CreditsUsed: 1000, CreditsCovered: 400}, nil
+	}
+
+	costCenter, err := db.SwitchToStripeBilling(context.Background(), conn, existing.ID, 100, "EUR", now, snapshot)
+	require.NoError(t, err)
+	require.Equal(t, db.CostCenter_Stripe, costCenter.BillingStrategy)
+	require.Equal(t, "EUR", costCenter.Currency)
+	require.EqualValues(t, 500, costCenter.SpendingLimit, "must keep the spending limit of existing cost centers")
+	require.Equal(t, db.NewVarcharTime(now), costCenter.BillingCycleAnchor, "must start a fresh billing period")
+	require.Equal(t, db.NewVarcharTime(now.AddDate(0, 1, 0)), costCenter.NextBillingTime)
+	require.Zero(t, costCenter.Debt)
+
+	transitions, err := db.FindBillingStrategyTransitions(context.Background(), conn, existing.ID)
+	require.NoError(t, err)
+	require.Len(t, transitions, 1)
+	require.Equal(t, db.CostCenter_Other, transitions[0].FromStrategy)
+	require.Equal(t, db.CostCenter_Stripe, transitions[0].ToStrategy)
+	require.Equal(t, db.NewVarcharTime(now), transitions[0].TransitionTime)
+	require.EqualValues(t, 1000, transitions[0].CreditsUsed)
+	require.EqualValues(t, 300, transitions[0].Debt)
+
+	_, err = db.SwitchToStripeBilling(context.Background(), conn, existing.ID, 100, "EUR", now.Add(time.Hour), snapshot)
+	require.NoError(t, err)
+	require.Equal(t, 1, snapshots, "cost centers already billed through Stripe must not be closed out again")
+
+	costCenter, err = db.SwitchToStripeBilling(context.Background(), conn, missingID, 100, db.DefaultCurrency, now, snapshot)
+	require.NoError(t, err)
+	require.Equal(t, db.CostCenter_Stripe, costCenter.BillingStrategy)
+	require.EqualValues(t, 100, costCenter.SpendingLimit)
+	require.Equal(t, 1, snapshots, "new cost centers have no balance to snapshot")
+
+	read, err := db.GetCostCenter(context.Background(), conn, missingID)
+	require.NoError(t, err)
+	require.Equal(t, db.CostCenter_Stripe, read.BillingStrategy)
+	require.Equal(t, db.DefaultCurrency, read.Currency)
+}
+
+func TestCreateCostCenter(t *testing.T) {
+	conn := dbtest.ConnectForTests(t)
+	now := time.Date(2022, 9, 20, 10, 0, 0, 0, time.UTC)
+
+	costCenter := dbtest.NewCostCenter(t, db.CostCenter{})
+	t.Cleanup(func() {
+		conn.Where("id = ?", costCenter.ID).Delete(&db.CostCenter{})
+	})
+
+	created, err := db.CreateCostCenter(context.Background(), conn, costCenter, now)
+	require.NoError(t, err)
+	require.Equal(t, db.NewVarcharTime(time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)), created.NextBillingTime, "must default to the end of the billing period")
+
+	read, err := db.GetCostCenter(context.Background(), conn, costCenter.ID)
+	require.NoError(t, err)
+	require.Equal(t, costCenter.SpendingLimit, read.SpendingLimit)
+	require.Equal(t, costCenter.BillingStrategy, read.BillingStrategy)
+	require.Equal(t, created.NextBillingTime.String(), read.NextBillingTime.String())
+}
+
+func TestUpdateCostCenter(t *testing.T) {
+	conn := dbtest.ConnectForTests(t)
+	costCenter := dbtest.CreateCostCenters(t, conn, db.CostCenter{SpendingLimit: 200})[0]
+
+	costCenter.SpendingLimit = 300
+	costCenter.BillingStrategy = db.CostCenter_Stripe
+	updated, err := db.UpdateCostCenter(context.Background(), conn, costCenter)
+	require.NoError(t, err)
+	require.EqualValues(t, 300, updated.SpendingLimit)
+
+	read, err := db.GetCostCenter(context.Background(), conn, costCenter.ID)
+	require.NoError(t, err)
+	require.EqualValues(t, 300, read.SpendingLimit)
+	require.Equal(t, db.CostCenter_Stripe, read.BillingStrategy)
+
+	_, err = db.UpdateCostCenter(context.Background(), conn, dbtest.NewCostCenter(t, db.CostCenter{}))
+	require.ErrorIs(t, err, db.CostCenterNotFound)
+}
+
+func TestDeleteCostCenter(t *testing.T) {
+	conn := dbtest.ConnectForTests(t)
+	costCenter := dbtest.CreateCostCenters(t, conn, db.CostCenter{})[0]
+
+	require.NoError(t, db.DeleteCostCenter(context.Background(), conn, costCenter.ID))
+
+	_, err := db.GetCostCenter(context.Background(), conn, costCenter.ID)
+	require.ErrorIs(t, err, db.CostCenterNotFound)
+
+	require.ErrorIs(t, db.DeleteCostCenter(context.Background(), conn, costCenter.ID), db.CostCenterNotFound)
+}
+
+func TestListCostCentersDueForBilling(t *testing.T) {
+	conn := dbtest.ConnectForTests(t)
+	now := time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	costCenters := dbtest.CreateCostCenters(t, conn,
+		db.CostCenter{NextBillingTime: db.NewVarcharTime(now.Add(-time.Hour))},
+		db.CostCenter{NextBillingTime: db.NewVarcharTime(now)},
+		db.CostCenter{NextBillingTime: db.NewVarcharTime(now.Add(time.Hour))},
+		db.CostCenter{},
+	)
+
+	due, err := db.ListCostCentersDueForBilling(context.Background(), conn, now)
+	require.NoError(t, err)
+
+	var dueIDs []db.AttributionID
+	for _, costCenter := range due {
+		dueIDs = append(dueIDs, costCenter.ID)
+	}
+	require.Contains(t, dueIDs, costCenters[0].ID)
+	require.Contains(t, dueIDs, costCenters[1].ID)
+	require.NotContains(t, dueIDs, costCenters[2].ID)
+	require.NotContains(t, dueIDs, costCenters[3].ID)
+}
+func TestBillingPeriodAt(t *testing.T) {
+	scenarios := []struct {
+		Name         string
+		Anchor       db.VarcharTime
+		At           time.Time
+		ExpectedFrom time.Time
+		ExpectedTo   time.Time
+	}{
+		{
+			Name:         "calendar month without anchor",
+			At:           time.Date(2022, 9, 15, 10, 0, 0, 0, time.UTC),
+			ExpectedFrom: time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC),
+			ExpectedTo:   time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			Name:         "mid-month anchor, after the anchor day",
+			Anchor:       db.NewVarcharTime(time.Date(2022, 3, 15, 12, 0, 0, 0, time.UTC)),
+			At:           time.Date(2022, 9, 20, 0, 0, 0, 0, time.UTC),
+			ExpectedFrom: time.Date(2022, 9, 15, 12, 0, 0, 0, time.UTC),
+			ExpectedTo:   time.Date(2022, 10, 15, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			Name:         "mid-month anchor, before the anchor day",
+			Anchor:       db.NewVarcharTime(time.Date(2022, 3, 15, 12, 0, 0, 0, time.UTC)),
+			At:           time.Date(2022, 9, 15, 11, 59, 0, 0, time.UTC),
+			ExpectedFrom: time.Date(2022, 8, 15, 12, 0, 0, 0, time.UTC),
+			ExpectedTo:   time.Date(2022, 9, 15, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			Name:         "anchor on the 31st in a short month",
+			Anchor:       db.NewVarcharTime(time.Date(2022, 1, 31, 0, 0, 0, 0, time.UTC)),
+			At:           time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC),
+			ExpectedFrom: time.Date(2022, 2, 28, 0, 0, 0, 0, time.UTC),
+			ExpectedTo:   time.Date(2022, 3, 31, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			Name:         "annual contract crossing the year",
+			Anchor:       db.NewVarcharTime(time.Date(2021, 11, 10, 0, 0, 0, 0, time.UTC)),
+			At:           time.Date(2022, 1, 5, 0, 0, 0, 0, time.UTC),
+			ExpectedFrom: time.Date(2021, 12, 10, 0, 0, 0, 0, time.UTC),
+			ExpectedTo:   time.Date(2022, 1, 10, 0, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.Name, func(t *testing.T) {
+			from, to := db.BillingPeriodAt(s.Anchor, s.At)
+			require.Equal(t, s.ExpectedFrom, from)
+			require.Equal(t, s.ExpectedTo, to)
+		})
+	}
+}
+
+func TestAdvanceNextBillingTime(t *testing.T) {
+	conn := dbtest.ConnectForTests(t)
+	nextBillingTime := time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)
+	costCenter := dbtest.CreateCostCenters(t, conn, db.CostCenter{NextBillingTime: db.NewVarcharTime(nextBillingTime)})[0]
+
+	advanced, err := db.AdvanceNextBillingTime(context.Background(), conn, costCenter.ID, nextBillingTime, nextBillingTime.AddDate(0, 1, 0))
+	require.NoError(t, err)
+	require.True(t, advanced)
+
+	advanced, err = db.AdvanceNextBillingTime(context.Background(), conn, costCenter.ID, nextBillingTime, nextBillingTime.AddDate(0, 1, 0))
+	require.NoError(t, err)
+	require.False(t, advanced, "must not advance twice from the same billing time")
+
+	read, err := db.GetCostCenter(context.Background(), conn, costCenter.ID)
+	require.NoError(t, err)
+	require.Equal(t, db.TimeToISO8601(nextBillingTime.AddDate(0, 1, 0)), read.NextBillingTime.String())
+}
@@ -0,0 +1,330 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/relvacode/iso8601"
+	"gorm.io/gorm"
+)
+
+// CreditGrantUsageData represents the shape of metadata for usage entries of kind "creditgrant"
+// the equivalent TypeScript definition is maintained in `components/gitpod-protocol/src/usage.ts“
+type CreditGrantUsageData struct {
+	Reason    string `json:"reason"`
+	ExpiresAt string `json:"expiresAt"`
+	// PaymentIntentID is set for purchased credits, and references the payment in Stripe.
+	PaymentIntentID string `json:"paymentIntentId,omitempty"`
+}
+
+// CreditGrantExpiryUsageData represents the shape of metadata for usage entries of kind "creditgrantexpiry"
+// the equivalent TypeScript definition is maintained in `components/gitpod-protocol/src/usage.ts“
+type CreditGrantExpiryUsageData struct {
+	CreditGrantID string `json:"creditGrantId"`
+}
+
+func (u *Usage) SetMetadataWithCreditGrant(data CreditGrantUsageData) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to serialize credit grant usage data into json: %w", err)
+	}
+
+	u.Metadata = b
+	return nil
+}
+
+func (u *Usage) GetMetadataAsCreditGrantData() (CreditGrantUsageData, error) {
+	var data CreditGrantUsageData
+	err := json.Unmarshal(u.Metadata, &data)
+	if err != nil {
+		return CreditGrantUsageData{}, fmt.Errorf("failed unmarshal metadata into credit grant data: %w", err)
+	}
+
+	return data, nil
+}
+
+func (u *Usage) SetMetadataWithCreditGrantExpiry(data CreditGrantExpiryUsageData) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to serialize credit grant expiry usage data into json: %w", err)
+	}
+
+	u.Metadata = b
+	return nil
+}
+
+// CreditGrant is a usage entry of kind "creditgrant", together with the time its unused remainder expires.
+type CreditGrant struct {
+	Usage
+	ExpiresAt time.Time
+}
+
+// Credits returns the granted credits. They are stored as negative credit cents, because grants credit the balance.
+func (g CreditGrant) Credits() CreditCents {
+	return -g.CreditCents
+}
+
+// ActiveAt is true when usage at `t` can consume the grant.
+func (g CreditGrant) ActiveAt(t time.Time) bool {
+	return !t.Before(g.EffectiveTime.Time()) && t.Before(g.ExpiresAt)
+}
+
+// NewCreditGrant constructs the usage entry which grants `credits` to `attributionID` from `grantedAt` until
+// `expiresAt`.
+func NewCreditGrant(attributionID AttributionID, credits float64, reason string, grantedAt, expiresAt time.Time) (CreditGrant, error) {
+	usage := Usage{
+		ID:            uuid.New(),
+		AttributionID: attributionID,
+		Description:   fmt.Sprintf("Credit grant: %s", reason),
+		CreditCents:   -NewCreditCents(credits),
+		EffectiveTime: NewVarcharTime(grantedAt),
+		Kind:          CreditGrantUsageKind,
+	}
+	err := usage.SetMetadataWithCreditGrant(CreditGrantUsageData{
+		Reason:    reason,
+		ExpiresAt: TimeToISO8601(expiresAt),
+	})
+	if err != nil {
+		return CreditGrant{}, err
+	}
+	return CreditGrant{Usage: usage, ExpiresAt: expiresAt}, nil
+}
+
+// freeTierGrantNamespace and rolloverGrantNamespace are used to derive the ID of credit grants from the attribution ID
+// and the billing period, such that they are granted at most once per billing period.
+var (
+	freeTierGrantNamespace = uuid.MustParse("7d1b3c52-93e4-4f0a-b6a8-2c5e9f41d803")
+	rolloverGrantNamespace = uuid.MustParse("c4a9e2f7-1b6d-4e38-8f05-6d2b7a9c3e14")
+)
+
+func periodGrantID(namespace uuid.UUID, attributionID AttributionID, periodStart time.Time) uuid.UUID {
+	return uuid.NewSHA1(namespace, []byte(fmt.Sprintf("%s/%s", attributionID, TimeToISO8601(periodStart))))
+}
+
+// NewFreeTierCreditGrant constructs the grant of the free tier `credits` of `attributionID` for the billing period
+// [periodStart, periodEnd). Unused free tier credits expire at the end of the billing period.
+func NewFreeTierCreditGrant(attributionID AttributionID, credits float64, periodStart, periodEnd time.Time) (CreditGrant, error) {
+	grant, err := NewCreditGrant(attributionID, credits, fmt.Sprintf("Free tier %s", periodStart.Format("2006-01-02")), periodStart, periodEnd)
+	if err != nil {
+		return CreditGrant{}, err
+	}
+	grant.ID = periodGrantID(freeTierGrantNamespace, attributionID, periodStart)
+	return grant, nil
+}
+
+// NewRolloverCreditGrant constructs the grant which carries `credits` which were unused in the previous billing period
+// over into the billing period [periodStart, periodEnd).
+func NewRolloverCreditGrant(attributionID AttributionID, credits CreditCents, periodStart, periodEnd time.Time) (CreditGrant, error) {
+	grant, err := NewCreditGrant(attributionID, credits.ToCredits(), fmt.Sprintf("Rollover into %s", periodStart.Format("2006-01-02")), periodStart, periodEnd)
+	if err != nil {
+		return CreditGrant{}, err
+	}
+	grant.ID = periodGrantID(rolloverGrantNamespace, attributionID, periodStart)
+	return grant, nil
+}
+
+// PurchasedCreditsValidity is how long purchased credits can be used.
+const PurchasedCreditsValidity = 365 * 24 * time.Hour
+
+// purchaseGrantNamespace is used to derive the ID of the credit grant from the ID of the payment intent, such that
+// every payment grants credits at most once.
+var purchaseGrantNamespace = uuid.MustParse("e83f1a6c-5b27-4d9e-a0c4-7f2d8b1e6a95")
+
+// NewPurchasedCreditGrant constructs the grant of `credits` which `attributionID` paid for with the payment intent.
+func NewPurchasedCreditGrant(attributionID AttributionID, credits float64, paymentIntentID string, paidAt time.Time) (CreditGrant, error) {
+	expiresAt := paidAt.Add(PurchasedCreditsValidity)
+	grant, err := NewCreditGrant(attributionID, credits, "Purchased credits", paidAt, expiresAt)
+	if err != nil {
+		return CreditGrant{}, err
+	}
+	grant.ID = uuid.NewSHA1(purchaseGrantNamespace, []byte(paymentIntentID))
+	err = grant.SetMetadataWithCreditGrant(CreditGrantUsageData{
+		Reason:          "Purchased credits",
+		ExpiresAt:       TimeToISO8601(expiresAt),
+		PaymentIntentID: paymentIntentID,
+	})
+	if err != nil {
+		return CreditGrant{}, err
+	}
+	return grant, nil
+}
+
+// NewCreditGrantExpiry constructs the usage entry which debits the unused `remainder` of the grant when it expires.
+// Its ID is derived from the ID of the grant, such that every grant expires at most once.
+func NewCreditGrantExpiry(grant CreditGrant, remainder CreditCents) (Usage, error) {
+	usage := Usage{
+		ID:            creditGrantExpiryID(grant.ID),
+		AttributionID: grant.AttributionID,
+		Description:   fmt.Sprintf("Expired credit grant %s", grant.ID),
+		CreditCents:   remainder,
+		EffectiveTime: NewVarcharTime(grant.ExpiresAt),
+		Kind:          CreditGrantExpiryUsageKind,
+	}
+	err := usage.SetMetadataWithCreditGrantExpiry(CreditGrantExpiryUsageData{
+		CreditGrantID: grant.ID.String(),
+	})
+	if err != nil {
+		return Usage{}, err
+	}
+	return usage, nil
+}
+
+func creditGrantExpiryID(grantID uuid.UUID) uuid.UUID {
+	return uuid.NewSHA1(grantID, []byte("expire"))
+}
+
+func creditGrantFromUsage(usage Usage) (CreditGrant, error) {
+	data, err := usage.GetMetadataAsCreditGrantData()
+	if err != nil {
+		return CreditGrant{}, err
+	}
+	expiresAt, err := iso8601.ParseString(data.ExpiresAt)
+	if err != nil {
+		return CreditGrant{}, fmt.Errorf("failed to parse expiry of credit grant %s: %w", usage.ID, err)
+	}
+	return CreditGrant{Usage: usage, ExpiresAt: expiresAt.UTC()}, nil
+}
+
+// FindCreditGrants returns the credit grants of the attribution IDs, ordered by the time they were granted.
+func FindCreditGrants(ctx context.Context, conn *gorm.DB, attributionIds ...AttributionID) ([]CreditGrant, error) {
+	var records []Usage
+	result := conn.WithContext(ctx).
+		Scopes(notSoftDeletedUsage).
+		Where("kind = ?", CreditGrantUsageKind).
+		Where("attributionId IN ?", attributionIds).
+		Order("effectiveTime ASC").
+		Find(&records)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to find credit grants: %w", result.Error)
+	}
+
+	var grants []CreditGrant
+	for _, record := range records {
+		grant, err := creditGrantFromUsage(record)
+		if err != nil {
+			return nil, err
+		}
+		grants = append(grants, grant)
+	}
+	return grants, nil
+}
+
+// FindExpiredCreditGrants returns the credit grants which expired at or before `t`, and whose unused remainder was not
+// expired yet.
+func FindExpiredCreditGrants(ctx context.Context, conn *gorm.DB, t time.Time) ([]CreditGrant, error) {
+	var records []Usage
+	result := conn.WithContext(ctx).
+		Scopes(notSoftDeletedUsage).
+		Where("kind = ?", CreditGrantUsageKind).
+		Order("effectiveTime ASC").
+		Find(&records)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to find credit grants: %w", result.Error)
+	}
+
+	var expired []CreditGrant
+	var expiryIDs []string
+	for _, record := range records {
+		grant, err := creditGrantFromUsage(record)
+		if err != nil {
+			return nil, err
+		}
+		if grant.ExpiresAt.After(t) {
+			continue
+		}
+		expired = append(expired, grant)
+		expiryIDs = append(expiryIDs, creditGrantExpiryID(grant.ID).String())
+	}
+	if len(expired) == 0 {
+		return nil, nil
+	}
+
+	var existingExpiryIDs []string
+	result = conn.WithContext(ctx).
+		Model(&Usage{}).
+		Where("id IN ?", expiryIDs).
+		Pluck("id", &existingExpiryIDs)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to find credit grant expiries: %w", result.Error)
+	}
+	alreadyExpired := map[string]bool{}
+	for _, id := range existingExpiryIDs {
+		alreadyExpired[id] = true
+	}
+
+	var pending []CreditGrant
+	for i, grant := range expired {
+		if !alreadyExpired[expiryIDs[i]] {
+			pending = append(pending, grant)
+		}
+	}
+	return pending, nil
+}
+
+// CreditGrantAllocation describes which usage consumed which credit grants.
+type CreditGrantAllocation struct {
+	// Remaining is the unused remainder of every credit grant, by ID of the grant.
+	Remaining map[uuid.UUID]CreditCents
+	// Covered is the part of every usage entry which was paid for with granted credits, by ID of the usage entry.
+	Covered map[uuid.UUID]CreditCents
+}
+
+// AllocateCreditGrants consumes the credit grants with the workspace usage, in the order in which the usage occurred.
+// Usage consumes the grant which expires first among the grants that are active when the usage occurs. Usage which
+// exceeds the active grants is not covered, and is billed. Negative usage, e.g. voided usage, does not restore grants.
+func AllocateCreditGrants(grants []CreditGrant, usage []Usage) CreditGrantAllocation {
+	allocation := CreditGrantAllocation{
+		Remaining: map[uuid.UUID]CreditCents{},
+		Covered:   map[uuid.UUID]CreditCents{},
+	}
+
+	byExpiry := make([]CreditGrant, len(grants))
+	copy(byExpiry, grants)
+	sort.SliceStable(byExpiry, func(i, j int) bool {
+		return byExpiry[i].ExpiresAt.Before(byExpiry[j].ExpiresAt)
+	})
+	for _, grant := range byExpiry {
+		allocation.Remaining[grant.ID] = grant.Credits()
+	}
+
+	chronological := make([]Usage, 0, len(usage))
+	for _, entry := range usage {
+		if entry.Kind == WorkspaceInstanceUsageKind && entry.CreditCents > 0 {
+			chronological = append(chronological, entry)
+		}
+	}
+	sort.SliceStable(chronological, func(i, j int) bool {
+		return chronological[i].EffectiveTime.Time().Before(chronological[j].EffectiveTime.Time())
+	})
+
+	for _, entry := range chronological {
+		uncovered := entry.CreditCents
+		for _, grant := range byExpiry {
+			if uncovered == 0 {
+				break
+			}
+			remaining := allocation.Remaining[grant.ID]
+			if remaining <= 0 || !grant.ActiveAt(entry.EffectiveTime.Time()) {
+				continue
+			}
+
+			consumed := remaining
+			if uncovered < consumed {
+				consumed = uncovered
+			}
+			allocation.Remaining[grant.ID] = remaining - consumed
+			allocation.Covered[entry.ID] += consumed
+			uncovered -= consumed
+		}
+	}
+
+	return allocation
+}
@@ -0,0 +1,162 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/db/dbtest"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllocateCreditGrants(t *testing.T) {
+	team := db.NewTeamAttributionID(uuid.New().String())
+	start := time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC)
+
+	newGrant := func(credits float64, grantedAt, expiresAt time.Time) db.CreditGrant {
+		grant, err := db.NewCreditGrant(team, credits, "campaign", grantedAt, expiresAt)
+		require.NoError(t, err)
+		return grant
+	}
+	newUsage := func(creditCents db.CreditCents, at time.Time) db.Usage {
+		return dbtest.NewUsage(t, db.Usage{AttributionID: team, CreditCents: creditCents, EffectiveTime: db.NewVarcharTime(at)})
+	}
+
+	t.Run("usage consumes the grant which expires first", func(t *testing.T) {
+		late := newGrant(10, start, start.AddDate(0, 2, 0))
+		early := newGrant(5, start, start.AddDate(0, 1, 0))
+		usage := newUsage(700, start.Add(time.Hour))
+
+		allocation := db.AllocateCreditGrants([]db.CreditGrant{late, early}, []db.Usage{usage})
+		require.Equal(t, db.CreditCents(0), allocation.Remaining[early.ID])
+		require.Equal(t, db.CreditCents(800), allocation.Remaining[late.ID])
+		require.Equal(t, db.CreditCents(700), allocation.Covered[usage.ID])
+	})
+
+	t.Run("usage exceeding the grants is not covered", func(t *testing.T) {
+		grant := newGrant(5, start, start.AddDate(0, 1, 0))
+		first := newUsage(300, start.Add(time.Hour))
+		second := newUsage(300, start.Add(2*time.Hour))
+
+		allocation := db.AllocateCreditGrants([]db.CreditGrant{grant}, []db.Usage{second, first})
+		require.Equal(t, db.CreditCents(0), allocation.Remaining[grant.ID])
+		require.Equal(t, db.CreditCents(300), allocation.Covered[first.ID], "earlier usage must consume the grant first")
+		require.Equal(t, db.CreditCents(200), allocation.Covered[second.ID])
+	})
+
+	t.Run("usage outside of the grant period does not consume it", func(t *testing.T) {
+		grant := newGrant(5, start, start.AddDate(0, 1, 0))
+		before := newUsage(100, start.Add(-time.Hour))
+		after := newUsage(100, start.AddDate(0, 1, 0))
+
+		allocation := db.AllocateCreditGrants([]db.CreditGrant{grant}, []db.Usage{before, after})
+		require.Equal(t, db.CreditCents(500), allocation.Remaining[grant.ID])
+		require.Zero(t, allocation.Covered[before.ID])
+		require.Zero(t, allocation.Covered[after.ID])
+	})
+
+	t.Run("invoices and voided usage do not consume grants", func(t *testing.T) {
+		grant := newGrant(5, start, start.AddDate(0, 1, 0))
+		invoice := dbtest.NewUsage(t, db.Usage{AttributionID: team, CreditCents: 100, Kind: db.InvoiceUsageKind, EffectiveTime: db.NewVarcharTime(start.Add(time.Hour))})
+		voided := newUsage(-100, start.Add(time.Hour))
+
+		allocation := db.AllocateCreditGrants([]db.CreditGrant{grant}, []db.Usage{invoice, voided})
+		require.Equal(t, db.CreditCents(500), allocation.Remaining[grant.ID])
+	})
+}
+
+func TestFindExpiredCreditGrants(t *testing.T) {
+	conn := dbtest.ConnectForTests(t)
+
+	team := db.NewTeamAttributionID(uuid.New().String())
+	now := time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	expired, err := db.NewCreditGrant(team, 10, "expired", now.AddDate(0, -2, 0), now.Add(-time.Hour))
+	require.NoError(t, err)
+	alreadyExpired, err := db.NewCreditGrant(team, 10, "already expired", now.AddDate(0, -2, 0), now.Add(-2*time.Hour))
+	require.NoError(t, err)
+	active, err := db.NewCreditGrant(team, 10, "active", now.AddDate(0, -1, 0), now.Add(time.Hour))
+	require.NoError(t, err)
+	expiry, err := db.NewCreditGrantExpiry(alreadyExpired, 1000)
+	require.NoError(t, err)
+
+	dbtest.CreateUsageRecords(t, conn, expired.Usage, alreadyExpired.Usage, active.Usage, expiry)
+
+	grants, err := db.FindCreditGrants(context.Background(), conn, team)
+	require.NoError(t, err)
+	require.Len(t, grants, 3)
+
+	pending, err := db.FindExpiredCreditGrants(context.Background(), conn, now)
+	require.NoError(t, err)
+	var pendingIDs []uuid.UUID
+	for _, grant := range pending {
+		pendingIDs = append(pendingIDs, grant.ID)
+	}
+	require.Contains(t, pendingIDs, expired.ID)
+	require.NotContains(t, pendingIDs, alreadyExpired.ID)
+	require.NotContains(t, pendingIDs, active.ID)
+}
+
+func TestNewFreeTierCreditGrant(t *testing.T) {
+	team := db.NewTeamAttributionID(uuid.New().String())
+	periodStart := time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)
+	periodEnd := periodStart.AddDate(0, 1, 0)
+
+	grant, err := db.NewFreeTierCreditGrant(team, 50, periodStart, periodEnd)
+	require.NoError(t, err)
+	require.Equal(t, db.CreditCents(5000), grant.Credits())
+	require.Equal(t, periodEnd, grant.ExpiresAt)
+	require.True(t, grant.ActiveAt(periodStart))
+	require.False(t, grant.ActiveAt(periodEnd))
+
+	again, err := db.NewFreeTierCreditGrant(team, 50, periodStart, periodEnd)
+	require.NoError(t, err)
+	require.Equal(t, grant.ID, again.ID, "must grant every billing period at most once")
+
+	next, err := db.NewFreeTierCreditGrant(team, 50, periodEnd, periodEnd.AddDate(0, 1, 0))
+	require.NoError(t, err)
+	require.NotEqual(t, grant.ID, next.ID)
+}
+
+func TestNewRolloverCreditGrant(t *testing.T) {
+	team := db.NewTeamAttributionID(uuid.New().String())
+	periodStart := time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)
+	periodEnd := periodStart.AddDate(0, 1, 0)
+
+	grant, err := db.NewRolloverCreditGrant(team, 1000, periodStart, periodEnd)
+	require.NoError(t, err)
+	require.Equal(t, db.CreditCents(1000), grant.Credits())
+	require.Equal(t, periodEnd, grant.ExpiresAt)
+
+	again, err := db.NewRolloverCreditGrant(team, 1000, periodStart, periodEnd)
+	require.NoError(t, err)
+	require.Equal(t, grant.ID, again.ID, "must roll over into every billing period at most once")
+
+	freeTier, err := db.NewFreeTierCreditGrant(team, 10, periodStart, periodEnd)
+	require.NoError(t, err)
+	require.NotEqual(t, grant.ID, freeTier.ID, "must not collide with the free tier grant of the same period")
+}
+
+func TestNewPurchasedCreditGrant(t *testing.T) {
+	team := db.NewTeamAttributionID(uuid.New().String())
+	paidAt := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	grant, err := db.NewPurchasedCreditGrant(team, 1000, "pi_123", paidAt)
+	require.NoError(t, err)
+	require.Equal(t, db.CreditCents(100000), grant.Credits())
+	require.Equal(t, paidAt.Add(db.PurchasedCreditsValidity), grant.ExpiresAt)
+
+	data, err := grant.GetMetadataAsCreditGrantData()
+	require.NoError(t, err)
+	require.Equal(t, "pi_123", data.PaymentIntentID)
+
+	again, err := db.NewPurchasedCreditGrant(team, 1000, "pi_123", paidAt.Add(time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, grant.ID, again.ID, "must grant every payment at most once")
+}
@@ -0,0 +1,122 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package dbtest
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	createdRowsKey = "dbtest:created_rows"
+)
+
+// createdRows records the rows created by a single test. Connections from ConnectForTests are tagged with the createdRows
+// of their test, such that the rows are deleted when that test completes, even when the test does not clean up itself.
+type createdRows struct {
+	mu   sync.Mutex
+	rows []createdRow
+}
+
+type createdRow struct {
+	table string
+	// primaryKey maps the primary key columns to the values of the row.
+	primaryKey map[string]interface{}
+}
+
+func (c *createdRows) add(row createdRow) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.rows = append(c.rows, row)
+}
+
+// trackCreatedRows registers a callback recording the rows created through sessions returned by trackedSession.
+func trackCreatedRows(conn *gorm.DB) error {
+	return conn.Callback().Create().After("gorm:create").Register("dbtest:track_created_rows", func(tx *gorm.DB) {
+		if tx.Error != nil || tx.Statement.Schema == nil || len(tx.Statement.Schema.PrimaryFields) == 0 {
+			return
+		}
+		v, ok := tx.Get(createdRowsKey)
+		if !ok {
+			return
+		}
+		created := v.(*createdRows)
+
+		rv := reflect.Indirect(tx.Statement.ReflectValue)
+		if !insertedAllRows(tx, rv) {
+			return
+		}
+
+		record := func(value reflect.Value) {
+			row := createdRow{table: tx.Statement.Table, primaryKey: map[string]interface{}{}}
+			for _, field := range tx.Statement.Schema.PrimaryFields {
+				pk, zero := field.ValueOf(tx.Statement.Context, value)
+				if zero {
+					return
+				}
+				row.primaryKey[field.DBName] = pk
+			}
+			created.add(row)
+		}
+
+		switch rv.Kind() {
+		case reflect.Slice, reflect.Array:
+			for i := 0; i < rv.Len(); i++ {
+				record(reflect.Indirect(rv.Index(i)))
+			}
+		case reflect.Struct:
+			record(rv)
+		}
+	})
+}
+
+// insertedAllRows returns whether the statement inserted every row of value. Statements with an ON CONFLICT clause
+// may skip or update existing rows, which must not be deleted by the test. As MySQL reports one affected row per
+// insert and two per update, only rows of statements affecting exactly one row per inserted row are tracked, which
+// for upserts is unambiguous only when inserting a single row.
+func insertedAllRows(tx *gorm.DB, value reflect.Value) bool {
+	c, ok := tx.Statement.Clauses[clause.OnConflict{}.Name()]
+	if !ok {
+		return true
+	}
+	rows := int64(1)
+	if value.Kind() == reflect.Slice || value.Kind() == reflect.Array {
+		rows = int64(value.Len())
+	}
+	if onConflict, ok := c.Expression.(clause.OnConflict); ok && !onConflict.DoNothing && rows != 1 {
+		return false
+	}
+	return tx.RowsAffected == rows
+}
+
+// trackedSession returns a session of conn which records the rows it creates, and deletes them when the test completes.
+func trackedSession(t *testing.T, conn *gorm.DB) *gorm.DB {
+	t.Helper()
+
+	created := &createdRows{}
+	t.Cleanup(func() {
+		created.mu.Lock()
+		defer created.mu.Unlock()
+
+		// Delete in reverse order of creation, such that rows referencing others are removed first.
+		for i := len(created.rows) - 1; i >= 0; i-- {
+			row := created.rows[i]
+			var conditions []clause.Expression
+			for column, value := range row.primaryKey {
+				conditions = append(conditions, clause.Eq{Column: clause.Column{Name: column}, Value: value})
+			}
+			require.NoError(t, conn.Exec("DELETE FROM ? WHERE ?", clause.Table{Name: row.table}, clause.And(conditions...)).Error,
+				"Failed to delete row of table %s created by test %s", row.table, t.Name())
+		}
+	})
+
+	return conn.Session(&gorm.Session{}).Set(createdRowsKey, created).Session(&gorm.Session{})
+}
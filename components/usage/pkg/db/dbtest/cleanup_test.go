@@ -0,0 +1,78 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package dbtest
+
+import (
+	"testing"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func TestTrackedSession_DeletesCreatedRows(t *testing.T) {
+	conn := ConnectInMemoryForTests(t)
+	require.NoError(t, trackCreatedRows(conn))
+
+	untracked := db.Team{ID: uuid.New(), Name: "untracked"}
+	require.NoError(t, conn.Create(&untracked).Error)
+
+	t.Run("creates rows", func(t *testing.T) {
+		tracked := trackedSession(t, conn)
+
+		require.NoError(t, tracked.Create(&db.Team{ID: uuid.New(), Name: "tracked"}).Error)
+		workspaces := []db.Workspace{NewWorkspace(t, db.Workspace{}), NewWorkspace(t, db.Workspace{})}
+		require.NoError(t, tracked.Create(&workspaces).Error)
+		require.NoError(t, tracked.Transaction(func(tx *gorm.DB) error {
+			return tx.Create(&db.CostCenterSplit{
+				AttributionID:       db.NewTeamAttributionID(uuid.New().String()),
+				TargetAttributionID: db.NewTeamAttributionID(uuid.New().String()),
+				Percentage:          50,
+			}).Error
+		}))
+
+		var count int64
+		require.NoError(t, conn.Model(&db.Workspace{}).Count(&count).Error)
+		require.EqualValues(t, 2, count)
+	})
+
+	var teams []db.Team
+	require.NoError(t, conn.Find(&teams).Error)
+	require.Len(t, teams, 1)
+	require.Equal(t, untracked.ID, teams[0].ID)
+
+	for _, model := range []interface{}{&db.Workspace{}, &db.CostCenterSplit{}} {
+		var count int64
+		require.NoError(t, conn.Model(model).Count(&count).Error)
+		require.Zero(t, count)
+	}
+}
+
+func TestTrackedSession_KeepsRowsSkippedOnConflict(t *testing.T) {
+	conn := ConnectInMemoryForTests(t)
+	require.NoError(t, trackCreatedRows(conn))
+
+	existing := db.Team{ID: uuid.New(), Name: "existing"}
+	require.NoError(t, conn.Create(&existing).Error)
+
+	t.Run("creates rows on conflict", func(t *testing.T) {
+		tracked := trackedSession(t, conn)
+
+		require.NoError(t, tracked.Clauses(clause.OnConflict{DoNothing: true}).Create(&db.Team{ID: existing.ID, Name: "skipped"}).Error)
+		require.NoError(t, tracked.Clauses(clause.OnConflict{DoNothing: true}).Create(&[]db.Team{
+			{ID: existing.ID, Name: "skipped"},
+			{ID: uuid.New(), Name: "inserted"},
+		}).Error)
+		require.NoError(t, tracked.Clauses(clause.OnConflict{DoNothing: true}).Create(&db.Team{ID: uuid.New(), Name: "tracked"}).Error)
+	})
+
+	var teams []db.Team
+	require.NoError(t, conn.Order("name").Find(&teams).Error)
+	require.Len(t, teams, 2, "must keep existing rows, and rows of statements which skipped some rows")
+	require.Equal(t, existing.ID, teams[0].ID)
+	require.Equal(t, "inserted", teams[1].Name)
+}
@@ -17,9 +17,17 @@ var (
 	conn     *gorm.DB
 )
 
+// ConnectForTests connects to the MySQL test database. Rows created through the returned connection are deleted when the
+// test completes.
 func ConnectForTests(t *testing.T) *gorm.DB {
 	t.Helper()
 
+	return trackedSession(t, connectForTests(t))
+}
+
+func connectForTests(t *testing.T) *gorm.DB {
+	t.Helper()
+
 	connLock.Lock()
 	defer connLock.Unlock()
 
@@ -37,6 +45,7 @@ func ConnectForTests(t *testing.T) *gorm.DB {
 		Database: "gitpod",
 	})
 	require.NoError(t, err, "Failed to establish connection to DB. In a workspace, run `leeway build components/usage:init-testdb` once to bootstrap the DB.")
+	require.NoError(t, trackCreatedRows(conn))
 
 	return conn
 }
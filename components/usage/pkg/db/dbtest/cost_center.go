@@ -0,0 +1,81 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package dbtest
+
+import (
+	"testing"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func NewCostCenter(t *testing.T, costCenter db.CostCenter) db.CostCenter {
+	t.Helper()
+
+	result := db.CostCenter{
+		ID:                db.NewTeamAttributionID(uuid.New().String()),
+		SpendingLimit:     100,
+		BillingStrategy:   db.CostCenter_Other,
+		SpendingLimitType: db.SpendingLimitType_Hard,
+		Currency:          db.DefaultCurrency,
+		State:             db.CostCenterState_Active,
+	}
+
+	if costCenter.ID != "" {
+		result.ID = costCenter.ID
+	}
+	if costCenter.SpendingLimit != 0 {
+		result.SpendingLimit = costCenter.SpendingLimit
+	}
+	if costCenter.BillingStrategy != "" {
+		result.BillingStrategy = costCenter.BillingStrategy
+	}
+	if costCenter.SpendingLimitType != "" {
+		result.SpendingLimitType = costCenter.SpendingLimitType
+	}
+	if costCenter.Currency != "" {
+		result.Currency = costCenter.Currency
+	}
+	if costCenter.State != "" {
+		result.State = costCenter.State
+	}
+	if costCenter.BillingCycleAnchor.IsSet() {
+		result.BillingCycleAnchor = costCenter.BillingCycleAnchor
+	}
+	if costCenter.PaymentFailedAt.IsSet() {
+		result.PaymentFailedAt = costCenter.PaymentFailedAt
+	}
+	if costCenter.NextBillingTime.IsSet() {
+		result.NextBillingTime = costCenter.NextBillingTime
+	}
+	if costCenter.RolloverLimit != 0 {
+		result.RolloverLimit = costCenter.RolloverLimit
+	}
+	if costCenter.Debt != 0 {
+		result.Debt = costCenter.Debt
+	}
+	return result
+}
+
+func CreateCostCenters(t *testing.T, conn *gorm.DB, costCenters ...db.CostCenter) []db.CostCenter {
+	t.Helper()
+
+	var records []db.CostCenter
+	var ids []db.AttributionID
+	for _, costCenter := range costCenters {
+		record := NewCostCenter(t, costCenter)
+		records = append(records, record)
+		ids = append(ids, record.ID)
+	}
+
+	require.NoError(t, conn.CreateInBatches(&records, 1000).Error)
+	t.Cleanup(func() {
+		require.NoError(t, conn.Where("id IN ?", ids).Delete(&db.CostCenter{}).Error)
+	})
+
+	return records
+}
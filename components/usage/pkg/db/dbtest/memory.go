@@ -0,0 +1,96 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package dbtest
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// InMemoryDisabledEnv names the environment variable which, when set to "true", makes ConnectInMemoryForTests
+// connect to the MySQL test database instead. Full integration runs use it to exercise all tests against MySQL.
+const InMemoryDisabledEnv = "USAGE_TEST_DISABLE_IN_MEMORY_DB"
+
+// ConnectInMemoryForTests connects to a new, empty in-memory SQLite database with the tables of the usage models.
+// Unlike ConnectForTests it requires no running MySQL server, and every test gets its own database.
+// Queries relying on MySQL features (JSON functions, ON DUPLICATE KEY UPDATE, information_schema, FOR UPDATE)
+// still need ConnectForTests.
+//
+// Falls back to ConnectForTests when SQLite is unavailable (binaries built with CGO_ENABLED=0) or disabled through InMemoryDisabledEnv.
+func ConnectInMemoryForTests(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	if os.Getenv(InMemoryDisabledEnv) == "true" {
+		return ConnectForTests(t)
+	}
+
+	conn, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Logf("In-memory database unavailable, using MySQL instead: %v", err)
+		return ConnectForTests(t)
+	}
+	sqlDB, err := conn.DB()
+	require.NoError(t, err)
+	// Every connection to ":memory:" opens a separate database, hence all queries must share a single one.
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() {
+		_ = sqlDB.Close()
+	})
+
+	for _, model := range inMemoryModels {
+		// Parsed schemas are cached by the connection, such that the migration uses the adapted defaults.
+		stmt := &gorm.Statement{DB: conn}
+		require.NoError(t, stmt.Parse(model))
+		for _, field := range stmt.Schema.Fields {
+			field.DefaultValue = strings.ReplaceAll(field.DefaultValue, "CURRENT_TIMESTAMP(6)", "CURRENT_TIMESTAMP")
+		}
+		require.NoError(t, conn.AutoMigrate(model))
+	}
+	// The archive tables have the same columns as the tables they archive.
+	require.NoError(t, conn.Table(db.UsageArchiveTableName).AutoMigrate(&db.Usage{}))
+	require.NoError(t, conn.Table(db.WorkspaceInstanceUsageArchiveTableName).AutoMigrate(&db.WorkspaceInstanceUsage{}))
+	// Cost centers are marked as deleted through a column which only db-sync writes, it is not part of the model.
+	require.NoError(t, conn.Exec("ALTER TABLE d_b_cost_center ADD COLUMN deleted BOOLEAN NOT NULL DEFAULT 0").Error)
+	return conn
+}
+
+var inMemoryModels = []interface{}{
+	&db.AttributionMigration{},
+	&db.AuditEvent{},
+	&db.BilledSession{},
+	&db.BillingStrategyTransition{},
+	&db.BudgetNotification{},
+	&db.CachedBalance{},
+	&db.CostCenter{},
+	&db.CostCenterSplit{},
+	&db.PlanChange{},
+	&db.Project{},
+	&db.ProjectBudget{},
+	&db.ReconciliationAudit{},
+	&db.ReportJob{},
+	&db.RetentionPolicy{},
+	&db.SpendingLimitChange{},
+	&db.StripeWebhookEvent{},
+	&db.Team{},
+	&db.TeamMembership{},
+	&db.Usage{},
+	&db.UsageDailySummary{},
+	&db.UsageDailySummaryState{},
+	&db.UsageExport{},
+	&db.UsageKey{},
+	&db.UsageMilestone{},
+	&db.UsageWebhook{},
+	&db.UsageWebhookDelivery{},
+	&db.Workspace{},
+	&db.WorkspaceInstance{},
+	&db.WorkspaceInstanceUsage{},
+}
@@ -0,0 +1,222 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package dbtest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+const (
+	runningWorkspaceInstanceStatus = `{"phase": "running", "conditions": {"deployed": true, "pullingImages": false, "serviceExists": true}}`
+)
+
+// ScenarioBuilder builds linked test records: workspaces and instances are owned by the scenario's user and attributed to
+// its team (or the user, when no team is set), and drafts reference the instance they account for.
+// Use Scenario to create one, and Build or Create to obtain the records.
+type ScenarioBuilder struct {
+	now     time.Time
+	ownerID uuid.UUID
+	team    *db.Team
+
+	instances []scenarioInstance
+	drafts    []scenarioDraft
+}
+
+type scenarioInstance struct {
+	instance db.WorkspaceInstance
+	running  bool
+}
+
+type scenarioDraft struct {
+	usage db.Usage
+	// instance is the index of the instance the draft accounts for.
+	instance int
+}
+
+// ScenarioRecords are the records of a scenario, in the order in which they were added to the builder.
+type ScenarioRecords struct {
+	// Team is nil, unless the scenario was built with WithTeam.
+	Team          *db.Team
+	Membership    *db.TeamMembership
+	OwnerID       uuid.UUID
+	AttributionID db.AttributionID
+	Workspaces    []db.Workspace
+	Instances     []db.WorkspaceInstance
+	Drafts        []db.Usage
+}
+
+// Scenario starts a new scenario for a new user, at the current time.
+func Scenario() *ScenarioBuilder {
+	return &ScenarioBuilder{
+		now:     time.Now().UTC(),
+		ownerID: uuid.New(),
+	}
+}
+
+// At sets the current time of the scenario, from which default start times of instances are derived.
+func (s *ScenarioBuilder) At(now time.Time) *ScenarioBuilder {
+	s.now = now.UTC()
+	return s
+}
+
+// WithOwner sets the user owning the workspaces of the scenario.
+func (s *ScenarioBuilder) WithOwner(ownerID uuid.UUID) *ScenarioBuilder {
+	s.ownerID = ownerID
+	return s
+}
+
+// WithTeam attributes the scenario to a team, of which the owner is a member. Unset fields of the team get default values.
+func (s *ScenarioBuilder) WithTeam(team db.Team) *ScenarioBuilder {
+	if team.ID.ID() == 0 {
+		team.ID = uuid.New()
+	}
+	if team.Name == "" {
+		team.Name = "Team " + team.ID.String()
+	}
+	if team.Slug == "" {
+		team.Slug = "team-" + team.ID.String()
+	}
+	if !team.CreationTime.IsSet() {
+		team.CreationTime = db.NewVarcharTime(s.now)
+	}
+	s.team = &team
+	return s
+}
+
+// WithRunningInstance adds a running instance of a new workspace. Unless set, the instance started an hour ago.
+func (s *ScenarioBuilder) WithRunningInstance(instance db.WorkspaceInstance) *ScenarioBuilder {
+	if !instance.StartedTime.IsSet() {
+		instance.StartedTime = db.NewVarcharTime(s.now.Add(-1 * time.Hour))
+	}
+	instance.StoppingTime = db.VarcharTime{}
+	instance.StoppedTime = db.VarcharTime{}
+	s.instances = append(s.instances, scenarioInstance{instance: instance, running: true})
+	return s
+}
+
+// WithStoppedInstance adds a stopped instance of a new workspace. Unless set, the instance started two hours ago and
+// stopped an hour later.
+func (s *ScenarioBuilder) WithStoppedInstance(instance db.WorkspaceInstance) *ScenarioBuilder {
+	if !instance.StartedTime.IsSet() {
+		instance.StartedTime = db.NewVarcharTime(s.now.Add(-2 * time.Hour))
+	}
+	if !instance.StoppingTime.IsSet() {
+		instance.StoppingTime = db.NewVarcharTime(instance.StartedTime.Time().Add(time.Hour))
+	}
+	if !instance.StoppedTime.IsSet() {
+		instance.StoppedTime = instance.StoppingTime
+	}
+	s.instances = append(s.instances, scenarioInstance{instance: instance})
+	return s
+}
+
+// WithDraft adds draft usage for the most recently added instance. Unset fields are derived from the instance.
+func (s *ScenarioBuilder) WithDraft(usage db.Usage) *ScenarioBuilder {
+	s.drafts = append(s.drafts, scenarioDraft{usage: usage, instance: len(s.instances) - 1})
+	return s
+}
+
+// Build returns the records of the scenario without storing them.
+func (s *ScenarioBuilder) Build(t *testing.T) ScenarioRecords {
+	t.Helper()
+
+	records := ScenarioRecords{
+		OwnerID:       s.ownerID,
+		AttributionID: db.NewUserAttributionID(s.ownerID.String()),
+	}
+	if s.team != nil {
+		team := *s.team
+		records.Team = &team
+		records.Membership = &db.TeamMembership{
+			ID:           uuid.New(),
+			TeamID:       team.ID,
+			UserID:       s.ownerID,
+			Role:         db.TeamMembershipRole_Owner,
+			CreationTime: team.CreationTime,
+		}
+		records.AttributionID = db.NewTeamAttributionID(team.ID.String())
+	}
+
+	for _, si := range s.instances {
+		workspace := NewWorkspace(t, db.Workspace{OwnerID: s.ownerID})
+
+		instance := si.instance
+		instance.WorkspaceID = workspace.ID
+		instance.UsageAttributionID = records.AttributionID
+		if si.running && instance.Status.String() == "" {
+			instance.Status = []byte(runningWorkspaceInstanceStatus)
+		}
+		instance = NewWorkspaceInstance(t, instance)
+		instance.PhasePersisted = "stopped"
+		if si.running {
+			instance.PhasePersisted = "running"
+		}
+
+		records.Workspaces = append(records.Workspaces, workspace)
+		records.Instances = append(records.Instances, instance)
+	}
+
+	for _, sd := range s.drafts {
+		require.GreaterOrEqual(t, sd.instance, 0, "WithDraft must follow the instance the draft accounts for")
+		instance := records.Instances[sd.instance]
+
+		usage := sd.usage
+		usage.WorkspaceInstanceID = instance.ID
+		usage.AttributionID = records.AttributionID
+		usage.Kind = db.WorkspaceInstanceUsageKind
+		usage.Draft = true
+		if !usage.EffectiveTime.IsSet() {
+			usage.EffectiveTime = db.NewVarcharTime(s.now)
+		}
+		if usage.Metadata == nil {
+			var endTime string
+			if instance.StoppingTime.IsSet() {
+				endTime = db.TimeToISO8601(instance.StoppingTime.Time())
+			}
+			require.NoError(t, usage.SetMetadataWithWorkspaceInstance(db.WorkspaceInstanceUsageData{
+				WorkspaceId:    instance.WorkspaceID,
+				WorkspaceType:  db.WorkspaceType_Regular,
+				WorkspaceClass: instance.WorkspaceClass,
+				StartTime:      db.TimeToISO8601(instance.StartedTime.Time()),
+				EndTime:        endTime,
+			}))
+		}
+
+		records.Drafts = append(records.Drafts, NewUsage(t, usage))
+	}
+
+	return records
+}
+
+// Create stores the records of the scenario, and removes them when the test completes.
+func (s *ScenarioBuilder) Create(t *testing.T, conn *gorm.DB) ScenarioRecords {
+	t.Helper()
+
+	records := s.Build(t)
+
+	if records.Team != nil {
+		require.NoError(t, conn.Create(records.Team).Error)
+		require.NoError(t, conn.Create(records.Membership).Error)
+		t.Cleanup(func() {
+			require.NoError(t, conn.Delete(records.Membership).Error)
+			require.NoError(t, conn.Delete(records.Team).Error)
+		})
+	}
+	if len(records.Workspaces) > 0 {
+		CreateWorkspaces(t, conn, records.Workspaces...)
+		CreateWorkspaceInstances(t, conn, records.Instances...)
+	}
+	if len(records.Drafts) > 0 {
+		CreateUsageRecords(t, conn, records.Drafts...)
+	}
+
+	return records
+}
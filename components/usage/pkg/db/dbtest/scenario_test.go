@@ -0,0 +1,75 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package dbtest_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/db/dbtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScenario_Create(t *testing.T) {
+	conn := dbtest.ConnectInMemoryForTests(t)
+	now := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	records := dbtest.Scenario().
+		At(now).
+		WithTeam(db.Team{Name: "Gitpod"}).
+		WithRunningInstance(db.WorkspaceInstance{}).
+		WithDraft(db.Usage{CreditCents: 100}).
+		WithStoppedInstance(db.WorkspaceInstance{}).
+		WithDraft(db.Usage{}).
+		Create(t, conn)
+
+	require.NotNil(t, records.Team)
+	require.Equal(t, db.NewTeamAttributionID(records.Team.ID.String()), records.AttributionID)
+	require.Equal(t, records.OwnerID, records.Membership.UserID)
+	require.Len(t, records.Workspaces, 2)
+	require.Len(t, records.Instances, 2)
+	require.Len(t, records.Drafts, 2)
+
+	for i, instance := range records.Instances {
+		require.Equal(t, records.Workspaces[i].ID, instance.WorkspaceID)
+		require.Equal(t, records.OwnerID, records.Workspaces[i].OwnerID)
+		require.Equal(t, records.AttributionID, instance.UsageAttributionID)
+
+		draft := records.Drafts[i]
+		require.True(t, draft.Draft)
+		require.Equal(t, instance.ID, draft.WorkspaceInstanceID)
+		require.Equal(t, records.AttributionID, draft.AttributionID)
+
+		data, err := draft.GetMetadataAsWorkspaceInstanceData()
+		require.NoError(t, err)
+		require.Equal(t, instance.WorkspaceID, data.WorkspaceId)
+		require.Equal(t, db.TimeToISO8601(instance.StartedTime.Time()), data.StartTime)
+	}
+	require.Equal(t, db.NewCreditCents(1), records.Drafts[0].CreditCents)
+	require.Equal(t, db.NewVarcharTime(now.Add(-1*time.Hour)), records.Instances[0].StartedTime)
+	require.False(t, records.Instances[0].StoppingTime.IsSet())
+	require.True(t, records.Instances[1].StoppedTime.IsSet())
+
+	var stored []db.Usage
+	require.NoError(t, conn.Where("attributionId = ?", records.AttributionID).Order("creditCents DESC").Find(&stored).Error)
+	require.Len(t, stored, 2)
+	require.Equal(t, records.Drafts[0].ID, stored[0].ID)
+
+	var instances []db.WorkspaceInstance
+	require.NoError(t, conn.Where("usageAttributionId = ?", records.AttributionID).Find(&instances).Error)
+	require.Len(t, instances, 2)
+}
+
+func TestScenario_DefaultsToUserAttribution(t *testing.T) {
+	records := dbtest.Scenario().
+		WithRunningInstance(db.WorkspaceInstance{}).
+		Build(t)
+
+	require.Nil(t, records.Team)
+	require.Equal(t, db.NewUserAttributionID(records.OwnerID.String()), records.AttributionID)
+	require.Equal(t, records.AttributionID, records.Instances[0].UsageAttributionID)
+	require.Empty(t, records.Drafts)
+}
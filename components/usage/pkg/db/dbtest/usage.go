@@ -39,12 +39,16 @@ func NewUsage(t *testing.T, record db.Usage) db.Usage {
 	if record.Description != "" {
 		result.Description = record.Description
 	}
-	if record.CreditCents != 0 {
+	// Only usage of workspace instances defaults to non-zero credits, other kinds of usage may not change the balance.
+	if record.CreditCents != 0 || (record.Kind != "" && record.Kind != db.WorkspaceInstanceUsageKind) {
 		result.CreditCents = record.CreditCents
 	}
 	if record.WorkspaceInstanceID.ID() != 0 {
 		result.WorkspaceInstanceID = record.WorkspaceInstanceID
 	}
+	if record.ProjectID != "" {
+		result.ProjectID = record.ProjectID
+	}
 	if record.Kind != "" {
 		result.Kind = record.Kind
 	}
@@ -54,6 +58,9 @@ func NewUsage(t *testing.T, record db.Usage) db.Usage {
 	if record.Metadata != nil {
 		result.Metadata = record.Metadata
 	}
+	if record.Version != 0 {
+		result.Version = record.Version
+	}
 	return result
 }
 
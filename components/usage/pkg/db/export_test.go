@@ -0,0 +1,11 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db
+
+// ListWorkspaceInstancesInRangeGORM exposes the query builder implementation to compare it with the SQL implementation.
+var ListWorkspaceInstancesInRangeGORM = listWorkspaceInstancesInRangeGORM
+
+// RetryTx exposes the retry loop of WithRetryableTx, such that it can be tested without a database.
+var RetryTx = retryTx
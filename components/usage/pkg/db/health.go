@@ -0,0 +1,100 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	driver_mysql "github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+)
+
+// LatestMigration is the latest migration of gitpod-db which this component relies on. Migrations run in order, so
+// all earlier migrations ran when it ran. Update it when relying on a newer migration.
+const LatestMigration = "AddUsageExportTable1665734400000"
+
+// CheckMigration returns an error unless the migration of gitpod-db ran.
+func CheckMigration(ctx context.Context, conn *gorm.DB, name string) error {
+	var count int64
+	err := conn.WithContext(ctx).Table("migrations").Where("name = ?", name).Count(&count).Error
+	if err != nil {
+		return fmt.Errorf("failed to get migrations: %w", err)
+	}
+	if count == 0 {
+		return fmt.Errorf("migration %s did not run yet", name)
+	}
+	return nil
+}
+
+// mysqlErrParse is ER_PARSE_ERROR, returned by MySQL versions before 8.0.22 for SHOW REPLICA STATUS.
+const mysqlErrParse = 1064
+
+// ReplicationLag returns how far the replica is behind its source. It fails when conn is not connected to a replica,
+// or when replication is not running. Reading the lag requires the REPLICATION CLIENT privilege.
+func ReplicationLag(ctx context.Context, conn *gorm.DB) (time.Duration, error) {
+	status, err := replicaStatus(ctx, conn, "SHOW REPLICA STATUS")
+	var mysqlErr *driver_mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlErrParse {
+		status, err = replicaStatus(ctx, conn, "SHOW SLAVE STATUS")
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get replica status: %w", err)
+	}
+	if status == nil {
+		return 0, fmt.Errorf("database is not a replica")
+	}
+
+	for _, column := range []string{"Seconds_Behind_Source", "Seconds_Behind_Master"} {
+		value, ok := status[column]
+		if !ok {
+			continue
+		}
+		if !value.Valid {
+			return 0, fmt.Errorf("replication is not running")
+		}
+		seconds, err := strconv.ParseInt(value.String, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse replication lag %q: %w", value.String, err)
+		}
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return 0, fmt.Errorf("replica status has no replication lag")
+}
+
+// replicaStatus returns the columns of the first row of the status statement, or nil when there is none.
+func replicaStatus(ctx context.Context, conn *gorm.DB, statement string) (map[string]sql.NullString, error) {
+	rows, err := conn.WithContext(ctx).Raw(statement).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	values := make([]sql.NullString, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return nil, err
+	}
+
+	status := map[string]sql.NullString{}
+	for i, column := range columns {
+		status[column] = values[i]
+	}
+	return status, nil
+}
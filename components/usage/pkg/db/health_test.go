@@ -0,0 +1,29 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/db/dbtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckMigration(t *testing.T) {
+	conn := dbtest.ConnectForTests(t)
+	ctx := context.Background()
+
+	require.NoError(t, db.CheckMigration(ctx, conn, db.LatestMigration))
+	require.Error(t, db.CheckMigration(ctx, conn, "DoesNotExist1234567890123"))
+}
+
+func TestReplicationLag_NotAReplica(t *testing.T) {
+	conn := dbtest.ConnectForTests(t)
+
+	_, err := db.ReplicationLag(context.Background(), conn)
+	require.Error(t, err)
+}
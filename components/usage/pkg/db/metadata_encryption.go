@@ -0,0 +1,352 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// PersonalMetadataFields are the fields of usage metadata which identify people. They are stored encrypted when metadata
+// encryption is configured, and hashed when metadata redaction is configured.
+var PersonalMetadataFields = []string{"contextURL", "userName", "userAvatarURL"}
+
+// encryptedValuePrefix marks encrypted values of metadata fields. Encrypted values are formatted as
+// enc:<key ID>:<base64 of nonce and ciphertext>.
+const encryptedValuePrefix = "enc:"
+
+// MetadataEncryptionConfig configures the keys which encrypt usage metadata.
+type MetadataEncryptionConfig struct {
+	// KeysFile is the path to a JSON object of key IDs to base64 encoded AES-256 keys, e.g. provisioned from a KMS.
+	// Keys which are no longer primary must be kept until ReencryptUsageMetadata re-encrypted all metadata.
+	KeysFile string `json:"keysFile"`
+	// PrimaryKeyID is the ID of the key which encrypts metadata. The other keys only decrypt.
+	PrimaryKeyID string `json:"primaryKeyID"`
+}
+
+// ReadMetadataCipher reads the keys of the configuration.
+func ReadMetadataCipher(c MetadataEncryptionConfig) (*MetadataCipher, error) {
+	b, err := os.ReadFile(c.KeysFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata encryption keys: %w", err)
+	}
+	var encoded map[string]string
+	if err := json.Unmarshal(b, &encoded); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal metadata encryption keys: %w", err)
+	}
+
+	keys := map[string][]byte{}
+	for id, value := range encoded {
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode metadata encryption key %s: %w", id, err)
+		}
+		keys[id] = key
+	}
+	return NewMetadataCipher(keys, c.PrimaryKeyID)
+}
+
+// MetadataCipher encrypts the PersonalMetadataFields of usage metadata with AES-GCM. Values are bound to their field,
+// such that an encrypted value can not be moved to another field.
+type MetadataCipher struct {
+	primaryKeyID string
+	aeads        map[string]cipher.AEAD
+}
+
+func NewMetadataCipher(keys map[string][]byte, primaryKeyID string) (*MetadataCipher, error) {
+	if _, ok := keys[primaryKeyID]; !ok {
+		return nil, fmt.Errorf("primary metadata encryption key %q does not exist", primaryKeyID)
+	}
+
+	aeads := map[string]cipher.AEAD{}
+	for id, key := range keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("metadata encryption key ID %q must not be empty or contain ':'", id)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("metadata encryption key %s must be 32 bytes, was %d", id, len(key))
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create cipher of metadata encryption key %s: %w", id, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create cipher of metadata encryption key %s: %w", id, err)
+		}
+		aeads[id] = aead
+	}
+	return &MetadataCipher{primaryKeyID: primaryKeyID, aeads: aeads}, nil
+}
+
+// Encrypt encrypts the PersonalMetadataFields of the metadata with the primary key. Values which are encrypted with
+// the primary key already are kept, values encrypted with other keys are re-encrypted. Metadata which is not a JSON
+// object is returned unchanged.
+func (c *MetadataCipher) Encrypt(metadata datatypes.JSON) (datatypes.JSON, error) {
+	return transformPersonalMetadataFields(metadata, func(field, value string) (string, error) {
+		if keyID, _, ok := parseEncryptedValue(value); ok {
+			if keyID == c.primaryKeyID {
+				return value, nil
+			}
+			plaintext, err := c.decryptValue(field, value)
+			if err != nil {
+				return "", err
+			}
+			value = plaintext
+		}
+		return c.encryptValue(field, value)
+	})
+}
+
+// Decrypt decrypts the PersonalMetadataFields of the metadata. Values which are not encrypted are kept.
+func (c *MetadataCipher) Decrypt(metadata datatypes.JSON) (datatypes.JSON, error) {
+	return transformPersonalMetadataFields(metadata, func(field, value string) (string, error) {
+		if _, _, ok := parseEncryptedValue(value); !ok {
+			return value, nil
+		}
+		return c.decryptValue(field, value)
+	})
+}
+
+// transformPersonalMetadataFields replaces the non-empty string values of the PersonalMetadataFields of the metadata
+// with the result of fn. Metadata which is not a JSON object is returned unchanged.
+func transformPersonalMetadataFields(metadata datatypes.JSON, fn func(field, value string) (string, error)) (datatypes.JSON, error) {
+	if len(metadata) == 0 {
+		return metadata, nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(metadata, &fields); err != nil {
+		return metadata, nil
+	}
+
+	changed := false
+	for _, field := range PersonalMetadataFields {
+		raw, ok := fields[field]
+		if !ok {
+			continue
+		}
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil || value == "" {
+			continue
+		}
+		transformed, err := fn(field, value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to transform metadata field %s: %w", field, err)
+		}
+		if transformed == value {
+			continue
+		}
+		b, err := json.Marshal(transformed)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal metadata field %s: %w", field, err)
+		}
+		fields[field] = b
+		changed = true
+	}
+	if !changed {
+		return metadata, nil
+	}
+
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+	return b, nil
+}
+
+func (c *MetadataCipher) encryptValue(field, value string) (string, error) {
+	aead := c.aeads[c.primaryKeyID]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(value), []byte(field))
+	return encryptedValuePrefix + c.primaryKeyID + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (c *MetadataCipher) decryptValue(field, value string) (string, error) {
+	keyID, encoded, _ := parseEncryptedValue(value)
+	aead, ok := c.aeads[keyID]
+	if !ok {
+		return "", fmt.Errorf("metadata encryption key %s does not exist", keyID)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode encrypted value: %w", err)
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("encrypted value is too short")
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(field))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt value with key %s: %w", keyID, err)
+	}
+	return string(plaintext), nil
+}
+
+func parseEncryptedValue(value string) (keyID, encoded string, ok bool) {
+	if !strings.HasPrefix(value, encryptedValuePrefix) {
+		return "", "", false
+	}
+	parts := strings.SplitN(strings.TrimPrefix(value, encryptedValuePrefix), ":", 2)
+	if len(parts) != 2 {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+const metadataEncryptionPluginName = "usage:metadata_encryption"
+
+// MetadataEncryption is a gorm plugin which stores the metadata of usage encrypted, and decrypts it when usage is
+// read, such that callers only see plaintext metadata. Install it with conn.Use.
+type MetadataEncryption struct {
+	Cipher *MetadataCipher
+}
+
+func (p *MetadataEncryption) Name() string {
+	return metadataEncryptionPluginName
+}
+
+func (p *MetadataEncryption) Initialize(conn *gorm.DB) error {
+	callbacks := conn.Callback()
+	// The records of the caller are encrypted while they are written, and decrypted again afterwards.
+	if err := callbacks.Create().Before("gorm:create").Register("usage:encrypt_metadata_create", p.encrypt); err != nil {
+		return err
+	}
+	if err := callbacks.Create().After("gorm:create").Register("usage:decrypt_metadata_create", p.decrypt); err != nil {
+		return err
+	}
+	if err := callbacks.Update().Before("gorm:update").Register("usage:encrypt_metadata_update", p.encrypt); err != nil {
+		return err
+	}
+	if err := callbacks.Update().After("gorm:update").Register("usage:decrypt_metadata_update", p.decrypt); err != nil {
+		return err
+	}
+	return callbacks.Query().After("gorm:query").Register("usage:decrypt_metadata_query", p.decrypt)
+}
+
+func (p *MetadataEncryption) encrypt(tx *gorm.DB) {
+	p.each(tx, p.Cipher.Encrypt)
+}
+
+func (p *MetadataEncryption) decrypt(tx *gorm.DB) {
+	// Records of the caller are decrypted even when writing them failed, as they were encrypted before.
+	p.each(tx, p.Cipher.Decrypt)
+}
+
+func (p *MetadataEncryption) each(tx *gorm.DB, transform func(datatypes.JSON) (datatypes.JSON, error)) {
+	if tx.Statement.Schema == nil || tx.Statement.Schema.ModelType != reflect.TypeOf(Usage{}) {
+		return
+	}
+
+	apply := func(value reflect.Value) {
+		value = reflect.Indirect(value)
+		if !value.CanAddr() {
+			return
+		}
+		usage, ok := value.Addr().Interface().(*Usage)
+		if !ok {
+			return
+		}
+		metadata, err := transform(usage.Metadata)
+		if err != nil {
+			_ = tx.AddError(fmt.Errorf("failed to transform metadata of usage %s: %w", usage.ID, err))
+			return
+		}
+		usage.Metadata = metadata
+	}
+
+	switch value := tx.Statement.ReflectValue; value.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			apply(value.Index(i))
+		}
+	case reflect.Struct:
+		apply(value)
+	}
+}
+
+// metadataCipherOf returns the cipher of the MetadataEncryption plugin of the connection, or nil when metadata is not
+// encrypted.
+func metadataCipherOf(conn *gorm.DB) *MetadataCipher {
+	plugin, ok := conn.Config.Plugins[metadataEncryptionPluginName]
+	if !ok {
+		return nil
+	}
+	return plugin.(*MetadataEncryption).Cipher
+}
+
+// ReencryptUsageMetadata encrypts the metadata of all usage, including archived usage, with the primary key of the
+// cipher: plaintext metadata which was written before encryption was configured, and metadata encrypted with keys
+// which are no longer primary. It returns the number of entries which were re-encrypted.
+//
+// Entries which change while they are re-encrypted are skipped, they are encrypted by the writer already.
+func ReencryptUsageMetadata(ctx context.Context, conn *gorm.DB, c *MetadataCipher) (int64, error) {
+	const batchSize = 1000
+
+	var reencrypted int64
+	for _, table := range []string{(&Usage{}).TableName(), UsageArchiveTableName} {
+		after := ""
+		for {
+			// Reading into usageMetadata bypasses the MetadataEncryption plugin, which only decrypts Usage.
+			var batch []usageMetadata
+			err := conn.WithContext(ctx).
+				Table(table).
+				Select("id", "metadata").
+				Where("id > ?", after).
+				Order("id").
+				Limit(batchSize).
+				Find(&batch).Error
+			if err != nil {
+				return reencrypted, fmt.Errorf("failed to read usage metadata from %s: %w", table, err)
+			}
+
+			for _, entry := range batch {
+				encrypted, err := c.Encrypt(entry.Metadata)
+				if err != nil {
+					return reencrypted, fmt.Errorf("failed to encrypt metadata of usage %s: %w", entry.ID, err)
+				}
+				if bytes.Equal(encrypted, entry.Metadata) {
+					continue
+				}
+				result := conn.WithContext(ctx).
+					Table(table).
+					Where("id = ? AND metadata = ?", entry.ID, string(entry.Metadata)).
+					UpdateColumns(map[string]interface{}{
+						"metadata": string(encrypted),
+						"version":  gorm.Expr("version + 1"),
+					})
+				if result.Error != nil {
+					return reencrypted, fmt.Errorf("failed to re-encrypt metadata of usage %s: %w", entry.ID, result.Error)
+				}
+				reencrypted += result.RowsAffected
+			}
+
+			if len(batch) < batchSize {
+				break
+			}
+			after = batch[len(batch)-1].ID
+		}
+	}
+	return reencrypted, nil
+}
+
+type usageMetadata struct {
+	ID       string         `gorm:"column:id"`
+	Metadata datatypes.JSON `gorm:"column:metadata"`
+}
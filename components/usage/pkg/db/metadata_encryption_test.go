@@ -0,0 +1,99 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+func newTestMetadataCipher(t *testing.T, primaryKeyID string) *MetadataCipher {
+	t.Helper()
+	c, err := NewMetadataCipher(map[string][]byte{
+		"k1": bytes.Repeat([]byte{1}, 32),
+		"k2": bytes.Repeat([]byte{2}, 32),
+	}, primaryKeyID)
+	require.NoError(t, err)
+	return c
+}
+
+func TestMetadataCipher(t *testing.T) {
+	c := newTestMetadataCipher(t, "k1")
+	plaintext := datatypes.JSON(`{"workspaceClass":"default","contextURL":"https://github.com/gitpod-io/gitpod","userName":"alice","userAvatarURL":"https://avatars/alice","startTime":"2022-10-01T00:00:00.000Z"}`)
+
+	encrypted, err := c.Encrypt(plaintext)
+	require.NoError(t, err)
+	var fields map[string]string
+	require.NoError(t, json.Unmarshal(encrypted, &fields))
+	for _, field := range PersonalMetadataFields {
+		require.True(t, strings.HasPrefix(fields[field], "enc:k1:"), field)
+	}
+	require.Equal(t, "default", fields["workspaceClass"], "other fields must stay readable")
+
+	decrypted, err := c.Decrypt(encrypted)
+	require.NoError(t, err)
+	require.JSONEq(t, string(plaintext), string(decrypted))
+
+	again, err := c.Encrypt(encrypted)
+	require.NoError(t, err)
+	require.Equal(t, encrypted, again, "values encrypted with the primary key must be kept")
+
+	rotated, err := newTestMetadataCipher(t, "k2").Encrypt(encrypted)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(rotated, &fields))
+	require.True(t, strings.HasPrefix(fields["userName"], "enc:k2:"))
+	decrypted, err = c.Decrypt(rotated)
+	require.NoError(t, err)
+	require.JSONEq(t, string(plaintext), string(decrypted))
+
+	// Values must not decrypt in another field.
+	var swapped map[string]string
+	require.NoError(t, json.Unmarshal(encrypted, &swapped))
+	swapped["userName"], swapped["contextURL"] = swapped["contextURL"], swapped["userName"]
+	b, err := json.Marshal(swapped)
+	require.NoError(t, err)
+	_, err = c.Decrypt(b)
+	require.Error(t, err)
+
+	for _, metadata := range []datatypes.JSON{nil, datatypes.JSON(`[]`), datatypes.JSON(`{"workspaceClass":"default"}`)} {
+		encrypted, err := c.Encrypt(metadata)
+		require.NoError(t, err)
+		require.Equal(t, metadata, encrypted)
+	}
+
+	_, err = NewMetadataCipher(map[string][]byte{"k1": []byte("short")}, "k1")
+	require.Error(t, err)
+	_, err = NewMetadataCipher(map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)}, "k2")
+	require.Error(t, err)
+}
+
+func TestMetadataEncryption(t *testing.T) {
+	conn, err := ConnectReplica(ConnectionParams{Host: "127.0.0.1:1", Database: "gitpod"})
+	require.NoError(t, err)
+	c := newTestMetadataCipher(t, "k1")
+	require.NoError(t, conn.Use(&MetadataEncryption{Cipher: c}))
+	require.Equal(t, c, metadataCipherOf(conn))
+
+	usage := Usage{ID: uuid.New(), Kind: WorkspaceInstanceUsageKind}
+	require.NoError(t, usage.SetMetadataWithWorkspaceInstance(WorkspaceInstanceUsageData{UserName: "alice"}))
+	plaintext := usage.Metadata
+
+	stmt := conn.Session(&gorm.Session{DryRun: true, SkipDefaultTransaction: true}).Create(&usage).Statement
+	var written string
+	for _, v := range stmt.Vars {
+		if metadata, ok := v.(string); ok && strings.Contains(metadata, "userName") {
+			written = metadata
+		}
+	}
+	require.Contains(t, written, `"userName":"enc:k1:`)
+	require.JSONEq(t, string(plaintext), string(usage.Metadata), "the record of the caller must be plaintext after writing it")
+}
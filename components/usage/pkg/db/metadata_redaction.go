@@ -0,0 +1,74 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"gorm.io/datatypes"
+)
+
+// redactedValuePrefix marks values of metadata fields which were replaced by their hash.
+const redactedValuePrefix = "hmac-sha256:"
+
+// MetadataRedactionConfig configures the redaction of usage metadata.
+type MetadataRedactionConfig struct {
+	// HashKeyFile is the path to the secret key of the hashes. Hashes of the same value are equal, such that usage of
+	// the same person can still be grouped, but the key prevents guessing the values from their hashes.
+	HashKeyFile string `json:"hashKeyFile"`
+}
+
+// ReadMetadataRedactor reads the hash key of the configuration.
+func ReadMetadataRedactor(c MetadataRedactionConfig) (*MetadataRedactor, error) {
+	b, err := os.ReadFile(c.HashKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata hash key: %w", err)
+	}
+	key := strings.TrimSpace(string(b))
+	if key == "" {
+		return nil, fmt.Errorf("metadata hash key must not be empty")
+	}
+	return &MetadataRedactor{key: []byte(key)}, nil
+}
+
+// MetadataRedactor replaces the PersonalMetadataFields of usage metadata by their HMAC-SHA256. The fields which usage
+// is priced and billed by are kept.
+type MetadataRedactor struct {
+	key []byte
+}
+
+func NewMetadataRedactor(key []byte) *MetadataRedactor {
+	return &MetadataRedactor{key: key}
+}
+
+// Redact hashes the PersonalMetadataFields of the metadata. Values which are hashed already are kept.
+func (r *MetadataRedactor) Redact(metadata datatypes.JSON) (datatypes.JSON, error) {
+	return transformPersonalMetadataFields(metadata, func(field, value string) (string, error) {
+		if strings.HasPrefix(value, redactedValuePrefix) {
+			return value, nil
+		}
+		mac := hmac.New(sha256.New, r.key)
+		// The field is part of the hash, such that hashes can not be correlated across fields.
+		mac.Write([]byte(field))
+		mac.Write([]byte{0})
+		mac.Write([]byte(value))
+		return redactedValuePrefix + hex.EncodeToString(mac.Sum(nil)), nil
+	})
+}
+
+// metadataRedactor redacts the metadata of all workspace instance usage, see SetMetadataWithWorkspaceInstance. It is
+// nil unless redaction is configured.
+var metadataRedactor *MetadataRedactor
+
+// SetMetadataRedaction redacts the metadata of workspace instance usage from now on, or stops redacting it when r is
+// nil. It must be called before usage is recorded, e.g. on startup.
+func SetMetadataRedaction(r *MetadataRedactor) {
+	metadataRedactor = r
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetMetadataWithWorkspaceInstance_Redaction(t *testing.T) {
+	data := db.WorkspaceInstanceUsageData{
+		WorkspaceId:    "ws-1",
+		WorkspaceClass: "g1-large",
+		ContextURL:     "https://github.com/gitpod-io/gitpod",
+		StartTime:      "2022-10-01T00:00:00.000Z",
+		EndTime:        "2022-10-01T01:00:00.000Z",
+		UserName:       "alice",
+		UserAvatarURL:  "https://avatars/alice",
+		PricingSegments: []db.PricingSegment{
+			{Plan: "default", StartTime: "2022-10-01T00:00:00.000Z", EndTime: "2022-10-01T01:00:00.000Z", CreditsPerMinute: 0.5, Credits: 30},
+		},
+	}
+
+	var plain db.Usage
+	require.NoError(t, plain.SetMetadataWithWorkspaceInstance(data))
+	stored, err := plain.GetMetadataAsWorkspaceInstanceData()
+	require.NoError(t, err)
+	require.Equal(t, data, stored, "metadata must be kept without redaction")
+
+	db.SetMetadataRedaction(db.NewMetadataRedactor([]byte("secret")))
+	t.Cleanup(func() {
+		db.SetMetadataRedaction(nil)
+	})
+
+	var redacted db.Usage
+	require.NoError(t, redacted.SetMetadataWithWorkspaceInstance(data))
+	require.NotContains(t, string(redacted.Metadata), "alice")
+	require.NotContains(t, string(redacted.Metadata), "gitpod-io")
+
+	stored, err = redacted.GetMetadataAsWorkspaceInstanceData()
+	require.NoError(t, err)
+	for _, value := range []string{stored.UserName, stored.UserAvatarURL, stored.ContextURL} {
+		require.True(t, strings.HasPrefix(value, "hmac-sha256:"), value)
+	}
+	require.NotEqual(t, stored.UserName, stored.UserAvatarURL)
+	require.Equal(t, data.WorkspaceId, stored.WorkspaceId)
+	require.Equal(t, data.WorkspaceClass, stored.WorkspaceClass)
+	require.Equal(t, data.StartTime, stored.StartTime)
+	require.Equal(t, data.EndTime, stored.EndTime)
+	require.Equal(t, data.PricingSegments, stored.PricingSegments)
+
+	// Metadata is read and set again when drafts are updated, hashes must not be hashed again.
+	var updated db.Usage
+	require.NoError(t, updated.SetMetadataWithWorkspaceInstance(stored))
+	again, err := updated.GetMetadataAsWorkspaceInstanceData()
+	require.NoError(t, err)
+	require.Equal(t, stored, again)
+
+	var other db.Usage
+	require.NoError(t, other.SetMetadataWithWorkspaceInstance(data))
+	otherData, err := other.GetMetadataAsWorkspaceInstanceData()
+	require.NoError(t, err)
+	require.Equal(t, stored.UserName, otherData.UserName, "usage of the same person must have the same hashes")
+}
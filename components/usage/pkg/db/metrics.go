@@ -0,0 +1,217 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gitpod-io/gitpod/common-go/tracing"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/prometheus/client_golang/prometheus"
+	"gorm.io/gorm"
+)
+
+var (
+	queryDurationSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "gitpod",
+		Subsystem: "usage",
+		Name:      "db_query_duration_seconds",
+		Help:      "Histogram of time it takes (in seconds) to run a database statement, by the query which ran it",
+		Buckets:   []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"query"})
+
+	queryErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gitpod",
+		Subsystem: "usage",
+		Name:      "db_query_errors_total",
+		Help:      "Counter of database statements which failed, by the query which ran them",
+	}, []string{"query"})
+
+	slowQueriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gitpod",
+		Subsystem: "usage",
+		Name:      "db_slow_queries_total",
+		Help:      "Counter of database statements which exceeded the slow query threshold, by the query which ran them and its caller",
+	}, []string{"query", "caller"})
+
+	usageWriteQueuePending = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "gitpod",
+		Subsystem: "usage",
+		Name:      "write_queue_pending_records",
+		Help:      "Number of usage records in the write queue which are not written yet",
+	})
+
+	usageWriteQueueWritesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gitpod",
+		Subsystem: "usage",
+		Name:      "write_queue_records_total",
+		Help:      "Counter of usage records flushed from the write queue, by outcome: written, conflict (dropped) or failed (requeued)",
+	}, []string{"outcome"})
+)
+
+func RegisterMetrics(reg *prometheus.Registry) error {
+	metrics := []prometheus.Collector{
+		queryDurationSeconds,
+		queryErrorsTotal,
+		slowQueriesTotal,
+		usageWriteQueuePending,
+		usageWriteQueueWritesTotal,
+	}
+	for _, metric := range metrics {
+		err := reg.Register(metric)
+		if err != nil {
+			return fmt.Errorf("failed to register metric: %w", err)
+		}
+	}
+
+	return nil
+}
+
+const (
+	// queryStartKey stores the start of a statement in its gorm instance.
+	queryStartKey = "usage:query_start"
+	// querySpanKey stores the tracing span of a statement in its gorm instance.
+	querySpanKey = "usage:query_span"
+	// queryNameKey stores the name of the query which runs a statement in its gorm instance.
+	queryNameKey = "usage:query_name"
+	// otherQuery labels statements which were not run by a query of this package.
+	otherQuery = "other"
+)
+
+// InstrumentQueries records the duration and errors of every statement run through conn. Statements are labelled with
+// the name of the exported function, or method, of this package which ran them, e.g. GetBalance. Statements whose
+// context carries a tracing span are traced as a child span, named after the query, e.g. db.GetBalance.
+func InstrumentQueries(conn *gorm.DB) error {
+	type registerer interface {
+		Register(name string, fn func(*gorm.DB)) error
+	}
+
+	callbacks := conn.Callback()
+	for _, c := range []struct {
+		Operation     string
+		Before, After registerer
+	}{
+		{Operation: "create", Before: callbacks.Create().Before("gorm:create"), After: callbacks.Create().After("gorm:create")},
+		{Operation: "query", Before: callbacks.Query().Before("gorm:query"), After: callbacks.Query().After("gorm:query")},
+		{Operation: "update", Before: callbacks.Update().Before("gorm:update"), After: callbacks.Update().After("gorm:update")},
+		{Operation: "delete", Before: callbacks.Delete().Before("gorm:delete"), After: callbacks.Delete().After("gorm:delete")},
+		{Operation: "row", Before: callbacks.Row().Before("gorm:row"), After: callbacks.Row().After("gorm:row")},
+		{Operation: "raw", Before: callbacks.Raw().Before("gorm:raw"), After: callbacks.Raw().After("gorm:raw")},
+	} {
+		if err := c.Before.Register("usage:metrics_before_"+c.Operation, startQuery); err != nil {
+			return fmt.Errorf("failed to instrument %s statements: %w", c.Operation, err)
+		}
+		if err := c.After.Register("usage:metrics_after_"+c.Operation, observeQuery); err != nil {
+			return fmt.Errorf("failed to instrument %s statements: %w", c.Operation, err)
+		}
+	}
+	return nil
+}
+
+func startQuery(tx *gorm.DB) {
+	tx.InstanceSet(queryStartKey, time.Now())
+
+	// Statements are only traced as part of a trace of their caller, e.g. an RPC or a reconciliation.
+	if ctx := tx.Statement.Context; ctx != nil && opentracing.SpanFromContext(ctx) != nil {
+		span, _ := opentracing.StartSpanFromContext(ctx, "db."+statementQueryName(tx))
+		ext.DBType.Set(span, "sql")
+		ext.SpanKindRPCClient.Set(span)
+		tx.InstanceSet(querySpanKey, span)
+	}
+}
+
+func observeQuery(tx *gorm.DB) {
+	if value, ok := tx.InstanceGet(querySpanKey); ok {
+		if span, ok := value.(opentracing.Span); ok {
+			ext.DBStatement.Set(span, tx.Statement.SQL.String())
+			span.SetTag("db.rows_affected", tx.Statement.RowsAffected)
+			if tx.Error != nil && !errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+				tracing.LogError(span, tx.Error)
+			}
+			span.Finish()
+		}
+	}
+
+	value, ok := tx.InstanceGet(queryStartKey)
+	if !ok {
+		return
+	}
+	start, ok := value.(time.Time)
+	if !ok {
+		return
+	}
+
+	query := statementQueryName(tx)
+	queryDurationSeconds.WithLabelValues(query).Observe(time.Since(start).Seconds())
+	if tx.Error != nil && !errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		queryErrorsTotal.WithLabelValues(query).Inc()
+	}
+}
+
+// packagePrefix prefixes the names of the functions of this package in stack traces.
+var packagePrefix = func() string {
+	name := runtime.FuncForPC(reflect.ValueOf(RegisterMetrics).Pointer()).Name()
+	return strings.TrimSuffix(name, "RegisterMetrics")
+}()
+
+// statementQueryName returns the name of the query which runs the statement, see queryName. The name is only looked
+// up once per statement.
+func statementQueryName(tx *gorm.DB) string {
+	if value, ok := tx.InstanceGet(queryNameKey); ok {
+		if name, ok := value.(string); ok {
+			return name
+		}
+	}
+	name := queryName()
+	tx.InstanceSet(queryNameKey, name)
+	return name
+}
+
+// queryName returns the name of the innermost exported function of this package on the stack of the caller, such that
+// statements of unexported helpers and closures are attributed to the query which uses them.
+func queryName() string {
+	pcs := make([]uintptr, 64)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+	for {
+		frame, more := frames.Next()
+		if name, ok := exportedQueryName(frame.Function); ok {
+			return name
+		}
+		if !more {
+			return otherQuery
+		}
+	}
+}
+
+// exportedQueryName returns the name of the function without its package, and whether it is an exported function or
+// method of this package. Closures are attributed to the function which declares them.
+func exportedQueryName(function string) (string, bool) {
+	if !strings.HasPrefix(function, packagePrefix) {
+		return "", false
+	}
+	name := strings.TrimPrefix(function, packagePrefix)
+	// Closures are named like GetBalance.func1, or GetBalance.func1.2 when nested.
+	if i := strings.Index(name, ".func"); i >= 0 {
+		name = name[:i]
+	}
+	// Methods are named like (*ReplicaRouter).Reader.
+	name = strings.NewReplacer("(*", "", ")", "").Replace(name)
+
+	// Methods of unexported types are not queries either.
+	for _, segment := range strings.Split(name, ".") {
+		runes := []rune(segment)
+		if len(runes) == 0 || !unicode.IsUpper(runes[0]) {
+			return "", false
+		}
+	}
+	return name, true
+}
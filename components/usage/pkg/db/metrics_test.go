@@ -0,0 +1,82 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportedQueryName(t *testing.T) {
+	for _, s := range []struct {
+		Function string
+		Expected string
+		Exported bool
+	}{
+		{Function: packagePrefix + "GetBalance", Expected: "GetBalance", Exported: true},
+		{Function: packagePrefix + "UpsertUsage.func1", Expected: "UpsertUsage", Exported: true},
+		{Function: packagePrefix + "UpsertUsage.func1.2", Expected: "UpsertUsage", Exported: true},
+		{Function: packagePrefix + "(*ReplicaRouter).Reader", Expected: "ReplicaRouter.Reader", Exported: true},
+		{Function: packagePrefix + "usageBalanceBefore"},
+		{Function: packagePrefix + "(*usageCursor).Next"},
+		{Function: "gorm.io/gorm.(*DB).Find"},
+		{Function: "github.com/gitpod-io/gitpod/usage/pkg/db_test.TestGetBalance"},
+	} {
+		t.Run(s.Function, func(t *testing.T) {
+			name, exported := exportedQueryName(s.Function)
+			require.Equal(t, s.Exported, exported)
+			require.Equal(t, s.Expected, name)
+		})
+	}
+}
+
+func TestInstrumentQueries(t *testing.T) {
+	// Nothing listens on the port, such that every statement fails.
+	conn, err := ConnectReplica(ConnectionParams{Host: "127.0.0.1:1", Database: "gitpod"})
+	require.NoError(t, err)
+	require.NoError(t, InstrumentQueries(conn))
+
+	_, err = FindDraftUsageBefore(context.Background(), conn, time.Now())
+	require.Error(t, err)
+
+	require.Equal(t, float64(1), testutil.ToFloat64(queryErrorsTotal.WithLabelValues("FindDraftUsageBefore")))
+	require.Equal(t, 1, testutil.CollectAndCount(queryDurationSeconds))
+}
+
+func TestInstrumentQueries_Tracing(t *testing.T) {
+	tracer := mocktracer.New()
+	opentracing.SetGlobalTracer(tracer)
+	t.Cleanup(func() {
+		opentracing.SetGlobalTracer(opentracing.NoopTracer{})
+	})
+
+	conn, err := ConnectReplica(ConnectionParams{Host: "127.0.0.1:1", Database: "gitpod"})
+	require.NoError(t, err)
+	require.NoError(t, InstrumentQueries(conn))
+
+	// Statements without a trace of their caller are not traced.
+	_, err = FindDraftUsageBefore(context.Background(), conn, time.Now())
+	require.Error(t, err)
+	require.Empty(t, tracer.FinishedSpans())
+
+	parent, ctx := opentracing.StartSpanFromContext(context.Background(), "test")
+	_, err = FindDraftUsageBefore(ctx, conn, time.Now())
+	require.Error(t, err)
+	parent.Finish()
+
+	spans := tracer.FinishedSpans()
+	require.Len(t, spans, 2)
+	span := spans[0]
+	require.Equal(t, "db.FindDraftUsageBefore", span.OperationName)
+	require.Equal(t, parent.(*mocktracer.MockSpan).SpanContext.SpanID, span.ParentID)
+	require.Equal(t, true, span.Tag("error"))
+	require.Contains(t, span.Tag("db.statement"), "SELECT")
+}
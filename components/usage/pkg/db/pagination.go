@@ -0,0 +1,57 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// PageKey is the position of a row in a list which is paginated by keyset: the value of the column the list is ordered
+// by, and the ID of the row, which orders rows with the same value. Unlike an offset, the key selects the next page with
+// a range scan of an index, and rows inserted into earlier pages meanwhile do not shift the next page.
+type PageKey struct {
+	Value interface{}
+	ID    string
+}
+
+// AfterKey orders the rows by the column and then by the ID column, and selects the rows after the key. A nil key
+// selects the rows from the first one.
+func AfterKey(column, idColumn string, order Order, key *PageKey) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		db = db.Order(fmt.Sprintf("`%s` %s, `%s` %s", column, order.ToSQL(), idColumn, order.ToSQL()))
+		if key == nil {
+			return db
+		}
+
+		after := "<"
+		if order == AscendingOrder {
+			after = ">"
+		}
+		return db.Where(fmt.Sprintf("(`%s` %s ? OR (`%s` = ? AND `%s` %s ?))", column, after, column, idColumn, after),
+			key.Value, key.Value, key.ID)
+	}
+}
+
+// Limit limits the number of rows. A limit of 0 selects all rows.
+func Limit(limit int64) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if limit == 0 {
+			return db
+		}
+		return db.Limit(int(limit))
+	}
+}
+
+// NextPageKey returns the key of the page after the rows, or nil when the rows are the last page because there are
+// fewer than `limit`.
+func NextPageKey[T any](rows []T, limit int64, key func(T) PageKey) *PageKey {
+	if limit == 0 || int64(len(rows)) < limit {
+		return nil
+	}
+	next := key(rows[len(rows)-1])
+	return &next
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestAfterKey(t *testing.T) {
+	conn, err := ConnectReplica(ConnectionParams{Host: "127.0.0.1:1"})
+	require.NoError(t, err)
+	dryRun := conn.Session(&gorm.Session{DryRun: true})
+
+	for _, s := range []struct {
+		Name         string
+		Order        Order
+		Key          *PageKey
+		ExpectedSQL  string
+		ExpectedVars []interface{}
+	}{
+		{
+			Name:        "first page",
+			Order:       AscendingOrder,
+			ExpectedSQL: "SELECT * FROM `d_b_usage` ORDER BY `effectiveTime` ASC, `id` ASC LIMIT 10",
+		},
+		{
+			Name:         "ascending after key",
+			Order:        AscendingOrder,
+			Key:          &PageKey{Value: "2022-10-01T00:00:00.000Z", ID: "a"},
+			ExpectedSQL:  "SELECT * FROM `d_b_usage` WHERE (`effectiveTime` > ? OR (`effectiveTime` = ? AND `id` > ?)) ORDER BY `effectiveTime` ASC, `id` ASC LIMIT 10",
+			ExpectedVars: []interface{}{"2022-10-01T00:00:00.000Z", "2022-10-01T00:00:00.000Z", "a"},
+		},
+		{
+			Name:         "descending after key",
+			Order:        DescendingOrder,
+			Key:          &PageKey{Value: "2022-10-01T00:00:00.000Z", ID: "a"},
+			ExpectedSQL:  "SELECT * FROM `d_b_usage` WHERE (`effectiveTime` < ? OR (`effectiveTime` = ? AND `id` < ?)) ORDER BY `effectiveTime` DESC, `id` DESC LIMIT 10",
+			ExpectedVars: []interface{}{"2022-10-01T00:00:00.000Z", "2022-10-01T00:00:00.000Z", "a"},
+		},
+	} {
+		t.Run(s.Name, func(t *testing.T) {
+			stmt := dryRun.Scopes(AfterKey("effectiveTime", "id", s.Order, s.Key), Limit(10)).Find(&[]Usage{}).Statement
+			require.Equal(t, s.ExpectedSQL, stmt.SQL.String())
+			require.Equal(t, s.ExpectedVars, stmt.Vars)
+		})
+	}
+}
+
+func TestNextPageKey(t *testing.T) {
+	key := func(n int) PageKey { return PageKey{Value: n} }
+
+	require.Nil(t, NextPageKey([]int{1, 2}, 3, key), "a page with fewer rows than the limit is the last page")
+	require.Nil(t, NextPageKey([]int{1, 2}, 0, key), "an unlimited page is the last page")
+	require.Equal(t, &PageKey{Value: 3}, NextPageKey([]int{1, 2, 3}, 3, key))
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// PlanChange records that a cost center switched to Plan at EffectiveTime. Usage before the change is priced at the
+// previous plan, usage after the change at the new one.
+type PlanChange struct {
+	ID            uuid.UUID     `gorm:"primary_key;column:id;type:char;size:36;" json:"id"`
+	AttributionID AttributionID `gorm:"column:attributionId;type:varchar;size:255;" json:"attributionId"`
+	Plan          string        `gorm:"column:plan;type:varchar;size:255;" json:"plan"`
+	EffectiveTime VarcharTime   `gorm:"column:effectiveTime;type:varchar;size:255;" json:"effectiveTime"`
+}
+
+// TableName sets the insert table name for this struct type
+func (p *PlanChange) TableName() string {
+	return "d_b_cost_center_plan_change"
+}
+
+func CreatePlanChange(ctx context.Context, conn *gorm.DB, change PlanChange) error {
+	result := conn.WithContext(ctx).Create(&change)
+	if result.Error != nil {
+		return fmt.Errorf("failed to create plan change: %w", result.Error)
+	}
+	return nil
+}
+
+// FindPlanChangesByAttributionIDs returns the plan changes of the given attribution IDs, ordered by effective time.
+func FindPlanChangesByAttributionIDs(ctx context.Context, conn *gorm.DB, attributionIDs []AttributionID) (map[AttributionID][]PlanChange, error) {
+	result := map[AttributionID][]PlanChange{}
+	if len(attributionIDs) == 0 {
+		return result, nil
+	}
+
+	var changes []PlanChange
+	tx := conn.WithContext(ctx).
+		Where("attributionId IN ?", attributionIDs).
+		Order("effectiveTime ASC").
+		Find(&changes)
+	if tx.Error != nil {
+		return nil, fmt.Errorf("failed to find plan changes: %w", tx.Error)
+	}
+
+	for _, change := range changes {
+		result[change.AttributionID] = append(result[change.AttributionID], change)
+	}
+	return result, nil
+}
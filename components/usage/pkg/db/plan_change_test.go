@@ -0,0 +1,44 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/db/dbtest"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindPlanChangesByAttributionIDs(t *testing.T) {
+	conn := dbtest.ConnectInMemoryForTests(t)
+	ctx := context.Background()
+
+	teamA := db.NewTeamAttributionID(uuid.New().String())
+	teamB := db.NewTeamAttributionID(uuid.New().String())
+	start := time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC)
+
+	changes := []db.PlanChange{
+		{ID: uuid.New(), AttributionID: teamA, Plan: "professional", EffectiveTime: db.NewVarcharTime(start.Add(48 * time.Hour))},
+		{ID: uuid.New(), AttributionID: teamA, Plan: "unleashed", EffectiveTime: db.NewVarcharTime(start.Add(24 * time.Hour))},
+		{ID: uuid.New(), AttributionID: teamB, Plan: "professional", EffectiveTime: db.NewVarcharTime(start)},
+	}
+	for _, change := range changes {
+		require.NoError(t, db.CreatePlanChange(ctx, conn, change))
+	}
+	t.Cleanup(func() {
+		require.NoError(t, conn.Where("attributionId IN ?", []db.AttributionID{teamA, teamB}).Delete(&db.PlanChange{}).Error)
+	})
+
+	result, err := db.FindPlanChangesByAttributionIDs(ctx, conn, []db.AttributionID{teamA})
+	require.NoError(t, err)
+	require.Len(t, result, 1)
+	require.Len(t, result[teamA], 2)
+	require.Equal(t, "unleashed", result[teamA][0].Plan, "must be ordered by effective time")
+	require.Equal(t, "professional", result[teamA][1].Plan)
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gitpod-io/gitpod/common-go/util"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"gorm.io/gorm"
+)
+
+// PoolConfig configures the connection pool of a database connection. Zero values keep the defaults of database/sql.
+type PoolConfig struct {
+	// MaxOpenConnections limits the number of open connections, including those in use.
+	MaxOpenConnections int `json:"maxOpenConnections,omitempty"`
+	// MaxIdleConnections limits the number of idle connections which are kept open.
+	MaxIdleConnections int `json:"maxIdleConnections,omitempty"`
+	// ConnectionMaxLifetime is the maximum time a connection is reused, before it is closed.
+	ConnectionMaxLifetime util.Duration `json:"connectionMaxLifetime,omitempty"`
+}
+
+func (c PoolConfig) Validate() error {
+	if c.MaxOpenConnections < 0 {
+		return fmt.Errorf("max open connections must not be negative, was %d", c.MaxOpenConnections)
+	}
+	if c.MaxIdleConnections < 0 {
+		return fmt.Errorf("max idle connections must not be negative, was %d", c.MaxIdleConnections)
+	}
+	if c.MaxOpenConnections > 0 && c.MaxIdleConnections > c.MaxOpenConnections {
+		return fmt.Errorf("max idle connections (%d) must not exceed max open connections (%d)", c.MaxIdleConnections, c.MaxOpenConnections)
+	}
+	if c.ConnectionMaxLifetime < 0 {
+		return fmt.Errorf("connection max lifetime must not be negative, was %s", time.Duration(c.ConnectionMaxLifetime))
+	}
+	return nil
+}
+
+// ConfigurePool applies the pool configuration to the connection.
+func ConfigurePool(conn *gorm.DB, c PoolConfig) error {
+	if err := c.Validate(); err != nil {
+		return fmt.Errorf("invalid connection pool config: %w", err)
+	}
+
+	sqlDB, err := conn.DB()
+	if err != nil {
+		return fmt.Errorf("failed to get connection pool: %w", err)
+	}
+	if c.MaxOpenConnections > 0 {
+		sqlDB.SetMaxOpenConns(c.MaxOpenConnections)
+	}
+	if c.MaxIdleConnections > 0 {
+		sqlDB.SetMaxIdleConns(c.MaxIdleConnections)
+	}
+	if c.ConnectionMaxLifetime > 0 {
+		sqlDB.SetConnMaxLifetime(time.Duration(c.ConnectionMaxLifetime))
+	}
+	return nil
+}
+
+// RegisterPoolMetrics publishes the statistics of the connection pool, e.g. connections in use, the number of waits
+// for a connection and the total time waited, labelled with the name.
+func RegisterPoolMetrics(reg prometheus.Registerer, conn *gorm.DB, name string) error {
+	sqlDB, err := conn.DB()
+	if err != nil {
+		return fmt.Errorf("failed to get connection pool: %w", err)
+	}
+	err = reg.Register(collectors.NewDBStatsCollector(sqlDB, name))
+	if err != nil {
+		return fmt.Errorf("failed to register connection pool metrics of %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gitpod-io/gitpod/common-go/util"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPoolConfig_Validate(t *testing.T) {
+	for _, s := range []struct {
+		Name   string
+		Config PoolConfig
+		Valid  bool
+	}{
+		{Name: "defaults", Config: PoolConfig{}, Valid: true},
+		{Name: "limits", Config: PoolConfig{MaxOpenConnections: 20, MaxIdleConnections: 10, ConnectionMaxLifetime: util.Duration(time.Hour)}, Valid: true},
+		{Name: "idle without open limit", Config: PoolConfig{MaxIdleConnections: 10}, Valid: true},
+		{Name: "negative open", Config: PoolConfig{MaxOpenConnections: -1}},
+		{Name: "negative idle", Config: PoolConfig{MaxIdleConnections: -1}},
+		{Name: "more idle than open", Config: PoolConfig{MaxOpenConnections: 5, MaxIdleConnections: 10}},
+		{Name: "negative lifetime", Config: PoolConfig{ConnectionMaxLifetime: util.Duration(-time.Second)}},
+	} {
+		t.Run(s.Name, func(t *testing.T) {
+			err := s.Config.Validate()
+			if s.Valid {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestConfigurePool(t *testing.T) {
+	conn, err := ConnectReplica(ConnectionParams{Host: "127.0.0.1:1"})
+	require.NoError(t, err)
+
+	require.NoError(t, ConfigurePool(conn, PoolConfig{MaxOpenConnections: 20, MaxIdleConnections: 10}))
+	sqlDB, err := conn.DB()
+	require.NoError(t, err)
+	require.Equal(t, 20, sqlDB.Stats().MaxOpenConnections)
+
+	require.Error(t, ConfigurePool(conn, PoolConfig{MaxOpenConnections: -1}))
+
+	reg := prometheus.NewRegistry()
+	require.NoError(t, RegisterPoolMetrics(reg, conn, "gitpod"))
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	var names []string
+	for _, family := range families {
+		names = append(names, family.GetName())
+	}
+	require.Contains(t, names, "go_sql_in_use_connections")
+	require.Contains(t, names, "go_sql_wait_count_total")
+	require.Contains(t, names, "go_sql_wait_duration_seconds_total")
+}
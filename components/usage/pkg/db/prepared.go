@@ -0,0 +1,23 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db
+
+import (
+	"gorm.io/gorm"
+)
+
+// prepared returns a session of conn which prepares each statement once, and reuses it for all later queries with the
+// same SQL through any session of the same connection. It is meant for frequent queries whose SQL does not depend on
+// their arguments: every distinct statement stays prepared, so queries with lists of values, e.g. IN conditions, must
+// not use it. Queries on it must not use Row(): when preparing the statement fails, gorm returns a row which panics
+// when it is scanned, instead of the error.
+//
+// Transactions keep using conn, because prepared statements of the connection pool would run outside of them.
+func prepared(conn *gorm.DB) *gorm.DB {
+	if _, inTx := conn.Statement.ConnPool.(gorm.TxCommitter); inTx {
+		return conn
+	}
+	return conn.Session(&gorm.Session{PrepareStmt: true})
+}
@@ -0,0 +1,28 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestPrepared(t *testing.T) {
+	conn, err := ConnectReplica(ConnectionParams{Host: "127.0.0.1:1", Database: "gitpod"})
+	require.NoError(t, err)
+
+	first, ok := prepared(conn).Statement.ConnPool.(*gorm.PreparedStmtDB)
+	require.True(t, ok, "must prepare statements")
+	second, ok := prepared(conn).Statement.ConnPool.(*gorm.PreparedStmtDB)
+	require.True(t, ok, "must prepare statements")
+	require.Same(t, first.Mux, second.Mux, "sessions must share the prepared statements of the connection")
+
+	tx := conn.Session(&gorm.Session{})
+	tx.Statement.ConnPool = &sql.Tx{}
+	require.Same(t, tx, prepared(tx), "transactions must not use statements prepared outside of them")
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ProjectBudgetNotFound = errors.New("ProjectBudget not found")
+
+// ProjectBudget is a spending limit for the usage of a single project, within the spending limit of its team.
+type ProjectBudget struct {
+	AttributionID AttributionID `gorm:"primary_key;column:attributionId;type:varchar;size:255;" json:"attributionId"`
+	ProjectID     string        `gorm:"primary_key;column:projectId;type:varchar;size:255;" json:"projectId"`
+	SpendingLimit int32         `gorm:"column:spendingLimit;type:int;default:0;" json:"spendingLimit"`
+}
+
+// TableName sets the insert table name for this struct type
+func (b *ProjectBudget) TableName() string {
+	return "d_b_project_budget"
+}
+
+// SetProjectBudget creates the budget of the project, or replaces its spending limit if it already has one.
+func SetProjectBudget(ctx context.Context, conn *gorm.DB, budget ProjectBudget) error {
+	result := conn.WithContext(ctx).
+		Clauses(clause.OnConflict{DoUpdates: clause.AssignmentColumns([]string{"spendingLimit"})}).
+		Create(&budget)
+	if result.Error != nil {
+		return fmt.Errorf("failed to set budget of project %s: %w", budget.ProjectID, result.Error)
+	}
+	return nil
+}
+
+// DeleteProjectBudget removes the budget of the project, and returns ProjectBudgetNotFound if it has none.
+func DeleteProjectBudget(ctx context.Context, conn *gorm.DB, attributionId AttributionID, projectID string) error {
+	result := conn.WithContext(ctx).
+		Where("attributionId = ? AND projectId = ?", attributionId, projectID).
+		Delete(&ProjectBudget{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete budget of project %s: %w", projectID, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ProjectBudgetNotFound
+	}
+	return nil
+}
+
+// FindProjectBudgets returns the budgets of all projects of the attribution ID, ordered by project ID.
+func FindProjectBudgets(ctx context.Context, conn *gorm.DB, attributionId AttributionID) ([]ProjectBudget, error) {
+	var budgets []ProjectBudget
+	result := conn.WithContext(ctx).
+		Where("attributionId = ?", attributionId).
+		Order("projectId").
+		Find(&budgets)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to find project budgets: %w", result.Error)
+	}
+	return budgets, nil
+}
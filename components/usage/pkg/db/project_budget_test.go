@@ -0,0 +1,42 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/db/dbtest"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProjectBudgets(t *testing.T) {
+	conn := dbtest.ConnectInMemoryForTests(t)
+	ctx := context.Background()
+	attributionID := db.NewTeamAttributionID(uuid.New().String())
+	t.Cleanup(func() {
+		require.NoError(t, conn.Where("attributionId = ?", attributionID).Delete(&db.ProjectBudget{}).Error)
+	})
+
+	require.NoError(t, db.SetProjectBudget(ctx, conn, db.ProjectBudget{AttributionID: attributionID, ProjectID: "project-b", SpendingLimit: 20}))
+	require.NoError(t, db.SetProjectBudget(ctx, conn, db.ProjectBudget{AttributionID: attributionID, ProjectID: "project-a", SpendingLimit: 10}))
+	require.NoError(t, db.SetProjectBudget(ctx, conn, db.ProjectBudget{AttributionID: attributionID, ProjectID: "project-a", SpendingLimit: 15}))
+
+	budgets, err := db.FindProjectBudgets(ctx, conn, attributionID)
+	require.NoError(t, err)
+	require.Equal(t, []db.ProjectBudget{
+		{AttributionID: attributionID, ProjectID: "project-a", SpendingLimit: 15},
+		{AttributionID: attributionID, ProjectID: "project-b", SpendingLimit: 20},
+	}, budgets)
+
+	require.NoError(t, db.DeleteProjectBudget(ctx, conn, attributionID, "project-b"))
+	require.ErrorIs(t, db.DeleteProjectBudget(ctx, conn, attributionID, "project-b"), db.ProjectBudgetNotFound)
+
+	budgets, err = db.FindProjectBudgets(ctx, conn, attributionID)
+	require.NoError(t, err)
+	require.Len(t, budgets, 1)
+}
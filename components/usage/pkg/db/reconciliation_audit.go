@@ -0,0 +1,69 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+const (
+	// JanitorReconciler expires credit grants and finalizes stale draft usage.
+	JanitorReconciler = "janitor"
+)
+
+// ReconciliationAudit records a run of a reconciler which changed the ledger without being asked to by a user, such
+// that support can tell what was changed, and when.
+type ReconciliationAudit struct {
+	ID         uuid.UUID `gorm:"primary_key;column:id;type:char;size:36;" json:"id"`
+	Reconciler string    `gorm:"column:reconciler;type:varchar;size:255;" json:"reconciler"`
+	// Summary describes what the run changed, its shape depends on the Reconciler.
+	Summary datatypes.JSON `gorm:"column:summary;type:text;size:65535" json:"summary"`
+	// RunTime is set by the database when the run is recorded.
+	RunTime time.Time `gorm:"->;column:runTime;type:timestamp;default:CURRENT_TIMESTAMP(6);" json:"runTime"`
+}
+
+// TableName sets the insert table name for this struct type
+func (a *ReconciliationAudit) TableName() string {
+	return "d_b_reconciliation_audit"
+}
+
+// RecordReconciliationAudit records a run of the reconciler, with the summary serialized as JSON.
+func RecordReconciliationAudit(ctx context.Context, conn *gorm.DB, reconciler string, summary interface{}) (ReconciliationAudit, error) {
+	b, err := json.Marshal(summary)
+	if err != nil {
+		return ReconciliationAudit{}, fmt.Errorf("failed to serialize summary of %s run: %w", reconciler, err)
+	}
+
+	audit := ReconciliationAudit{
+		ID:         uuid.New(),
+		Reconciler: reconciler,
+		Summary:    b,
+	}
+	if err := conn.WithContext(ctx).Create(&audit).Error; err != nil {
+		return ReconciliationAudit{}, fmt.Errorf("failed to record %s run: %w", reconciler, err)
+	}
+	return audit, nil
+}
+
+// FindReconciliationAudits returns the most recent runs of the reconciler, up to limit.
+func FindReconciliationAudits(ctx context.Context, conn *gorm.DB, reconciler string, limit int) ([]ReconciliationAudit, error) {
+	var audits []ReconciliationAudit
+	result := conn.WithContext(ctx).
+		Where("reconciler = ?", reconciler).
+		Order("runTime DESC").
+		Limit(limit).
+		Find(&audits)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to find %s runs: %w", reconciler, result.Error)
+	}
+	return audits, nil
+}
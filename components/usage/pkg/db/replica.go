@@ -0,0 +1,141 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gitpod-io/gitpod/common-go/log"
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultReplicaCheckInterval is how long the availability of a read replica is cached.
+	DefaultReplicaCheckInterval = 10 * time.Second
+
+	replicaPingTimeout = 2 * time.Second
+)
+
+// ReplicaRouter routes queries which tolerate replication lag to a read replica of the database. While the replica is
+// unavailable, or lags behind by more than the maximum replication lag, queries are routed to the primary instead.
+type ReplicaRouter struct {
+	primary *gorm.DB
+	replica *gorm.DB
+
+	checkInterval time.Duration
+	maxLag        time.Duration
+	nowFunc       func() time.Time
+	pingFunc      func(ctx context.Context) error
+	lagFunc       func(ctx context.Context) (time.Duration, error)
+
+	mu        sync.Mutex
+	checkedAt time.Time
+	available bool
+	lastErr   error
+}
+
+// NewReplicaRouter creates a ReplicaRouter, which checks the availability of the replica at most once per
+// checkInterval. When maxLag is 0, the replication lag is not checked. When replica is nil, all queries are routed to
+// the primary.
+func NewReplicaRouter(primary, replica *gorm.DB, checkInterval, maxLag time.Duration) *ReplicaRouter {
+	r := &ReplicaRouter{
+		primary:       primary,
+		replica:       replica,
+		checkInterval: checkInterval,
+		maxLag:        maxLag,
+		nowFunc:       time.Now,
+	}
+	r.pingFunc = r.ping
+	r.lagFunc = func(ctx context.Context) (time.Duration, error) {
+		return ReplicationLag(ctx, r.replica)
+	}
+	return r
+}
+
+// Primary returns the connection to the primary, which must be used for writes.
+func (r *ReplicaRouter) Primary() *gorm.DB {
+	return r.primary
+}
+
+// Reader returns the connection to the replica when it is available, and the connection to the primary otherwise.
+func (r *ReplicaRouter) Reader(ctx context.Context) *gorm.DB {
+	if r.replica == nil {
+		return r.primary
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.refresh(ctx)
+	if !r.available {
+		return r.primary
+	}
+	return r.replica
+}
+
+// HealthCheck reports why the replica is not used, based on the latest check. It succeeds when there is no replica.
+func (r *ReplicaRouter) HealthCheck() error {
+	if r.replica == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.refresh(context.Background())
+	return r.lastErr
+}
+
+// refresh checks the replica, unless it was checked within the check interval. r.mu must be held.
+func (r *ReplicaRouter) refresh(ctx context.Context) {
+	now := r.nowFunc()
+	if !r.checkedAt.IsZero() && now.Sub(r.checkedAt) < r.checkInterval {
+		return
+	}
+
+	err := r.check(ctx)
+	available := err == nil
+	if available != r.available || r.checkedAt.IsZero() {
+		if available {
+			log.Log.Info("Read replica is available.")
+		} else {
+			log.Log.WithError(err).Warn("Read replica is unavailable, falling back to the primary.")
+		}
+	}
+	r.available = available
+	r.lastErr = err
+	r.checkedAt = now
+}
+
+func (r *ReplicaRouter) check(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, replicaPingTimeout)
+	defer cancel()
+
+	if err := r.pingFunc(ctx); err != nil {
+		return fmt.Errorf("read replica is unreachable: %w", err)
+	}
+	if r.maxLag <= 0 {
+		return nil
+	}
+	lag, err := r.lagFunc(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get replication lag: %w", err)
+	}
+	if lag > r.maxLag {
+		return fmt.Errorf("read replica lags behind by %s, more than %s", lag, r.maxLag)
+	}
+	return nil
+}
+
+func (r *ReplicaRouter) ping(ctx context.Context) error {
+	sqlDB, err := r.replica.DB()
+	if err != nil {
+		return fmt.Errorf("failed to get connection pool: %w", err)
+	}
+	return sqlDB.PingContext(ctx)
+}
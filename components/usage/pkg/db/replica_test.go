@@ -0,0 +1,80 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplicaRouter_WithoutReplica(t *testing.T) {
+	primary, err := ConnectReplica(ConnectionParams{Host: "127.0.0.1:1"})
+	require.NoError(t, err)
+
+	router := NewReplicaRouter(primary, nil, DefaultReplicaCheckInterval, 0)
+	require.Same(t, primary, router.Reader(context.Background()))
+	require.Same(t, primary, router.Primary())
+	require.NoError(t, router.HealthCheck())
+}
+
+func TestReplicaRouter_FallsBackToPrimary(t *testing.T) {
+	primary, err := ConnectReplica(ConnectionParams{Host: "127.0.0.1:1"})
+	require.NoError(t, err)
+	replica, err := ConnectReplica(ConnectionParams{Host: "127.0.0.1:2"})
+	require.NoError(t, err)
+
+	now := time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)
+	router := NewReplicaRouter(primary, replica, time.Minute, 0)
+	router.nowFunc = func() time.Time { return now }
+
+	require.Same(t, primary, router.Reader(context.Background()), "an unavailable replica must not be used")
+
+	// Within the check interval, the replica is not checked again.
+	router.available = true
+	now = now.Add(30 * time.Second)
+	require.Same(t, replica, router.Reader(context.Background()))
+
+	now = now.Add(time.Minute)
+	require.Same(t, primary, router.Reader(context.Background()))
+}
+
+func TestReplicaRouter_ReplicationLag(t *testing.T) {
+	primary, err := ConnectReplica(ConnectionParams{Host: "127.0.0.1:1"})
+	require.NoError(t, err)
+	replica, err := ConnectReplica(ConnectionParams{Host: "127.0.0.1:2"})
+	require.NoError(t, err)
+
+	now := time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)
+	router := NewReplicaRouter(primary, replica, time.Minute, 30*time.Second)
+	router.nowFunc = func() time.Time { return now }
+	router.pingFunc = func(ctx context.Context) error { return nil }
+	lag := 10 * time.Second
+	var lagErr error
+	router.lagFunc = func(ctx context.Context) (time.Duration, error) { return lag, lagErr }
+
+	require.Same(t, replica, router.Reader(context.Background()))
+	require.NoError(t, router.HealthCheck())
+
+	lag = time.Minute
+	now = now.Add(time.Minute)
+	require.Same(t, primary, router.Reader(context.Background()), "a lagging replica must not be used")
+	err = router.HealthCheck()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "lags behind by 1m0s")
+
+	lag, lagErr = 0, errors.New("replication is not running")
+	now = now.Add(time.Minute)
+	require.Same(t, primary, router.Reader(context.Background()), "a replica with unknown lag must not be used")
+	require.Error(t, router.HealthCheck())
+
+	lagErr = nil
+	now = now.Add(time.Minute)
+	require.Same(t, replica, router.Reader(context.Background()))
+	require.NoError(t, router.HealthCheck())
+}
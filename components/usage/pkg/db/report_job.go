@@ -0,0 +1,103 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var ReportJobNotFound = errors.New("ReportJob not found")
+
+type ReportJobState string
+
+const (
+	ReportJobState_Running   ReportJobState = "running"
+	ReportJobState_Completed ReportJobState = "completed"
+	ReportJobState_Failed    ReportJobState = "failed"
+	ReportJobState_Cancelled ReportJobState = "cancelled"
+)
+
+// ReportJob tracks the generation of a usage report.
+type ReportJob struct {
+	ID    uuid.UUID      `gorm:"primary_key;column:id;type:char;size:36;" json:"id"`
+	State ReportJobState `gorm:"column:state;type:varchar;size:255;" json:"state"`
+
+	From time.Time `gorm:"column:fromTime;type:timestamp;" json:"fromTime"`
+	To   time.Time `gorm:"column:toTime;type:timestamp;" json:"toTime"`
+
+	InstancesProcessed int64 `gorm:"column:instancesProcessed;type:bigint;" json:"instancesProcessed"`
+	InstancesTotal     int64 `gorm:"column:instancesTotal;type:bigint;" json:"instancesTotal"`
+
+	ReportID string `gorm:"column:reportId;type:varchar;size:255;" json:"reportId"`
+	Error    string `gorm:"column:error;type:text;" json:"error"`
+
+	StartedAt  time.Time    `gorm:"column:startedAt;type:timestamp;" json:"startedAt"`
+	FinishedAt sql.NullTime `gorm:"column:finishedAt;type:timestamp;" json:"finishedAt"`
+}
+
+// TableName sets the insert table name for this struct type
+func (j *ReportJob) TableName() string {
+	return "d_b_usage_report_job"
+}
+
+func CreateReportJob(ctx context.Context, conn *gorm.DB, job ReportJob) error {
+	result := conn.WithContext(ctx).Create(&job)
+	if result.Error != nil {
+		return fmt.Errorf("failed to create report job: %w", result.Error)
+	}
+	return nil
+}
+
+func GetReportJob(ctx context.Context, conn *gorm.DB, id uuid.UUID) (ReportJob, error) {
+	var job ReportJob
+	result := conn.WithContext(ctx).First(&job, "id = ?", id.String())
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return ReportJob{}, ReportJobNotFound
+		}
+		return ReportJob{}, fmt.Errorf("failed to get report job: %w", result.Error)
+	}
+	return job, nil
+}
+
+func UpdateReportJobProgress(ctx context.Context, conn *gorm.DB, id uuid.UUID, processed, total int64) error {
+	result := conn.WithContext(ctx).
+		Model(&ReportJob{}).
+		Where("id = ?", id.String()).
+		Updates(map[string]interface{}{
+			"instancesProcessed": processed,
+			"instancesTotal":     total,
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to update report job progress: %w", result.Error)
+	}
+	return nil
+}
+
+// FinishReportJob moves a running job into a final state. Jobs which already finished are left untouched, such that
+// a cancellation is not overwritten by the job failing as a consequence of it.
+func FinishReportJob(ctx context.Context, conn *gorm.DB, id uuid.UUID, state ReportJobState, reportID string, errorMessage string, finishedAt time.Time) error {
+	result := conn.WithContext(ctx).
+		Model(&ReportJob{}).
+		Where("id = ?", id.String()).
+		Where("state = ?", ReportJobState_Running).
+		Updates(map[string]interface{}{
+			"state":      state,
+			"reportId":   reportID,
+			"error":      errorMessage,
+			"finishedAt": finishedAt,
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to finish report job: %w", result.Error)
+	}
+	return nil
+}
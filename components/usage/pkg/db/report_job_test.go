@@ -0,0 +1,52 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/db/dbtest"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReportJob_Lifecycle(t *testing.T) {
+	conn := dbtest.ConnectInMemoryForTests(t)
+	ctx := context.Background()
+
+	job := db.ReportJob{
+		ID:        uuid.New(),
+		State:     db.ReportJobState_Running,
+		From:      time.Date(2022, 8, 1, 0, 0, 0, 0, time.UTC),
+		To:        time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC),
+		StartedAt: time.Now().UTC().Truncate(time.Second),
+	}
+	require.NoError(t, db.CreateReportJob(ctx, conn, job))
+	t.Cleanup(func() {
+		require.NoError(t, conn.Where("id = ?", job.ID.String()).Delete(&db.ReportJob{}).Error)
+	})
+
+	require.NoError(t, db.UpdateReportJobProgress(ctx, conn, job.ID, 50, 100))
+	read, err := db.GetReportJob(ctx, conn, job.ID)
+	require.NoError(t, err)
+	require.Equal(t, db.ReportJobState_Running, read.State)
+	require.EqualValues(t, 50, read.InstancesProcessed)
+	require.EqualValues(t, 100, read.InstancesTotal)
+
+	require.NoError(t, db.FinishReportJob(ctx, conn, job.ID, db.ReportJobState_Cancelled, "", "", time.Now()))
+	// a job which already finished must not change state anymore
+	require.NoError(t, db.FinishReportJob(ctx, conn, job.ID, db.ReportJobState_Failed, "", "context canceled", time.Now()))
+
+	read, err = db.GetReportJob(ctx, conn, job.ID)
+	require.NoError(t, err)
+	require.Equal(t, db.ReportJobState_Cancelled, read.State)
+	require.True(t, read.FinishedAt.Valid)
+
+	_, err = db.GetReportJob(ctx, conn, uuid.New())
+	require.ErrorIs(t, err, db.ReportJobNotFound)
+}
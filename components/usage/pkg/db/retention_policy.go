@@ -0,0 +1,229 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// InstallationRetentionPolicyID is the ID of the retention policy of the installation. Every installation has its own
+// database, hence there is only one policy.
+const InstallationRetentionPolicyID = "installation"
+
+// purgeBatchSize is the number of rows which are deleted at once.
+const purgeBatchSize = 1000
+
+// RetentionPolicy configures how long data is retained, before the janitor permanently deletes it. A retention period
+// of 0 days retains data indefinitely.
+type RetentionPolicy struct {
+	ID string `gorm:"primary_key;column:id;type:varchar;size:64;" json:"id"`
+
+	SessionRetentionDays int32 `gorm:"column:sessionRetentionDays;type:int;" json:"sessionRetentionDays"`
+	LedgerRetentionDays  int32 `gorm:"column:ledgerRetentionDays;type:int;" json:"ledgerRetentionDays"`
+	ReportRetentionDays  int32 `gorm:"column:reportRetentionDays;type:int;" json:"reportRetentionDays"`
+
+	UpdatedAt VarcharTime `gorm:"column:updatedAt;type:varchar;size:255;" json:"updatedAt"`
+}
+
+// TableName sets the insert table name for this struct type
+func (p *RetentionPolicy) TableName() string {
+	return "d_b_usage_retention_policy"
+}
+
+// GetRetentionPolicy returns the retention policy of the installation. Installations which never set a policy retain
+// all data indefinitely.
+func GetRetentionPolicy(ctx context.Context, conn *gorm.DB) (RetentionPolicy, error) {
+	var policy RetentionPolicy
+	err := conn.WithContext(ctx).Where("id = ?", InstallationRetentionPolicyID).First(&policy).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return RetentionPolicy{ID: InstallationRetentionPolicyID}, nil
+	}
+	if err != nil {
+		return RetentionPolicy{}, fmt.Errorf("failed to get retention policy: %w", err)
+	}
+	return policy, nil
+}
+
+// SetRetentionPolicy replaces the retention policy of the installation.
+func SetRetentionPolicy(ctx context.Context, conn *gorm.DB, policy RetentionPolicy) error {
+	policy.ID = InstallationRetentionPolicyID
+	result := conn.WithContext(ctx).
+		Clauses(clause.OnConflict{UpdateAll: true}).
+		Create(&policy)
+	if result.Error != nil {
+		return fmt.Errorf("failed to set retention policy: %w", result.Error)
+	}
+	return nil
+}
+
+// PurgeWorkspaceInstanceUsage permanently deletes workspace instance usage which stopped before `before`, including
+// archived usage. Usage of instances which are still running is retained.
+func PurgeWorkspaceInstanceUsage(ctx context.Context, conn *gorm.DB, before time.Time) (int64, error) {
+	var purged int64
+	for _, table := range []string{(&WorkspaceInstanceUsage{}).TableName(), WorkspaceInstanceUsageArchiveTableName} {
+		n, err := purgeInBatches(ctx, conn, table, "instanceId", func(query *gorm.DB) *gorm.DB {
+			return query.Where("stoppedAt < ?", before)
+		})
+		purged += n
+		if err != nil {
+			return purged, fmt.Errorf("failed to purge workspace instance usage from %s: %w", table, err)
+		}
+	}
+	return purged, nil
+}
+
+// PurgeLedgerUsage permanently deletes finalized usage effective before `before`, including archived usage. Like
+// ArchiveUsage it retains credit grants and their expiries, because expiring credit grants depends on them. The
+// balance of the purged usage is carried forward in an adjustment per attribution ID effective at `before`, such that
+// purging does not change balances. Adjustments of earlier purges are purged and carried forward again.
+func PurgeLedgerUsage(ctx context.Context, conn *gorm.DB, before time.Time) (int64, error) {
+	var purged int64
+	for _, table := range []string{(&Usage{}).TableName(), UsageArchiveTableName} {
+		for {
+			n, err := purgeLedgerUsageBatch(ctx, conn, table, before)
+			purged += n
+			if err != nil {
+				return purged, fmt.Errorf("failed to purge usage from %s: %w", table, err)
+			}
+			if n == 0 {
+				break
+			}
+		}
+	}
+	return purged, nil
+}
+
+// purgeLedgerUsageBatch deletes up to purgeBatchSize rows of PurgeLedgerUsage from the table, and carries their balance
+// forward in the same transaction. It returns the number of deleted rows.
+func purgeLedgerUsageBatch(ctx context.Context, conn *gorm.DB, table string, before time.Time) (int64, error) {
+	var purged int64
+	err := WithRetryableTx(ctx, conn, func(tx *gorm.DB) error {
+		purged = 0
+		var records []Usage
+		err := tx.Table(table).
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("effectiveTime < ?", TimeToISO8601(before)).
+			Where("draft = ?", false).
+			Where("kind NOT IN ?", []UsageKind{CreditGrantUsageKind, CreditGrantExpiryUsageKind}).
+			Limit(purgeBatchSize).
+			Find(&records).Error
+		if err != nil {
+			return fmt.Errorf("failed to find usage to purge: %w", err)
+		}
+		if len(records) == 0 {
+			return nil
+		}
+
+		carriedForward := map[AttributionID]CreditCents{}
+		var ids []string
+		for _, record := range records {
+			ids = append(ids, record.ID.String())
+			// Soft-deleted usage is not included in the balance.
+			if record.SoftDeletedTime.IsSet() {
+				continue
+			}
+			carriedForward[record.AttributionID] += record.CreditCents
+		}
+
+		var carryForwards []Usage
+		for attributionID, creditCents := range carriedForward {
+			if creditCents == 0 {
+				continue
+			}
+			carryForward, err := newCarryForwardUsage(attributionID, creditCents, before)
+			if err != nil {
+				return err
+			}
+			carryForwards = append(carryForwards, carryForward)
+		}
+		if len(carryForwards) > 0 {
+			if _, err := claimUsageIDs(tx, carryForwards, false); err != nil {
+				return err
+			}
+			if err := tx.Create(&carryForwards).Error; err != nil {
+				return fmt.Errorf("failed to carry forward balance of purged usage: %w", err)
+			}
+		}
+
+		result := tx.Exec(fmt.Sprintf("DELETE FROM `%s` WHERE `id` IN ?", table), ids)
+		if result.Error != nil {
+			return fmt.Errorf("failed to delete %d rows: %w", len(ids), result.Error)
+		}
+		purged = result.RowsAffected
+
+		// Daily summaries include the purged usage, but not the adjustments carrying it forward.
+		if err := invalidateSummarizedDays(ctx, tx, records); err != nil {
+			return err
+		}
+		return InvalidateCachedBalances(ctx, tx, attributionIDsOf(records)...)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return purged, nil
+}
+
+// newCarryForwardUsage constructs the adjustment which carries the balance `creditCents` of purged usage of
+// `attributionID` forward to `effectiveTime`.
+func newCarryForwardUsage(attributionID AttributionID, creditCents CreditCents, effectiveTime time.Time) (Usage, error) {
+	usage := Usage{
+		ID:            uuid.New(),
+		AttributionID: attributionID,
+		Description:   "Balance of usage purged by the retention policy",
+		CreditCents:   creditCents,
+		EffectiveTime: NewVarcharTime(effectiveTime),
+		Kind:          AdjustmentUsageKind,
+	}
+	err := usage.SetMetadataWithAdjustment(AdjustmentUsageData{
+		Actor:  "retention-policy",
+		Reason: fmt.Sprintf("Carried forward the balance of usage effective before %s", TimeToISO8601(effectiveTime)),
+	})
+	if err != nil {
+		return Usage{}, err
+	}
+	return usage, nil
+}
+
+// PurgeReportJobs permanently deletes report jobs which finished before `before`. Running jobs are retained.
+func PurgeReportJobs(ctx context.Context, conn *gorm.DB, before time.Time) (int64, error) {
+	n, err := purgeInBatches(ctx, conn, (&ReportJob{}).TableName(), "id", func(query *gorm.DB) *gorm.DB {
+		return query.Where("finishedAt < ?", before)
+	})
+	if err != nil {
+		return n, fmt.Errorf("failed to purge report jobs: %w", err)
+	}
+	return n, nil
+}
+
+// purgeInBatches deletes the rows of the table matching the filter in batches of purgeBatchSize, such that large purges
+// do not lock the table for long. It returns the number of deleted rows, also when a batch failed.
+func purgeInBatches(ctx context.Context, conn *gorm.DB, table, key string, filter func(*gorm.DB) *gorm.DB) (int64, error) {
+	var purged int64
+	for {
+		var ids []string
+		err := filter(conn.WithContext(ctx).Table(table)).
+			Limit(purgeBatchSize).
+			Pluck(key, &ids).Error
+		if err != nil {
+			return purged, fmt.Errorf("failed to find rows to purge: %w", err)
+		}
+		if len(ids) == 0 {
+			return purged, nil
+		}
+
+		result := conn.WithContext(ctx).Exec(fmt.Sprintf("DELETE FROM `%s` WHERE `%s` IN ?", table, key), ids)
+		if result.Error != nil {
+			return purged, fmt.Errorf("failed to delete %d rows: %w", len(ids), result.Error)
+		}
+		purged += result.RowsAffected
+	}
+}
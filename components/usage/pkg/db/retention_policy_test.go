@@ -0,0 +1,183 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/db/dbtest"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetentionPolicy_GetAndSet(t *testing.T) {
+	conn := dbtest.ConnectInMemoryForTests(t)
+	ctx := context.Background()
+
+	policy, err := db.GetRetentionPolicy(ctx, conn)
+	require.NoError(t, err)
+	require.Equal(t, db.RetentionPolicy{ID: db.InstallationRetentionPolicyID}, policy, "must retain everything without a policy")
+
+	updatedAt := time.Date(2022, 10, 15, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, db.SetRetentionPolicy(ctx, conn, db.RetentionPolicy{SessionRetentionDays: 90, UpdatedAt: db.NewVarcharTime(updatedAt)}))
+	require.NoError(t, db.SetRetentionPolicy(ctx, conn, db.RetentionPolicy{SessionRetentionDays: 180, ReportRetentionDays: 365, UpdatedAt: db.NewVarcharTime(updatedAt)}))
+
+	policy, err = db.GetRetentionPolicy(ctx, conn)
+	require.NoError(t, err)
+	require.Equal(t, db.InstallationRetentionPolicyID, policy.ID)
+	require.EqualValues(t, 180, policy.SessionRetentionDays)
+	require.Zero(t, policy.LedgerRetentionDays)
+	require.EqualValues(t, 365, policy.ReportRetentionDays)
+	require.Equal(t, updatedAt, policy.UpdatedAt.Time())
+}
+
+func TestPurgeWorkspaceInstanceUsage(t *testing.T) {
+	conn := dbtest.ConnectInMemoryForTests(t)
+	ctx := context.Background()
+	before := time.Date(2022, 7, 1, 0, 0, 0, 0, time.UTC)
+
+	stoppedBefore := dbtest.NewWorkspaceInstanceUsage(t, db.WorkspaceInstanceUsage{
+		StartedAt: before.Add(-2 * time.Hour),
+		StoppedAt: sql.NullTime{Time: before.Add(-time.Hour), Valid: true},
+	})
+	stoppedAfter := dbtest.NewWorkspaceInstanceUsage(t, db.WorkspaceInstanceUsage{
+		StartedAt: before.Add(-time.Hour),
+		StoppedAt: sql.NullTime{Time: before.Add(time.Hour), Valid: true},
+	})
+	running := dbtest.NewWorkspaceInstanceUsage(t, db.WorkspaceInstanceUsage{StartedAt: before.Add(-time.Hour)})
+	archived := dbtest.NewWorkspaceInstanceUsage(t, db.WorkspaceInstanceUsage{
+		StartedAt: before.Add(-48 * time.Hour),
+		StoppedAt: sql.NullTime{Time: before.Add(-47 * time.Hour), Valid: true},
+	})
+	require.NoError(t, conn.Create([]db.WorkspaceInstanceUsage{stoppedBefore, stoppedAfter, running}).Error)
+	require.NoError(t, conn.Table(db.WorkspaceInstanceUsageArchiveTableName).Create(&archived).Error)
+
+	purged, err := db.PurgeWorkspaceInstanceUsage(ctx, conn, before)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, purged, "must purge usage which stopped before, including archived usage")
+
+	var remaining []string
+	require.NoError(t, conn.Model(&db.WorkspaceInstanceUsage{}).Pluck("instanceId", &remaining).Error)
+	require.ElementsMatch(t, []string{stoppedAfter.InstanceID.String(), running.InstanceID.String()}, remaining)
+}
+
+func TestPurgeLedgerUsage(t *testing.T) {
+	conn := dbtest.ConnectInMemoryForTests(t)
+	ctx := context.Background()
+	before := time.Date(2022, 7, 1, 0, 0, 0, 0, time.UTC)
+	attributionID := db.NewTeamAttributionID(uuid.New().String())
+
+	old := dbtest.NewUsage(t, db.Usage{AttributionID: attributionID, EffectiveTime: db.NewVarcharTime(before.Add(-time.Hour))})
+	recent := dbtest.NewUsage(t, db.Usage{AttributionID: attributionID, EffectiveTime: db.NewVarcharTime(before.Add(time.Hour))})
+	draft := dbtest.NewUsage(t, db.Usage{AttributionID: attributionID, EffectiveTime: db.NewVarcharTime(before.Add(-time.Hour)), Draft: true})
+	grant := dbtest.NewUsage(t, db.Usage{AttributionID: attributionID, EffectiveTime: db.NewVarcharTime(before.Add(-time.Hour)), Kind: db.CreditGrantUsageKind, CreditCents: -1000})
+	archived := dbtest.NewUsage(t, db.Usage{AttributionID: attributionID, EffectiveTime: db.NewVarcharTime(before.AddDate(0, -1, 0))})
+	dbtest.CreateUsageRecords(t, conn, old, recent, draft, grant)
+	require.NoError(t, conn.Table(db.UsageArchiveTableName).Create(&archived).Error)
+
+	purged, err := db.PurgeLedgerUsage(ctx, conn, before)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, purged, "must purge finalized usage effective before, including archived usage")
+
+	var remaining []string
+	require.NoError(t, conn.Model(&db.Usage{}).Where("kind <> ?", db.AdjustmentUsageKind).Pluck("id", &remaining).Error)
+	require.ElementsMatch(t, []string{recent.ID.String(), draft.ID.String(), grant.ID.String()}, remaining, "must retain drafts and credit grants")
+
+	var carriedForward db.CreditCents
+	var carryForwards []db.Usage
+	require.NoError(t, conn.Where("kind = ?", db.AdjustmentUsageKind).Find(&carryForwards).Error)
+	for _, carryForward := range carryForwards {
+		require.Equal(t, attributionID, carryForward.AttributionID)
+		require.Equal(t, before, carryForward.EffectiveTime.Time())
+		carriedForward += carryForward.CreditCents
+	}
+	require.Equal(t, old.CreditCents+archived.CreditCents, carriedForward, "must carry forward the balance of purged usage")
+
+	// A later purge carries forward the adjustments of the earlier one.
+	_, err = db.PurgeLedgerUsage(ctx, conn, before.Add(2*time.Hour))
+	require.NoError(t, err)
+	require.NoError(t, conn.Where("kind = ?", db.AdjustmentUsageKind).Find(&carryForwards).Error)
+	require.Len(t, carryForwards, 1)
+	require.Equal(t, old.CreditCents+archived.CreditCents+recent.CreditCents, carryForwards[0].CreditCents)
+}
+
+func TestPurgeLedgerUsage_SummarizedUsage(t *testing.T) {
+	conn := dbtest.ConnectForTests(t)
+	ctx := context.Background()
+	// Far in the past, such that usage of other tests is not purged.
+	before := time.Date(2000, 7, 1, 0, 0, 0, 0, time.UTC)
+	attributionID := db.NewTeamAttributionID(uuid.New().String())
+	other := db.NewTeamAttributionID(uuid.New().String())
+
+	softDeleted := dbtest.NewUsage(t, db.Usage{AttributionID: attributionID, EffectiveTime: db.NewVarcharTime(before.AddDate(0, -2, 0)), CreditCents: 400})
+	softDeleted.SoftDeletedTime = db.NewVarcharTime(before.AddDate(0, -1, 0))
+	dbtest.CreateUsageRecords(t, conn,
+		dbtest.NewUsage(t, db.Usage{AttributionID: attributionID, EffectiveTime: db.NewVarcharTime(before.AddDate(0, -3, 0)), Kind: db.CreditGrantUsageKind, CreditCents: -10000}),
+		dbtest.NewUsage(t, db.Usage{AttributionID: attributionID, EffectiveTime: db.NewVarcharTime(before.AddDate(0, -2, 0)), CreditCents: 1500}),
+		dbtest.NewUsage(t, db.Usage{AttributionID: attributionID, EffectiveTime: db.NewVarcharTime(before.AddDate(0, -1, 0)), Kind: db.InvoiceUsageKind, CreditCents: -700}),
+		dbtest.NewUsage(t, db.Usage{AttributionID: attributionID, EffectiveTime: db.NewVarcharTime(before.AddDate(0, 0, 1)), CreditCents: 300}),
+		dbtest.NewUsage(t, db.Usage{AttributionID: other, EffectiveTime: db.NewVarcharTime(before.AddDate(0, -1, 0)), CreditCents: 900}),
+		softDeleted,
+	)
+	archived := dbtest.NewUsage(t, db.Usage{AttributionID: attributionID, EffectiveTime: db.NewVarcharTime(before.AddDate(0, -4, 0)), CreditCents: 2000})
+	require.NoError(t, conn.Table(db.UsageArchiveTableName).Create(&archived).Error)
+
+	// Summarize the purged days, such that the summaries include the purged usage.
+	now := before.AddDate(0, 1, 0)
+	refreshSummaries := func() {
+		for _, id := range []db.AttributionID{attributionID, other} {
+			require.NoError(t, db.RefreshUsageDailySummaries(ctx, conn, id, now))
+		}
+	}
+	balances := func() map[db.AttributionID]db.CreditCents {
+		result := map[db.AttributionID]db.CreditCents{}
+		for _, id := range []db.AttributionID{attributionID, other} {
+			balance, err := db.GetBalance(ctx, conn, id)
+			require.NoError(t, err)
+			result[id] = balance
+		}
+		return result
+	}
+	refreshSummaries()
+	expected := map[db.AttributionID]db.CreditCents{attributionID: -10000 + 1500 - 700 + 300 + 2000, other: 900}
+	require.Equal(t, expected, balances())
+
+	_, err := db.PurgeLedgerUsage(ctx, conn, before)
+	require.NoError(t, err)
+	require.Equal(t, expected, balances(), "must not change balances")
+
+	refreshSummaries()
+	require.Equal(t, expected, balances(), "must not change balances once the purged days are summarized again")
+
+	_, err = db.PurgeLedgerUsage(ctx, conn, before.AddDate(0, 0, 2))
+	require.NoError(t, err)
+	require.Equal(t, expected, balances(), "must not change balances when carrying forward earlier purges")
+}
+
+func TestPurgeReportJobs(t *testing.T) {
+	conn := dbtest.ConnectInMemoryForTests(t)
+	ctx := context.Background()
+	before := time.Date(2022, 7, 1, 0, 0, 0, 0, time.UTC)
+
+	finishedBefore := db.ReportJob{ID: uuid.New(), State: db.ReportJobState_Completed, StartedAt: before.Add(-2 * time.Hour), FinishedAt: sql.NullTime{Time: before.Add(-time.Hour), Valid: true}}
+	finishedAfter := db.ReportJob{ID: uuid.New(), State: db.ReportJobState_Failed, StartedAt: before.Add(-2 * time.Hour), FinishedAt: sql.NullTime{Time: before.Add(time.Hour), Valid: true}}
+	running := db.ReportJob{ID: uuid.New(), State: db.ReportJobState_Running, StartedAt: before.Add(-2 * time.Hour)}
+	for _, job := range []db.ReportJob{finishedBefore, finishedAfter, running} {
+		require.NoError(t, db.CreateReportJob(ctx, conn, job))
+	}
+
+	purged, err := db.PurgeReportJobs(ctx, conn, before)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, purged)
+
+	_, err = db.GetReportJob(ctx, conn, finishedBefore.ID)
+	require.ErrorIs(t, err, db.ReportJobNotFound)
+	_, err = db.GetReportJob(ctx, conn, running.ID)
+	require.NoError(t, err, "must retain running jobs")
+}
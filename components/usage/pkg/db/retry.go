@@ -0,0 +1,68 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gitpod-io/gitpod/common-go/log"
+	driver_mysql "github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+)
+
+const (
+	// mysqlErrLockWaitTimeout is ER_LOCK_WAIT_TIMEOUT, returned when a lock could not be acquired in time.
+	mysqlErrLockWaitTimeout = 1205
+	// mysqlErrLockDeadlock is ER_LOCK_DEADLOCK, returned when the transaction was rolled back to resolve a deadlock.
+	mysqlErrLockDeadlock = 1213
+)
+
+const (
+	DefaultTxRetryAttempts = 3
+	DefaultTxRetryBackoff  = 50 * time.Millisecond
+)
+
+// IsRetryableTxError returns whether the transaction failed because of a deadlock or a lock wait timeout, such that
+// running it again can succeed.
+func IsRetryableTxError(err error) bool {
+	var mysqlErr *driver_mysql.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return false
+	}
+	return mysqlErr.Number == mysqlErrLockDeadlock || mysqlErr.Number == mysqlErrLockWaitTimeout
+}
+
+// WithRetryableTx runs fn in a transaction, and runs it again in a new transaction with exponential backoff while it
+// fails with a deadlock or a lock wait timeout. fn must not have side effects outside of the transaction.
+//
+// When conn is a transaction already, fn is run in a nested transaction without retries: MySQL rolls back the entire
+// transaction on a deadlock, which only the outermost transaction can run again.
+func WithRetryableTx(ctx context.Context, conn *gorm.DB, fn func(tx *gorm.DB) error) error {
+	if _, inTx := conn.Statement.ConnPool.(gorm.TxCommitter); inTx {
+		return conn.WithContext(ctx).Transaction(fn)
+	}
+	return retryTx(ctx, DefaultTxRetryAttempts, DefaultTxRetryBackoff, func() error {
+		return conn.WithContext(ctx).Transaction(fn)
+	})
+}
+
+func retryTx(ctx context.Context, attempts int, backoff time.Duration, run func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := run()
+		if err == nil || !IsRetryableTxError(err) || attempt >= attempts {
+			return err
+		}
+
+		log.WithError(err).WithField("attempt", attempt).Warn("Transaction failed because of a lock conflict, retrying.")
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
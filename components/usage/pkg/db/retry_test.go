@@ -0,0 +1,79 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	driver_mysql "github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsRetryableTxError(t *testing.T) {
+	deadlock := &driver_mysql.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock; try restarting transaction"}
+	lockWait := &driver_mysql.MySQLError{Number: 1205, Message: "Lock wait timeout exceeded; try restarting transaction"}
+
+	require.True(t, db.IsRetryableTxError(deadlock))
+	require.True(t, db.IsRetryableTxError(lockWait))
+	require.True(t, db.IsRetryableTxError(fmt.Errorf("failed to update usage: %w", deadlock)))
+	require.False(t, db.IsRetryableTxError(&driver_mysql.MySQLError{Number: 1062, Message: "Duplicate entry"}))
+	require.False(t, db.IsRetryableTxError(db.UsageVersionConflict))
+	require.False(t, db.IsRetryableTxError(nil))
+}
+
+func TestRetryTx(t *testing.T) {
+	deadlock := &driver_mysql.MySQLError{Number: 1213}
+
+	t.Run("retries lock conflicts until success", func(t *testing.T) {
+		calls := 0
+		err := db.RetryTx(context.Background(), 3, time.Millisecond, func() error {
+			calls++
+			if calls < 3 {
+				return deadlock
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, 3, calls)
+	})
+
+	t.Run("gives up after the attempts", func(t *testing.T) {
+		calls := 0
+		err := db.RetryTx(context.Background(), 3, time.Millisecond, func() error {
+			calls++
+			return deadlock
+		})
+		require.ErrorIs(t, err, deadlock)
+		require.Equal(t, 3, calls)
+	})
+
+	t.Run("does not retry other errors", func(t *testing.T) {
+		calls := 0
+		other := errors.New("some error")
+		err := db.RetryTx(context.Background(), 3, time.Millisecond, func() error {
+			calls++
+			return other
+		})
+		require.ErrorIs(t, err, other)
+		require.Equal(t, 1, calls)
+	})
+
+	t.Run("stops when the context is done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		calls := 0
+		err := db.RetryTx(ctx, 3, time.Hour, func() error {
+			calls++
+			return deadlock
+		})
+		require.ErrorIs(t, err, context.Canceled)
+		require.Equal(t, 1, calls)
+	})
+}
@@ -0,0 +1,199 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/gitpod-io/gitpod/common-go/util"
+	"github.com/gitpod-io/gitpod/usage/pkg/requestid"
+	"google.golang.org/grpc"
+	"gorm.io/gorm"
+)
+
+// DefaultSlowQueryThreshold is the duration above which statements are captured when no threshold is configured.
+const DefaultSlowQueryThreshold = 200 * time.Millisecond
+
+// SlowQueryConfig configures which statements are captured as slow.
+type SlowQueryConfig struct {
+	// Threshold is the duration above which statements are captured. When Threshold is 0, DefaultSlowQueryThreshold
+	// applies.
+	Threshold util.Duration `json:"threshold,omitempty"`
+	// Queries overrides Threshold by the query which runs a statement, e.g. GetBalance. See InstrumentQueries for query
+	// names.
+	Queries map[string]util.Duration `json:"queries,omitempty"`
+}
+
+func (c SlowQueryConfig) Validate() error {
+	if c.Threshold < 0 {
+		return fmt.Errorf("slow query threshold must not be negative, was %s", time.Duration(c.Threshold))
+	}
+	for query, threshold := range c.Queries {
+		if threshold <= 0 {
+			return fmt.Errorf("slow query threshold of query %s must be positive, was %s", query, time.Duration(threshold))
+		}
+	}
+	return nil
+}
+
+// ThresholdOf returns the duration above which statements of the query are captured.
+func (c SlowQueryConfig) ThresholdOf(query string) time.Duration {
+	if threshold, ok := c.Queries[query]; ok {
+		return time.Duration(threshold)
+	}
+	if c.Threshold == 0 {
+		return DefaultSlowQueryThreshold
+	}
+	return time.Duration(c.Threshold)
+}
+
+type callerContextKey struct{}
+
+// WithCaller attributes the statements run with ctx to caller, e.g. a background job. Statements run while serving an
+// RPC are attributed to its method without it.
+func WithCaller(ctx context.Context, caller string) context.Context {
+	return context.WithValue(ctx, callerContextKey{}, caller)
+}
+
+// callerOf returns the caller the statements of ctx are attributed to, see WithCaller.
+func callerOf(ctx context.Context) string {
+	if ctx == nil {
+		return otherQuery
+	}
+	if caller, ok := ctx.Value(callerContextKey{}).(string); ok && caller != "" {
+		return caller
+	}
+	if method, ok := grpc.Method(ctx); ok {
+		return method
+	}
+	return otherQuery
+}
+
+const (
+	// slowQueryStartKey stores the start of a statement in its gorm instance.
+	slowQueryStartKey = "usage:slow_query_start"
+	// maxRedactedListParams is the length of list parameters above which their values are not logged individually.
+	maxRedactedListParams = 10
+)
+
+// CaptureSlowQueries logs and counts every statement run through conn which takes longer than the threshold of its
+// query. Statements are attributed to their query and caller, see WithCaller. Parameters are logged redacted, only
+// numbers, booleans and times are kept.
+func CaptureSlowQueries(conn *gorm.DB, c SlowQueryConfig) error {
+	if err := c.Validate(); err != nil {
+		return fmt.Errorf("invalid slow query configuration: %w", err)
+	}
+
+	type registerer interface {
+		Register(name string, fn func(*gorm.DB)) error
+	}
+
+	callbacks := conn.Callback()
+	for _, cb := range []struct {
+		Operation     string
+		Before, After registerer
+	}{
+		{Operation: "create", Before: callbacks.Create().Before("gorm:create"), After: callbacks.Create().After("gorm:create")},
+		{Operation: "query", Before: callbacks.Query().Before("gorm:query"), After: callbacks.Query().After("gorm:query")},
+		{Operation: "update", Before: callbacks.Update().Before("gorm:update"), After: callbacks.Update().After("gorm:update")},
+		{Operation: "delete", Before: callbacks.Delete().Before("gorm:delete"), After: callbacks.Delete().After("gorm:delete")},
+		{Operation: "row", Before: callbacks.Row().Before("gorm:row"), After: callbacks.Row().After("gorm:row")},
+		{Operation: "raw", Before: callbacks.Raw().Before("gorm:raw"), After: callbacks.Raw().After("gorm:raw")},
+	} {
+		if err := cb.Before.Register("usage:slow_query_before_"+cb.Operation, func(tx *gorm.DB) {
+			tx.InstanceSet(slowQueryStartKey, time.Now())
+		}); err != nil {
+			return fmt.Errorf("failed to capture slow %s statements: %w", cb.Operation, err)
+		}
+		if err := cb.After.Register("usage:slow_query_after_"+cb.Operation, captureSlowQuery(c)); err != nil {
+			return fmt.Errorf("failed to capture slow %s statements: %w", cb.Operation, err)
+		}
+	}
+	return nil
+}
+
+func captureSlowQuery(c SlowQueryConfig) func(tx *gorm.DB) {
+	return func(tx *gorm.DB) {
+		value, ok := tx.InstanceGet(slowQueryStartKey)
+		if !ok {
+			return
+		}
+		start, ok := value.(time.Time)
+		if !ok {
+			return
+		}
+
+		query := statementQueryName(tx)
+		duration := time.Since(start)
+		if duration < c.ThresholdOf(query) {
+			return
+		}
+
+		ctx := tx.Statement.Context
+		caller := callerOf(ctx)
+		slowQueriesTotal.WithLabelValues(query, caller).Inc()
+
+		params := make([]interface{}, 0, len(tx.Statement.Vars))
+		for _, v := range tx.Statement.Vars {
+			params = append(params, redactQueryParam(v))
+		}
+		logger := requestid.Log(ctx)
+		if tx.Error != nil {
+			logger = logger.WithError(tx.Error)
+		}
+		logger.
+			WithField("query", query).
+			WithField("caller", caller).
+			WithField("duration", duration).
+			WithField("rows_affected", tx.Statement.RowsAffected).
+			WithField("sql", tx.Statement.SQL.String()).
+			WithField("params", params).
+			Warn("Slow database query.")
+	}
+}
+
+// redactQueryParam returns the parameter of a statement as it is logged. Numbers, booleans and times do not identify
+// anyone and are kept, such that e.g. the billing period of a query stays visible. Other values are replaced by their
+// type and size.
+func redactQueryParam(param interface{}) interface{} {
+	switch p := param.(type) {
+	case nil:
+		return nil
+	case time.Time:
+		return p
+	case VarcharTime:
+		return p.String()
+	}
+
+	v := reflect.ValueOf(param)
+	switch v.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		return param
+	case reflect.String:
+		// Times are stored as strings, see VarcharTime.
+		if _, err := time.Parse(time.RFC3339Nano, v.String()); err == nil {
+			return v.String()
+		}
+		return fmt.Sprintf("<redacted %T of length %d>", param, v.Len())
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return fmt.Sprintf("<redacted %d bytes>", v.Len())
+		}
+		// Lists of e.g. attribution IDs can be long, only their length is relevant.
+		if v.Len() > maxRedactedListParams {
+			return fmt.Sprintf("<redacted list of %d values>", v.Len())
+		}
+		redacted := make([]interface{}, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			redacted = append(redacted, redactQueryParam(v.Index(i).Interface()))
+		}
+		return redacted
+	}
+	return fmt.Sprintf("<redacted %T>", param)
+}
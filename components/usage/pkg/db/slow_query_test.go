@@ -0,0 +1,113 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gitpod-io/gitpod/common-go/log"
+	"github.com/gitpod-io/gitpod/common-go/util"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+func TestSlowQueryConfig(t *testing.T) {
+	require.NoError(t, SlowQueryConfig{}.Validate())
+	require.Error(t, SlowQueryConfig{Threshold: util.Duration(-time.Second)}.Validate())
+	require.Error(t, SlowQueryConfig{Queries: map[string]util.Duration{"GetBalance": 0}}.Validate())
+
+	c := SlowQueryConfig{Queries: map[string]util.Duration{"FindStoppedWorkspaceInstancesInRange": util.Duration(5 * time.Second)}}
+	require.Equal(t, DefaultSlowQueryThreshold, c.ThresholdOf("GetBalance"))
+	require.Equal(t, 5*time.Second, c.ThresholdOf("FindStoppedWorkspaceInstancesInRange"))
+
+	c.Threshold = util.Duration(time.Second)
+	require.Equal(t, time.Second, c.ThresholdOf("GetBalance"))
+}
+
+func TestRedactQueryParam(t *testing.T) {
+	periodStart := time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)
+	for _, s := range []struct {
+		Name     string
+		Param    interface{}
+		Expected interface{}
+	}{
+		{Name: "nil", Param: nil, Expected: nil},
+		{Name: "number", Param: int64(42), Expected: int64(42)},
+		{Name: "credit cents", Param: NewCreditCents(1.5), Expected: NewCreditCents(1.5)},
+		{Name: "bool", Param: true, Expected: true},
+		{Name: "time", Param: periodStart, Expected: periodStart},
+		{Name: "varchar time", Param: NewVarcharTime(periodStart), Expected: NewVarcharTime(periodStart).String()},
+		{Name: "time string", Param: "2022-10-01T00:00:00.000Z", Expected: "2022-10-01T00:00:00.000Z"},
+		{Name: "string", Param: "jane@example.com", Expected: "<redacted string of length 16>"},
+		{Name: "attribution ID", Param: NewTeamAttributionID("0d4f5e7c"), Expected: "<redacted db.AttributionID of length 13>"},
+		{Name: "uuid", Param: uuid.New(), Expected: "<redacted 16 bytes>"},
+		{Name: "list", Param: []interface{}{"a", 1}, Expected: []interface{}{"<redacted string of length 1>", 1}},
+		{Name: "long list", Param: make([]string, maxRedactedListParams+1), Expected: "<redacted list of 11 values>"},
+	} {
+		t.Run(s.Name, func(t *testing.T) {
+			require.Equal(t, s.Expected, redactQueryParam(s.Param))
+		})
+	}
+}
+
+type fakeServerTransportStream struct {
+	grpc.ServerTransportStream
+	method string
+}
+
+func (s fakeServerTransportStream) Method() string {
+	return s.method
+}
+
+func TestCallerOf(t *testing.T) {
+	require.Equal(t, otherQuery, callerOf(context.Background()))
+
+	rpc := grpc.NewContextWithServerTransportStream(context.Background(), fakeServerTransportStream{method: "/usage.v1.UsageService/ReconcileUsageWithLedger"})
+	require.Equal(t, "/usage.v1.UsageService/ReconcileUsageWithLedger", callerOf(rpc))
+	require.Equal(t, "usage_archive", callerOf(WithCaller(rpc, "usage_archive")))
+}
+
+func TestCaptureSlowQueries(t *testing.T) {
+	original := log.Log.Logger.ReplaceHooks(make(logrus.LevelHooks))
+	t.Cleanup(func() {
+		log.Log.Logger.ReplaceHooks(original)
+	})
+	hook := test.NewLocal(log.Log.Logger)
+
+	// Nothing listens on the port, such that every statement fails fast.
+	conn, err := ConnectReplica(ConnectionParams{Host: "127.0.0.1:1", Database: "gitpod"})
+	require.NoError(t, err)
+	require.NoError(t, CaptureSlowQueries(conn, SlowQueryConfig{
+		Threshold: util.Duration(time.Nanosecond),
+		Queries:   map[string]util.Duration{"FindAllDraftUsage": util.Duration(time.Hour)},
+	}))
+
+	before := time.Date(2022, 10, 31, 0, 0, 0, 0, time.UTC)
+	_, err = FindDraftUsageBefore(WithCaller(context.Background(), "test_job"), conn, before)
+	require.Error(t, err)
+	_, err = FindAllDraftUsage(context.Background(), conn)
+	require.Error(t, err)
+
+	require.Equal(t, float64(1), testutil.ToFloat64(slowQueriesTotal.WithLabelValues("FindDraftUsageBefore", "test_job")))
+	require.Equal(t, float64(0), testutil.ToFloat64(slowQueriesTotal.WithLabelValues("FindAllDraftUsage", otherQuery)), "must apply the threshold of the query")
+
+	var captured []*logrus.Entry
+	for _, entry := range hook.AllEntries() {
+		if entry.Message == "Slow database query." {
+			captured = append(captured, entry)
+		}
+	}
+	require.Len(t, captured, 1)
+	require.Equal(t, logrus.WarnLevel, captured[0].Level)
+	require.Equal(t, "FindDraftUsageBefore", captured[0].Data["query"])
+	require.Equal(t, "test_job", captured[0].Data["caller"])
+	require.Contains(t, captured[0].Data["params"], NewVarcharTime(before).String())
+}
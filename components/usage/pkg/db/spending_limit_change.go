@@ -0,0 +1,77 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// SpendingLimitChangeActor_System is the actor of spending limit changes which were not made by a user, for example
+// when a cost center switches to Stripe billing.
+const SpendingLimitChangeActor_System = "system"
+
+// SpendingLimitChange records that Actor changed the spending limit of a cost center from OldSpendingLimit to
+// NewSpendingLimit. Spending limit changes are append-only, they are never updated or deleted.
+type SpendingLimitChange struct {
+	ID               uuid.UUID     `gorm:"primary_key;column:id;type:char;size:36;" json:"id"`
+	AttributionID    AttributionID `gorm:"column:attributionId;type:varchar;size:255;" json:"attributionId"`
+	OldSpendingLimit int32         `gorm:"column:oldSpendingLimit;type:int;" json:"oldSpendingLimit"`
+	NewSpendingLimit int32         `gorm:"column:newSpendingLimit;type:int;" json:"newSpendingLimit"`
+	Actor            string        `gorm:"column:actor;type:varchar;size:255;" json:"actor"`
+	Reason           string        `gorm:"column:reason;type:varchar;size:255;" json:"reason"`
+	// ChangeTime is set by the database when the change is recorded.
+	ChangeTime time.Time `gorm:"->;column:changeTime;type:timestamp;default:CURRENT_TIMESTAMP(6);" json:"changeTime"`
+}
+
+// TableName sets the insert table name for this struct type
+func (c *SpendingLimitChange) TableName() string {
+	return "d_b_cost_center_spending_limit_change"
+}
+
+func recordSpendingLimitChange(tx *gorm.DB, attributionId AttributionID, oldSpendingLimit, newSpendingLimit int32, actor, reason string) error {
+	result := tx.Create(&SpendingLimitChange{
+		ID:               uuid.New(),
+		AttributionID:    attributionId,
+		OldSpendingLimit: oldSpendingLimit,
+		NewSpendingLimit: newSpendingLimit,
+		Actor:            actor,
+		Reason:           reason,
+	})
+	if result.Error != nil {
+		return fmt.Errorf("failed to record spending limit change of %s: %w", attributionId, result.Error)
+	}
+	return nil
+}
+
+// FindSpendingLimitChanges returns the spending limit changes of the attribution ID, most recent first, and the total
+// number of its changes. All changes are returned when limit is 0.
+func FindSpendingLimitChanges(ctx context.Context, conn *gorm.DB, attributionId AttributionID, offset, limit int64) ([]SpendingLimitChange, int64, error) {
+	db := conn.WithContext(ctx).
+		Model(&SpendingLimitChange{}).
+		Where("attributionId = ?", attributionId)
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count spending limit changes of %s: %w", attributionId, err)
+	}
+
+	query := db.Order("changeTime DESC").Order("id ASC")
+	if offset != 0 {
+		query = query.Offset(int(offset))
+	}
+	if limit != 0 {
+		query = query.Limit(int(limit))
+	}
+	var changes []SpendingLimitChange
+	if err := query.Find(&changes).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to find spending limit changes of %s: %w", attributionId, err)
+	}
+	return changes, total, nil
+}
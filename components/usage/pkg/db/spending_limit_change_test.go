@@ -0,0 +1,59 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/db/dbtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetSpendingLimit_RecordsChanges(t *testing.T) {
+	conn := dbtest.ConnectForTests(t)
+	ctx := context.Background()
+	costCenter := dbtest.CreateCostCenters(t, conn, db.CostCenter{SpendingLimit: 100})[0]
+	t.Cleanup(func() {
+		require.NoError(t, conn.Where("attributionId = ?", costCenter.ID).Delete(&db.SpendingLimitChange{}).Error)
+	})
+
+	updated, err := db.SetSpendingLimit(ctx, conn, costCenter.ID, 500, "user-a", "Raised for a hackathon")
+	require.NoError(t, err)
+	require.EqualValues(t, 500, updated.SpendingLimit)
+
+	_, err = db.SetSpendingLimit(ctx, conn, costCenter.ID, 500, "user-b", "No change")
+	require.NoError(t, err)
+
+	_, err = db.SetDebt(ctx, conn, costCenter.ID, 42)
+	require.NoError(t, err)
+
+	_, err = db.SetSpendingLimit(ctx, conn, costCenter.ID, 200, "user-b", "Hackathon is over")
+	require.NoError(t, err)
+
+	changes, total, err := db.FindSpendingLimitChanges(ctx, conn, costCenter.ID, 0, 0)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, total, "only changes of the spending limit are recorded")
+	require.Len(t, changes, 2)
+
+	require.EqualValues(t, 500, changes[0].OldSpendingLimit, "must be ordered most recent first")
+	require.EqualValues(t, 200, changes[0].NewSpendingLimit)
+	require.Equal(t, "user-b", changes[0].Actor)
+	require.Equal(t, "Hackathon is over", changes[0].Reason)
+	require.False(t, changes[0].ChangeTime.IsZero())
+
+	require.EqualValues(t, 100, changes[1].OldSpendingLimit)
+	require.EqualValues(t, 500, changes[1].NewSpendingLimit)
+	require.Equal(t, "user-a", changes[1].Actor)
+
+	page, total, err := db.FindSpendingLimitChanges(ctx, conn, costCenter.ID, 1, 1)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, total)
+	require.Equal(t, []db.SpendingLimitChange{changes[1]}, page)
+
+	_, err = db.SetSpendingLimit(ctx, conn, dbtest.NewCostCenter(t, db.CostCenter{}).ID, 100, "user-a", "Missing")
+	require.ErrorIs(t, err, db.CostCenterNotFound)
+}
@@ -0,0 +1,52 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// StripeWebhookEvent records that a Stripe webhook event was processed, such that redeliveries of the same event
+// are not processed again. Records are kept until ExpiresAt.
+type StripeWebhookEvent struct {
+	EventID     string      `gorm:"primary_key;column:eventId;type:varchar;size:255;" json:"eventId"`
+	EventType   string      `gorm:"column:eventType;type:varchar;size:255;" json:"eventType"`
+	ProcessedAt VarcharTime `gorm:"column:processedAt;type:varchar;size:255;" json:"processedAt"`
+	ExpiresAt   VarcharTime `gorm:"column:expiresAt;type:varchar;size:255;" json:"expiresAt"`
+}
+
+// TableName sets the insert table name for this struct type
+func (e *StripeWebhookEvent) TableName() string {
+	return "d_b_stripe_webhook_event"
+}
+
+// RecordStripeWebhookEvent stores the event and returns false if an event with the same ID was already recorded.
+// Within a transaction, the record is locked until the transaction ends, so concurrent deliveries of the same event
+// wait for each other.
+func RecordStripeWebhookEvent(ctx context.Context, conn *gorm.DB, event StripeWebhookEvent) (bool, error) {
+	result := conn.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&event)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to record stripe webhook event %s: %w", event.EventID, result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// DeleteExpiredStripeWebhookEvents deletes all events which expired before `now` and returns how many were deleted.
+func DeleteExpiredStripeWebhookEvents(ctx context.Context, conn *gorm.DB, now time.Time) (int64, error) {
+	result := conn.WithContext(ctx).
+		Where("expiresAt < ?", TimeToISO8601(now)).
+		Delete(&StripeWebhookEvent{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to delete expired stripe webhook events: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
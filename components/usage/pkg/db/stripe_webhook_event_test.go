@@ -0,0 +1,53 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/db/dbtest"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordStripeWebhookEvent(t *testing.T) {
+	conn := dbtest.ConnectInMemoryForTests(t)
+	ctx := context.Background()
+	now := time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC)
+
+	event := db.StripeWebhookEvent{
+		EventID:     fmt.Sprintf("evt_%s", uuid.New().String()),
+		EventType:   "invoice.finalized",
+		ProcessedAt: db.NewVarcharTime(now),
+		ExpiresAt:   db.NewVarcharTime(now.Add(24 * time.Hour)),
+	}
+	t.Cleanup(func() {
+		require.NoError(t, conn.Where("eventId = ?", event.EventID).Delete(&db.StripeWebhookEvent{}).Error)
+	})
+
+	recorded, err := db.RecordStripeWebhookEvent(ctx, conn, event)
+	require.NoError(t, err)
+	require.True(t, recorded)
+
+	recorded, err = db.RecordStripeWebhookEvent(ctx, conn, event)
+	require.NoError(t, err)
+	require.False(t, recorded, "must not record the same event twice")
+
+	deleted, err := db.DeleteExpiredStripeWebhookEvents(ctx, conn, now.Add(time.Hour))
+	require.NoError(t, err)
+	require.Zero(t, deleted)
+
+	deleted, err = db.DeleteExpiredStripeWebhookEvents(ctx, conn, now.Add(25*time.Hour))
+	require.NoError(t, err)
+	require.EqualValues(t, 1, deleted)
+
+	recorded, err = db.RecordStripeWebhookEvent(ctx, conn, event)
+	require.NoError(t, err)
+	require.True(t, recorded, "expired events can be recorded again")
+}
@@ -14,7 +14,7 @@ import (
 )
 
 func TestTeamMembership_WriteRead(t *testing.T) {
-	conn := dbtest.ConnectForTests(t)
+	conn := dbtest.ConnectInMemoryForTests(t)
 
 	membership := &db.TeamMembership{
 		ID:             uuid.New(),
@@ -0,0 +1,107 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gitpod-io/gitpod/common-go/util"
+	"gorm.io/gorm"
+)
+
+// QueryTimeoutConfig limits how long a single database statement may run. Statements also stop when the context of
+// their query is done. Zero values do not limit statements.
+//
+// Statements which return Row() or Rows() are only limited by the context of their query: their rows are read after
+// gorm returns them, so their timeout could not be released once they are closed.
+type QueryTimeoutConfig struct {
+	// Default limits statements of queries which have no timeout in Queries.
+	Default util.Duration `json:"default,omitempty"`
+	// Queries limits statements by the query which runs them, e.g. GetBalance. See InstrumentQueries for query names.
+	Queries map[string]util.Duration `json:"queries,omitempty"`
+}
+
+func (c QueryTimeoutConfig) Validate() error {
+	if c.Default < 0 {
+		return fmt.Errorf("default query timeout must not be negative, was %s", time.Duration(c.Default))
+	}
+	for query, timeout := range c.Queries {
+		if timeout < 0 {
+			return fmt.Errorf("timeout of query %s must not be negative, was %s", query, time.Duration(timeout))
+		}
+	}
+	return nil
+}
+
+// TimeoutOf returns the timeout of statements of the query, or 0 when they are not limited.
+func (c QueryTimeoutConfig) TimeoutOf(query string) time.Duration {
+	if timeout, ok := c.Queries[query]; ok {
+		return time.Duration(timeout)
+	}
+	return time.Duration(c.Default)
+}
+
+const (
+	// queryContextKey stores the context of a statement before its timeout was applied in its gorm instance.
+	queryContextKey = "usage:query_context"
+	// queryCancelKey stores the function which releases the timeout of a statement in its gorm instance.
+	queryCancelKey = "usage:query_cancel"
+)
+
+// ConfigureQueryTimeouts applies the timeouts to every statement run through conn.
+func ConfigureQueryTimeouts(conn *gorm.DB, c QueryTimeoutConfig) error {
+	if err := c.Validate(); err != nil {
+		return fmt.Errorf("invalid query timeout configuration: %w", err)
+	}
+
+	type registerer interface {
+		Register(name string, fn func(*gorm.DB)) error
+	}
+
+	callbacks := conn.Callback()
+	for _, cb := range []struct {
+		Operation     string
+		Before, After registerer
+	}{
+		{Operation: "create", Before: callbacks.Create().Before("gorm:create"), After: callbacks.Create().After("gorm:create")},
+		{Operation: "query", Before: callbacks.Query().Before("gorm:query"), After: callbacks.Query().After("gorm:query")},
+		{Operation: "update", Before: callbacks.Update().Before("gorm:update"), After: callbacks.Update().After("gorm:update")},
+		{Operation: "delete", Before: callbacks.Delete().Before("gorm:delete"), After: callbacks.Delete().After("gorm:delete")},
+		{Operation: "raw", Before: callbacks.Raw().Before("gorm:raw"), After: callbacks.Raw().After("gorm:raw")},
+	} {
+		if err := cb.Before.Register("usage:timeout_before_"+cb.Operation, applyQueryTimeout(c)); err != nil {
+			return fmt.Errorf("failed to limit %s statements: %w", cb.Operation, err)
+		}
+		if err := cb.After.Register("usage:timeout_after_"+cb.Operation, releaseQueryTimeout); err != nil {
+			return fmt.Errorf("failed to limit %s statements: %w", cb.Operation, err)
+		}
+	}
+	return nil
+}
+
+func applyQueryTimeout(c QueryTimeoutConfig) func(tx *gorm.DB) {
+	return func(tx *gorm.DB) {
+		timeout := c.TimeoutOf(statementQueryName(tx))
+		if timeout <= 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(tx.Statement.Context, timeout)
+		tx.InstanceSet(queryContextKey, tx.Statement.Context)
+		tx.InstanceSet(queryCancelKey, cancel)
+		tx.Statement.Context = ctx
+	}
+}
+
+func releaseQueryTimeout(tx *gorm.DB) {
+	// Later statements of the same gorm instance must not inherit the timeout.
+	if ctx, ok := tx.InstanceGet(queryContextKey); ok {
+		tx.Statement.Context = ctx.(context.Context)
+	}
+	if cancel, ok := tx.InstanceGet(queryCancelKey); ok {
+		cancel.(context.CancelFunc)()
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gitpod-io/gitpod/common-go/util"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestQueryTimeoutConfig(t *testing.T) {
+	c := QueryTimeoutConfig{
+		Default: util.Duration(5 * time.Second),
+		Queries: map[string]util.Duration{
+			"GetBalance":           util.Duration(time.Second),
+			"ListUsageReportsSlow": 0,
+		},
+	}
+	require.NoError(t, c.Validate())
+	require.Equal(t, time.Second, c.TimeoutOf("GetBalance"))
+	require.Equal(t, 5*time.Second, c.TimeoutOf("FindUsage"))
+	require.Equal(t, time.Duration(0), c.TimeoutOf("ListUsageReportsSlow"), "queries can opt out of the default")
+
+	require.Error(t, QueryTimeoutConfig{Default: util.Duration(-time.Second)}.Validate())
+	require.Error(t, QueryTimeoutConfig{Queries: map[string]util.Duration{"GetBalance": util.Duration(-time.Second)}}.Validate())
+}
+
+func TestConfigureQueryTimeouts(t *testing.T) {
+	conn, err := ConnectReplica(ConnectionParams{Host: "127.0.0.1:1", Database: "gitpod"})
+	require.NoError(t, err)
+	require.NoError(t, ConfigureQueryTimeouts(conn, QueryTimeoutConfig{
+		Queries: map[string]util.Duration{
+			"FindDraftUsageBefore": util.Duration(time.Minute),
+			"GetBalance":           util.Duration(time.Minute),
+		},
+	}))
+
+	var deadline time.Time
+	var hasDeadline bool
+	require.NoError(t, conn.Callback().Query().Before("gorm:query").After("usage:timeout_before_query").Register("test:deadline", func(tx *gorm.DB) {
+		deadline, hasDeadline = tx.Statement.Context.Deadline()
+	}))
+
+	dryRun := conn.Session(&gorm.Session{DryRun: true})
+	_, err = FindDraftUsageBefore(context.Background(), dryRun, time.Now())
+	require.NoError(t, err)
+	require.True(t, hasDeadline)
+	require.WithinDuration(t, time.Now().Add(time.Minute), deadline, 5*time.Second)
+
+	var usage []Usage
+	require.NoError(t, dryRun.WithContext(context.Background()).Find(&usage).Error)
+	require.False(t, hasDeadline, "statements of other queries must not be limited")
+
+	_, err = GetBalance(context.Background(), dryRun, NewTeamAttributionID("team-a"))
+	require.NoError(t, err)
+	require.True(t, hasDeadline, "balances must be read by statements which release their timeout")
+
+}
+
+func TestConfigureQueryTimeouts_Rows(t *testing.T) {
+	conn, err := ConnectReplica(ConnectionParams{Host: "127.0.0.1:1", Database: "gitpod"})
+	require.NoError(t, err)
+	require.NoError(t, ConfigureQueryTimeouts(conn, QueryTimeoutConfig{Default: util.Duration(time.Minute)}))
+
+	var hasDeadline bool
+	require.NoError(t, conn.Callback().Row().Before("gorm:row").Register("test:deadline", func(tx *gorm.DB) {
+		_, hasDeadline = tx.Statement.Context.Deadline()
+	}))
+	require.NoError(t, conn.Callback().Query().Before("gorm:query").Register("test:deadline", func(tx *gorm.DB) {
+		_, hasDeadline = tx.Statement.Context.Deadline()
+	}))
+
+	dryRun := conn.Session(&gorm.Session{DryRun: true})
+	var usage []Usage
+	require.NoError(t, dryRun.WithContext(context.Background()).Find(&usage).Error)
+	require.True(t, hasDeadline)
+
+	_, _ = dryRun.WithContext(context.Background()).Model(&Usage{}).Rows()
+	require.False(t, hasDeadline, "statements which return rows must not be limited, their timeout could not be released")
+}
@@ -8,6 +8,7 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math"
 	"time"
@@ -15,16 +16,35 @@ import (
 	"github.com/google/uuid"
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
-	"gorm.io/gorm/clause"
 )
 
+var UsageNotFound = errors.New("Usage not found")
+
+// UsageVersionConflict is returned when usage was updated concurrently. Callers can read the usage again, and retry.
+var UsageVersionConflict = errors.New("Usage was updated concurrently")
+
+// UsageAlreadyExists is returned by CreateUsage when a record conflicts with existing usage.
+var UsageAlreadyExists = errors.New("Usage already exists")
+
 type UsageKind string
 
 const (
 	WorkspaceInstanceUsageKind UsageKind = "workspaceinstance"
 	InvoiceUsageKind           UsageKind = "invoice"
+	// DisputeUsageKind entries annotate the ledger with a payment dispute, they do not credit or debit the balance.
+	DisputeUsageKind UsageKind = "dispute"
+	// CreditGrantUsageKind entries credit promotional credits, which are consumed by usage until they expire.
+	CreditGrantUsageKind UsageKind = "creditgrant"
+	// CreditGrantExpiryUsageKind entries debit the unused remainder of an expired credit grant.
+	CreditGrantExpiryUsageKind UsageKind = "creditgrantexpiry"
+	// AdjustmentUsageKind entries manually correct the balance, e.g. imported in bulk by support. Positive entries
+	// debit the balance like workspace usage, negative entries credit it.
+	AdjustmentUsageKind UsageKind = "adjustment"
 )
 
+// balanceUsageKinds are the kinds of usage which count towards the credits used in a billing period.
+var balanceUsageKinds = []UsageKind{WorkspaceInstanceUsageKind, AdjustmentUsageKind}
+
 func NewCreditCents(n float64) CreditCents {
 	inCents := n * 100
 	return CreditCents(int64(math.Round(inCents)))
@@ -44,16 +64,32 @@ type Usage struct {
 	EffectiveTime       VarcharTime    `gorm:"column:effectiveTime;type:varchar;size:255;" json:"effectiveTime"`
 	Kind                UsageKind      `gorm:"column:kind;type:char;size:10;" json:"kind"`
 	WorkspaceInstanceID uuid.UUID      `gorm:"column:workspaceInstanceId;type:char;size:36;" json:"workspaceInstanceId"`
+	ProjectID           string         `gorm:"column:projectId;type:varchar;size:255;" json:"projectId"`
 	Draft               bool           `gorm:"column:draft;type:boolean;" json:"draft"`
 	Metadata            datatypes.JSON `gorm:"column:metadata;type:text;size:65535" json:"metadata"`
+	// SoftDeletedTime is set when the usage was deleted on request of its owner. Soft-deleted usage is ignored by all
+	// queries, and purged after the retention period.
+	SoftDeletedTime VarcharTime `gorm:"column:softDeletedTime;type:varchar;size:255;" json:"softDeletedTime"`
+	// Version is incremented on every update. Updates fail with UsageVersionConflict when the version changed since the
+	// usage was read.
+	Version int64 `gorm:"column:version;type:int;" json:"version"`
 }
 
+// SetMetadataWithWorkspaceInstance sets the metadata of workspace instance usage. When metadata redaction is configured,
+// the fields which identify people are hashed, see SetMetadataRedaction.
 func (u *Usage) SetMetadataWithWorkspaceInstance(data WorkspaceInstanceUsageData) error {
 	b, err := json.Marshal(data)
 	if err != nil {
 		return fmt.Errorf("failed to serialize workspace instance usage data into json: %w", err)
 	}
 
+	if metadataRedactor != nil {
+		b, err = metadataRedactor.Redact(b)
+		if err != nil {
+			return fmt.Errorf("failed to redact workspace instance usage data: %w", err)
+		}
+	}
+
 	u.Metadata = b
 	return nil
 }
@@ -79,6 +115,62 @@ type WorkspaceInstanceUsageData struct {
 	EndTime        string        `json:"endTime"`
 	UserName       string        `json:"userName"`
 	UserAvatarURL  string        `json:"userAvatarURL"`
+
+	// PricingSegments documents how the runtime was split when the plan of the cost center changed while the
+	// instance was running. It is empty for instances priced at the default rates.
+	PricingSegments []PricingSegment `json:"pricingSegments,omitempty"`
+
+	// SplitFromAttributionId is set on usage which was charged to a split target of the cost center the workspace
+	// instance is attributed to.
+	SplitFromAttributionId AttributionID `json:"splitFromAttributionId,omitempty"`
+}
+
+// PricingSegment is a part of a workspace instance's runtime which was priced at the rates of a single plan.
+type PricingSegment struct {
+	Plan             string  `json:"plan"`
+	StartTime        string  `json:"startTime"`
+	EndTime          string  `json:"endTime"`
+	CreditsPerMinute float64 `json:"creditsPerMinute"`
+	Credits          float64 `json:"credits"`
+}
+
+func (u *Usage) SetMetadataWithInvoice(data InvoiceUsageData) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to serialize invoice usage data into json: %w", err)
+	}
+
+	u.Metadata = b
+	return nil
+}
+
+// InvoiceUsageData represents the shape of metadata for usage entries of kind "invoice"
+// the equivalent TypeScript definition is maintained in `components/gitpod-protocol/src/usage.ts“
+type InvoiceUsageData struct {
+	InvoiceID string `json:"invoiceId"`
+	StartDate string `json:"startDate"`
+	EndDate   string `json:"endDate"`
+}
+
+func (u *Usage) SetMetadataWithDispute(data DisputeUsageData) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to serialize dispute usage data into json: %w", err)
+	}
+
+	u.Metadata = b
+	return nil
+}
+
+// DisputeUsageData represents the shape of metadata for usage entries of kind "dispute"
+// the equivalent TypeScript definition is maintained in `components/gitpod-protocol/src/usage.ts“
+type DisputeUsageData struct {
+	DisputeID string `json:"disputeId"`
+	ChargeID  string `json:"chargeId"`
+	Reason    string `json:"reason"`
+	// Amount is the disputed amount in the smallest unit of Currency.
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
 }
 
 type FindUsageResult struct {
@@ -90,28 +182,181 @@ func (u *Usage) TableName() string {
 	return "d_b_usage"
 }
 
+// InsertUsage stores the usage records, skipping records whose IDs were already claimed, and invalidates the cached
+// balances and affected daily summaries of their attribution IDs in the same transaction.
 func InsertUsage(ctx context.Context, conn *gorm.DB, records ...Usage) error {
-	return conn.WithContext(ctx).
-		Clauses(clause.OnConflict{DoNothing: true}).
-		CreateInBatches(records, 1000).Error
+	return WithRetryableTx(ctx, conn, func(tx *gorm.DB) error {
+		inserts, err := claimUsageIDs(tx, records, false)
+		if err != nil {
+			return err
+		}
+		if len(inserts) == 0 {
+			return nil
+		}
+		err = tx.CreateInBatches(inserts, 1000).Error
+		if err != nil {
+			return err
+		}
+		if err := invalidateSummarizedDays(ctx, tx, inserts); err != nil {
+			return err
+		}
+		return InvalidateCachedBalances(ctx, tx, attributionIDsOf(inserts)...)
+	})
 }
 
-func UpdateUsage(ctx context.Context, conn *gorm.DB, records ...Usage) error {
-	for _, record := range records {
-		err := conn.WithContext(ctx).Save(record).Error
+// CreateUsage stores the usage records like InsertUsage, but stores none of them and returns UsageAlreadyExists when
+// any of them conflicts with existing usage. It is meant for entries which must not be lost silently, e.g. because
+// they are accompanied by a credit note.
+func CreateUsage(ctx context.Context, conn *gorm.DB, records ...Usage) error {
+	return WithRetryableTx(ctx, conn, func(tx *gorm.DB) error {
+		inserts, err := claimUsageIDs(tx, records, false)
 		if err != nil {
-			return fmt.Errorf("failed to update usage record ID: %s: %w", record.ID, err)
+			return err
+		}
+		if len(inserts) != len(records) {
+			return fmt.Errorf("claimed %d of %d usage IDs: %w", len(inserts), len(records), UsageAlreadyExists)
+		}
+		err = tx.CreateInBatches(inserts, 1000).Error
+		if err != nil {
+			return err
+		}
+		if err := invalidateSummarizedDays(ctx, tx, inserts); err != nil {
+			return err
 		}
+		return InvalidateCachedBalances(ctx, tx, attributionIDsOf(inserts)...)
+	})
+}
+
+// notSoftDeletedUsage excludes usage which was soft-deleted, and is pending purging.
+func notSoftDeletedUsage(db *gorm.DB) *gorm.DB {
+	return db.Where("softDeletedTime = ?", "")
+}
+
+func GetUsage(ctx context.Context, conn *gorm.DB, id uuid.UUID) (Usage, error) {
+	var usage Usage
+	result := conn.WithContext(ctx).Scopes(notSoftDeletedUsage).First(&usage, "id = ?", id.String())
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return Usage{}, UsageNotFound
+		}
+		return Usage{}, fmt.Errorf("failed to get usage: %w", result.Error)
 	}
+	return usage, nil
+}
 
-	return nil
+// invoiceUsageNamespace is used to derive the ID of the usage entry from the Stripe invoice ID, such that each
+// invoice is credited at most once.
+var invoiceUsageNamespace = uuid.MustParse("0f4e8a3c-6c8e-4b8c-9a52-3b1f0d6a2e71")
+
+// InvoiceUsageID returns the ID of the usage entry which credits the invoice.
+func InvoiceUsageID(invoiceID string) uuid.UUID {
+	return uuid.NewSHA1(invoiceUsageNamespace, []byte(invoiceID))
+}
+
+// workspaceInstanceUsageNamespace is used to derive the ID of the usage of a workspace instance from the instance and
+// the attribution ID it is charged to, such that concurrent writers record it at most once per attribution ID.
+var workspaceInstanceUsageNamespace = uuid.MustParse("5838ad94-23fe-4bce-8b39-2dce31393ee9")
+
+// WorkspaceInstanceUsageID returns the ID of the usage of the workspace instance which is charged to the attribution ID.
+func WorkspaceInstanceUsageID(instanceID uuid.UUID, attributionID AttributionID) uuid.UUID {
+	return uuid.NewSHA1(workspaceInstanceUsageNamespace, []byte(instanceID.String()+"/"+string(attributionID)))
+}
+
+// NewInvoiceUsage constructs the usage entry which credits the invoiced credits against the cost center of
+// `attributionID`, effective when the invoice was finalized.
+func NewInvoiceUsage(invoiceID string, attributionID AttributionID, credits int64, finalizedAt, periodStart, periodEnd time.Time) (Usage, error) {
+	usage := Usage{
+		ID:            InvoiceUsageID(invoiceID),
+		AttributionID: attributionID,
+		Description:   fmt.Sprintf("Invoice %s", invoiceID),
+		CreditCents:   NewCreditCents(float64(-credits)),
+		EffectiveTime: NewVarcharTime(finalizedAt),
+		Kind:          InvoiceUsageKind,
+	}
+	err := usage.SetMetadataWithInvoice(InvoiceUsageData{
+		InvoiceID: invoiceID,
+		StartDate: TimeToISO8601(periodStart),
+		EndDate:   TimeToISO8601(periodEnd),
+	})
+	if err != nil {
+		return Usage{}, err
+	}
+	return usage, nil
+}
+
+// VoidingUsageID returns the ID of the usage entry which reverses the usage with `usageID` when it is voided.
+func VoidingUsageID(usageID uuid.UUID) uuid.UUID {
+	return uuid.NewSHA1(usageID, []byte("void"))
+}
+
+// NewVoidingUsage constructs the usage entry which reverses `usage`. The entry has the same effective time as the
+// voided usage, such that it offsets the usage within the same billing period. Its ID is derived from the ID of the
+// voided usage, such that usage can be voided at most once.
+func NewVoidingUsage(usage Usage, reason string) Usage {
+	return Usage{
+		ID:                  VoidingUsageID(usage.ID),
+		AttributionID:       usage.AttributionID,
+		Description:         fmt.Sprintf("Voided usage %s: %s", usage.ID, reason),
+		CreditCents:         -usage.CreditCents,
+		EffectiveTime:       usage.EffectiveTime,
+		Kind:                usage.Kind,
+		WorkspaceInstanceID: usage.WorkspaceInstanceID,
+		ProjectID:           usage.ProjectID,
+		Draft:               false,
+		Metadata:            usage.Metadata,
+	}
+}
+
+// TransferReversalID returns the ID of the usage entry which reverses the usage with `usageID` when it is transferred
+// to another attribution ID.
+func TransferReversalID(usageID uuid.UUID) uuid.UUID {
+	return uuid.NewSHA1(usageID, []byte("transfer"))
+}
+
+// NewTransferringUsage constructs the usage entries which move `usage` to the attribution ID `to`, without changing
+// `usage` itself: the reversal offsets the usage for its attribution ID, the transfer charges it to `to`. Both have
+// the same effective time as the transferred usage. Their IDs are derived from the ID of the transferred usage, such
+// that usage can be transferred at most once.
+func NewTransferringUsage(usage Usage, to AttributionID, reason string) (reversal Usage, transfer Usage) {
+	reversal = Usage{
+		ID:                  TransferReversalID(usage.ID),
+		AttributionID:       usage.AttributionID,
+		Description:         fmt.Sprintf("Transferred usage %s to %s: %s", usage.ID, to, reason),
+		CreditCents:         -usage.CreditCents,
+		EffectiveTime:       usage.EffectiveTime,
+		Kind:                usage.Kind,
+		WorkspaceInstanceID: usage.WorkspaceInstanceID,
+		ProjectID:           usage.ProjectID,
+		Draft:               false,
+		Metadata:            usage.Metadata,
+	}
+	transfer = reversal
+	transfer.ID = uuid.NewSHA1(usage.ID, []byte("transfer-to"))
+	transfer.AttributionID = to
+	transfer.Description = fmt.Sprintf("Transferred usage %s from %s: %s", usage.ID, usage.AttributionID, reason)
+	transfer.CreditCents = usage.CreditCents
+	return reversal, transfer
+}
+
+// UpdateUsage updates the usage records in batches, inserting records which do not exist. See UpsertUsage.
+func UpdateUsage(ctx context.Context, conn *gorm.DB, records ...Usage) error {
+	return UpsertUsage(ctx, conn, records...)
+}
+
+func attributionIDsOf(records []Usage) []AttributionID {
+	attributionIds := make([]AttributionID, 0, len(records))
+	for _, record := range records {
+		attributionIds = append(attributionIds, record.AttributionID)
+	}
+	return attributionIds
 }
 
 func FindAllDraftUsage(ctx context.Context, conn *gorm.DB) ([]Usage, error) {
 	var usageRecords []Usage
 	var usageRecordsBatch []Usage
 
-	result := conn.WithContext(ctx).
+	result := prepared(conn).WithContext(ctx).
+		Scopes(notSoftDeletedUsage).
 		Where("draft = TRUE").
 		Order("effectiveTime DESC").
 		FindInBatches(&usageRecordsBatch, 1000, func(_ *gorm.DB, _ int) error {
@@ -124,38 +369,71 @@ func FindAllDraftUsage(ctx context.Context, conn *gorm.DB) ([]Usage, error) {
 	return usageRecords, nil
 }
 
+// FindWorkspaceInstanceUsage returns the workspace usage of the workspace instances, including drafts and soft-deleted
+// usage.
+func FindWorkspaceInstanceUsage(ctx context.Context, conn *gorm.DB, workspaceInstanceIds []uuid.UUID) ([]Usage, error) {
+	var usageRecords []Usage
+	// explicit batching to reduce the lengths of the 'in'-part in the SELECT statement below
+	chunkSize := 1000
+	for i := 0; i < len(workspaceInstanceIds); i += chunkSize {
+		end := i + chunkSize
+		if end > len(workspaceInstanceIds) {
+			end = len(workspaceInstanceIds)
+		}
+
+		var usageRecordsBatch []Usage
+		result := conn.WithContext(ctx).
+			Where("kind = ?", WorkspaceInstanceUsageKind).
+			Where("workspaceInstanceId IN ?", workspaceInstanceIds[i:end]).
+			Find(&usageRecordsBatch)
+		if result.Error != nil {
+			return nil, fmt.Errorf("failed to get usage records of workspace instances: %w", result.Error)
+		}
+		usageRecords = append(usageRecords, usageRecordsBatch...)
+	}
+	return usageRecords, nil
+}
+
+// FindDraftUsageBefore returns the draft usage with an effective time before `t`.
+func FindDraftUsageBefore(ctx context.Context, conn *gorm.DB, t time.Time) ([]Usage, error) {
+	var usageRecords []Usage
+	result := prepared(conn).WithContext(ctx).
+		Scopes(notSoftDeletedUsage).
+		Where("draft = TRUE").
+		Where("effectiveTime < ?", TimeToISO8601(t)).
+		Order("effectiveTime ASC").
+		Find(&usageRecords)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get draft usage records before %s: %w", t, result.Error)
+	}
+	return usageRecords, nil
+}
+
 type FindUsageParams struct {
 	AttributionId AttributionID
 	From, To      time.Time
 	ExcludeDrafts bool
 	Order         Order
+	// After is the key of the last usage of the previous page. The offset is applied after the key.
+	After         *PageKey
 	Offset, Limit int64
 }
 
+// UsagePageKey is the key of usage in lists ordered by effective time, see FindUsageParams.After.
+func UsagePageKey(usage Usage) PageKey {
+	return PageKey{Value: usage.EffectiveTime.String(), ID: usage.ID.String()}
+}
+
+// FindUsage returns the usage of the attribution ID in [From, To), including archived usage. See ForEachUsage to
+// iterate over the usage of large attribution IDs instead.
 func FindUsage(ctx context.Context, conn *gorm.DB, params *FindUsageParams) ([]Usage, error) {
 	var usageRecords []Usage
-	var usageRecordsBatch []Usage
-
-	db := conn.WithContext(ctx).
-		Where("attributionId = ?", params.AttributionId).
-		Where("effectiveTime >= ? AND effectiveTime < ?", TimeToISO8601(params.From), TimeToISO8601(params.To))
-	if params.ExcludeDrafts {
-		db = db.Where("draft = ?", false)
-	}
-	db = db.Order(fmt.Sprintf("effectiveTime %s", params.Order.ToSQL()))
-	if params.Offset != 0 {
-		db = db.Offset(int(params.Offset))
-	}
-	if params.Limit != 0 {
-		db = db.Limit(int(params.Limit))
-	}
-
-	result := db.FindInBatches(&usageRecordsBatch, 1000, func(_ *gorm.DB, _ int) error {
-		usageRecords = append(usageRecords, usageRecordsBatch...)
+	err := ForEachUsage(ctx, conn, params, func(usage Usage) error {
+		usageRecords = append(usageRecords, usage)
 		return nil
 	})
-	if result.Error != nil {
-		return nil, fmt.Errorf("failed to get usage records: %s", result.Error)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get usage records: %w", err)
 	}
 	return usageRecords, nil
 }
@@ -166,37 +444,144 @@ type UsageSummary struct {
 	CreditCentsBalanceAtEnd   int64
 }
 
+// GetUsageSummary summarizes the usage of the attribution ID until `to`, including archived usage. Balances are read from
+// the daily usage summaries where they are valid.
 func GetUsageSummary(ctx context.Context, conn *gorm.DB, attributionId AttributionID, from, to time.Time, excludeDrafts bool) (*UsageSummary, error) {
-	db := conn.WithContext(ctx)
-	query1 := db.Table((&Usage{}).TableName()).
-		Select("sum(creditCents) as creditCentsBalanceAtStart").
-		Where("attributionId = ?", attributionId).
-		Where("effectiveTime < ?", TimeToISO8601(from))
-	if excludeDrafts {
-		query1 = query1.Where("draft = ?", false)
+	summary := &UsageSummary{}
+	for _, table := range []string{(&Usage{}).TableName(), UsageArchiveTableName} {
+		query := conn.WithContext(ctx).
+			Table(table).
+			Scopes(notSoftDeletedUsage).
+			Where("attributionId = ?", attributionId).
+			Where("? <= effectiveTime AND effectiveTime < ?", TimeToISO8601(from), TimeToISO8601(to))
+		if excludeDrafts {
+			query = query.Where("draft = ?", false)
+		}
+
+		var numRecordsInRange int64
+		err := query.Count(&numRecordsInRange).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to get usage meta data: %s", err)
+		}
+		summary.NumRecordsInRange += int(numRecordsInRange)
+	}
+
+	balanceAtStart, err := usageBalanceBefore(ctx, conn, attributionId, from, excludeDrafts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get balance at start: %w", err)
 	}
-	var creditCentsBalanceAtStart sql.NullInt64
-	err := query1.Row().Scan(&creditCentsBalanceAtStart)
+	balanceAtEnd, err := usageBalanceBefore(ctx, conn, attributionId, to, excludeDrafts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get usage meta data: %s", err)
+		return nil, fmt.Errorf("failed to get balance at end: %w", err)
 	}
+	summary.CreditCentsBalanceAtStart = int64(balanceAtStart)
+	summary.CreditCentsBalanceAtEnd = int64(balanceAtEnd)
+	return summary, nil
+}
 
-	query2 := db.Table((&Usage{}).TableName()).
-		Select("sum(creditCents) as creditCentsBalanceInPeriod", "count(id) as numRecordsInRange").
-		Where("attributionId = ?", attributionId).
+// GetBalance returns the credit balance of the attribution ID over its entire ledger including archived usage: the usage
+// of its workspaces, including instances which are still running, minus the credits it was invoiced for.
+func GetBalance(ctx context.Context, conn *gorm.DB, attributionId AttributionID) (CreditCents, error) {
+	balance, err := usageBalanceBefore(ctx, conn, attributionId, time.Time{}, false)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get balance of %s: %w", attributionId, err)
+	}
+	return balance, nil
+}
+
+// GetFinalizedWorkspaceUsageByAttribution sums the credit cents of all non-draft workspace instance usage and
+// adjustments in the period [from, to), grouped by attribution ID.
+func GetFinalizedWorkspaceUsageByAttribution(ctx context.Context, conn *gorm.DB, from, to time.Time) (map[AttributionID]CreditCents, error) {
+	return sumWorkspaceUsageByAttribution(ctx, conn, from, to, true)
+}
+
+// GetWorkspaceUsageByAttribution sums the credit cents of the workspace instance usage and adjustments in the period
+// [from, to), grouped by attribution ID, including usage of instances which are still running.
+func GetWorkspaceUsageByAttribution(ctx context.Context, conn *gorm.DB, from, to time.Time) (map[AttributionID]CreditCents, error) {
+	return sumWorkspaceUsageByAttribution(ctx, conn, from, to, false)
+}
+
+func sumWorkspaceUsageByAttribution(ctx context.Context, conn *gorm.DB, from, to time.Time, excludeDrafts bool) (map[AttributionID]CreditCents, error) {
+	query := conn.WithContext(ctx).
+		Table((&Usage{}).TableName()).
+		Scopes(notSoftDeletedUsage).
+		Select("attributionId", "sum(creditCents) as creditCents").
+		Where("kind IN ?", balanceUsageKinds).
 		Where("? <= effectiveTime AND effectiveTime < ?", TimeToISO8601(from), TimeToISO8601(to))
 	if excludeDrafts {
-		query2 = query2.Where("draft = ?", false)
+		query = query.Where("draft = ?", false)
+	}
+	rows, err := query.Group("attributionId").Rows()
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum workspace usage: %w", err)
 	}
-	var creditCentsBalanceInPeriod sql.NullInt64
-	var numRecordsInRange sql.NullInt32
-	err = query2.Row().Scan(&creditCentsBalanceInPeriod, &numRecordsInRange)
+	defer rows.Close()
+
+	result := map[AttributionID]CreditCents{}
+	for rows.Next() {
+		var attributionID AttributionID
+		var creditCents int64
+		if err := rows.Scan(&attributionID, &creditCents); err != nil {
+			return nil, fmt.Errorf("failed to scan workspace usage: %w", err)
+		}
+		result[attributionID] = CreditCents(creditCents)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read workspace usage: %w", err)
+	}
+
+	return result, nil
+}
+
+// GetWorkspaceUsageByProject sums the credit cents of the workspace instance usage of the attribution ID in the
+// period [from, to) by project, including usage of instances which are still running. Usage of workspaces without a
+// project is summed under the empty project ID.
+func GetWorkspaceUsageByProject(ctx context.Context, conn *gorm.DB, attributionId AttributionID, from, to time.Time) (map[string]CreditCents, error) {
+	rows, err := conn.WithContext(ctx).
+		Table((&Usage{}).TableName()).
+		Scopes(notSoftDeletedUsage).
+		Select("projectId", "sum(creditCents) as creditCents").
+		Where("attributionId = ?", attributionId).
+		Where("kind = ?", WorkspaceInstanceUsageKind).
+		Where("? <= effectiveTime AND effectiveTime < ?", TimeToISO8601(from), TimeToISO8601(to)).
+		Group("projectId").
+		Rows()
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum workspace usage by project: %w", err)
+	}
+	defer rows.Close()
+
+	result := map[string]CreditCents{}
+	for rows.Next() {
+		var projectID string
+		var creditCents int64
+		if err := rows.Scan(&projectID, &creditCents); err != nil {
+			return nil, fmt.Errorf("failed to scan workspace usage by project: %w", err)
+		}
+		result[projectID] = CreditCents(creditCents)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read workspace usage by project: %w", err)
+	}
+
+	return result, nil
+}
+
+// GetWorkspaceUsageForAttribution sums the credit cents of the workspace instance usage and adjustments of the
+// attribution ID in the period [from, to), including usage of instances which are still running.
+func GetWorkspaceUsageForAttribution(ctx context.Context, conn *gorm.DB, attributionId AttributionID, from, to time.Time) (CreditCents, error) {
+	var creditCents sql.NullInt64
+	err := conn.WithContext(ctx).
+		Table((&Usage{}).TableName()).
+		Scopes(notSoftDeletedUsage).
+		Select("sum(creditCents)").
+		Where("attributionId = ?", attributionId).
+		Where("kind IN ?", balanceUsageKinds).
+		Where("? <= effectiveTime AND effectiveTime < ?", TimeToISO8601(from), TimeToISO8601(to)).
+		Row().
+		Scan(&creditCents)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get usage meta data: %s", err)
+		return 0, fmt.Errorf("failed to sum workspace usage: %w", err)
 	}
-	return &UsageSummary{
-		NumRecordsInRange:         int(numRecordsInRange.Int32),
-		CreditCentsBalanceAtStart: creditCentsBalanceAtStart.Int64,
-		CreditCentsBalanceAtEnd:   creditCentsBalanceAtStart.Int64 + creditCentsBalanceInPeriod.Int64,
-	}, nil
+	return CreditCents(creditCents.Int64), nil
 }
@@ -0,0 +1,71 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AdjustmentUsageData represents the shape of metadata for usage entries of kind "adjustment"
+// the equivalent TypeScript definition is maintained in `components/gitpod-protocol/src/usage.ts“
+type AdjustmentUsageData struct {
+	Actor  string `json:"actor"`
+	Reason string `json:"reason"`
+	// ImportID identifies the import which created the adjustment, all adjustments of one import share it.
+	ImportID string `json:"importId"`
+	// Line is the line of the adjustment in the imported file.
+	Line int `json:"line"`
+}
+
+func (u *Usage) SetMetadataWithAdjustment(data AdjustmentUsageData) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to serialize adjustment usage data into json: %w", err)
+	}
+
+	u.Metadata = b
+	return nil
+}
+
+func (u *Usage) GetMetadataAsAdjustmentData() (AdjustmentUsageData, error) {
+	var data AdjustmentUsageData
+	err := json.Unmarshal(u.Metadata, &data)
+	if err != nil {
+		return AdjustmentUsageData{}, fmt.Errorf("failed unmarshal metadata into adjustment data: %w", err)
+	}
+
+	return data, nil
+}
+
+// adjustmentNamespace is used to derive the ID of adjustments from the import and the line, such that importing the
+// same file again does not adjust the balance twice.
+var adjustmentNamespace = uuid.MustParse("3e8b5d21-7c4f-4a96-b0e2-9f1a6c8d5b47")
+
+// AdjustmentUsageID returns the ID of the adjustment on `line` of the import `importID`.
+func AdjustmentUsageID(importID string, line int) uuid.UUID {
+	return uuid.NewSHA1(adjustmentNamespace, []byte(fmt.Sprintf("%s/%d", importID, line)))
+}
+
+// NewAdjustmentUsage constructs the usage entry which adjusts the balance of `attributionID` by `credits` at
+// `effectiveTime`. Positive credits debit the balance, negative credits credit it.
+func NewAdjustmentUsage(attributionID AttributionID, credits float64, description string, effectiveTime time.Time, data AdjustmentUsageData) (Usage, error) {
+	usage := Usage{
+		ID:            AdjustmentUsageID(data.ImportID, data.Line),
+		AttributionID: attributionID,
+		Description:   description,
+		CreditCents:   NewCreditCents(credits),
+		EffectiveTime: NewVarcharTime(effectiveTime),
+		Kind:          AdjustmentUsageKind,
+	}
+	err := usage.SetMetadataWithAdjustment(data)
+	if err != nil {
+		return Usage{}, err
+	}
+	return usage, nil
+}
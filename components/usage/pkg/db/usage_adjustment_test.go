@@ -0,0 +1,32 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewAdjustmentUsage(t *testing.T) {
+	attributionID := db.NewTeamAttributionID(uuid.New().String())
+	effectiveTime := time.Date(2022, 10, 4, 0, 0, 0, 0, time.UTC)
+	data := db.AdjustmentUsageData{Actor: "support-a", Reason: "Corrections", ImportID: "import-a", Line: 2}
+
+	usage, err := db.NewAdjustmentUsage(attributionID, -12.5, "Outage refund", effectiveTime, data)
+	require.NoError(t, err)
+	require.Equal(t, db.AdjustmentUsageKind, usage.Kind)
+	require.Equal(t, db.NewCreditCents(-12.5), usage.CreditCents)
+	require.Equal(t, effectiveTime, usage.EffectiveTime.Time())
+	require.Equal(t, db.AdjustmentUsageID("import-a", 2), usage.ID, "must adjust at most once per line of an import")
+	require.NotEqual(t, db.AdjustmentUsageID("import-a", 3), usage.ID)
+
+	read, err := usage.GetMetadataAsAdjustmentData()
+	require.NoError(t, err)
+	require.Equal(t, data, read)
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// UsageArchiveTableName holds usage entries which were moved out of d_b_usage by ArchiveUsage. It has the same
+	// columns as d_b_usage.
+	UsageArchiveTableName = "d_b_usage_archive"
+	// WorkspaceInstanceUsageArchiveTableName holds workspace instance usage which was moved out of
+	// d_b_workspace_instance_usage by ArchiveUsage. It has the same columns as d_b_workspace_instance_usage.
+	WorkspaceInstanceUsageArchiveTableName = "d_b_workspace_instance_usage_archive"
+
+	archiveBatchSize = 1000
+)
+
+// ArchivedUsage is the number of entries which were archived.
+type ArchivedUsage struct {
+	Usage                  int64
+	WorkspaceInstanceUsage int64
+}
+
+// ArchiveUsage moves finalized usage effective before `before`, and workspace instance usage which stopped before
+// `before`, into the archive tables. Archived usage is still included in FindUsage, GetUsageSummary, GetBalance and
+// ListUsage, but not in the aggregations of billing periods, so `before` must be before any period which is still
+// billed. Credit grants and their expiries are never archived, because expiring credit grants depends on them.
+func ArchiveUsage(ctx context.Context, conn *gorm.DB, before time.Time) (ArchivedUsage, error) {
+	var archived ArchivedUsage
+
+	for {
+		var ids []string
+		err := conn.WithContext(ctx).
+			Model(&Usage{}).
+			Where("effectiveTime < ?", TimeToISO8601(before)).
+			Where("draft = ?", false).
+			Where("kind NOT IN ?", []UsageKind{CreditGrantUsageKind, CreditGrantExpiryUsageKind}).
+			Limit(archiveBatchSize).
+			Pluck("id", &ids).Error
+		if err != nil {
+			return archived, fmt.Errorf("failed to find usage to archive: %w", err)
+		}
+		if len(ids) == 0 {
+			break
+		}
+
+		err = conn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			return moveToArchive(tx, (&Usage{}).TableName(), UsageArchiveTableName, "id", ids)
+		})
+		if err != nil {
+			return archived, fmt.Errorf("failed to archive usage: %w", err)
+		}
+		archived.Usage += int64(len(ids))
+	}
+
+	for {
+		var ids []string
+		err := conn.WithContext(ctx).
+			Model(&WorkspaceInstanceUsage{}).
+			Where("stoppedAt < ?", before).
+			Limit(archiveBatchSize).
+			Pluck("instanceId", &ids).Error
+		if err != nil {
+			return archived, fmt.Errorf("failed to find workspace instance usage to archive: %w", err)
+		}
+		if len(ids) == 0 {
+			break
+		}
+
+		err = conn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			return moveToArchive(tx, (&WorkspaceInstanceUsage{}).TableName(), WorkspaceInstanceUsageArchiveTableName, "instanceId", ids)
+		})
+		if err != nil {
+			return archived, fmt.Errorf("failed to archive workspace instance usage: %w", err)
+		}
+		archived.WorkspaceInstanceUsage += int64(len(ids))
+	}
+
+	return archived, nil
+}
+
+// moveToArchive copies the rows with the given keys into the archive table, and deletes them from the table. Rows which
+// were archived already are skipped, such that an interrupted run can be repeated.
+func moveToArchive(tx *gorm.DB, table, archiveTable, key string, ids []string) error {
+	err := tx.Exec(fmt.Sprintf("INSERT IGNORE INTO `%s` SELECT * FROM `%s` WHERE `%s` IN ?", archiveTable, table, key), ids).Error
+	if err != nil {
+		return fmt.Errorf("failed to copy %d rows of %s into the archive: %w", len(ids), table, err)
+	}
+	err = tx.Exec(fmt.Sprintf("DELETE FROM `%s` WHERE `%s` IN ?", table, key), ids).Error
+	if err != nil {
+		return fmt.Errorf("failed to delete %d archived rows of %s: %w", len(ids), table, err)
+	}
+	return nil
+}
+
+// mergeWorkspaceInstanceUsagePage merges workspace instance usage from d_b_workspace_instance_usage and the archive,
+// which are each ordered by start time, and returns the page at `offset`.
+func mergeWorkspaceInstanceUsagePage(live, archived []WorkspaceInstanceUsage, order Order, offset, limit int64) []WorkspaceInstanceUsage {
+	merged := append(append([]WorkspaceInstanceUsage{}, live...), archived...)
+	sort.SliceStable(merged, func(i, j int) bool {
+		a, b := merged[i].StartedAt, merged[j].StartedAt
+		if a.Equal(b) {
+			return (merged[i].InstanceID.String() < merged[j].InstanceID.String()) == (order == AscendingOrder)
+		}
+		return a.Before(b) == (order == AscendingOrder)
+	})
+	start, end := pageBounds(int64(len(merged)), offset, limit)
+	return merged[start:end]
+}
+
+func pageBounds(n, offset, limit int64) (int64, int64) {
+	start := offset
+	if start > n {
+		start = n
+	}
+	end := n
+	if limit != 0 && start+limit < n {
+		end = start + limit
+	}
+	return start, end
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/db/dbtest"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchiveUsage(t *testing.T) {
+	conn := dbtest.ConnectForTests(t)
+	ctx := context.Background()
+	// Usage this old is never created by other tests, which are not affected by archiving.
+	cutoff := time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+	old := cutoff.AddDate(0, -1, 0)
+	attributionID := db.NewTeamAttributionID(uuid.New().String())
+
+	usage := dbtest.CreateUsageRecords(t, conn,
+		dbtest.NewUsage(t, db.Usage{AttributionID: attributionID, CreditCents: 100, EffectiveTime: db.NewVarcharTime(old)}),
+		dbtest.NewUsage(t, db.Usage{AttributionID: attributionID, CreditCents: 200, EffectiveTime: db.NewVarcharTime(old.Add(time.Hour))}),
+		dbtest.NewUsage(t, db.Usage{AttributionID: attributionID, CreditCents: 400, EffectiveTime: db.NewVarcharTime(old.Add(2 * time.Hour)), Draft: true}),
+		dbtest.NewUsage(t, db.Usage{AttributionID: attributionID, CreditCents: -800, EffectiveTime: db.NewVarcharTime(old.Add(-time.Hour)), Kind: db.CreditGrantUsageKind}),
+		dbtest.NewUsage(t, db.Usage{AttributionID: attributionID, CreditCents: 1600, EffectiveTime: db.NewVarcharTime(cutoff)}),
+	)
+	instanceUsage := dbtest.CreateWorkspaceInstanceUsageRecords(t, conn,
+		dbtest.NewWorkspaceInstanceUsage(t, db.WorkspaceInstanceUsage{
+			AttributionID: attributionID,
+			StartedAt:     old,
+			StoppedAt:     sql.NullTime{Time: old.Add(time.Hour), Valid: true},
+		}),
+		dbtest.NewWorkspaceInstanceUsage(t, db.WorkspaceInstanceUsage{
+			AttributionID: attributionID,
+			StartedAt:     cutoff,
+			StoppedAt:     sql.NullTime{Time: cutoff.Add(time.Hour), Valid: true},
+		}),
+	)
+	t.Cleanup(func() {
+		require.NoError(t, conn.Table(db.UsageArchiveTableName).Where("attributionId = ?", attributionID).Delete(&db.Usage{}).Error)
+		require.NoError(t, conn.Table(db.WorkspaceInstanceUsageArchiveTableName).Where("attributionId = ?", attributionID).Delete(&db.WorkspaceInstanceUsage{}).Error)
+	})
+
+	balanceBefore, err := db.GetBalance(ctx, conn, attributionID)
+	require.NoError(t, err)
+
+	archived, err := db.ArchiveUsage(ctx, conn, cutoff)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, archived.Usage, "drafts, credit grants and recent usage must not be archived")
+	require.EqualValues(t, 1, archived.WorkspaceInstanceUsage)
+
+	_, err = db.GetUsage(ctx, conn, usage[0].ID)
+	require.ErrorIs(t, err, db.UsageNotFound, "archived usage must be moved")
+
+	balanceAfter, err := db.GetBalance(ctx, conn, attributionID)
+	require.NoError(t, err)
+	require.Equal(t, balanceBefore, balanceAfter, "archived usage must still count towards the balance")
+
+	found, err := db.FindUsage(ctx, conn, &db.FindUsageParams{
+		AttributionId: attributionID,
+		From:          old.Add(-time.Hour),
+		To:            cutoff.Add(time.Hour),
+		Order:         db.AscendingOrder,
+		Offset:        1,
+		Limit:         3,
+	})
+	require.NoError(t, err)
+	require.Len(t, found, 3)
+	require.Equal(t, usage[0].ID, found[0].ID, "archived and live usage must be ordered together")
+	require.Equal(t, usage[1].ID, found[1].ID)
+	require.Equal(t, usage[2].ID, found[2].ID)
+
+	summary, err := db.GetUsageSummary(ctx, conn, attributionID, old.Add(time.Hour), cutoff.Add(time.Hour), false)
+	require.NoError(t, err)
+	require.Equal(t, 3, summary.NumRecordsInRange)
+	require.EqualValues(t, -700, summary.CreditCentsBalanceAtStart)
+	require.EqualValues(t, 1500, summary.CreditCentsBalanceAtEnd)
+
+	listed, err := db.ListUsage(ctx, conn, attributionID, old, cutoff.Add(2*time.Hour), db.DescendingOrder, 0, 10)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, listed.Count)
+	require.Len(t, listed.UsageRecords, 2)
+	require.Equal(t, instanceUsage[1].InstanceID, listed.UsageRecords[0].InstanceID)
+	require.Equal(t, instanceUsage[0].InstanceID, listed.UsageRecords[1].InstanceID, "archived workspace instance usage must be listed")
+}
@@ -0,0 +1,215 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// usageDayFormat is the format of the days of usage daily summaries. Effective times of usage start with their day in
+// this format, such that they can be compared with days as strings.
+const usageDayFormat = "2006-01-02"
+
+// UsageDailySummary sums the finalized usage of an attribution ID per day, and workspace class. Usage which is not
+// workspace instance usage is summed under the empty workspace class.
+type UsageDailySummary struct {
+	AttributionID  AttributionID `gorm:"primary_key;column:attributionId;type:varchar;size:255;" json:"attributionId"`
+	Day            string        `gorm:"primary_key;column:day;type:varchar;size:10;" json:"day"`
+	WorkspaceClass string        `gorm:"primary_key;column:workspaceClass;type:varchar;size:255;" json:"workspaceClass"`
+	CreditCents    CreditCents   `gorm:"column:creditCents;type:bigint;" json:"creditCents"`
+	Entries        int64         `gorm:"column:entries;type:int;" json:"entries"`
+}
+
+// TableName sets the insert table name for this struct type
+func (s *UsageDailySummary) TableName() string {
+	return "d_b_usage_daily_summary"
+}
+
+// UsageDailySummaryState records up to which day the daily summaries of an attribution ID are complete. Summaries are
+// only used while the state exists: writing finalized usage before SummarizedUntil deletes it.
+type UsageDailySummaryState struct {
+	AttributionID AttributionID `gorm:"primary_key;column:attributionId;type:varchar;size:255;" json:"attributionId"`
+	// SummarizedUntil is the first day which is not summarized.
+	SummarizedUntil string `gorm:"column:summarizedUntil;type:varchar;size:10;" json:"summarizedUntil"`
+}
+
+// TableName sets the insert table name for this struct type
+func (s *UsageDailySummaryState) TableName() string {
+	return "d_b_usage_daily_summary_state"
+}
+
+// UsageDay returns the day of `t` in the format of usage daily summaries.
+func UsageDay(t time.Time) string {
+	return t.UTC().Format(usageDayFormat)
+}
+
+// RefreshUsageDailySummaries summarizes the finalized usage of the attribution ID, including archived usage, up to the
+// start of the day of `until`. Only days after the previous refresh are added, unless the summaries were invalidated
+// since.
+func RefreshUsageDailySummaries(ctx context.Context, conn *gorm.DB, attributionId AttributionID, until time.Time) error {
+	untilDay := UsageDay(until)
+
+	return WithRetryableTx(ctx, conn, func(tx *gorm.DB) error {
+		// Locking the state first makes concurrent invalidations wait for the refresh, and then invalidate it.
+		var state UsageDailySummaryState
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("attributionId = ?", attributionId).
+			First(&state).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			state = UsageDailySummaryState{AttributionID: attributionId}
+			err = tx.Create(&state).Error
+		}
+		if err != nil {
+			return fmt.Errorf("failed to lock usage summary state of %s: %w", attributionId, err)
+		}
+
+		fromDay := state.SummarizedUntil
+		if fromDay >= untilDay {
+			return nil
+		}
+		if fromDay == "" {
+			err = tx.Where("attributionId = ?", attributionId).Delete(&UsageDailySummary{}).Error
+			if err != nil {
+				return fmt.Errorf("failed to delete usage summaries of %s: %w", attributionId, err)
+			}
+		}
+
+		for _, table := range []string{(&Usage{}).TableName(), UsageArchiveTableName} {
+			err = tx.Exec(fmt.Sprintf(
+				"INSERT INTO `%s` (attributionId, day, workspaceClass, creditCents, entries) "+
+					"SELECT attributionId, LEFT(effectiveTime, 10), "+
+					"CASE WHEN kind = ? AND JSON_VALID(metadata) THEN IFNULL(JSON_UNQUOTE(JSON_EXTRACT(metadata, '$.workspaceClass')), '') ELSE '' END AS class, "+
+					"SUM(creditCents), COUNT(*) FROM `%s` "+
+					"WHERE attributionId = ? AND draft = 0 AND softDeletedTime = '' AND effectiveTime >= ? AND effectiveTime < ? "+
+					"GROUP BY attributionId, LEFT(effectiveTime, 10), class "+
+					"ON DUPLICATE KEY UPDATE creditCents = creditCents + VALUES(creditCents), entries = entries + VALUES(entries)",
+				(&UsageDailySummary{}).TableName(), table),
+				WorkspaceInstanceUsageKind, attributionId, fromDay, untilDay,
+			).Error
+			if err != nil {
+				return fmt.Errorf("failed to summarize usage of %s in %s: %w", attributionId, table, err)
+			}
+		}
+
+		err = tx.Model(&state).Update("summarizedUntil", untilDay).Error
+		if err != nil {
+			return fmt.Errorf("failed to update usage summary state of %s: %w", attributionId, err)
+		}
+		return nil
+	})
+}
+
+// InvalidateUsageDailySummaries stops using the daily summaries of the attribution IDs, until they are refreshed.
+func InvalidateUsageDailySummaries(ctx context.Context, conn *gorm.DB, attributionIds ...AttributionID) error {
+	if len(attributionIds) == 0 {
+		return nil
+	}
+	err := conn.WithContext(ctx).Where("attributionId IN ?", attributionIds).Delete(&UsageDailySummaryState{}).Error
+	if err != nil {
+		return fmt.Errorf("failed to invalidate usage summaries: %w", err)
+	}
+	return nil
+}
+
+// invalidateSummarizedDays invalidates the daily summaries of the attribution IDs of finalized usage records which are
+// effective on a day which was already summarized. Drafts are never summarized.
+func invalidateSummarizedDays(ctx context.Context, conn *gorm.DB, records []Usage) error {
+	earliest := map[AttributionID]string{}
+	for _, record := range records {
+		if record.Draft {
+			continue
+		}
+		day := UsageDay(record.EffectiveTime.Time())
+		if current, ok := earliest[record.AttributionID]; !ok || day < current {
+			earliest[record.AttributionID] = day
+		}
+	}
+
+	for attributionId, day := range earliest {
+		err := conn.WithContext(ctx).
+			Where("attributionId = ? AND summarizedUntil > ?", attributionId, day).
+			Delete(&UsageDailySummaryState{}).Error
+		if err != nil {
+			return fmt.Errorf("failed to invalidate usage summaries of %s: %w", attributionId, err)
+		}
+	}
+	return nil
+}
+
+// summarizedCreditCents returns the sum of the daily summaries of the attribution ID before the day of `before`, and
+// the first day which is not included. Usage before that day is included, unless it is a draft. When there are no
+// valid summaries, the day is empty. A zero `before` includes all summarized days.
+func summarizedCreditCents(ctx context.Context, conn *gorm.DB, attributionId AttributionID, before time.Time) (CreditCents, string, error) {
+	// The state and the summaries are read in a single statement, such that a concurrent refresh is not observed halfway.
+	beforeDay := "9999-12-31"
+	if !before.IsZero() {
+		beforeDay = UsageDay(before)
+	}
+	var summary struct {
+		SummarizedUntil sql.NullString `gorm:"column:summarizedUntil"`
+		CreditCents     sql.NullInt64  `gorm:"column:creditCents"`
+	}
+	// Read with Find, because Row() of prepared sessions panics instead of returning preparation errors, and statements
+	// which return rows are not limited by query timeouts.
+	result := prepared(conn).WithContext(ctx).Raw(fmt.Sprintf(
+		"SELECT LEAST(s.summarizedUntil, ?) AS summarizedUntil, SUM(d.creditCents) AS creditCents FROM `%s` s "+
+			"LEFT JOIN `%s` d ON d.attributionId = s.attributionId AND d.day < LEAST(s.summarizedUntil, ?) "+
+			"WHERE s.attributionId = ? AND s.summarizedUntil != '' "+
+			"GROUP BY s.summarizedUntil",
+		(&UsageDailySummaryState{}).TableName(), (&UsageDailySummary{}).TableName()),
+		beforeDay, beforeDay, attributionId,
+	).Find(&summary)
+	if result.Error != nil {
+		return 0, "", fmt.Errorf("failed to get usage summaries of %s: %w", attributionId, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return 0, "", nil
+	}
+	return CreditCents(summary.CreditCents.Int64), summary.SummarizedUntil.String, nil
+}
+
+// usageBalanceBefore sums the usage of the attribution ID which is effective before `before`, including archived usage.
+// Days covered by valid daily summaries are read from them, the remaining usage from the ledger. A zero `before`
+// includes all usage.
+func usageBalanceBefore(ctx context.Context, conn *gorm.DB, attributionId AttributionID, before time.Time, excludeDrafts bool) (CreditCents, error) {
+	balance, summarizedUntil, err := summarizedCreditCents(ctx, conn, attributionId, before)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, table := range []string{(&Usage{}).TableName(), UsageArchiveTableName} {
+		query := prepared(conn).WithContext(ctx).
+			Table(table).
+			Scopes(notSoftDeletedUsage).
+			Select("sum(creditCents) AS creditCents").
+			Where("attributionId = ?", attributionId)
+		if !before.IsZero() {
+			query = query.Where("effectiveTime < ?", TimeToISO8601(before))
+		}
+		if summarizedUntil != "" {
+			// Drafts are never summarized.
+			query = query.Where("effectiveTime >= ? OR draft = ?", summarizedUntil, true)
+		}
+		if excludeDrafts {
+			query = query.Where("draft = ?", false)
+		}
+
+		var sum struct {
+			CreditCents sql.NullInt64 `gorm:"column:creditCents"`
+		}
+		if err := query.Find(&sum).Error; err != nil {
+			return 0, fmt.Errorf("failed to sum usage of %s: %w", attributionId, err)
+		}
+		balance += CreditCents(sum.CreditCents.Int64)
+	}
+	return balance, nil
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/db/dbtest"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestUsageDailySummaries(t *testing.T) {
+	conn := dbtest.ConnectForTests(t)
+	ctx := context.Background()
+	attributionID := db.NewTeamAttributionID(uuid.New().String())
+	t.Cleanup(func() {
+		require.NoError(t, conn.Where("attributionId = ?", attributionID).Delete(&db.Usage{}).Error)
+		require.NoError(t, conn.Where("attributionId = ?", attributionID).Delete(&db.UsageDailySummary{}).Error)
+		require.NoError(t, conn.Where("attributionId = ?", attributionID).Delete(&db.UsageDailySummaryState{}).Error)
+	})
+
+	day := time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)
+	usageAt := func(t *testing.T, effective time.Time, creditCents db.CreditCents, draft bool) db.Usage {
+		record := dbtest.NewUsage(t, db.Usage{
+			AttributionID: attributionID,
+			EffectiveTime: db.NewVarcharTime(effective),
+			CreditCents:   creditCents,
+		})
+		record.Draft = draft
+		return record
+	}
+	require.NoError(t, db.InsertUsage(ctx, conn,
+		usageAt(t, day.Add(2*time.Hour), 100, false),
+		usageAt(t, day.Add(3*time.Hour), 200, false),
+		usageAt(t, day.AddDate(0, 0, 1).Add(time.Hour), 400, false),
+		usageAt(t, day.AddDate(0, 0, 1).Add(2*time.Hour), 800, true),
+		usageAt(t, day.AddDate(0, 0, 2).Add(time.Hour), 1600, false),
+	))
+
+	requireBalances := func(t *testing.T) {
+		t.Helper()
+		balance, err := db.GetBalance(ctx, conn, attributionID)
+		require.NoError(t, err)
+		var expected db.CreditCents
+		var records []db.Usage
+		require.NoError(t, conn.Where("attributionId = ?", attributionID).Find(&records).Error)
+		for _, record := range records {
+			expected += record.CreditCents
+		}
+		require.Equal(t, expected, balance)
+
+		summary, err := db.GetUsageSummary(ctx, conn, attributionID, day.AddDate(0, 0, 1), day.AddDate(0, 0, 2).Add(12*time.Hour), true)
+		require.NoError(t, err)
+		var atStart, atEnd int64
+		var inRange int
+		for _, record := range records {
+			effective := record.EffectiveTime.Time()
+			if record.Draft || !effective.Before(day.AddDate(0, 0, 2).Add(12*time.Hour)) {
+				continue
+			}
+			atEnd += int64(record.CreditCents)
+			if effective.Before(day.AddDate(0, 0, 1)) {
+				atStart += int64(record.CreditCents)
+			} else {
+				inRange++
+			}
+		}
+		require.Equal(t, &db.UsageSummary{NumRecordsInRange: inRange, CreditCentsBalanceAtStart: atStart, CreditCentsBalanceAtEnd: atEnd}, summary)
+	}
+
+	requireBalances(t)
+
+	require.NoError(t, db.RefreshUsageDailySummaries(ctx, conn, attributionID, day.AddDate(0, 0, 2).Add(5*time.Hour)))
+	var state db.UsageDailySummaryState
+	require.NoError(t, conn.Where("attributionId = ?", attributionID).First(&state).Error)
+	require.Equal(t, "2022-10-03", state.SummarizedUntil)
+	var summaries []db.UsageDailySummary
+	require.NoError(t, conn.Where("attributionId = ?", attributionID).Order("day").Find(&summaries).Error)
+	require.Len(t, summaries, 2)
+	require.Equal(t, db.CreditCents(300), summaries[0].CreditCents)
+	require.Equal(t, int64(2), summaries[0].Entries)
+	require.Equal(t, db.CreditCents(400), summaries[1].CreditCents, "drafts must not be summarized")
+	requireBalances(t)
+
+	// Finalized usage on a summarized day invalidates the summaries.
+	require.NoError(t, db.InsertUsage(ctx, conn, usageAt(t, day.Add(5*time.Hour), 3200, false)))
+	err := conn.Where("attributionId = ?", attributionID).First(&state).Error
+	require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	requireBalances(t)
+
+	require.NoError(t, db.RefreshUsageDailySummaries(ctx, conn, attributionID, day.AddDate(0, 0, 2)))
+	requireBalances(t)
+
+	// Later days are added incrementally, and usage on days which are not summarized yet keeps the summaries valid.
+	require.NoError(t, db.InsertUsage(ctx, conn, usageAt(t, day.AddDate(0, 0, 2).Add(2*time.Hour), 6400, false)))
+	require.NoError(t, db.RefreshUsageDailySummaries(ctx, conn, attributionID, day.AddDate(0, 0, 3)))
+	require.NoError(t, conn.Where("attributionId = ?", attributionID).First(&state).Error)
+	require.Equal(t, "2022-10-04", state.SummarizedUntil)
+	require.NoError(t, conn.Where("attributionId = ?", attributionID).Order("day").Find(&summaries).Error)
+	require.Len(t, summaries, 3)
+	require.Equal(t, db.CreditCents(3500), summaries[0].CreditCents)
+	require.Equal(t, db.CreditCents(8000), summaries[2].CreditCents)
+	requireBalances(t)
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DeletedUsage is the number of entries which were soft-deleted or purged.
+type DeletedUsage struct {
+	Usage                  int64
+	WorkspaceInstanceUsage int64
+}
+
+// SoftDeleteUsage marks all usage and workspace instance usage of the attribution ID as deleted at `t`, including
+// archived usage. Usage which was soft-deleted before keeps its deletion time.
+func SoftDeleteUsage(ctx context.Context, conn *gorm.DB, attributionId AttributionID, t time.Time) (DeletedUsage, error) {
+	var deleted DeletedUsage
+	err := conn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, table := range []string{(&Usage{}).TableName(), UsageArchiveTableName} {
+			result := tx.Table(table).
+				Where("attributionId = ?", attributionId).
+				Scopes(notSoftDeletedUsage).
+				UpdateColumns(map[string]interface{}{
+					"softDeletedTime": TimeToISO8601(t),
+					"version":         gorm.Expr("version + 1"),
+				})
+			if result.Error != nil {
+				return fmt.Errorf("failed to soft-delete usage of %s in %s: %w", attributionId, table, result.Error)
+			}
+			deleted.Usage += result.RowsAffected
+		}
+
+		for _, table := range []string{(&WorkspaceInstanceUsage{}).TableName(), WorkspaceInstanceUsageArchiveTableName} {
+			result := tx.Table(table).
+				Where("attributionId = ?", attributionId).
+				Scopes(notSoftDeletedUsage).
+				UpdateColumn("softDeletedTime", TimeToISO8601(t))
+			if result.Error != nil {
+				return fmt.Errorf("failed to soft-delete workspace instance usage of %s in %s: %w", attributionId, table, result.Error)
+			}
+			deleted.WorkspaceInstanceUsage += result.RowsAffected
+		}
+
+		if err := InvalidateUsageDailySummaries(ctx, tx, attributionId); err != nil {
+			return err
+		}
+		return InvalidateCachedBalances(ctx, tx, attributionId)
+	})
+	if err != nil {
+		return DeletedUsage{}, err
+	}
+	return deleted, nil
+}
+
+// PurgeUsage permanently deletes the usage and workspace instance usage of the attribution ID which was soft-deleted
+// before `softDeletedBefore`, including archived usage. When dryRun is true, it only counts the entries which would be
+// purged.
+func PurgeUsage(ctx context.Context, conn *gorm.DB, attributionId AttributionID, softDeletedBefore time.Time, dryRun bool) (DeletedUsage, error) {
+	const purgeable = "attributionId = ? AND softDeletedTime != '' AND softDeletedTime < ?"
+	purge := func(tx *gorm.DB, table string) (int64, error) {
+		if dryRun {
+			var count int64
+			err := tx.Table(table).Where(purgeable, attributionId, TimeToISO8601(softDeletedBefore)).Count(&count).Error
+			return count, err
+		}
+		result := tx.Exec(fmt.Sprintf("DELETE FROM `%s` WHERE %s", table, purgeable), attributionId, TimeToISO8601(softDeletedBefore))
+		return result.RowsAffected, result.Error
+	}
+
+	var purged DeletedUsage
+	err := conn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, table := range []string{(&Usage{}).TableName(), UsageArchiveTableName} {
+			n, err := purge(tx, table)
+			if err != nil {
+				return fmt.Errorf("failed to purge usage of %s from %s: %w", attributionId, table, err)
+			}
+			purged.Usage += n
+		}
+		for _, table := range []string{(&WorkspaceInstanceUsage{}).TableName(), WorkspaceInstanceUsageArchiveTableName} {
+			n, err := purge(tx, table)
+			if err != nil {
+				return fmt.Errorf("failed to purge workspace instance usage of %s from %s: %w", attributionId, table, err)
+			}
+			purged.WorkspaceInstanceUsage += n
+		}
+		return nil
+	})
+	if err != nil {
+		return DeletedUsage{}, err
+	}
+	return purged, nil
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/db/dbtest"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSoftDeleteAndPurgeUsage(t *testing.T) {
+	conn := dbtest.ConnectForTests(t)
+	ctx := context.Background()
+	now := time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)
+	attributionID := db.NewTeamAttributionID(uuid.New().String())
+
+	usage := dbtest.CreateUsageRecords(t, conn,
+		dbtest.NewUsage(t, db.Usage{AttributionID: attributionID, CreditCents: 100, EffectiveTime: db.NewVarcharTime(now.Add(-time.Hour))}),
+		dbtest.NewUsage(t, db.Usage{AttributionID: attributionID, CreditCents: 200, EffectiveTime: db.NewVarcharTime(now.Add(-2 * time.Hour))}),
+	)
+	t.Cleanup(func() {
+		require.NoError(t, conn.Where("attributionId = ?", attributionID).Delete(&db.CachedBalance{}).Error)
+	})
+
+	deleted, err := db.SoftDeleteUsage(ctx, conn, attributionID, now)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, deleted.Usage)
+
+	_, err = db.GetUsage(ctx, conn, usage[0].ID)
+	require.ErrorIs(t, err, db.UsageNotFound, "soft-deleted usage must not be found")
+
+	balance, err := db.GetBalance(ctx, conn, attributionID)
+	require.NoError(t, err)
+	require.EqualValues(t, 0, balance)
+
+	found, err := db.FindUsage(ctx, conn, &db.FindUsageParams{
+		AttributionId: attributionID,
+		From:          now.Add(-24 * time.Hour),
+		To:            now,
+	})
+	require.NoError(t, err)
+	require.Empty(t, found)
+
+	deleted, err = db.SoftDeleteUsage(ctx, conn, attributionID, now.Add(time.Hour))
+	require.NoError(t, err)
+	require.EqualValues(t, 0, deleted.Usage, "usage must keep its first deletion time")
+
+	purged, err := db.PurgeUsage(ctx, conn, attributionID, now, false)
+	require.NoError(t, err)
+	require.EqualValues(t, 0, purged.Usage, "usage deleted within the retention must not be purged")
+
+	purged, err = db.PurgeUsage(ctx, conn, attributionID, now.Add(time.Second), true)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, purged.Usage)
+
+	var count int64
+	require.NoError(t, conn.Model(&db.Usage{}).Where("attributionId = ?", attributionID).Count(&count).Error)
+	require.EqualValues(t, 2, count, "a dry run must not delete usage")
+
+	purged, err = db.PurgeUsage(ctx, conn, attributionID, now.Add(time.Second), false)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, purged.Usage)
+
+	require.NoError(t, conn.Model(&db.Usage{}).Where("attributionId = ?", attributionID).Count(&count).Error)
+	require.EqualValues(t, 0, count)
+}
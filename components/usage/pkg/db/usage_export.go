@@ -0,0 +1,58 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// UsageExport records that the usage of a day was exported to an analytics store, such that days which were not
+// exported yet can be caught up on.
+type UsageExport struct {
+	Exporter string `gorm:"primary_key;column:exporter;type:varchar;size:64;" json:"exporter"`
+	// Day is the exported day, see UsageDay.
+	Day        string      `gorm:"primary_key;column:day;type:varchar;size:10;" json:"day"`
+	Rows       int64       `gorm:"column:rowCount;type:bigint;" json:"rows"`
+	ExportedAt VarcharTime `gorm:"column:exportedAt;type:varchar;size:255;" json:"exportedAt"`
+}
+
+// TableName sets the insert table name for this struct type
+func (e *UsageExport) TableName() string {
+	return "d_b_usage_export"
+}
+
+// RecordUsageExport stores the export, replacing the previous export of the day to the same exporter.
+func RecordUsageExport(ctx context.Context, conn *gorm.DB, export UsageExport) error {
+	result := conn.WithContext(ctx).
+		Clauses(clause.OnConflict{UpdateAll: true}).
+		Create(&export)
+	if result.Error != nil {
+		return fmt.Errorf("failed to record usage export of %s to %s: %w", export.Day, export.Exporter, result.Error)
+	}
+	return nil
+}
+
+// FindUsageExports returns the exports of the days in [from, to) to the exporter by day.
+func FindUsageExports(ctx context.Context, conn *gorm.DB, exporter string, from, to time.Time) (map[string]UsageExport, error) {
+	var exports []UsageExport
+	err := conn.WithContext(ctx).
+		Where("exporter = ?", exporter).
+		Where("day >= ? AND day < ?", UsageDay(from), UsageDay(to)).
+		Find(&exports).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find usage exports to %s: %w", exporter, err)
+	}
+
+	result := map[string]UsageExport{}
+	for _, export := range exports {
+		result[export.Day] = export
+	}
+	return result, nil
+}
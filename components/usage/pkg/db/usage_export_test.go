@@ -0,0 +1,36 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/db/dbtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordUsageExport(t *testing.T) {
+	conn := dbtest.ConnectInMemoryForTests(t)
+	ctx := context.Background()
+	day := time.Date(2022, 10, 10, 0, 0, 0, 0, time.UTC)
+
+	for _, export := range []db.UsageExport{
+		{Exporter: "stage", Day: "2022-10-09", Rows: 1, ExportedAt: db.NewVarcharTime(day)},
+		{Exporter: "stage", Day: "2022-10-10", Rows: 2, ExportedAt: db.NewVarcharTime(day)},
+		{Exporter: "stage", Day: "2022-10-10", Rows: 3, ExportedAt: db.NewVarcharTime(day.Add(time.Hour))},
+		{Exporter: "bigquery", Day: "2022-10-11", Rows: 4, ExportedAt: db.NewVarcharTime(day)},
+	} {
+		require.NoError(t, db.RecordUsageExport(ctx, conn, export))
+	}
+
+	exports, err := db.FindUsageExports(ctx, conn, "stage", day, day.AddDate(0, 0, 2))
+	require.NoError(t, err)
+	require.Len(t, exports, 1, "must only find exports of the exporter in the time range")
+	require.Equal(t, int64(3), exports["2022-10-10"].Rows, "must replace the previous export of the day")
+	require.Equal(t, day.Add(time.Hour), exports["2022-10-10"].ExportedAt.Time())
+}
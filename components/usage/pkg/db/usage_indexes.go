@@ -0,0 +1,66 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Index is an index on the columns of a table, in order.
+type Index struct {
+	Table   string
+	Name    string
+	Columns []string
+}
+
+func (i Index) String() string {
+	return fmt.Sprintf("%s.%s (%s)", i.Table, i.Name, strings.Join(i.Columns, ", "))
+}
+
+// UsageIndexes are the indexes which the queries on usage rely on. They are created by the AddUsageLedgerIndexes
+// migration of gitpod-db.
+var UsageIndexes = []Index{
+	// FindUsage, GetUsageSummary and GetBalance filter by attribution ID and effective time, and sum up kinds.
+	{Table: "d_b_usage", Name: "IDX_usage__attributionId_effectiveTime_kind", Columns: []string{"attributionId", "effectiveTime", "kind"}},
+	// FindWorkspaceInstanceUsage filters by workspace instance and kind.
+	{Table: "d_b_usage", Name: "IDX_usage__workspaceInstanceId_kind", Columns: []string{"workspaceInstanceId", "kind"}},
+	// FindAllDraftUsage and FindDraftUsageBefore filter by draft.
+	{Table: "d_b_usage", Name: "IDX_usage__draft", Columns: []string{"draft"}},
+}
+
+// FindMissingIndexes returns the indexes which do not exist, or which are not on the expected columns.
+func FindMissingIndexes(ctx context.Context, conn *gorm.DB, indexes []Index) ([]Index, error) {
+	var missing []Index
+	for _, index := range indexes {
+		var columns []string
+		err := conn.WithContext(ctx).
+			Raw("SELECT COLUMN_NAME FROM information_schema.STATISTICS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND INDEX_NAME = ? ORDER BY SEQ_IN_INDEX",
+				index.Table, index.Name).
+			Scan(&columns).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to get columns of index %s: %w", index, err)
+		}
+		if !sameColumns(columns, index.Columns) {
+			missing = append(missing, index)
+		}
+	}
+	return missing, nil
+}
+
+func sameColumns(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !strings.EqualFold(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,28 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/db/dbtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindMissingIndexes(t *testing.T) {
+	conn := dbtest.ConnectForTests(t)
+
+	missing, err := db.FindMissingIndexes(context.Background(), conn, db.UsageIndexes)
+	require.NoError(t, err)
+	require.Empty(t, missing, "migrations must create all usage indexes")
+
+	wrongColumns := db.Index{Table: "d_b_usage", Name: "IDX_usage__draft", Columns: []string{"draft", "kind"}}
+	notExisting := db.Index{Table: "d_b_usage", Name: "IDX_usage__does_not_exist", Columns: []string{"kind"}}
+	missing, err = db.FindMissingIndexes(context.Background(), conn, []db.Index{wrongColumns, notExisting})
+	require.NoError(t, err)
+	require.Equal(t, []db.Index{wrongColumns, notExisting}, missing)
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// usageIteratorBatchSize bounds the number of usage entries ForEachUsage holds in memory per table.
+const usageIteratorBatchSize = 1000
+
+// ForEachUsage calls fn with the usage of the attribution ID in [From, To), including archived usage, in the order of
+// the params. Usage is read in batches, such that the usage of large attribution IDs is never held in memory at once.
+// Offset and Limit of the params apply to the usage which is iterated. When fn returns an error, iteration stops and the
+// error is returned. When the attribution ID of the params is empty, the usage of all attribution IDs is iterated.
+func ForEachUsage(ctx context.Context, conn *gorm.DB, params *FindUsageParams, fn func(Usage) error) error {
+	cursors := []*usageCursor{
+		{conn: conn, table: (&Usage{}).TableName(), params: params, after: params.After},
+		{conn: conn, table: UsageArchiveTableName, params: params, after: params.After},
+	}
+
+	var n int64
+	for {
+		// Both tables are ordered, the next usage is the first of either table.
+		var next *usageCursor
+		for _, cursor := range cursors {
+			usage, err := cursor.peek(ctx)
+			if err != nil {
+				return err
+			}
+			if usage == nil {
+				continue
+			}
+			if next == nil || usageBefore(*usage, next.buf[0], params.Order) {
+				next = cursor
+			}
+		}
+		if next == nil {
+			return nil
+		}
+
+		usage := next.pop()
+		n++
+		if n <= params.Offset {
+			continue
+		}
+		if err := fn(usage); err != nil {
+			return err
+		}
+		if params.Limit != 0 && n >= params.Offset+params.Limit {
+			return nil
+		}
+	}
+}
+
+// usageBefore is true when a comes before b in the order, consistent with AfterKey.
+func usageBefore(a, b Usage, order Order) bool {
+	ta, tb := a.EffectiveTime.Time(), b.EffectiveTime.Time()
+	if ta.Equal(tb) {
+		return (a.ID.String() < b.ID.String()) == (order == AscendingOrder)
+	}
+	return ta.Before(tb) == (order == AscendingOrder)
+}
+
+// usageCursor reads the usage of a table in batches.
+type usageCursor struct {
+	conn   *gorm.DB
+	table  string
+	params *FindUsageParams
+
+	after *PageKey
+	buf   []Usage
+	done  bool
+}
+
+// peek returns the next usage of the table, or nil when there is none.
+func (c *usageCursor) peek(ctx context.Context) (*Usage, error) {
+	if len(c.buf) == 0 && !c.done {
+		query := c.conn.WithContext(ctx).
+			Table(c.table).
+			Scopes(notSoftDeletedUsage).
+			Where("effectiveTime >= ? AND effectiveTime < ?", TimeToISO8601(c.params.From), TimeToISO8601(c.params.To))
+		if c.params.AttributionId != "" {
+			query = query.Where("attributionId = ?", c.params.AttributionId)
+		}
+		if c.params.ExcludeDrafts {
+			query = query.Where("draft = ?", false)
+		}
+
+		var batch []Usage
+		err := query.Scopes(AfterKey("effectiveTime", "id", c.params.Order, c.after), Limit(usageIteratorBatchSize)).Find(&batch).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to get usage records from %s: %w", c.table, err)
+		}
+		c.buf = batch
+		c.after = NextPageKey(batch, usageIteratorBatchSize, UsagePageKey)
+		c.done = c.after == nil
+	}
+	if len(c.buf) == 0 {
+		return nil, nil
+	}
+	return &c.buf[0], nil
+}
+
+func (c *usageCursor) pop() Usage {
+	usage := c.buf[0]
+	c.buf = c.buf[1:]
+	return usage
+}
@@ -0,0 +1,27 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsageBefore(t *testing.T) {
+	start := time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)
+	early := Usage{ID: uuid.MustParse("00000000-0000-0000-0000-000000000002"), EffectiveTime: NewVarcharTime(start)}
+	late := Usage{ID: uuid.MustParse("00000000-0000-0000-0000-000000000001"), EffectiveTime: NewVarcharTime(start.Add(time.Hour))}
+	sameTime := Usage{ID: uuid.MustParse("00000000-0000-0000-0000-000000000003"), EffectiveTime: NewVarcharTime(start)}
+
+	require.True(t, usageBefore(early, late, AscendingOrder))
+	require.False(t, usageBefore(late, early, AscendingOrder))
+	require.True(t, usageBefore(late, early, DescendingOrder))
+
+	require.True(t, usageBefore(early, sameTime, AscendingOrder), "usage with the same effective time is ordered by ID")
+	require.True(t, usageBefore(sameTime, early, DescendingOrder))
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// UsageKey records the unique keys of a usage entry. Unique keys of the partitioned usage table must include the
+// effective time, which changes while usage is in draft, hence usage is unique through this table instead. Keys of
+// archived and purged usage are retained, such that their IDs are never reused.
+type UsageKey struct {
+	ID uuid.UUID `gorm:"primary_key;column:id;type:char;size:36;" json:"id"`
+
+	// WorkspaceInstanceID, Kind and AttributionID are unique, such that UpsertUsage records usage of a workspace
+	// instance at most once per kind and attribution ID. The attribution ID is part of the key, as usage of a workspace
+	// instance is split across cost centers. WorkspaceInstanceID is nil for usage inserted otherwise, e.g. voiding usage
+	// shares the workspace instance of the usage it voids.
+	WorkspaceInstanceID *uuid.UUID    `gorm:"column:workspaceInstanceId;type:char;size:36;uniqueIndex:UQ_usage_key__workspaceInstanceId_kind_attributionId,priority:1;" json:"workspaceInstanceId"`
+	Kind                UsageKind     `gorm:"column:kind;type:char;size:10;uniqueIndex:UQ_usage_key__workspaceInstanceId_kind_attributionId,priority:2;" json:"kind"`
+	AttributionID       AttributionID `gorm:"column:attributionId;type:varchar;size:255;uniqueIndex:UQ_usage_key__workspaceInstanceId_kind_attributionId,priority:3;" json:"attributionId"`
+}
+
+// TableName sets the insert table name for this struct type
+func (k *UsageKey) TableName() string {
+	return "d_b_usage_key"
+}
+
+func usageKeyOf(record Usage, byWorkspaceInstance bool) UsageKey {
+	key := UsageKey{ID: record.ID, Kind: record.Kind, AttributionID: record.AttributionID}
+	if byWorkspaceInstance && record.WorkspaceInstanceID != uuid.Nil {
+		workspaceInstanceID := record.WorkspaceInstanceID
+		key.WorkspaceInstanceID = &workspaceInstanceID
+	}
+	return key
+}
+
+// claimUsageIDs inserts the keys of the usage records, and returns the records whose IDs were not claimed before, in
+// order, without duplicates. Existing keys are read with a locking read, such that concurrent transactions claiming the
+// same ID deadlock and are retried, and the unique keys reject usage which was claimed nonetheless. When
+// byWorkspaceInstance is set, they also reject usage of a workspace instance which was claimed under another ID.
+func claimUsageIDs(tx *gorm.DB, records []Usage, byWorkspaceInstance bool) ([]Usage, error) {
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	var existingKeys []UsageKey
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id IN ?", usageIDs(records)).
+		Find(&existingKeys).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find existing usage keys: %w", err)
+	}
+	claimed := map[uuid.UUID]bool{}
+	for _, key := range existingKeys {
+		claimed[key.ID] = true
+	}
+
+	var unclaimed []Usage
+	var keys []UsageKey
+	for _, record := range records {
+		if claimed[record.ID] {
+			continue
+		}
+		claimed[record.ID] = true
+		unclaimed = append(unclaimed, record)
+		keys = append(keys, usageKeyOf(record, byWorkspaceInstance))
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	err = tx.CreateInBatches(keys, 1000).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim %d usage IDs: %w", len(keys), err)
+	}
+	return unclaimed, nil
+}
@@ -0,0 +1,40 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// UsageMilestone_FirstPaidUsage is reached when an attribution ID first uses credits beyond its credit grants while
+// being billed through Stripe.
+const UsageMilestone_FirstPaidUsage = "first_paid_usage"
+
+// UsageMilestone records that an attribution ID reached a milestone, such that every milestone is reached at most once.
+type UsageMilestone struct {
+	AttributionID AttributionID `gorm:"primary_key;column:attributionId;type:varchar;size:255;" json:"attributionId"`
+	Milestone     string        `gorm:"primary_key;column:milestone;type:varchar;size:64;" json:"milestone"`
+	ReachedAt     VarcharTime   `gorm:"column:reachedAt;type:varchar;size:255;" json:"reachedAt"`
+}
+
+// TableName sets the insert table name for this struct type
+func (m *UsageMilestone) TableName() string {
+	return "d_b_usage_milestone"
+}
+
+// RecordUsageMilestone stores the milestone and returns false if the attribution ID reached it before.
+func RecordUsageMilestone(ctx context.Context, conn *gorm.DB, milestone UsageMilestone) (bool, error) {
+	result := conn.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&milestone)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to record usage milestone %s for %s: %w", milestone.Milestone, milestone.AttributionID, result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
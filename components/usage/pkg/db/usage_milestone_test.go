@@ -0,0 +1,50 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/db/dbtest"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordUsageMilestone(t *testing.T) {
+	conn := dbtest.ConnectInMemoryForTests(t)
+	ctx := context.Background()
+	attributionID := db.NewTeamAttributionID(uuid.New().String())
+	reachedAt := time.Date(2022, 10, 11, 8, 0, 0, 0, time.UTC)
+
+	milestone := db.UsageMilestone{
+		AttributionID: attributionID,
+		Milestone:     db.UsageMilestone_FirstPaidUsage,
+		ReachedAt:     db.NewVarcharTime(reachedAt),
+	}
+
+	recorded, err := db.RecordUsageMilestone(ctx, conn, milestone)
+	require.NoError(t, err)
+	require.True(t, recorded)
+
+	milestone.ReachedAt = db.NewVarcharTime(reachedAt.AddDate(0, 1, 0))
+	recorded, err = db.RecordUsageMilestone(ctx, conn, milestone)
+	require.NoError(t, err)
+	require.False(t, recorded, "must reach every milestone at most once")
+
+	var stored db.UsageMilestone
+	require.NoError(t, conn.Where("attributionId = ?", attributionID).First(&stored).Error)
+	require.Equal(t, reachedAt, stored.ReachedAt.Time())
+
+	recorded, err = db.RecordUsageMilestone(ctx, conn, db.UsageMilestone{
+		AttributionID: db.NewTeamAttributionID(uuid.New().String()),
+		Milestone:     db.UsageMilestone_FirstPaidUsage,
+		ReachedAt:     db.NewVarcharTime(reachedAt),
+	})
+	require.NoError(t, err)
+	require.True(t, recorded, "must track milestones per attribution ID")
+}
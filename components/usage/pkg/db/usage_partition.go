@@ -0,0 +1,138 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gitpod-io/gitpod/common-go/log"
+	"gorm.io/gorm"
+)
+
+const (
+	// usageMaxPartition catches usage beyond the last monthly partition of d_b_usage. Monthly partitions are split
+	// off it ahead of time, such that it stays empty.
+	usageMaxPartition = "pmax"
+)
+
+// UsagePartition is a monthly partition of d_b_usage, holding the usage with an effective time in Month.
+type UsagePartition struct {
+	Month time.Time
+}
+
+// NewUsagePartition returns the partition holding usage effective at `t`.
+func NewUsagePartition(t time.Time) UsagePartition {
+	t = t.UTC()
+	return UsagePartition{Month: time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)}
+}
+
+// Name is the name of the partition, e.g. p202209 for September 2022.
+func (p UsagePartition) Name() string {
+	return p.Month.Format("p200601")
+}
+
+// LessThan is the upper bound of the effective times in the partition. Effective times are ISO 8601 strings, which
+// sort before the first day of the next month exactly when they are in the month.
+func (p UsagePartition) LessThan() string {
+	return p.Month.AddDate(0, 1, 0).Format("2006-01-02")
+}
+
+// ParseUsagePartitionName parses the name of a monthly partition, as returned by Name.
+func ParseUsagePartitionName(name string) (UsagePartition, error) {
+	month, err := time.Parse("p200601", name)
+	if err != nil {
+		return UsagePartition{}, fmt.Errorf("failed to parse usage partition name %q: %w", name, err)
+	}
+	return UsagePartition{Month: month}, nil
+}
+
+// MissingUsagePartitions returns the monthly partitions which need to be added after the existing ones, such that
+// there is a partition for every month up to and including the month of `until`.
+func MissingUsagePartitions(existing []UsagePartition, until time.Time) []UsagePartition {
+	if len(existing) == 0 {
+		return nil
+	}
+
+	last := existing[0]
+	for _, partition := range existing[1:] {
+		if partition.Month.After(last.Month) {
+			last = partition
+		}
+	}
+
+	var missing []UsagePartition
+	untilMonth := NewUsagePartition(until).Month
+	for month := last.Month.AddDate(0, 1, 0); !month.After(untilMonth); month = month.AddDate(0, 1, 0) {
+		missing = append(missing, UsagePartition{Month: month})
+	}
+	return missing
+}
+
+// EnsureUsagePartitions adds the monthly partitions of d_b_usage up to and including the month of `until`, by
+// splitting them off the max partition. Queries are not affected by partitioning, apart from only scanning the
+// partitions of the months they filter on.
+func EnsureUsagePartitions(ctx context.Context, conn *gorm.DB, until time.Time) error {
+	existing, err := listUsagePartitions(ctx, conn)
+	if err != nil {
+		return err
+	}
+	if len(existing) == 0 {
+		log.Warn("Usage table is not partitioned, not adding partitions.")
+		return nil
+	}
+
+	missing := MissingUsagePartitions(existing, until)
+	if len(missing) == 0 {
+		return nil
+	}
+
+	definitions := make([]string, 0, len(missing)+1)
+	for _, partition := range missing {
+		definitions = append(definitions, fmt.Sprintf("PARTITION %s VALUES LESS THAN ('%s')", partition.Name(), partition.LessThan()))
+	}
+	definitions = append(definitions, fmt.Sprintf("PARTITION %s VALUES LESS THAN (MAXVALUE)", usageMaxPartition))
+
+	// Reorganizing the max partition is cheap, because no usage is effective that far in the future.
+	err = conn.WithContext(ctx).Exec(fmt.Sprintf("ALTER TABLE `%s` REORGANIZE PARTITION %s INTO (%s)",
+		(&Usage{}).TableName(), usageMaxPartition, strings.Join(definitions, ", "))).Error
+	if err != nil {
+		return fmt.Errorf("failed to add usage partitions: %w", err)
+	}
+	log.WithField("partitions", len(missing)).WithField("until", missing[len(missing)-1].Name()).Info("Added usage partitions.")
+	return nil
+}
+
+// listUsagePartitions returns the monthly partitions of d_b_usage, in order. It returns no partitions when the table is
+// not partitioned.
+func listUsagePartitions(ctx context.Context, conn *gorm.DB) ([]UsagePartition, error) {
+	var names []string
+	err := conn.WithContext(ctx).
+		Raw("SELECT PARTITION_NAME FROM information_schema.PARTITIONS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND PARTITION_NAME IS NOT NULL",
+			(&Usage{}).TableName()).
+		Scan(&names).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list usage partitions: %w", err)
+	}
+
+	var partitions []UsagePartition
+	for _, name := range names {
+		if name == usageMaxPartition {
+			continue
+		}
+		partition, err := ParseUsagePartitionName(name)
+		if err != nil {
+			return nil, err
+		}
+		partitions = append(partitions, partition)
+	}
+	sort.Slice(partitions, func(i, j int) bool {
+		return partitions[i].Month.Before(partitions[j].Month)
+	})
+	return partitions, nil
+}
@@ -0,0 +1,45 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsagePartition(t *testing.T) {
+	partition := db.NewUsagePartition(time.Date(2022, 12, 31, 23, 59, 0, 0, time.UTC))
+	require.Equal(t, "p202212", partition.Name())
+	require.Equal(t, "2023-01-01", partition.LessThan())
+
+	parsed, err := db.ParseUsagePartitionName(partition.Name())
+	require.NoError(t, err)
+	require.Equal(t, partition, parsed)
+
+	_, err = db.ParseUsagePartitionName("pmax")
+	require.Error(t, err)
+
+	last := db.TimeToISO8601(time.Date(2022, 12, 31, 23, 59, 59, 999000000, time.UTC))
+	first := db.TimeToISO8601(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+	require.Less(t, last, partition.LessThan(), "usage at the end of the month must be in the partition")
+	require.GreaterOrEqual(t, first, partition.LessThan(), "usage at the start of the next month must not be in the partition")
+}
+
+func TestMissingUsagePartitions(t *testing.T) {
+	month := func(year int, month time.Month) db.UsagePartition {
+		return db.UsagePartition{Month: time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)}
+	}
+	existing := []db.UsagePartition{month(2022, 8), month(2022, 9), month(2022, 10)}
+
+	require.Empty(t, db.MissingUsagePartitions(existing, time.Date(2022, 10, 31, 0, 0, 0, 0, time.UTC)))
+	require.Equal(t,
+		[]db.UsagePartition{month(2022, 11), month(2022, 12), month(2023, 1)},
+		db.MissingUsagePartitions(existing, time.Date(2023, 1, 15, 0, 0, 0, 0, time.UTC)),
+	)
+	require.Empty(t, db.MissingUsagePartitions(nil, time.Date(2023, 1, 15, 0, 0, 0, 0, time.UTC)), "unpartitioned tables must not be partitioned")
+}
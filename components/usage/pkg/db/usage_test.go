@@ -5,7 +5,9 @@
 package db_test
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"testing"
 	"time"
@@ -148,6 +150,58 @@ func TestInsertUsageRecords(t *testing.T) {
 	require.NotEqual(t, updatedDesc, drafts[0].Description)
 }
 
+func TestCreateUsage(t *testing.T) {
+	conn := dbtest.ConnectInMemoryForTests(t)
+	ctx := context.Background()
+
+	attributionID := db.NewTeamAttributionID(uuid.New().String())
+	start := time.Date(2022, 7, 1, 0, 0, 0, 0, time.UTC)
+	usage := dbtest.CreateUsageRecords(t, conn, dbtest.NewUsage(t, db.Usage{
+		AttributionID: attributionID,
+		CreditCents:   100,
+		EffectiveTime: db.NewVarcharTime(start),
+	}))[0]
+
+	voiding := db.NewVoidingUsage(usage, "refund")
+	require.NoError(t, db.CreateUsage(ctx, conn, voiding))
+
+	other := dbtest.NewUsage(t, db.Usage{AttributionID: attributionID, EffectiveTime: db.NewVarcharTime(start)})
+	err := db.CreateUsage(ctx, conn, other, voiding)
+	require.ErrorIs(t, err, db.UsageAlreadyExists)
+
+	_, err = db.GetUsage(ctx, conn, other.ID)
+	require.ErrorIs(t, err, db.UsageNotFound, "must not store any record when one of them exists")
+}
+
+func TestInsertUsage_ClaimsIDs(t *testing.T) {
+	conn := dbtest.ConnectInMemoryForTests(t)
+	ctx := context.Background()
+
+	attributionID := db.NewTeamAttributionID(uuid.New().String())
+	start := time.Date(2022, 7, 1, 0, 0, 0, 0, time.UTC)
+	usage := dbtest.CreateUsageRecords(t, conn, dbtest.NewUsage(t, db.Usage{
+		AttributionID: attributionID,
+		CreditCents:   100,
+		EffectiveTime: db.NewVarcharTime(start),
+	}))[0]
+
+	// The effective time is part of the primary key of the partitioned table, it must not make the ID unique.
+	redelivered := usage
+	redelivered.EffectiveTime = db.NewVarcharTime(start.Add(time.Hour))
+	require.NoError(t, db.InsertUsage(ctx, conn, redelivered))
+
+	var count int64
+	require.NoError(t, conn.Model(&db.Usage{}).Where("id = ?", usage.ID).Count(&count).Error)
+	require.EqualValues(t, 1, count)
+
+	// IDs of purged usage remain claimed.
+	require.NoError(t, conn.Where("id = ?", usage.ID).Delete(&db.Usage{}).Error)
+	require.NoError(t, db.InsertUsage(ctx, conn, usage))
+	_, err := db.GetUsage(ctx, conn, usage.ID)
+	require.ErrorIs(t, err, db.UsageNotFound)
+	require.ErrorIs(t, db.UpsertUsage(ctx, conn, usage), db.UsageAlreadyExists)
+}
+
 func TestUpdateUsageRecords(t *testing.T) {
 	conn := dbtest.ConnectForTests(t)
 
@@ -172,6 +226,227 @@ func TestUpdateUsageRecords(t *testing.T) {
 	require.Equal(t, updatedDesc, drafts[0].Description)
 }
 
+func TestFindUsage_AfterKey(t *testing.T) {
+	conn := dbtest.ConnectForTests(t)
+	ctx := context.Background()
+
+	attributionID := db.NewTeamAttributionID(uuid.New().String())
+	start := time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC)
+	// Two entries share the effective time, and are ordered by ID.
+	dbtest.CreateUsageRecords(t, conn,
+		dbtest.NewUsage(t, db.Usage{AttributionID: attributionID, EffectiveTime: db.NewVarcharTime(start)}),
+		dbtest.NewUsage(t, db.Usage{AttributionID: attributionID, EffectiveTime: db.NewVarcharTime(start.Add(time.Hour))}),
+		dbtest.NewUsage(t, db.Usage{AttributionID: attributionID, EffectiveTime: db.NewVarcharTime(start.Add(time.Hour))}),
+		dbtest.NewUsage(t, db.Usage{AttributionID: attributionID, EffectiveTime: db.NewVarcharTime(start.Add(2 * time.Hour))}),
+	)
+
+	all, err := db.FindUsage(ctx, conn, &db.FindUsageParams{
+		AttributionId: attributionID,
+		From:          start,
+		To:            start.Add(3 * time.Hour),
+		Order:         db.AscendingOrder,
+	})
+	require.NoError(t, err)
+	require.Len(t, all, 4)
+
+	var paged []db.Usage
+	var after *db.PageKey
+	for i := 0; i < 3; i++ {
+		page, err := db.FindUsage(ctx, conn, &db.FindUsageParams{
+			AttributionId: attributionID,
+			From:          start,
+			To:            start.Add(3 * time.Hour),
+			Order:         db.AscendingOrder,
+			After:         after,
+			Limit:         2,
+		})
+		require.NoError(t, err)
+		paged = append(paged, page...)
+		after = db.NextPageKey(page, 2, db.UsagePageKey)
+		if after == nil {
+			break
+		}
+	}
+	require.Equal(t, all, paged, "pages must neither skip nor repeat usage")
+}
+
+func TestForEachUsage(t *testing.T) {
+	conn := dbtest.ConnectForTests(t)
+	ctx := context.Background()
+
+	attributionID := db.NewTeamAttributionID(uuid.New().String())
+	start := time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC)
+	usage := dbtest.CreateUsageRecords(t, conn,
+		dbtest.NewUsage(t, db.Usage{AttributionID: attributionID, EffectiveTime: db.NewVarcharTime(start.Add(2 * time.Hour))}),
+		dbtest.NewUsage(t, db.Usage{AttributionID: attributionID, EffectiveTime: db.NewVarcharTime(start)}),
+		dbtest.NewUsage(t, db.Usage{AttributionID: attributionID, EffectiveTime: db.NewVarcharTime(start.Add(time.Hour))}),
+	)
+	params := &db.FindUsageParams{
+		AttributionId: attributionID,
+		From:          start,
+		To:            start.Add(3 * time.Hour),
+		Order:         db.AscendingOrder,
+	}
+
+	var ids []uuid.UUID
+	require.NoError(t, db.ForEachUsage(ctx, conn, params, func(u db.Usage) error {
+		ids = append(ids, u.ID)
+		return nil
+	}))
+	require.Equal(t, []uuid.UUID{usage[1].ID, usage[2].ID, usage[0].ID}, ids)
+
+	stop := errors.New("stop")
+	ids = nil
+	err := db.ForEachUsage(ctx, conn, params, func(u db.Usage) error {
+		ids = append(ids, u.ID)
+		return stop
+	})
+	require.ErrorIs(t, err, stop)
+	require.Len(t, ids, 1, "iteration must stop when fn fails")
+}
+
+func TestForEachUsage_AllAttributionIDs(t *testing.T) {
+	conn := dbtest.ConnectInMemoryForTests(t)
+	ctx := context.Background()
+
+	start := time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC)
+	teamA := db.NewTeamAttributionID(uuid.New().String())
+	teamB := db.NewTeamAttributionID(uuid.New().String())
+	usage := dbtest.CreateUsageRecords(t, conn,
+		dbtest.NewUsage(t, db.Usage{AttributionID: teamA, EffectiveTime: db.NewVarcharTime(start)}),
+		dbtest.NewUsage(t, db.Usage{AttributionID: teamB, EffectiveTime: db.NewVarcharTime(start.Add(2 * time.Hour))}),
+		dbtest.NewUsage(t, db.Usage{AttributionID: teamB, EffectiveTime: db.NewVarcharTime(start.Add(24 * time.Hour))}),
+	)
+	archived := dbtest.NewUsage(t, db.Usage{AttributionID: teamA, EffectiveTime: db.NewVarcharTime(start.Add(time.Hour))})
+	require.NoError(t, conn.Table(db.UsageArchiveTableName).Create(&archived).Error)
+
+	var ids []uuid.UUID
+	require.NoError(t, db.ForEachUsage(ctx, conn, &db.FindUsageParams{From: start, To: start.Add(24 * time.Hour), Order: db.AscendingOrder}, func(u db.Usage) error {
+		ids = append(ids, u.ID)
+		return nil
+	}))
+	require.Equal(t, []uuid.UUID{usage[0].ID, archived.ID, usage[1].ID}, ids)
+}
+
+func TestUpsertUsage(t *testing.T) {
+	conn := dbtest.ConnectForTests(t)
+	ctx := context.Background()
+
+	attributionID := db.NewTeamAttributionID(uuid.New().String())
+	start := time.Date(2022, 9, 30, 0, 0, 0, 0, time.UTC)
+
+	draft := dbtest.CreateUsageRecords(t, conn, dbtest.NewUsage(t, db.Usage{
+		AttributionID: attributionID,
+		CreditCents:   100,
+		EffectiveTime: db.NewVarcharTime(start),
+		Draft:         true,
+	}))[0]
+	inserted := dbtest.NewUsage(t, db.Usage{
+		AttributionID: attributionID,
+		CreditCents:   200,
+		EffectiveTime: db.NewVarcharTime(start),
+	})
+	t.Cleanup(func() {
+		require.NoError(t, conn.Where("id = ?", inserted.ID).Delete(&db.Usage{}).Error)
+	})
+
+	// Finalizing the draft in the next month moves it into another partition.
+	draft.CreditCents = 300
+	draft.Draft = false
+	draft.EffectiveTime = db.NewVarcharTime(start.AddDate(0, 0, 2))
+	require.NoError(t, db.UpsertUsage(ctx, conn, draft, inserted))
+
+	updated, err := db.GetUsage(ctx, conn, draft.ID)
+	require.NoError(t, err)
+	require.EqualValues(t, 300, updated.CreditCents)
+	require.False(t, updated.Draft)
+	require.EqualValues(t, 1, updated.Version)
+	require.Equal(t, draft.EffectiveTime.Time(), updated.EffectiveTime.Time())
+
+	var count int64
+	require.NoError(t, conn.Model(&db.Usage{}).Where("id = ?", draft.ID).Count(&count).Error)
+	require.EqualValues(t, 1, count, "updates must not duplicate usage")
+
+	created, err := db.GetUsage(ctx, conn, inserted.ID)
+	require.NoError(t, err)
+	require.EqualValues(t, 200, created.CreditCents)
+}
+
+func TestUpsertUsage_VersionConflict(t *testing.T) {
+	conn := dbtest.ConnectForTests(t)
+	ctx := context.Background()
+
+	attributionID := db.NewTeamAttributionID(uuid.New().String())
+	usage := dbtest.CreateUsageRecords(t, conn, dbtest.NewUsage(t, db.Usage{
+		AttributionID: attributionID,
+		CreditCents:   100,
+		EffectiveTime: db.NewVarcharTime(time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC)),
+		Draft:         true,
+	}))[0]
+	t.Cleanup(func() {
+		require.NoError(t, conn.Where("attributionId = ?", attributionID).Delete(&db.CachedBalance{}).Error)
+	})
+
+	// Both callers read version 0, the first update wins.
+	first, second := usage, usage
+	first.CreditCents = 200
+	second.CreditCents = 300
+	require.NoError(t, db.UpsertUsage(ctx, conn, first))
+	require.ErrorIs(t, db.UpsertUsage(ctx, conn, second), db.UsageVersionConflict)
+
+	stored, err := db.GetUsage(ctx, conn, usage.ID)
+	require.NoError(t, err)
+	require.EqualValues(t, 200, stored.CreditCents)
+	require.EqualValues(t, 1, stored.Version)
+
+	// Retrying with fresh data succeeds.
+	stored.CreditCents = 300
+	require.NoError(t, db.UpsertUsage(ctx, conn, stored))
+	stored, err = db.GetUsage(ctx, conn, usage.ID)
+	require.NoError(t, err)
+	require.EqualValues(t, 300, stored.CreditCents)
+	require.EqualValues(t, 2, stored.Version)
+}
+
+func TestUpsertUsage_UniqueWorkspaceInstanceUsage(t *testing.T) {
+	conn := dbtest.ConnectForTests(t)
+	ctx := context.Background()
+
+	attributionID := db.NewTeamAttributionID(uuid.New().String())
+	t.Cleanup(func() {
+		require.NoError(t, conn.Where("attributionId = ?", attributionID).Delete(&db.Usage{}).Error)
+		require.NoError(t, conn.Where("attributionId = ?", attributionID).Delete(&db.CachedBalance{}).Error)
+	})
+
+	usage := dbtest.NewUsage(t, db.Usage{
+		AttributionID: attributionID,
+		Kind:          db.WorkspaceInstanceUsageKind,
+		CreditCents:   100,
+		EffectiveTime: db.NewVarcharTime(time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC)),
+		Draft:         true,
+	})
+	require.NoError(t, db.UpsertUsage(ctx, conn, usage))
+
+	// Usage of the same instance, kind and attribution ID under another ID is rejected.
+	duplicate := usage
+	duplicate.ID = uuid.New()
+	require.Error(t, db.UpsertUsage(ctx, conn, duplicate))
+
+	var count int64
+	require.NoError(t, conn.Model(&db.Usage{}).Where("workspaceInstanceId = ?", usage.WorkspaceInstanceID).Count(&count).Error)
+	require.EqualValues(t, 1, count)
+
+	// Usage of the instance for another attribution ID, e.g. a cost center split, is recorded.
+	split := usage
+	split.ID = uuid.New()
+	split.AttributionID = db.NewUserAttributionID(uuid.New().String())
+	t.Cleanup(func() {
+		require.NoError(t, conn.Where("attributionId = ?", split.AttributionID).Delete(&db.Usage{}).Error)
+		require.NoError(t, conn.Where("attributionId = ?", split.AttributionID).Delete(&db.CachedBalance{}).Error)
+	})
+	require.NoError(t, db.UpsertUsage(ctx, conn, split))
+}
+
 func TestFindAllDraftUsage(t *testing.T) {
 	conn := dbtest.ConnectForTests(t)
 
@@ -271,3 +546,226 @@ func TestCreditCents(t *testing.T) {
 		require.Equal(t, s.expectedAsFloat, cc.ToCredits())
 	}
 }
+
+func TestGetFinalizedWorkspaceUsageByAttribution(t *testing.T) {
+	conn := dbtest.ConnectForTests(t)
+
+	teamA := db.NewTeamAttributionID(uuid.New().String())
+	teamB := db.NewTeamAttributionID(uuid.New().String())
+	start := time.Date(2022, 7, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 1, 0)
+
+	dbtest.CreateUsageRecords(t, conn,
+		dbtest.NewUsage(t, db.Usage{AttributionID: teamA, CreditCents: 100, Kind: db.WorkspaceInstanceUsageKind, EffectiveTime: db.NewVarcharTime(start.Add(time.Hour))}),
+		dbtest.NewUsage(t, db.Usage{AttributionID: teamA, CreditCents: 250, Kind: db.WorkspaceInstanceUsageKind, EffectiveTime: db.NewVarcharTime(start.Add(2 * time.Hour))}),
+		// drafts are not finalized yet
+		dbtest.NewUsage(t, db.Usage{AttributionID: teamA, CreditCents: 1000, Kind: db.WorkspaceInstanceUsageKind, Draft: true, EffectiveTime: db.NewVarcharTime(start.Add(time.Hour))}),
+		// invoices are not workspace usage
+		dbtest.NewUsage(t, db.Usage{AttributionID: teamA, CreditCents: -350, Kind: db.InvoiceUsageKind, EffectiveTime: db.NewVarcharTime(start.Add(time.Hour))}),
+		// outside of the period
+		dbtest.NewUsage(t, db.Usage{AttributionID: teamA, CreditCents: 1000, Kind: db.WorkspaceInstanceUsageKind, EffectiveTime: db.NewVarcharTime(end)}),
+		dbtest.NewUsage(t, db.Usage{AttributionID: teamB, CreditCents: 50, Kind: db.WorkspaceInstanceUsageKind, EffectiveTime: db.NewVarcharTime(start)}),
+	)
+
+	usage, err := db.GetFinalizedWorkspaceUsageByAttribution(context.Background(), conn, start, end)
+	require.NoError(t, err)
+	require.Equal(t, db.CreditCents(350), usage[teamA])
+	require.Equal(t, db.CreditCents(50), usage[teamB])
+
+	usage, err = db.GetWorkspaceUsageByAttribution(context.Background(), conn, start, end)
+	require.NoError(t, err)
+	require.Equal(t, db.CreditCents(1350), usage[teamA], "must include usage of running instances")
+	require.Equal(t, db.CreditCents(50), usage[teamB])
+}
+
+func TestNewVoidingUsage(t *testing.T) {
+	usage := dbtest.NewUsage(t, db.Usage{
+		CreditCents:   1234,
+		EffectiveTime: db.NewVarcharTime(time.Date(2022, 8, 15, 10, 0, 0, 0, time.UTC)),
+	})
+
+	voiding := db.NewVoidingUsage(usage, "duplicate instance")
+	require.Equal(t, db.CreditCents(-1234), voiding.CreditCents)
+	require.Equal(t, usage.EffectiveTime, voiding.EffectiveTime, "must offset the usage in the same period")
+	require.Equal(t, usage.AttributionID, voiding.AttributionID)
+	require.False(t, voiding.Draft)
+	require.Equal(t, voiding.ID, db.NewVoidingUsage(usage, "other reason").ID, "usage must be voided at most once")
+}
+
+func TestNewTransferringUsage(t *testing.T) {
+	usage := dbtest.NewUsage(t, db.Usage{
+		CreditCents:   1234,
+		EffectiveTime: db.NewVarcharTime(time.Date(2022, 8, 15, 10, 0, 0, 0, time.UTC)),
+	})
+	to := db.NewTeamAttributionID(uuid.New().String())
+
+	reversal, transfer := db.NewTransferringUsage(usage, to, "wrong team")
+	require.Equal(t, usage.AttributionID, reversal.AttributionID)
+	require.Equal(t, db.CreditCents(-1234), reversal.CreditCents)
+	require.Equal(t, db.TransferReversalID(usage.ID), reversal.ID)
+	require.Equal(t, to, transfer.AttributionID)
+	require.Equal(t, db.CreditCents(1234), transfer.CreditCents)
+	for _, entry := range []db.Usage{reversal, transfer} {
+		require.Equal(t, usage.EffectiveTime, entry.EffectiveTime, "must move the usage within the same period")
+		require.Equal(t, usage.Kind, entry.Kind)
+		require.False(t, entry.Draft)
+	}
+	require.NotEqual(t, reversal.ID, transfer.ID)
+
+	otherReversal, otherTransfer := db.NewTransferringUsage(usage, db.NewTeamAttributionID(uuid.New().String()), "other reason")
+	require.Equal(t, reversal.ID, otherReversal.ID, "usage must be transferred at most once")
+	require.Equal(t, transfer.ID, otherTransfer.ID)
+}
+
+func TestGetUsage(t *testing.T) {
+	conn := dbtest.ConnectForTests(t)
+
+	records := dbtest.CreateUsageRecords(t, conn, dbtest.NewUsage(t, db.Usage{}))
+
+	usage, err := db.GetUsage(context.Background(), conn, records[0].ID)
+	require.NoError(t, err)
+	require.Equal(t, records[0].ID, usage.ID)
+
+	_, err = db.GetUsage(context.Background(), conn, uuid.New())
+	require.ErrorIs(t, err, db.UsageNotFound)
+}
+
+func TestGetWorkspaceUsageForAttribution(t *testing.T) {
+	conn := dbtest.ConnectForTests(t)
+
+	team := db.NewTeamAttributionID(uuid.New().String())
+	start := time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 1, 0)
+
+	dbtest.CreateUsageRecords(t, conn,
+		dbtest.NewUsage(t, db.Usage{AttributionID: team, CreditCents: 100, EffectiveTime: db.NewVarcharTime(start)}),
+		// running instances count towards the period
+		dbtest.NewUsage(t, db.Usage{AttributionID: team, CreditCents: 50, Draft: true, EffectiveTime: db.NewVarcharTime(start.Add(time.Hour))}),
+		dbtest.NewUsage(t, db.Usage{AttributionID: team, CreditCents: -1000, Kind: db.InvoiceUsageKind, EffectiveTime: db.NewVarcharTime(start.Add(time.Hour))}),
+		dbtest.NewUsage(t, db.Usage{AttributionID: team, CreditCents: 1000, EffectiveTime: db.NewVarcharTime(end)}),
+	)
+
+	creditCents, err := db.GetWorkspaceUsageForAttribution(context.Background(), conn, team, start, end)
+	require.NoError(t, err)
+	require.Equal(t, db.CreditCents(150), creditCents)
+}
+
+func TestGetBalance(t *testing.T) {
+	conn := dbtest.ConnectForTests(t)
+
+	team := db.NewTeamAttributionID(uuid.New().String())
+	otherTeam := db.NewTeamAttributionID(uuid.New().String())
+	start := time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC)
+
+	balance, err := db.GetBalance(context.Background(), conn, team)
+	require.NoError(t, err)
+	require.Equal(t, db.CreditCents(0), balance, "must be zero without any usage")
+
+	dbtest.CreateUsageRecords(t, conn,
+		dbtest.NewUsage(t, db.Usage{AttributionID: team, CreditCents: 1050, EffectiveTime: db.NewVarcharTime(start)}),
+		dbtest.NewUsage(t, db.Usage{AttributionID: team, CreditCents: 25, Draft: true, EffectiveTime: db.NewVarcharTime(start.AddDate(0, 1, 0))}),
+		dbtest.NewUsage(t, db.Usage{AttributionID: team, CreditCents: -1000, Kind: db.InvoiceUsageKind, EffectiveTime: db.NewVarcharTime(start.AddDate(0, 1, 0))}),
+		dbtest.NewUsage(t, db.Usage{AttributionID: team, CreditCents: 0, Kind: db.DisputeUsageKind, EffectiveTime: db.NewVarcharTime(start.AddDate(0, 1, 0))}),
+		dbtest.NewUsage(t, db.Usage{AttributionID: otherTeam, CreditCents: 500, EffectiveTime: db.NewVarcharTime(start)}),
+	)
+
+	balance, err = db.GetBalance(context.Background(), conn, team)
+	require.NoError(t, err)
+	require.Equal(t, db.CreditCents(75), balance)
+}
+
+func TestGetBalance_DatabaseError(t *testing.T) {
+	conn := dbtest.ConnectInMemoryForTests(t)
+	sqlDB, err := conn.DB()
+	require.NoError(t, err)
+	require.NoError(t, sqlDB.Close())
+
+	team := db.NewTeamAttributionID(uuid.New().String())
+	_, err = db.GetBalance(context.Background(), conn, team)
+	require.Error(t, err, "must return an error instead of panicking")
+
+	_, err = db.GetUsageSummary(context.Background(), conn, team, time.Now().Add(-time.Hour), time.Now(), false)
+	require.Error(t, err)
+}
+
+func TestGetWorkspaceUsageByProject(t *testing.T) {
+	conn := dbtest.ConnectForTests(t)
+
+	team := db.NewTeamAttributionID(uuid.New().String())
+	start := time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 1, 0)
+
+	dbtest.CreateUsageRecords(t, conn,
+		dbtest.NewUsage(t, db.Usage{AttributionID: team, ProjectID: "project-a", CreditCents: 100, EffectiveTime: db.NewVarcharTime(start)}),
+		dbtest.NewUsage(t, db.Usage{AttributionID: team, ProjectID: "project-a", CreditCents: 50, Draft: true, EffectiveTime: db.NewVarcharTime(start.Add(time.Hour))}),
+		dbtest.NewUsage(t, db.Usage{AttributionID: team, ProjectID: "project-b", CreditCents: 25, EffectiveTime: db.NewVarcharTime(start.Add(time.Hour))}),
+		dbtest.NewUsage(t, db.Usage{AttributionID: team, CreditCents: 10, EffectiveTime: db.NewVarcharTime(start.Add(time.Hour))}),
+		dbtest.NewUsage(t, db.Usage{AttributionID: team, ProjectID: "project-a", CreditCents: 1000, EffectiveTime: db.NewVarcharTime(end)}),
+	)
+
+	usage, err := db.GetWorkspaceUsageByProject(context.Background(), conn, team, start, end)
+	require.NoError(t, err)
+	require.Equal(t, map[string]db.CreditCents{
+		"project-a": 150,
+		"project-b": 25,
+		"":          10,
+	}, usage)
+}
+
+func TestFindWorkspaceInstanceUsage(t *testing.T) {
+	conn := dbtest.ConnectForTests(t)
+	instanceID := uuid.New()
+
+	usage := dbtest.CreateUsageRecords(t, conn,
+		dbtest.NewUsage(t, db.Usage{WorkspaceInstanceID: instanceID}),
+		dbtest.NewUsage(t, db.Usage{WorkspaceInstanceID: instanceID, Draft: true}),
+		dbtest.NewUsage(t, db.Usage{WorkspaceInstanceID: instanceID, Kind: db.InvoiceUsageKind}),
+		dbtest.NewUsage(t, db.Usage{}),
+	)
+
+	found, err := db.FindWorkspaceInstanceUsage(context.Background(), conn, []uuid.UUID{instanceID})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []uuid.UUID{usage[0].ID, usage[1].ID}, []uuid.UUID{found[0].ID, found[1].ID})
+	require.Len(t, found, 2, "only workspace usage of the instance must be found")
+}
+
+func TestReencryptUsageMetadata(t *testing.T) {
+	conn := dbtest.ConnectForTests(t)
+	ctx := context.Background()
+	attributionID := db.NewTeamAttributionID(uuid.New().String())
+	t.Cleanup(func() {
+		require.NoError(t, conn.Where("attributionId = ?", attributionID).Delete(&db.Usage{}).Error)
+	})
+
+	usage := dbtest.NewUsage(t, db.Usage{AttributionID: attributionID})
+	require.NoError(t, usage.SetMetadataWithWorkspaceInstance(db.WorkspaceInstanceUsageData{
+		WorkspaceClass: "default",
+		UserName:       "alice",
+		ContextURL:     "https://github.com/gitpod-io/gitpod",
+	}))
+	dbtest.CreateUsageRecords(t, conn, usage)
+
+	c, err := db.NewMetadataCipher(map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)}, "k1")
+	require.NoError(t, err)
+	reencrypted, err := db.ReencryptUsageMetadata(ctx, conn, c)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, reencrypted, int64(1))
+
+	stored, err := db.GetUsage(ctx, conn, usage.ID)
+	require.NoError(t, err)
+	require.NotContains(t, string(stored.Metadata), "alice")
+	require.Equal(t, usage.Version+1, stored.Version)
+
+	decrypted, err := c.Decrypt(stored.Metadata)
+	require.NoError(t, err)
+	data, err := (&db.Usage{Metadata: decrypted}).GetMetadataAsWorkspaceInstanceData()
+	require.NoError(t, err)
+	require.Equal(t, "alice", data.UserName)
+	require.Equal(t, "default", data.WorkspaceClass)
+
+	_, err = db.ReencryptUsageMetadata(ctx, conn, c)
+	require.NoError(t, err)
+	stored, err = db.GetUsage(ctx, conn, usage.ID)
+	require.NoError(t, err)
+	require.Equal(t, usage.Version+1, stored.Version, "encrypted metadata must not be written again")
+}
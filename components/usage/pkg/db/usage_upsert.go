@@ -0,0 +1,174 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// usageUpsertBatchSize bounds the number of placeholders of a batched upsert, which MySQL limits to 65535.
+const usageUpsertBatchSize = 500
+
+// usageUpsertColumns are the columns which UpsertUsage inserts. The effective time and the version are updated
+// separately, and the soft-deletion time is never overwritten.
+var usageUpsertColumns = []string{"id", "attributionId", "description", "creditCents", "effectiveTime", "kind", "workspaceInstanceId", "projectId", "draft", "metadata", "softDeletedTime", "version"}
+
+// usageUpsertUpdatedColumns are the columns which UpsertUsage updates to the values of the records.
+var usageUpsertUpdatedColumns = []string{"attributionId", "description", "creditCents", "kind", "workspaceInstanceId", "projectId", "draft", "metadata"}
+
+// UpsertUsage inserts the usage records which do not exist yet, and updates the existing ones, with a single
+// INSERT ... ON DUPLICATE KEY UPDATE statement per batch. Cached balances of the attribution IDs, and their daily
+// summaries of the affected days, are invalidated in the same transaction. The transaction is retried on deadlocks, see
+// WithRetryableTx.
+//
+// Unique keys of the partitioned table must include the effective time, which changes on every reconciliation of a
+// draft. Records are therefore keyed by UsageKey, which is unique on the ID, and on the workspace instance, kind and
+// attribution ID: usage of a workspace instance is split across attribution IDs. Existing records are read with a
+// locking read first, such that the statement addresses them by their current effective time, and moves them to their
+// new one. Records which do not exist are claimed as UsageKey, which fails the transaction rather than duplicating a
+// record which a concurrent transaction inserted.
+//
+// Existing records are only updated when their version is still the version of the record, and their version is
+// incremented. Otherwise, no record is written and UsageVersionConflict is returned.
+func UpsertUsage(ctx context.Context, conn *gorm.DB, records ...Usage) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	return WithRetryableTx(ctx, conn, func(tx *gorm.DB) error {
+		for start := 0; start < len(records); start += usageUpsertBatchSize {
+			end := start + usageUpsertBatchSize
+			if end > len(records) {
+				end = len(records)
+			}
+			batch := records[start:end]
+
+			var existingRecords []Usage
+			err := tx.Model(&Usage{}).
+				Clauses(clause.Locking{Strength: "UPDATE"}).
+				Select("id", "attributionId", "effectiveTime", "draft").
+				Where("id IN ?", usageIDs(batch)).
+				Find(&existingRecords).Error
+			if err != nil {
+				return fmt.Errorf("failed to find existing usage records: %w", err)
+			}
+			existing := map[uuid.UUID]VarcharTime{}
+			for _, record := range existingRecords {
+				existing[record.ID] = record.EffectiveTime
+			}
+
+			// Both the previous and the new values of updated records may be part of a daily summary.
+			err = invalidateSummarizedDays(ctx, tx, append(existingRecords, batch...))
+			if err != nil {
+				return err
+			}
+
+			var inserts []Usage
+			for _, record := range batch {
+				if _, ok := existing[record.ID]; !ok {
+					inserts = append(inserts, record)
+				}
+			}
+			// The IDs of records which do not exist may still have been claimed by archived or purged usage.
+			claimed, err := claimUsageIDs(tx, inserts, true)
+			if err != nil {
+				return err
+			}
+			if len(claimed) != len(inserts) {
+				return fmt.Errorf("claimed %d of %d usage IDs: %w", len(claimed), len(inserts), UsageAlreadyExists)
+			}
+
+			// The upsert is raw SQL, which the MetadataEncryption plugin does not see.
+			if metadataCipher := metadataCipherOf(tx); metadataCipher != nil {
+				batch, err = encryptUsageMetadata(metadataCipher, batch)
+				if err != nil {
+					return err
+				}
+			}
+			query, args := usageBatchUpsert(batch, existing)
+			result := tx.Exec(query, args...)
+			if result.Error != nil {
+				return fmt.Errorf("failed to upsert %d usage records: %w", len(batch), result.Error)
+			}
+			// MySQL counts an inserted row once, and an updated row twice.
+			updates := len(batch) - len(inserts)
+			if result.RowsAffected != int64(len(inserts)+2*updates) {
+				return fmt.Errorf("upserted %d usage records, expected %d inserts and %d updates: %w", result.RowsAffected, len(inserts), updates, UsageVersionConflict)
+			}
+		}
+
+		return InvalidateCachedBalances(ctx, tx, attributionIDsOf(records)...)
+	})
+}
+
+// usageBatchUpsert builds a single INSERT ... ON DUPLICATE KEY UPDATE statement for the records. Existing records are
+// inserted with their current effective time, such that they conflict with their row, and the row is updated to the
+// values of the record when its version is still the version of the record.
+func usageBatchUpsert(records []Usage, existing map[uuid.UUID]VarcharTime) (string, []interface{}) {
+	columns := make([]string, 0, len(usageUpsertColumns))
+	for _, column := range usageUpsertColumns {
+		columns = append(columns, fmt.Sprintf("`%s`", column))
+	}
+	row := fmt.Sprintf("(%s)", strings.TrimSuffix(strings.Repeat("?, ", len(usageUpsertColumns)), ", "))
+
+	var args []interface{}
+	rows := make([]string, 0, len(records))
+	var effectiveTimes strings.Builder
+	var effectiveTimeArgs []interface{}
+	for _, record := range records {
+		effectiveTime := record.EffectiveTime
+		if current, ok := existing[record.ID]; ok {
+			effectiveTime = current
+			effectiveTimes.WriteString(" WHEN ? THEN ?")
+			effectiveTimeArgs = append(effectiveTimeArgs, record.ID.String(), record.EffectiveTime)
+		}
+		rows = append(rows, row)
+		args = append(args, record.ID.String(), record.AttributionID, record.Description, record.CreditCents, effectiveTime, record.Kind, record.WorkspaceInstanceID, record.ProjectID, record.Draft, record.Metadata, record.SoftDeletedTime, record.Version)
+	}
+
+	const versionMatches = "`version` = VALUES(`version`)"
+	var assignments []string
+	for _, column := range usageUpsertUpdatedColumns {
+		assignments = append(assignments, fmt.Sprintf("`%[1]s` = IF(%[2]s, VALUES(`%[1]s`), `%[1]s`)", column, versionMatches))
+	}
+	if effectiveTimes.Len() > 0 {
+		assignments = append(assignments, fmt.Sprintf("`effectiveTime` = IF(%s, CASE `id`%s END, `effectiveTime`)", versionMatches, effectiveTimes.String()))
+		args = append(args, effectiveTimeArgs...)
+	}
+	// The version is assigned last, assignments are evaluated in order and compare the previous version.
+	assignments = append(assignments, fmt.Sprintf("`version` = IF(%s, `version` + 1, `version`)", versionMatches))
+
+	query := fmt.Sprintf("INSERT INTO `%s` (%s) VALUES %s ON DUPLICATE KEY UPDATE %s",
+		(&Usage{}).TableName(), strings.Join(columns, ", "), strings.Join(rows, ", "), strings.Join(assignments, ", "))
+	return query, args
+}
+
+func usageIDs(records []Usage) []string {
+	ids := make([]string, 0, len(records))
+	for _, record := range records {
+		ids = append(ids, record.ID.String())
+	}
+	return ids
+}
+
+// encryptUsageMetadata returns copies of the records with encrypted metadata.
+func encryptUsageMetadata(c *MetadataCipher, records []Usage) ([]Usage, error) {
+	encrypted := make([]Usage, 0, len(records))
+	for _, record := range records {
+		metadata, err := c.Encrypt(record.Metadata)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt metadata of usage %s: %w", record.ID, err)
+		}
+		record.Metadata = metadata
+		encrypted = append(encrypted, record)
+	}
+	return encrypted, nil
+}
@@ -0,0 +1,39 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsageBatchUpsert(t *testing.T) {
+	previous := NewVarcharTime(time.Date(2022, 9, 30, 0, 0, 0, 0, time.UTC))
+	updated := Usage{ID: uuid.New(), CreditCents: 100, EffectiveTime: NewVarcharTime(time.Date(2022, 10, 2, 0, 0, 0, 0, time.UTC)), Version: 3}
+	inserted := Usage{ID: uuid.New(), CreditCents: 200, EffectiveTime: NewVarcharTime(time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC))}
+
+	query, args := usageBatchUpsert([]Usage{updated, inserted}, map[uuid.UUID]VarcharTime{updated.ID: previous})
+	require.True(t, strings.HasPrefix(query, "INSERT INTO `d_b_usage` (`id`, `attributionId`, "))
+	require.Contains(t, query, "ON DUPLICATE KEY UPDATE `attributionId` = IF(`version` = VALUES(`version`), VALUES(`attributionId`), `attributionId`)")
+	require.Contains(t, query, "`effectiveTime` = IF(`version` = VALUES(`version`), CASE `id` WHEN ? THEN ? END, `effectiveTime`)")
+	require.True(t, strings.HasSuffix(query, "`version` = IF(`version` = VALUES(`version`), `version` + 1, `version`)"))
+	require.Equal(t, 2*len(usageUpsertColumns)+2, len(args))
+	require.Equal(t, strings.Count(query, "?"), len(args))
+
+	// Existing records are inserted with their current effective time, and moved to their new one.
+	effectiveTime := 4
+	require.Equal(t, previous, args[effectiveTime])
+	require.Equal(t, inserted.EffectiveTime, args[len(usageUpsertColumns)+effectiveTime])
+	require.Equal(t, []interface{}{updated.ID.String(), updated.EffectiveTime}, args[len(args)-2:])
+
+	// Without existing records, the effective time is not updated.
+	query, args = usageBatchUpsert([]Usage{inserted}, nil)
+	require.NotContains(t, query, "CASE")
+	require.Equal(t, len(usageUpsertColumns), len(args))
+}
@@ -0,0 +1,201 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var UsageWebhookNotFound = errors.New("Usage webhook not found")
+
+// UsageWebhook is an endpoint which the owner of an attribution ID registered to receive the usage events of the
+// attribution ID.
+type UsageWebhook struct {
+	ID            uuid.UUID     `gorm:"primary_key;column:id;type:char;size:36;" json:"id"`
+	AttributionID AttributionID `gorm:"column:attributionId;type:varchar;size:255;" json:"attributionId"`
+	URL           string        `gorm:"column:url;type:varchar;size:2048;" json:"url"`
+	// Secret signs the requests to the endpoint. It is only returned to the owner when the webhook is created.
+	Secret       string      `gorm:"column:secret;type:varchar;size:255;" json:"-"`
+	CreationTime VarcharTime `gorm:"column:creationTime;type:varchar;size:255;" json:"creationTime"`
+}
+
+// TableName sets the insert table name for this struct type
+func (w *UsageWebhook) TableName() string {
+	return "d_b_usage_webhook"
+}
+
+func CreateUsageWebhook(ctx context.Context, conn *gorm.DB, webhook UsageWebhook) error {
+	result := conn.WithContext(ctx).Create(&webhook)
+	if result.Error != nil {
+		return fmt.Errorf("failed to create usage webhook for %s: %w", webhook.AttributionID, result.Error)
+	}
+	return nil
+}
+
+// ListUsageWebhooks lists the webhooks of the attribution ID, oldest first.
+func ListUsageWebhooks(ctx context.Context, conn *gorm.DB, attributionID AttributionID) ([]UsageWebhook, error) {
+	var webhooks []UsageWebhook
+	result := conn.WithContext(ctx).
+		Where("attributionId = ?", attributionID).
+		Order("creationTime, id").
+		Find(&webhooks)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list usage webhooks of %s: %w", attributionID, result.Error)
+	}
+	return webhooks, nil
+}
+
+// FindUsageWebhooks returns the webhooks with the IDs by ID. IDs of deleted webhooks are missing.
+func FindUsageWebhooks(ctx context.Context, conn *gorm.DB, ids []uuid.UUID) (map[uuid.UUID]UsageWebhook, error) {
+	result := map[uuid.UUID]UsageWebhook{}
+	if len(ids) == 0 {
+		return result, nil
+	}
+
+	var webhooks []UsageWebhook
+	err := conn.WithContext(ctx).Where("id IN ?", ids).Find(&webhooks).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find usage webhooks: %w", err)
+	}
+	for _, webhook := range webhooks {
+		result[webhook.ID] = webhook
+	}
+	return result, nil
+}
+
+// ListUsageWebhookAttributionIDs lists the attribution IDs which have at least one webhook, in order.
+func ListUsageWebhookAttributionIDs(ctx context.Context, conn *gorm.DB) ([]AttributionID, error) {
+	var attributionIDs []AttributionID
+	err := conn.WithContext(ctx).
+		Model(&UsageWebhook{}).
+		Distinct("attributionId").
+		Order("attributionId").
+		Pluck("attributionId", &attributionIDs).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list attribution IDs with usage webhooks: %w", err)
+	}
+	return attributionIDs, nil
+}
+
+// DeleteUsageWebhook deletes the webhook of the attribution ID, and its pending deliveries.
+func DeleteUsageWebhook(ctx context.Context, conn *gorm.DB, attributionID AttributionID, id uuid.UUID) error {
+	return conn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND attributionId = ?", id.String(), attributionID).Delete(&UsageWebhook{})
+		if result.Error != nil {
+			return fmt.Errorf("failed to delete usage webhook %s: %w", id, result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return UsageWebhookNotFound
+		}
+
+		err := tx.Where("webhookId = ? AND deliveredTime = '' AND failedTime = ''", id.String()).Delete(&UsageWebhookDelivery{}).Error
+		if err != nil {
+			return fmt.Errorf("failed to delete pending deliveries of usage webhook %s: %w", id, err)
+		}
+		return nil
+	})
+}
+
+// UsageWebhookDelivery is an event which is delivered to a usage webhook. Failed deliveries are retried at
+// NextAttemptTime, until they are delivered or given up.
+type UsageWebhookDelivery struct {
+	ID        uuid.UUID      `gorm:"primary_key;column:id;type:char;size:36;" json:"id"`
+	WebhookID uuid.UUID      `gorm:"column:webhookId;type:char;size:36;" json:"webhookId"`
+	Event     string         `gorm:"column:event;type:varchar;size:255;" json:"event"`
+	Payload   datatypes.JSON `gorm:"column:payload;type:text;size:65535" json:"payload"`
+
+	Attempts        int         `gorm:"column:attempts;type:int;" json:"attempts"`
+	NextAttemptTime VarcharTime `gorm:"column:nextAttemptTime;type:varchar;size:255;" json:"nextAttemptTime"`
+	// LastError is the error of the last failed attempt.
+	LastError     string      `gorm:"column:lastError;type:varchar;size:255;" json:"lastError"`
+	DeliveredTime VarcharTime `gorm:"column:deliveredTime;type:varchar;size:255;" json:"deliveredTime"`
+	// FailedTime is set when the delivery was given up.
+	FailedTime   VarcharTime `gorm:"column:failedTime;type:varchar;size:255;" json:"failedTime"`
+	CreationTime VarcharTime `gorm:"column:creationTime;type:varchar;size:255;" json:"creationTime"`
+}
+
+// TableName sets the insert table name for this struct type
+func (d *UsageWebhookDelivery) TableName() string {
+	return "d_b_usage_webhook_delivery"
+}
+
+// UsageWebhookDeliveryID identifies the delivery of an event to a webhook. The key distinguishes occurrences of the
+// same event, e.g. the day of a summary, such that every occurrence is delivered at most once.
+func UsageWebhookDeliveryID(webhookID uuid.UUID, event, key string) uuid.UUID {
+	return uuid.NewSHA1(webhookID, []byte(fmt.Sprintf("%s/%s", event, key)))
+}
+
+// EnqueueUsageWebhookDeliveries schedules the delivery of the event to every webhook of the attribution ID, and returns
+// how many deliveries were scheduled. Occurrences of the event which were scheduled before are skipped.
+func EnqueueUsageWebhookDeliveries(ctx context.Context, conn *gorm.DB, attributionID AttributionID, event, key string, payload []byte, now time.Time) (int64, error) {
+	webhooks, err := ListUsageWebhooks(ctx, conn, attributionID)
+	if err != nil {
+		return 0, err
+	}
+	if len(webhooks) == 0 {
+		return 0, nil
+	}
+
+	var deliveries []UsageWebhookDelivery
+	for _, webhook := range webhooks {
+		deliveries = append(deliveries, UsageWebhookDelivery{
+			ID:              UsageWebhookDeliveryID(webhook.ID, event, key),
+			WebhookID:       webhook.ID,
+			Event:           event,
+			Payload:         payload,
+			NextAttemptTime: NewVarcharTime(now),
+			CreationTime:    NewVarcharTime(now),
+		})
+	}
+	result := conn.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&deliveries)
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to enqueue %s deliveries for %s: %w", event, attributionID, result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// FindDueUsageWebhookDeliveries returns up to `limit` pending deliveries whose next attempt is due at `now`, the most
+// overdue first.
+func FindDueUsageWebhookDeliveries(ctx context.Context, conn *gorm.DB, now time.Time, limit int) ([]UsageWebhookDelivery, error) {
+	var deliveries []UsageWebhookDelivery
+	result := conn.WithContext(ctx).
+		Where("deliveredTime = '' AND failedTime = ''").
+		Where("nextAttemptTime <= ?", TimeToISO8601(now)).
+		Order("nextAttemptTime, id").
+		Limit(limit).
+		Find(&deliveries)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to find due usage webhook deliveries: %w", result.Error)
+	}
+	return deliveries, nil
+}
+
+// UpdateUsageWebhookDelivery stores the outcome of an attempt to deliver.
+func UpdateUsageWebhookDelivery(ctx context.Context, conn *gorm.DB, delivery UsageWebhookDelivery) error {
+	result := conn.WithContext(ctx).
+		Model(&UsageWebhookDelivery{}).
+		Where("id = ?", delivery.ID.String()).
+		Updates(map[string]interface{}{
+			"attempts":        delivery.Attempts,
+			"nextAttemptTime": delivery.NextAttemptTime,
+			"lastError":       delivery.LastError,
+			"deliveredTime":   delivery.DeliveredTime,
+			"failedTime":      delivery.FailedTime,
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to update usage webhook delivery %s: %w", delivery.ID, result.Error)
+	}
+	return nil
+}
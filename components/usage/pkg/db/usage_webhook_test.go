@@ -0,0 +1,106 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/db/dbtest"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsageWebhooks(t *testing.T) {
+	conn := dbtest.ConnectInMemoryForTests(t)
+	ctx := context.Background()
+	now := time.Date(2022, 10, 12, 8, 0, 0, 0, time.UTC)
+	teamA := db.NewTeamAttributionID(uuid.New().String())
+	teamB := db.NewTeamAttributionID(uuid.New().String())
+
+	first := db.UsageWebhook{ID: uuid.New(), AttributionID: teamA, URL: "https://a.example.com/1", Secret: "s1", CreationTime: db.NewVarcharTime(now)}
+	second := db.UsageWebhook{ID: uuid.New(), AttributionID: teamA, URL: "https://a.example.com/2", Secret: "s2", CreationTime: db.NewVarcharTime(now.Add(time.Minute))}
+	other := db.UsageWebhook{ID: uuid.New(), AttributionID: teamB, URL: "https://b.example.com", Secret: "s3", CreationTime: db.NewVarcharTime(now)}
+	for _, webhook := range []db.UsageWebhook{second, first, other} {
+		require.NoError(t, db.CreateUsageWebhook(ctx, conn, webhook))
+	}
+
+	webhooks, err := db.ListUsageWebhooks(ctx, conn, teamA)
+	require.NoError(t, err)
+	require.Len(t, webhooks, 2)
+	require.Equal(t, first.ID, webhooks[0].ID)
+	require.Equal(t, "s1", webhooks[0].Secret)
+	require.Equal(t, second.ID, webhooks[1].ID)
+
+	attributionIDs, err := db.ListUsageWebhookAttributionIDs(ctx, conn)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []db.AttributionID{teamA, teamB}, attributionIDs)
+
+	found, err := db.FindUsageWebhooks(ctx, conn, []uuid.UUID{first.ID, other.ID, uuid.New()})
+	require.NoError(t, err)
+	require.Len(t, found, 2)
+	require.Equal(t, other.URL, found[other.ID].URL)
+
+	require.ErrorIs(t, db.DeleteUsageWebhook(ctx, conn, teamB, first.ID), db.UsageWebhookNotFound, "must only delete webhooks of the attribution ID")
+	require.NoError(t, db.DeleteUsageWebhook(ctx, conn, teamA, first.ID))
+	webhooks, err = db.ListUsageWebhooks(ctx, conn, teamA)
+	require.NoError(t, err)
+	require.Len(t, webhooks, 1)
+}
+
+func TestUsageWebhookDeliveries(t *testing.T) {
+	conn := dbtest.ConnectInMemoryForTests(t)
+	ctx := context.Background()
+	now := time.Date(2022, 10, 12, 8, 0, 0, 0, time.UTC)
+	teamA := db.NewTeamAttributionID(uuid.New().String())
+
+	webhook := db.UsageWebhook{ID: uuid.New(), AttributionID: teamA, URL: "https://a.example.com", Secret: "s1", CreationTime: db.NewVarcharTime(now)}
+	require.NoError(t, db.CreateUsageWebhook(ctx, conn, webhook))
+
+	enqueued, err := db.EnqueueUsageWebhookDeliveries(ctx, conn, db.NewTeamAttributionID(uuid.New().String()), "usage.daily_summary", "2022-10-11", []byte(`{}`), now)
+	require.NoError(t, err)
+	require.Zero(t, enqueued, "attribution IDs without webhooks must not enqueue deliveries")
+
+	enqueued, err = db.EnqueueUsageWebhookDeliveries(ctx, conn, teamA, "usage.daily_summary", "2022-10-11", []byte(`{"day": "2022-10-11"}`), now)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), enqueued)
+	enqueued, err = db.EnqueueUsageWebhookDeliveries(ctx, conn, teamA, "usage.daily_summary", "2022-10-11", []byte(`{"day": "2022-10-11"}`), now)
+	require.NoError(t, err)
+	require.Zero(t, enqueued, "must enqueue every occurrence of an event at most once")
+
+	due, err := db.FindDueUsageWebhookDeliveries(ctx, conn, now.Add(-time.Second), 10)
+	require.NoError(t, err)
+	require.Empty(t, due)
+	due, err = db.FindDueUsageWebhookDeliveries(ctx, conn, now, 10)
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+	delivery := due[0]
+	require.Equal(t, db.UsageWebhookDeliveryID(webhook.ID, "usage.daily_summary", "2022-10-11"), delivery.ID)
+	require.JSONEq(t, `{"day": "2022-10-11"}`, string(delivery.Payload))
+
+	delivery.Attempts = 1
+	delivery.LastError = "webhook returned unexpected status code: 503"
+	delivery.NextAttemptTime = db.NewVarcharTime(now.Add(time.Minute))
+	require.NoError(t, db.UpdateUsageWebhookDelivery(ctx, conn, delivery))
+	due, err = db.FindDueUsageWebhookDeliveries(ctx, conn, now, 10)
+	require.NoError(t, err)
+	require.Empty(t, due, "failed deliveries must wait for their next attempt")
+
+	delivery.Attempts = 2
+	delivery.DeliveredTime = db.NewVarcharTime(now.Add(time.Minute))
+	require.NoError(t, db.UpdateUsageWebhookDelivery(ctx, conn, delivery))
+	due, err = db.FindDueUsageWebhookDeliveries(ctx, conn, now.Add(time.Hour), 10)
+	require.NoError(t, err)
+	require.Empty(t, due, "delivered deliveries must not be delivered again")
+
+	_, err = db.EnqueueUsageWebhookDeliveries(ctx, conn, teamA, "spending_limit.reached", "2022-10-01", []byte(`{}`), now)
+	require.NoError(t, err)
+	require.NoError(t, db.DeleteUsageWebhook(ctx, conn, teamA, webhook.ID))
+	due, err = db.FindDueUsageWebhookDeliveries(ctx, conn, now.Add(time.Hour), 10)
+	require.NoError(t, err)
+	require.Empty(t, due, "pending deliveries of deleted webhooks must be deleted")
+}
@@ -0,0 +1,295 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gitpod-io/gitpod/common-go/log"
+	"github.com/gitpod-io/gitpod/common-go/util"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultUsageWriteBatchSize     = 500
+	DefaultUsageWriteFlushInterval = 5 * time.Second
+)
+
+var (
+	// UsageWriteQueueFull is returned when a UsageWriteQueue holds its maximum number of pending records. Callers can
+	// write the usage with UpsertUsage instead, or retry later.
+	UsageWriteQueueFull = errors.New("Usage write queue is full")
+	// UsageWriteQueueClosed is returned when usage is enqueued after the UsageWriteQueue was closed.
+	UsageWriteQueueClosed = errors.New("Usage write queue is closed")
+)
+
+type UsageWriteQueueConfig struct {
+	// BatchSize is the number of pending records at which the queue is flushed, and the number of records written per
+	// transaction. When BatchSize is 0, DefaultUsageWriteBatchSize applies.
+	BatchSize int `json:"batchSize,omitempty"`
+
+	// FlushInterval is how long records are pending at most, unless writing them fails. When FlushInterval is 0,
+	// DefaultUsageWriteFlushInterval applies.
+	FlushInterval util.Duration `json:"flushInterval,omitempty"`
+
+	// MaxPending bounds the number of records held in memory, for example while the database is unavailable. When
+	// MaxPending is 0, ten batches can be pending.
+	MaxPending int `json:"maxPending,omitempty"`
+}
+
+func (c UsageWriteQueueConfig) Validate() error {
+	if c.BatchSize < 0 {
+		return fmt.Errorf("batch size must not be negative, was %d", c.BatchSize)
+	}
+	if c.FlushInterval < 0 {
+		return fmt.Errorf("flush interval must not be negative, was %s", time.Duration(c.FlushInterval))
+	}
+	if c.MaxPending < 0 {
+		return fmt.Errorf("max pending must not be negative, was %d", c.MaxPending)
+	}
+	if c.MaxPending > 0 && c.MaxPending < c.BatchSize {
+		return fmt.Errorf("max pending (%d) must not be less than the batch size (%d)", c.MaxPending, c.BatchSize)
+	}
+	return nil
+}
+
+// UsageWriteQueue buffers incremental usage updates, and writes them in batches with UpsertUsage. Updates of the same
+// usage which are pending together are coalesced, only the last one is written.
+//
+// Records are written with the version check of UpsertUsage. Records whose version changed since they were read are
+// dropped, the next reconciliation writes their usage from the workspace instances.
+type UsageWriteQueue struct {
+	conn          *gorm.DB
+	batchSize     int
+	flushInterval time.Duration
+	maxPending    int
+
+	mu      sync.Mutex
+	pending map[uuid.UUID]Usage
+	// order holds the IDs of the pending records, in the order in which they were first enqueued.
+	order  []uuid.UUID
+	closed bool
+
+	// flushMu ensures that pending records are written by a single flush at a time.
+	flushMu sync.Mutex
+
+	wake chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewUsageWriteQueue(conn *gorm.DB, cfg UsageWriteQueueConfig) (*UsageWriteQueue, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid usage write queue config: %w", err)
+	}
+
+	q := &UsageWriteQueue{
+		conn:          conn,
+		batchSize:     cfg.BatchSize,
+		flushInterval: time.Duration(cfg.FlushInterval),
+		maxPending:    cfg.MaxPending,
+		pending:       map[uuid.UUID]Usage{},
+		wake:          make(chan struct{}, 1),
+		stop:          make(chan struct{}),
+	}
+	if q.batchSize == 0 {
+		q.batchSize = DefaultUsageWriteBatchSize
+	}
+	if q.flushInterval == 0 {
+		q.flushInterval = DefaultUsageWriteFlushInterval
+	}
+	if q.maxPending == 0 {
+		q.maxPending = 10 * q.batchSize
+	}
+	return q, nil
+}
+
+// Start flushes the queue in the background, every flush interval and whenever a batch is pending.
+func (q *UsageWriteQueue) Start() {
+	q.done = make(chan struct{})
+
+	go func() {
+		defer close(q.done)
+
+		ticker := time.NewTicker(q.flushInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-q.stop:
+				return
+			case <-ticker.C:
+			case <-q.wake:
+			}
+
+			err := q.Flush(WithCaller(context.Background(), "usage_write_queue"))
+			if err != nil {
+				log.WithError(err).Error("Failed to flush usage write queue, retrying with the next flush.")
+			}
+		}
+	}()
+}
+
+// Enqueue adds the records to the queue. Either all records are enqueued, or none is.
+func (q *UsageWriteQueue) Enqueue(records ...Usage) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return UsageWriteQueueClosed
+	}
+
+	added := map[uuid.UUID]bool{}
+	for _, record := range records {
+		if _, ok := q.pending[record.ID]; !ok {
+			added[record.ID] = true
+		}
+	}
+	if len(q.pending)+len(added) > q.maxPending {
+		return UsageWriteQueueFull
+	}
+
+	for _, record := range records {
+		if _, ok := q.pending[record.ID]; !ok {
+			q.order = append(q.order, record.ID)
+		}
+		q.pending[record.ID] = record
+	}
+	usageWriteQueuePending.Set(float64(len(q.pending)))
+
+	if len(q.pending) >= q.batchSize {
+		select {
+		case q.wake <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Pending returns the number of records which are not written yet.
+func (q *UsageWriteQueue) Pending() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.pending)
+}
+
+// Flush writes all pending records, one batch per transaction. When writing a batch fails, its records stay pending,
+// unless they were updated again in the meantime.
+func (q *UsageWriteQueue) Flush(ctx context.Context) error {
+	q.flushMu.Lock()
+	defer q.flushMu.Unlock()
+
+	for {
+		batch := q.take()
+		if len(batch) == 0 {
+			return nil
+		}
+
+		unwritten, err := q.write(ctx, batch)
+		if err != nil {
+			q.requeue(unwritten)
+			return err
+		}
+	}
+}
+
+// Close stops flushing in the background, and writes the pending records. Records enqueued afterwards are rejected.
+func (q *UsageWriteQueue) Close(ctx context.Context) error {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return nil
+	}
+	q.closed = true
+	q.mu.Unlock()
+
+	close(q.stop)
+	if q.done != nil {
+		select {
+		case <-q.done:
+		case <-ctx.Done():
+			return fmt.Errorf("failed to stop usage write queue: %w", ctx.Err())
+		}
+	}
+
+	err := q.Flush(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to flush %d pending usage records on close: %w", q.Pending(), err)
+	}
+	return nil
+}
+
+// take removes the next batch from the pending records.
+func (q *UsageWriteQueue) take() []Usage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	n := q.batchSize
+	if n > len(q.order) {
+		n = len(q.order)
+	}
+	batch := make([]Usage, 0, n)
+	for _, id := range q.order[:n] {
+		batch = append(batch, q.pending[id])
+		delete(q.pending, id)
+	}
+	q.order = q.order[n:]
+	usageWriteQueuePending.Set(float64(len(q.pending)))
+	return batch
+}
+
+// requeue adds the records of a failed batch back to the front of the queue. Records which were enqueued again while
+// the batch was written are superseded, and not requeued.
+func (q *UsageWriteQueue) requeue(batch []Usage) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var order []uuid.UUID
+	for _, record := range batch {
+		if _, ok := q.pending[record.ID]; ok {
+			continue
+		}
+		q.pending[record.ID] = record
+		order = append(order, record.ID)
+	}
+	q.order = append(order, q.order...)
+	usageWriteQueuePending.Set(float64(len(q.pending)))
+}
+
+// write upserts the batch, and returns the records which were not written when it fails. On a version conflict, the
+// records are written one by one, such that only the conflicting records are dropped.
+func (q *UsageWriteQueue) write(ctx context.Context, batch []Usage) ([]Usage, error) {
+	err := UpsertUsage(ctx, q.conn, batch...)
+	if err == nil {
+		usageWriteQueueWritesTotal.WithLabelValues("written").Add(float64(len(batch)))
+		return nil, nil
+	}
+	if !errors.Is(err, UsageVersionConflict) {
+		usageWriteQueueWritesTotal.WithLabelValues("failed").Add(float64(len(batch)))
+		return batch, fmt.Errorf("failed to write %d usage records: %w", len(batch), err)
+	}
+
+	for i, record := range batch {
+		err := UpsertUsage(ctx, q.conn, record)
+		if errors.Is(err, UsageVersionConflict) {
+			log.WithField("usage_id", record.ID).Warn("Usage was updated concurrently, dropping queued update.")
+			usageWriteQueueWritesTotal.WithLabelValues("conflict").Inc()
+			continue
+		}
+		if err != nil {
+			usageWriteQueueWritesTotal.WithLabelValues("failed").Add(float64(len(batch) - i))
+			return batch[i:], fmt.Errorf("failed to write usage record %s: %w", record.ID, err)
+		}
+		usageWriteQueueWritesTotal.WithLabelValues("written").Inc()
+	}
+	return nil, nil
+}
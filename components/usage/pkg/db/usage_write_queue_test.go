@@ -0,0 +1,143 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package db_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gitpod-io/gitpod/common-go/util"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/db/dbtest"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestUsageWriteQueue_FlushCoalescesUpdates(t *testing.T) {
+	conn := dbtest.ConnectForTests(t)
+	q, err := db.NewUsageWriteQueue(conn, db.UsageWriteQueueConfig{BatchSize: 2})
+	require.NoError(t, err)
+
+	attributionID := db.NewTeamAttributionID(uuid.New().String())
+	cleanUpUsage(t, conn, attributionID)
+	first := dbtest.NewUsage(t, db.Usage{AttributionID: attributionID, CreditCents: 100, Draft: true})
+	second := dbtest.NewUsage(t, db.Usage{AttributionID: attributionID, CreditCents: 200, Draft: true})
+	third := dbtest.NewUsage(t, db.Usage{AttributionID: attributionID, CreditCents: 300, Draft: true})
+	require.NoError(t, q.Enqueue(first, second, third))
+
+	updated := first
+	updated.CreditCents = 150
+	require.NoError(t, q.Enqueue(updated))
+	require.Equal(t, 3, q.Pending())
+
+	require.NoError(t, q.Flush(context.Background()))
+	require.Equal(t, 0, q.Pending())
+
+	for _, expected := range []db.Usage{updated, second, third} {
+		actual, err := db.GetUsage(context.Background(), conn, expected.ID)
+		require.NoError(t, err)
+		require.Equal(t, expected.CreditCents, actual.CreditCents)
+	}
+}
+
+func TestUsageWriteQueue_Full(t *testing.T) {
+	q, err := db.NewUsageWriteQueue(nil, db.UsageWriteQueueConfig{BatchSize: 1, MaxPending: 2})
+	require.NoError(t, err)
+
+	first := dbtest.NewUsage(t, db.Usage{})
+	require.NoError(t, q.Enqueue(first, dbtest.NewUsage(t, db.Usage{})))
+	require.ErrorIs(t, q.Enqueue(dbtest.NewUsage(t, db.Usage{})), db.UsageWriteQueueFull)
+	// Updates of pending records are coalesced, and do not need room.
+	require.NoError(t, q.Enqueue(first))
+	require.Equal(t, 2, q.Pending())
+}
+
+func TestUsageWriteQueue_FlushesBatchesInBackground(t *testing.T) {
+	conn := dbtest.ConnectForTests(t)
+	q, err := db.NewUsageWriteQueue(conn, db.UsageWriteQueueConfig{BatchSize: 2, FlushInterval: util.Duration(time.Hour)})
+	require.NoError(t, err)
+	q.Start()
+	t.Cleanup(func() {
+		require.NoError(t, q.Close(context.Background()))
+	})
+
+	attributionID := db.NewTeamAttributionID(uuid.New().String())
+	cleanUpUsage(t, conn, attributionID)
+	require.NoError(t, q.Enqueue(dbtest.NewUsage(t, db.Usage{AttributionID: attributionID}), dbtest.NewUsage(t, db.Usage{AttributionID: attributionID})))
+	require.Eventually(t, func() bool {
+		return q.Pending() == 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	var count int64
+	require.NoError(t, conn.Model(&db.Usage{}).Where("attributionId = ?", attributionID).Count(&count).Error)
+	require.EqualValues(t, 2, count)
+}
+
+func TestUsageWriteQueue_CloseFlushes(t *testing.T) {
+	conn := dbtest.ConnectForTests(t)
+	q, err := db.NewUsageWriteQueue(conn, db.UsageWriteQueueConfig{FlushInterval: util.Duration(time.Hour)})
+	require.NoError(t, err)
+	q.Start()
+
+	attributionID := db.NewTeamAttributionID(uuid.New().String())
+	cleanUpUsage(t, conn, attributionID)
+	record := dbtest.NewUsage(t, db.Usage{AttributionID: attributionID})
+	require.NoError(t, q.Enqueue(record))
+	require.NoError(t, q.Close(context.Background()))
+
+	_, err = db.GetUsage(context.Background(), conn, record.ID)
+	require.NoError(t, err)
+	require.ErrorIs(t, q.Enqueue(record), db.UsageWriteQueueClosed)
+}
+
+func TestUsageWriteQueueConfig_Validate(t *testing.T) {
+	require.NoError(t, db.UsageWriteQueueConfig{}.Validate())
+	require.NoError(t, db.UsageWriteQueueConfig{BatchSize: 10, MaxPending: 10}.Validate())
+	require.Error(t, db.UsageWriteQueueConfig{BatchSize: -1}.Validate())
+	require.Error(t, db.UsageWriteQueueConfig{FlushInterval: util.Duration(-time.Second)}.Validate())
+	require.Error(t, db.UsageWriteQueueConfig{BatchSize: 10, MaxPending: 5}.Validate())
+}
+
+func TestUsageWriteQueue_DropsConflictingUpdates(t *testing.T) {
+	conn := dbtest.ConnectForTests(t)
+	q, err := db.NewUsageWriteQueue(conn, db.UsageWriteQueueConfig{})
+	require.NoError(t, err)
+
+	attributionID := db.NewTeamAttributionID(uuid.New().String())
+	cleanUpUsage(t, conn, attributionID)
+	stale := dbtest.NewUsage(t, db.Usage{AttributionID: attributionID, CreditCents: 100, Draft: true})
+	other := dbtest.NewUsage(t, db.Usage{AttributionID: attributionID, CreditCents: 100, Draft: true})
+	require.NoError(t, db.InsertUsage(context.Background(), conn, stale, other))
+
+	// The stored record is updated, and its version incremented, before the queued update of the read version is written.
+	concurrent := stale
+	concurrent.CreditCents = 200
+	require.NoError(t, db.UpsertUsage(context.Background(), conn, concurrent))
+
+	stale.CreditCents = 300
+	other.CreditCents = 300
+	require.NoError(t, q.Enqueue(stale, other))
+	require.NoError(t, q.Flush(context.Background()))
+	require.Equal(t, 0, q.Pending())
+
+	actual, err := db.GetUsage(context.Background(), conn, stale.ID)
+	require.NoError(t, err)
+	require.Equal(t, concurrent.CreditCents, actual.CreditCents)
+
+	actual, err = db.GetUsage(context.Background(), conn, other.ID)
+	require.NoError(t, err)
+	require.Equal(t, other.CreditCents, actual.CreditCents)
+}
+
+// cleanUpUsage deletes the usage of the attribution ID when the test completes. UpsertUsage writes usage with raw SQL,
+// which the cleanup of ConnectForTests does not track.
+func cleanUpUsage(t *testing.T, conn *gorm.DB, attributionID db.AttributionID) {
+	t.Cleanup(func() {
+		require.NoError(t, conn.Where("attributionId = ?", attributionID).Delete(&db.Usage{}).Error)
+		require.NoError(t, conn.Where("attributionId = ?", attributionID).Delete(&db.CachedBalance{}).Error)
+	})
+}
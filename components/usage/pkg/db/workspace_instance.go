@@ -127,16 +127,102 @@ func FindWorkspaceInstancesByIds(ctx context.Context, conn *gorm.DB, workspaceIn
 // - instances which only just terminated after the start period
 // - instances which only just started in the period specified
 func ListWorkspaceInstancesInRange(ctx context.Context, conn *gorm.DB, from, to time.Time) ([]WorkspaceInstanceForUsage, error) {
+	return ListWorkspaceInstancesInRangeWithProgress(ctx, conn, from, to, nil)
+}
+
+// ListWorkspaceInstancesInRangeWithProgress lists instances like ListWorkspaceInstancesInRange, and calls onBatch with the number of
+// instances listed so far after each batch.
+//
+// Instances are read with listWorkspaceInstancesInRangeSQL, one batch at a time: each batch is a range scan of the
+// primary key of d_b_workspace_instance starting after the last instance of the previous batch, joined to the workspace
+// by the primary key of d_b_workspace. No index covers the start and stopping times, so they are filtered while scanning.
+func ListWorkspaceInstancesInRangeWithProgress(ctx context.Context, conn *gorm.DB, from, to time.Time, onBatch func(listed int)) ([]WorkspaceInstanceForUsage, error) {
+	const batchSize = 1000
+
+	var instances []WorkspaceInstanceForUsage
+	after := ""
+	for {
+		rows, err := prepared(conn).WithContext(ctx).Raw(listWorkspaceInstancesInRangeSQL,
+			TimeToISO8601(from), TimeToISO8601(to), after, batchSize,
+		).Rows()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list workspace instances: %w", err)
+		}
+
+		batch, err := scanWorkspaceInstancesForUsage(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list workspace instances: %w", err)
+		}
+		instances = append(instances, batch...)
+		if len(batch) > 0 && onBatch != nil {
+			onBatch(len(instances))
+		}
+		if len(batch) < batchSize {
+			return instances, nil
+		}
+		after = batch[len(batch)-1].ID.String()
+	}
+}
+
+// listWorkspaceInstancesInRangeSQL selects a batch of the instances which were running in [from, to), after the
+// instance ID. Its conditions are the ones of workspaceInstancesInRange.
+const listWorkspaceInstancesInRangeSQL = `SELECT
+		wsi.id, ws.projectId, ws.type, wsi.workspaceClass, wsi.usageAttributionId, wsi.startedTime, wsi.stoppingTime, ws.ownerId, ws.id
+	FROM d_b_workspace_instance AS wsi
+	LEFT JOIN d_b_workspace AS ws ON wsi.workspaceId = ws.id
+	WHERE (wsi.stoppingTime >= ? OR wsi.stoppingTime = '')
+		AND wsi.startedTime != ''
+		AND wsi.startedTime < ?
+		AND wsi.usageAttributionId != ''
+		AND wsi.id > ?
+	ORDER BY wsi.id
+	LIMIT ?`
+
+// scanWorkspaceInstancesForUsage scans the columns selected by listWorkspaceInstancesInRangeSQL, and closes the rows.
+func scanWorkspaceInstancesForUsage(rows *sql.Rows) ([]WorkspaceInstanceForUsage, error) {
+	defer rows.Close()
+
+	var instances []WorkspaceInstanceForUsage
+	for rows.Next() {
+		var instance WorkspaceInstanceForUsage
+		// The workspace is joined, its columns are NULL when it does not exist.
+		var workspaceType, workspaceClass, ownerID, workspaceID sql.NullString
+		err := rows.Scan(
+			&instance.ID,
+			&instance.ProjectID,
+			&workspaceType,
+			&workspaceClass,
+			&instance.UsageAttributionID,
+			&instance.StartedTime,
+			&instance.StoppingTime,
+			&ownerID,
+			&workspaceID,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan workspace instance: %w", err)
+		}
+
+		instance.Type = WorkspaceType(workspaceType.String)
+		instance.WorkspaceClass = workspaceClass.String
+		instance.WorkspaceID = workspaceID.String
+		if ownerID.Valid {
+			instance.OwnerID, err = uuid.Parse(ownerID.String)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse owner ID of workspace instance %s: %w", instance.ID, err)
+			}
+		}
+		instances = append(instances, instance)
+	}
+	return instances, rows.Err()
+}
+
+// listWorkspaceInstancesInRangeGORM is the query builder implementation of ListWorkspaceInstancesInRange. Tests compare
+// it with the SQL implementation.
+func listWorkspaceInstancesInRangeGORM(ctx context.Context, conn *gorm.DB, from, to time.Time) ([]WorkspaceInstanceForUsage, error) {
 	var instances []WorkspaceInstanceForUsage
 	var instancesInBatch []WorkspaceInstanceForUsage
 
-	tx := queryWorkspaceInstanceForUsage(ctx, conn).
-		Where(
-			conn.Where("wsi.stoppingTime >= ?", TimeToISO8601(from)).Or("wsi.stoppingTime = ?", ""),
-		).
-		Where("wsi.startedTime != ?", "").
-		Where("wsi.startedTime < ?", TimeToISO8601(to)).
-		Where("wsi.usageAttributionId != ?", "").
+	tx := workspaceInstancesInRange(conn, queryWorkspaceInstanceForUsage(ctx, conn), from, to).
 		FindInBatches(&instancesInBatch, 1000, func(_ *gorm.DB, _ int) error {
 			instances = append(instances, instancesInBatch...)
 			return nil
@@ -148,6 +234,30 @@ func ListWorkspaceInstancesInRange(ctx context.Context, conn *gorm.DB, from, to
 	return instances, nil
 }
 
+// CountWorkspaceInstancesInRange counts the instances which ListWorkspaceInstancesInRange returns.
+func CountWorkspaceInstancesInRange(ctx context.Context, conn *gorm.DB, from, to time.Time) (int64, error) {
+	var count int64
+	tx := workspaceInstancesInRange(conn,
+		conn.WithContext(ctx).Table(fmt.Sprintf("%s as wsi", (&WorkspaceInstance{}).TableName())),
+		from, to,
+	).Count(&count)
+	if tx.Error != nil {
+		return 0, fmt.Errorf("failed to count workspace instances: %w", tx.Error)
+	}
+
+	return count, nil
+}
+
+func workspaceInstancesInRange(conn *gorm.DB, tx *gorm.DB, from, to time.Time) *gorm.DB {
+	return tx.
+		Where(
+			conn.Where("wsi.stoppingTime >= ?", TimeToISO8601(from)).Or("wsi.stoppingTime = ?", ""),
+		).
+		Where("wsi.startedTime != ?", "").
+		Where("wsi.startedTime < ?", TimeToISO8601(to)).
+		Where("wsi.usageAttributionId != ?", "")
+}
+
 func queryWorkspaceInstanceForUsage(ctx context.Context, conn *gorm.DB) *gorm.DB {
 	return conn.WithContext(ctx).
 		Table(fmt.Sprintf("%s as wsi", (&WorkspaceInstance{}).TableName())).
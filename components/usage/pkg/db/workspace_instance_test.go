@@ -186,6 +186,66 @@ func TestListWorkspaceInstancesInRange_InBatches(t *testing.T) {
 	require.Len(t, results, len(instances))
 }
 
+func TestListWorkspaceInstancesInRange_MatchesGORM(t *testing.T) {
+	conn := dbtest.ConnectForTests(t)
+
+	workspace := dbtest.CreateWorkspaces(t, conn, dbtest.NewWorkspace(t, db.Workspace{
+		ProjectID: sql.NullString{String: uuid.New().String(), Valid: true},
+	}))[0]
+	instances := dbtest.CreateWorkspaceInstances(t, conn,
+		// Stopped in range.
+		dbtest.NewWorkspaceInstance(t, db.WorkspaceInstance{
+			WorkspaceID:  workspace.ID,
+			StartedTime:  db.NewVarcharTime(time.Date(2022, 05, 15, 12, 00, 00, 00, time.UTC)),
+			StoppingTime: db.NewVarcharTime(time.Date(2022, 05, 15, 13, 00, 00, 00, time.UTC)),
+		}),
+		// Still running.
+		dbtest.NewWorkspaceInstance(t, db.WorkspaceInstance{
+			WorkspaceID: workspace.ID,
+			StartedTime: db.NewVarcharTime(time.Date(2022, 04, 30, 12, 00, 00, 00, time.UTC)),
+		}),
+		// The workspace does not exist.
+		dbtest.NewWorkspaceInstance(t, db.WorkspaceInstance{
+			WorkspaceID:  dbtest.GenerateWorkspaceID(),
+			StartedTime:  db.NewVarcharTime(time.Date(2022, 05, 20, 12, 00, 00, 00, time.UTC)),
+			StoppingTime: db.NewVarcharTime(time.Date(2022, 06, 20, 13, 00, 00, 00, time.UTC)),
+		}),
+		// Stopped before the range.
+		dbtest.NewWorkspaceInstance(t, db.WorkspaceInstance{
+			WorkspaceID:  workspace.ID,
+			StartedTime:  db.NewVarcharTime(time.Date(2022, 04, 15, 12, 00, 00, 00, time.UTC)),
+			StoppingTime: db.NewVarcharTime(time.Date(2022, 04, 15, 13, 00, 00, 00, time.UTC)),
+		}),
+		// Started after the range.
+		dbtest.NewWorkspaceInstance(t, db.WorkspaceInstance{
+			WorkspaceID: workspace.ID,
+			StartedTime: db.NewVarcharTime(time.Date(2022, 06, 15, 12, 00, 00, 00, time.UTC)),
+		}),
+	)
+	created := map[uuid.UUID]bool{}
+	for _, instance := range instances {
+		created[instance.ID] = true
+	}
+	// Other tests create instances concurrently, only the instances of this test are compared.
+	ofThisTest := func(listed []db.WorkspaceInstanceForUsage) map[uuid.UUID]db.WorkspaceInstanceForUsage {
+		result := map[uuid.UUID]db.WorkspaceInstanceForUsage{}
+		for _, instance := range listed {
+			if created[instance.ID] {
+				result[instance.ID] = instance
+			}
+		}
+		return result
+	}
+
+	listed, err := db.ListWorkspaceInstancesInRange(context.Background(), conn, startOfMay, startOfJune)
+	require.NoError(t, err)
+	expected, err := db.ListWorkspaceInstancesInRangeGORM(context.Background(), conn, startOfMay, startOfJune)
+	require.NoError(t, err)
+
+	require.Len(t, ofThisTest(listed), 3)
+	require.Equal(t, ofThisTest(expected), ofThisTest(listed))
+}
+
 func TestAttributionID_Values(t *testing.T) {
 	scenarios := []struct {
 		Input          string
@@ -286,6 +346,10 @@ func TestListWorkspaceInstancesInRange(t *testing.T) {
 	}
 
 	require.Len(t, retrieved, len(valid))
+
+	count, err := db.CountWorkspaceInstancesInRange(context.Background(), conn, startOfMay, startOfJune)
+	require.NoError(t, err)
+	require.EqualValues(t, len(valid), count)
 }
 
 func TestFindRunningWorkspace(t *testing.T) {
@@ -34,6 +34,10 @@ type WorkspaceInstanceUsage struct {
 
 	// deleted is used by db-sync
 	Deleted bool `gorm:"column:deleted;type:tinyint;default:0;" json:"deleted"`
+
+	// SoftDeletedTime is set when the usage was deleted on request of its owner. It is read-only, such that reports of
+	// the same instance do not restore soft-deleted usage.
+	SoftDeletedTime VarcharTime `gorm:"->;column:softDeletedTime;type:varchar;size:255;" json:"softDeletedTime"`
 }
 
 type ListUsageResult struct {
@@ -71,19 +75,70 @@ const (
 	AscendingOrder
 )
 
+// ListUsage lists the workspace instance usage of the attribution ID which overlaps [from, to), including archived usage.
 func ListUsage(ctx context.Context, conn *gorm.DB, attributionId AttributionID, from, to time.Time, sort Order, offset int64, limit int64) (*ListUsageResult, error) {
 	var listUsageResult = new(ListUsageResult)
-	db := conn.WithContext(ctx)
+	// Both tables need to be read up to the end of the requested page, the page is only known once they are merged.
+	tableLimit := limit
+	if limit != 0 {
+		tableLimit = offset + limit
+	}
 
-	var totalCreditsUsed sql.NullFloat64
-	var count sql.NullInt64
-	countResult, err := db.
-		WithContext(ctx).
-		Table((&WorkspaceInstanceUsage{}).TableName()).
-		Select("sum(creditsUsed) as totalCreditsUsed", "count(*) as count").
-		Order(fmt.Sprintf("startedAt %s", sort.ToSQL())).
-		Where("attributionId = ?", attributionId).
-		Where(
+	var records [][]WorkspaceInstanceUsage
+	for _, table := range []string{(&WorkspaceInstanceUsage{}).TableName(), WorkspaceInstanceUsageArchiveTableName} {
+		tableResult, err := listUsageIn(ctx, conn, table, attributionId, from, to, sort, tableLimit)
+		if err != nil {
+			return nil, err
+		}
+		listUsageResult.Count += tableResult.Count
+		listUsageResult.TotalCreditsUsed += tableResult.TotalCreditsUsed
+		records = append(records, tableResult.UsageRecords)
+	}
+	listUsageResult.UsageRecords = mergeWorkspaceInstanceUsagePage(records[0], records[1], sort, offset, limit)
+
+	return listUsageResult, nil
+}
+
+// ListWorkspaceInstanceUsageParams selects a page of the workspace instance usage of an attribution ID.
+type ListWorkspaceInstanceUsageParams struct {
+	AttributionId AttributionID
+	From, To      time.Time
+	Order         Order
+	// After is the key of the last workspace instance usage of the previous page.
+	After *PageKey
+	Limit int64
+}
+
+// WorkspaceInstanceUsagePageKey is the key of workspace instance usage in lists ordered by start time, see
+// ListWorkspaceInstanceUsageParams.After.
+func WorkspaceInstanceUsagePageKey(usage WorkspaceInstanceUsage) PageKey {
+	return PageKey{Value: usage.StartedAt, ID: usage.InstanceID.String()}
+}
+
+// ListWorkspaceInstanceUsage lists the page of workspace instance usage of the attribution ID which overlaps [From, To),
+// including archived usage. Unlike ListUsage, it does not count all usage in the range.
+func ListWorkspaceInstanceUsage(ctx context.Context, conn *gorm.DB, params *ListWorkspaceInstanceUsageParams) ([]WorkspaceInstanceUsage, error) {
+	var records [][]WorkspaceInstanceUsage
+	for _, table := range []string{(&WorkspaceInstanceUsage{}).TableName(), WorkspaceInstanceUsageArchiveTableName} {
+		var tableRecords []WorkspaceInstanceUsage
+		err := conn.WithContext(ctx).
+			Table(table).
+			Scopes(notSoftDeletedUsage).
+			Where("attributionId = ?", params.AttributionId).
+			Scopes(overlappingRange(conn, params.From, params.To), AfterKey("startedAt", "instanceId", params.Order, params.After), Limit(params.Limit)).
+			Find(&tableRecords).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to list workspace instance usage in %s: %w", table, err)
+		}
+		records = append(records, tableRecords)
+	}
+	return mergeWorkspaceInstanceUsagePage(records[0], records[1], params.Order, 0, params.Limit), nil
+}
+
+// overlappingRange selects workspace instance usage which overlaps [from, to).
+func overlappingRange(conn *gorm.DB, from, to time.Time) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(
 			// started before, finished inside query range
 			conn.Where("? <= stoppedAt AND stoppedAt < ?", from, to).
 				// started inside query range, finished inside
@@ -92,7 +147,24 @@ func ListUsage(ctx context.Context, conn *gorm.DB, attributionId AttributionID,
 				Or("? <= startedAt AND startedAt < ?", from, to).
 				// started before query range, still running
 				Or("startedAt <= ? AND (stoppedAt > ? OR stoppedAt IS NULL)", from, to),
-		).
+		)
+	}
+}
+
+// listUsageIn lists the first `limit` records of the table, and counts all of them. A limit of 0 lists all records.
+func listUsageIn(ctx context.Context, conn *gorm.DB, table string, attributionId AttributionID, from, to time.Time, sort Order, limit int64) (*ListUsageResult, error) {
+	var listUsageResult = new(ListUsageResult)
+	db := conn.WithContext(ctx)
+
+	var totalCreditsUsed sql.NullFloat64
+	var count sql.NullInt64
+	countResult, err := db.
+		WithContext(ctx).
+		Table(table).
+		Scopes(notSoftDeletedUsage).
+		Select("sum(creditsUsed) as totalCreditsUsed", "count(*) as count").
+		Where("attributionId = ?", attributionId).
+		Scopes(overlappingRange(conn, from, to)).
 		Rows()
 	if err != nil || !countResult.Next() {
 		return nil, fmt.Errorf("failed to get count of usage records: %s", err)
@@ -111,21 +183,10 @@ func ListUsage(ctx context.Context, conn *gorm.DB, attributionId AttributionID,
 	var usageRecords []WorkspaceInstanceUsage
 	result := db.
 		WithContext(ctx).
-		Table((&WorkspaceInstanceUsage{}).TableName()).
-		Order(fmt.Sprintf("startedAt %s", sort.ToSQL())).
+		Table(table).
+		Scopes(notSoftDeletedUsage).
 		Where("attributionId = ?", attributionId).
-		Where(
-			// started before, finished inside query range
-			conn.Where("? <= stoppedAt AND stoppedAt < ?", from, to).
-				// started inside query range, finished inside
-				Or("startedAt >= ? AND stoppedAt < ?", from, to).
-				// started inside query range, finished outside
-				Or("? <= startedAt AND startedAt < ?", from, to).
-				// started before query range, still running
-				Or("startedAt <= ? AND (stoppedAt > ? OR stoppedAt IS NULL)", from, to),
-		).
-		Offset(int(offset)).
-		Limit(int(limit)).
+		Scopes(overlappingRange(conn, from, to), AfterKey("startedAt", "instanceId", sort, nil), Limit(limit)).
 		Find(&usageRecords)
 	if result.Error != nil {
 		return nil, fmt.Errorf("failed to get usage records: %s", result.Error)
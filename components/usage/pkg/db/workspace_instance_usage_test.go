@@ -223,3 +223,43 @@ func TestListUsagePagination(t *testing.T) {
 	require.Equal(t, float64(244), listResult.TotalCreditsUsed)
 	require.Equal(t, int64(122), listResult.Count)
 }
+
+func TestListWorkspaceInstanceUsage(t *testing.T) {
+	conn := dbtest.ConnectForTests(t)
+
+	start := time.Date(2022, 7, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2022, 8, 1, 0, 0, 0, 0, time.UTC)
+	attributionID := db.NewTeamAttributionID(uuid.New().String())
+
+	// All instances started at the same time, pages are ordered by instance ID.
+	var instances []db.WorkspaceInstanceUsage
+	for i := 0; i < 5; i++ {
+		instances = append(instances, dbtest.NewWorkspaceInstanceUsage(t, db.WorkspaceInstanceUsage{
+			AttributionID: attributionID,
+			StartedAt:     start.Add(time.Hour),
+			StoppedAt:     sql.NullTime{Time: start.Add(2 * time.Hour), Valid: true},
+		}))
+	}
+	dbtest.CreateWorkspaceInstanceUsageRecords(t, conn, instances...)
+
+	seen := map[uuid.UUID]bool{}
+	var after *db.PageKey
+	for pages := 0; pages < 3; pages++ {
+		page, err := db.ListWorkspaceInstanceUsage(context.Background(), conn, &db.ListWorkspaceInstanceUsageParams{
+			AttributionId: attributionID,
+			From:          start,
+			To:            end,
+			Order:         db.DescendingOrder,
+			After:         after,
+			Limit:         2,
+		})
+		require.NoError(t, err)
+		for _, usage := range page {
+			require.False(t, seen[usage.InstanceID], "pages must not repeat usage")
+			seen[usage.InstanceID] = true
+		}
+		after = db.NextPageKey(page, 2, db.WorkspaceInstanceUsagePageKey)
+	}
+	require.Len(t, seen, 5)
+	require.Nil(t, after)
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package export
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"google.golang.org/api/option"
+)
+
+// DefaultBigQueryTable is the table usage is exported to, unless another table is configured.
+const DefaultBigQueryTable = "usage"
+
+type BigQueryConfig struct {
+	ProjectID string `json:"projectId"`
+	Dataset   string `json:"dataset"`
+	// Table is created on the first export, partitioned by the day of the effective time of usage. When Table is
+	// empty, DefaultBigQueryTable applies.
+	Table string `json:"table,omitempty"`
+	// CredentialsFile is the path of the key of a service account which can run load jobs in the dataset. When
+	// CredentialsFile is empty, the application default credentials are used.
+	CredentialsFile string `json:"credentialsFile,omitempty"`
+}
+
+// BigQueryExporter exports usage into a BigQuery table, which is partitioned by day. Every export of a day replaces
+// the partition of the day, such that days can be exported again.
+type BigQueryExporter struct {
+	client *bigquery.Client
+	table  *bigquery.Table
+}
+
+func NewBigQueryExporter(ctx context.Context, cfg BigQueryConfig) (*BigQueryExporter, error) {
+	if cfg.ProjectID == "" || cfg.Dataset == "" {
+		return nil, fmt.Errorf("BigQuery project ID and dataset must be set")
+	}
+	table := cfg.Table
+	if table == "" {
+		table = DefaultBigQueryTable
+	}
+
+	var opts []option.ClientOption
+	if cfg.CredentialsFile != "" {
+		opts = append(opts, option.WithCredentialsFile(cfg.CredentialsFile))
+	}
+	client, err := bigquery.NewClient(ctx, cfg.ProjectID, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create BigQuery client: %w", err)
+	}
+
+	return &BigQueryExporter{
+		client: client,
+		table:  client.Dataset(cfg.Dataset).Table(table),
+	}, nil
+}
+
+// ExportUsage replaces the partition of the day with the usage of the iterator, which must all be effective on the day.
+// Usage is streamed into a load job, it is never held in memory at once.
+func (e *BigQueryExporter) ExportUsage(ctx context.Context, day time.Time, usage UsageIterator) (int64, error) {
+	schema, err := bigquery.InferSchema(usageRow{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to infer BigQuery schema: %w", err)
+	}
+
+	reader, writer := io.Pipe()
+	type result struct {
+		rows int64
+		err  error
+	}
+	written := make(chan result, 1)
+	go func() {
+		rows, err := writeUsageRows(writer, usage)
+		// Closing with a nil error ends the upload.
+		_ = writer.CloseWithError(err)
+		written <- result{rows: rows, err: err}
+	}()
+
+	source := bigquery.NewReaderSource(reader)
+	source.SourceFormat = bigquery.JSON
+	source.Schema = schema
+
+	partition := e.client.Dataset(e.table.DatasetID).Table(fmt.Sprintf("%s$%s", e.table.TableID, utcDay(day).Format("20060102")))
+	loader := partition.LoaderFrom(source)
+	loader.CreateDisposition = bigquery.CreateIfNeeded
+	loader.WriteDisposition = bigquery.WriteTruncate
+	loader.TimePartitioning = &bigquery.TimePartitioning{
+		Type:  bigquery.DayPartitioningType,
+		Field: "effective_time",
+	}
+
+	job, err := loader.Run(ctx)
+	// Unblocks the writer when the upload failed before all usage was read.
+	_ = reader.CloseWithError(io.ErrClosedPipe)
+	w := <-written
+	// Writes fail with io.ErrClosedPipe when the upload failed, the error of the upload is the cause then.
+	if w.err != nil && !errors.Is(w.err, io.ErrClosedPipe) {
+		return 0, fmt.Errorf("failed to read usage to export: %w", w.err)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to start BigQuery load job for %s: %w", day.Format("2006-01-02"), err)
+	}
+
+	status, err := job.Wait(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to wait for BigQuery load job %s: %w", job.ID(), err)
+	}
+	if err := status.Err(); err != nil {
+		return 0, fmt.Errorf("BigQuery load job %s failed: %w", job.ID(), err)
+	}
+	return w.rows, nil
+}
+
+func (e *BigQueryExporter) Name() string {
+	return "bigquery"
+}
+
+func (e *BigQueryExporter) Close() error {
+	return e.client.Close()
+}
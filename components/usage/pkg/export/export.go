@@ -0,0 +1,111 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+)
+
+// UsageIterator calls fn with every usage to export, see db.ForEachUsage.
+type UsageIterator func(fn func(db.Usage) error) error
+
+// usageRow is the exported representation of usage. Metadata is not exported, it may contain personal data.
+type usageRow struct {
+	ID                  string    `json:"id" bigquery:"id"`
+	AttributionID       string    `json:"attribution_id" bigquery:"attribution_id"`
+	Description         string    `json:"description" bigquery:"description"`
+	Credits             float64   `json:"credits" bigquery:"credits"`
+	CreditCents         int64     `json:"credit_cents" bigquery:"credit_cents"`
+	EffectiveTime       time.Time `json:"effective_time" bigquery:"effective_time"`
+	Kind                string    `json:"kind" bigquery:"kind"`
+	WorkspaceInstanceID string    `json:"workspace_instance_id" bigquery:"workspace_instance_id"`
+	ProjectID           string    `json:"project_id" bigquery:"project_id"`
+	Draft               bool      `json:"draft" bigquery:"draft"`
+}
+
+func newUsageRow(usage db.Usage) usageRow {
+	return usageRow{
+		ID:                  usage.ID.String(),
+		AttributionID:       string(usage.AttributionID),
+		Description:         usage.Description,
+		Credits:             usage.CreditCents.ToCredits(),
+		CreditCents:         int64(usage.CreditCents),
+		EffectiveTime:       usage.EffectiveTime.Time().UTC(),
+		Kind:                string(usage.Kind),
+		WorkspaceInstanceID: usage.WorkspaceInstanceID.String(),
+		ProjectID:           usage.ProjectID,
+		Draft:               usage.Draft,
+	}
+}
+
+// usageColumns are the columns of exported CSV files, in the order of usageRow.csvRecord.
+var usageColumns = []string{"id", "attribution_id", "description", "credits", "credit_cents", "effective_time", "kind", "workspace_instance_id", "project_id", "draft"}
+
+func (r usageRow) csvRecord() []string {
+	return []string{
+		r.ID,
+		r.AttributionID,
+		r.Description,
+		strconv.FormatFloat(r.Credits, 'f', -1, 64),
+		strconv.FormatInt(r.CreditCents, 10),
+		r.EffectiveTime.Format(time.RFC3339Nano),
+		r.Kind,
+		r.WorkspaceInstanceID,
+		r.ProjectID,
+		strconv.FormatBool(r.Draft),
+	}
+}
+
+// writeUsageRows writes the usage of the iterator to w as newline delimited JSON, and returns the number of rows.
+func writeUsageRows(w io.Writer, usage UsageIterator) (int64, error) {
+	var rows int64
+	encoder := json.NewEncoder(w)
+	err := usage(func(u db.Usage) error {
+		if err := encoder.Encode(newUsageRow(u)); err != nil {
+			return fmt.Errorf("failed to write usage %s: %w", u.ID, err)
+		}
+		rows++
+		return nil
+	})
+	return rows, err
+}
+
+// writeUsageCSV writes the usage of the iterator to w as CSV with a header of usageColumns, and returns the number of
+// rows without the header.
+func writeUsageCSV(w io.Writer, usage UsageIterator) (int64, error) {
+	var rows int64
+	writer := csv.NewWriter(w)
+	if err := writer.Write(usageColumns); err != nil {
+		return 0, fmt.Errorf("failed to write CSV header: %w", err)
+	}
+	err := usage(func(u db.Usage) error {
+		if err := writer.Write(newUsageRow(u).csvRecord()); err != nil {
+			return fmt.Errorf("failed to write usage %s: %w", u.ID, err)
+		}
+		rows++
+		return nil
+	})
+	if err != nil {
+		return rows, err
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return rows, fmt.Errorf("failed to write CSV: %w", err)
+	}
+	return rows, nil
+}
+
+// utcDay returns the start of the day of t in UTC.
+func utcDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/db/dbtest"
+	"github.com/stretchr/testify/require"
+)
+
+func iterate(usage ...db.Usage) UsageIterator {
+	return func(fn func(db.Usage) error) error {
+		for _, u := range usage {
+			if err := fn(u); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func TestWriteUsageRows(t *testing.T) {
+	effective := time.Date(2022, 10, 11, 8, 30, 0, 0, time.UTC)
+	usage := dbtest.NewUsage(t, db.Usage{
+		AttributionID: db.NewTeamAttributionID("team-a"),
+		CreditCents:   db.NewCreditCents(2.5),
+		EffectiveTime: db.NewVarcharTime(effective),
+		Kind:          db.WorkspaceInstanceUsageKind,
+		ProjectID:     "project-a",
+		Metadata:      []byte(`{"userName": "jane"}`),
+	})
+
+	var buf bytes.Buffer
+	rows, err := writeUsageRows(&buf, iterate(usage, usage))
+	require.NoError(t, err)
+	require.Equal(t, int64(2), rows)
+
+	scanner := bufio.NewScanner(&buf)
+	require.True(t, scanner.Scan(), "rows must be newline delimited")
+	var row map[string]interface{}
+	require.NoError(t, json.Unmarshal(scanner.Bytes(), &row))
+	require.Equal(t, map[string]interface{}{
+		"id":                    usage.ID.String(),
+		"attribution_id":        "team:team-a",
+		"description":           usage.Description,
+		"credits":               2.5,
+		"credit_cents":          float64(250),
+		"effective_time":        "2022-10-11T08:30:00Z",
+		"kind":                  "workspaceinstance",
+		"workspace_instance_id": usage.WorkspaceInstanceID.String(),
+		"project_id":            "project-a",
+		"draft":                 false,
+	}, row, "metadata must not be exported")
+	require.True(t, scanner.Scan())
+	require.False(t, scanner.Scan())
+
+	failing := func(fn func(db.Usage) error) error { return errors.New("connection lost") }
+	_, err = writeUsageRows(&buf, failing)
+	require.Error(t, err)
+}
+
+func TestUsageRowSchema(t *testing.T) {
+	schema, err := bigquery.InferSchema(usageRow{})
+	require.NoError(t, err)
+
+	fields := map[string]bigquery.FieldType{}
+	for _, field := range schema {
+		fields[field.Name] = field.Type
+	}
+	require.Equal(t, bigquery.TimestampFieldType, fields["effective_time"], "the table is partitioned by the effective time")
+	require.Equal(t, bigquery.IntegerFieldType, fields["credit_cents"])
+	require.Len(t, fields, 10)
+}
+
+func TestUTCDay(t *testing.T) {
+	require.Equal(t, time.Date(2022, 10, 11, 0, 0, 0, 0, time.UTC), utcDay(time.Date(2022, 10, 12, 1, 0, 0, 0, time.FixedZone("CEST", 2*60*60))))
+}
@@ -0,0 +1,208 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package export
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gitpod-io/gitpod/common-go/util"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultRemoteWriteInterval is how often samples are pushed, unless another interval is configured.
+	DefaultRemoteWriteInterval = time.Minute
+
+	// CreditsUsedMetric is the name of the pushed samples. Its value is the credits used by the workspaces of an
+	// attribution ID in the current month, including workspaces which are still running.
+	CreditsUsedMetric = "gitpod_usage_credits_used"
+
+	remoteWriteTimeout = 30 * time.Second
+)
+
+type RemoteWriteConfig struct {
+	// URL is the remote-write endpoint, e.g. https://prometheus.example.com/api/v1/write.
+	URL string `json:"url"`
+	// Interval is how often samples are pushed. When Interval is 0, DefaultRemoteWriteInterval applies.
+	Interval util.Duration `json:"interval,omitempty"`
+	// BearerTokenFile is the path to a file containing the token which authenticates pushes. When BearerTokenFile is
+	// empty, pushes are not authenticated.
+	BearerTokenFile string `json:"bearerTokenFile,omitempty"`
+	// Labels are added to every sample, e.g. to tell installations apart.
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+func (c RemoteWriteConfig) interval() time.Duration {
+	if c.Interval <= 0 {
+		return DefaultRemoteWriteInterval
+	}
+	return time.Duration(c.Interval)
+}
+
+// RemoteWriter pushes the credits used by every attribution ID to a Prometheus remote-write endpoint, such that
+// consumption can be charged back with the tools of the observability stack, without access to the database.
+type RemoteWriter struct {
+	conn        *gorm.DB
+	url         string
+	bearerToken string
+	labels      map[string]string
+	interval    time.Duration
+	client      *http.Client
+	nowFunc     func() time.Time
+}
+
+func NewRemoteWriter(conn *gorm.DB, cfg RemoteWriteConfig) (*RemoteWriter, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("remote-write URL must be an http(s) URL, was %q", cfg.URL)
+	}
+	for name := range cfg.Labels {
+		if name == "__name__" || name == "attribution_id" || name == "month" {
+			return nil, fmt.Errorf("remote-write label %s is reserved", name)
+		}
+	}
+
+	var bearerToken string
+	if cfg.BearerTokenFile != "" {
+		token, err := os.ReadFile(cfg.BearerTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read remote-write bearer token: %w", err)
+		}
+		bearerToken = strings.TrimSpace(string(token))
+	}
+
+	return &RemoteWriter{
+		conn:        conn,
+		url:         cfg.URL,
+		bearerToken: bearerToken,
+		labels:      cfg.Labels,
+		interval:    cfg.interval(),
+		client:      &http.Client{Timeout: remoteWriteTimeout},
+		nowFunc:     time.Now,
+	}, nil
+}
+
+// Interval is how often Push should be called.
+func (w *RemoteWriter) Interval() time.Duration {
+	return w.interval
+}
+
+// Push sends a sample of the credits used in the current month for every attribution ID with usage in the month, and
+// returns the number of samples. Samples are gauges, pushes which fail are not retried, the next push catches up.
+func (w *RemoteWriter) Push(ctx context.Context) (int, error) {
+	now := w.nowFunc().UTC()
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	usage, err := db.GetWorkspaceUsageByAttribution(ctx, w.conn, monthStart, monthStart.AddDate(0, 1, 0))
+	if err != nil {
+		return 0, fmt.Errorf("failed to get usage by attribution ID: %w", err)
+	}
+
+	var series []timeSeries
+	for attributionID, creditCents := range usage {
+		labels := map[string]string{
+			"__name__":       CreditsUsedMetric,
+			"attribution_id": string(attributionID),
+			"month":          monthStart.Format("2006-01"),
+		}
+		for name, value := range w.labels {
+			labels[name] = value
+		}
+		series = append(series, timeSeries{
+			labels:    labels,
+			value:     creditCents.ToCredits(),
+			timestamp: now,
+		})
+	}
+	if len(series) == 0 {
+		return 0, nil
+	}
+
+	err = w.send(ctx, snappy.Encode(nil, encodeWriteRequest(series)))
+	if err != nil {
+		return 0, err
+	}
+	return len(series), nil
+}
+
+func (w *RemoteWriter) send(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create remote-write request: %w", err)
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	req.Header.Set("User-Agent", "gitpod-usage")
+	if w.bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+w.bearerToken)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to push samples: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("remote-write endpoint responded with %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+type timeSeries struct {
+	labels    map[string]string
+	value     float64
+	timestamp time.Time
+}
+
+// encodeWriteRequest encodes the series as prometheus.WriteRequest protobuf message, see
+// https://prometheus.io/docs/concepts/remote_write_spec/. Labels are sorted by name, as the spec requires.
+func encodeWriteRequest(series []timeSeries) []byte {
+	var req []byte
+	for _, ts := range series {
+		var msg []byte
+
+		names := make([]string, 0, len(ts.labels))
+		for name := range ts.labels {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			var label []byte
+			label = protowire.AppendTag(label, 1, protowire.BytesType)
+			label = protowire.AppendString(label, name)
+			label = protowire.AppendTag(label, 2, protowire.BytesType)
+			label = protowire.AppendString(label, ts.labels[name])
+			msg = protowire.AppendTag(msg, 1, protowire.BytesType)
+			msg = protowire.AppendBytes(msg, label)
+		}
+
+		var sample []byte
+		sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+		sample = protowire.AppendFixed64(sample, math.Float64bits(ts.value))
+		sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+		sample = protowire.AppendVarint(sample, uint64(ts.timestamp.UnixMilli()))
+		msg = protowire.AppendTag(msg, 2, protowire.BytesType)
+		msg = protowire.AppendBytes(msg, sample)
+
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, msg)
+	}
+	return req
+}
@@ -0,0 +1,155 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package export
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/db/dbtest"
+	"github.com/golang/snappy"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type decodedSample struct {
+	labels    map[string]string
+	value     float64
+	timestamp int64
+}
+
+// decodeWriteRequest decodes the fields of a prometheus.WriteRequest which encodeWriteRequest writes.
+func decodeWriteRequest(t *testing.T, b []byte) []decodedSample {
+	var samples []decodedSample
+	forEachField(t, b, func(_ protowire.Number, series []byte) {
+		sample := decodedSample{labels: map[string]string{}}
+		var names []string
+		forEachField(t, series, func(num protowire.Number, msg []byte) {
+			switch num {
+			case 1:
+				var name, value string
+				forEachField(t, msg, func(num protowire.Number, field []byte) {
+					if num == 1 {
+						name = string(field)
+					} else {
+						value = string(field)
+					}
+				})
+				names = append(names, name)
+				sample.labels[name] = value
+			case 2:
+				_, _, n := protowire.ConsumeTag(msg)
+				bits, m := protowire.ConsumeFixed64(msg[n:])
+				sample.value = math.Float64frombits(bits)
+				_, _, k := protowire.ConsumeTag(msg[n+m:])
+				ts, _ := protowire.ConsumeVarint(msg[n+m+k:])
+				sample.timestamp = int64(ts)
+			}
+		})
+		require.IsIncreasing(t, names, "labels must be sorted by name")
+		samples = append(samples, sample)
+	})
+	return samples
+}
+
+func forEachField(t *testing.T, b []byte, fn func(protowire.Number, []byte)) {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		require.True(t, n > 0)
+		require.Equal(t, protowire.BytesType, typ)
+		value, m := protowire.ConsumeBytes(b[n:])
+		require.True(t, m > 0)
+		fn(num, value)
+		b = b[n+m:]
+	}
+}
+
+func TestRemoteWriter_Push(t *testing.T) {
+	conn := dbtest.ConnectInMemoryForTests(t)
+	now := time.Date(2022, 10, 12, 8, 0, 0, 0, time.UTC)
+	team := db.NewTeamAttributionID(uuid.New().String())
+
+	dbtest.CreateUsageRecords(t, conn,
+		dbtest.NewUsage(t, db.Usage{AttributionID: team, CreditCents: 150, Kind: db.WorkspaceInstanceUsageKind, EffectiveTime: db.NewVarcharTime(now.AddDate(0, 0, -5))}),
+		dbtest.NewUsage(t, db.Usage{AttributionID: team, CreditCents: 100, Kind: db.WorkspaceInstanceUsageKind, Draft: true, EffectiveTime: db.NewVarcharTime(now.Add(-time.Hour))}),
+		// previous month
+		dbtest.NewUsage(t, db.Usage{AttributionID: team, CreditCents: 1000, Kind: db.WorkspaceInstanceUsageKind, EffectiveTime: db.NewVarcharTime(now.AddDate(0, -1, 0))}),
+	)
+
+	var received []decodedSample
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "snappy", r.Header.Get("Content-Encoding"))
+		require.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+		require.Equal(t, "0.1.0", r.Header.Get("X-Prometheus-Remote-Write-Version"))
+		require.Equal(t, "Bearer secret-token", r.Header.Get("Authorization"))
+
+		compressed, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		body, err := snappy.Decode(nil, compressed)
+		require.NoError(t, err)
+		received = decodeWriteRequest(t, body)
+	}))
+	defer srv.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("secret-token\n"), 0600))
+
+	writer, err := NewRemoteWriter(conn, RemoteWriteConfig{
+		URL:             srv.URL,
+		BearerTokenFile: tokenFile,
+		Labels:          map[string]string{"installation": "eu"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, DefaultRemoteWriteInterval, writer.Interval())
+	writer.nowFunc = func() time.Time { return now }
+
+	pushed, err := writer.Push(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, pushed)
+	require.Equal(t, []decodedSample{{
+		labels: map[string]string{
+			"__name__":       CreditsUsedMetric,
+			"attribution_id": string(team),
+			"installation":   "eu",
+			"month":          "2022-10",
+		},
+		value:     2.5,
+		timestamp: now.UnixMilli(),
+	}}, received, "must push the credits of the current month, including running instances")
+}
+
+func TestRemoteWriter_PushFails(t *testing.T) {
+	conn := dbtest.ConnectInMemoryForTests(t)
+	dbtest.CreateUsageRecords(t, conn,
+		dbtest.NewUsage(t, db.Usage{CreditCents: 150, Kind: db.WorkspaceInstanceUsageKind, EffectiveTime: db.NewVarcharTime(time.Now())}),
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "out of order sample", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	writer, err := NewRemoteWriter(conn, RemoteWriteConfig{URL: srv.URL})
+	require.NoError(t, err)
+	_, err = writer.Push(context.Background())
+	require.ErrorContains(t, err, "out of order sample")
+}
+
+func TestNewRemoteWriter_InvalidConfig(t *testing.T) {
+	_, err := NewRemoteWriter(nil, RemoteWriteConfig{URL: "prometheus:9090"})
+	require.Error(t, err)
+
+	_, err = NewRemoteWriter(nil, RemoteWriteConfig{URL: "https://prometheus.example.com/api/v1/write", Labels: map[string]string{"attribution_id": "team"}})
+	require.Error(t, err, "must not override the labels of samples")
+}
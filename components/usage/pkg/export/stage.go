@@ -0,0 +1,181 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package export
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/option"
+)
+
+// StageConfig configures the export of usage into a bucket, which a warehouse like Snowflake uses as external stage.
+type StageConfig struct {
+	Bucket string `json:"bucket"`
+	// Prefix is prepended to the names of all objects, e.g. to share a bucket between installations.
+	Prefix string `json:"prefix,omitempty"`
+	// CredentialsFile is the path of the key of a service account which can create objects in the bucket. When
+	// CredentialsFile is empty, the application default credentials are used.
+	CredentialsFile string `json:"credentialsFile,omitempty"`
+}
+
+// StageManifest describes the snapshot of the usage of a day. It is written after the snapshot, such that warehouses
+// which auto-ingest manifests only load complete snapshots.
+type StageManifest struct {
+	Day         string      `json:"day"`
+	ExportedAt  time.Time   `json:"exportedAt"`
+	Format      string      `json:"format"`
+	Compression string      `json:"compression"`
+	Columns     []string    `json:"columns"`
+	Files       []StageFile `json:"files"`
+}
+
+type StageFile struct {
+	// Path is the name of the object, relative to the bucket.
+	Path   string `json:"path"`
+	Rows   int64  `json:"rows"`
+	Bytes  int64  `json:"bytes"`
+	SHA256 string `json:"sha256"`
+}
+
+// objectWriterFunc returns a writer which creates the object on Close. The object must not be created when ctx is
+// cancelled before.
+type objectWriterFunc func(ctx context.Context, name, contentType string) io.WriteCloser
+
+// StageExporter exports a snapshot of the usage of every day as gzipped CSV into a bucket, followed by a manifest of
+// the snapshot. Every export of a day writes a new snapshot, and replaces the manifest of the day, which always
+// references the latest snapshot.
+type StageExporter struct {
+	client      *storage.Client
+	prefix      string
+	writeObject objectWriterFunc
+	nowFunc     func() time.Time
+}
+
+func NewStageExporter(ctx context.Context, cfg StageConfig) (*StageExporter, error) {
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("stage bucket must be set")
+	}
+
+	var opts []option.ClientOption
+	if cfg.CredentialsFile != "" {
+		opts = append(opts, option.WithCredentialsFile(cfg.CredentialsFile))
+	}
+	client, err := storage.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create storage client: %w", err)
+	}
+
+	bucket := client.Bucket(cfg.Bucket)
+	return &StageExporter{
+		client: client,
+		prefix: cfg.Prefix,
+		writeObject: func(ctx context.Context, name, contentType string) io.WriteCloser {
+			w := bucket.Object(name).NewWriter(ctx)
+			w.ContentType = contentType
+			return w
+		},
+		nowFunc: time.Now,
+	}, nil
+}
+
+// ExportUsage writes a snapshot of the usage of the iterator, which must all be effective on the day, and the manifest
+// of the day.
+func (e *StageExporter) ExportUsage(ctx context.Context, day time.Time, usage UsageIterator) (int64, error) {
+	day = utcDay(day)
+	exportedAt := e.nowFunc().UTC()
+
+	file, err := e.writeSnapshot(ctx, day, exportedAt, usage)
+	if err != nil {
+		return 0, err
+	}
+
+	manifest := StageManifest{
+		Day:         day.Format("2006-01-02"),
+		ExportedAt:  exportedAt,
+		Format:      "csv",
+		Compression: "gzip",
+		Columns:     usageColumns,
+		Files:       []StageFile{file},
+	}
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal stage manifest: %w", err)
+	}
+	w := e.writeObject(ctx, e.manifestPath(day), "application/json")
+	if _, err := w.Write(content); err != nil {
+		_ = w.Close()
+		return 0, fmt.Errorf("failed to write stage manifest of %s: %w", manifest.Day, err)
+	}
+	if err := w.Close(); err != nil {
+		return 0, fmt.Errorf("failed to write stage manifest of %s: %w", manifest.Day, err)
+	}
+	return file.Rows, nil
+}
+
+func (e *StageExporter) writeSnapshot(ctx context.Context, day, exportedAt time.Time, usage UsageIterator) (StageFile, error) {
+	// Cancelling the context aborts the upload, such that failed exports do not leave partial snapshots behind.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	file := StageFile{Path: e.snapshotPath(day, exportedAt)}
+	object := e.writeObject(ctx, file.Path, "application/gzip")
+	hash := sha256.New()
+	counter := &countingWriter{}
+	compressed := gzip.NewWriter(io.MultiWriter(object, hash, counter))
+
+	rows, err := writeUsageCSV(compressed, usage)
+	if err == nil {
+		err = compressed.Close()
+	}
+	if err != nil {
+		cancel()
+		_ = object.Close()
+		return StageFile{}, fmt.Errorf("failed to write usage snapshot of %s: %w", day.Format("2006-01-02"), err)
+	}
+	if err := object.Close(); err != nil {
+		return StageFile{}, fmt.Errorf("failed to upload usage snapshot of %s: %w", day.Format("2006-01-02"), err)
+	}
+
+	file.Rows = rows
+	file.Bytes = counter.n
+	file.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return file, nil
+}
+
+// snapshotPath returns the name of a snapshot. Snapshots are never overwritten, warehouses which ingest every new
+// object only ingest every snapshot once.
+func (e *StageExporter) snapshotPath(day, exportedAt time.Time) string {
+	return path.Join(e.prefix, "usage", "day="+day.Format("2006-01-02"), fmt.Sprintf("usage-%d.csv.gz", exportedAt.UnixNano()))
+}
+
+func (e *StageExporter) manifestPath(day time.Time) string {
+	return path.Join(e.prefix, "manifests", "day="+day.Format("2006-01-02")+".json")
+}
+
+func (e *StageExporter) Name() string {
+	return "stage"
+}
+
+func (e *StageExporter) Close() error {
+	return e.client.Close()
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
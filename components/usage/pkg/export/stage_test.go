@@ -0,0 +1,102 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package export
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/db/dbtest"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeBucket struct {
+	objects map[string][]byte
+}
+
+type fakeObject struct {
+	ctx    context.Context
+	name   string
+	bucket *fakeBucket
+	bytes.Buffer
+}
+
+func (o *fakeObject) Close() error {
+	if err := o.ctx.Err(); err != nil {
+		return err
+	}
+	o.bucket.objects[o.name] = o.Bytes()
+	return nil
+}
+
+func newFakeStageExporter(now time.Time) (*StageExporter, *fakeBucket) {
+	bucket := &fakeBucket{objects: map[string][]byte{}}
+	return &StageExporter{
+		prefix: "gitpod",
+		writeObject: func(ctx context.Context, name, contentType string) io.WriteCloser {
+			return &fakeObject{ctx: ctx, name: name, bucket: bucket}
+		},
+		nowFunc: func() time.Time { return now },
+	}, bucket
+}
+
+func TestStageExporter(t *testing.T) {
+	day := time.Date(2022, 10, 11, 0, 0, 0, 0, time.UTC)
+	now := time.Date(2022, 10, 12, 0, 5, 0, 0, time.UTC)
+	exporter, bucket := newFakeStageExporter(now)
+
+	usage := dbtest.NewUsage(t, db.Usage{
+		CreditCents:   db.NewCreditCents(1.5),
+		EffectiveTime: db.NewVarcharTime(day.Add(time.Hour)),
+	})
+	rows, err := exporter.ExportUsage(context.Background(), day, iterate(usage, usage))
+	require.NoError(t, err)
+	require.Equal(t, int64(2), rows)
+
+	var manifest StageManifest
+	require.NoError(t, json.Unmarshal(bucket.objects["gitpod/manifests/day=2022-10-11.json"], &manifest))
+	require.Equal(t, "2022-10-11", manifest.Day)
+	require.Equal(t, now, manifest.ExportedAt)
+	require.Equal(t, usageColumns, manifest.Columns)
+	require.Len(t, manifest.Files, 1)
+
+	file := manifest.Files[0]
+	require.Equal(t, "gitpod/usage/day=2022-10-11/usage-1665533100000000000.csv.gz", file.Path)
+	require.Equal(t, int64(2), file.Rows)
+	snapshot := bucket.objects[file.Path]
+	require.Equal(t, int64(len(snapshot)), file.Bytes)
+	sum := sha256.Sum256(snapshot)
+	require.Equal(t, hex.EncodeToString(sum[:]), file.SHA256)
+
+	reader, err := gzip.NewReader(bytes.NewReader(snapshot))
+	require.NoError(t, err)
+	records, err := csv.NewReader(reader).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	require.Equal(t, usageColumns, records[0])
+	require.Equal(t, usage.ID.String(), records[1][0])
+	require.Equal(t, "1.5", records[1][3])
+	require.Equal(t, "2022-10-11T01:00:00Z", records[1][5])
+}
+
+func TestStageExporter_FailedSnapshot(t *testing.T) {
+	day := time.Date(2022, 10, 11, 0, 0, 0, 0, time.UTC)
+	exporter, bucket := newFakeStageExporter(day)
+
+	failing := func(fn func(db.Usage) error) error { return errors.New("connection lost") }
+	_, err := exporter.ExportUsage(context.Background(), day, failing)
+	require.Error(t, err)
+	require.Empty(t, bucket.objects, "must neither upload partial snapshots nor manifests")
+}
@@ -0,0 +1,35 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package graph
+
+import (
+	"fmt"
+	"net/http"
+
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/graph-gophers/graphql-go"
+	"github.com/graph-gophers/graphql-go/relay"
+)
+
+// maxQueryDepth bounds the nesting of queries. The deepest field of the schema, costCenters.costCenters.balance.
+// projectBalances.projectId, is nested 5 levels.
+const maxQueryDepth = 6
+
+func NewSchema(usage v1.UsageServiceClient) (*graphql.Schema, error) {
+	schema, err := graphql.ParseSchema(Schema, NewResolver(usage), graphql.MaxDepth(maxQueryDepth))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse usage GraphQL schema: %w", err)
+	}
+	return schema, nil
+}
+
+// NewHandler returns a handler which serves GraphQL queries in POST requests, and resolves them through the usage service.
+func NewHandler(usage v1.UsageServiceClient) (http.Handler, error) {
+	schema, err := NewSchema(usage)
+	if err != nil {
+		return nil, err
+	}
+	return &relay.Handler{Schema: schema}, nil
+}
@@ -0,0 +1,382 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package graph
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/graph-gophers/graphql-go"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Resolver resolves queries through the usage service, such that the GraphQL API returns the same data, and applies
+// the same validation, as the gRPC API. Every field is only fetched when it is queried.
+type Resolver struct {
+	usage v1.UsageServiceClient
+}
+
+func NewResolver(usage v1.UsageServiceClient) *Resolver {
+	return &Resolver{usage: usage}
+}
+
+type attributionArgs struct {
+	AttributionID string
+}
+
+type paginationArgs struct {
+	Page    *int32
+	PerPage *int32
+}
+
+func (a paginationArgs) toPaginatedRequest() *v1.PaginatedRequest {
+	if a.Page == nil && a.PerPage == nil {
+		return nil
+	}
+	req := &v1.PaginatedRequest{}
+	if a.Page != nil {
+		req.Page = int64(*a.Page)
+	}
+	if a.PerPage != nil {
+		req.PerPage = int64(*a.PerPage)
+	}
+	return req
+}
+
+func (r *Resolver) CostCenter(ctx context.Context, args attributionArgs) (*costCenterResolver, error) {
+	resp, err := r.usage.GetCostCenter(ctx, &v1.GetCostCenterRequest{AttributionId: args.AttributionID})
+	if err != nil {
+		return nil, rpcError(err)
+	}
+	return &costCenterResolver{usage: r.usage, costCenter: resp.GetCostCenter()}, nil
+}
+
+type costCentersArgs struct {
+	BillingStrategy *string
+	OverLimit       *bool
+	paginationArgs
+}
+
+func (r *Resolver) CostCenters(ctx context.Context, args costCentersArgs) (*costCenterListResolver, error) {
+	req := &v1.ListCostCentersRequest{Pagination: args.toPaginatedRequest()}
+	if args.BillingStrategy != nil {
+		req.BillingStrategy = v1.BillingStrategy(v1.BillingStrategy_value["BILLING_STRATEGY_"+*args.BillingStrategy])
+	}
+	if args.OverLimit != nil {
+		req.OverLimit = *args.OverLimit
+	}
+
+	resp, err := r.usage.ListCostCenters(ctx, req)
+	if err != nil {
+		return nil, rpcError(err)
+	}
+	list := &costCenterListResolver{pagination: resp.GetPagination()}
+	for _, costCenter := range resp.GetCostCenters() {
+		list.costCenters = append(list.costCenters, &costCenterResolver{usage: r.usage, costCenter: costCenter})
+	}
+	return list, nil
+}
+
+func (r *Resolver) Balance(ctx context.Context, args attributionArgs) (*balanceResolver, error) {
+	return getBalance(ctx, r.usage, args.AttributionID)
+}
+
+type sessionsArgs struct {
+	AttributionID string
+	From          *graphql.Time
+	To            *graphql.Time
+	Order         *string
+	paginationArgs
+}
+
+func (r *Resolver) Sessions(ctx context.Context, args sessionsArgs) (*sessionListResolver, error) {
+	req := &v1.ListBilledUsageRequest{
+		AttributionId: args.AttributionID,
+		From:          toTimestamp(args.From),
+		To:            toTimestamp(args.To),
+		Pagination:    args.toPaginatedRequest(),
+	}
+	if args.Order != nil {
+		req.Order = v1.ListBilledUsageRequest_Ordering(v1.ListBilledUsageRequest_Ordering_value["ORDERING_"+*args.Order])
+	}
+
+	resp, err := r.usage.ListBilledUsage(ctx, req)
+	if err != nil {
+		return nil, rpcError(err)
+	}
+	return &sessionListResolver{resp: resp}, nil
+}
+
+type summaryArgs struct {
+	AttributionID string
+	From          *graphql.Time
+	To            *graphql.Time
+}
+
+func (r *Resolver) Summary(args summaryArgs) *summaryResolver {
+	return &summaryResolver{usage: r.usage, args: args}
+}
+
+type costCenterResolver struct {
+	usage      v1.UsageServiceClient
+	costCenter *v1.CostCenter
+}
+
+func (r *costCenterResolver) AttributionID() string { return r.costCenter.GetAttributionId() }
+func (r *costCenterResolver) SpendingLimit() int32  { return r.costCenter.GetSpendingLimit() }
+func (r *costCenterResolver) SpendingLimitType() string {
+	return enumValue(r.costCenter.GetSpendingLimitType().String(), "SPENDING_LIMIT_TYPE_")
+}
+func (r *costCenterResolver) BillingStrategy() string {
+	return enumValue(r.costCenter.GetBillingStrategy().String(), "BILLING_STRATEGY_")
+}
+func (r *costCenterResolver) Currency() string { return r.costCenter.GetCurrency() }
+func (r *costCenterResolver) BillingCycleAnchor() *graphql.Time {
+	return toTime(r.costCenter.GetBillingCycleAnchor())
+}
+func (r *costCenterResolver) BillingPeriodStart() *graphql.Time {
+	return toTime(r.costCenter.GetBillingPeriodStart())
+}
+func (r *costCenterResolver) BillingPeriodEnd() *graphql.Time {
+	return toTime(r.costCenter.GetBillingPeriodEnd())
+}
+func (r *costCenterResolver) CreditsUsed() float64 { return r.costCenter.GetCreditsUsed() }
+func (r *costCenterResolver) State() string {
+	return enumValue(r.costCenter.GetState().String(), "STATE_")
+}
+func (r *costCenterResolver) DunningState() string {
+	return enumValue(r.costCenter.GetDunningState().String(), "DUNNING_STATE_")
+}
+func (r *costCenterResolver) PaymentFailedAt() *graphql.Time {
+	return toTime(r.costCenter.GetPaymentFailedAt())
+}
+func (r *costCenterResolver) RolloverLimit() int32 { return r.costCenter.GetRolloverLimit() }
+func (r *costCenterResolver) Balance(ctx context.Context) (*balanceResolver, error) {
+	return getBalance(ctx, r.usage, r.costCenter.GetAttributionId())
+}
+
+type costCenterListResolver struct {
+	costCenters []*costCenterResolver
+	pagination  *v1.PaginatedResponse
+}
+
+func (r *costCenterListResolver) CostCenters() []*costCenterResolver { return r.costCenters }
+func (r *costCenterListResolver) Pagination() *paginationResolver {
+	return &paginationResolver{r.pagination}
+}
+
+func getBalance(ctx context.Context, usage v1.UsageServiceClient, attributionID string) (*balanceResolver, error) {
+	resp, err := usage.GetBalance(ctx, &v1.GetBalanceRequest{AttributionId: attributionID})
+	if err != nil {
+		return nil, rpcError(err)
+	}
+	return &balanceResolver{resp}, nil
+}
+
+type balanceResolver struct {
+	balance *v1.GetBalanceResponse
+}
+
+func (r *balanceResolver) CreditsUsed() float64 { return r.balance.GetCreditsUsed() }
+func (r *balanceResolver) SpendingLimit() int32 { return r.balance.GetSpendingLimit() }
+func (r *balanceResolver) SpendingLimitType() string {
+	return enumValue(r.balance.GetSpendingLimitType().String(), "SPENDING_LIMIT_TYPE_")
+}
+func (r *balanceResolver) LimitReached() bool { return r.balance.GetLimitReached() }
+func (r *balanceResolver) State() string {
+	return enumValue(r.balance.GetState().String(), "SPENDING_LIMIT_STATE_")
+}
+func (r *balanceResolver) HardLimit() float64  { return r.balance.GetHardLimit() }
+func (r *balanceResolver) Debt() float64       { return r.balance.GetDebt() }
+func (r *balanceResolver) Currency() string    { return r.balance.GetCurrency() }
+func (r *balanceResolver) AmountUsed() float64 { return r.balance.GetAmountUsed() }
+func (r *balanceResolver) CreditsCoveredByGrants() float64 {
+	return r.balance.GetCreditsCoveredByGrants()
+}
+func (r *balanceResolver) CreditsGrantedRemaining() float64 {
+	return r.balance.GetCreditsGrantedRemaining()
+}
+func (r *balanceResolver) BillingPeriodStart() *graphql.Time {
+	return toTime(r.balance.GetBillingPeriodStart())
+}
+func (r *balanceResolver) BillingPeriodEnd() *graphql.Time {
+	return toTime(r.balance.GetBillingPeriodEnd())
+}
+func (r *balanceResolver) ProjectBalances() []*projectBalanceResolver {
+	var balances []*projectBalanceResolver
+	for _, balance := range r.balance.GetProjectBalances() {
+		balances = append(balances, &projectBalanceResolver{balance})
+	}
+	return balances
+}
+
+type projectBalanceResolver struct {
+	balance *v1.ProjectBalance
+}
+
+func (r *projectBalanceResolver) ProjectID() string         { return r.balance.GetProjectId() }
+func (r *projectBalanceResolver) SpendingLimit() int32      { return r.balance.GetSpendingLimit() }
+func (r *projectBalanceResolver) CreditsUsed() float64      { return r.balance.GetCreditsUsed() }
+func (r *projectBalanceResolver) CreditsRemaining() float64 { return r.balance.GetCreditsRemaining() }
+func (r *projectBalanceResolver) LimitExceeded() bool       { return r.balance.GetLimitExceeded() }
+
+type sessionListResolver struct {
+	resp *v1.ListBilledUsageResponse
+}
+
+func (r *sessionListResolver) Sessions() []*sessionResolver {
+	var sessions []*sessionResolver
+	for _, session := range r.resp.GetSessions() {
+		sessions = append(sessions, &sessionResolver{session})
+	}
+	return sessions
+}
+func (r *sessionListResolver) TotalCreditsUsed() float64 { return r.resp.GetTotalCreditsUsed() }
+func (r *sessionListResolver) Pagination() *paginationResolver {
+	return &paginationResolver{r.resp.GetPagination()}
+}
+
+type sessionResolver struct {
+	session *v1.BilledSession
+}
+
+func (r *sessionResolver) AttributionID() string    { return r.session.GetAttributionId() }
+func (r *sessionResolver) UserID() string           { return r.session.GetUserId() }
+func (r *sessionResolver) TeamID() string           { return r.session.GetTeamId() }
+func (r *sessionResolver) WorkspaceID() string      { return r.session.GetWorkspaceId() }
+func (r *sessionResolver) WorkspaceType() string    { return r.session.GetWorkspaceType() }
+func (r *sessionResolver) ProjectID() string        { return r.session.GetProjectId() }
+func (r *sessionResolver) InstanceID() string       { return r.session.GetInstanceId() }
+func (r *sessionResolver) WorkspaceClass() string   { return r.session.GetWorkspaceClass() }
+func (r *sessionResolver) StartTime() *graphql.Time { return toTime(r.session.GetStartTime()) }
+func (r *sessionResolver) EndTime() *graphql.Time   { return toTime(r.session.GetEndTime()) }
+func (r *sessionResolver) Credits() float64         { return r.session.GetCredits() }
+
+// summaryResolver fetches the billed usage and the ledger balances of the summarized period at most once each, even
+// when their fields are resolved concurrently.
+type summaryResolver struct {
+	usage v1.UsageServiceClient
+	args  summaryArgs
+
+	billedOnce sync.Once
+	billed     *v1.ListBilledUsageResponse
+	billedErr  error
+
+	ledgerOnce sync.Once
+	ledger     *v1.ListUsageResponse
+	ledgerErr  error
+}
+
+func (r *summaryResolver) AttributionID() string { return r.args.AttributionID }
+
+func (r *summaryResolver) CreditsUsed(ctx context.Context) (float64, error) {
+	r.billedOnce.Do(func() {
+		r.billed, r.billedErr = r.usage.ListBilledUsage(ctx, &v1.ListBilledUsageRequest{
+			AttributionId: r.args.AttributionID,
+			From:          toTimestamp(r.args.From),
+			To:            toTimestamp(r.args.To),
+			// Only the total is needed.
+			Pagination: &v1.PaginatedRequest{PerPage: 1, Page: 1},
+		})
+	})
+	if r.billedErr != nil {
+		return 0, rpcError(r.billedErr)
+	}
+	return r.billed.GetTotalCreditsUsed(), nil
+}
+
+func (r *summaryResolver) CreditBalanceAtStart(ctx context.Context) (float64, error) {
+	ledger, err := r.listLedger(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return ledger.GetCreditBalanceAtStart(), nil
+}
+
+func (r *summaryResolver) CreditBalanceAtEnd(ctx context.Context) (float64, error) {
+	ledger, err := r.listLedger(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return ledger.GetCreditBalanceAtEnd(), nil
+}
+
+func (r *summaryResolver) listLedger(ctx context.Context) (*v1.ListUsageResponse, error) {
+	r.ledgerOnce.Do(func() {
+		r.ledger, r.ledgerErr = r.usage.ListUsage(ctx, &v1.ListUsageRequest{
+			AttributionId: r.args.AttributionID,
+			From:          toTimestamp(r.args.From),
+			To:            toTimestamp(r.args.To),
+			// Only the balances are needed.
+			Pagination: &v1.PaginatedRequest{PerPage: 1, Page: 1},
+		})
+	})
+	if r.ledgerErr != nil {
+		return nil, rpcError(r.ledgerErr)
+	}
+	return r.ledger, nil
+}
+
+type paginationResolver struct {
+	pagination *v1.PaginatedResponse
+}
+
+func (r *paginationResolver) Page() int32       { return int32(r.pagination.GetPage()) }
+func (r *paginationResolver) PerPage() int32    { return int32(r.pagination.GetPerPage()) }
+func (r *paginationResolver) TotalPages() int32 { return int32(r.pagination.GetTotalPages()) }
+func (r *paginationResolver) Total() int32      { return int32(r.pagination.GetTotal()) }
+
+// enumValue returns the GraphQL enum value of a usage API enum value.
+func enumValue(name, prefix string) string {
+	return strings.TrimPrefix(name, prefix)
+}
+
+func toTime(t *timestamppb.Timestamp) *graphql.Time {
+	if t == nil {
+		return nil
+	}
+	return &graphql.Time{Time: t.AsTime()}
+}
+
+func toTimestamp(t *graphql.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(t.Time)
+}
+
+// queryError is the error of a field whose RPC failed. Its extensions carry the gRPC code and the reason of the
+// error, such that clients can handle errors like they do for the gRPC API.
+type queryError struct {
+	message    string
+	extensions map[string]interface{}
+}
+
+func (e *queryError) Error() string {
+	return e.message
+}
+
+func (e *queryError) Extensions() map[string]interface{} {
+	return e.extensions
+}
+
+func rpcError(err error) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return fmt.Errorf("failed to query usage: %w", err)
+	}
+	extensions := map[string]interface{}{"code": st.Code().String()}
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			extensions["reason"] = info.GetReason()
+		}
+	}
+	return &queryError{message: st.Message(), extensions: extensions}
+}
@@ -0,0 +1,217 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package graph
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type fakeUsageClient struct {
+	v1.UsageServiceClient
+
+	mu    sync.Mutex
+	calls map[string]int
+	// listBilledUsage is the last ListBilledUsage request.
+	listBilledUsage *v1.ListBilledUsageRequest
+}
+
+func (c *fakeUsageClient) called(method string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.calls == nil {
+		c.calls = map[string]int{}
+	}
+	c.calls[method]++
+}
+
+func (c *fakeUsageClient) GetCostCenter(_ context.Context, in *v1.GetCostCenterRequest, _ ...grpc.CallOption) (*v1.GetCostCenterResponse, error) {
+	c.called("GetCostCenter")
+	if in.GetAttributionId() == "invalid" {
+		st, err := status.New(codes.InvalidArgument, "Failed to parse attribution ID").WithDetails(&errdetails.ErrorInfo{Reason: "INVALID_ATTRIBUTION_ID"})
+		if err != nil {
+			return nil, err
+		}
+		return nil, st.Err()
+	}
+	return &v1.GetCostCenterResponse{CostCenter: &v1.CostCenter{
+		AttributionId:      in.GetAttributionId(),
+		SpendingLimit:      500,
+		SpendingLimitType:  v1.SpendingLimitType_SPENDING_LIMIT_TYPE_HARD,
+		BillingStrategy:    v1.BillingStrategy_BILLING_STRATEGY_STRIPE,
+		BillingPeriodStart: timestamppb.New(time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)),
+		DunningState:       v1.CostCenter_DUNNING_STATE_NONE,
+	}}, nil
+}
+
+func (c *fakeUsageClient) ListCostCenters(_ context.Context, in *v1.ListCostCentersRequest, _ ...grpc.CallOption) (*v1.ListCostCentersResponse, error) {
+	c.called("ListCostCenters")
+	return &v1.ListCostCentersResponse{
+		CostCenters: []*v1.CostCenter{{AttributionId: "team:a", BillingStrategy: in.GetBillingStrategy()}, {AttributionId: "team:b", BillingStrategy: in.GetBillingStrategy()}},
+		Pagination:  &v1.PaginatedResponse{Page: in.GetPagination().GetPage(), PerPage: in.GetPagination().GetPerPage(), Total: 12, TotalPages: 6},
+	}, nil
+}
+
+func (c *fakeUsageClient) GetBalance(_ context.Context, in *v1.GetBalanceRequest, _ ...grpc.CallOption) (*v1.GetBalanceResponse, error) {
+	c.called("GetBalance")
+	return &v1.GetBalanceResponse{
+		CreditsUsed:     120,
+		State:           v1.GetBalanceResponse_SPENDING_LIMIT_STATE_WITHIN_LIMIT,
+		ProjectBalances: []*v1.ProjectBalance{{ProjectId: "project-a", SpendingLimit: 100, CreditsUsed: 20, CreditsRemaining: 80}},
+	}, nil
+}
+
+func (c *fakeUsageClient) ListBilledUsage(_ context.Context, in *v1.ListBilledUsageRequest, _ ...grpc.CallOption) (*v1.ListBilledUsageResponse, error) {
+	c.called("ListBilledUsage")
+	c.mu.Lock()
+	c.listBilledUsage = in
+	c.mu.Unlock()
+	return &v1.ListBilledUsageResponse{
+		Sessions:         []*v1.BilledSession{{AttributionId: in.GetAttributionId(), InstanceId: "instance-a", Credits: 3.5, StartTime: timestamppb.New(time.Date(2022, 10, 2, 8, 0, 0, 0, time.UTC))}},
+		TotalCreditsUsed: 42,
+		Pagination:       &v1.PaginatedResponse{Page: 1, PerPage: 50, Total: 1, TotalPages: 1},
+	}, nil
+}
+
+func (c *fakeUsageClient) ListUsage(_ context.Context, in *v1.ListUsageRequest, _ ...grpc.CallOption) (*v1.ListUsageResponse, error) {
+	c.called("ListUsage")
+	return &v1.ListUsageResponse{CreditBalanceAtStart: -10, CreditBalanceAtEnd: -52}, nil
+}
+
+func execute(t *testing.T, usage v1.UsageServiceClient, query string) (map[string]interface{}, []map[string]interface{}) {
+	t.Helper()
+
+	handler, err := NewHandler(usage)
+	require.NoError(t, err)
+
+	body, err := json.Marshal(map[string]interface{}{"query": query})
+	require.NoError(t, err)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/graphql", bytes.NewReader(body)))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var resp struct {
+		Data   map[string]interface{}   `json:"data"`
+		Errors []map[string]interface{} `json:"errors"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	return resp.Data, resp.Errors
+}
+
+func TestQuery_OnlyFetchesQueriedFields(t *testing.T) {
+	usage := &fakeUsageClient{}
+	data, errs := execute(t, usage, `{
+		costCenter(attributionId: "team:a") { attributionId spendingLimit spendingLimitType billingStrategy dunningState billingPeriodStart }
+	}`)
+	require.Empty(t, errs)
+	require.Equal(t, map[string]interface{}{
+		"attributionId":      "team:a",
+		"spendingLimit":      float64(500),
+		"spendingLimitType":  "HARD",
+		"billingStrategy":    "STRIPE",
+		"dunningState":       "NONE",
+		"billingPeriodStart": "2022-10-01T00:00:00Z",
+	}, data["costCenter"])
+	require.Equal(t, map[string]int{"GetCostCenter": 1}, usage.calls, "the balance must not be fetched unless it is queried")
+}
+
+func TestQuery_FetchesAPageInOneQuery(t *testing.T) {
+	usage := &fakeUsageClient{}
+	data, errs := execute(t, usage, `{
+		costCenter(attributionId: "team:a") { balance { creditsUsed state projectBalances { projectId creditsRemaining } } }
+		sessions(attributionId: "team:a", from: "2022-10-01T00:00:00Z", order: ASCENDING, perPage: 50) {
+			sessions { instanceId credits startTime }
+			totalCreditsUsed
+			pagination { total }
+		}
+		summary(attributionId: "team:a") { creditsUsed creditBalanceAtStart creditBalanceAtEnd }
+	}`)
+	require.Empty(t, errs)
+
+	require.Equal(t, map[string]interface{}{
+		"creditsUsed":     float64(120),
+		"state":           "WITHIN_LIMIT",
+		"projectBalances": []interface{}{map[string]interface{}{"projectId": "project-a", "creditsRemaining": float64(80)}},
+	}, data["costCenter"].(map[string]interface{})["balance"])
+	require.Equal(t, map[string]interface{}{
+		"sessions":         []interface{}{map[string]interface{}{"instanceId": "instance-a", "credits": 3.5, "startTime": "2022-10-02T08:00:00Z"}},
+		"totalCreditsUsed": float64(42),
+		"pagination":       map[string]interface{}{"total": float64(1)},
+	}, data["sessions"])
+	require.Equal(t, map[string]interface{}{
+		"creditsUsed":          float64(42),
+		"creditBalanceAtStart": float64(-10),
+		"creditBalanceAtEnd":   float64(-52),
+	}, data["summary"])
+
+	require.Equal(t, 1, usage.calls["ListUsage"], "the ledger must be listed once for both balances")
+	require.Equal(t, 2, usage.calls["ListBilledUsage"])
+}
+
+func TestQuery_SessionsArguments(t *testing.T) {
+	usage := &fakeUsageClient{}
+	_, errs := execute(t, usage, `{
+		sessions(attributionId: "team:a", from: "2022-10-01T00:00:00Z", to: "2022-10-02T00:00:00Z", order: ASCENDING, page: 2, perPage: 50) { totalCreditsUsed }
+	}`)
+	require.Empty(t, errs)
+
+	req := usage.listBilledUsage
+	require.Equal(t, "team:a", req.GetAttributionId())
+	require.Equal(t, time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC), req.GetFrom().AsTime())
+	require.Equal(t, time.Date(2022, 10, 2, 0, 0, 0, 0, time.UTC), req.GetTo().AsTime())
+	require.Equal(t, v1.ListBilledUsageRequest_ORDERING_ASCENDING, req.GetOrder())
+	require.Equal(t, &v1.PaginatedRequest{Page: 2, PerPage: 50}, req.GetPagination())
+}
+
+func TestQuery_CostCenters(t *testing.T) {
+	usage := &fakeUsageClient{}
+	data, errs := execute(t, usage, `{
+		costCenters(billingStrategy: OTHER, page: 2, perPage: 2) { costCenters { attributionId billingStrategy } pagination { page perPage total totalPages } }
+	}`)
+	require.Empty(t, errs)
+	require.Equal(t, map[string]interface{}{
+		"costCenters": []interface{}{
+			map[string]interface{}{"attributionId": "team:a", "billingStrategy": "OTHER"},
+			map[string]interface{}{"attributionId": "team:b", "billingStrategy": "OTHER"},
+		},
+		"pagination": map[string]interface{}{"page": float64(2), "perPage": float64(2), "total": float64(12), "totalPages": float64(6)},
+	}, data["costCenters"])
+}
+
+func TestQuery_RPCErrors(t *testing.T) {
+	_, errs := execute(t, &fakeUsageClient{}, `{ costCenter(attributionId: "invalid") { attributionId } }`)
+	require.Len(t, errs, 1)
+	require.Equal(t, "Failed to parse attribution ID", errs[0]["message"])
+	require.Equal(t, map[string]interface{}{"code": "InvalidArgument", "reason": "INVALID_ATTRIBUTION_ID"}, errs[0]["extensions"])
+}
+
+func TestQuery_IsReadOnly(t *testing.T) {
+	_, errs := execute(t, &fakeUsageClient{}, `mutation { setSpendingLimit(attributionId: "team:a", spendingLimit: 0) }`)
+	require.NotEmpty(t, errs)
+}
+
+func TestQuery_RejectsDeepQueries(t *testing.T) {
+	schema, err := NewSchema(&fakeUsageClient{})
+	require.NoError(t, err)
+	resp := schema.Exec(context.Background(), `{ costCenters { costCenters { balance { projectBalances { projectId } } } } }`, "", nil)
+	require.Empty(t, resp.Errors, "the deepest query of the schema must be accepted")
+
+	resp = schema.Exec(context.Background(), `{ a: costCenters { costCenters { balance { projectBalances { projectId } } } } b: __schema { types { fields { type { ofType { ofType { name } } } } } } }`, "", nil)
+	require.NotEmpty(t, resp.Errors)
+}
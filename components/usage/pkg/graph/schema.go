@@ -0,0 +1,151 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package graph
+
+// Schema is the schema of the read-only usage GraphQL API. Enum values are the values of the corresponding usage API
+// enums, without their prefix.
+const Schema = `
+schema {
+	query: Query
+}
+
+scalar Time
+
+type Query {
+	# costCenter is the cost center of the attribution ID.
+	costCenter(attributionId: String!): CostCenter!
+	# costCenters lists cost centers, filtered like ListCostCenters.
+	costCenters(billingStrategy: BillingStrategy, overLimit: Boolean, page: Int, perPage: Int): CostCenterList!
+	# balance is the balance of the attribution ID in its current billing period.
+	balance(attributionId: String!): Balance!
+	# sessions lists the billed workspace sessions of the attribution ID. Without from and to, the sessions of the
+	# current billing period are listed.
+	sessions(attributionId: String!, from: Time, to: Time, order: Order, page: Int, perPage: Int): SessionList!
+	# summary summarizes the usage of the attribution ID between from and to. Without from and to, the current billing
+	# period is summarized.
+	summary(attributionId: String!, from: Time, to: Time): Summary!
+}
+
+enum BillingStrategy {
+	UNSPECIFIED
+	STRIPE
+	OTHER
+}
+
+enum SpendingLimitType {
+	UNSPECIFIED
+	SOFT
+	HARD
+}
+
+enum CostCenterState {
+	UNSPECIFIED
+	ACTIVE
+	DISPUTED
+}
+
+enum DunningState {
+	UNSPECIFIED
+	NONE
+	GRACE
+	RESTRICTED
+	SUSPENDED
+}
+
+enum SpendingLimitState {
+	UNSPECIFIED
+	WITHIN_LIMIT
+	GRACE
+	EXCEEDED
+}
+
+enum Order {
+	DESCENDING
+	ASCENDING
+}
+
+type Pagination {
+	page: Int!
+	perPage: Int!
+	totalPages: Int!
+	total: Int!
+}
+
+type CostCenter {
+	attributionId: String!
+	spendingLimit: Int!
+	spendingLimitType: SpendingLimitType!
+	billingStrategy: BillingStrategy!
+	currency: String!
+	billingCycleAnchor: Time
+	billingPeriodStart: Time
+	billingPeriodEnd: Time
+	creditsUsed: Float!
+	state: CostCenterState!
+	dunningState: DunningState!
+	paymentFailedAt: Time
+	rolloverLimit: Int!
+	# balance is the balance of the cost center, it is only fetched when it is queried.
+	balance: Balance!
+}
+
+type CostCenterList {
+	costCenters: [CostCenter!]!
+	pagination: Pagination!
+}
+
+type Balance {
+	creditsUsed: Float!
+	spendingLimit: Int!
+	spendingLimitType: SpendingLimitType!
+	limitReached: Boolean!
+	state: SpendingLimitState!
+	hardLimit: Float!
+	debt: Float!
+	currency: String!
+	amountUsed: Float!
+	creditsCoveredByGrants: Float!
+	creditsGrantedRemaining: Float!
+	billingPeriodStart: Time
+	billingPeriodEnd: Time
+	projectBalances: [ProjectBalance!]!
+}
+
+type ProjectBalance {
+	projectId: String!
+	spendingLimit: Int!
+	creditsUsed: Float!
+	creditsRemaining: Float!
+	limitExceeded: Boolean!
+}
+
+type Session {
+	attributionId: String!
+	userId: String!
+	teamId: String!
+	workspaceId: String!
+	workspaceType: String!
+	projectId: String!
+	instanceId: String!
+	workspaceClass: String!
+	startTime: Time
+	endTime: Time
+	credits: Float!
+}
+
+type SessionList {
+	sessions: [Session!]!
+	totalCreditsUsed: Float!
+	pagination: Pagination!
+}
+
+type Summary {
+	attributionId: String!
+	# creditsUsed is the usage of billed workspace sessions.
+	creditsUsed: Float!
+	creditBalanceAtStart: Float!
+	creditBalanceAtEnd: Float!
+}
+`
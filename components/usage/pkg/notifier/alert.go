@@ -0,0 +1,254 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package notifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+)
+
+// Alert is an event rendered for humans, e.g. as Slack message or email.
+type Alert struct {
+	Subject string
+	Text    string
+}
+
+// AlertChannel delivers alerts, e.g. to Slack or by email.
+type AlertChannel interface {
+	SendAlert(ctx context.Context, alert Alert) error
+}
+
+// AlertTemplate renders the alerts of an event. Subject and Text are text/template templates, which are executed with
+// the WebhookEvent of the alert, e.g. {{.SpendingLimit.CreditsUsed}}. The function date formats times as 2006-01-02.
+type AlertTemplate struct {
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+}
+
+// DefaultAlertTemplates are the templates of the events which are alerted, unless they are overridden.
+var DefaultAlertTemplates = map[string]AlertTemplate{
+	BudgetThresholdReachedEvent: {
+		Subject: `{{.SpendingLimit.AttributionID}} used {{.SpendingLimit.ThresholdPercent}}% of its spending limit`,
+		Text:    `{{printf "%.2f" .SpendingLimit.CreditsUsed}} of {{.SpendingLimit.SpendingLimit}} credits are used in the billing period from {{date .SpendingLimit.BillingPeriodStart}} to {{date .SpendingLimit.BillingPeriodEnd}}.`,
+	},
+	SpendingLimitReachedEvent: {
+		Subject: `{{.SpendingLimit.AttributionID}} reached its spending limit`,
+		Text:    `{{printf "%.2f" .SpendingLimit.CreditsUsed}} of {{.SpendingLimit.SpendingLimit}} credits are used in the billing period from {{date .SpendingLimit.BillingPeriodStart}} to {{date .SpendingLimit.BillingPeriodEnd}}. Workspaces can still be started until {{printf "%.2f" .SpendingLimit.HardLimit}} credits are used.`,
+	},
+	SpendingLimitExceededEvent: {
+		Subject: `{{.SpendingLimit.AttributionID}} exceeded its spending limit`,
+		Text:    `{{printf "%.2f" .SpendingLimit.CreditsUsed}} credits are used in the billing period from {{date .SpendingLimit.BillingPeriodStart}} to {{date .SpendingLimit.BillingPeriodEnd}}, which exceeds the limit of {{printf "%.2f" .SpendingLimit.HardLimit}} credits.{{if eq .SpendingLimit.LimitType "hard"}} New workspaces can not be started until the spending limit is raised, or the next billing period starts.{{end}}`,
+	},
+	ReconciliationFailingEvent: {
+		Subject: `Usage {{.Reconciliation.Reconciler}} reconciliation is failing`,
+		Text:    `The {{.Reconciliation.Reconciler}} reconciliation failed {{.Reconciliation.ConsecutiveFailures}} times in a row since {{.Reconciliation.FailingSince.UTC.Format "2006-01-02 15:04 MST"}}: {{.Reconciliation.LastError}}`,
+	},
+	ReconciliationRecoveredEvent: {
+		Subject: `Usage {{.Reconciliation.Reconciler}} reconciliation recovered`,
+		Text:    `The {{.Reconciliation.Reconciler}} reconciliation succeeded again, after failing since {{.Reconciliation.FailingSince.UTC.Format "2006-01-02 15:04 MST"}}.`,
+	},
+}
+
+// AlertChannelsConfig configures the channels which receive alerts. Any combination of channels can be configured.
+type AlertChannelsConfig struct {
+	// SlackWebhookURLFile is the path to a file containing the URL of a Slack incoming webhook.
+	SlackWebhookURLFile string `json:"slackWebhookURLFile,omitempty"`
+	// EmailRecipients receive alerts by email, through the SMTP server of the AlertConfig.
+	EmailRecipients []string `json:"emailRecipients,omitempty"`
+}
+
+type AlertConfig struct {
+	// SMTP configures the server which sends alerts by email. It is required when there are email recipients.
+	SMTP *SMTPServerConfig `json:"smtp,omitempty"`
+	// Channels receive alerts about reconciliation, and budget alerts of cost centers without channels of their own.
+	Channels AlertChannelsConfig `json:"channels"`
+	// CostCenters configures the channels which receive the budget alerts of a cost center, by attribution ID, instead
+	// of Channels.
+	CostCenters map[string]AlertChannelsConfig `json:"costCenters,omitempty"`
+	// Templates override DefaultAlertTemplates by event, e.g. spending_limit.threshold_reached.
+	Templates map[string]AlertTemplate `json:"templates,omitempty"`
+}
+
+type alertTemplate struct {
+	subject *template.Template
+	text    *template.Template
+}
+
+// Alerter sends budget alerts and alerts about failing reconciliations to the channels configured for the installation,
+// and to channels configured for individual cost centers.
+type Alerter struct {
+	channels    []AlertChannel
+	costCenters map[string][]AlertChannel
+	templates   map[string]alertTemplate
+}
+
+func NewAlerter(cfg AlertConfig) (*Alerter, error) {
+	templates, err := parseAlertTemplates(cfg.Templates)
+	if err != nil {
+		return nil, err
+	}
+
+	channels, err := newAlertChannels(cfg.SMTP, cfg.Channels)
+	if err != nil {
+		return nil, err
+	}
+	costCenters := map[string][]AlertChannel{}
+	for attributionID, channelsCfg := range cfg.CostCenters {
+		if _, err := db.ParseAttributionID(attributionID); err != nil {
+			return nil, fmt.Errorf("invalid attribution ID of alert channels %q: %w", attributionID, err)
+		}
+		costCenterChannels, err := newAlertChannels(cfg.SMTP, channelsCfg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid alert channels of %s: %w", attributionID, err)
+		}
+		if len(costCenterChannels) == 0 {
+			return nil, fmt.Errorf("no alert channels of %s specified", attributionID)
+		}
+		costCenters[attributionID] = costCenterChannels
+	}
+	if len(channels) == 0 && len(costCenters) == 0 {
+		return nil, errors.New("no alert channels specified")
+	}
+
+	return &Alerter{
+		channels:    channels,
+		costCenters: costCenters,
+		templates:   templates,
+	}, nil
+}
+
+func newAlertChannels(smtpCfg *SMTPServerConfig, cfg AlertChannelsConfig) ([]AlertChannel, error) {
+	var channels []AlertChannel
+	if cfg.SlackWebhookURLFile != "" {
+		slack, err := NewSlack(cfg.SlackWebhookURLFile)
+		if err != nil {
+			return nil, err
+		}
+		channels = append(channels, slack)
+	}
+	if len(cfg.EmailRecipients) > 0 {
+		if smtpCfg == nil {
+			return nil, errors.New("email recipients require an SMTP server")
+		}
+		email, err := NewEmail(*smtpCfg, cfg.EmailRecipients)
+		if err != nil {
+			return nil, err
+		}
+		channels = append(channels, email)
+	}
+	return channels, nil
+}
+
+func parseAlertTemplates(overrides map[string]AlertTemplate) (map[string]alertTemplate, error) {
+	funcs := template.FuncMap{
+		"date": func(t time.Time) string {
+			return t.UTC().Format("2006-01-02")
+		},
+	}
+
+	templates := map[string]alertTemplate{}
+	for event, tmpl := range DefaultAlertTemplates {
+		if override, ok := overrides[event]; ok {
+			tmpl = override
+		}
+		subject, err := template.New(event + ".subject").Funcs(funcs).Parse(tmpl.Subject)
+		if err != nil {
+			return nil, fmt.Errorf("invalid alert subject template of %s: %w", event, err)
+		}
+		text, err := template.New(event + ".text").Funcs(funcs).Parse(tmpl.Text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid alert text template of %s: %w", event, err)
+		}
+		templates[event] = alertTemplate{subject: subject, text: text}
+	}
+	for event := range overrides {
+		if _, ok := DefaultAlertTemplates[event]; !ok {
+			return nil, fmt.Errorf("alert template of unknown event %s", event)
+		}
+	}
+	return templates, nil
+}
+
+func (a *Alerter) render(event WebhookEvent) (Alert, error) {
+	tmpl, ok := a.templates[event.Event]
+	if !ok {
+		return Alert{}, fmt.Errorf("no alert template of event %s", event.Event)
+	}
+
+	subject := &strings.Builder{}
+	if err := tmpl.subject.Execute(subject, event); err != nil {
+		return Alert{}, fmt.Errorf("failed to render alert subject of %s: %w", event.Event, err)
+	}
+	text := &strings.Builder{}
+	if err := tmpl.text.Execute(text, event); err != nil {
+		return Alert{}, fmt.Errorf("failed to render alert text of %s: %w", event.Event, err)
+	}
+	// Subjects are single lines, line breaks would break email headers.
+	return Alert{
+		Subject: strings.Join(strings.Fields(subject.String()), " "),
+		Text:    text.String(),
+	}, nil
+}
+
+// send renders the event and sends it to every channel, even when sending to one of them fails. Events of a cost
+// center are sent to its own channels when it has any, otherwise to the channels of the installation.
+func (a *Alerter) send(ctx context.Context, attributionID string, event WebhookEvent) error {
+	channels := a.channels
+	if costCenterChannels, ok := a.costCenters[attributionID]; ok {
+		channels = costCenterChannels
+	}
+	if len(channels) == 0 {
+		return nil
+	}
+
+	alert, err := a.render(event)
+	if err != nil {
+		return err
+	}
+
+	var failed int
+	var lastErr error
+	for _, channel := range channels {
+		if err := channel.SendAlert(ctx, alert); err != nil {
+			failed++
+			lastErr = err
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to send %s alert to %d of %d channels: %w", event.Event, failed, len(channels), lastErr)
+	}
+	return nil
+}
+
+// NotifySpendingLimitReached alerts that the cost center reached its spending limit.
+func (a *Alerter) NotifySpendingLimitReached(ctx context.Context, limit SpendingLimit) error {
+	return a.send(ctx, limit.AttributionID, WebhookEvent{Event: SpendingLimitReachedEvent, SpendingLimit: &limit})
+}
+
+// NotifySpendingLimitExceeded alerts that the cost center exceeded its spending limit including the grace margin.
+func (a *Alerter) NotifySpendingLimitExceeded(ctx context.Context, limit SpendingLimit) error {
+	return a.send(ctx, limit.AttributionID, WebhookEvent{Event: SpendingLimitExceededEvent, SpendingLimit: &limit})
+}
+
+// NotifyBudgetThresholdReached alerts that the cost center reached limit.ThresholdPercent of its spending limit.
+func (a *Alerter) NotifyBudgetThresholdReached(ctx context.Context, limit SpendingLimit) error {
+	return a.send(ctx, limit.AttributionID, WebhookEvent{Event: BudgetThresholdReachedEvent, SpendingLimit: &limit})
+}
+
+// NotifyReconciliationFailing alerts the channels of the installation that a reconciliation keeps failing.
+func (a *Alerter) NotifyReconciliationFailing(ctx context.Context, failure ReconciliationFailure) error {
+	return a.send(ctx, "", WebhookEvent{Event: ReconciliationFailingEvent, Reconciliation: &failure})
+}
+
+// NotifyReconciliationRecovered alerts the channels of the installation that a reconciliation recovered.
+func (a *Alerter) NotifyReconciliationRecovered(ctx context.Context, failure ReconciliationFailure) error {
+	return a.send(ctx, "", WebhookEvent{Event: ReconciliationRecoveredEvent, Reconciliation: &failure})
+}
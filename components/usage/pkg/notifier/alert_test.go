@@ -0,0 +1,136 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package notifier
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingAlertChannel struct {
+	alerts []Alert
+	err    error
+}
+
+func (c *recordingAlertChannel) SendAlert(ctx context.Context, alert Alert) error {
+	c.alerts = append(c.alerts, alert)
+	return c.err
+}
+
+func TestAlerter_RoutesBudgetAlertsToCostCenterChannels(t *testing.T) {
+	routed := string(db.NewTeamAttributionID(uuid.New().String()))
+	other := string(db.NewTeamAttributionID(uuid.New().String()))
+
+	templates, err := parseAlertTemplates(nil)
+	require.NoError(t, err)
+	installation := &recordingAlertChannel{}
+	costCenter := &recordingAlertChannel{}
+	alerter := &Alerter{
+		channels:    []AlertChannel{installation},
+		costCenters: map[string][]AlertChannel{routed: {costCenter}},
+		templates:   templates,
+	}
+
+	limit := SpendingLimit{
+		AttributionID:      routed,
+		SpendingLimit:      100,
+		LimitType:          "hard",
+		HardLimit:          110,
+		CreditsUsed:        80.5,
+		BillingPeriodStart: time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC),
+		BillingPeriodEnd:   time.Date(2022, 11, 1, 0, 0, 0, 0, time.UTC),
+		ThresholdPercent:   80,
+	}
+	require.NoError(t, alerter.NotifyBudgetThresholdReached(context.Background(), limit))
+	require.Empty(t, installation.alerts, "must not alert the installation about cost centers with channels of their own")
+	require.Equal(t, []Alert{{
+		Subject: routed + " used 80% of its spending limit",
+		Text:    "80.50 of 100 credits are used in the billing period from 2022-10-01 to 2022-11-01.",
+	}}, costCenter.alerts)
+
+	limit.AttributionID = other
+	limit.CreditsUsed = 111
+	require.NoError(t, alerter.NotifySpendingLimitExceeded(context.Background(), limit))
+	require.Len(t, installation.alerts, 1)
+	require.Equal(t, other+" exceeded its spending limit", installation.alerts[0].Subject)
+	require.Contains(t, installation.alerts[0].Text, "New workspaces can not be started")
+
+	failure := ReconciliationFailure{Reconciler: "ledger", ConsecutiveFailures: 3, LastError: "database unavailable", FailingSince: time.Date(2022, 10, 15, 8, 0, 0, 0, time.UTC)}
+	require.NoError(t, alerter.NotifyReconciliationFailing(context.Background(), failure))
+	require.Len(t, installation.alerts, 2)
+	require.Equal(t, Alert{
+		Subject: "Usage ledger reconciliation is failing",
+		Text:    "The ledger reconciliation failed 3 times in a row since 2022-10-15 08:00 UTC: database unavailable",
+	}, installation.alerts[1])
+	require.Len(t, costCenter.alerts, 1, "must alert reconciliation only to the installation")
+}
+
+func TestAlerter_SendsToAllChannelsWhenOneFails(t *testing.T) {
+	templates, err := parseAlertTemplates(nil)
+	require.NoError(t, err)
+	failing := &recordingAlertChannel{err: errors.New("unavailable")}
+	working := &recordingAlertChannel{}
+	alerter := &Alerter{channels: []AlertChannel{failing, working}, templates: templates}
+
+	err = alerter.NotifyReconciliationRecovered(context.Background(), ReconciliationFailure{Reconciler: "ledger"})
+	require.ErrorContains(t, err, "1 of 2 channels")
+	require.Len(t, working.alerts, 1)
+}
+
+func TestAlerter_TemplateOverrides(t *testing.T) {
+	templates, err := parseAlertTemplates(map[string]AlertTemplate{
+		SpendingLimitReachedEvent: {
+			Subject: "Budget of\n{{.SpendingLimit.AttributionID}}",
+			Text:    "Used {{.SpendingLimit.CreditsUsed}} credits until {{date .SpendingLimit.BillingPeriodEnd}}.",
+		},
+	})
+	require.NoError(t, err)
+	channel := &recordingAlertChannel{}
+	alerter := &Alerter{channels: []AlertChannel{channel}, templates: templates}
+
+	require.NoError(t, alerter.NotifySpendingLimitReached(context.Background(), SpendingLimit{
+		AttributionID:    "team:a",
+		CreditsUsed:      100,
+		BillingPeriodEnd: time.Date(2022, 11, 1, 0, 0, 0, 0, time.UTC),
+	}))
+	require.Equal(t, []Alert{{Subject: "Budget of team:a", Text: "Used 100 credits until 2022-11-01."}}, channel.alerts, "subjects must be a single line")
+
+	_, err = parseAlertTemplates(map[string]AlertTemplate{"unknown.event": {Subject: "a", Text: "b"}})
+	require.Error(t, err)
+	_, err = parseAlertTemplates(map[string]AlertTemplate{SpendingLimitReachedEvent: {Subject: "{{.Missing", Text: "b"}})
+	require.Error(t, err)
+}
+
+func TestNewAlerter_Validation(t *testing.T) {
+	urlFile := filepath.Join(t.TempDir(), "slack")
+	require.NoError(t, os.WriteFile(urlFile, []byte("https://hooks.slack.example.com/services/a\n"), 0600))
+	team := string(db.NewTeamAttributionID(uuid.New().String()))
+
+	_, err := NewAlerter(AlertConfig{})
+	require.Error(t, err, "must require channels")
+
+	_, err = NewAlerter(AlertConfig{Channels: AlertChannelsConfig{EmailRecipients: []string{"ops@example.com"}}})
+	require.Error(t, err, "must require an SMTP server for email recipients")
+
+	_, err = NewAlerter(AlertConfig{CostCenters: map[string]AlertChannelsConfig{"not-an-attribution-id": {SlackWebhookURLFile: urlFile}}})
+	require.Error(t, err)
+
+	alerter, err := NewAlerter(AlertConfig{
+		SMTP:        &SMTPServerConfig{Address: "smtp.example.com:587", From: "usage@example.com"},
+		Channels:    AlertChannelsConfig{SlackWebhookURLFile: urlFile},
+		CostCenters: map[string]AlertChannelsConfig{team: {EmailRecipients: []string{"billing@example.com"}}},
+	})
+	require.NoError(t, err)
+	require.Len(t, alerter.channels, 1)
+	require.Len(t, alerter.costCenters[team], 1)
+}
@@ -0,0 +1,223 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/streadway/amqp"
+)
+
+// DefaultUsageEventsExchange is the topic exchange which usage events are published to, with their event as routing
+// key, such that consumers bind queues to e.g. usage.invoice.* or usage.#.
+const DefaultUsageEventsExchange = "gitpod.usage"
+
+const (
+	// UsageInstanceBilledEvent is published when the usage of a stopped workspace instance is finalized in the ledger.
+	UsageInstanceBilledEvent = "usage.instance.billed"
+	// UsageDraftFinalizedEvent is published when a stale draft, whose workspace instance is gone, is finalized.
+	UsageDraftFinalizedEvent = "usage.draft.finalized"
+	// UsageInvoiceRecordedEvent is published when a finalized invoice is credited in the ledger.
+	UsageInvoiceRecordedEvent = "usage.invoice.recorded"
+)
+
+type MessageBusConfig struct {
+	// URL is the AMQP URL of the message bus, without credentials, e.g. amqp://messagebus:5672.
+	URL      string `json:"url"`
+	Username string `json:"username"`
+	// PasswordFile is the path to a file containing the password of Username.
+	PasswordFile string `json:"passwordFile"`
+	// Exchange is the topic exchange which events are published to. When Exchange is empty,
+	// DefaultUsageEventsExchange applies.
+	Exchange string `json:"exchange,omitempty"`
+}
+
+// UsageEvent describes a usage entry which was written to the ledger.
+type UsageEvent struct {
+	Event         string    `json:"event"`
+	UsageID       string    `json:"usageId"`
+	AttributionID string    `json:"attributionId"`
+	Kind          string    `json:"kind"`
+	Credits       float64   `json:"credits"`
+	EffectiveTime time.Time `json:"effectiveTime"`
+	// WorkspaceInstanceID and ProjectID are only set for workspace instance usage.
+	WorkspaceInstanceID string `json:"workspaceInstanceId,omitempty"`
+	ProjectID           string `json:"projectId,omitempty"`
+	// InvoiceID is only set for invoice usage.
+	InvoiceID string `json:"invoiceId,omitempty"`
+}
+
+// NewUsageEvent describes the usage entry as event.
+func NewUsageEvent(event string, usage db.Usage) UsageEvent {
+	e := UsageEvent{
+		Event:         event,
+		UsageID:       usage.ID.String(),
+		AttributionID: string(usage.AttributionID),
+		Kind:          string(usage.Kind),
+		Credits:       usage.CreditCents.ToCredits(),
+		EffectiveTime: usage.EffectiveTime.Time(),
+	}
+	switch usage.Kind {
+	case db.WorkspaceInstanceUsageKind:
+		e.WorkspaceInstanceID = usage.WorkspaceInstanceID.String()
+		e.ProjectID = usage.ProjectID
+	case db.InvoiceUsageKind:
+		var data db.InvoiceUsageData
+		if err := json.Unmarshal(usage.Metadata, &data); err == nil {
+			e.InvoiceID = data.InvoiceID
+		}
+	}
+	return e
+}
+
+// MessageBus publishes usage events to a topic exchange of an AMQP message bus, like the Gitpod message bus. The
+// connection is established on the first publish, and re-established after it failed.
+type MessageBus struct {
+	url      string
+	exchange string
+
+	mu       sync.Mutex
+	conn     *amqp.Connection
+	channel  *amqp.Channel
+	confirms chan amqp.Confirmation
+}
+
+func NewMessageBus(cfg MessageBusConfig) (*MessageBus, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid message bus URL %q", cfg.URL)
+	}
+	if cfg.Username == "" {
+		return nil, errors.New("no message bus username specified")
+	}
+	password, err := os.ReadFile(cfg.PasswordFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read message bus password: %w", err)
+	}
+	u.User = url.UserPassword(cfg.Username, string(bytes.TrimSpace(password)))
+
+	exchange := cfg.Exchange
+	if exchange == "" {
+		exchange = DefaultUsageEventsExchange
+	}
+	return &MessageBus{
+		url:      u.String(),
+		exchange: exchange,
+	}, nil
+}
+
+// PublishUsageEvents publishes the events, and waits until the message bus confirmed them. Events are persistent, and
+// identified by their event and usage ID, such that consumers can deduplicate events which are published again.
+func (m *MessageBus) PublishUsageEvents(ctx context.Context, events ...UsageEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	err := m.connect()
+	if err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		body, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("failed to marshal usage event: %w", err)
+		}
+		err = m.channel.Publish(m.exchange, event.Event, false, false, amqp.Publishing{
+			ContentType:  "application/json",
+			DeliveryMode: amqp.Persistent,
+			MessageId:    event.Event + "/" + event.UsageID,
+			Timestamp:    time.Now(),
+			Body:         body,
+		})
+		if err != nil {
+			m.reset()
+			return fmt.Errorf("failed to publish usage event: %w", err)
+		}
+	}
+
+	for range events {
+		select {
+		case confirm, ok := <-m.confirms:
+			if !ok {
+				m.reset()
+				return errors.New("message bus channel was closed before usage events were confirmed")
+			}
+			if !confirm.Ack {
+				return errors.New("message bus rejected usage event")
+			}
+		case <-ctx.Done():
+			// Confirms of the events would be mistaken for confirms of later events on the same channel.
+			m.reset()
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (m *MessageBus) connect() error {
+	if m.channel != nil {
+		return nil
+	}
+
+	conn, err := amqp.Dial(m.url)
+	if err != nil {
+		return fmt.Errorf("failed to connect to message bus: %w", err)
+	}
+	channel, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to open message bus channel: %w", err)
+	}
+	err = channel.Confirm(false)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to enable publisher confirms: %w", err)
+	}
+	err = channel.ExchangeDeclare(m.exchange, amqp.ExchangeTopic, true, false, false, false, nil)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to declare exchange %s: %w", m.exchange, err)
+	}
+
+	m.conn = conn
+	m.channel = channel
+	m.confirms = channel.NotifyPublish(make(chan amqp.Confirmation, 100))
+	return nil
+}
+
+func (m *MessageBus) reset() {
+	if m.conn != nil {
+		_ = m.conn.Close()
+	}
+	m.conn = nil
+	m.channel = nil
+	m.confirms = nil
+}
+
+// Close closes the connection to the message bus.
+func (m *MessageBus) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.conn == nil {
+		return nil
+	}
+	err := m.conn.Close()
+	m.reset()
+	return err
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// DefaultPagerDutyEventsURL is the endpoint of the PagerDuty Events API v2.
+const DefaultPagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+type PagerDutyConfig struct {
+	// RoutingKeyFile is the path to a file containing the integration key of the PagerDuty service.
+	RoutingKeyFile string `json:"routingKeyFile"`
+	// URL is the endpoint of the Events API. When URL is empty, DefaultPagerDutyEventsURL applies.
+	URL string `json:"url,omitempty"`
+}
+
+// PagerDuty triggers incidents through the PagerDuty Events API v2, and resolves them.
+type PagerDuty struct {
+	url        string
+	routingKey string
+
+	client *http.Client
+}
+
+func NewPagerDuty(cfg PagerDutyConfig) (*PagerDuty, error) {
+	routingKey, err := os.ReadFile(cfg.RoutingKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PagerDuty routing key: %w", err)
+	}
+	routingKey = bytes.TrimSpace(routingKey)
+	if len(routingKey) == 0 {
+		return nil, errors.New("PagerDuty routing key is empty")
+	}
+
+	url := cfg.URL
+	if url == "" {
+		url = DefaultPagerDutyEventsURL
+	}
+	return &PagerDuty{
+		url:        url,
+		routingKey: string(routingKey),
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+type pagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *pagerDutyPayload `json:"payload,omitempty"`
+}
+
+type pagerDutyPayload struct {
+	Summary       string      `json:"summary"`
+	Source        string      `json:"source"`
+	Severity      string      `json:"severity"`
+	Timestamp     time.Time   `json:"timestamp"`
+	Component     string      `json:"component"`
+	Group         string      `json:"group"`
+	CustomDetails interface{} `json:"custom_details,omitempty"`
+}
+
+// NotifyReconciliationFailing triggers a critical incident for the reconciler. Repeated triggers for the same
+// reconciler are deduplicated into one incident.
+func (p *PagerDuty) NotifyReconciliationFailing(ctx context.Context, failure ReconciliationFailure) error {
+	return p.enqueue(ctx, pagerDutyEvent{
+		RoutingKey:  p.routingKey,
+		EventAction: "trigger",
+		DedupKey:    reconciliationDedupKey(failure.Reconciler),
+		Payload: &pagerDutyPayload{
+			Summary:       fmt.Sprintf("Usage %s reconciliation failed %d times in a row: %s", failure.Reconciler, failure.ConsecutiveFailures, failure.LastError),
+			Source:        "usage",
+			Severity:      "critical",
+			Timestamp:     failure.LastFailureAt,
+			Component:     "usage",
+			Group:         "reconciliation",
+			CustomDetails: failure,
+		},
+	})
+}
+
+// NotifyReconciliationRecovered resolves the incident of the reconciler.
+func (p *PagerDuty) NotifyReconciliationRecovered(ctx context.Context, failure ReconciliationFailure) error {
+	return p.enqueue(ctx, pagerDutyEvent{
+		RoutingKey:  p.routingKey,
+		EventAction: "resolve",
+		DedupKey:    reconciliationDedupKey(failure.Reconciler),
+	})
+}
+
+func (p *PagerDuty) enqueue(ctx context.Context, event pagerDutyEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal PagerDuty event: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to construct PagerDuty request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to make PagerDuty request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("PagerDuty returned unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func reconciliationDedupKey(reconciler string) string {
+	return "gitpod-usage-reconciliation-" + reconciler
+}
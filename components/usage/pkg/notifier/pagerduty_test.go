@@ -0,0 +1,88 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestPagerDuty(t *testing.T, url string) *PagerDuty {
+	t.Helper()
+
+	routingKeyFile := filepath.Join(t.TempDir(), "routing-key")
+	require.NoError(t, os.WriteFile(routingKeyFile, []byte("r0ut1ng\n"), 0600))
+
+	pagerDuty, err := NewPagerDuty(PagerDutyConfig{RoutingKeyFile: routingKeyFile, URL: url})
+	require.NoError(t, err)
+	return pagerDuty
+}
+
+func TestPagerDuty_TriggersAndResolvesIncident(t *testing.T) {
+	var received []map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+		received = append(received, event)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	pagerDuty := newTestPagerDuty(t, srv.URL)
+	failure := ReconciliationFailure{
+		Reconciler:          "ledger",
+		ConsecutiveFailures: 3,
+		LastError:           "failed to reconcile usage with ledger",
+		FailingSince:        time.Date(2022, 10, 7, 10, 0, 0, 0, time.UTC),
+		LastFailureAt:       time.Date(2022, 10, 7, 12, 0, 0, 0, time.UTC),
+	}
+	require.NoError(t, pagerDuty.NotifyReconciliationFailing(context.Background(), failure))
+	require.NoError(t, pagerDuty.NotifyReconciliationRecovered(context.Background(), failure))
+
+	require.Len(t, received, 2)
+
+	trigger := received[0]
+	require.Equal(t, "r0ut1ng", trigger["routing_key"])
+	require.Equal(t, "trigger", trigger["event_action"])
+	require.Equal(t, "gitpod-usage-reconciliation-ledger", trigger["dedup_key"])
+	payload := trigger["payload"].(map[string]interface{})
+	require.Equal(t, "critical", payload["severity"])
+	require.Equal(t, "Usage ledger reconciliation failed 3 times in a row: failed to reconcile usage with ledger", payload["summary"])
+	require.Equal(t, "2022-10-07T12:00:00Z", payload["timestamp"])
+	require.Equal(t, "ledger", payload["custom_details"].(map[string]interface{})["reconciler"])
+
+	resolve := received[1]
+	require.Equal(t, "resolve", resolve["event_action"])
+	require.Equal(t, "gitpod-usage-reconciliation-ledger", resolve["dedup_key"])
+	require.NotContains(t, resolve, "payload")
+}
+
+func TestPagerDuty_FailsOnUnexpectedStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	err := newTestPagerDuty(t, srv.URL).NotifyReconciliationFailing(context.Background(), ReconciliationFailure{Reconciler: "ledger"})
+	require.Error(t, err)
+}
+
+func TestNewPagerDuty_Validation(t *testing.T) {
+	_, err := NewPagerDuty(PagerDutyConfig{RoutingKeyFile: filepath.Join(t.TempDir(), "missing")})
+	require.Error(t, err)
+
+	empty := filepath.Join(t.TempDir(), "empty")
+	require.NoError(t, os.WriteFile(empty, []byte("\n"), 0600))
+	_, err = NewPagerDuty(PagerDutyConfig{RoutingKeyFile: empty})
+	require.Error(t, err)
+}
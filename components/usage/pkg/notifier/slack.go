@@ -0,0 +1,76 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Slack posts alerts to a channel through a Slack incoming webhook.
+type Slack struct {
+	url    string
+	client *http.Client
+}
+
+// NewSlack creates a Slack channel for the incoming webhook whose URL is stored in the file at webhookURLFile. The URL
+// is a secret, anyone who knows it can post to the channel.
+func NewSlack(webhookURLFile string) (*Slack, error) {
+	b, err := os.ReadFile(webhookURLFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Slack webhook URL: %w", err)
+	}
+	webhookURL := strings.TrimSpace(string(b))
+	if webhookURL == "" {
+		return nil, errors.New("Slack webhook URL is empty")
+	}
+	u, err := url.Parse(webhookURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, errors.New("Slack webhook URL must be an http(s) URL")
+	}
+
+	return &Slack{
+		url:    webhookURL,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+type slackMessage struct {
+	Text string `json:"text"`
+}
+
+// SendAlert posts the alert as one message, with the subject in bold.
+func (s *Slack) SendAlert(ctx context.Context, alert Alert) error {
+	body, err := json.Marshal(slackMessage{Text: fmt.Sprintf("*%s*\n%s", alert.Subject, alert.Text)})
+	if err != nil {
+		return fmt.Errorf("failed to marshal Slack message: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to construct Slack request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		// The error contains the URL, which must not be logged.
+		return errors.New("failed to make Slack request")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Slack returned unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
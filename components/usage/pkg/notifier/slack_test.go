@@ -0,0 +1,59 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlack_SendAlert(t *testing.T) {
+	var received slackMessage
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+	}))
+	defer srv.Close()
+
+	urlFile := filepath.Join(t.TempDir(), "slack")
+	require.NoError(t, os.WriteFile(urlFile, []byte(srv.URL+"\n"), 0600))
+	slack, err := NewSlack(urlFile)
+	require.NoError(t, err)
+
+	require.NoError(t, slack.SendAlert(context.Background(), Alert{Subject: "Budget reached", Text: "80 of 100 credits are used."}))
+	require.Equal(t, "*Budget reached*\n80 of 100 credits are used.", received.Text)
+}
+
+func TestSlack_FailsOnUnexpectedStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid_token", http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	urlFile := filepath.Join(t.TempDir(), "slack")
+	require.NoError(t, os.WriteFile(urlFile, []byte(srv.URL), 0600))
+	slack, err := NewSlack(urlFile)
+	require.NoError(t, err)
+
+	err = slack.SendAlert(context.Background(), Alert{Subject: "a", Text: "b"})
+	require.ErrorContains(t, err, "403")
+}
+
+func TestNewSlack_Validation(t *testing.T) {
+	_, err := NewSlack(filepath.Join(t.TempDir(), "missing"))
+	require.Error(t, err)
+
+	urlFile := filepath.Join(t.TempDir(), "slack")
+	require.NoError(t, os.WriteFile(urlFile, []byte("hooks.slack.com/services/a"), 0600))
+	_, err = NewSlack(urlFile)
+	require.Error(t, err)
+}
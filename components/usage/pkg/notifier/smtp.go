@@ -0,0 +1,300 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package notifier
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gitpod-io/gitpod/common-go/log"
+	"github.com/gitpod-io/gitpod/usage/pkg/contentservice"
+)
+
+// SMTPConfig configures delivery of usage reports by email.
+// Amazon SES is supported through its SMTP interface, for example with an Address of email-smtp.eu-west-1.amazonaws.com:587.
+type SMTPConfig struct {
+	// Address is the host:port of the SMTP server.
+	Address string `json:"address"`
+
+	Username string `json:"username,omitempty"`
+	// PasswordFile is the path to a file containing the SMTP password.
+	PasswordFile string `json:"passwordFile,omitempty"`
+
+	From string `json:"from"`
+
+	// BillingContacts are the email addresses which receive the monthly usage report.
+	BillingContacts []string `json:"billingContacts"`
+
+	// MaxAttachmentSizeBytes is the largest compressed report which is attached to the email.
+	// Larger reports are linked instead. When zero, reports are always linked.
+	MaxAttachmentSizeBytes int64 `json:"maxAttachmentSizeBytes,omitempty"`
+}
+
+type sendMailFunc func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+
+// ReportNotifier emails usage reports to billing contacts.
+type ReportNotifier struct {
+	cfg            SMTPConfig
+	auth           smtp.Auth
+	contentService contentservice.Interface
+
+	nowFunc  func() time.Time
+	sendMail sendMailFunc
+}
+
+func NewReportNotifier(cfg SMTPConfig, contentService contentservice.Interface) (*ReportNotifier, error) {
+	if cfg.Address == "" {
+		return nil, errors.New("no SMTP address specified")
+	}
+	if cfg.From == "" {
+		return nil, errors.New("no sender address specified")
+	}
+	if len(cfg.BillingContacts) == 0 {
+		return nil, errors.New("no billing contacts specified")
+	}
+
+	auth, err := newSMTPAuth(cfg.Address, cfg.Username, cfg.PasswordFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ReportNotifier{
+		cfg:            cfg,
+		auth:           auth,
+		contentService: contentService,
+		nowFunc:        time.Now,
+		sendMail:       smtp.SendMail,
+	}, nil
+}
+
+// newSMTPAuth returns the authentication for the SMTP server at address, or nil when username is empty.
+func newSMTPAuth(address, username, passwordFile string) (smtp.Auth, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SMTP address %q: %w", address, err)
+	}
+	if username == "" {
+		return nil, nil
+	}
+
+	password, err := os.ReadFile(passwordFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SMTP password: %w", err)
+	}
+	return smtp.PlainAuth("", username, strings.TrimSpace(string(password)), host), nil
+}
+
+// NotifyUsageReport emails the report with the given ID to all billing contacts.
+func (n *ReportNotifier) NotifyUsageReport(ctx context.Context, reportID string) error {
+	report, err := n.contentService.DownloadUsageReport(ctx, reportID)
+	if err != nil {
+		return fmt.Errorf("failed to download usage report %s: %w", reportID, err)
+	}
+
+	compressed, err := compressReport(report)
+	if err != nil {
+		return err
+	}
+
+	var downloadURL string
+	attach := int64(len(compressed)) <= n.cfg.MaxAttachmentSizeBytes
+	if !attach {
+		downloadURL, err = n.contentService.ReportDownloadURL(ctx, reportID)
+		if err != nil {
+			return fmt.Errorf("failed to get download URL for usage report %s: %w", reportID, err)
+		}
+	}
+
+	var attachment []byte
+	if attach {
+		attachment = compressed
+	}
+	msg, err := n.composeMessage(reportID, report, downloadURL, attachment)
+	if err != nil {
+		return fmt.Errorf("failed to compose email: %w", err)
+	}
+
+	log.WithField("reportId", reportID).WithField("attached", attach).Info("Emailing usage report to billing contacts.")
+	err = n.sendMail(n.cfg.Address, n.auth, n.cfg.From, n.cfg.BillingContacts, msg)
+	if err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+
+	return nil
+}
+
+func (n *ReportNotifier) composeMessage(reportID string, report contentservice.UsageReport, downloadURL string, attachment []byte) ([]byte, error) {
+	msg := &bytes.Buffer{}
+	mw := multipart.NewWriter(msg)
+
+	headers := []string{
+		fmt.Sprintf("From: %s", n.cfg.From),
+		fmt.Sprintf("To: %s", strings.Join(n.cfg.BillingContacts, ", ")),
+		fmt.Sprintf("Subject: Gitpod usage report for %s", report.From.UTC().Format("January 2006")),
+		fmt.Sprintf("Date: %s", n.nowFunc().UTC().Format(time.RFC1123Z)),
+		"MIME-Version: 1.0",
+		fmt.Sprintf("Content-Type: multipart/mixed; boundary=%q", mw.Boundary()),
+	}
+	msg.WriteString(strings.Join(headers, "\r\n") + "\r\n\r\n")
+
+	var totalCreditsUsed float64
+	for _, record := range report.UsageRecords {
+		totalCreditsUsed += record.CreditsUsed
+	}
+
+	body := &strings.Builder{}
+	fmt.Fprintf(body, "Usage report for %s to %s.\r\n\r\n", report.From.UTC().Format(time.RFC3339), report.To.UTC().Format(time.RFC3339))
+	fmt.Fprintf(body, "Usage records: %d\r\n", len(report.UsageRecords))
+	fmt.Fprintf(body, "Total credits used: %.2f\r\n", totalCreditsUsed)
+	fmt.Fprintf(body, "Invalid sessions: %d\r\n\r\n", len(report.InvalidSessions))
+	if attachment != nil {
+		fmt.Fprintf(body, "The full report is attached as %s.\r\n", reportID)
+	} else {
+		fmt.Fprintf(body, "The full report can be downloaded from %s\r\n", downloadURL)
+	}
+
+	textPart, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {"text/plain; charset=utf-8"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	_, err = textPart.Write([]byte(body.String()))
+	if err != nil {
+		return nil, err
+	}
+
+	if attachment != nil {
+		attachmentPart, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {"application/gzip"},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {fmt.Sprintf("attachment; filename=%q", reportID)},
+		})
+		if err != nil {
+			return nil, err
+		}
+		_, err = attachmentPart.Write(wrapBase64(attachment))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = mw.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return msg.Bytes(), nil
+}
+
+func compressReport(report contentservice.UsageReport) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	err := json.NewEncoder(gz).Encode(report)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal report to JSON: %w", err)
+	}
+	err = gz.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to compress usage report: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// wrapBase64 encodes data as base64 with lines no longer than 76 characters, as required by RFC 2045.
+func wrapBase64(data []byte) []byte {
+	const lineLength = 76
+
+	encoded := base64.StdEncoding.EncodeToString(data)
+	wrapped := &bytes.Buffer{}
+	for len(encoded) > lineLength {
+		wrapped.WriteString(encoded[:lineLength] + "\r\n")
+		encoded = encoded[lineLength:]
+	}
+	wrapped.WriteString(encoded + "\r\n")
+
+	return wrapped.Bytes()
+}
+
+// SMTPServerConfig configures the SMTP server which sends alerts by email.
+type SMTPServerConfig struct {
+	// Address is the host:port of the SMTP server.
+	Address string `json:"address"`
+
+	Username string `json:"username,omitempty"`
+	// PasswordFile is the path to a file containing the SMTP password.
+	PasswordFile string `json:"passwordFile,omitempty"`
+
+	From string `json:"from"`
+}
+
+// Email sends alerts as plain text emails to a fixed list of recipients.
+type Email struct {
+	cfg        SMTPServerConfig
+	auth       smtp.Auth
+	recipients []string
+
+	nowFunc  func() time.Time
+	sendMail sendMailFunc
+}
+
+func NewEmail(cfg SMTPServerConfig, recipients []string) (*Email, error) {
+	if cfg.Address == "" {
+		return nil, errors.New("no SMTP address specified")
+	}
+	if cfg.From == "" {
+		return nil, errors.New("no sender address specified")
+	}
+	if len(recipients) == 0 {
+		return nil, errors.New("no email recipients specified")
+	}
+
+	auth, err := newSMTPAuth(cfg.Address, cfg.Username, cfg.PasswordFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Email{
+		cfg:        cfg,
+		auth:       auth,
+		recipients: recipients,
+		nowFunc:    time.Now,
+		sendMail:   smtp.SendMail,
+	}, nil
+}
+
+// SendAlert emails the alert to all recipients.
+func (e *Email) SendAlert(ctx context.Context, alert Alert) error {
+	headers := []string{
+		fmt.Sprintf("From: %s", e.cfg.From),
+		fmt.Sprintf("To: %s", strings.Join(e.recipients, ", ")),
+		fmt.Sprintf("Subject: %s", mime.QEncoding.Encode("utf-8", alert.Subject)),
+		fmt.Sprintf("Date: %s", e.nowFunc().UTC().Format(time.RFC1123Z)),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=utf-8",
+	}
+	body := strings.ReplaceAll(strings.ReplaceAll(alert.Text, "\r\n", "\n"), "\n", "\r\n")
+	msg := strings.Join(headers, "\r\n") + "\r\n\r\n" + body + "\r\n"
+
+	err := e.sendMail(e.cfg.Address, e.auth, e.cfg.From, e.recipients, []byte(msg))
+	if err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package notifier
+
+import (
+	"context"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/contentservice"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/db/dbtest"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeContentService struct {
+	contentservice.NoOpClient
+	report contentservice.UsageReport
+}
+
+func (f *fakeContentService) DownloadUsageReport(ctx context.Context, filename string) (contentservice.UsageReport, error) {
+	return f.report, nil
+}
+
+func (f *fakeContentService) ReportDownloadURL(ctx context.Context, filename string) (string, error) {
+	return "https://storage.example.com/" + filename, nil
+}
+
+func TestReportNotifier_NotifyUsageReport(t *testing.T) {
+	report := contentservice.UsageReport{
+		GenerationTime: time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC),
+		From:           time.Date(2022, 8, 1, 0, 0, 0, 0, time.UTC),
+		To:             time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC),
+		UsageRecords: []db.WorkspaceInstanceUsage{
+			dbtest.NewWorkspaceInstanceUsage(t, db.WorkspaceInstanceUsage{CreditsUsed: 10}),
+			dbtest.NewWorkspaceInstanceUsage(t, db.WorkspaceInstanceUsage{CreditsUsed: 2.5}),
+		},
+	}
+
+	for _, scenario := range []struct {
+		Name                   string
+		MaxAttachmentSizeBytes int64
+		Expected               []string
+		NotExpected            []string
+	}{
+		{
+			Name:                   "small reports are attached",
+			MaxAttachmentSizeBytes: 1024 * 1024,
+			Expected:               []string{"Content-Disposition: attachment; filename=\"report.gz\"", "attached as report.gz"},
+			NotExpected:            []string{"https://storage.example.com/report.gz"},
+		},
+		{
+			Name:                   "large reports are linked",
+			MaxAttachmentSizeBytes: 0,
+			Expected:               []string{"https://storage.example.com/report.gz"},
+			NotExpected:            []string{"Content-Disposition: attachment"},
+		},
+	} {
+		t.Run(scenario.Name, func(t *testing.T) {
+			n, err := NewReportNotifier(SMTPConfig{
+				Address:                "smtp.example.com:587",
+				From:                   "usage@example.com",
+				BillingContacts:        []string{"billing@example.com", "finance@example.com"},
+				MaxAttachmentSizeBytes: scenario.MaxAttachmentSizeBytes,
+			}, &fakeContentService{report: report})
+			require.NoError(t, err)
+
+			var sent string
+			n.sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+				require.Equal(t, "smtp.example.com:587", addr)
+				require.Equal(t, "usage@example.com", from)
+				require.Equal(t, []string{"billing@example.com", "finance@example.com"}, to)
+				sent = string(msg)
+				return nil
+			}
+
+			err = n.NotifyUsageReport(context.Background(), "report.gz")
+			require.NoError(t, err)
+
+			require.Contains(t, sent, "Subject: Gitpod usage report for August 2022")
+			require.Contains(t, sent, "Usage records: 2")
+			require.Contains(t, sent, "Total credits used: 12.50")
+			for _, s := range scenario.Expected {
+				require.True(t, strings.Contains(sent, s), "expected message to contain %q", s)
+			}
+			for _, s := range scenario.NotExpected {
+				require.False(t, strings.Contains(sent, s), "expected message not to contain %q", s)
+			}
+		})
+	}
+}
+
+func TestNewReportNotifier_Validation(t *testing.T) {
+	_, err := NewReportNotifier(SMTPConfig{From: "usage@example.com", BillingContacts: []string{"billing@example.com"}}, &contentservice.NoOpClient{})
+	require.Error(t, err, "must require an address")
+
+	_, err = NewReportNotifier(SMTPConfig{Address: "smtp.example.com:587", BillingContacts: []string{"billing@example.com"}}, &contentservice.NoOpClient{})
+	require.Error(t, err, "must require a sender")
+
+	_, err = NewReportNotifier(SMTPConfig{Address: "smtp.example.com:587", From: "usage@example.com"}, &contentservice.NoOpClient{})
+	require.Error(t, err, "must require billing contacts")
+}
+
+func TestEmail_SendAlert(t *testing.T) {
+	email, err := NewEmail(SMTPServerConfig{Address: "smtp.example.com:587", From: "usage@example.com"}, []string{"ops@example.com", "billing@example.com"})
+	require.NoError(t, err)
+	email.nowFunc = func() time.Time { return time.Date(2022, 10, 15, 8, 0, 0, 0, time.UTC) }
+
+	var sent string
+	email.sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		require.Equal(t, "smtp.example.com:587", addr)
+		require.Equal(t, "usage@example.com", from)
+		require.Equal(t, []string{"ops@example.com", "billing@example.com"}, to)
+		sent = string(msg)
+		return nil
+	}
+
+	err = email.SendAlert(context.Background(), Alert{Subject: "Usage ledger reconciliation is failing", Text: "First line\nSecond line"})
+	require.NoError(t, err)
+	require.Contains(t, sent, "To: ops@example.com, billing@example.com\r\n")
+	require.Contains(t, sent, "Subject: Usage ledger reconciliation is failing\r\n")
+	require.Contains(t, sent, "Date: Sat, 15 Oct 2022 08:00:00 +0000\r\n")
+	require.True(t, strings.HasSuffix(sent, "\r\n\r\nFirst line\r\nSecond line\r\n"))
+}
+
+func TestNewEmail_Validation(t *testing.T) {
+	_, err := NewEmail(SMTPServerConfig{From: "usage@example.com"}, []string{"ops@example.com"})
+	require.Error(t, err, "must require an address")
+
+	_, err = NewEmail(SMTPServerConfig{Address: "smtp.example.com:587"}, []string{"ops@example.com"})
+	require.Error(t, err, "must require a sender")
+
+	_, err = NewEmail(SMTPServerConfig{Address: "smtp.example.com:587", From: "usage@example.com"}, nil)
+	require.Error(t, err, "must require recipients")
+}
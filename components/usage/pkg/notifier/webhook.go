@@ -0,0 +1,305 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gitpod-io/gitpod/common-go/log"
+	"github.com/gitpod-io/gitpod/usage/pkg/contentservice"
+)
+
+const (
+	// SignatureHeader carries the hex encoded HMAC-SHA256 of "<timestamp>.<body>", keyed with the webhook secret.
+	SignatureHeader = "X-Gitpod-Signature"
+	// TimestampHeader carries the unix time at which the request was signed.
+	TimestampHeader = "X-Gitpod-Timestamp"
+	// DeliveryHeader identifies a delivery through Deliver, such that endpoints can ignore redeliveries.
+	DeliveryHeader = "X-Gitpod-Delivery"
+
+	ReportUploadedEvent = "usage_report.uploaded"
+	// SpendingLimitReachedEvent is sent when usage reaches the spending limit. Workspaces can still be started within the grace margin.
+	SpendingLimitReachedEvent = "spending_limit.reached"
+	// SpendingLimitExceededEvent is sent when usage exceeds the spending limit including the grace margin.
+	SpendingLimitExceededEvent = "spending_limit.exceeded"
+	// BudgetThresholdReachedEvent is sent when usage reaches a percentage of the spending limit, e.g. 80%, such that
+	// users are warned before workspaces stop starting.
+	BudgetThresholdReachedEvent = "spending_limit.threshold_reached"
+	// CostCenterDisputedEvent is sent when a customer disputes a payment, such that paid features can be blocked.
+	CostCenterDisputedEvent = "cost_center.disputed"
+	// ReconciliationFailingEvent is sent when a reconciliation failed a number of times in a row, such that usage is
+	// not recorded or billed until it is fixed.
+	ReconciliationFailingEvent = "reconciliation.failing"
+	// ReconciliationRecoveredEvent is sent when a reconciliation succeeds again after ReconciliationFailingEvent.
+	ReconciliationRecoveredEvent = "reconciliation.recovered"
+	// UsageSummaryEvent is sent to the webhooks of an attribution ID once a day, summarizing the usage of the day before.
+	UsageSummaryEvent = "usage.daily_summary"
+)
+
+type WebhookConfig struct {
+	URL string `json:"url"`
+	// SecretFile is the path to a file containing the secret used to sign requests.
+	SecretFile string `json:"secretFile"`
+}
+
+type WebhookEvent struct {
+	Event          string                              `json:"event"`
+	Report         *contentservice.UsageReportManifest `json:"report,omitempty"`
+	SpendingLimit  *SpendingLimit                      `json:"spendingLimit,omitempty"`
+	Dispute        *Dispute                            `json:"dispute,omitempty"`
+	Reconciliation *ReconciliationFailure              `json:"reconciliation,omitempty"`
+	UsageSummary   *UsageSummary                       `json:"usageSummary,omitempty"`
+}
+
+// SpendingLimit describes the usage of an attribution ID in a billing period, relative to its spending limit.
+type SpendingLimit struct {
+	AttributionID string `json:"attributionId"`
+	SpendingLimit int32  `json:"spendingLimit"`
+	// LimitType is either "soft", when exceeding the limit only warns, or "hard", when it blocks workspace starts.
+	LimitType          string    `json:"limitType"`
+	HardLimit          float64   `json:"hardLimit"`
+	CreditsUsed        float64   `json:"creditsUsed"`
+	BillingPeriodStart time.Time `json:"billingPeriodStart"`
+	BillingPeriodEnd   time.Time `json:"billingPeriodEnd"`
+	// ThresholdPercent is the percentage of the spending limit which was reached. It is only set for
+	// BudgetThresholdReachedEvent.
+	ThresholdPercent int32 `json:"thresholdPercent,omitempty"`
+}
+
+// Dispute describes a payment of an attribution ID which the customer disputed with their bank.
+type Dispute struct {
+	AttributionID string `json:"attributionId"`
+	DisputeID     string `json:"disputeId"`
+	ChargeID      string `json:"chargeId"`
+	Reason        string `json:"reason"`
+	// Amount is the disputed amount in the smallest unit of Currency.
+	Amount    int64     `json:"amount"`
+	Currency  string    `json:"currency"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ReconciliationFailure describes consecutive failed runs of a reconciliation.
+type ReconciliationFailure struct {
+	// Reconciler names the reconciliation, e.g. "ledger".
+	Reconciler          string `json:"reconciler"`
+	ConsecutiveFailures int    `json:"consecutiveFailures"`
+	// LastError is the error of the last failed run.
+	LastError     string    `json:"lastError,omitempty"`
+	FailingSince  time.Time `json:"failingSince"`
+	LastFailureAt time.Time `json:"lastFailureAt"`
+}
+
+// UsageSummary describes the workspace usage of an attribution ID on a day, including usage of workspace instances
+// which were still running at the end of the day.
+type UsageSummary struct {
+	AttributionID string `json:"attributionId"`
+	// Day is the summarized day in UTC, e.g. 2022-10-11.
+	Day         string  `json:"day"`
+	CreditsUsed float64 `json:"creditsUsed"`
+	// CreditsUsedByProject maps project IDs to the credits used by their workspaces. Workspaces without a project are
+	// summarized under the empty project ID.
+	CreditsUsedByProject map[string]float64 `json:"creditsUsedByProject"`
+}
+
+// Webhook delivers signed events to an operator configured URL.
+type Webhook struct {
+	url    string
+	secret []byte
+
+	client   *http.Client
+	nowFunc  func() time.Time
+	attempts int
+	backoff  time.Duration
+}
+
+func NewWebhook(cfg WebhookConfig) (*Webhook, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("no webhook URL specified")
+	}
+
+	secret, err := os.ReadFile(cfg.SecretFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read webhook secret: %w", err)
+	}
+	secret = bytes.TrimSpace(secret)
+	if len(secret) == 0 {
+		return nil, errors.New("webhook secret is empty")
+	}
+
+	return &Webhook{
+		url:      cfg.URL,
+		secret:   secret,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		nowFunc:  time.Now,
+		attempts: 3,
+		backoff:  time.Second,
+	}, nil
+}
+
+// NewEndpointWebhook creates a webhook for an endpoint which is not configured by the operator, e.g. one registered by a
+// customer. Deliveries through Deliver are attempted once, retrying them is up to the caller.
+func NewEndpointWebhook(url string, secret []byte) *Webhook {
+	return &Webhook{
+		url:      url,
+		secret:   secret,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		nowFunc:  time.Now,
+		attempts: 1,
+		backoff:  time.Second,
+	}
+}
+
+// Deliver sends a marshalled WebhookEvent once, identified by the delivery ID.
+func (w *Webhook) Deliver(ctx context.Context, deliveryID string, body []byte) error {
+	return w.send(ctx, deliveryID, body)
+}
+
+// Send delivers the event, retrying failed deliveries with exponential backoff.
+func (w *Webhook) Send(ctx context.Context, event WebhookEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook event: %w", err)
+	}
+
+	backoff := w.backoff
+	for attempt := 1; ; attempt++ {
+		err = w.send(ctx, "", body)
+		if err == nil || attempt >= w.attempts {
+			return err
+		}
+
+		log.WithError(err).WithField("attempt", attempt).Warn("Failed to deliver webhook, retrying.")
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (w *Webhook) send(ctx context.Context, deliveryID string, body []byte) error {
+	timestamp := strconv.FormatInt(w.nowFunc().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to construct webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(w.secret, timestamp, body))
+	if deliveryID != "" {
+		req.Header.Set(DeliveryHeader, deliveryID)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to make webhook request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned unexpected status code: %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// NotifySpendingLimitReached sends a SpendingLimitReachedEvent, such that users can be warned without polling the balance.
+func (w *Webhook) NotifySpendingLimitReached(ctx context.Context, limit SpendingLimit) error {
+	return w.Send(ctx, WebhookEvent{Event: SpendingLimitReachedEvent, SpendingLimit: &limit})
+}
+
+// NotifySpendingLimitExceeded sends a SpendingLimitExceededEvent, such that starting new workspaces can be blocked for
+// hard spending limits without polling the balance.
+func (w *Webhook) NotifySpendingLimitExceeded(ctx context.Context, limit SpendingLimit) error {
+	return w.Send(ctx, WebhookEvent{Event: SpendingLimitExceededEvent, SpendingLimit: &limit})
+}
+
+// NotifyBudgetThresholdReached sends a BudgetThresholdReachedEvent for limit.ThresholdPercent.
+func (w *Webhook) NotifyBudgetThresholdReached(ctx context.Context, limit SpendingLimit) error {
+	return w.Send(ctx, WebhookEvent{Event: BudgetThresholdReachedEvent, SpendingLimit: &limit})
+}
+
+// NotifyCostCenterDisputed sends a CostCenterDisputedEvent, such that the cost center can be blocked from consuming
+// paid features until the dispute is resolved.
+func (w *Webhook) NotifyCostCenterDisputed(ctx context.Context, dispute Dispute) error {
+	return w.Send(ctx, WebhookEvent{Event: CostCenterDisputedEvent, Dispute: &dispute})
+}
+
+// NotifyReconciliationFailing sends a ReconciliationFailingEvent.
+func (w *Webhook) NotifyReconciliationFailing(ctx context.Context, failure ReconciliationFailure) error {
+	return w.Send(ctx, WebhookEvent{Event: ReconciliationFailingEvent, Reconciliation: &failure})
+}
+
+// NotifyReconciliationRecovered sends a ReconciliationRecoveredEvent.
+func (w *Webhook) NotifyReconciliationRecovered(ctx context.Context, failure ReconciliationFailure) error {
+	return w.Send(ctx, WebhookEvent{Event: ReconciliationRecoveredEvent, Reconciliation: &failure})
+}
+
+// Sign computes the signature of a webhook request body, as sent in the SignatureHeader.
+func Sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature checks a signature produced by Sign in constant time.
+func VerifySignature(secret []byte, timestamp string, body []byte, signature string) bool {
+	expected := Sign(secret, timestamp, body)
+	return hmac.Equal([]byte(expected), []byte(strings.TrimSpace(signature)))
+}
+
+// WithWebhook wraps a content service such that the webhook is notified after each report upload completes.
+// Delivery failures are logged, but do not fail the upload - the report is already persisted at that point.
+func WithWebhook(svc contentservice.Interface, webhook *Webhook) contentservice.Interface {
+	return &webhookContentService{Interface: svc, webhook: webhook}
+}
+
+type webhookContentService struct {
+	contentservice.Interface
+	webhook *Webhook
+}
+
+func (s *webhookContentService) UploadUsageReport(ctx context.Context, filename string, report contentservice.UsageReport) error {
+	err := s.Interface.UploadUsageReport(ctx, filename, report)
+	if err != nil {
+		return err
+	}
+
+	logger := log.WithField("report", filename)
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		logger.WithError(err).Error("Failed to marshal report for webhook.")
+		return nil
+	}
+	manifest, err := contentservice.NewUsageReportManifest(filename, report, data)
+	if err != nil {
+		logger.WithError(err).Error("Failed to compute report manifest for webhook.")
+		return nil
+	}
+
+	err = s.webhook.Send(ctx, WebhookEvent{Event: ReportUploadedEvent, Report: &manifest})
+	if err != nil {
+		logger.WithError(err).Error("Failed to deliver report uploaded webhook.")
+	}
+
+	return nil
+}
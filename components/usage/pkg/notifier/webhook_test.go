@@ -0,0 +1,150 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/contentservice"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/db/dbtest"
+	"github.com/stretchr/testify/require"
+)
+
+type uploadRecorder struct {
+	contentservice.NoOpClient
+	uploaded []string
+}
+
+func (r *uploadRecorder) UploadUsageReport(ctx context.Context, filename string, report contentservice.UsageReport) error {
+	r.uploaded = append(r.uploaded, filename)
+	return nil
+}
+
+func newTestWebhook(t *testing.T, url string) *Webhook {
+	t.Helper()
+
+	secretFile := filepath.Join(t.TempDir(), "secret")
+	require.NoError(t, os.WriteFile(secretFile, []byte("s3cr3t\n"), 0600))
+
+	webhook, err := NewWebhook(WebhookConfig{URL: url, SecretFile: secretFile})
+	require.NoError(t, err)
+	webhook.backoff = time.Millisecond
+	return webhook
+}
+
+func TestWithWebhook_SendsSignedEventAfterUpload(t *testing.T) {
+	var received WebhookEvent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		require.True(t, VerifySignature([]byte("s3cr3t"), r.Header.Get(TimestampHeader), body, r.Header.Get(SignatureHeader)))
+		require.NoError(t, json.Unmarshal(body, &received))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	recorder := &uploadRecorder{}
+	svc := WithWebhook(recorder, newTestWebhook(t, srv.URL))
+
+	report := contentservice.UsageReport{
+		From: time.Date(2022, 8, 1, 0, 0, 0, 0, time.UTC),
+		To:   time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC),
+		UsageRecords: []db.WorkspaceInstanceUsage{
+			dbtest.NewWorkspaceInstanceUsage(t, db.WorkspaceInstanceUsage{CreditsUsed: 3}),
+		},
+	}
+	require.NoError(t, svc.UploadUsageReport(context.Background(), "report.gz", report))
+
+	require.Equal(t, []string{"report.gz"}, recorder.uploaded)
+	require.Equal(t, ReportUploadedEvent, received.Event)
+	require.Equal(t, "report.gz", received.Report.ReportFilename)
+	require.Equal(t, report.From, received.Report.From)
+	require.Equal(t, report.To, received.Report.To)
+	require.Equal(t, 1, received.Report.RecordCount)
+	require.Equal(t, float64(3), received.Report.TotalCreditsUsed)
+}
+
+func TestWebhook_NotifySpendingLimitReached(t *testing.T) {
+	var received WebhookEvent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		require.True(t, VerifySignature([]byte("s3cr3t"), r.Header.Get(TimestampHeader), body, r.Header.Get(SignatureHeader)))
+		require.NoError(t, json.Unmarshal(body, &received))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	limit := SpendingLimit{
+		AttributionID:      "team:0cd7d2e6-bd16-4b2e-8a62-70bc2a0c5f1e",
+		SpendingLimit:      500,
+		LimitType:          "hard",
+		HardLimit:          550,
+		CreditsUsed:        500.5,
+		BillingPeriodStart: time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC),
+		BillingPeriodEnd:   time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC),
+	}
+	require.NoError(t, newTestWebhook(t, srv.URL).NotifySpendingLimitReached(context.Background(), limit))
+
+	require.Equal(t, SpendingLimitReachedEvent, received.Event)
+	require.Nil(t, received.Report)
+	require.Equal(t, &limit, received.SpendingLimit)
+}
+
+func TestWebhook_RetriesFailedDeliveries(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	err := newTestWebhook(t, srv.URL).Send(context.Background(), WebhookEvent{Event: ReportUploadedEvent})
+	require.NoError(t, err)
+	require.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+func TestEndpointWebhook_DeliversOnce(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.True(t, VerifySignature([]byte("customer-secret"), r.Header.Get(TimestampHeader), body, r.Header.Get(SignatureHeader)))
+		require.Equal(t, "d3l1very", r.Header.Get(DeliveryHeader))
+
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	err := NewEndpointWebhook(srv.URL, []byte("customer-secret")).Deliver(context.Background(), "d3l1very", []byte(`{"event":"usage.daily_summary"}`))
+	require.Error(t, err)
+	require.Equal(t, int32(1), atomic.LoadInt32(&calls), "retries are up to the caller")
+}
+
+func TestVerifySignature(t *testing.T) {
+	secret := []byte("secret")
+	body := []byte(`{"event":"usage_report.uploaded"}`)
+	signature := Sign(secret, "1661990400", body)
+
+	require.True(t, VerifySignature(secret, "1661990400", body, signature))
+	require.False(t, VerifySignature(secret, "1661990401", body, signature), "timestamp is part of the signature")
+	require.False(t, VerifySignature([]byte("other"), "1661990400", body, signature))
+}
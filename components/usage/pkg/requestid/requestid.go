@@ -0,0 +1,106 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+// Package requestid correlates the logs of an RPC or a reconciliation run with the RPCs, database statements and
+// Stripe requests it causes. Request IDs travel in context, and in the x-request-id metadata of gRPC calls.
+package requestid
+
+import (
+	"context"
+
+	"github.com/gitpod-io/gitpod/common-go/log"
+	"github.com/google/uuid"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/logrus/ctxlogrus"
+	"github.com/opentracing/opentracing-go"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// MetadataKey is the gRPC metadata key of the request ID, in requests and in response headers.
+	MetadataKey = "x-request-id"
+
+	// LogField is the structured log field of the request ID.
+	LogField = "request_id"
+
+	// maxLength bounds the length of request IDs received from callers.
+	maxLength = 128
+)
+
+type contextKey struct{}
+
+// New returns a new random request ID.
+func New() string {
+	return uuid.New().String()
+}
+
+// WithID returns a context carrying the request ID.
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// WithNew returns a context carrying a new request ID, for work which does not originate from a request, like
+// reconciliation runs.
+func WithNew(ctx context.Context) context.Context {
+	return WithID(ctx, New())
+}
+
+// FromContext returns the request ID of the context, or an empty string.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// Log returns the application logger with the request ID of the context as field.
+func Log(ctx context.Context) *logrus.Entry {
+	id := FromContext(ctx)
+	if id == "" {
+		return log.Log
+	}
+	return log.Log.WithField(LogField, id)
+}
+
+// UnaryServerInterceptor adopts the request ID of the caller, or generates one when the caller sends none. The request
+// ID is added to the context, the call log and the trace of the RPC, and returned to the caller as response header.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		id := fromIncomingMetadata(ctx)
+		if id == "" {
+			id = New()
+		}
+
+		ctxlogrus.AddFields(ctx, logrus.Fields{LogField: id})
+		if span := opentracing.SpanFromContext(ctx); span != nil {
+			span.SetTag(LogField, id)
+		}
+		if err := grpc.SetHeader(ctx, metadata.Pairs(MetadataKey, id)); err != nil {
+			log.Log.WithError(err).WithField(LogField, id).Debug("Failed to send request ID header.")
+		}
+
+		return handler(WithID(ctx, id), req)
+	}
+}
+
+// UnaryClientInterceptor sends the request ID of the context along with outgoing calls.
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if id := FromContext(ctx); id != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, MetadataKey, id)
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+func fromIncomingMetadata(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	values := md.Get(MetadataKey)
+	if len(values) == 0 || len(values[0]) > maxLength {
+		return ""
+	}
+	return values[0]
+}
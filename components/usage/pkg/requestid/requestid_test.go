@@ -0,0 +1,76 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package requestid
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	interceptor := UnaryServerInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/usage.v1.UsageService/GetBalance"}
+
+	handledID := func(ctx context.Context) string {
+		var id string
+		_, err := interceptor(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			id = FromContext(ctx)
+			return nil, nil
+		})
+		require.NoError(t, err)
+		return id
+	}
+
+	t.Run("adopts the request ID of the caller", func(t *testing.T) {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(MetadataKey, "billing-question-42"))
+		require.Equal(t, "billing-question-42", handledID(ctx))
+	})
+
+	t.Run("generates a request ID when the caller sends none", func(t *testing.T) {
+		first := handledID(context.Background())
+		second := handledID(context.Background())
+		require.NotEmpty(t, first)
+		require.NotEmpty(t, second)
+		require.NotEqual(t, first, second)
+	})
+
+	t.Run("replaces request IDs which are too long", func(t *testing.T) {
+		tooLong := strings.Repeat("a", maxLength+1)
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(MetadataKey, tooLong))
+		id := handledID(ctx)
+		require.NotEmpty(t, id)
+		require.NotEqual(t, tooLong, id)
+	})
+}
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	interceptor := UnaryClientInterceptor()
+
+	sentID := func(ctx context.Context) []string {
+		var sent []string
+		err := interceptor(ctx, "/usage.v1.UsageService/GetBalance", nil, nil, nil, func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			md, _ := metadata.FromOutgoingContext(ctx)
+			sent = md.Get(MetadataKey)
+			return nil
+		})
+		require.NoError(t, err)
+		return sent
+	}
+
+	require.Equal(t, []string{"run-1"}, sentID(WithID(context.Background(), "run-1")))
+	require.Empty(t, sentID(context.Background()))
+}
+
+func TestLog(t *testing.T) {
+	require.NotContains(t, Log(context.Background()).Data, LogField)
+
+	ctx := WithNew(context.Background())
+	require.Equal(t, FromContext(ctx), Log(ctx).Data[LogField])
+}
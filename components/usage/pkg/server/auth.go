@@ -0,0 +1,46 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package server
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// requireBearerToken only passes requests to next which authenticate with token in their Authorization header, and
+// responds with Unauthorized to all others. The HTTP server also serves the Stripe webhook, so it is reachable from
+// outside of the cluster.
+func requireBearerToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization := r.Header.Get("Authorization")
+		presented := strings.TrimPrefix(authorization, "Bearer ")
+		if presented == authorization || subtle.ConstantTimeCompare([]byte(presented), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func readHTTPAPIToken(path string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("no HTTP API token file is configured")
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read HTTP API token: %w", err)
+	}
+
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return "", fmt.Errorf("HTTP API token file %s is empty", path)
+	}
+	return token, nil
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/graph"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequireBearerToken_GraphQL(t *testing.T) {
+	graphQLHandler, err := graph.NewHandler(&restUsageClient{})
+	require.NoError(t, err)
+	handler := requireBearerToken("secret", graphQLHandler)
+
+	query := func(authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(`{"query": "{ __typename }"}`))
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := query("")
+	require.Equal(t, http.StatusUnauthorized, rec.Code, "must reject unauthenticated requests")
+	require.Equal(t, "Bearer", rec.Header().Get("WWW-Authenticate"))
+
+	require.Equal(t, http.StatusUnauthorized, query("Bearer other").Code, "must reject other tokens")
+	require.Equal(t, http.StatusUnauthorized, query("secret").Code, "must require the bearer scheme")
+
+	rec = query("Bearer secret")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `{"data": {"__typename": "Query"}}`, rec.Body.String())
+}
+
+func TestReadHTTPAPIToken(t *testing.T) {
+	_, err := readHTTPAPIToken("")
+	require.Error(t, err, "must require a token file")
+
+	path := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(path, []byte(" \n"), 0600))
+	_, err = readHTTPAPIToken(path)
+	require.Error(t, err, "must reject empty tokens")
+
+	require.NoError(t, os.WriteFile(path, []byte("secret\n"), 0600))
+	token, err := readHTTPAPIToken(path)
+	require.NoError(t, err)
+	require.Equal(t, "secret", token)
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package server
+
+import (
+	"database/sql"
+	"expvar"
+	"net/http"
+	"runtime"
+	"sync"
+	"time"
+)
+
+var publishRuntimeStatsOnce sync.Once
+
+// registerDebugHandlers adds runtime stats to the pprof endpoints of the debug server:
+//   - /debug/vars serves the memory stats and command line published by expvar, and the runtime stats of the
+//     component under "usage"
+//
+// Goroutine dumps are served by pprof at /debug/pprof/goroutine?debug=2.
+func registerDebugHandlers(mux *http.ServeMux, databases map[string]*sql.DB) {
+	started := time.Now()
+	publishRuntimeStatsOnce.Do(func() {
+		expvar.Publish("usage", expvar.Func(func() interface{} {
+			return runtimeStats(started, databases)
+		}))
+	})
+	mux.Handle("/debug/vars", expvar.Handler())
+}
+
+type debugRuntimeStats struct {
+	UptimeSeconds float64 `json:"uptimeSeconds"`
+	Goroutines    int     `json:"goroutines"`
+	GOMAXPROCS    int     `json:"gomaxprocs"`
+	HeapAlloc     uint64  `json:"heapAlloc"`
+	HeapInuse     uint64  `json:"heapInuse"`
+	HeapObjects   uint64  `json:"heapObjects"`
+	NumGC         uint32  `json:"numGC"`
+	// LastGCPauseNs is the duration of the stop-the-world pause of the last garbage collection.
+	LastGCPauseNs uint64 `json:"lastGCPauseNs"`
+	// Databases are the connection pool stats of the database and its read replica.
+	Databases map[string]sql.DBStats `json:"databases"`
+}
+
+func runtimeStats(started time.Time, databases map[string]*sql.DB) debugRuntimeStats {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	stats := debugRuntimeStats{
+		UptimeSeconds: time.Since(started).Seconds(),
+		Goroutines:    runtime.NumGoroutine(),
+		GOMAXPROCS:    runtime.GOMAXPROCS(0),
+		HeapAlloc:     mem.HeapAlloc,
+		HeapInuse:     mem.HeapInuse,
+		HeapObjects:   mem.HeapObjects,
+		NumGC:         mem.NumGC,
+		LastGCPauseNs: mem.PauseNs[(mem.NumGC+255)%256],
+		Databases:     map[string]sql.DBStats{},
+	}
+	for name, db := range databases {
+		stats.Databases[name] = db.Stats()
+	}
+	return stats
+}
@@ -0,0 +1,33 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegisterDebugHandlers(t *testing.T) {
+	mux := http.NewServeMux()
+	registerDebugHandlers(mux, map[string]*sql.DB{})
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/vars", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var vars struct {
+		MemStats map[string]interface{} `json:"memstats"`
+		Usage    debugRuntimeStats      `json:"usage"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &vars))
+	require.NotEmpty(t, vars.MemStats)
+	require.Positive(t, vars.Usage.Goroutines)
+	require.Positive(t, vars.Usage.HeapAlloc)
+}
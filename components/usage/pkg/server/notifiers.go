@@ -0,0 +1,43 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package server
+
+import (
+	"context"
+
+	"github.com/gitpod-io/gitpod/usage/pkg/apiv1"
+	"github.com/gitpod-io/gitpod/usage/pkg/notifier"
+)
+
+// multiSpendingLimitNotifier informs every notifier, even when informing one of them fails, and returns the first error.
+type multiSpendingLimitNotifier []apiv1.SpendingLimitNotifier
+
+func (m multiSpendingLimitNotifier) NotifySpendingLimitReached(ctx context.Context, limit notifier.SpendingLimit) error {
+	return m.each(func(n apiv1.SpendingLimitNotifier) error {
+		return n.NotifySpendingLimitReached(ctx, limit)
+	})
+}
+
+func (m multiSpendingLimitNotifier) NotifySpendingLimitExceeded(ctx context.Context, limit notifier.SpendingLimit) error {
+	return m.each(func(n apiv1.SpendingLimitNotifier) error {
+		return n.NotifySpendingLimitExceeded(ctx, limit)
+	})
+}
+
+func (m multiSpendingLimitNotifier) NotifyBudgetThresholdReached(ctx context.Context, limit notifier.SpendingLimit) error {
+	return m.each(func(n apiv1.SpendingLimitNotifier) error {
+		return n.NotifyBudgetThresholdReached(ctx, limit)
+	})
+}
+
+func (m multiSpendingLimitNotifier) each(notify func(apiv1.SpendingLimitNotifier) error) error {
+	var first error
+	for _, n := range m {
+		if err := notify(n); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
@@ -0,0 +1,225 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/heptiolabs/healthcheck"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// Dependencies whose readiness is reported separately.
+const (
+	dependencyDatabase        = "database"
+	dependencyContentService  = "content-service"
+	dependencyBillingProvider = "billing-provider"
+)
+
+// readiness reports the readiness of the component per dependency. The component is only not ready while a critical
+// dependency fails, other dependencies are degraded without keeping requests from being served.
+//
+// Over HTTP, /ready reports the component, and /ready?dependency=<name> a single dependency. With ?full=1, the results
+// of the checks are included. Over gRPC, the health service reports the component for the empty service name, and a
+// single dependency for its name.
+type readiness struct {
+	grpc_health_v1.UnimplementedHealthServer
+
+	// liveness handles the liveness checks, which are not split into dependencies.
+	liveness healthcheck.Handler
+
+	mu           sync.RWMutex
+	dependencies map[string]*dependency
+}
+
+type dependency struct {
+	critical bool
+	checks   map[string]healthcheck.Check
+}
+
+// dependencyStatus is the outcome of the checks of a dependency.
+type dependencyStatus struct {
+	Ready    bool              `json:"ready"`
+	Critical bool              `json:"critical"`
+	Checks   map[string]string `json:"checks"`
+}
+
+func newReadiness() *readiness {
+	return &readiness{
+		liveness:     healthcheck.NewHandler(),
+		dependencies: map[string]*dependency{},
+	}
+}
+
+var _ healthcheck.Handler = (*readiness)(nil)
+var _ grpc_health_v1.HealthServer = (*readiness)(nil)
+
+// AddDependencyCheck adds a check of the dependency. A dependency is critical when it was added as critical at least
+// once.
+func (r *readiness) AddDependencyCheck(name string, critical bool, checkName string, check healthcheck.Check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d, ok := r.dependencies[name]
+	if !ok {
+		d = &dependency{checks: map[string]healthcheck.Check{}}
+		r.dependencies[name] = d
+	}
+	d.critical = d.critical || critical
+	d.checks[checkName] = check
+}
+
+// AddReadinessCheck adds a check as a critical dependency of its own.
+func (r *readiness) AddReadinessCheck(name string, check healthcheck.Check) {
+	r.AddDependencyCheck(name, true, name, check)
+}
+
+func (r *readiness) AddLivenessCheck(name string, check healthcheck.Check) {
+	r.liveness.AddLivenessCheck(name, check)
+}
+
+func (r *readiness) LiveEndpoint(w http.ResponseWriter, req *http.Request) {
+	r.liveness.LiveEndpoint(w, req)
+}
+
+func (r *readiness) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch req.URL.Path {
+	case "/live":
+		r.LiveEndpoint(w, req)
+	case "/ready":
+		r.ReadyEndpoint(w, req)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+func (r *readiness) ReadyEndpoint(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var (
+		ready bool
+		body  interface{}
+	)
+	if name := req.URL.Query().Get("dependency"); name != "" {
+		s, ok := r.checkDependency(name)
+		if !ok {
+			http.Error(w, fmt.Sprintf("unknown dependency %q", name), http.StatusNotFound)
+			return
+		}
+		ready, body = s.Ready, s
+	} else {
+		ready, body = r.check()
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if ready {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	// Kubernetes only cares about the status code, the results are only written on request.
+	if req.URL.Query().Get("full") != "1" {
+		_, _ = w.Write([]byte("{}\n"))
+		return
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "    ")
+	_ = encoder.Encode(body)
+}
+
+// Check reports the component for the empty service name, and a single dependency for its name.
+func (r *readiness) Check(ctx context.Context, req *grpc_health_v1.HealthCheckRequest) (*grpc_health_v1.HealthCheckResponse, error) {
+	var ready bool
+	if req.GetService() == "" {
+		ready, _ = r.check()
+	} else {
+		s, ok := r.checkDependency(req.GetService())
+		if !ok {
+			return nil, status.Errorf(codes.NotFound, "unknown dependency %s", req.GetService())
+		}
+		ready = s.Ready
+	}
+
+	if !ready {
+		return &grpc_health_v1.HealthCheckResponse{Status: grpc_health_v1.HealthCheckResponse_NOT_SERVING}, nil
+	}
+	return &grpc_health_v1.HealthCheckResponse{Status: grpc_health_v1.HealthCheckResponse_SERVING}, nil
+}
+
+// check runs the checks of all dependencies. The component is ready unless a critical dependency fails.
+func (r *readiness) check() (bool, map[string]dependencyStatus) {
+	r.mu.RLock()
+	names := make([]string, 0, len(r.dependencies))
+	for name := range r.dependencies {
+		names = append(names, name)
+	}
+	r.mu.RUnlock()
+	sort.Strings(names)
+
+	ready := true
+	statuses := map[string]dependencyStatus{}
+	for _, name := range names {
+		s, _ := r.checkDependency(name)
+		if s.Critical && !s.Ready {
+			ready = false
+		}
+		statuses[name] = s
+	}
+	return ready, statuses
+}
+
+func (r *readiness) checkDependency(name string) (dependencyStatus, bool) {
+	r.mu.RLock()
+	d, ok := r.dependencies[name]
+	if !ok {
+		r.mu.RUnlock()
+		return dependencyStatus{}, false
+	}
+	critical := d.critical
+	checks := make(map[string]healthcheck.Check, len(d.checks))
+	for checkName, check := range d.checks {
+		checks[checkName] = check
+	}
+	r.mu.RUnlock()
+
+	s := dependencyStatus{Ready: true, Critical: critical, Checks: map[string]string{}}
+	for checkName, check := range checks {
+		if err := check(); err != nil {
+			s.Ready = false
+			s.Checks[checkName] = err.Error()
+			continue
+		}
+		s.Checks[checkName] = "OK"
+	}
+	return s, true
+}
+
+// connectionHealthCheck fails while the client connection can not reach its server. Idle connections are connected,
+// such that the next check reports their actual state.
+func connectionHealthCheck(conn *grpc.ClientConn) healthcheck.Check {
+	return func() error {
+		state := conn.GetState()
+		switch state {
+		case connectivity.Idle:
+			conn.Connect()
+		case connectivity.TransientFailure, connectivity.Shutdown:
+			return fmt.Errorf("connection is in state %s", state)
+		}
+		return nil
+	}
+}
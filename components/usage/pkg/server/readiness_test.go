@@ -0,0 +1,93 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+func TestReadiness(t *testing.T) {
+	var databaseErr, stripeErr error
+	health := newReadiness()
+	health.AddDependencyCheck(dependencyDatabase, true, "database", func() error { return databaseErr })
+	health.AddDependencyCheck(dependencyDatabase, true, "database-migrations", func() error { return nil })
+	health.AddDependencyCheck(dependencyBillingProvider, false, "stripe", func() error { return stripeErr })
+
+	ready := func(query string) int {
+		rec := httptest.NewRecorder()
+		health.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready"+query, nil))
+		return rec.Code
+	}
+	grpcStatus := func(service string) grpc_health_v1.HealthCheckResponse_ServingStatus {
+		resp, err := health.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{Service: service})
+		require.NoError(t, err)
+		return resp.Status
+	}
+
+	require.Equal(t, http.StatusOK, ready(""))
+	require.Equal(t, http.StatusOK, ready("?dependency=billing-provider"))
+	require.Equal(t, grpc_health_v1.HealthCheckResponse_SERVING, grpcStatus(""))
+
+	t.Run("degraded billing provider keeps the component ready", func(t *testing.T) {
+		stripeErr = errors.New("circuit breaker is open")
+		defer func() { stripeErr = nil }()
+
+		require.Equal(t, http.StatusOK, ready(""))
+		require.Equal(t, http.StatusServiceUnavailable, ready("?dependency=billing-provider"))
+		require.Equal(t, http.StatusOK, ready("?dependency=database"))
+		require.Equal(t, grpc_health_v1.HealthCheckResponse_SERVING, grpcStatus(""))
+		require.Equal(t, grpc_health_v1.HealthCheckResponse_NOT_SERVING, grpcStatus(dependencyBillingProvider))
+	})
+
+	t.Run("failing database makes the component not ready", func(t *testing.T) {
+		databaseErr = errors.New("connection refused")
+		defer func() { databaseErr = nil }()
+
+		require.Equal(t, http.StatusServiceUnavailable, ready(""))
+		require.Equal(t, http.StatusServiceUnavailable, ready("?dependency=database"))
+		require.Equal(t, grpc_health_v1.HealthCheckResponse_NOT_SERVING, grpcStatus(""))
+		require.Equal(t, grpc_health_v1.HealthCheckResponse_NOT_SERVING, grpcStatus(dependencyDatabase))
+	})
+
+	t.Run("full output reports every dependency", func(t *testing.T) {
+		stripeErr = errors.New("circuit breaker is open")
+		defer func() { stripeErr = nil }()
+
+		rec := httptest.NewRecorder()
+		health.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready?full=1", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var statuses map[string]dependencyStatus
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &statuses))
+		require.Equal(t, map[string]dependencyStatus{
+			dependencyDatabase: {
+				Ready:    true,
+				Critical: true,
+				Checks:   map[string]string{"database": "OK", "database-migrations": "OK"},
+			},
+			dependencyBillingProvider: {
+				Ready:  false,
+				Checks: map[string]string{"stripe": "circuit breaker is open"},
+			},
+		}, statuses)
+	})
+
+	t.Run("unknown dependencies are not found", func(t *testing.T) {
+		require.Equal(t, http.StatusNotFound, ready("?dependency=snowflake"))
+
+		_, err := health.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{Service: "snowflake"})
+		require.Equal(t, codes.NotFound, status.Code(err))
+	})
+}
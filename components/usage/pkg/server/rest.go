@@ -0,0 +1,40 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+)
+
+// restPrefix is the path prefix of the REST endpoints, it matches the paths of the google.api.http options in
+// usage.proto.
+const restPrefix = "/v1/"
+
+// newRESTHandler returns a handler which serves the REST endpoints of the UsageService through the usage client, and
+// their OpenAPI spec on /v1/openapi.json. Requests to the endpoints must authenticate with token.
+func newRESTHandler(ctx context.Context, usageClient v1.UsageServiceClient, token string) (http.Handler, error) {
+	gateway := runtime.NewServeMux()
+	err := v1.RegisterUsageServiceHandlerClient(ctx, gateway, usageClient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register usage REST endpoints: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(restPrefix, requireBearerToken(token, gateway))
+	mux.HandleFunc(restPrefix+"openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(v1.OpenAPISpec)
+	})
+	return mux, nil
+}
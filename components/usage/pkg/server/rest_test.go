@@ -0,0 +1,106 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type restUsageClient struct {
+	v1.UsageServiceClient
+	listUsage *v1.ListUsageRequest
+}
+
+func (c *restUsageClient) ListUsage(_ context.Context, in *v1.ListUsageRequest, _ ...grpc.CallOption) (*v1.ListUsageResponse, error) {
+	c.listUsage = in
+	return &v1.ListUsageResponse{
+		UsageEntries:         []*v1.Usage{{Id: "usage-a", AttributionId: in.GetAttributionId(), Credits: 2.5}},
+		CreditBalanceAtStart: -10,
+	}, nil
+}
+
+func (c *restUsageClient) ListBilledUsage(_ context.Context, in *v1.ListBilledUsageRequest, _ ...grpc.CallOption) (*v1.ListBilledUsageResponse, error) {
+	return nil, status.Errorf(codes.InvalidArgument, "Failed to parse attribution ID")
+}
+
+func authenticatedRequest(method, target string) *http.Request {
+	req := httptest.NewRequest(method, target, nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	return req
+}
+
+func TestRESTHandler(t *testing.T) {
+	usageClient := &restUsageClient{}
+	handler, err := newRESTHandler(context.Background(), usageClient, "secret")
+	require.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, authenticatedRequest(http.MethodGet, "/v1/attributions/team:a/usage?from=2022-10-01T00:00:00Z&order=ORDERING_ASCENDING&pagination.page=2&pagination.perPage=50"))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	require.Equal(t, "team:a", usageClient.listUsage.GetAttributionId())
+	require.Equal(t, time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC), usageClient.listUsage.GetFrom().AsTime())
+	require.Equal(t, v1.ListUsageRequest_ORDERING_ASCENDING, usageClient.listUsage.GetOrder())
+	require.Equal(t, int64(2), usageClient.listUsage.GetPagination().GetPage())
+	require.Equal(t, int64(50), usageClient.listUsage.GetPagination().GetPerPage())
+
+	var resp map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Equal(t, float64(-10), resp["creditBalanceAtStart"])
+	require.Len(t, resp["usageEntries"], 1)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, authenticatedRequest(http.MethodGet, "/v1/attributions/invalid/sessions"))
+	require.Equal(t, http.StatusBadRequest, rec.Code, "gRPC codes must map to HTTP status codes")
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, authenticatedRequest(http.MethodPost, "/v1/attributions/team:a/usage"))
+	require.NotEqual(t, http.StatusOK, rec.Code, "only documented methods must be served")
+}
+
+func TestRESTHandler_RejectsUnauthenticatedRequests(t *testing.T) {
+	usageClient := &restUsageClient{}
+	handler, err := newRESTHandler(context.Background(), usageClient, "secret")
+	require.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/attributions/team:a/usage", nil))
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/attributions/team:a/usage", nil)
+	req.Header.Set("Authorization", "Bearer other")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	require.Nil(t, usageClient.listUsage, "must not call the usage service")
+}
+
+func TestRESTHandler_ServesOpenAPISpec(t *testing.T) {
+	handler, err := newRESTHandler(context.Background(), &restUsageClient{}, "secret")
+	require.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/openapi.json", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var spec struct {
+		Paths map[string]interface{} `json:"paths"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &spec))
+	require.Contains(t, spec.Paths, "/v1/attributions/{attributionId}/usage")
+	require.Contains(t, spec.Paths, "/v1/attributions/{attributionId}/sessions")
+}
@@ -5,28 +5,51 @@
 package server
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
 	"github.com/gitpod-io/gitpod/content-service/api"
 	"net"
+	"net/http"
 	"os"
+	"strings"
 	"time"
 
+	grpc_opentracing "github.com/grpc-ecosystem/go-grpc-middleware/tracing/opentracing"
 	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 
+	"github.com/gitpod-io/gitpod/common-go/analytics"
 	"github.com/gitpod-io/gitpod/common-go/baseserver"
 	"github.com/gitpod-io/gitpod/common-go/log"
+	"github.com/gitpod-io/gitpod/common-go/util"
 	v1 "github.com/gitpod-io/gitpod/usage-api/v1"
 	"github.com/gitpod-io/gitpod/usage/pkg/apiv1"
 	"github.com/gitpod-io/gitpod/usage/pkg/contentservice"
 	"github.com/gitpod-io/gitpod/usage/pkg/controller"
 	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/export"
+	"github.com/gitpod-io/gitpod/usage/pkg/graph"
+	"github.com/gitpod-io/gitpod/usage/pkg/notifier"
+	"github.com/gitpod-io/gitpod/usage/pkg/requestid"
 	"github.com/gitpod-io/gitpod/usage/pkg/stripe"
+	"github.com/gitpod-io/gitpod/usage/pkg/webhooks"
+	"github.com/heptiolabs/healthcheck"
+	"github.com/opentracing/opentracing-go"
 	"gorm.io/gorm"
 )
 
+const (
+	defaultInvoiceLedgerLookbackDays = 30
+	defaultStaleDraftAge             = 7 * 24 * time.Hour
+	// usagePartitionMonthsAhead is how many months of usage partitions are added ahead of time.
+	usagePartitionMonthsAhead = 3
+	// minUsageRetention keeps usage of billing periods which may still be invoiced or reconciled out of the archive.
+	minUsageRetention = 90 * 24 * time.Hour
+)
+
 type Config struct {
 	// ControllerSchedule determines how frequently to run the Usage/Billing controller.
 	// When ControllerSchedule is empty, the background controller is disabled.
@@ -34,10 +57,196 @@ type Config struct {
 
 	CreditsPerMinuteByWorkspaceClass map[string]float64 `json:"creditsPerMinuteByWorkspaceClass,omitempty"`
 
+	// CreditsPerMinuteByPlan overrides CreditsPerMinuteByWorkspaceClass for cost centers on the given plan.
+	// Usage is split at plan changes, such that runtime before and after the change is priced at the respective plan.
+	CreditsPerMinuteByPlan map[string]map[string]float64 `json:"creditsPerMinuteByPlan,omitempty"`
+
+	// ExternalPricing configures a PricingService which is asked for the rates of workspace classes, such that bespoke
+	// pricing does not require changes to the usage component. CreditsPerMinuteByWorkspaceClass and
+	// CreditsPerMinuteByPlan only apply when it defers to them, usage is left in draft while it is unavailable.
+	ExternalPricing *apiv1.ExternalPricingConfig `json:"externalPricing,omitempty"`
+
+	// BillingDisabled tracks usage without a payment provider. No Stripe client is constructed, billing RPCs return
+	// Unimplemented and the Stripe webhook endpoint returns NotImplemented. Usage reconciliation and reports are unaffected.
+	BillingDisabled bool `json:"billingDisabled,omitempty"`
+
 	StripeCredentialsFile string `json:"stripeCredentialsFile,omitempty"`
 
+	// StripeWebhookSigningSecretPath is the path to the secret used to verify Stripe webhook events.
+	// When StripeWebhookSigningSecretPath is empty, the Stripe webhook endpoint returns NotImplemented.
+	StripeWebhookSigningSecretPath string `json:"stripeWebhookSigningSecretPath,omitempty"`
+
+	// StripePrices maps currencies to the ID of the usage-based Stripe price in that currency, e.g. {"EUR": "price_123"}.
+	StripePrices map[string]string `json:"stripePrices,omitempty"`
+
+	// TaxRates maps ISO 3166-1 alpha-2 country codes to tax rates in percent, e.g. {"DE": 19}. Invoice amounts
+	// include the tax of the country of the customer's billing address. Customers in other countries are not taxed.
+	TaxRates stripe.TaxRates `json:"taxRates,omitempty"`
+
+	// CreditPrices maps currencies to the price of a credit in the smallest unit of the currency, e.g. {"EUR": 3.6}.
+	// Balances and invoice previews are converted to the currency of the cost center with these prices.
+	CreditPrices apiv1.CreditPrices `json:"creditPrices,omitempty"`
+
 	ContentServiceAddress string `json:"contentServiceAddress,omitempty"`
 
+	// SummaryCurrency configures the currency shown in the human-readable summary uploaded with each usage report.
+	// When SummaryCurrency is nil, the summary only shows credits.
+	SummaryCurrency *contentservice.Currency `json:"summaryCurrency,omitempty"`
+
+	// ReportNotifications configures emailing the monthly usage report to billing contacts.
+	// When ReportNotifications is nil, reports are not emailed.
+	ReportNotifications *notifier.SMTPConfig `json:"reportNotifications,omitempty"`
+
+	// ReportWebhook configures a webhook which receives a signed request whenever a usage report finished uploading.
+	// When ReportWebhook is nil, no webhook is called.
+	ReportWebhook *notifier.WebhookConfig `json:"reportWebhook,omitempty"`
+
+	// SpendingLimitWebhook configures a webhook which receives a signed request whenever a cost center reaches its spending limit.
+	// When SpendingLimitWebhook is nil, callers need to poll GetBalance instead.
+	SpendingLimitWebhook *notifier.WebhookConfig `json:"spendingLimitWebhook,omitempty"`
+
+	// SpendingLimitNotificationAddress is the gRPC address of the UsageNotificationService of the server component, which
+	// is called whenever the spending limit state of an attribution ID changes. When SpendingLimitNotificationAddress is
+	// empty, the server needs to poll GetBalance instead.
+	SpendingLimitNotificationAddress string `json:"spendingLimitNotificationAddress,omitempty"`
+
+	// DisputeWebhook configures a webhook which receives a signed request whenever a cost center is flagged because
+	// a customer disputed a payment. When DisputeWebhook is nil, callers need to check the state of the cost center instead.
+	DisputeWebhook *notifier.WebhookConfig `json:"disputeWebhook,omitempty"`
+
+	// UsageEventsMessageBus configures the message bus which usage events are published to whenever usage of a workspace
+	// instance is billed, a stale draft is finalized, or an invoice is credited in the ledger. When UsageEventsMessageBus
+	// is nil, no usage events are published.
+	UsageEventsMessageBus *notifier.MessageBusConfig `json:"usageEventsMessageBus,omitempty"`
+
+	// UsageWebhooks enables owners of attribution IDs to register webhooks, which receive daily usage summaries and
+	// spending limit events. When UsageWebhooks is nil, webhooks can not be registered.
+	UsageWebhooks *apiv1.UsageWebhookConfig `json:"usageWebhooks,omitempty"`
+
+	// BigQueryExport configures the daily export of the usage of the previous day into a BigQuery table, which is
+	// partitioned by day. When BigQueryExport is nil, usage is not exported.
+	BigQueryExport *export.BigQueryConfig `json:"bigQueryExport,omitempty"`
+
+	// StageExport configures the daily export of snapshots of the usage of the previous day into a bucket, which a
+	// warehouse like Snowflake auto-ingests as external stage. When StageExport is nil, no snapshots are exported.
+	StageExport *export.StageConfig `json:"stageExport,omitempty"`
+
+	// UsageRemoteWrite configures pushing the credits used by every attribution ID in the current month to a
+	// Prometheus remote-write endpoint, for chargeback in the observability stack. When UsageRemoteWrite is nil,
+	// nothing is pushed.
+	UsageRemoteWrite *export.RemoteWriteConfig `json:"usageRemoteWrite,omitempty"`
+
+	// GraphQLEnabled serves the read-only usage GraphQL API on /graphql of the HTTP server. Requests must authenticate
+	// with the token in HTTPAPITokenFile.
+	GraphQLEnabled bool `json:"graphqlEnabled,omitempty"`
+
+	// RESTEnabled serves the REST endpoints of the usage API, and their OpenAPI spec on /v1/openapi.json, on /v1/ of the
+	// HTTP server. Requests must authenticate with the token in HTTPAPITokenFile, the public API authenticates personal
+	// access tokens and forwards requests of their owners with it.
+	RESTEnabled bool `json:"restEnabled,omitempty"`
+
+	// HTTPAPITokenFile is the path to a file containing the token which requests to the HTTP APIs must send as
+	// "Authorization: Bearer <token>". It is required when any of them is enabled, as the HTTP server also serves the
+	// Stripe webhook and is reachable from outside of the cluster.
+	HTTPAPITokenFile string `json:"httpApiTokenFile,omitempty"`
+
+	// ReconciliationEscalationThreshold is the number of runs of a reconciler which fail in a row before the failures are
+	// escalated, see controller.EscalateFailures. When ReconciliationEscalationThreshold is 0,
+	// controller.DefaultEscalationThreshold applies.
+	ReconciliationEscalationThreshold int `json:"reconciliationEscalationThreshold,omitempty"`
+
+	// ReconciliationWebhook configures a webhook which receives a signed request when a reconciler keeps failing, and
+	// when it recovers. When ReconciliationWebhook is nil, failures are only escalated as metric.
+	ReconciliationWebhook *notifier.WebhookConfig `json:"reconciliationWebhook,omitempty"`
+
+	// ReconciliationPagerDuty triggers a PagerDuty incident when a reconciler keeps failing, which is resolved when it
+	// recovers. When ReconciliationPagerDuty is nil, no incidents are triggered.
+	ReconciliationPagerDuty *notifier.PagerDutyConfig `json:"reconciliationPagerDuty,omitempty"`
+
+	// Alerts configures Slack and email alerts when cost centers reach budget thresholds or their spending limit, and
+	// when a reconciler keeps failing. When Alerts is nil, no alerts are sent.
+	Alerts *notifier.AlertConfig `json:"alerts,omitempty"`
+
+	// SpendingLimitGraceMargin configures the overage on top of spending limits during which workspaces can still be started.
+	// When SpendingLimitGraceMargin is nil, workspace starts are blocked as soon as the spending limit is reached.
+	SpendingLimitGraceMargin *apiv1.SpendingLimitGraceMargin `json:"spendingLimitGraceMargin,omitempty"`
+
+	// DunningPeriods configures how long cost centers with a failed invoice payment stay in grace, and then restricted,
+	// before they are suspended. When DunningPeriods is nil, apiv1.DefaultDunningPeriods apply.
+	DunningPeriods *apiv1.DunningPeriods `json:"dunningPeriods,omitempty"`
+
+	// InvoiceLedgerLookbackDays is how many days of finalized Stripe invoices are reconciled into the ledger daily,
+	// to credit invoices whose webhook delivery was missed. When InvoiceLedgerLookbackDays is 0, 30 days are reconciled.
+	InvoiceLedgerLookbackDays int `json:"invoiceLedgerLookbackDays,omitempty"`
+
+	// FreeTierCredits is the number of credits every cost center is granted at the start of each billing period. Unused
+	// free tier credits expire at the end of the period. When FreeTierCredits is 0, no credits are granted.
+	FreeTierCredits float64 `json:"freeTierCredits,omitempty"`
+
+	// StaleDraftAge is how long draft usage whose workspace instance no longer exists is kept as a draft, before the
+	// janitor finalizes it. When StaleDraftAge is 0, drafts are finalized after 7 days.
+	StaleDraftAge util.Duration `json:"staleDraftAge,omitempty"`
+
+	// UsageRetention is how long usage and workspace instance usage are kept, before they are moved into the archive
+	// tables. Archived usage is still listed and included in balances. When UsageRetention is 0, usage is not archived.
+	UsageRetention util.Duration `json:"usageRetention,omitempty"`
+
+	// DeletedUsageRetention is how long usage which was soft-deleted on request of its owner is retained, before it can
+	// be purged. When DeletedUsageRetention is 0, apiv1.DefaultDeletedUsageRetention applies.
+	DeletedUsageRetention util.Duration `json:"deletedUsageRetention,omitempty"`
+
+	// UsageWriteQueue buffers the usage which RecordInstanceEvents computes from instance events, and writes it in
+	// batches. Pending usage is written when the component shuts down. When UsageWriteQueue is nil, usage is written
+	// before RecordInstanceEvents returns.
+	UsageWriteQueue *db.UsageWriteQueueConfig `json:"usageWriteQueue,omitempty"`
+
+	// DatabasePool configures the connection pools of the database and its read replica. When DatabasePool is nil, the
+	// defaults of database/sql apply, which do not limit the number of open connections.
+	DatabasePool *db.PoolConfig `json:"databasePool,omitempty"`
+
+	// DatabaseQueryTimeouts limits how long statements on the database and its read replica may run. When it is nil,
+	// statements only stop when the request which runs them is cancelled.
+	DatabaseQueryTimeouts *db.QueryTimeoutConfig `json:"databaseQueryTimeouts,omitempty"`
+
+	// DatabaseSlowQueries configures which statements on the database and its read replica are logged and counted as
+	// slow, see db.CaptureSlowQueries. When it is nil, db.DefaultSlowQueryThreshold applies to all statements.
+	DatabaseSlowQueries *db.SlowQueryConfig `json:"databaseSlowQueries,omitempty"`
+
+	// MetadataEncryption encrypts the fields of usage metadata which identify people, see db.PersonalMetadataFields.
+	// When MetadataEncryption is nil, metadata is stored in plaintext.
+	MetadataEncryption *db.MetadataEncryptionConfig `json:"metadataEncryption,omitempty"`
+
+	// MetadataRedaction stores only hashes of the fields of workspace instance usage metadata which identify people, see
+	// db.PersonalMetadataFields. Usage is priced and billed as before. When MetadataRedaction is nil, the fields are kept.
+	MetadataRedaction *db.MetadataRedactionConfig `json:"metadataRedaction,omitempty"`
+
+	// MaxReplicationLag is the replication lag of the read replica above which reads are routed to the primary, and the
+	// component is not ready. When MaxReplicationLag is 0, the lag is not checked, which does not require the
+	// REPLICATION CLIENT privilege.
+	MaxReplicationLag util.Duration `json:"maxReplicationLag,omitempty"`
+
+	// SLOs are the service level objectives of RPCs, keyed by full method name. Calls of these RPCs are counted against
+	// their error budgets, see apiv1.NewSLOInterceptor. When SLOs is empty, apiv1.DefaultSLOs apply.
+	SLOs apiv1.SLOs `json:"slos,omitempty"`
+
+	// AttributionMetrics exports the balances of the listed attribution IDs as metrics labelled by attribution ID.
+	// When AttributionMetrics is nil, no per-attribution metrics are exported.
+	AttributionMetrics *apiv1.AttributionMetricsConfig `json:"attributionMetrics,omitempty"`
+
+	// ReconciliationLogSampling bounds the lines which reconciliation logs per workspace instance or attribution ID.
+	// Further records are summarized per attribution ID. Every record is logged while the log level is debug, which is
+	// set at runtime with POST /debug/logging on the debug listener.
+	ReconciliationLogSampling apiv1.LogSamplingConfig `json:"reconciliationLogSampling,omitempty"`
+
+	// UsageAnalytics publishes usage milestones which reconciliation reaches, like billed workspace sessions, crossed
+	// spending limits and first paid usage, to the analytics writer configured through GITPOD_ANALYTICS_WRITER.
+	UsageAnalytics bool `json:"usageAnalytics,omitempty"`
+
+	// TraceSamplingAttributionIDs are the attribution IDs whose RPCs are always traced, regardless of the sampler
+	// configured through JAEGER_SAMPLER_*. They are changed at runtime with PUT /debug/trace-sampling on the debug
+	// listener.
+	TraceSamplingAttributionIDs []string `json:"traceSamplingAttributionIds,omitempty"`
+
 	// billInstancesAfter sets the date after which instances should be considered for billing -
 	// instances started before `billInstancesAfter` will not be considered by the billing controller.
 	BillInstancesAfter *time.Time `json:"billInstancesAfter,omitempty"`
@@ -48,17 +257,145 @@ type Config struct {
 func Start(cfg Config) error {
 	log.WithField("config", cfg).Info("Starting usage component.")
 
-	conn, err := db.Connect(db.ConnectionParams{
-		User:     os.Getenv("DB_USERNAME"),
-		Password: os.Getenv("DB_PASSWORD"),
-		Host:     net.JoinHostPort(os.Getenv("DB_HOST"), os.Getenv("DB_PORT")),
-		Database: "gitpod",
+	conn, err := connectDatabase()
+	if err != nil {
+		return err
+	}
+
+	// Listing usage and generating reports read from the replica, when one is configured.
+	var replicaConn *gorm.DB
+	if replicaHost := os.Getenv("DB_REPLICA_HOST"); replicaHost != "" {
+		replicaPort := os.Getenv("DB_REPLICA_PORT")
+		if replicaPort == "" {
+			replicaPort = os.Getenv("DB_PORT")
+		}
+		replicaConn, err = db.ConnectReplica(db.ConnectionParams{
+			User:     os.Getenv("DB_USERNAME"),
+			Password: os.Getenv("DB_PASSWORD"),
+			Host:     net.JoinHostPort(replicaHost, replicaPort),
+			Database: "gitpod",
+		})
+		if err != nil {
+			return fmt.Errorf("failed to set up read replica connection: %w", err)
+		}
+	}
+	if cfg.DatabasePool != nil {
+		err = db.ConfigurePool(conn, *cfg.DatabasePool)
+		if err != nil {
+			return fmt.Errorf("failed to configure database connection pool: %w", err)
+		}
+		if replicaConn != nil {
+			err = db.ConfigurePool(replicaConn, *cfg.DatabasePool)
+			if err != nil {
+				return fmt.Errorf("failed to configure read replica connection pool: %w", err)
+			}
+		}
+	}
+	if cfg.MetadataEncryption != nil {
+		metadataCipher, err := db.ReadMetadataCipher(*cfg.MetadataEncryption)
+		if err != nil {
+			return fmt.Errorf("failed to set up metadata encryption: %w", err)
+		}
+		err = conn.Use(&db.MetadataEncryption{Cipher: metadataCipher})
+		if err != nil {
+			return fmt.Errorf("failed to set up metadata encryption: %w", err)
+		}
+		if replicaConn != nil {
+			err = replicaConn.Use(&db.MetadataEncryption{Cipher: metadataCipher})
+			if err != nil {
+				return fmt.Errorf("failed to set up metadata encryption of the read replica: %w", err)
+			}
+		}
+	}
+	if cfg.MetadataRedaction != nil {
+		metadataRedactor, err := db.ReadMetadataRedactor(*cfg.MetadataRedaction)
+		if err != nil {
+			return fmt.Errorf("failed to set up metadata redaction: %w", err)
+		}
+		db.SetMetadataRedaction(metadataRedactor)
+	}
+	if cfg.DatabaseQueryTimeouts != nil {
+		err = db.ConfigureQueryTimeouts(conn, *cfg.DatabaseQueryTimeouts)
+		if err != nil {
+			return fmt.Errorf("failed to configure database query timeouts: %w", err)
+		}
+		if replicaConn != nil {
+			err = db.ConfigureQueryTimeouts(replicaConn, *cfg.DatabaseQueryTimeouts)
+			if err != nil {
+				return fmt.Errorf("failed to configure read replica query timeouts: %w", err)
+			}
+		}
+	}
+	var slowQueries db.SlowQueryConfig
+	if cfg.DatabaseSlowQueries != nil {
+		slowQueries = *cfg.DatabaseSlowQueries
+	}
+	err = db.CaptureSlowQueries(conn, slowQueries)
+	if err != nil {
+		return fmt.Errorf("failed to capture slow database queries: %w", err)
+	}
+	if replicaConn != nil {
+		err = db.CaptureSlowQueries(replicaConn, slowQueries)
+		if err != nil {
+			return fmt.Errorf("failed to capture slow read replica queries: %w", err)
+		}
+	}
+	if cfg.MaxReplicationLag < 0 {
+		return fmt.Errorf("max replication lag must not be negative, was %s", time.Duration(cfg.MaxReplicationLag))
+	}
+	replica := db.NewReplicaRouter(conn, replicaConn, db.DefaultReplicaCheckInterval, time.Duration(cfg.MaxReplicationLag))
+
+	// Missing indexes make queries on usage slow, but do not break them.
+	missingIndexes, err := db.FindMissingIndexes(context.Background(), conn, db.UsageIndexes)
+	if err != nil {
+		log.WithError(err).Warn("Failed to check for missing indexes.")
+	}
+	for _, index := range missingIndexes {
+		log.WithField("index", index.String()).Warn("Index is missing, queries on usage will be slow. Check that all database migrations ran.")
+	}
+
+	// Readiness is reported per dependency, see readiness. Only the database is critical, the component is not ready
+	// while it fails.
+	health := newReadiness()
+	sqlDB, err := conn.DB()
+	if err != nil {
+		return fmt.Errorf("failed to get database connection pool: %w", err)
+	}
+	health.AddDependencyCheck(dependencyDatabase, true, "database", healthcheck.DatabasePingCheck(sqlDB, time.Second))
+	health.AddDependencyCheck(dependencyDatabase, true, "database-migrations", func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		return db.CheckMigration(ctx, conn, db.LatestMigration)
 	})
+	if replicaConn != nil {
+		// Reads fall back to the primary while the check fails. The component is not ready either, such that traffic
+		// shifts to instances with a healthy replica.
+		health.AddDependencyCheck(dependencyDatabase, true, "database-replica", replica.HealthCheck)
+	}
+	slos := apiv1.DefaultSLOs
+	if len(cfg.SLOs) > 0 {
+		slos = cfg.SLOs
+	}
+	sloInterceptor, err := apiv1.NewSLOInterceptor(slos)
+	if err != nil {
+		return err
+	}
+	traceSampling, err := apiv1.NewTraceSampling(cfg.TraceSamplingAttributionIDs)
 	if err != nil {
-		return fmt.Errorf("failed to establish database connection: %w", err)
+		return fmt.Errorf("invalid trace sampling attribution IDs: %w", err)
 	}
 
-	var serverOpts []baseserver.Option
+	serverOpts := []baseserver.Option{
+		baseserver.WithHealthHandler(health),
+		baseserver.WithGRPCHealthService(health),
+		// Request IDs are adopted or generated first, such that the audit events and logs of every RPC carry them.
+		baseserver.WithGRPCUnaryInterceptors(requestid.UnaryServerInterceptor(), sloInterceptor, apiv1.NewAuditInterceptor(conn), apiv1.NewErrorReasonInterceptor(), traceSampling.UnaryServerInterceptor()),
+		// Request counts, latencies and status codes of every RPC are exported from the start, such that SLOs are
+		// measured on the server rather than by its clients.
+		baseserver.WithInitializedGRPCMetrics(),
+		// The debug endpoints expose profiles and internals, they are only reached through kubectl port-forward.
+		baseserver.WithDebugAddress(fmt.Sprintf("127.0.0.1:%d", baseserver.BuiltinDebugPort)),
+	}
 	if cfg.Server != nil {
 		serverOpts = append(serverOpts, baseserver.WithConfig(cfg.Server))
 	}
@@ -68,6 +405,43 @@ func Start(cfg Config) error {
 		return fmt.Errorf("failed to initialize usage server: %w", err)
 	}
 
+	databases := map[string]*sql.DB{"gitpod": sqlDB}
+	if replicaConn != nil {
+		replicaDB, err := replicaConn.DB()
+		if err != nil {
+			return fmt.Errorf("failed to get read replica connection pool: %w", err)
+		}
+		databases["gitpod_replica"] = replicaDB
+	}
+	registerDebugHandlers(srv.DebugMux(), databases)
+	srv.DebugMux().Handle("/debug/trace-sampling", traceSampling)
+
+	err = db.RegisterPoolMetrics(srv.MetricsRegistry(), conn, "gitpod")
+	if err != nil {
+		return fmt.Errorf("failed to register database metrics: %w", err)
+	}
+	if replicaConn != nil {
+		err = db.RegisterPoolMetrics(srv.MetricsRegistry(), replicaConn, "gitpod_replica")
+		if err != nil {
+			return fmt.Errorf("failed to register read replica database metrics: %w", err)
+		}
+	}
+
+	err = db.InstrumentQueries(conn)
+	if err != nil {
+		return fmt.Errorf("failed to instrument database queries: %w", err)
+	}
+	if replicaConn != nil {
+		err = db.InstrumentQueries(replicaConn)
+		if err != nil {
+			return fmt.Errorf("failed to instrument read replica database queries: %w", err)
+		}
+	}
+	err = db.RegisterMetrics(srv.MetricsRegistry())
+	if err != nil {
+		return fmt.Errorf("failed to register database query metrics: %w", err)
+	}
+
 	grpcClientMetrics := grpc_prometheus.NewClientMetrics()
 	err = srv.MetricsRegistry().Register(grpcClientMetrics)
 	if err != nil {
@@ -76,8 +450,16 @@ func Start(cfg Config) error {
 	selfConnection, err := grpc.Dial(srv.GRPCAddress(),
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
 		grpcDialerWithInitialDelay(1*time.Second),
-		grpc.WithUnaryInterceptor(grpcClientMetrics.UnaryClientInterceptor()),
-		grpc.WithStreamInterceptor(grpcClientMetrics.StreamClientInterceptor()),
+		// Reconciliations call the usage service through the self-connection, which propagates their traces and request IDs.
+		grpc.WithChainUnaryInterceptor(
+			grpc_opentracing.UnaryClientInterceptor(grpc_opentracing.WithTracer(opentracing.GlobalTracer())),
+			grpcClientMetrics.UnaryClientInterceptor(),
+			requestid.UnaryClientInterceptor(),
+		),
+		grpc.WithChainStreamInterceptor(
+			grpc_opentracing.StreamClientInterceptor(grpc_opentracing.WithTracer(opentracing.GlobalTracer())),
+			grpcClientMetrics.StreamClientInterceptor(),
+		),
 		grpc.WithDefaultCallOptions(
 			grpc.MaxCallRecvMsgSize(100*1024*1024),
 			grpc.MaxCallSendMsgSize(100*1024*1024),
@@ -86,13 +468,34 @@ func Start(cfg Config) error {
 		return fmt.Errorf("failed to create self-connection to grpc server: %w", err)
 	}
 
-	pricer, err := apiv1.NewWorkspacePricer(cfg.CreditsPerMinuteByWorkspaceClass)
+	pricer, err := apiv1.NewWorkspacePricerWithPlans(cfg.CreditsPerMinuteByWorkspaceClass, cfg.CreditsPerMinuteByPlan)
 	if err != nil {
 		return fmt.Errorf("failed to create workspace pricer: %w", err)
 	}
+	if cfg.ExternalPricing != nil {
+		pricingConn, err := grpc.Dial(cfg.ExternalPricing.Address,
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithChainUnaryInterceptor(
+				grpcClientMetrics.UnaryClientInterceptor(),
+			),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to dial pricing service: %w", err)
+		}
+		pricer, err = pricer.WithExternalPricing(v1.NewPricingServiceClient(pricingConn), *cfg.ExternalPricing)
+		if err != nil {
+			return fmt.Errorf("failed to create external workspace pricer: %w", err)
+		}
+	}
+
+	if cfg.BillingDisabled && (cfg.StripeCredentialsFile != "" || cfg.StripeWebhookSigningSecretPath != "") {
+		return fmt.Errorf("stripe must not be configured when billing is disabled")
+	}
 
 	var stripeClient *stripe.Client
-	if cfg.StripeCredentialsFile != "" {
+	if cfg.BillingDisabled {
+		log.Info("Billing is disabled, usage will be tracked without a payment provider.")
+	} else if cfg.StripeCredentialsFile != "" {
 		config, err := stripe.ReadConfigFromFile(cfg.StripeCredentialsFile)
 		if err != nil {
 			return fmt.Errorf("failed to load stripe credentials: %w", err)
@@ -104,6 +507,90 @@ func Start(cfg Config) error {
 		}
 
 		stripeClient = c
+		// The check fails while calls to Stripe are suspended by the circuit breaker. Billing is degraded then, but usage
+		// is still recorded, so the component stays ready.
+		health.AddDependencyCheck(dependencyBillingProvider, false, "stripe", stripeClient.HealthCheck)
+	}
+
+	var usageEvents apiv1.UsageEventPublisher
+	if cfg.UsageEventsMessageBus != nil {
+		messageBus, err := notifier.NewMessageBus(*cfg.UsageEventsMessageBus)
+		if err != nil {
+			return fmt.Errorf("failed to initialize usage events message bus: %w", err)
+		}
+		defer messageBus.Close()
+		usageEvents = messageBus
+	}
+
+	var usageExporters []apiv1.UsageExporter
+	if cfg.BigQueryExport != nil {
+		bigQueryExporter, err := export.NewBigQueryExporter(context.Background(), *cfg.BigQueryExport)
+		if err != nil {
+			return fmt.Errorf("failed to initialize BigQuery usage export: %w", err)
+		}
+		defer bigQueryExporter.Close()
+		usageExporters = append(usageExporters, bigQueryExporter)
+	}
+	if cfg.StageExport != nil {
+		stageExporter, err := export.NewStageExporter(context.Background(), *cfg.StageExport)
+		if err != nil {
+			return fmt.Errorf("failed to initialize stage usage export: %w", err)
+		}
+		defer stageExporter.Close()
+		usageExporters = append(usageExporters, stageExporter)
+	}
+
+	var stripeWebhookHandler http.Handler = webhooks.NewNoopWebhookHandler()
+	if cfg.StripeWebhookSigningSecretPath != "" && stripeClient != nil {
+		stripeWebhookSecret, err := readStripeWebhookSecret(cfg.StripeWebhookSigningSecretPath)
+		if err != nil {
+			return fmt.Errorf("failed to read stripe webhook secret: %w", err)
+		}
+
+		var disputeNotifier webhooks.DisputeNotifier
+		if cfg.DisputeWebhook != nil {
+			webhook, err := notifier.NewWebhook(*cfg.DisputeWebhook)
+			if err != nil {
+				return fmt.Errorf("failed to initialize dispute webhook: %w", err)
+			}
+			disputeNotifier = webhook
+		}
+		stripeWebhookHandler = webhooks.NewStripeWebhookHandler(conn, stripeClient, stripeWebhookSecret, disputeNotifier, usageEvents)
+	} else {
+		log.Info("No stripe webhook secret is configured, endpoints will return NotImplemented")
+	}
+	srv.HTTPMux().Handle("/stripe/invoices/webhook", stripeWebhookHandler)
+
+	var httpAPIToken string
+	if cfg.GraphQLEnabled || cfg.RESTEnabled {
+		httpAPIToken, err = readHTTPAPIToken(cfg.HTTPAPITokenFile)
+		if err != nil {
+			return fmt.Errorf("failed to initialize HTTP APIs: %w", err)
+		}
+	}
+
+	if cfg.GraphQLEnabled {
+		graphQLHandler, err := graph.NewHandler(v1.NewUsageServiceClient(selfConnection))
+		if err != nil {
+			return fmt.Errorf("failed to initialize GraphQL handler: %w", err)
+		}
+		srv.HTTPMux().Handle("/graphql", requireBearerToken(httpAPIToken, graphQLHandler))
+	}
+
+	if cfg.RESTEnabled {
+		restHandler, err := newRESTHandler(context.Background(), v1.NewUsageServiceClient(selfConnection), httpAPIToken)
+		if err != nil {
+			return fmt.Errorf("failed to initialize REST handler: %w", err)
+		}
+		srv.HTTPMux().Handle(restPrefix, restHandler)
+	}
+
+	var alerter *notifier.Alerter
+	if cfg.Alerts != nil {
+		alerter, err = notifier.NewAlerter(*cfg.Alerts)
+		if err != nil {
+			return fmt.Errorf("failed to initialize alerts: %w", err)
+		}
 	}
 
 	if cfg.ControllerSchedule != "" {
@@ -113,11 +600,40 @@ func Start(cfg Config) error {
 			return fmt.Errorf("failed to parse schedule duration: %w", err)
 		}
 
+		if cfg.ReconciliationEscalationThreshold < 0 {
+			return fmt.Errorf("invalid reconciliation escalation threshold of %d", cfg.ReconciliationEscalationThreshold)
+		}
+		var escalators []controller.FailureEscalator
+		if cfg.ReconciliationWebhook != nil {
+			webhook, err := notifier.NewWebhook(*cfg.ReconciliationWebhook)
+			if err != nil {
+				return fmt.Errorf("failed to initialize reconciliation webhook: %w", err)
+			}
+			escalators = append(escalators, webhook)
+		}
+		if cfg.ReconciliationPagerDuty != nil {
+			pagerDuty, err := notifier.NewPagerDuty(*cfg.ReconciliationPagerDuty)
+			if err != nil {
+				return fmt.Errorf("failed to initialize reconciliation PagerDuty: %w", err)
+			}
+			escalators = append(escalators, pagerDuty)
+		}
+		if alerter != nil {
+			escalators = append(escalators, alerter)
+		}
+		escalate := func(name string, reconciler controller.Reconciler) controller.Reconciler {
+			return controller.EscalateFailures(name, reconciler, cfg.ReconciliationEscalationThreshold, escalators...)
+		}
+
 		usageClient := v1.NewUsageServiceClient(selfConnection)
-		ctrl, err := controller.New(schedule, controller.NewUsageAndBillingReconciler(
+		var billingClient v1.BillingServiceClient
+		if !cfg.BillingDisabled {
+			billingClient = v1.NewBillingServiceClient(selfConnection)
+		}
+		ctrl, err := controller.New(schedule, escalate("usage_and_billing", controller.NewUsageAndBillingReconciler(
 			usageClient,
-			v1.NewBillingServiceClient(selfConnection),
-		))
+			billingClient,
+		)))
 		if err != nil {
 			return fmt.Errorf("failed to initialize usage controller: %w", err)
 		}
@@ -128,7 +644,7 @@ func Start(cfg Config) error {
 		}
 		defer ctrl.Stop()
 
-		ledgerCtrl, err := controller.New(schedule, controller.NewLedgerReconciler(usageClient))
+		ledgerCtrl, err := controller.New(schedule, escalate("ledger", controller.NewLedgerReconciler(usageClient, billingClient)))
 		if err != nil {
 			return fmt.Errorf("failed to initialize ledger controller: %w", err)
 		}
@@ -138,6 +654,178 @@ func Start(cfg Config) error {
 			return fmt.Errorf("failed tostart ledger controller: %w", err)
 		}
 		defer ledgerCtrl.Stop()
+
+		if cfg.FreeTierCredits < 0 {
+			return fmt.Errorf("invalid free tier of %f credits", cfg.FreeTierCredits)
+		}
+		freeTierCtrl, err := controller.NewWithSpec("@hourly", escalate("free_tier", controller.NewFreeTierReconciler(usageClient, cfg.FreeTierCredits)))
+		if err != nil {
+			return fmt.Errorf("failed to initialize free tier controller: %w", err)
+		}
+
+		err = freeTierCtrl.Start()
+		if err != nil {
+			return fmt.Errorf("failed to start free tier controller: %w", err)
+		}
+		defer freeTierCtrl.Stop()
+
+		staleDraftAge := time.Duration(cfg.StaleDraftAge)
+		if staleDraftAge < 0 {
+			return fmt.Errorf("invalid stale draft age of %s", staleDraftAge)
+		}
+		if staleDraftAge == 0 {
+			staleDraftAge = defaultStaleDraftAge
+		}
+		janitorCtrl, err := controller.NewWithSpec("@hourly", escalate("janitor", controller.NewJanitorReconciler(usageClient, staleDraftAge)))
+		if err != nil {
+			return fmt.Errorf("failed to initialize janitor controller: %w", err)
+		}
+
+		err = janitorCtrl.Start()
+		if err != nil {
+			return fmt.Errorf("failed to start janitor controller: %w", err)
+		}
+		defer janitorCtrl.Stop()
+
+		cachedBalanceCtrl, err := controller.NewWithSpec("@every 6h", escalate("cached_balance", controller.NewCachedBalanceReconciler(usageClient)))
+		if err != nil {
+			return fmt.Errorf("failed to initialize cached balance controller: %w", err)
+		}
+
+		err = cachedBalanceCtrl.Start()
+		if err != nil {
+			return fmt.Errorf("failed to start cached balance controller: %w", err)
+		}
+		defer cachedBalanceCtrl.Stop()
+
+		usagePartitionCtrl, err := controller.NewWithSpec("@daily", escalate("usage_partition", controller.ReconcilerFunc(func() error {
+			return db.EnsureUsagePartitions(db.WithCaller(context.Background(), "usage_partition"), conn, time.Now().AddDate(0, usagePartitionMonthsAhead, 0))
+		})))
+		if err != nil {
+			return fmt.Errorf("failed to initialize usage partition controller: %w", err)
+		}
+
+		err = usagePartitionCtrl.Start()
+		if err != nil {
+			return fmt.Errorf("failed to start usage partition controller: %w", err)
+		}
+		defer usagePartitionCtrl.Stop()
+
+		if retention := time.Duration(cfg.UsageRetention); retention != 0 {
+			if retention < minUsageRetention {
+				return fmt.Errorf("invalid usage retention of %s, must be at least %s", retention, minUsageRetention)
+			}
+			usageArchiveCtrl, err := controller.NewWithSpec("@daily", escalate("usage_archive", controller.ReconcilerFunc(func() error {
+				archived, err := db.ArchiveUsage(db.WithCaller(context.Background(), "usage_archive"), conn, time.Now().Add(-retention))
+				if err != nil {
+					return fmt.Errorf("failed to archive usage: %w", err)
+				}
+				log.WithField("usage", archived.Usage).
+					WithField("workspace_instance_usage", archived.WorkspaceInstanceUsage).
+					Info("Archived usage.")
+				return nil
+			})))
+			if err != nil {
+				return fmt.Errorf("failed to initialize usage archive controller: %w", err)
+			}
+
+			err = usageArchiveCtrl.Start()
+			if err != nil {
+				return fmt.Errorf("failed to start usage archive controller: %w", err)
+			}
+			defer usageArchiveCtrl.Stop()
+		}
+
+		if billingClient != nil {
+			lookbackDays := cfg.InvoiceLedgerLookbackDays
+			if lookbackDays < 0 {
+				return fmt.Errorf("invalid invoice ledger lookback of %d days", lookbackDays)
+			}
+			if lookbackDays == 0 {
+				lookbackDays = defaultInvoiceLedgerLookbackDays
+			}
+			// Listing all invoices of the lookback period is expensive, and only catches up on missed webhook deliveries.
+			invoiceLedgerCtrl, err := controller.NewWithSpec("@daily", escalate("invoice_ledger", controller.NewInvoiceLedgerReconciler(billingClient, time.Duration(lookbackDays)*24*time.Hour)))
+			if err != nil {
+				return fmt.Errorf("failed to initialize invoice ledger controller: %w", err)
+			}
+
+			err = invoiceLedgerCtrl.Start()
+			if err != nil {
+				return fmt.Errorf("failed to start invoice ledger controller: %w", err)
+			}
+			defer invoiceLedgerCtrl.Stop()
+
+			billingDriftCtrl, err := controller.NewWithSpec("@daily", escalate("billing_drift", controller.NewBillingDriftReconciler(billingClient)))
+			if err != nil {
+				return fmt.Errorf("failed to initialize billing drift controller: %w", err)
+			}
+
+			err = billingDriftCtrl.Start()
+			if err != nil {
+				return fmt.Errorf("failed to start billing drift controller: %w", err)
+			}
+			defer billingDriftCtrl.Stop()
+		}
+
+		if cfg.UsageWebhooks != nil {
+			usageWebhookCtrl, err := controller.NewWithSpec("@every 1m", escalate("usage_webhooks", controller.NewUsageWebhookReconciler(usageClient)))
+			if err != nil {
+				return fmt.Errorf("failed to initialize usage webhook controller: %w", err)
+			}
+
+			err = usageWebhookCtrl.Start()
+			if err != nil {
+				return fmt.Errorf("failed to start usage webhook controller: %w", err)
+			}
+			defer usageWebhookCtrl.Stop()
+
+			usageSummaryWebhookCtrl, err := controller.NewWithSpec("@daily", escalate("usage_summary_webhooks", controller.NewUsageSummaryWebhookReconciler(usageClient)))
+			if err != nil {
+				return fmt.Errorf("failed to initialize usage summary webhook controller: %w", err)
+			}
+
+			err = usageSummaryWebhookCtrl.Start()
+			if err != nil {
+				return fmt.Errorf("failed to start usage summary webhook controller: %w", err)
+			}
+			defer usageSummaryWebhookCtrl.Stop()
+		}
+
+		if cfg.UsageRemoteWrite != nil {
+			remoteWriter, err := export.NewRemoteWriter(conn, *cfg.UsageRemoteWrite)
+			if err != nil {
+				return fmt.Errorf("failed to initialize usage remote-write: %w", err)
+			}
+			remoteWriteCtrl, err := controller.NewWithSpec("@every "+remoteWriter.Interval().String(), escalate("usage_remote_write", controller.ReconcilerFunc(func() error {
+				ctx, cancel := context.WithTimeout(db.WithCaller(context.Background(), "usage_remote_write"), remoteWriter.Interval())
+				defer cancel()
+				_, err := remoteWriter.Push(ctx)
+				return err
+			})))
+			if err != nil {
+				return fmt.Errorf("failed to initialize usage remote-write controller: %w", err)
+			}
+
+			err = remoteWriteCtrl.Start()
+			if err != nil {
+				return fmt.Errorf("failed to start usage remote-write controller: %w", err)
+			}
+			defer remoteWriteCtrl.Stop()
+		}
+
+		if len(usageExporters) > 0 {
+			usageExportCtrl, err := controller.NewWithSpec("@daily", escalate("usage_export", controller.NewUsageExportReconciler(usageClient)))
+			if err != nil {
+				return fmt.Errorf("failed to initialize usage export controller: %w", err)
+			}
+
+			err = usageExportCtrl.Start()
+			if err != nil {
+				return fmt.Errorf("failed to start usage export controller: %w", err)
+			}
+			defer usageExportCtrl.Stop()
+		}
 	} else {
 		log.Info("No controller schedule specified, controller will be disabled.")
 	}
@@ -148,20 +836,166 @@ func Start(cfg Config) error {
 	}
 	var contentService contentservice.Interface = &contentservice.NoOpClient{}
 	if cfg.ContentServiceAddress != "" {
-		contentServiceConn, err := grpc.Dial(cfg.ContentServiceAddress, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		contentServiceConn, err := grpc.Dial(cfg.ContentServiceAddress,
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithChainUnaryInterceptor(
+				grpc_opentracing.UnaryClientInterceptor(grpc_opentracing.WithTracer(opentracing.GlobalTracer())),
+				requestid.UnaryClientInterceptor(),
+			),
+		)
 		if err != nil {
 			return fmt.Errorf("failed to dial contentservice: %w", err)
 		}
-		contentService = contentservice.New(api.NewUsageReportServiceClient(contentServiceConn))
+		contentService = contentservice.New(api.NewUsageReportServiceClient(contentServiceConn), cfg.SummaryCurrency)
+		// Only reports depend on the content service, the component stays ready without it.
+		health.AddDependencyCheck(dependencyContentService, false, "content-service", connectionHealthCheck(contentServiceConn))
 	}
 
-	reportGenerator := apiv1.NewReportGenerator(conn, pricer)
+	if cfg.ReportWebhook != nil {
+		webhook, err := notifier.NewWebhook(*cfg.ReportWebhook)
+		if err != nil {
+			return fmt.Errorf("failed to initialize report webhook: %w", err)
+		}
+		contentService = notifier.WithWebhook(contentService, webhook)
+	}
+
+	if cfg.ReportNotifications != nil {
+		if cfg.ContentServiceAddress == "" {
+			return fmt.Errorf("report notifications require a content service address")
+		}
+
+		reportNotifier, err := notifier.NewReportNotifier(*cfg.ReportNotifications, contentService)
+		if err != nil {
+			return fmt.Errorf("failed to initialize report notifier: %w", err)
+		}
 
-	err = registerGRPCServices(srv, conn, stripeClient, reportGenerator, contentService, pricer, *cfg.BillInstancesAfter)
+		reportCtrl, err := controller.NewWithSpec("@monthly", controller.NewMonthlyReportReconciler(
+			v1.NewUsageServiceClient(selfConnection),
+			reportNotifier,
+		))
+		if err != nil {
+			return fmt.Errorf("failed to initialize monthly report controller: %w", err)
+		}
+
+		err = reportCtrl.Start()
+		if err != nil {
+			return fmt.Errorf("failed to start monthly report controller: %w", err)
+		}
+		defer reportCtrl.Stop()
+	}
+
+	var spendingLimitNotifiers multiSpendingLimitNotifier
+	if cfg.SpendingLimitWebhook != nil {
+		webhook, err := notifier.NewWebhook(*cfg.SpendingLimitWebhook)
+		if err != nil {
+			return fmt.Errorf("failed to initialize spending limit webhook: %w", err)
+		}
+		spendingLimitNotifiers = append(spendingLimitNotifiers, webhook)
+	}
+	if alerter != nil {
+		spendingLimitNotifiers = append(spendingLimitNotifiers, alerter)
+	}
+	var spendingLimitNotifier apiv1.SpendingLimitNotifier
+	switch len(spendingLimitNotifiers) {
+	case 0:
+	case 1:
+		spendingLimitNotifier = spendingLimitNotifiers[0]
+	default:
+		spendingLimitNotifier = spendingLimitNotifiers
+	}
+
+	var limitStates v1.UsageNotificationServiceClient
+	if cfg.SpendingLimitNotificationAddress != "" {
+		serverConn, err := grpc.Dial(cfg.SpendingLimitNotificationAddress,
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithChainUnaryInterceptor(
+				grpc_opentracing.UnaryClientInterceptor(grpc_opentracing.WithTracer(opentracing.GlobalTracer())),
+				grpcClientMetrics.UnaryClientInterceptor(),
+				requestid.UnaryClientInterceptor(),
+			),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to dial spending limit notification service: %w", err)
+		}
+		limitStates = v1.NewUsageNotificationServiceClient(serverConn)
+	}
+
+	var graceMargin apiv1.SpendingLimitGraceMargin
+	if cfg.SpendingLimitGraceMargin != nil {
+		err = cfg.SpendingLimitGraceMargin.Validate()
+		if err != nil {
+			return fmt.Errorf("invalid spending limit grace margin: %w", err)
+		}
+		graceMargin = *cfg.SpendingLimitGraceMargin
+	}
+
+	err = cfg.TaxRates.Validate()
+	if err != nil {
+		return fmt.Errorf("invalid tax rates: %w", err)
+	}
+
+	err = cfg.CreditPrices.Validate()
+	if err != nil {
+		return fmt.Errorf("invalid credit prices: %w", err)
+	}
+
+	dunningPeriods := apiv1.DefaultDunningPeriods
+	if cfg.DunningPeriods != nil {
+		err = cfg.DunningPeriods.Validate()
+		if err != nil {
+			return fmt.Errorf("invalid dunning periods: %w", err)
+		}
+		dunningPeriods = *cfg.DunningPeriods
+	}
+
+	deletedUsageRetention := time.Duration(cfg.DeletedUsageRetention)
+	if deletedUsageRetention < 0 {
+		return fmt.Errorf("invalid deleted usage retention of %s", deletedUsageRetention)
+	}
+	if deletedUsageRetention == 0 {
+		deletedUsageRetention = apiv1.DefaultDeletedUsageRetention
+	}
+
+	err = cfg.ReconciliationLogSampling.Validate()
+	if err != nil {
+		return fmt.Errorf("invalid reconciliation log sampling: %w", err)
+	}
+
+	var analyticsWriter analytics.Writer
+	if cfg.UsageAnalytics {
+		analyticsWriter = analytics.NewFromEnvironment()
+		defer analyticsWriter.Close()
+	}
+
+	var usageWriteQueue *db.UsageWriteQueue
+	if cfg.UsageWriteQueue != nil {
+		usageWriteQueue, err = db.NewUsageWriteQueue(conn, *cfg.UsageWriteQueue)
+		if err != nil {
+			return fmt.Errorf("failed to initialize usage write queue: %w", err)
+		}
+		usageWriteQueue.Start()
+		// The queue is closed when the server stopped serving, such that no more usage is enqueued.
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			if err := usageWriteQueue.Close(ctx); err != nil {
+				log.WithError(err).Error("Failed to write pending usage on shutdown, the next reconciliation writes it.")
+			}
+		}()
+	}
+
+	reportGenerator := apiv1.NewReportGenerator(conn, pricer, replica, cfg.ReconciliationLogSampling)
+
+	err = registerGRPCServices(srv, conn, cfg.BillingDisabled, stripeClient, reportGenerator, contentService, pricer, spendingLimitNotifier, graceMargin, *cfg.BillInstancesAfter, cfg.StripePrices, cfg.TaxRates, cfg.CreditPrices, dunningPeriods, deletedUsageRetention, replica, cfg.AttributionMetrics, cfg.ReconciliationLogSampling, analyticsWriter, usageEvents, cfg.UsageWebhooks, usageExporters, limitStates, usageWriteQueue)
 	if err != nil {
 		return fmt.Errorf("failed to register gRPC services: %w", err)
 	}
 
+	err = apiv1.RegisterMetrics(srv.MetricsRegistry())
+	if err != nil {
+		return fmt.Errorf("failed to register api metrics: %w", err)
+	}
+
 	err = controller.RegisterMetrics(srv.MetricsRegistry())
 	if err != nil {
 		return fmt.Errorf("failed to register controller metrics: %w", err)
@@ -180,12 +1014,70 @@ func Start(cfg Config) error {
 	return nil
 }
 
-func registerGRPCServices(srv *baseserver.Server, conn *gorm.DB, stripeClient *stripe.Client, reportGenerator *apiv1.ReportGenerator, contentSvc contentservice.Interface, pricer *apiv1.WorkspacePricer, billInstancesAfter time.Time) error {
-	v1.RegisterUsageServiceServer(srv.GRPC(), apiv1.NewUsageService(conn, reportGenerator, contentSvc, pricer))
-	if stripeClient == nil {
+func registerGRPCServices(srv *baseserver.Server, conn *gorm.DB, billingDisabled bool, stripeClient *stripe.Client, reportGenerator *apiv1.ReportGenerator, contentSvc contentservice.Interface, pricer *apiv1.WorkspacePricer, spendingLimitNotifier apiv1.SpendingLimitNotifier, graceMargin apiv1.SpendingLimitGraceMargin, billInstancesAfter time.Time, stripePrices map[string]string, taxRates stripe.TaxRates, creditPrices apiv1.CreditPrices, dunningPeriods apiv1.DunningPeriods, deletedUsageRetention time.Duration, replica *db.ReplicaRouter, attributionMetrics *apiv1.AttributionMetricsConfig, logSampling apiv1.LogSamplingConfig, analyticsWriter analytics.Writer, usageEvents apiv1.UsageEventPublisher, usageWebhooks *apiv1.UsageWebhookConfig, usageExporters []apiv1.UsageExporter, limitStates v1.UsageNotificationServiceClient, usageWriteQueue *db.UsageWriteQueue) error {
+	usageService := apiv1.NewUsageService(conn, reportGenerator, contentSvc, pricer, spendingLimitNotifier, graceMargin, creditPrices, dunningPeriods, deletedUsageRetention, replica, logSampling, analyticsWriter, usageEvents, usageWebhooks, usageExporters, limitStates, usageWriteQueue)
+	v1.RegisterUsageServiceServer(srv.GRPC(), usageService)
+	if attributionMetrics != nil {
+		collector, err := apiv1.NewAttributionUsageCollector(usageService, *attributionMetrics)
+		if err != nil {
+			return err
+		}
+		err = srv.MetricsRegistry().Register(collector)
+		if err != nil {
+			return fmt.Errorf("failed to register attribution metrics: %w", err)
+		}
+	}
+	if billingDisabled {
+		v1.RegisterBillingServiceServer(srv.GRPC(), &apiv1.BillingServiceDisabled{})
+	} else if stripeClient == nil {
 		v1.RegisterBillingServiceServer(srv.GRPC(), &apiv1.BillingServiceNoop{})
 	} else {
-		v1.RegisterBillingServiceServer(srv.GRPC(), apiv1.NewBillingService(stripeClient, billInstancesAfter, conn, contentSvc))
+		v1.RegisterBillingServiceServer(srv.GRPC(), apiv1.NewBillingService(stripeClient, billInstancesAfter, conn, contentSvc, stripePrices, taxRates, creditPrices, usageEvents))
+	}
+	return nil
+}
+
+// ReencryptUsageMetadata encrypts the metadata of all usage with the primary key of the metadata encryption, see
+// db.ReencryptUsageMetadata.
+func ReencryptUsageMetadata(ctx context.Context, cfg Config) error {
+	if cfg.MetadataEncryption == nil {
+		return fmt.Errorf("metadata encryption is not configured")
+	}
+	metadataCipher, err := db.ReadMetadataCipher(*cfg.MetadataEncryption)
+	if err != nil {
+		return fmt.Errorf("failed to set up metadata encryption: %w", err)
+	}
+
+	conn, err := connectDatabase()
+	if err != nil {
+		return err
+	}
+	reencrypted, err := db.ReencryptUsageMetadata(ctx, conn, metadataCipher)
+	log.WithField("reencrypted", reencrypted).Info("Re-encrypted usage metadata.")
+	if err != nil {
+		return fmt.Errorf("failed to re-encrypt usage metadata: %w", err)
 	}
 	return nil
 }
+
+func connectDatabase() (*gorm.DB, error) {
+	conn, err := db.Connect(db.ConnectionParams{
+		User:     os.Getenv("DB_USERNAME"),
+		Password: os.Getenv("DB_PASSWORD"),
+		Host:     net.JoinHostPort(os.Getenv("DB_HOST"), os.Getenv("DB_PORT")),
+		Database: "gitpod",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to establish database connection: %w", err)
+	}
+	return conn, nil
+}
+
+func readStripeWebhookSecret(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read stripe webhook secret: %w", err)
+	}
+
+	return strings.TrimSpace(string(b)), nil
+}
@@ -0,0 +1,201 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package stripe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gitpod-io/gitpod/common-go/log"
+	"github.com/gitpod-io/gitpod/common-go/tracing"
+	"github.com/gitpod-io/gitpod/usage/pkg/requestid"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/stripe/stripe-go/v72"
+)
+
+// ErrUnavailable is returned without calling Stripe while the circuit breaker is open.
+var ErrUnavailable = errors.New("stripe is unavailable")
+
+const (
+	DefaultRetryAttempts    = 3
+	DefaultRetryBackoff     = 500 * time.Millisecond
+	DefaultFailureThreshold = 5
+	DefaultBreakerCooldown  = time.Minute
+)
+
+// CircuitBreaker retries calls to Stripe which failed because Stripe is unavailable, and stops calling Stripe
+// altogether after `failureThreshold` consecutive failed calls. After `cooldown`, a single call is let through to
+// probe whether Stripe recovered.
+type CircuitBreaker struct {
+	attempts         int
+	backoff          time.Duration
+	failureThreshold int
+	cooldown         time.Duration
+	nowFunc          func() time.Time
+
+	mu                  sync.Mutex
+	consecutiveFailures int
+	openedAt            time.Time
+	probing             bool
+}
+
+func NewCircuitBreaker(attempts int, backoff time.Duration, failureThreshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		attempts:         attempts,
+		backoff:          backoff,
+		failureThreshold: failureThreshold,
+		cooldown:         cooldown,
+		nowFunc:          time.Now,
+	}
+}
+
+// Do calls fn, retrying with exponential backoff while it fails with a retryable error.
+func (b *CircuitBreaker) Do(ctx context.Context, fn func() error) error {
+	if !b.allow() {
+		return ErrUnavailable
+	}
+
+	backoff := b.backoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || !IsRetryable(err) {
+			b.record(true)
+			return err
+		}
+		if attempt >= b.attempts {
+			b.record(false)
+			return err
+		}
+
+		// The failure itself is logged by Client.call, along with the Stripe request ID.
+		requestid.Log(ctx).WithField("attempt", attempt).WithField("backoff", backoff).Info("Retrying Stripe request.")
+		select {
+		case <-ctx.Done():
+			b.record(false)
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (b *CircuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.consecutiveFailures < b.failureThreshold {
+		return true
+	}
+	if b.probing || b.nowFunc().Sub(b.openedAt) < b.cooldown {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+func (b *CircuitBreaker) record(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	wasOpen := b.consecutiveFailures >= b.failureThreshold
+	b.probing = false
+	if success {
+		if wasOpen {
+			log.Info("Stripe is available again, closing circuit breaker.")
+		}
+		b.consecutiveFailures = 0
+		reportStripeCircuitBreakerOpen(false)
+		return
+	}
+
+	b.consecutiveFailures++
+	if b.consecutiveFailures >= b.failureThreshold {
+		if !wasOpen {
+			log.WithField("failures", b.consecutiveFailures).Warn("Stripe is unavailable, opening circuit breaker.")
+		}
+		b.openedAt = b.nowFunc()
+		reportStripeCircuitBreakerOpen(true)
+	}
+}
+
+// IsRetryable is true for errors which indicate that Stripe is unavailable, rather than that the request is invalid.
+func IsRetryable(err error) bool {
+	if errors.Is(err, ErrUnavailable) {
+		return true
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var stripeErr *stripe.Error
+	if errors.As(err, &stripeErr) {
+		return stripeErr.HTTPStatusCode == http.StatusTooManyRequests ||
+			stripeErr.HTTPStatusCode >= http.StatusInternalServerError ||
+			stripeErr.Type == stripe.ErrorTypeAPIConnection
+	}
+
+	// Errors which did not originate from a Stripe response, for example network errors.
+	return true
+}
+
+// call runs fn through the circuit breaker of the client, if it has one. Every attempt is reported as a request to
+// Stripe for the given operation, e.g. "customers.get", and traced as a span of the trace in ctx, if there is one.
+func (c *Client) call(ctx context.Context, operation string, fn func() error) error {
+	instrumented := func() (err error) {
+		if opentracing.SpanFromContext(ctx) != nil {
+			var span opentracing.Span
+			span, _ = tracing.FromContext(ctx, "stripe."+operation)
+			ext.SpanKindRPCClient.Set(span)
+			if id := requestid.FromContext(ctx); id != "" {
+				span.SetTag(requestid.LogField, id)
+			}
+			defer tracing.FinishSpan(span, &err)
+		}
+
+		start := time.Now()
+		err = fn()
+		reportStripeRequest(operation, time.Since(start), err)
+
+		// Stripe identifies its requests by their own ID, which is logged along with ours to correlate both.
+		var stripeErr *stripe.Error
+		if errors.As(err, &stripeErr) {
+			requestid.Log(ctx).
+				WithError(err).
+				WithField("operation", operation).
+				WithField("stripe_request_id", stripeErr.RequestID).
+				Warn("Stripe request failed.")
+		}
+		return err
+	}
+
+	if c.breaker == nil {
+		return instrumented()
+	}
+	return c.breaker.Do(ctx, instrumented)
+}
+
+// Healthy returns an error while the circuit breaker is open, because Stripe is unavailable.
+func (b *CircuitBreaker) Healthy() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.consecutiveFailures >= b.failureThreshold {
+		return fmt.Errorf("%w: %d consecutive requests failed", ErrUnavailable, b.consecutiveFailures)
+	}
+	return nil
+}
+
+// HealthCheck reports whether Stripe is available, based on the outcome of recent requests.
+func (c *Client) HealthCheck() error {
+	if c.breaker == nil {
+		return nil
+	}
+	return c.breaker.Healthy()
+}
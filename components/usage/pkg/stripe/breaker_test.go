@@ -0,0 +1,118 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package stripe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"github.com/stripe/stripe-go/v72"
+)
+
+var (
+	errStripeDown   = &stripe.Error{HTTPStatusCode: http.StatusServiceUnavailable, Type: stripe.ErrorTypeAPI}
+	errInvalidParam = &stripe.Error{HTTPStatusCode: http.StatusBadRequest, Type: stripe.ErrorTypeInvalidRequest}
+)
+
+func TestCircuitBreaker_RetriesRetryableErrors(t *testing.T) {
+	breaker := NewCircuitBreaker(3, time.Millisecond, 5, time.Minute)
+
+	calls := 0
+	err := breaker.Do(context.Background(), func() error {
+		calls++
+		if calls < 3 {
+			return errStripeDown
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 3, calls)
+
+	calls = 0
+	err = breaker.Do(context.Background(), func() error {
+		calls++
+		return errInvalidParam
+	})
+	require.ErrorIs(t, err, errInvalidParam)
+	require.Equal(t, 1, calls, "invalid requests must not be retried")
+}
+
+func TestCircuitBreaker_OpensAfterConsecutiveFailures(t *testing.T) {
+	now := time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC)
+	breaker := NewCircuitBreaker(1, time.Millisecond, 2, time.Minute)
+	breaker.nowFunc = func() time.Time { return now }
+
+	failing := func() error { return errStripeDown }
+	require.ErrorIs(t, breaker.Do(context.Background(), failing), errStripeDown)
+	require.NoError(t, breaker.Healthy())
+	require.ErrorIs(t, breaker.Do(context.Background(), failing), errStripeDown)
+	require.ErrorIs(t, breaker.Healthy(), ErrUnavailable, "must be unhealthy while the breaker is open")
+
+	calls := 0
+	succeeding := func() error {
+		calls++
+		return nil
+	}
+	require.ErrorIs(t, breaker.Do(context.Background(), succeeding), ErrUnavailable)
+	require.Equal(t, 0, calls, "must not call stripe while the breaker is open")
+
+	now = now.Add(time.Minute)
+	require.NoError(t, breaker.Do(context.Background(), succeeding), "must probe stripe after the cooldown")
+	require.NoError(t, breaker.Do(context.Background(), succeeding), "must close after a successful probe")
+	require.Equal(t, 2, calls)
+	require.NoError(t, breaker.Healthy())
+}
+
+func TestClientCall_ReportsRequests(t *testing.T) {
+	c := &Client{}
+	rateLimited := &stripe.Error{HTTPStatusCode: http.StatusTooManyRequests, Type: stripe.ErrorTypeInvalidRequest}
+
+	require.NoError(t, c.call(context.Background(), "test.succeed", func() error { return nil }))
+	require.ErrorIs(t, c.call(context.Background(), "test.rate_limited", func() error { return rateLimited }), rateLimited)
+
+	require.Equal(t, float64(1), testutil.ToFloat64(stripeRequestsTotal.WithLabelValues("test.succeed", "success")))
+	require.Equal(t, float64(1), testutil.ToFloat64(stripeRequestsTotal.WithLabelValues("test.rate_limited", "fail")))
+	require.Equal(t, float64(0), testutil.ToFloat64(stripeRateLimitedTotal.WithLabelValues("test.succeed")))
+	require.Equal(t, float64(1), testutil.ToFloat64(stripeRateLimitedTotal.WithLabelValues("test.rate_limited")))
+}
+
+func TestClientCall_TracesRequests(t *testing.T) {
+	tracer := mocktracer.New()
+	opentracing.SetGlobalTracer(tracer)
+	t.Cleanup(func() {
+		opentracing.SetGlobalTracer(opentracing.NoopTracer{})
+	})
+
+	c := &Client{}
+	require.NoError(t, c.call(context.Background(), "test.untraced", func() error { return nil }))
+	require.Empty(t, tracer.FinishedSpans())
+
+	parent, ctx := opentracing.StartSpanFromContext(context.Background(), "test")
+	require.ErrorIs(t, c.call(ctx, "test.traced", func() error { return errInvalidParam }), errInvalidParam)
+	parent.Finish()
+
+	spans := tracer.FinishedSpans()
+	require.Len(t, spans, 2)
+	require.Equal(t, "stripe.test.traced", spans[0].OperationName)
+	require.Equal(t, parent.(*mocktracer.MockSpan).SpanContext.SpanID, spans[0].ParentID)
+	require.Equal(t, true, spans[0].Tag("error"))
+}
+
+func TestIsRetryable(t *testing.T) {
+	require.True(t, IsRetryable(fmt.Errorf("failed: %w", errStripeDown)))
+	require.True(t, IsRetryable(&stripe.Error{HTTPStatusCode: http.StatusTooManyRequests}))
+	require.True(t, IsRetryable(errors.New("connection reset by peer")))
+	require.True(t, IsRetryable(ErrUnavailable))
+	require.False(t, IsRetryable(fmt.Errorf("failed: %w", errInvalidParam)))
+	require.False(t, IsRetryable(context.Canceled))
+}
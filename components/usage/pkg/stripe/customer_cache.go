@@ -0,0 +1,92 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package stripe
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/stripe/stripe-go/v72"
+)
+
+const (
+	DefaultCustomerCacheTTL         = 5 * time.Minute
+	DefaultCustomerCacheNegativeTTL = 1 * time.Minute
+)
+
+// CustomerLookupFunc finds the Stripe customer for a key, returning ErrCustomerNotFound if there is none.
+type CustomerLookupFunc func(ctx context.Context, key string) (*stripe.Customer, error)
+
+// CustomerCache caches Stripe customer lookups in-process, such that repeated lookups do not count against the
+// Stripe API rate limits. Keys without a customer are cached as well, for a shorter negativeTTL.
+type CustomerCache struct {
+	lookup      CustomerLookupFunc
+	ttl         time.Duration
+	negativeTTL time.Duration
+	nowFunc     func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]customerCacheEntry
+}
+
+type customerCacheEntry struct {
+	customer  *stripe.Customer
+	expiresAt time.Time
+}
+
+func NewCustomerCache(lookup CustomerLookupFunc, ttl, negativeTTL time.Duration) *CustomerCache {
+	return &CustomerCache{
+		lookup:      lookup,
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		nowFunc:     time.Now,
+		entries:     map[string]customerCacheEntry{},
+	}
+}
+
+// Get returns the customer for key, or ErrCustomerNotFound if there is none.
+func (c *CustomerCache) Get(ctx context.Context, key string) (*stripe.Customer, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && c.nowFunc().Before(entry.expiresAt) {
+		if entry.customer == nil {
+			return nil, ErrCustomerNotFound
+		}
+		return entry.customer, nil
+	}
+
+	customer, err := c.lookup(ctx, key)
+	if err != nil && !errors.Is(err, ErrCustomerNotFound) {
+		// other errors are not cached, the next lookup retries
+		return nil, err
+	}
+
+	ttl := c.ttl
+	if customer == nil {
+		ttl = c.negativeTTL
+	}
+	c.mu.Lock()
+	c.entries[key] = customerCacheEntry{
+		customer:  customer,
+		expiresAt: c.nowFunc().Add(ttl),
+	}
+	c.mu.Unlock()
+
+	if customer == nil {
+		return nil, ErrCustomerNotFound
+	}
+	return customer, nil
+}
+
+// Invalidate removes key from the cache, for example after a customer was created.
+func (c *CustomerCache) Invalidate(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, key)
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package stripe
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stripe/stripe-go/v72"
+)
+
+func TestCustomerCache(t *testing.T) {
+	lookups := map[string]int{}
+	failing := true
+	cache := NewCustomerCache(func(ctx context.Context, key string) (*stripe.Customer, error) {
+		lookups[key]++
+		switch key {
+		case "existing":
+			return &stripe.Customer{ID: "cus_123"}, nil
+		case "failing":
+			if failing {
+				return nil, errors.New("rate limited")
+			}
+			return &stripe.Customer{ID: "cus_456"}, nil
+		default:
+			return nil, ErrCustomerNotFound
+		}
+	}, time.Minute, 10*time.Second)
+
+	now := time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC)
+	cache.nowFunc = func() time.Time { return now }
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		customer, err := cache.Get(ctx, "existing")
+		require.NoError(t, err)
+		require.Equal(t, "cus_123", customer.ID)
+
+		_, err = cache.Get(ctx, "missing")
+		require.ErrorIs(t, err, ErrCustomerNotFound)
+	}
+	require.Equal(t, 1, lookups["existing"])
+	require.Equal(t, 1, lookups["missing"], "missing customers must be cached")
+
+	// negative entries expire before positive ones
+	now = now.Add(30 * time.Second)
+	_, err := cache.Get(ctx, "missing")
+	require.ErrorIs(t, err, ErrCustomerNotFound)
+	_, err = cache.Get(ctx, "existing")
+	require.NoError(t, err)
+	require.Equal(t, 2, lookups["missing"])
+	require.Equal(t, 1, lookups["existing"])
+
+	now = now.Add(time.Minute)
+	_, err = cache.Get(ctx, "existing")
+	require.NoError(t, err)
+	require.Equal(t, 2, lookups["existing"])
+
+	// errors are not cached
+	_, err = cache.Get(ctx, "failing")
+	require.Error(t, err)
+	failing = false
+	customer, err := cache.Get(ctx, "failing")
+	require.NoError(t, err)
+	require.Equal(t, "cus_456", customer.ID)
+
+	cache.Invalidate("existing")
+	_, err = cache.Get(ctx, "existing")
+	require.NoError(t, err)
+	require.Equal(t, 3, lookups["existing"])
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package stripe
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Every mutating request to Stripe carries a deterministic idempotency key, such that a request retried after a
+// timeout is not applied twice. Stripe remembers keys for 24 hours, and rejects a reused key with different parameters.
+
+func usageRecordIdempotencyKey(customerID string, periodStart time.Time, credits int64) string {
+	return fmt.Sprintf("usage-%s-%s-%d", customerID, periodStart.UTC().Format("2006-01"), credits)
+}
+
+func reportUsageRecordIdempotencyKey(subscriptionItemID string, reportID string) string {
+	return fmt.Sprintf("usage-report-%s-%s", subscriptionItemID, reportID)
+}
+
+func invoiceMetadataIdempotencyKey(invoiceID string, metadata map[string]string) string {
+	keys := make([]string, 0, len(metadata))
+	for k := range metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	hash := sha256.New()
+	for _, k := range keys {
+		fmt.Fprintf(hash, "%s=%s\n", k, metadata[k])
+	}
+	return fmt.Sprintf("invoice-metadata-%s-%s", invoiceID, hex.EncodeToString(hash.Sum(nil)))
+}
+
+// customerIdempotencyKey identifies the customer by its owner, such that each team or user gets at most one customer
+// even when the customer is not yet visible in search results.
+func customerIdempotencyKey(metadata map[string]string) (string, error) {
+	if teamID := metadata[TeamIDMetadataKey]; teamID != "" {
+		return fmt.Sprintf("customer-team-%s", teamID), nil
+	}
+	if userID := metadata[UserIDMetadataKey]; userID != "" {
+		return fmt.Sprintf("customer-user-%s", userID), nil
+	}
+	return "", errors.New("customer metadata must identify a team or user")
+}
+
+func subscriptionIdempotencyKey(customerID string) string {
+	return fmt.Sprintf("subscription-%s", customerID)
+}
+
+func attachPaymentMethodIdempotencyKey(paymentMethodID string, customerID string) string {
+	return fmt.Sprintf("attach-payment-method-%s-%s", paymentMethodID, customerID)
+}
+
+func defaultPaymentMethodIdempotencyKey(customerID string, paymentMethodID string) string {
+	return fmt.Sprintf("default-payment-method-%s-%s", customerID, paymentMethodID)
+}
+
+func creditPurchaseIdempotencyKey(customerID string, purchaseID string) string {
+	return fmt.Sprintf("credit-purchase-%s-%s", customerID, purchaseID)
+}
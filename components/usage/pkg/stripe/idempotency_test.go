@@ -0,0 +1,50 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package stripe
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsageRecordIdempotencyKey(t *testing.T) {
+	periodStart := time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC)
+
+	key := usageRecordIdempotencyKey("cus_123", periodStart, 480)
+	require.Equal(t, "usage-cus_123-2022-09-480", key)
+	require.Equal(t, key, usageRecordIdempotencyKey("cus_123", periodStart.Add(time.Hour), 480), "must be stable within the period")
+	require.NotEqual(t, key, usageRecordIdempotencyKey("cus_123", periodStart, 481), "changed usage must be reported again")
+	require.NotEqual(t, key, usageRecordIdempotencyKey("cus_123", periodStart.AddDate(0, 1, 0), 480))
+}
+
+func TestInvoiceMetadataIdempotencyKey(t *testing.T) {
+	key := invoiceMetadataIdempotencyKey("in_123", map[string]string{ReportIDMetadataKey: "report-a", "other": "value"})
+	require.Equal(t, key, invoiceMetadataIdempotencyKey("in_123", map[string]string{"other": "value", ReportIDMetadataKey: "report-a"}), "must not depend on map order")
+	require.NotEqual(t, key, invoiceMetadataIdempotencyKey("in_123", map[string]string{ReportIDMetadataKey: "report-b", "other": "value"}))
+	require.NotEqual(t, key, invoiceMetadataIdempotencyKey("in_456", map[string]string{ReportIDMetadataKey: "report-a", "other": "value"}))
+	require.LessOrEqual(t, len(key), 255, "stripe limits idempotency keys to 255 characters")
+}
+
+func TestCustomerIdempotencyKey(t *testing.T) {
+	key, err := customerIdempotencyKey(map[string]string{TeamIDMetadataKey: "team-a"})
+	require.NoError(t, err)
+	require.Equal(t, "customer-team-team-a", key)
+
+	key, err = customerIdempotencyKey(map[string]string{UserIDMetadataKey: "user-a"})
+	require.NoError(t, err)
+	require.Equal(t, "customer-user-user-a", key)
+
+	_, err = customerIdempotencyKey(map[string]string{})
+	require.Error(t, err)
+}
+
+func TestCreditPurchaseIdempotencyKey(t *testing.T) {
+	key := creditPurchaseIdempotencyKey("cus_123", "purchase-a")
+	require.Equal(t, key, creditPurchaseIdempotencyKey("cus_123", "purchase-a"))
+	require.NotEqual(t, key, creditPurchaseIdempotencyKey("cus_123", "purchase-b"))
+	require.NotEqual(t, key, creditPurchaseIdempotencyKey("cus_456", "purchase-a"))
+}
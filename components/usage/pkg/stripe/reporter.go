@@ -5,8 +5,13 @@
 package stripe
 
 import (
+	"errors"
 	"fmt"
+	"net/http"
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stripe/stripe-go/v72"
 )
 
 var (
@@ -16,11 +21,52 @@ var (
 		Name:      "usage_records_updated_total",
 		Help:      "Counter of usage records updated",
 	}, []string{"outcome"})
+
+	stripeCircuitBreakerOpen = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "gitpod",
+		Subsystem: "stripe",
+		Name:      "circuit_breaker_open",
+		Help:      "Whether calls to Stripe are currently suspended, because Stripe is unavailable",
+	})
+
+	stripePendingUsageSyncs = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "gitpod",
+		Subsystem: "stripe",
+		Name:      "pending_usage_syncs",
+		Help:      "Number of usage syncs queued for retry, because Stripe was unavailable",
+	})
+
+	stripeRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gitpod",
+		Subsystem: "stripe",
+		Name:      "requests_total",
+		Help:      "Counter of requests to the Stripe API, including retries",
+	}, []string{"operation", "outcome"})
+
+	stripeRequestDurationSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "gitpod",
+		Subsystem: "stripe",
+		Name:      "request_duration_seconds",
+		Help:      "Histogram of Stripe API request latency",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	stripeRateLimitedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gitpod",
+		Subsystem: "stripe",
+		Name:      "rate_limited_total",
+		Help:      "Counter of requests to the Stripe API which were rejected because of rate limiting",
+	}, []string{"operation"})
 )
 
 func RegisterMetrics(reg *prometheus.Registry) error {
 	metrics := []prometheus.Collector{
 		stripeUsageUpdateTotal,
+		stripeCircuitBreakerOpen,
+		stripePendingUsageSyncs,
+		stripeRequestsTotal,
+		stripeRequestDurationSeconds,
+		stripeRateLimitedTotal,
 	}
 	for _, metric := range metrics {
 		err := reg.Register(metric)
@@ -39,3 +85,29 @@ func reportStripeUsageUpdate(err error) {
 	}
 	stripeUsageUpdateTotal.WithLabelValues(outcome).Inc()
 }
+
+func reportStripeCircuitBreakerOpen(open bool) {
+	if open {
+		stripeCircuitBreakerOpen.Set(1)
+	} else {
+		stripeCircuitBreakerOpen.Set(0)
+	}
+}
+
+func reportStripePendingUsageSyncs(count int) {
+	stripePendingUsageSyncs.Set(float64(count))
+}
+
+func reportStripeRequest(operation string, duration time.Duration, err error) {
+	outcome := "success"
+	if err != nil {
+		outcome = "fail"
+	}
+	stripeRequestsTotal.WithLabelValues(operation, outcome).Inc()
+	stripeRequestDurationSeconds.WithLabelValues(operation).Observe(duration.Seconds())
+
+	var stripeErr *stripe.Error
+	if errors.As(err, &stripeErr) && stripeErr.HTTPStatusCode == http.StatusTooManyRequests {
+		stripeRateLimitedTotal.WithLabelValues(operation).Inc()
+	}
+}
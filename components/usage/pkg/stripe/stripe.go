@@ -7,22 +7,46 @@ package stripe
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
-	"github.com/gitpod-io/gitpod/common-go/log"
+	"github.com/gitpod-io/gitpod/usage/pkg/requestid"
 	"github.com/stripe/stripe-go/v72"
 	"github.com/stripe/stripe-go/v72/client"
 )
 
+var (
+	ErrCustomerNotFound = errors.New("stripe customer not found")
+	ErrInvoiceNotFound  = errors.New("stripe invoice not found")
+
+	// errBillingPeriodEnded is returned for usage of a billing period which is no longer the current period of the
+	// subscription. Stripe rejects usage records for ended periods.
+	errBillingPeriodEnded = errors.New("billing period ended")
+)
+
+const customerSearchClausesPerQuery = 10
+
 const (
 	ReportIDMetadataKey = "reportId"
 	TeamIDMetadataKey   = "teamId"
+	UserIDMetadataKey   = "userId"
+
+	// AttributionIDMetadataKey and PurchasedCreditsMetadataKey identify payment intents of credit purchases, and
+	// which credits are granted to whom once the payment succeeded.
+	AttributionIDMetadataKey    = "attributionId"
+	PurchasedCreditsMetadataKey = "purchasedCredits"
 )
 
 type Client struct {
 	sc *client.API
+
+	breaker      *CircuitBreaker
+	pendingUsage usageQueue
 }
 
 type ClientConfig struct {
@@ -47,7 +71,10 @@ func ReadConfigFromFile(path string) (ClientConfig, error) {
 
 // New authenticates a Stripe client using the provided config
 func New(config ClientConfig) (*Client, error) {
-	return &Client{sc: client.New(config.SecretKey, nil)}, nil
+	return &Client{
+		sc:      client.New(config.SecretKey, nil),
+		breaker: NewCircuitBreaker(DefaultRetryAttempts, DefaultRetryBackoff, DefaultFailureThreshold, DefaultBreakerCooldown),
+	}, nil
 }
 
 type UsageRecord struct {
@@ -61,6 +88,17 @@ type Invoice struct {
 	Amount         int64
 	Currency       string
 	Credits        int64
+
+	LineItems   []InvoiceLineItem
+	DueDate     time.Time
+	PeriodStart time.Time
+	PeriodEnd   time.Time
+}
+
+type InvoiceLineItem struct {
+	Description string
+	Quantity    int64
+	Amount      int64
 }
 
 type CreditSummary struct {
@@ -78,7 +116,7 @@ func (c *Client) UpdateUsage(ctx context.Context, creditsPerTeam map[string]Cred
 	queries := queriesForCustomersWithTeamIds(teamIds)
 
 	for _, query := range queries {
-		log.Infof("Searching customers in Stripe with query: %q", query)
+		requestid.Log(ctx).Infof("Searching customers in Stripe with query: %q", query)
 
 		customers, err := c.findCustomers(ctx, query)
 		if err != nil {
@@ -87,11 +125,11 @@ func (c *Client) UpdateUsage(ctx context.Context, creditsPerTeam map[string]Cred
 
 		for _, customer := range customers {
 			teamID := customer.Metadata["teamId"]
-			log.Infof("Found customer %q for teamId %q", customer.Name, teamID)
+			requestid.Log(ctx).Infof("Found customer %q for teamId %q", customer.Name, teamID)
 
 			_, err := c.updateUsageForCustomer(ctx, customer, creditsPerTeam[teamID])
 			if err != nil {
-				log.WithField("customer_id", customer.ID).
+				requestid.Log(ctx).WithField("customer_id", customer.ID).
 					WithField("customer_name", customer.Name).
 					WithField("subscriptions", customer.Subscriptions).
 					WithError(err).
@@ -106,6 +144,220 @@ func (c *Client) UpdateUsage(ctx context.Context, creditsPerTeam map[string]Cred
 	return nil
 }
 
+// SetUsageForPeriod sets the usage of each team's subscription to the credits used in the billing period starting at
+// `periodStart`. The usage record is idempotent per (customer, period, credits), such that repeated syncs of unchanged
+// usage are not reported to Stripe twice.
+// Usage which cannot be set because Stripe is unavailable is queued, and set again on the next call, oldest billing
+// period first. Usage of a billing period which ended in Stripe is dropped, it would overwrite the usage of the current
+// period.
+func (c *Client) SetUsageForPeriod(ctx context.Context, creditsPerTeam map[string]int64, periodStart time.Time) error {
+	usageByPeriod := c.pendingUsage.drain()
+	periodStart = periodStart.UTC()
+	if usageByPeriod[periodStart] == nil {
+		usageByPeriod[periodStart] = map[string]int64{}
+	}
+	for teamID, credits := range creditsPerTeam {
+		usageByPeriod[periodStart][teamID] = credits
+	}
+
+	starts := make([]time.Time, 0, len(usageByPeriod))
+	for start := range usageByPeriod {
+		starts = append(starts, start)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i].Before(starts[j]) })
+	for _, start := range starts {
+		c.setUsageForTeams(ctx, usageByPeriod[start], start)
+	}
+	return nil
+}
+
+func (c *Client) setUsageForTeams(ctx context.Context, creditsPerTeam map[string]int64, periodStart time.Time) {
+	teamIds := make([]string, 0, len(creditsPerTeam))
+	for k := range creditsPerTeam {
+		teamIds = append(teamIds, k)
+	}
+
+	for i := 0; i < len(teamIds); i += customerSearchClausesPerQuery {
+		end := i + customerSearchClausesPerQuery
+		if end > len(teamIds) {
+			end = len(teamIds)
+		}
+		batch := teamIds[i:end]
+
+		customers, err := c.findCustomers(ctx, queriesForCustomersWithTeamIds(batch)[0])
+		if err != nil {
+			requestid.Log(ctx).WithError(err).WithField("teams", len(batch)).Error("Failed to find customers to set usage, queueing usage for the next sync.")
+			c.pendingUsage.add(creditsForTeamIDs(creditsPerTeam, batch), periodStart)
+			continue
+		}
+
+		for _, customer := range customers {
+			teamID := customer.Metadata[TeamIDMetadataKey]
+
+			err := c.setUsageForCustomer(ctx, customer, creditsPerTeam[teamID], periodStart)
+			if err != nil {
+				logger := requestid.Log(ctx).WithField("customer_id", customer.ID).
+					WithField("team_id", teamID).
+					WithError(err)
+				if errors.Is(err, errBillingPeriodEnded) {
+					// Setting the usage would overwrite the usage of the current period.
+					logger.WithField("period_start", periodStart).Warn("Billing period ended in Stripe, dropping usage.")
+					continue
+				}
+				if IsRetryable(err) {
+					logger.Error("Failed to set usage, queueing usage for the next sync.")
+					c.pendingUsage.add(creditsForTeamIDs(creditsPerTeam, []string{teamID}), periodStart)
+				} else {
+					logger.Error("Failed to set usage.")
+				}
+
+				reportStripeUsageUpdate(err)
+				continue
+			}
+			reportStripeUsageUpdate(nil)
+		}
+	}
+}
+
+func creditsForTeamIDs(creditsPerTeam map[string]int64, teamIds []string) map[string]int64 {
+	result := map[string]int64{}
+	for _, teamID := range teamIds {
+		result[teamID] = creditsPerTeam[teamID]
+	}
+	return result
+}
+
+func (c *Client) setUsageForCustomer(ctx context.Context, customer *stripe.Customer, credits int64, periodStart time.Time) error {
+	if customer.Subscriptions == nil || len(customer.Subscriptions.Data) != 1 {
+		return fmt.Errorf("customer %s does not have exactly one subscription", customer.ID)
+	}
+	subscription := customer.Subscriptions.Data[0]
+	if len(subscription.Items.Data) != 1 {
+		return fmt.Errorf("subscription %s has an unexpected number of subscriptionItems (expected 1, got %d)", subscription.ID, len(subscription.Items.Data))
+	}
+	subscriptionItemID := subscription.Items.Data[0].ID
+	timestamp, err := usageRecordTimestamp(subscription, periodStart)
+	if err != nil {
+		return fmt.Errorf("failed to set usage for customer %s: %w", customer.ID, err)
+	}
+
+	err = c.call(ctx, "usage_records.create", func() error {
+		_, err := c.sc.UsageRecords.New(&stripe.UsageRecordParams{
+			Params: stripe.Params{
+				Context:        ctx,
+				IdempotencyKey: stripe.String(usageRecordIdempotencyKey(customer.ID, periodStart, credits)),
+			},
+			SubscriptionItem: stripe.String(subscriptionItemID),
+			Quantity:         stripe.Int64(credits),
+			Timestamp:        stripe.Int64(timestamp),
+			Action:           stripe.String(stripe.UsageRecordActionSet),
+		})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set usage for customer %s on subscription item %s: %w", customer.ID, subscriptionItemID, err)
+	}
+	return nil
+}
+
+// usageRecordTimestamp returns the timestamp of the usage record which sets the usage of the billing period starting at
+// periodStart. Stripe rejects usage records with a timestamp before the start of the current subscription period,
+// which starts after periodStart when the subscription was created during the billing period. Any other current
+// subscription period which starts after periodStart is a later billing period, errBillingPeriodEnded is returned.
+func usageRecordTimestamp(subscription *stripe.Subscription, periodStart time.Time) (int64, error) {
+	if subscription.CurrentPeriodStart > periodStart.Unix() && subscription.CurrentPeriodStart > subscription.StartDate {
+		return 0, fmt.Errorf("billing period starting at %s: %w", periodStart, errBillingPeriodEnded)
+	}
+	timestamp := periodStart.Unix()
+	if subscription.CurrentPeriodStart > timestamp {
+		timestamp = subscription.CurrentPeriodStart
+	}
+	return timestamp, nil
+}
+
+// ReportedUsage is the usage of a team's subscription as reported to Stripe.
+type ReportedUsage struct {
+	CustomerID string
+	Credits    int64
+}
+
+// GetUsageForPeriod returns the usage reported for each team's subscription in the billing period starting at
+// `periodStart`, as set by SetUsageForPeriod. Teams without a Stripe customer are omitted, customers without exactly
+// one subscription item have no usage reported.
+func (c *Client) GetUsageForPeriod(ctx context.Context, teamIds []string, periodStart time.Time) (map[string]ReportedUsage, error) {
+	periodStart = periodStart.UTC()
+	result := map[string]ReportedUsage{}
+	for _, query := range queriesForCustomersWithTeamIds(teamIds) {
+		customers, err := c.findCustomers(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, customer := range customers {
+			teamID := customer.Metadata[TeamIDMetadataKey]
+			credits, err := c.getUsageForCustomer(ctx, customer, periodStart)
+			if err != nil {
+				return nil, err
+			}
+			result[teamID] = ReportedUsage{CustomerID: customer.ID, Credits: credits}
+		}
+	}
+	return result, nil
+}
+
+func (c *Client) getUsageForCustomer(ctx context.Context, customer *stripe.Customer, periodStart time.Time) (int64, error) {
+	if customer.Subscriptions == nil || len(customer.Subscriptions.Data) != 1 {
+		return 0, nil
+	}
+	subscription := customer.Subscriptions.Data[0]
+	if subscription.Items == nil || len(subscription.Items.Data) != 1 {
+		return 0, nil
+	}
+	subscriptionItemID := subscription.Items.Data[0].ID
+	timestamp, err := usageRecordTimestamp(subscription, periodStart)
+	if errors.Is(err, errBillingPeriodEnded) {
+		// The summary of an ended period covers its start, or the creation of the subscription during the period.
+		timestamp = periodStart.Unix()
+		if subscription.StartDate > timestamp {
+			timestamp = subscription.StartDate
+		}
+	}
+
+	var credits int64
+	err = c.call(ctx, "usage_record_summaries.list", func() error {
+		credits = 0
+		iter := c.sc.UsageRecordSummaries.List(&stripe.UsageRecordSummaryListParams{
+			ListParams:       stripe.ListParams{Context: ctx},
+			SubscriptionItem: stripe.String(subscriptionItemID),
+		})
+		// Summaries are listed newest first, such that older periods need not be listed.
+		for iter.Next() {
+			summary := iter.UsageRecordSummary()
+			if summaryContains(summary, timestamp) {
+				credits = summary.TotalUsage
+				break
+			}
+			if summary.Period != nil && summary.Period.Start <= timestamp {
+				break
+			}
+		}
+		return iter.Err()
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get usage for customer %s on subscription item %s: %w", customer.ID, subscriptionItemID, err)
+	}
+	return credits, nil
+}
+
+// summaryContains returns whether the usage record summary covers the timestamp. The period of the current billing
+// period has no end yet.
+func summaryContains(summary *stripe.UsageRecordSummary, timestamp int64) bool {
+	if summary.Period == nil {
+		return false
+	}
+	return summary.Period.Start <= timestamp && (summary.Period.End == 0 || timestamp < summary.Period.End)
+}
+
 func (c *Client) findCustomers(ctx context.Context, query string) ([]*stripe.Customer, error) {
 	params := &stripe.CustomerSearchParams{
 		SearchParams: stripe.SearchParams{
@@ -114,14 +366,18 @@ func (c *Client) findCustomers(ctx context.Context, query string) ([]*stripe.Cus
 			Context: ctx,
 		},
 	}
-	iter := c.sc.Customers.Search(params)
-	if iter.Err() != nil {
-		return nil, fmt.Errorf("failed to search for customers: %w", iter.Err())
-	}
 
 	var customers []*stripe.Customer
-	for iter.Next() {
-		customers = append(customers, iter.Customer())
+	err := c.call(ctx, "customers.search", func() error {
+		customers = nil
+		iter := c.sc.Customers.Search(params)
+		for iter.Next() {
+			customers = append(customers, iter.Customer())
+		}
+		return iter.Err()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search for customers: %w", err)
 	}
 
 	return customers, nil
@@ -134,19 +390,23 @@ func (c *Client) updateUsageForCustomer(ctx context.Context, customer *stripe.Cu
 	}
 	subscription := customer.Subscriptions.Data[0]
 
-	log.Infof("Customer has subscription: %q", subscription.ID)
+	requestid.Log(ctx).Infof("Customer has subscription: %q", subscription.ID)
 	if len(subscription.Items.Data) != 1 {
 		return nil, fmt.Errorf("subscription %s has an unexpected number of subscriptionItems (expected 1, got %d)", subscription.ID, len(subscription.Items.Data))
 	}
 
 	subscriptionItemId := subscription.Items.Data[0].ID
-	log.Infof("Registering usage against subscriptionItem %q", subscriptionItemId)
-	_, err := c.sc.UsageRecords.New(&stripe.UsageRecordParams{
-		Params: stripe.Params{
-			Context: ctx,
-		},
-		SubscriptionItem: stripe.String(subscriptionItemId),
-		Quantity:         stripe.Int64(summary.Credits),
+	requestid.Log(ctx).Infof("Registering usage against subscriptionItem %q", subscriptionItemId)
+	err := c.call(ctx, "usage_records.create", func() error {
+		_, err := c.sc.UsageRecords.New(&stripe.UsageRecordParams{
+			Params: stripe.Params{
+				Context:        ctx,
+				IdempotencyKey: stripe.String(reportUsageRecordIdempotencyKey(subscriptionItemId, summary.ReportID)),
+			},
+			SubscriptionItem: stripe.String(subscriptionItemId),
+			Quantity:         stripe.Int64(summary.Credits),
+		})
+		return err
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to register usage for customer %q on subscription item %s", customer.Name, subscriptionItemId)
@@ -170,6 +430,38 @@ func (c *Client) updateUsageForCustomer(ctx context.Context, customer *stripe.Cu
 	}, nil
 }
 
+func (c *Client) GetCustomer(ctx context.Context, customerID string) (*stripe.Customer, error) {
+	var customer *stripe.Customer
+	err := c.call(ctx, "customers.get", func() (err error) {
+		customer, err = c.sc.Customers.Get(customerID, &stripe.CustomerParams{
+			Params: stripe.Params{
+				Context: ctx,
+			},
+		})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get customer %s: %w", customerID, err)
+	}
+	return customer, nil
+}
+
+func (c *Client) GetCharge(ctx context.Context, chargeID string) (*stripe.Charge, error) {
+	var charge *stripe.Charge
+	err := c.call(ctx, "charges.get", func() (err error) {
+		charge, err = c.sc.Charges.Get(chargeID, &stripe.ChargeParams{
+			Params: stripe.Params{
+				Context: ctx,
+			},
+		})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get charge %s: %w", chargeID, err)
+	}
+	return charge, nil
+}
+
 func (c *Client) GetCustomerByTeamID(ctx context.Context, teamID string) (*stripe.Customer, error) {
 	customers, err := c.findCustomers(ctx, fmt.Sprintf("metadata['teamId']:'%s'", teamID))
 	if err != nil {
@@ -177,7 +469,7 @@ func (c *Client) GetCustomerByTeamID(ctx context.Context, teamID string) (*strip
 	}
 
 	if len(customers) == 0 {
-		return nil, fmt.Errorf("no team customer found for id: %s", teamID)
+		return nil, fmt.Errorf("no team customer found for id: %s: %w", teamID, ErrCustomerNotFound)
 	}
 	if len(customers) > 1 {
 		return nil, fmt.Errorf("found multiple team customers for id: %s", teamID)
@@ -193,7 +485,7 @@ func (c *Client) GetCustomerByUserID(ctx context.Context, userID string) (*strip
 	}
 
 	if len(customers) == 0 {
-		return nil, fmt.Errorf("no user customer found for id: %s", userID)
+		return nil, fmt.Errorf("no user customer found for id: %s: %w", userID, ErrCustomerNotFound)
 	}
 	if len(customers) > 1 {
 		return nil, fmt.Errorf("found multiple user customers for id: %s", userID)
@@ -210,29 +502,70 @@ func (c *Client) GetUpcomingInvoice(ctx context.Context, customerID string) (*In
 		},
 		Customer: stripe.String(customerID),
 	}
-	invoice, err := c.sc.Invoices.GetNext(invoiceParams)
+	var invoice *stripe.Invoice
+	err := c.call(ctx, "invoices.upcoming", func() (err error) {
+		invoice, err = c.sc.Invoices.GetNext(invoiceParams)
+		return err
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch the upcoming invoice for customer %s", customerID)
+		return nil, fmt.Errorf("failed to fetch the upcoming invoice for customer %s: %w", customerID, err)
 	}
 	if len(invoice.Lines.Data) < 1 {
 		return nil, fmt.Errorf("no line items on invoice %s for customer %s", invoice.ID, customerID)
 	}
 
-	return &Invoice{
-		ID:             invoice.ID,
-		SubscriptionID: invoice.Subscription.ID,
-		Amount:         invoice.AmountRemaining,
-		Currency:       string(invoice.Currency),
-		Credits:        invoice.Lines.Data[0].Quantity,
-	}, nil
+	return convertInvoice(invoice), nil
+}
+
+func convertInvoice(invoice *stripe.Invoice) *Invoice {
+	result := &Invoice{
+		ID:       invoice.ID,
+		Amount:   invoice.AmountRemaining,
+		Currency: string(invoice.Currency),
+		Credits:  invoice.Lines.Data[0].Quantity,
+	}
+	if invoice.Subscription != nil {
+		result.SubscriptionID = invoice.Subscription.ID
+	}
+
+	for _, line := range invoice.Lines.Data {
+		result.LineItems = append(result.LineItems, InvoiceLineItem{
+			Description: line.Description,
+			Quantity:    line.Quantity,
+			Amount:      line.Amount,
+		})
+	}
+
+	// Automatically charged invoices have no due date, they are charged on the next payment attempt.
+	switch {
+	case invoice.DueDate != 0:
+		result.DueDate = time.Unix(invoice.DueDate, 0)
+	case invoice.NextPaymentAttempt != 0:
+		result.DueDate = time.Unix(invoice.NextPaymentAttempt, 0)
+	}
+
+	if period := invoice.Lines.Data[0].Period; period != nil {
+		result.PeriodStart = time.Unix(period.Start, 0)
+		result.PeriodEnd = time.Unix(period.End, 0)
+	} else {
+		result.PeriodStart = time.Unix(invoice.PeriodStart, 0)
+		result.PeriodEnd = time.Unix(invoice.PeriodEnd, 0)
+	}
+
+	return result
 }
 
 func (c *Client) UpdateInvoiceMetadata(ctx context.Context, invoiceID string, metadata map[string]string) (*stripe.Invoice, error) {
-	invoice, err := c.sc.Invoices.Update(invoiceID, &stripe.InvoiceParams{
-		Params: stripe.Params{
-			Context:  ctx,
-			Metadata: metadata,
-		},
+	var invoice *stripe.Invoice
+	err := c.call(ctx, "invoices.update", func() (err error) {
+		invoice, err = c.sc.Invoices.Update(invoiceID, &stripe.InvoiceParams{
+			Params: stripe.Params{
+				Context:        ctx,
+				IdempotencyKey: stripe.String(invoiceMetadataIdempotencyKey(invoiceID, metadata)),
+				Metadata:       metadata,
+			},
+		})
+		return err
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to update invoice %s metadata: %w", invoiceID, err)
@@ -241,16 +574,66 @@ func (c *Client) UpdateInvoiceMetadata(ctx context.Context, invoiceID string, me
 	return invoice, nil
 }
 
+// ListFinalizedInvoices lists the invoices created within [from, to) which were finalized, and not voided since.
+// The customer of each invoice is expanded.
+func (c *Client) ListFinalizedInvoices(ctx context.Context, from, to time.Time) ([]*stripe.Invoice, error) {
+	params := &stripe.InvoiceListParams{
+		ListParams: stripe.ListParams{
+			Context: ctx,
+			Expand:  []*string{stripe.String("data.customer")},
+		},
+		CreatedRange: &stripe.RangeQueryParams{
+			GreaterThanOrEqual: from.Unix(),
+			LesserThan:         to.Unix(),
+		},
+	}
+
+	var invoices []*stripe.Invoice
+	err := c.call(ctx, "invoices.list", func() error {
+		invoices = nil
+		iter := c.sc.Invoices.List(params)
+		for iter.Next() {
+			invoice := iter.Invoice()
+			if invoice.StatusTransitions.FinalizedAt == 0 || invoice.Status == stripe.InvoiceStatusVoid {
+				continue
+			}
+			invoices = append(invoices, invoice)
+		}
+		return iter.Err()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list invoices: %w", err)
+	}
+
+	return invoices, nil
+}
+
+// InvoiceCredits returns the amount of credits invoiced. Usage is reported to Stripe in credits, so the quantity of
+// the line items is the amount of credits.
+func InvoiceCredits(invoice *stripe.Invoice) int64 {
+	var credits int64
+	if invoice.Lines != nil {
+		for _, line := range invoice.Lines.Data {
+			credits += line.Quantity
+		}
+	}
+	return credits
+}
+
 func (c *Client) GetInvoice(ctx context.Context, invoiceID string) (*stripe.Invoice, error) {
 	if invoiceID == "" {
 		return nil, fmt.Errorf("no invoice ID specified")
 	}
 
-	invoice, err := c.sc.Invoices.Get(invoiceID, &stripe.InvoiceParams{
-		Params: stripe.Params{
-			Context: ctx,
-			Expand:  []*string{stripe.String("data.subscriptions")},
-		},
+	var invoice *stripe.Invoice
+	err := c.call(ctx, "invoices.get", func() (err error) {
+		invoice, err = c.sc.Invoices.Get(invoiceID, &stripe.InvoiceParams{
+			Params: stripe.Params{
+				Context: ctx,
+				Expand:  []*string{stripe.String("data.subscriptions")},
+			},
+		})
+		return err
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get invoice %s: %w", invoiceID, err)
@@ -260,17 +643,16 @@ func (c *Client) GetInvoice(ctx context.Context, invoiceID string) (*stripe.Invo
 
 // queriesForCustomersWithTeamIds constructs Stripe query strings to find the Stripe Customer for each teamId
 // It returns multiple queries, each being a big disjunction of subclauses so that we can process multiple teamIds in one query.
-// `clausesPerQuery` is a limit enforced by the Stripe API.
+// `customerSearchClausesPerQuery` is a limit enforced by the Stripe API.
 func queriesForCustomersWithTeamIds(teamIds []string) []string {
-	const clausesPerQuery = 10
 	var queries []string
 	sb := strings.Builder{}
 
-	for i := 0; i < len(teamIds); i += clausesPerQuery {
+	for i := 0; i < len(teamIds); i += customerSearchClausesPerQuery {
 		sb.Reset()
-		for j := 0; j < clausesPerQuery && i+j < len(teamIds); j++ {
+		for j := 0; j < customerSearchClausesPerQuery && i+j < len(teamIds); j++ {
 			sb.WriteString(fmt.Sprintf("metadata['%s']:'%s'", TeamIDMetadataKey, teamIds[i+j]))
-			if j < clausesPerQuery-1 && i+j < len(teamIds)-1 {
+			if j < customerSearchClausesPerQuery-1 && i+j < len(teamIds)-1 {
 				sb.WriteString(" OR ")
 			}
 		}
@@ -279,3 +661,260 @@ func queriesForCustomersWithTeamIds(teamIds []string) []string {
 
 	return queries
 }
+
+const PreferredCurrencyMetadataKey = "preferredCurrency"
+
+type CreateCustomerParams struct {
+	// Metadata identifies the owner of the customer, using TeamIDMetadataKey or UserIDMetadataKey.
+	Metadata map[string]string
+	Name     string
+	Email    string
+	Currency string
+}
+
+func (c *Client) CreateCustomer(ctx context.Context, params CreateCustomerParams) (*stripe.Customer, error) {
+	metadata := map[string]string{}
+	for k, v := range params.Metadata {
+		metadata[k] = v
+	}
+	if params.Currency != "" {
+		metadata[PreferredCurrencyMetadataKey] = params.Currency
+	}
+
+	idempotencyKey, err := customerIdempotencyKey(params.Metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	var customer *stripe.Customer
+	err = c.call(ctx, "customers.create", func() (err error) {
+		customer, err = c.sc.Customers.New(&stripe.CustomerParams{
+			Params: stripe.Params{
+				Context:        ctx,
+				IdempotencyKey: stripe.String(idempotencyKey),
+				Metadata:       metadata,
+			},
+			Name:  stripe.String(params.Name),
+			Email: stripe.String(params.Email),
+		})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create customer: %w", err)
+	}
+	return customer, nil
+}
+
+// SetDefaultPaymentMethodForCustomer attaches the payment method of the given SetupIntent to the customer, and makes
+// it the default payment method for the customer's invoices.
+func (c *Client) SetDefaultPaymentMethodForCustomer(ctx context.Context, customerID string, setupIntentID string) error {
+	var setupIntent *stripe.SetupIntent
+	err := c.call(ctx, "setup_intents.get", func() (err error) {
+		setupIntent, err = c.sc.SetupIntents.Get(setupIntentID, &stripe.SetupIntentParams{
+			Params: stripe.Params{
+				Context: ctx,
+			},
+		})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get setup intent %s: %w", setupIntentID, err)
+	}
+	if setupIntent.PaymentMethod == nil || setupIntent.PaymentMethod.ID == "" {
+		return fmt.Errorf("setup intent %s does not have a payment method attached", setupIntentID)
+	}
+	paymentMethodID := setupIntent.PaymentMethod.ID
+
+	err = c.call(ctx, "payment_methods.attach", func() error {
+		_, err := c.sc.PaymentMethods.Attach(paymentMethodID, &stripe.PaymentMethodAttachParams{
+			Params: stripe.Params{
+				Context:        ctx,
+				IdempotencyKey: stripe.String(attachPaymentMethodIdempotencyKey(paymentMethodID, customerID)),
+			},
+			Customer: stripe.String(customerID),
+		})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to attach payment method %s to customer %s: %w", paymentMethodID, customerID, err)
+	}
+
+	err = c.call(ctx, "customers.update", func() error {
+		_, err := c.sc.Customers.Update(customerID, &stripe.CustomerParams{
+			Params: stripe.Params{
+				Context:        ctx,
+				IdempotencyKey: stripe.String(defaultPaymentMethodIdempotencyKey(customerID, paymentMethodID)),
+			},
+			InvoiceSettings: &stripe.CustomerInvoiceSettingsParams{
+				DefaultPaymentMethod: stripe.String(paymentMethodID),
+			},
+		})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set default payment method for customer %s: %w", customerID, err)
+	}
+	return nil
+}
+
+// CreateSubscription subscribes the customer to the usage-based price, billed on the first of each month starting
+// with `billingCycleAnchor`. Subscriptions are created at most once per customer.
+func (c *Client) CreateSubscription(ctx context.Context, customerID string, priceID string, billingCycleAnchor time.Time) (*stripe.Subscription, error) {
+	var subscription *stripe.Subscription
+	err := c.call(ctx, "subscriptions.create", func() (err error) {
+		subscription, err = c.sc.Subscriptions.New(&stripe.SubscriptionParams{
+			Params: stripe.Params{
+				Context:        ctx,
+				IdempotencyKey: stripe.String(subscriptionIdempotencyKey(customerID)),
+			},
+			Customer: stripe.String(customerID),
+			Items: []*stripe.SubscriptionItemsParams{
+				{
+					Price: stripe.String(priceID),
+				},
+			},
+			BillingCycleAnchor: stripe.Int64(billingCycleAnchor.Unix()),
+		})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create subscription for customer %s: %w", customerID, err)
+	}
+	return subscription, nil
+}
+
+// PreferredCurrency returns the upper-case currency code the customer chose to be billed in, defaulting to USD.
+func PreferredCurrency(customer *stripe.Customer) string {
+	currency := customer.Metadata[PreferredCurrencyMetadataKey]
+	if currency == "" {
+		return "USD"
+	}
+	return strings.ToUpper(currency)
+}
+
+// PriceIDForCurrency selects the usage-based price matching the customer's preferred currency, defaulting to USD.
+func PriceIDForCurrency(priceIDs map[string]string, customer *stripe.Customer) (string, error) {
+	currency := PreferredCurrency(customer)
+	priceID, ok := priceIDs[currency]
+	if !ok || priceID == "" {
+		return "", fmt.Errorf("no price configured for currency %s", currency)
+	}
+	return priceID, nil
+}
+
+// CreateCreditNoteForUsage credits `credits` on the customer's invoice line item which billed the usage at
+// `usageTime`. It returns ErrInvoiceNotFound if the usage has not been invoiced yet.
+func (c *Client) CreateCreditNoteForUsage(ctx context.Context, customerID string, usageTime time.Time, credits int64, memo string, idempotencyKey string) (*stripe.CreditNote, error) {
+	var invoices []*stripe.Invoice
+	err := c.call(ctx, "invoices.list", func() error {
+		invoices = nil
+		iter := c.sc.Invoices.List(&stripe.InvoiceListParams{
+			ListParams: stripe.ListParams{
+				Context: ctx,
+			},
+			Customer: stripe.String(customerID),
+		})
+		for iter.Next() {
+			invoices = append(invoices, iter.Invoice())
+		}
+		return iter.Err()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list invoices for customer %s: %w", customerID, err)
+	}
+
+	for _, invoice := range invoices {
+		if invoice.Status != stripe.InvoiceStatusOpen && invoice.Status != stripe.InvoiceStatusPaid {
+			continue
+		}
+
+		line := invoiceLineForTime(invoice, usageTime)
+		if line == nil {
+			continue
+		}
+
+		var creditNote *stripe.CreditNote
+		err := c.call(ctx, "credit_notes.create", func() (err error) {
+			creditNote, err = c.sc.CreditNotes.New(&stripe.CreditNoteParams{
+				Params: stripe.Params{
+					Context:        ctx,
+					IdempotencyKey: stripe.String(idempotencyKey),
+				},
+				Invoice: stripe.String(invoice.ID),
+				Lines: []*stripe.CreditNoteLineParams{
+					{
+						Type:            stripe.String(string(stripe.CreditNoteLineItemTypeInvoiceLineItem)),
+						InvoiceLineItem: stripe.String(line.ID),
+						Quantity:        stripe.Int64(credits),
+					},
+				},
+				Memo: stripe.String(memo),
+			})
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create credit note on invoice %s: %w", invoice.ID, err)
+		}
+		return creditNote, nil
+	}
+
+	return nil, ErrInvoiceNotFound
+}
+
+type CreditPurchaseParams struct {
+	CustomerID      string
+	PaymentMethodID string
+	// PurchaseID identifies the purchase, such that a retried purchase charges the customer at most once.
+	PurchaseID    string
+	AttributionID string
+	Credits       float64
+	// Amount is the price of the credits in the smallest unit of the currency.
+	Amount   int64
+	Currency string
+}
+
+// CreateCreditPurchase charges the payment method of the customer once. The purchased credits are recorded in the
+// metadata of the payment intent, and are granted when Stripe reports that the payment succeeded.
+func (c *Client) CreateCreditPurchase(ctx context.Context, params CreditPurchaseParams) (*stripe.PaymentIntent, error) {
+	var paymentIntent *stripe.PaymentIntent
+	err := c.call(ctx, "payment_intents.create", func() (err error) {
+		paymentIntent, err = c.sc.PaymentIntents.New(&stripe.PaymentIntentParams{
+			Params: stripe.Params{
+				Context:        ctx,
+				IdempotencyKey: stripe.String(creditPurchaseIdempotencyKey(params.CustomerID, params.PurchaseID)),
+				Metadata: map[string]string{
+					AttributionIDMetadataKey:    params.AttributionID,
+					PurchasedCreditsMetadataKey: strconv.FormatFloat(params.Credits, 'f', -1, 64),
+				},
+			},
+			Customer:      stripe.String(params.CustomerID),
+			PaymentMethod: stripe.String(params.PaymentMethodID),
+			Amount:        stripe.Int64(params.Amount),
+			Currency:      stripe.String(strings.ToLower(params.Currency)),
+			Description:   stripe.String(fmt.Sprintf("Purchase of %v credits", params.Credits)),
+			Confirm:       stripe.Bool(true),
+			OffSession:    stripe.Bool(true),
+		})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create payment intent for customer %s: %w", params.CustomerID, err)
+	}
+	return paymentIntent, nil
+}
+
+// invoiceLineForTime finds the line item of the invoice which billed the period containing t.
+func invoiceLineForTime(invoice *stripe.Invoice, t time.Time) *stripe.InvoiceLine {
+	if invoice.Lines == nil {
+		return nil
+	}
+	for _, line := range invoice.Lines.Data {
+		if line.Period == nil {
+			continue
+		}
+		if line.Period.Start <= t.Unix() && t.Unix() < line.Period.End {
+			return line
+		}
+	}
+	return nil
+}
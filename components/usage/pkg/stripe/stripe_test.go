@@ -7,8 +7,10 @@ package stripe
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
+	"github.com/stripe/stripe-go/v72"
 )
 
 func TestCustomerQueriesForTeamIds_SingleQuery(t *testing.T) {
@@ -83,3 +85,106 @@ func TestCustomerQueriesForTeamIds_MultipleQueries(t *testing.T) {
 		})
 	}
 }
+
+func TestPriceIDForCurrency(t *testing.T) {
+	priceIDs := map[string]string{"EUR": "price_eur", "USD": "price_usd"}
+
+	priceID, err := PriceIDForCurrency(priceIDs, &stripe.Customer{Metadata: map[string]string{PreferredCurrencyMetadataKey: "eur"}})
+	require.NoError(t, err)
+	require.Equal(t, "price_eur", priceID)
+
+	priceID, err = PriceIDForCurrency(priceIDs, &stripe.Customer{})
+	require.NoError(t, err)
+	require.Equal(t, "price_usd", priceID, "must default to USD")
+
+	_, err = PriceIDForCurrency(priceIDs, &stripe.Customer{Metadata: map[string]string{PreferredCurrencyMetadataKey: "GBP"}})
+	require.Error(t, err)
+}
+
+func TestInvoiceLineForTime(t *testing.T) {
+	september := time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC)
+	october := september.AddDate(0, 1, 0)
+	invoice := &stripe.Invoice{
+		Lines: &stripe.InvoiceLineList{
+			Data: []*stripe.InvoiceLine{
+				{ID: "il_no_period"},
+				{ID: "il_september", Period: &stripe.Period{Start: september.Unix(), End: october.Unix()}},
+			},
+		},
+	}
+
+	require.Equal(t, "il_september", invoiceLineForTime(invoice, september).ID)
+	require.Equal(t, "il_september", invoiceLineForTime(invoice, october.Add(-time.Second)).ID)
+	require.Nil(t, invoiceLineForTime(invoice, october), "period end is exclusive")
+	require.Nil(t, invoiceLineForTime(&stripe.Invoice{}, september))
+}
+
+func TestConvertInvoice(t *testing.T) {
+	september := time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC)
+	october := september.AddDate(0, 1, 0)
+
+	invoice := convertInvoice(&stripe.Invoice{
+		ID:                 "in_123",
+		AmountRemaining:    4800,
+		Currency:           stripe.CurrencyEUR,
+		NextPaymentAttempt: october.Add(time.Hour).Unix(),
+		Subscription:       &stripe.Subscription{ID: "sub_123"},
+		Lines: &stripe.InvoiceLineList{
+			Data: []*stripe.InvoiceLine{
+				{
+					Description: "480 credits",
+					Quantity:    480,
+					Amount:      4800,
+					Period:      &stripe.Period{Start: september.Unix(), End: october.Unix()},
+				},
+			},
+		},
+	})
+
+	require.Equal(t, &Invoice{
+		ID:             "in_123",
+		SubscriptionID: "sub_123",
+		Amount:         4800,
+		Currency:       "eur",
+		Credits:        480,
+		LineItems: []InvoiceLineItem{
+			{Description: "480 credits", Quantity: 480, Amount: 4800},
+		},
+		DueDate:     time.Unix(october.Add(time.Hour).Unix(), 0),
+		PeriodStart: time.Unix(september.Unix(), 0),
+		PeriodEnd:   time.Unix(october.Unix(), 0),
+	}, invoice)
+}
+
+func TestSummaryContains(t *testing.T) {
+	september := time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC)
+	october := september.AddDate(0, 1, 0)
+	closed := &stripe.UsageRecordSummary{Period: &stripe.Period{Start: september.Unix(), End: october.Unix()}}
+	current := &stripe.UsageRecordSummary{Period: &stripe.Period{Start: october.Unix()}}
+
+	require.True(t, summaryContains(closed, september.Unix()))
+	require.False(t, summaryContains(closed, october.Unix()), "period end is exclusive")
+	require.True(t, summaryContains(current, october.AddDate(0, 0, 10).Unix()), "current period has no end yet")
+	require.False(t, summaryContains(current, september.Unix()))
+	require.False(t, summaryContains(&stripe.UsageRecordSummary{}, september.Unix()))
+}
+
+func TestUsageRecordTimestamp(t *testing.T) {
+	september := time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC)
+	october := september.AddDate(0, 1, 0)
+	createdMidSeptember := september.AddDate(0, 0, 14)
+
+	timestamp, err := usageRecordTimestamp(&stripe.Subscription{StartDate: september.AddDate(0, -3, 0).Unix(), CurrentPeriodStart: september.Unix()}, september)
+	require.NoError(t, err)
+	require.Equal(t, september.Unix(), timestamp)
+
+	timestamp, err = usageRecordTimestamp(&stripe.Subscription{StartDate: createdMidSeptember.Unix(), CurrentPeriodStart: createdMidSeptember.Unix()}, september)
+	require.NoError(t, err)
+	require.Equal(t, createdMidSeptember.Unix(), timestamp, "must not set usage before the first period of the subscription")
+
+	_, err = usageRecordTimestamp(&stripe.Subscription{StartDate: september.AddDate(0, -3, 0).Unix(), CurrentPeriodStart: october.Unix()}, september)
+	require.ErrorIs(t, err, errBillingPeriodEnded, "must not set usage of an ended period in the current period")
+
+	_, err = usageRecordTimestamp(&stripe.Subscription{StartDate: createdMidSeptember.Unix(), CurrentPeriodStart: october.Unix()}, september)
+	require.ErrorIs(t, err, errBillingPeriodEnded)
+}
@@ -0,0 +1,42 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package stripe
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/stripe/stripe-go/v72"
+)
+
+// TaxRates maps ISO 3166-1 alpha-2 country codes to the tax rate in percent, e.g. {"DE": 19}.
+type TaxRates map[string]float64
+
+func (r TaxRates) Validate() error {
+	for country, rate := range r {
+		if len(country) != 2 {
+			return fmt.Errorf("invalid country code %q, expected ISO 3166-1 alpha-2", country)
+		}
+		if rate < 0 || rate > 100 {
+			return fmt.Errorf("invalid tax rate %v for %s, expected percent between 0 and 100", rate, country)
+		}
+	}
+	return nil
+}
+
+// ForCustomer returns the tax rate in percent for the country of the customer's billing address.
+// Customers without a billing address, or in countries without a configured rate, are not taxed.
+func (r TaxRates) ForCustomer(customer *stripe.Customer) float64 {
+	if customer == nil {
+		return 0
+	}
+	return r[strings.ToUpper(customer.Address.Country)]
+}
+
+// Tax returns the tax on `amount`, in the smallest unit of the currency and rounded half up.
+func Tax(amount int64, ratePercent float64) int64 {
+	return int64(math.Round(float64(amount) * ratePercent / 100))
+}
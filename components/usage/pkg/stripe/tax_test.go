@@ -0,0 +1,33 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package stripe
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stripe/stripe-go/v72"
+)
+
+func TestTaxRates_ForCustomer(t *testing.T) {
+	rates := TaxRates{"DE": 19, "GB": 20}
+
+	require.Equal(t, float64(19), rates.ForCustomer(&stripe.Customer{Address: stripe.Address{Country: "DE"}}))
+	require.Equal(t, float64(20), rates.ForCustomer(&stripe.Customer{Address: stripe.Address{Country: "gb"}}))
+	require.Equal(t, float64(0), rates.ForCustomer(&stripe.Customer{Address: stripe.Address{Country: "US"}}), "countries without a rate are not taxed")
+	require.Equal(t, float64(0), rates.ForCustomer(&stripe.Customer{}), "customers without an address are not taxed")
+}
+
+func TestTaxRates_Validate(t *testing.T) {
+	require.NoError(t, TaxRates{"DE": 19}.Validate())
+	require.Error(t, TaxRates{"DEU": 19}.Validate())
+	require.Error(t, TaxRates{"DE": 119}.Validate())
+}
+
+func TestTax(t *testing.T) {
+	require.Equal(t, int64(1900), Tax(10000, 19))
+	require.Equal(t, int64(2), Tax(9, 19), "must round half up to the smallest unit")
+	require.Equal(t, int64(0), Tax(10000, 0))
+}
@@ -0,0 +1,54 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package stripe
+
+import (
+	"sync"
+	"time"
+)
+
+type pendingUsageKey struct {
+	teamID      string
+	periodStart time.Time
+}
+
+// usageQueue holds usage which could not be set in Stripe because Stripe was unavailable, such that it is set on the
+// next sync. Queued usage of a billing period which ended in Stripe in the meantime is dropped when it is set, see
+// usageRecordTimestamp.
+type usageQueue struct {
+	mu      sync.Mutex
+	pending map[pendingUsageKey]int64
+}
+
+// add queues the credits of each team. Usage is set rather than incremented, so later usage replaces queued usage.
+func (q *usageQueue) add(creditsPerTeam map[string]int64, periodStart time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.pending == nil {
+		q.pending = map[pendingUsageKey]int64{}
+	}
+	for teamID, credits := range creditsPerTeam {
+		q.pending[pendingUsageKey{teamID: teamID, periodStart: periodStart.UTC()}] = credits
+	}
+	reportStripePendingUsageSyncs(len(q.pending))
+}
+
+// drain removes all queued usage, grouped by the start of the billing period.
+func (q *usageQueue) drain() map[time.Time]map[string]int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	result := map[time.Time]map[string]int64{}
+	for key, credits := range q.pending {
+		if result[key.periodStart] == nil {
+			result[key.periodStart] = map[string]int64{}
+		}
+		result[key.periodStart][key.teamID] = credits
+	}
+	q.pending = nil
+	reportStripePendingUsageSyncs(0)
+	return result
+}
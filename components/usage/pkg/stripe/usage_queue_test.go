@@ -0,0 +1,28 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package stripe
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsageQueue(t *testing.T) {
+	august := time.Date(2022, 8, 1, 0, 0, 0, 0, time.UTC)
+	september := time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC)
+
+	q := &usageQueue{}
+	q.add(map[string]int64{"team-a": 10, "team-b": 20}, august)
+	q.add(map[string]int64{"team-a": 15}, august)
+	q.add(map[string]int64{"team-a": 5}, september)
+
+	require.Equal(t, map[time.Time]map[string]int64{
+		august:    {"team-a": 15, "team-b": 20},
+		september: {"team-a": 5},
+	}, q.drain(), "later usage must replace queued usage")
+	require.Empty(t, q.drain())
+}
@@ -0,0 +1,515 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gitpod-io/gitpod/common-go/log"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/notifier"
+	"github.com/gitpod-io/gitpod/usage/pkg/stripe"
+	"github.com/google/uuid"
+	stripesdk "github.com/stripe/stripe-go/v72"
+	"github.com/stripe/stripe-go/v72/webhook"
+	"gorm.io/gorm"
+)
+
+const (
+	maxBodyBytes = int64(65536)
+
+	invoiceFinalizedEventType     = "invoice.finalized"
+	invoicePaymentFailedEventType = "invoice.payment_failed"
+	invoicePaidEventType          = "invoice.paid"
+	disputeCreatedEventType       = "charge.dispute.created"
+	paymentSucceededEventType     = "payment_intent.succeeded"
+
+	// processedEventTTL is how long processed events are remembered to reject redeliveries. Stripe retries
+	// deliveries for up to three days.
+	processedEventTTL = 30 * 24 * time.Hour
+)
+
+// disputeUsageNamespace is used to derive the ID of the ledger annotation from the Stripe dispute ID.
+var disputeUsageNamespace = uuid.MustParse("5d2c7b9e-1f3a-4e6d-8b0c-9a4f2e7d1c63")
+
+type CustomerGetter interface {
+	GetCustomer(ctx context.Context, customerID string) (*stripesdk.Customer, error)
+}
+
+type ChargeGetter interface {
+	GetCharge(ctx context.Context, chargeID string) (*stripesdk.Charge, error)
+}
+
+type StripeClient interface {
+	CustomerGetter
+	ChargeGetter
+}
+
+// DisputeNotifier is informed whenever a cost center is flagged because of a disputed payment.
+type DisputeNotifier interface {
+	NotifyCostCenterDisputed(ctx context.Context, dispute notifier.Dispute) error
+}
+
+// UsageEventPublisher publishes events for invoices which were credited in the ledger.
+type UsageEventPublisher interface {
+	PublishUsageEvents(ctx context.Context, events ...notifier.UsageEvent) error
+}
+
+type stripeWebhookHandler struct {
+	conn            *gorm.DB
+	stripeClient    StripeClient
+	webhookSecret   string
+	disputeNotifier DisputeNotifier
+	events          UsageEventPublisher
+}
+
+// NewStripeWebhookHandler creates a handler for Stripe webhook events. When disputeNotifier is nil, disputed cost
+// centers are only flagged in the database. When events is nil, no usage events are published.
+func NewStripeWebhookHandler(conn *gorm.DB, stripeClient StripeClient, webhookSecret string, disputeNotifier DisputeNotifier, events UsageEventPublisher) *stripeWebhookHandler {
+	return &stripeWebhookHandler{
+		conn:            conn,
+		stripeClient:    stripeClient,
+		webhookSecret:   webhookSecret,
+		disputeNotifier: disputeNotifier,
+		events:          events,
+	}
+}
+
+func (h *stripeWebhookHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		log.Errorf("Bad HTTP method: %s", req.Method)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	stripeSignature := req.Header.Get("Stripe-Signature")
+	if stripeSignature == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	req.Body = http.MaxBytesReader(w, req.Body, maxBodyBytes)
+
+	payload, err := io.ReadAll(req.Body)
+	if err != nil {
+		log.WithError(err).Error("Failed to read payload body.")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// https://stripe.com/docs/webhooks/signatures#verify-official-libraries
+	event, err := webhook.ConstructEvent(payload, stripeSignature, h.webhookSecret)
+	if err != nil {
+		log.WithError(err).Error("Failed to verify webhook signature.")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if event.ID == "" {
+		log.Error("Stripe event has no ID.")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	switch event.Type {
+	case invoiceFinalizedEventType:
+		h.handleInvoiceFinalized(req.Context(), w, event)
+	case invoicePaymentFailedEventType:
+		h.handleInvoicePaymentFailed(req.Context(), w, event)
+	case invoicePaidEventType:
+		h.handleInvoicePaid(req.Context(), w, event)
+	case disputeCreatedEventType:
+		h.handleDisputeCreated(req.Context(), w, event)
+	case paymentSucceededEventType:
+		h.handlePaymentSucceeded(req.Context(), w, event)
+	default:
+		log.Errorf("Unexpected Stripe event type: %s", event.Type)
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func (h *stripeWebhookHandler) handleInvoiceFinalized(ctx context.Context, w http.ResponseWriter, event stripesdk.Event) {
+	invoice, err := parseInvoice(event)
+	if err != nil {
+		log.WithError(err).Error("Failed to parse invoice from Stripe event payload.")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	logger := log.WithField("event_id", event.ID).WithField("invoice_id", invoice.ID)
+
+	usage, err := h.usageForInvoice(ctx, invoice)
+	if err != nil {
+		logger.WithError(err).Error("Failed to construct usage entry for invoice.")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	processed, err := h.processOnce(ctx, event, func(tx *gorm.DB) error {
+		return db.InsertUsage(ctx, tx, usage)
+	})
+	if err != nil {
+		logger.WithError(err).Error("Failed to credit finalized invoice.")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if processed {
+		// Acknowledge the redelivery, such that Stripe stops retrying it.
+		logger.Info("Ignoring Stripe event which was already processed.")
+		return
+	}
+
+	logger.WithField("attribution_id", usage.AttributionID).
+		WithField("credit_cents", usage.CreditCents).
+		Info("Credited finalized invoice to cost center.")
+
+	if h.events == nil {
+		return
+	}
+	// The invoice is already credited at this point, so publishing failures are only logged.
+	err = h.events.PublishUsageEvents(ctx, notifier.NewUsageEvent(notifier.UsageInvoiceRecordedEvent, usage))
+	if err != nil {
+		logger.WithError(err).Error("Failed to publish usage event of finalized invoice.")
+	}
+}
+
+// handleInvoicePaymentFailed starts dunning of the cost center the invoice belongs to, unless it is already in dunning.
+func (h *stripeWebhookHandler) handleInvoicePaymentFailed(ctx context.Context, w http.ResponseWriter, event stripesdk.Event) {
+	invoice, err := parseInvoice(event)
+	if err != nil {
+		log.WithError(err).Error("Failed to parse invoice from Stripe event payload.")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	logger := log.WithField("event_id", event.ID).WithField("invoice_id", invoice.ID)
+
+	attributionID, err := h.attributionIDForInvoice(ctx, invoice)
+	if err != nil {
+		logger.WithError(err).Error("Failed to get attribution ID of invoice with failed payment.")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var costCenter *db.CostCenter
+	processed, err := h.processOnce(ctx, event, func(tx *gorm.DB) error {
+		costCenter, err = db.SetPaymentFailed(ctx, tx, attributionID, time.Unix(event.Created, 0))
+		if err != nil {
+			return fmt.Errorf("failed to record failed payment: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		logger.WithError(err).Error("Failed to record failed invoice payment.")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if processed {
+		logger.Info("Ignoring Stripe event which was already processed.")
+		return
+	}
+
+	logger.WithField("attribution_id", costCenter.ID).
+		WithField("payment_failed_at", costCenter.PaymentFailedAt).
+		Info("Recorded failed invoice payment of cost center.")
+}
+
+// handleInvoicePaid ends dunning of the cost center the invoice belongs to.
+func (h *stripeWebhookHandler) handleInvoicePaid(ctx context.Context, w http.ResponseWriter, event stripesdk.Event) {
+	invoice, err := parseInvoice(event)
+	if err != nil {
+		log.WithError(err).Error("Failed to parse invoice from Stripe event payload.")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	logger := log.WithField("event_id", event.ID).WithField("invoice_id", invoice.ID)
+
+	attributionID, err := h.attributionIDForInvoice(ctx, invoice)
+	if err != nil {
+		logger.WithError(err).Error("Failed to get attribution ID of paid invoice.")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var costCenter *db.CostCenter
+	processed, err := h.processOnce(ctx, event, func(tx *gorm.DB) error {
+		costCenter, err = db.ClearPaymentFailed(ctx, tx, attributionID)
+		if err != nil {
+			return fmt.Errorf("failed to clear failed payment: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		logger.WithError(err).Error("Failed to record paid invoice.")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if processed {
+		logger.Info("Ignoring Stripe event which was already processed.")
+		return
+	}
+
+	logger.WithField("attribution_id", costCenter.ID).Info("Recorded paid invoice of cost center.")
+}
+
+func (h *stripeWebhookHandler) handleDisputeCreated(ctx context.Context, w http.ResponseWriter, event stripesdk.Event) {
+	var dispute stripesdk.Dispute
+	err := json.Unmarshal(event.Data.Raw, &dispute)
+	if err != nil || dispute.ID == "" || dispute.Charge == nil || dispute.Charge.ID == "" {
+		log.WithError(err).Error("Failed to parse dispute from Stripe event payload.")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	logger := log.WithField("event_id", event.ID).WithField("dispute_id", dispute.ID)
+
+	annotation, err := h.usageForDispute(ctx, &dispute)
+	if err != nil {
+		logger.WithError(err).Error("Failed to construct ledger annotation for dispute.")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	processed, err := h.processOnce(ctx, event, func(tx *gorm.DB) error {
+		_, err := db.SetCostCenterState(ctx, tx, annotation.AttributionID, db.CostCenterState_Disputed)
+		if err != nil {
+			return fmt.Errorf("failed to flag cost center as disputed: %w", err)
+		}
+
+		return db.InsertUsage(ctx, tx, annotation)
+	})
+	if err != nil {
+		logger.WithError(err).Error("Failed to flag cost center of disputed charge.")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if processed {
+		logger.Info("Ignoring Stripe event which was already processed.")
+		return
+	}
+
+	logger = logger.WithField("attribution_id", annotation.AttributionID)
+	logger.Info("Flagged cost center of disputed charge.")
+
+	if h.disputeNotifier == nil {
+		return
+	}
+	// The cost center is already flagged at this point, so delivery failures are only logged.
+	err = h.disputeNotifier.NotifyCostCenterDisputed(ctx, notifier.Dispute{
+		AttributionID: string(annotation.AttributionID),
+		DisputeID:     dispute.ID,
+		ChargeID:      dispute.Charge.ID,
+		Reason:        string(dispute.Reason),
+		Amount:        dispute.Amount,
+		Currency:      string(dispute.Currency),
+		CreatedAt:     annotation.EffectiveTime.Time(),
+	})
+	if err != nil {
+		logger.WithError(err).Error("Failed to notify about disputed cost center.")
+	}
+}
+
+// handlePaymentSucceeded grants the credits of a credit purchase once its payment succeeded. Payments of invoices are
+// ignored, they are recorded when the invoice is finalized.
+func (h *stripeWebhookHandler) handlePaymentSucceeded(ctx context.Context, w http.ResponseWriter, event stripesdk.Event) {
+	var paymentIntent stripesdk.PaymentIntent
+	err := json.Unmarshal(event.Data.Raw, &paymentIntent)
+	if err != nil || paymentIntent.ID == "" {
+		log.WithError(err).Error("Failed to parse payment intent from Stripe event payload.")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	logger := log.WithField("event_id", event.ID).WithField("payment_intent_id", paymentIntent.ID)
+
+	if _, ok := paymentIntent.Metadata[stripe.PurchasedCreditsMetadataKey]; !ok {
+		logger.Debug("Ignoring payment which is not a credit purchase.")
+		return
+	}
+	grant, err := creditGrantForPurchase(&paymentIntent, time.Unix(event.Created, 0).UTC())
+	if err != nil {
+		logger.WithError(err).Error("Failed to construct credit grant for purchase.")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	processed, err := h.processOnce(ctx, event, func(tx *gorm.DB) error {
+		return db.InsertUsage(ctx, tx, grant.Usage)
+	})
+	if err != nil {
+		logger.WithError(err).Error("Failed to grant purchased credits.")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if processed {
+		logger.Info("Ignoring Stripe event which was already processed.")
+		return
+	}
+
+	logger.
+		WithField("attribution_id", grant.AttributionID).
+		WithField("credits", grant.Credits().ToCredits()).
+		Info("Granted purchased credits.")
+}
+
+func creditGrantForPurchase(paymentIntent *stripesdk.PaymentIntent, paidAt time.Time) (db.CreditGrant, error) {
+	attributionID, err := db.ParseAttributionID(paymentIntent.Metadata[stripe.AttributionIDMetadataKey])
+	if err != nil {
+		return db.CreditGrant{}, fmt.Errorf("invalid attribution ID in payment intent metadata: %w", err)
+	}
+	credits, err := strconv.ParseFloat(paymentIntent.Metadata[stripe.PurchasedCreditsMetadataKey], 64)
+	if err != nil || credits <= 0 {
+		return db.CreditGrant{}, fmt.Errorf("invalid purchased credits %q in payment intent metadata", paymentIntent.Metadata[stripe.PurchasedCreditsMetadataKey])
+	}
+	return db.NewPurchasedCreditGrant(attributionID, credits, paymentIntent.ID, paidAt)
+}
+
+// processOnce runs fn in a transaction, unless the event was already processed. The event is recorded in the same
+// transaction, such that it is only considered processed once fn succeeded. fn must only do database work, anything
+// which talks to Stripe has to happen before, so that no locks are held across network round-trips.
+func (h *stripeWebhookHandler) processOnce(ctx context.Context, event stripesdk.Event, fn func(tx *gorm.DB) error) (processed bool, err error) {
+	now := time.Now()
+	err = h.conn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		recorded, err := db.RecordStripeWebhookEvent(ctx, tx, db.StripeWebhookEvent{
+			EventID:     event.ID,
+			EventType:   event.Type,
+			ProcessedAt: db.NewVarcharTime(now),
+			ExpiresAt:   db.NewVarcharTime(now.Add(processedEventTTL)),
+		})
+		if err != nil {
+			return err
+		}
+		if !recorded {
+			processed = true
+			return nil
+		}
+
+		return fn(tx)
+	})
+	if err != nil || processed {
+		return processed, err
+	}
+
+	deleted, err := db.DeleteExpiredStripeWebhookEvents(ctx, h.conn, now)
+	if err != nil {
+		log.WithError(err).Warn("Failed to delete expired Stripe webhook events.")
+	} else if deleted > 0 {
+		log.WithField("deleted", deleted).Debug("Deleted expired Stripe webhook events.")
+	}
+	return false, nil
+}
+
+func parseInvoice(event stripesdk.Event) (*stripesdk.Invoice, error) {
+	var invoice stripesdk.Invoice
+	err := json.Unmarshal(event.Data.Raw, &invoice)
+	if err != nil {
+		return nil, err
+	}
+	if invoice.ID == "" {
+		return nil, fmt.Errorf("event %s has no invoice ID", event.ID)
+	}
+	return &invoice, nil
+}
+
+// attributionIDForInvoice returns the attribution ID of the customer the invoice belongs to.
+func (h *stripeWebhookHandler) attributionIDForInvoice(ctx context.Context, invoice *stripesdk.Invoice) (db.AttributionID, error) {
+	if invoice.Customer == nil || invoice.Customer.ID == "" {
+		return "", fmt.Errorf("invoice %s has no customer", invoice.ID)
+	}
+
+	attributionID, err := h.attributionIDForCustomer(ctx, invoice.Customer.ID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get attribution ID for invoice %s: %w", invoice.ID, err)
+	}
+	return attributionID, nil
+}
+
+// attributionIDForCustomer returns the attribution ID which the Stripe customer was created for.
+func (h *stripeWebhookHandler) attributionIDForCustomer(ctx context.Context, customerID string) (db.AttributionID, error) {
+	customer, err := h.stripeClient.GetCustomer(ctx, customerID)
+	if err != nil {
+		return "", err
+	}
+
+	if teamID, ok := customer.Metadata[stripe.TeamIDMetadataKey]; ok {
+		return db.NewTeamAttributionID(teamID), nil
+	}
+	if userID, ok := customer.Metadata[stripe.UserIDMetadataKey]; ok {
+		return db.NewUserAttributionID(userID), nil
+	}
+	return "", fmt.Errorf("customer %s has neither team nor user metadata", customer.ID)
+}
+
+// usageForDispute constructs the ledger annotation which records the dispute against the cost center of the customer
+// the disputed charge belongs to. The annotation does not change the balance.
+func (h *stripeWebhookHandler) usageForDispute(ctx context.Context, dispute *stripesdk.Dispute) (db.Usage, error) {
+	charge, err := h.stripeClient.GetCharge(ctx, dispute.Charge.ID)
+	if err != nil {
+		return db.Usage{}, fmt.Errorf("failed to get disputed charge: %w", err)
+	}
+	if charge.Customer == nil || charge.Customer.ID == "" {
+		return db.Usage{}, fmt.Errorf("charge %s has no customer", charge.ID)
+	}
+
+	attributionID, err := h.attributionIDForCustomer(ctx, charge.Customer.ID)
+	if err != nil {
+		return db.Usage{}, fmt.Errorf("failed to get attribution ID for dispute %s: %w", dispute.ID, err)
+	}
+
+	// The effective time is part of the primary key of usage, hence redeliveries of the dispute must derive the same.
+	if dispute.Created == 0 {
+		return db.Usage{}, fmt.Errorf("dispute %s has no creation time", dispute.ID)
+	}
+
+	usage := db.Usage{
+		ID:            uuid.NewSHA1(disputeUsageNamespace, []byte(dispute.ID)),
+		AttributionID: attributionID,
+		Description:   fmt.Sprintf("Dispute %s of charge %s", dispute.ID, charge.ID),
+		EffectiveTime: db.NewVarcharTime(time.Unix(dispute.Created, 0)),
+		Kind:          db.DisputeUsageKind,
+	}
+	err = usage.SetMetadataWithDispute(db.DisputeUsageData{
+		DisputeID: dispute.ID,
+		ChargeID:  charge.ID,
+		Reason:    string(dispute.Reason),
+		Amount:    dispute.Amount,
+		Currency:  string(dispute.Currency),
+	})
+	if err != nil {
+		return db.Usage{}, err
+	}
+
+	return usage, nil
+}
+
+// usageForInvoice constructs the usage entry which credits the invoiced credits against the cost center of the
+// customer the invoice belongs to.
+func (h *stripeWebhookHandler) usageForInvoice(ctx context.Context, invoice *stripesdk.Invoice) (db.Usage, error) {
+	attributionID, err := h.attributionIDForInvoice(ctx, invoice)
+	if err != nil {
+		return db.Usage{}, err
+	}
+
+	// The effective time is part of the primary key of usage, hence redeliveries of the invoice must derive the same.
+	var effectiveTime time.Time
+	switch {
+	case invoice.StatusTransitions.FinalizedAt != 0:
+		effectiveTime = time.Unix(invoice.StatusTransitions.FinalizedAt, 0)
+	case invoice.Created != 0:
+		effectiveTime = time.Unix(invoice.Created, 0)
+	default:
+		return db.Usage{}, fmt.Errorf("invoice %s has neither a finalization nor a creation time", invoice.ID)
+	}
+
+	return db.NewInvoiceUsage(invoice.ID, attributionID, stripe.InvoiceCredits(invoice), effectiveTime,
+		time.Unix(invoice.PeriodStart, 0), time.Unix(invoice.PeriodEnd, 0))
+}
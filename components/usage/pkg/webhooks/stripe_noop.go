@@ -0,0 +1,22 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package webhooks
+
+import (
+	"net/http"
+
+	"github.com/gitpod-io/gitpod/common-go/log"
+)
+
+func NewNoopWebhookHandler() *noopWebhookHandler {
+	return &noopWebhookHandler{}
+}
+
+type noopWebhookHandler struct{}
+
+func (h *noopWebhookHandler) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	log.Info("Received Stripe webhook, but running in no-op mode so will not be handling it.")
+	w.WriteHeader(http.StatusNotImplemented)
+}
@@ -0,0 +1,396 @@
+// Copyright (c) 2022 Gitpod GmbH. All rights reserved.
+// Licensed under the GNU Affero General Public License (AGPL).
+// See License-AGPL.txt in the project root for license information.
+
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gitpod-io/gitpod/common-go/baseserver"
+	"github.com/gitpod-io/gitpod/usage/pkg/db"
+	"github.com/gitpod-io/gitpod/usage/pkg/db/dbtest"
+	"github.com/gitpod-io/gitpod/usage/pkg/notifier"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	stripesdk "github.com/stripe/stripe-go/v72"
+	"github.com/stripe/stripe-go/v72/webhook"
+	"gorm.io/gorm"
+)
+
+const (
+	testWebhookSecret = "whsec_random_secret"
+)
+
+type fakeStripe struct {
+	customers map[string]*stripesdk.Customer
+	charges   map[string]*stripesdk.Charge
+}
+
+func (f fakeStripe) GetCustomer(_ context.Context, customerID string) (*stripesdk.Customer, error) {
+	customer, ok := f.customers[customerID]
+	if !ok {
+		return nil, fmt.Errorf("customer %s not found", customerID)
+	}
+	return customer, nil
+}
+
+func (f fakeStripe) GetCharge(_ context.Context, chargeID string) (*stripesdk.Charge, error) {
+	charge, ok := f.charges[chargeID]
+	if !ok {
+		return nil, fmt.Errorf("charge %s not found", chargeID)
+	}
+	return charge, nil
+}
+
+type fakeDisputeNotifier struct {
+	disputes []notifier.Dispute
+}
+
+func (f *fakeDisputeNotifier) NotifyCostCenterDisputed(_ context.Context, dispute notifier.Dispute) error {
+	f.disputes = append(f.disputes, dispute)
+	return nil
+}
+
+func TestWebhookRejectsInvalidRequests(t *testing.T) {
+	url := webhookURL(t, nil, fakeStripe{}, nil)
+	payload := []byte(`{"type": "invoice.finalized", "data": {"object": {"id": "in_123"}}}`)
+
+	scenarios := []struct {
+		Name               string
+		HttpMethod         string
+		Signature          string
+		ExpectedStatusCode int
+	}{
+		{
+			Name:               "GET is not allowed",
+			HttpMethod:         http.MethodGet,
+			Signature:          generateHeader(payload, testWebhookSecret),
+			ExpectedStatusCode: http.StatusMethodNotAllowed,
+		},
+		{
+			Name:               "missing signature",
+			HttpMethod:         http.MethodPost,
+			ExpectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			Name:               "signed with a different secret",
+			HttpMethod:         http.MethodPost,
+			Signature:          generateHeader(payload, "whsec_other_secret"),
+			ExpectedStatusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.Name, func(t *testing.T) {
+			resp := sendEvent(t, url, s.HttpMethod, payload, s.Signature)
+			require.Equal(t, s.ExpectedStatusCode, resp.StatusCode)
+		})
+	}
+}
+
+func TestWebhookIgnoresIrrelevantEvents(t *testing.T) {
+	url := webhookURL(t, nil, fakeStripe{}, nil)
+	payload := []byte(`{"type": "invoice.updated", "data": {"object": {"id": "in_123"}}}`)
+
+	resp := sendEvent(t, url, http.MethodPost, payload, generateHeader(payload, testWebhookSecret))
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestWebhookCreditsFinalizedInvoice(t *testing.T) {
+	conn := dbtest.ConnectForTests(t)
+	teamID := uuid.New().String()
+	invoiceID := fmt.Sprintf("in_%s", uuid.New().String())
+	eventID := fmt.Sprintf("evt_%s", uuid.New().String())
+
+	url := webhookURL(t, conn, fakeStripe{customers: map[string]*stripesdk.Customer{
+		"cus_123": {ID: "cus_123", Metadata: map[string]string{"teamId": teamID}},
+	}}, nil)
+	payload := []byte(fmt.Sprintf(`
+{
+  "id": %q,
+  "type": "invoice.finalized",
+  "data": {
+    "object": {
+      "id": %q,
+      "customer": "cus_123",
+      "period_start": 1661990400,
+      "period_end": 1664582400,
+      "status_transitions": {"finalized_at": 1664586000},
+      "lines": {"data": [{"quantity": 480}]}
+    }
+  }
+}
+`, eventID, invoiceID))
+	t.Cleanup(func() {
+		require.NoError(t, conn.Where("eventId = ?", eventID).Delete(&db.StripeWebhookEvent{}).Error)
+	})
+
+	// Stripe retries deliveries, which must not credit the invoice twice.
+	for i := 0; i < 2; i++ {
+		resp := sendEvent(t, url, http.MethodPost, payload, generateHeader(payload, testWebhookSecret))
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	usage, err := db.FindUsage(context.Background(), conn, &db.FindUsageParams{
+		AttributionId: db.NewTeamAttributionID(teamID),
+		From:          time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC),
+		To:            time.Date(2022, 11, 1, 0, 0, 0, 0, time.UTC),
+	})
+	require.NoError(t, err)
+	require.Len(t, usage, 1)
+	t.Cleanup(func() {
+		require.NoError(t, conn.Where("id = ?", usage[0].ID.String()).Delete(&db.Usage{}).Error)
+	})
+
+	require.Equal(t, db.InvoiceUsageKind, usage[0].Kind)
+	require.Equal(t, db.CreditCents(-48000), usage[0].CreditCents)
+	require.Equal(t, time.Unix(1664586000, 0).UTC(), usage[0].EffectiveTime.Time())
+	require.JSONEq(t, fmt.Sprintf(`{"invoiceId": %q, "startDate": "2022-09-01T00:00:00.000Z", "endDate": "2022-10-01T00:00:00.000Z"}`, invoiceID), string(usage[0].Metadata))
+}
+
+func TestWebhookRejectsReplayedEvents(t *testing.T) {
+	conn := dbtest.ConnectForTests(t)
+	teamID := uuid.New().String()
+	eventID := fmt.Sprintf("evt_%s", uuid.New().String())
+	t.Cleanup(func() {
+		require.NoError(t, conn.Where("eventId = ?", eventID).Delete(&db.StripeWebhookEvent{}).Error)
+		require.NoError(t, conn.Where("attributionId = ?", db.NewTeamAttributionID(teamID)).Delete(&db.Usage{}).Error)
+	})
+
+	url := webhookURL(t, conn, fakeStripe{customers: map[string]*stripesdk.Customer{
+		"cus_123": {ID: "cus_123", Metadata: map[string]string{"teamId": teamID}},
+	}}, nil)
+
+	// A replayed event carries a fresh signature, but the ID of the event which was already processed.
+	for _, invoiceID := range []string{"in_first", "in_replayed"} {
+		payload := []byte(fmt.Sprintf(`
+{
+  "id": %q,
+  "type": "invoice.finalized",
+  "data": {
+    "object": {
+      "id": %q,
+      "customer": "cus_123",
+      "period_start": 1661990400,
+      "period_end": 1664582400,
+      "status_transitions": {"finalized_at": 1664586000},
+      "lines": {"data": [{"quantity": 480}]}
+    }
+  }
+}
+`, eventID, invoiceID))
+		resp := sendEvent(t, url, http.MethodPost, payload, generateHeader(payload, testWebhookSecret))
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	usage, err := db.FindUsage(context.Background(), conn, &db.FindUsageParams{
+		AttributionId: db.NewTeamAttributionID(teamID),
+		From:          time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC),
+		To:            time.Date(2022, 11, 1, 0, 0, 0, 0, time.UTC),
+	})
+	require.NoError(t, err)
+	require.Len(t, usage, 1)
+	require.Equal(t, "Invoice in_first", usage[0].Description)
+}
+
+func TestWebhookFlagsDisputedCostCenter(t *testing.T) {
+	conn := dbtest.ConnectForTests(t)
+	teamID := uuid.New().String()
+	attributionID := db.NewTeamAttributionID(teamID)
+	eventID := fmt.Sprintf("evt_%s", uuid.New().String())
+	disputeID := fmt.Sprintf("dp_%s", uuid.New().String())
+
+	dbtest.CreateCostCenters(t, conn, db.CostCenter{ID: attributionID})
+	t.Cleanup(func() {
+		require.NoError(t, conn.Where("eventId = ?", eventID).Delete(&db.StripeWebhookEvent{}).Error)
+		require.NoError(t, conn.Where("attributionId = ?", attributionID).Delete(&db.Usage{}).Error)
+	})
+
+	disputes := &fakeDisputeNotifier{}
+	url := webhookURL(t, conn, fakeStripe{
+		customers: map[string]*stripesdk.Customer{
+			"cus_123": {ID: "cus_123", Metadata: map[string]string{"teamId": teamID}},
+		},
+		charges: map[string]*stripesdk.Charge{
+			"ch_123": {ID: "ch_123", Customer: &stripesdk.Customer{ID: "cus_123"}},
+		},
+	}, disputes)
+	payload := []byte(fmt.Sprintf(`
+{
+  "id": %q,
+  "type": "charge.dispute.created",
+  "data": {
+    "object": {
+      "id": %q,
+      "charge": "ch_123",
+      "amount": 4800,
+      "currency": "usd",
+      "reason": "fraudulent",
+      "created": 1664586000
+    }
+  }
+}
+`, eventID, disputeID))
+
+	resp := sendEvent(t, url, http.MethodPost, payload, generateHeader(payload, testWebhookSecret))
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	costCenter, err := db.GetCostCenter(context.Background(), conn, attributionID)
+	require.NoError(t, err)
+	require.Equal(t, db.CostCenterState_Disputed, costCenter.State)
+
+	usage, err := db.FindUsage(context.Background(), conn, &db.FindUsageParams{
+		AttributionId: attributionID,
+		From:          time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC),
+		To:            time.Date(2022, 11, 1, 0, 0, 0, 0, time.UTC),
+	})
+	require.NoError(t, err)
+	require.Len(t, usage, 1)
+	require.Equal(t, db.DisputeUsageKind, usage[0].Kind)
+	require.Equal(t, db.CreditCents(0), usage[0].CreditCents)
+	require.JSONEq(t, fmt.Sprintf(`{"disputeId": %q, "chargeId": "ch_123", "reason": "fraudulent", "amount": 4800, "currency": "usd"}`, disputeID), string(usage[0].Metadata))
+
+	require.Len(t, disputes.disputes, 1)
+	require.Equal(t, string(attributionID), disputes.disputes[0].AttributionID)
+	require.Equal(t, disputeID, disputes.disputes[0].DisputeID)
+}
+
+func TestWebhookTracksFailedInvoicePayments(t *testing.T) {
+	conn := dbtest.ConnectForTests(t)
+	teamID := uuid.New().String()
+	attributionID := db.NewTeamAttributionID(teamID)
+
+	dbtest.CreateCostCenters(t, conn, db.CostCenter{ID: attributionID})
+
+	url := webhookURL(t, conn, fakeStripe{customers: map[string]*stripesdk.Customer{
+		"cus_123": {ID: "cus_123", Metadata: map[string]string{"teamId": teamID}},
+	}}, nil)
+
+	var eventIDs []string
+	send := func(eventType string, created int64) {
+		eventID := fmt.Sprintf("evt_%s", uuid.New().String())
+		eventIDs = append(eventIDs, eventID)
+		payload := []byte(fmt.Sprintf(`
+{
+  "id": %q,
+  "type": %q,
+  "created": %d,
+  "data": {"object": {"id": "in_123", "customer": "cus_123"}}
+}
+`, eventID, eventType, created))
+		resp := sendEvent(t, url, http.MethodPost, payload, generateHeader(payload, testWebhookSecret))
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+	t.Cleanup(func() {
+		require.NoError(t, conn.Where("eventId IN ?", eventIDs).Delete(&db.StripeWebhookEvent{}).Error)
+	})
+
+	send("invoice.payment_failed", 1664586000)
+	// Stripe retries the payment, which must not restart dunning.
+	send("invoice.payment_failed", 1664845200)
+
+	costCenter, err := db.GetCostCenter(context.Background(), conn, attributionID)
+	require.NoError(t, err)
+	require.Equal(t, time.Unix(1664586000, 0).UTC(), costCenter.PaymentFailedAt.Time())
+
+	send("invoice.paid", 1664931600)
+
+	costCenter, err = db.GetCostCenter(context.Background(), conn, attributionID)
+	require.NoError(t, err)
+	require.False(t, costCenter.PaymentFailedAt.IsSet())
+}
+
+func TestWebhookGrantsPurchasedCredits(t *testing.T) {
+	conn := dbtest.ConnectForTests(t)
+	teamID := uuid.New().String()
+	attributionID := db.NewTeamAttributionID(teamID)
+	paymentIntentID := fmt.Sprintf("pi_%s", uuid.New().String())
+	t.Cleanup(func() {
+		require.NoError(t, conn.Where("attributionId = ?", attributionID).Delete(&db.Usage{}).Error)
+	})
+
+	url := webhookURL(t, conn, fakeStripe{}, nil)
+
+	// Events which report the same payment, e.g. after the processed events expired, must grant the credits once.
+	for i := 0; i < 2; i++ {
+		eventID := fmt.Sprintf("evt_%s", uuid.New().String())
+		t.Cleanup(func() {
+			require.NoError(t, conn.Where("eventId = ?", eventID).Delete(&db.StripeWebhookEvent{}).Error)
+		})
+		payload := []byte(fmt.Sprintf(`
+{
+  "id": %q,
+  "type": "payment_intent.succeeded",
+  "created": 1664586000,
+  "data": {
+    "object": {
+      "id": %q,
+      "amount": 3600,
+      "currency": "usd",
+      "metadata": {"attributionId": %q, "purchasedCredits": "1000"}
+    }
+  }
+}
+`, eventID, paymentIntentID, attributionID))
+		resp := sendEvent(t, url, http.MethodPost, payload, generateHeader(payload, testWebhookSecret))
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	grants, err := db.FindCreditGrants(context.Background(), conn, attributionID)
+	require.NoError(t, err)
+	require.Len(t, grants, 1)
+	require.Equal(t, db.CreditCents(100000), grants[0].Credits())
+	require.Equal(t, time.Unix(1664586000, 0).UTC(), grants[0].EffectiveTime.Time())
+
+	data, err := grants[0].GetMetadataAsCreditGrantData()
+	require.NoError(t, err)
+	require.Equal(t, paymentIntentID, data.PaymentIntentID)
+}
+
+func TestWebhookIgnoresPaymentsOfInvoices(t *testing.T) {
+	url := webhookURL(t, nil, fakeStripe{}, nil)
+	payload := []byte(`{"id": "evt_123", "type": "payment_intent.succeeded", "data": {"object": {"id": "pi_123", "invoice": "in_123"}}}`)
+
+	resp := sendEvent(t, url, http.MethodPost, payload, generateHeader(payload, testWebhookSecret))
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func webhookURL(t *testing.T, conn *gorm.DB, stripeClient StripeClient, disputeNotifier DisputeNotifier) string {
+	t.Helper()
+
+	srv := baseserver.NewForTests(t,
+		baseserver.WithHTTP(baseserver.MustUseRandomLocalAddress(t)),
+	)
+	baseserver.StartServerForTests(t, srv)
+
+	srv.HTTPMux().Handle("/webhook", NewStripeWebhookHandler(conn, stripeClient, testWebhookSecret, disputeNotifier, nil))
+
+	return fmt.Sprintf("%s%s", srv.HTTPAddress(), "/webhook")
+}
+
+func sendEvent(t *testing.T, url, method string, payload []byte, signature string) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, bytes.NewReader(payload))
+	require.NoError(t, err)
+	if signature != "" {
+		req.Header.Set("Stripe-Signature", signature)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	return resp
+}
+
+func generateHeader(payload []byte, secret string) string {
+	now := time.Now()
+	signature := webhook.ComputeSignature(now, payload, secret)
+	return fmt.Sprintf("t=%d,%s=%s", now.Unix(), "v1", hex.EncodeToString(signature))
+}
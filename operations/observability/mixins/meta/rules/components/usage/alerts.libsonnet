@@ -23,6 +23,19 @@
               description: 'We have accumulated {{ printf "%.2f" $value }} failures. This affects how stale usage data is and/or updating invoices in Stripe.',
             },
           },
+          {
+            alert: 'GitpodUsageReportUploadFailures',
+            expr: 'sum by (type) (increase(gitpod_usage_report_object_uploads_total{outcome="error"}[1h])) > 0',
+            'for': '1h',
+            labels: {
+              severity: 'warning',
+              team: 'webapp'
+            },
+            annotations: {
+              summary: 'Usage reports fail to upload to object storage.',
+              description: 'Uploads of {{ $labels.type }} objects of usage reports failed {{ printf "%.0f" $value }} times in the last hour. Finance does not receive the affected reports.',
+            },
+          },
         ],
       },
     ],